@@ -8,17 +8,34 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/pscheit/haproxy-nomad-connector/internal/config"
 	"github.com/pscheit/haproxy-nomad-connector/internal/connector"
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
+	"github.com/pscheit/haproxy-nomad-connector/internal/tracing"
 )
 
+// tracingFlushTimeout bounds the export of the spans still queued on shutdown
+const tracingFlushTimeout = 5 * time.Second
+
 var (
 	version = "dev"
 	commit  = "unknown"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "routes":
+			os.Exit(runRoutes(os.Args[2:]))
+		case "tail-events":
+			os.Exit(runTailEvents(os.Args[2:]))
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		}
+	}
+
 	var (
 		configFile  = flag.String("config", "", "Configuration file path")
 		showVersion = flag.Bool("version", false, "Show version information")
@@ -31,10 +48,14 @@ func main() {
 	}
 
 	// Load configuration
-	cfg, err := config.Load(*configFile)
+	cfg, err := config.ValidateFile(*configFile)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if err := logging.Setup(&cfg.Log, os.Stderr); err != nil {
+		log.Fatalf("Invalid log configuration: %v", err)
+	}
+	shutdownTracing := tracing.Setup(&cfg.Tracing, version)
 
 	log.Printf("Starting haproxy-nomad-connector %s", version)
 	log.Printf("Nomad URL: %s", cfg.Nomad.Address)
@@ -52,18 +73,58 @@ func main() {
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
 
 	// Start connector in background
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		if err := conn.Start(ctx); err != nil {
 			log.Fatalf("Connector failed: %v", err)
 		}
 	}()
 
-	// Wait for shutdown signal
-	<-sigCh
+	// Reload the configuration on SIGHUP until the shutdown signal, then let the connector complete
+	// pending server removals
+	for waiting := true; waiting; {
+		select {
+		case <-reloadCh:
+			if shutdown := reloadConfig(conn, *configFile); shutdown != nil {
+				shutdownTracing = shutdown
+			}
+		case <-sigCh:
+			waiting = false
+		}
+	}
 	log.Println("Shutdown signal received, stopping connector...")
 	cancel()
+	<-done
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Printf("Warning: Failed to export the remaining spans: %v", err)
+	}
 
 	log.Println("haproxy-nomad-connector stopped")
 }
+
+// reloadConfig loads the configuration again and applies the settings that take effect without a
+// restart. An invalid configuration is rejected and the current one is kept. Returns the shutdown
+// function of the reconfigured tracing, nil if the configuration was rejected.
+func reloadConfig(conn *connector.Connector, configFile string) func(context.Context) error {
+	log.Println("SIGHUP received, reloading configuration...")
+	cfg, err := config.ValidateFile(configFile)
+	if err == nil {
+		err = conn.Reload(cfg)
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to reload configuration, keeping the current one: %v", err)
+		return nil
+	}
+	if err := logging.Setup(&cfg.Log, os.Stderr); err != nil {
+		log.Printf("Warning: Failed to apply reloaded log configuration: %v", err)
+	}
+	return tracing.Setup(&cfg.Tracing, version)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/connector"
+)
+
+// runRoutes implements the "routes" subcommand: it fetches the managed routing table
+// from a running connector and prints it as a table, JSON or CSV
+func runRoutes(args []string) int {
+	fs := flag.NewFlagSet("routes", flag.ExitOnError)
+	addr := fs.String("addr", "http://localhost:8080", "Address of the running connector's HTTP server")
+	format := fs.String("format", connector.RouteFormatTable, "Output format: table, json or csv")
+	frontend := fs.String("frontend", "", "Only show rules of this frontend (default: configured frontends)")
+	_ = fs.Parse(args)
+
+	endpoint := *addr + "/routes?format=json"
+	if *frontend != "" {
+		endpoint += "&frontend=" + url.QueryEscape(*frontend)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create request: %v\n", err)
+		return 1
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to fetch routes from %s: %v\n", *addr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Connector returned status %d\n", resp.StatusCode)
+		return 1
+	}
+
+	var routes []connector.Route
+	if err := json.NewDecoder(resp.Body).Decode(&routes); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to decode routes: %v\n", err)
+		return 1
+	}
+
+	if err := connector.WriteRoutes(os.Stdout, routes, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print routes: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/connector"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// runTailEvents implements the "tail-events" subcommand: it follows Nomad's service event stream
+// like the connector does and prints every event with how the connector classifies it
+func runTailEvents(args []string) int {
+	fs := flag.NewFlagSet("tail-events", flag.ExitOnError)
+	configFile := fs.String("config", "", "Configuration file path")
+	format := fs.String("format", connector.EventFormatText, "Output format: text or json")
+	service := fs.String("service", "", "Only show events of this service")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+
+	// Stream status goes to stderr, events to stdout
+	logger := log.New(os.Stderr, "[tail-events] ", log.LstdFlags)
+	client, err := nomad.NewClientWithTLS(cfg.Nomad.Address, cfg.Nomad.Token, cfg.Nomad.Region, nomad.APITLSConfig(&cfg.Nomad.TLS), logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create Nomad client: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	events := make(chan nomad.ServiceEvent, connector.EventChannelBuffer)
+	go func() {
+		if err := client.StreamServiceEvents(ctx, events); err != nil && ctx.Err() == nil {
+			logger.Printf("Event stream ended: %v", err)
+		}
+		stop()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case event := <-events:
+			if *service != "" && event.Payload.Service.ServiceName != *service {
+				continue
+			}
+			classification := connector.ClassifyEvent(&event, &cfg.HAProxy)
+			if err := connector.WriteEvent(os.Stdout, &classification, *format); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to print event: %v\n", err)
+				return 1
+			}
+		}
+	}
+}
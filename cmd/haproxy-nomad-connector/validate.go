@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// runValidate implements the "validate" subcommand: it checks the configuration file together
+// with the environment and prints every problem found, optionally also checking that the
+// configured frontends exist in HAProxy
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configFile := fs.String("config", "", "Configuration file path")
+	checkHAProxy := fs.Bool("check-haproxy", false, "Check that the configured frontends exist on the Data Plane API")
+	_ = fs.Parse(args)
+
+	cfg, err := config.ValidateFile(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *checkHAProxy {
+		if missing := missingFrontends(cfg); len(missing) > 0 {
+			for _, problem := range missing {
+				fmt.Fprintln(os.Stderr, problem)
+			}
+			return 1
+		}
+	}
+
+	fmt.Println("Configuration is valid")
+	return 0
+}
+
+// missingFrontends lists the configured frontends that don't exist on a Data Plane API endpoint.
+// Frontends of domain groups with a port are created on startup and not checked.
+func missingFrontends(cfg *config.Config) []string {
+	frontends := cfg.HAProxy.DefaultFrontends()
+	if cfg.HAProxy.HTTPFrontend != "" {
+		frontends = append(frontends, cfg.HAProxy.HTTPFrontend)
+	}
+	for _, group := range cfg.HAProxy.DomainGroups {
+		if group.Port == 0 {
+			frontends = append(frontends, group.Frontend)
+		}
+	}
+
+	tls := cfg.HAProxy.TLS
+	tlsConfig, err := haproxy.NewTLSConfig(tls.CAFile, tls.CertFile, tls.KeyFile, tls.ServerName, tls.InsecureSkipVerify)
+	if err != nil {
+		return []string{fmt.Sprintf("haproxy.tls: %v", err)}
+	}
+
+	var problems []string
+	for _, instance := range cfg.HAProxy.InstanceConfigs() {
+		options := haproxy.DefaultClientOptions()
+		options.TLSConfig = tlsConfig
+		options.ReadUsername, options.ReadPassword = instance.ReadUsername, instance.ReadPassword
+		client := haproxy.NewClientWithOptions(instance.Address, instance.Username, instance.Password, options)
+		for _, name := range frontends {
+			if _, err := client.GetFrontend(name); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: frontend %q: %v", instance.Name, name, err))
+			}
+		}
+	}
+	return problems
+}
@@ -26,7 +26,7 @@ const (
 // setupCleanSlate restarts HAProxy container to get a completely clean baseline config
 // This is the SIMPLEST and MOST RELIABLE way to ensure no leftover state from previous tests
 // DataPlane API has no "reset to baseline" endpoint, so we just restart the container
-func setupCleanSlate(t *testing.T, client *haproxy.Client) {
+func setupCleanSlate(t *testing.T, client haproxy.ClientInterface) {
 	t.Helper()
 
 	ctx := context.Background()
@@ -96,7 +96,7 @@ func getHAProxyStatsForBackend(t *testing.T, backendName string) string {
 }
 
 // createMisconfiguredBackendForTest creates a backend without health checks to simulate production scenarios
-func createMisconfiguredBackendForTest(t *testing.T, client *haproxy.Client, backendName string) {
+func createMisconfiguredBackendForTest(t *testing.T, client haproxy.ClientInterface, backendName string) {
 	t.Helper()
 
 	version, err := client.GetConfigVersion()
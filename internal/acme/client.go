@@ -0,0 +1,476 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Let's Encrypt directory URLs
+const (
+	LetsEncryptProduction = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStaging    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// ACME object states and content types (RFC 8555)
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusValid      = "valid"
+	StatusInvalid    = "invalid"
+
+	ChallengeTypeHTTP01 = "http-01"
+
+	contentTypeJOSE = "application/jose+json"
+)
+
+// Client configuration constants
+const (
+	DefaultClientTimeoutSec = 30
+	DefaultPollInterval     = 2 * time.Second
+	ecdsaP256KeySize        = 32
+)
+
+// Solver makes HTTP-01 key authorizations available under /.well-known/acme-challenge/<token>
+type Solver interface {
+	Present(token, keyAuthorization string) error
+	CleanUp(token string)
+}
+
+// Client is a minimal ACME (RFC 8555) client supporting HTTP-01 validation with an ECDSA P-256 account key
+type Client struct {
+	directoryURL string
+	key          *ecdsa.PrivateKey
+	httpClient   *http.Client
+	pollInterval time.Duration
+
+	mu        sync.Mutex
+	directory *directory
+	accountID string
+	nonce     string
+}
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	Status         string       `json:"status"`
+	Identifiers    []identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+}
+
+type authorization struct {
+	Status     string      `json:"status"`
+	Identifier identifier  `json:"identifier"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Type   string          `json:"type"`
+	URL    string          `json:"url"`
+	Token  string          `json:"token"`
+	Status string          `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// NewClient creates an ACME client for the given directory URL and account key
+func NewClient(directoryURL string, key *ecdsa.PrivateKey) *Client {
+	return &Client{
+		directoryURL: directoryURL,
+		key:          key,
+		pollInterval: DefaultPollInterval,
+		httpClient: &http.Client{
+			Timeout: DefaultClientTimeoutSec * time.Second,
+		},
+	}
+}
+
+// Register creates the ACME account for the client key, or looks up the existing one
+func (c *Client) Register(ctx context.Context, email string) error {
+	dir, err := c.getDirectory(ctx)
+	if err != nil {
+		return err
+	}
+
+	request := map[string]interface{}{"termsOfServiceAgreed": true}
+	if email != "" {
+		request["contact"] = []string{"mailto:" + email}
+	}
+
+	resp, err := c.post(ctx, dir.NewAccount, request, nil)
+	if err != nil {
+		return fmt.Errorf("failed to register account: %w", err)
+	}
+
+	c.mu.Lock()
+	c.accountID = resp.header.Get("Location")
+	c.mu.Unlock()
+	return nil
+}
+
+// ObtainCertificate orders a certificate for domain, validating it via HTTP-01 through solver.
+// It returns the PEM encoded certificate chain.
+func (c *Client) ObtainCertificate(ctx context.Context, domain string, certKey crypto.Signer, solver Solver) ([]byte, error) {
+	dir, err := c.getDirectory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var o order
+	resp, err := c.post(ctx, dir.NewOrder, map[string]interface{}{
+		"identifiers": []identifier{{Type: "dns", Value: domain}},
+	}, &o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order for %s: %w", domain, err)
+	}
+	orderURL := resp.header.Get("Location")
+
+	for _, authzURL := range o.Authorizations {
+		if err := c.authorize(ctx, authzURL, solver); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, certKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+
+	if _, err := c.post(ctx, o.Finalize, map[string]string{"csr": encode(csr)}, &o); err != nil {
+		return nil, fmt.Errorf("failed to finalize order for %s: %w", domain, err)
+	}
+
+	for o.Status != StatusValid {
+		if o.Status == StatusInvalid {
+			return nil, fmt.Errorf("order for %s became invalid", domain)
+		}
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+		if _, err := c.post(ctx, orderURL, nil, &o); err != nil {
+			return nil, fmt.Errorf("failed to poll order for %s: %w", domain, err)
+		}
+	}
+
+	resp, err = c.post(ctx, o.Certificate, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download certificate for %s: %w", domain, err)
+	}
+	return resp.body, nil
+}
+
+// authorize completes the HTTP-01 challenge of an authorization
+func (c *Client) authorize(ctx context.Context, authzURL string, solver Solver) error {
+	var authz authorization
+	if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if authz.Status == StatusValid {
+		return nil
+	}
+
+	var chal *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == ChallengeTypeHTTP01 {
+			chal = &authz.Challenges[i]
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no %s challenge offered for %s", ChallengeTypeHTTP01, authz.Identifier.Value)
+	}
+
+	thumbprint, err := c.thumbprint()
+	if err != nil {
+		return err
+	}
+	if err := solver.Present(chal.Token, chal.Token+"."+thumbprint); err != nil {
+		return fmt.Errorf("failed to present challenge for %s: %w", authz.Identifier.Value, err)
+	}
+	defer solver.CleanUp(chal.Token)
+
+	if _, err := c.post(ctx, chal.URL, struct{}{}, nil); err != nil {
+		return fmt.Errorf("failed to accept challenge for %s: %w", authz.Identifier.Value, err)
+	}
+
+	for {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+			return fmt.Errorf("failed to poll authorization: %w", err)
+		}
+		switch authz.Status {
+		case StatusValid:
+			return nil
+		case StatusPending, StatusProcessing:
+			continue
+		default:
+			return fmt.Errorf("authorization for %s is %s: %s", authz.Identifier.Value, authz.Status, challengeError(&authz))
+		}
+	}
+}
+
+func challengeError(authz *authorization) string {
+	for _, chal := range authz.Challenges {
+		if len(chal.Error) > 0 {
+			return string(chal.Error)
+		}
+	}
+	return "no error details"
+}
+
+func (c *Client) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.pollInterval):
+		return nil
+	}
+}
+
+func (c *Client) getDirectory(ctx context.Context) (*directory, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.directory != nil {
+		return c.directory, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.directoryURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ACME directory: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ACME directory request failed with status %d", resp.StatusCode)
+	}
+
+	var dir directory
+	if err := json.NewDecoder(resp.Body).Decode(&dir); err != nil {
+		return nil, fmt.Errorf("failed to decode ACME directory: %w", err)
+	}
+	c.directory = &dir
+	return c.directory, nil
+}
+
+func (c *Client) getNonce(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if nonce := c.nonce; nonce != "" {
+		c.nonce = ""
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+
+	dir, err := c.getDirectory(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, dir.NewNonce, http.NoBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get nonce: %w", err)
+	}
+	resp.Body.Close()
+
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("ACME server returned no nonce")
+	}
+	return nonce, nil
+}
+
+type response struct {
+	header http.Header
+	body   []byte
+}
+
+// post sends a JWS signed request. A nil payload sends a POST-as-GET request.
+func (c *Client) post(ctx context.Context, url string, payload, result interface{}) (*response, error) {
+	nonce, err := c.getNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.sign(url, nonce, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentTypeJOSE)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.mu.Lock()
+		c.nonce = nonce
+		c.mu.Unlock()
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("ACME request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return &response{header: resp.Header, body: respBody}, nil
+}
+
+// sign builds a flattened JWS (ES256) for the request. Requests before registration embed the JWK,
+// later requests reference the account URL.
+func (c *Client) sign(url, nonce string, payload interface{}) ([]byte, error) {
+	protected := map[string]interface{}{
+		"alg":   "ES256",
+		"nonce": nonce,
+		"url":   url,
+	}
+
+	c.mu.Lock()
+	accountID := c.accountID
+	c.mu.Unlock()
+	if accountID != "" {
+		protected["kid"] = accountID
+	} else {
+		protected["jwk"] = c.jwk()
+	}
+
+	protectedJSON, err := json.Marshal(protected)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode protected header: %w", err)
+	}
+
+	encodedPayload := ""
+	if payload != nil {
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode payload: %w", err)
+		}
+		encodedPayload = encode(payloadJSON)
+	}
+
+	signingInput := encode(protectedJSON) + "." + encodedPayload
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	signature := make([]byte, 2*ecdsaP256KeySize)
+	r.FillBytes(signature[:ecdsaP256KeySize])
+	s.FillBytes(signature[ecdsaP256KeySize:])
+
+	return json.Marshal(map[string]string{
+		"protected": encode(protectedJSON),
+		"payload":   encodedPayload,
+		"signature": encode(signature),
+	})
+}
+
+// jwk returns the public account key as JWK with members in lexicographic order (RFC 7638)
+func (c *Client) jwk() map[string]string {
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   encode(padCoordinate(c.key.X)),
+		"y":   encode(padCoordinate(c.key.Y)),
+	}
+}
+
+// thumbprint returns the base64url encoded JWK thumbprint used in key authorizations
+func (c *Client) thumbprint() (string, error) {
+	jwkJSON, err := json.Marshal(c.jwk())
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWK: %w", err)
+	}
+	digest := sha256.Sum256(jwkJSON)
+	return encode(digest[:]), nil
+}
+
+func padCoordinate(value *big.Int) []byte {
+	return value.FillBytes(make([]byte, ecdsaP256KeySize))
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// GenerateKey creates a new ECDSA P-256 key for accounts and certificates
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// EncodeKey encodes a private key as PEM
+func EncodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// DecodeKey parses a PEM encoded ECDSA private key
+func DecodeKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,184 @@
+package acme
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSolver struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (s *testSolver) Present(token, keyAuthorization string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = keyAuthorization
+	return nil
+}
+
+func (s *testSolver) CleanUp(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+func (s *testSolver) get(token string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[token]
+}
+
+// fakeACMEServer implements just enough of RFC 8555 for a single-domain HTTP-01 order
+func fakeACMEServer(t *testing.T, solver *testSolver) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	authzStatus := StatusPending
+	var server *httptest.Server
+
+	decodeJWS := func(r *http.Request) (protected map[string]interface{}, payload []byte) {
+		var jws map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+			t.Fatalf("Invalid JWS body: %v", err)
+		}
+		header, _ := base64.RawURLEncoding.DecodeString(jws["protected"])
+		if err := json.Unmarshal(header, &protected); err != nil {
+			t.Fatalf("Invalid protected header: %v", err)
+		}
+		if protected["alg"] != "ES256" || protected["nonce"] == "" || protected["url"] != server.URL+r.URL.Path {
+			t.Errorf("Unexpected protected header %v", protected)
+		}
+		payload, _ = base64.RawURLEncoding.DecodeString(jws["payload"])
+		return protected, payload
+	}
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+
+		if r.URL.Path == "/directory" {
+			_ = json.NewEncoder(w).Encode(directory{
+				NewNonce:   server.URL + "/new-nonce",
+				NewAccount: server.URL + "/new-account",
+				NewOrder:   server.URL + "/new-order",
+			})
+			return
+		}
+		if r.URL.Path == "/new-nonce" {
+			return
+		}
+
+		protected, payload := decodeJWS(r)
+		if r.URL.Path == "/new-account" {
+			if protected["jwk"] == nil {
+				t.Errorf("Expected jwk in account request")
+			}
+			w.Header().Set("Location", server.URL+"/account/1")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"status":"valid"}`))
+			return
+		}
+		if protected["kid"] != server.URL+"/account/1" {
+			t.Errorf("Expected kid after registration, got %v", protected)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		currentOrder := order{
+			Status:         StatusPending,
+			Authorizations: []string{server.URL + "/authz/1"},
+			Finalize:       server.URL + "/finalize/1",
+		}
+
+		switch r.URL.Path {
+		case "/new-order":
+			w.Header().Set("Location", server.URL+"/order/1")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(currentOrder)
+		case "/authz/1":
+			_ = json.NewEncoder(w).Encode(authorization{
+				Status:     authzStatus,
+				Identifier: identifier{Type: "dns", Value: "shop.example.com"},
+				Challenges: []challenge{{Type: ChallengeTypeHTTP01, URL: server.URL + "/challenge/1", Token: "token1"}},
+			})
+		case "/challenge/1":
+			if keyAuth := solver.get("token1"); !strings.HasPrefix(keyAuth, "token1.") {
+				t.Errorf("Expected key authorization to be presented, got %q", keyAuth)
+			}
+			authzStatus = StatusValid
+			_, _ = w.Write([]byte(`{}`))
+		case "/finalize/1":
+			var request map[string]string
+			if err := json.Unmarshal(payload, &request); err != nil || request["csr"] == "" {
+				t.Errorf("Expected CSR in finalize request, got %s", payload)
+			}
+			currentOrder.Status = StatusValid
+			currentOrder.Certificate = server.URL + "/cert/1"
+			_ = json.NewEncoder(w).Encode(currentOrder)
+		case "/cert/1":
+			_, _ = w.Write([]byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"))
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestClient_ObtainCertificate(t *testing.T) {
+	solver := &testSolver{tokens: make(map[string]string)}
+	server := fakeACMEServer(t, solver)
+	defer server.Close()
+
+	accountKey, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	client := NewClient(server.URL+"/directory", accountKey)
+	client.pollInterval = time.Millisecond
+
+	ctx := context.Background()
+	if err := client.Register(ctx, "ops@example.com"); err != nil {
+		t.Fatalf("Register() failed: %v", err)
+	}
+
+	certKey, _ := GenerateKey()
+	chain, err := client.ObtainCertificate(ctx, "shop.example.com", certKey, solver)
+	if err != nil {
+		t.Fatalf("ObtainCertificate() failed: %v", err)
+	}
+	if !strings.Contains(string(chain), "BEGIN CERTIFICATE") {
+		t.Errorf("Expected PEM chain, got %q", chain)
+	}
+	if solver.get("token1") != "" {
+		t.Errorf("Expected challenge to be cleaned up")
+	}
+}
+
+func TestEncodeDecodeKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	data, err := EncodeKey(key)
+	if err != nil {
+		t.Fatalf("EncodeKey() failed: %v", err)
+	}
+	decoded, err := DecodeKey(data)
+	if err != nil {
+		t.Fatalf("DecodeKey() failed: %v", err)
+	}
+	if !decoded.Equal(key) {
+		t.Error("Decoded key does not match")
+	}
+}
@@ -4,37 +4,529 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 )
 
 // Default configuration constants
 const (
-	DefaultDrainTimeoutSec = 10
+	DefaultDrainTimeoutSec      = 10
+	DefaultMaxOverlapWaitSec    = 300
+	DefaultEmptyBackendGraceSec = 300
+	DefaultShutdownTimeoutSec   = 30
+	DefaultSyncTimeoutSec       = 300
+	DefaultSyncProgressInterval = 100
+	DefaultSyncQueueSize        = 10000
+	DefaultACMERenewBeforeDays  = 30
+	DefaultHATTLSec             = 15
+
+	DefaultHAProxyTimeoutSec         = 10
+	DefaultHAProxyCommitTimeoutSec   = 60
+	DefaultHAProxyIdleConnTimeoutSec = 90
+	DefaultHAProxyMaxIdleConns       = 10
+	DefaultHAProxyRetryAttempts      = 3
+	DefaultHAProxyMaxRetryAfterSec   = 30
+	DefaultHAProxyRetryBackoffMs     = 200
+	DefaultHAProxyMaxRetryBackoffMs  = 5000
+	DefaultHAProxyRuntimeTimeoutSec  = 5
+
+	DefaultCircuitBreakerFailureThreshold = 5
+	DefaultCircuitBreakerQueueSize        = 1000
+	DefaultCircuitBreakerMinBackoffSec    = 5
+	DefaultCircuitBreakerMaxBackoffSec    = 300
+
+	DefaultComplexityIntervalSec         = 300
+	DefaultComplexityMaxBackends         = 1000
+	DefaultComplexityMaxLines            = 50000
+	DefaultComplexityMaxRulesPerFrontend = 1000
+
+	DefaultLoggingIntervalSec = 60
+
+	DefaultDNSTimeoutSec = 10
+
+	DefaultHistorySize = 50
+
+	DefaultNotifyFailureThreshold = 3
+	DefaultNotifyDriftProbes      = 3
+	DefaultNotifyMinIntervalSec   = 900
+	DefaultNotifyTimeoutSec       = 10
+
+	// Nomad sends a heartbeat every 10s, a stream without any data this long is dead
+	DefaultStreamStallTimeoutSec = 60
+
+	DefaultNomadTokenRefreshIntervalSec = 60
+
+	DefaultVaultRefreshIntervalSec = 300
+	DefaultVaultTimeoutSec         = 10
 )
 
 type Config struct {
 	Nomad   NomadConfig   `json:"nomad"`
 	HAProxy HAProxyConfig `json:"haproxy"`
 	Log     LogConfig     `json:"log"`
+	Sync    SyncConfig    `json:"sync"`
+	ACME    ACMEConfig    `json:"acme"`
+	DNS     DNSConfig     `json:"dns"`
+	State   StateConfig   `json:"state"`
+	HA      HAConfig      `json:"ha"`
+	History HistoryConfig `json:"history"`
+	Vault   VaultConfig   `json:"vault"`
+
+	Discovery DiscoveryConfig `json:"discovery"`
+	Docker    DockerConfig    `json:"docker"`
+	Tracing   TracingConfig   `json:"tracing"`
+	Admin     AdminConfig     `json:"admin"`
+
+	Notifications NotificationsConfig `json:"notifications"`
+
+	// ManagedServices scopes the connector to a subset of the services
+	ManagedServices ManagedServicesConfig `json:"managed_services"`
+
+	// StaticServices are registered like Nomad services, e.g. legacy VMs sharing domains with Nomad workloads
+	StaticServices []StaticServiceConfig `json:"static_services"`
+
+	// credentialRefs are the env: and vault: references of credential settings, by config key
+	credentialRefs map[string]string
 }
 
 type NomadConfig struct {
-	Address string `json:"address"`
-	Token   string `json:"token"`
-	Region  string `json:"region"`
+	Address                 string `json:"address"`
+	Token                   string `json:"token"`
+	TokenFile               string `json:"token_file"`                 // Read the token from this file, e.g. written by Vault Agent (overrides token)
+	TokenRefreshIntervalSec int    `json:"token_refresh_interval_sec"` // Read the token file again this often to pick up a rotated token (0 = disabled)
+	Region                  string `json:"region"`
+	StreamStallTimeoutSec   int    `json:"stream_stall_timeout_sec"` // Reconnect and resync when the event stream received nothing this long (0 = disabled)
+
+	// WatchNodes follows node drains and node failures to drain and remove the servers of affected
+	// allocations early. The token needs the node:read capability.
+	WatchNodes bool `json:"watch_nodes"`
+
+	// AddressMode selects the address registered for service instances on multi-homed nodes: service
+	// (default, the address of the registration), node (the advertised node IP) or
+	// host_network:<alias> (the node's address in that host network). Node addresses need node:read.
+	AddressMode string `json:"address_mode"`
+
+	// TLS secures the connections to Nomad API addresses served over https, including the event stream
+	TLS TLSConfig `json:"tls"`
+
+	// Clusters are further Nomad clusters or regions watched alongside address, their services share
+	// the HAProxy frontends with those of address
+	Clusters []NomadClusterConfig `json:"clusters"`
+}
+
+// NomadClusterConfig is a further Nomad cluster or region. It uses the TLS, stall timeout and node
+// watch settings of the nomad section.
+type NomadClusterConfig struct {
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Token     string `json:"token"`
+	TokenFile string `json:"token_file"` // Read the token from this file (overrides token)
+	Region    string `json:"region"`
+
+	// BackendPrefix is put in front of the service names of this cluster, so equally named services
+	// of different clusters get their own backends (empty = the servers share the backend)
+	BackendPrefix string `json:"backend_prefix"`
 }
 
 type HAProxyConfig struct {
-	Address         string `json:"address"`
-	Username        string `json:"username"`
-	Password        string `json:"password"`
-	BackendStrategy string `json:"backend_strategy"`
-	DrainTimeoutSec int    `json:"drain_timeout_sec"` // Time to wait before removing drained servers
-	Frontend        string `json:"frontend"`          // Frontend name for domain rules
+	Address           string   `json:"address"`
+	Username          string   `json:"username"`
+	Password          string   `json:"password"`
+	ReadUsername      string   `json:"read_username"` // Read-only credentials for GET requests (default: username/password)
+	ReadPassword      string   `json:"read_password"`
+	BackendStrategy   string   `json:"backend_strategy"`
+	DrainTimeoutSec   int      `json:"drain_timeout_sec"`    // Time to wait before removing drained servers
+	MinOverlapSec     int      `json:"min_overlap_sec"`      // Drain deregistered servers only once another healthy server is up this long (0 = disabled)
+	MaxOverlapWaitSec int      `json:"max_overlap_wait_sec"` // Drain anyway after waiting this long for the overlap
+	ServerSlots       int      `json:"server_slots"`         // Pre-provisioned server slots per dynamic backend, filled without reloads (0 = disabled)
+	Frontend          string   `json:"frontend"`             // Frontend name for domain rules
+	Frontends         []string `json:"frontends"`            // Default frontends for domain rules (overrides frontend)
+	HTTPFrontend      string   `json:"http_frontend"`        // Plain HTTP frontend for haproxy.redirect.https rules
+
+	// ManageFrontendRules false leaves domain rules alone for installations with static routing,
+	// backends and servers are still managed
+	ManageFrontendRules bool `json:"manage_frontend_rules"`
+
+	// HostMatch is how domain ACLs read the Host header: header (default, as sent), strip_port
+	// (without port) or hdr_dom (hdr_dom(host) for exact domains), so clients sending
+	// "Host: example.com:8443" match on frontends with non-standard ports
+	HostMatch string `json:"host_match"`
+
+	// OrphanRuleIntervalSec is how often domain rules the connector created are removed once their
+	// backend is gone or no Nomad service publishes their domain anymore (0 = disabled)
+	OrphanRuleIntervalSec int `json:"orphan_rule_interval_sec"`
+
+	// DeleteEmptyBackends deletes dynamic backends once their last server left and no server
+	// registered for EmptyBackendGraceSec, unless the service is tagged haproxy.backend.keep=true
+	DeleteEmptyBackends  bool `json:"delete_empty_backends"`
+	EmptyBackendGraceSec int  `json:"empty_backend_grace_sec"`
+
+	// ShutdownTimeoutSec is how long pending server removals may take to complete on shutdown,
+	// the remaining ones are persisted and restored on the next start
+	ShutdownTimeoutSec int `json:"shutdown_timeout_sec"`
+
+	// DomainMetrics counts the requests of every domain rule in a stick table, reported by /metrics
+	DomainMetrics bool `json:"domain_metrics"`
+
+	// MaintenanceBackend receives the traffic of domains whose service is tagged haproxy.maint=true
+	// (empty = the domain keeps routing to its servers in maintenance)
+	MaintenanceBackend string `json:"maintenance_backend"`
+
+	// DomainGroups route services to dedicated frontends by domain suffix
+	DomainGroups []DomainGroupConfig `json:"domain_groups"`
+
+	// DefaultBackends set the default_backend of frontends, so a fresh HAProxy can be bootstrapped
+	// without a hand-seeded configuration
+	DefaultBackends []DefaultBackendConfig `json:"default_backends"`
+
+	// BootstrapFrontends are created with their binds when missing, before any rule is published
+	BootstrapFrontends []BootstrapFrontendConfig `json:"bootstrap_frontends"`
+
+	// Instances lists multiple Data Plane API endpoints that are kept in sync (overrides address)
+	Instances   []HAProxyInstanceConfig `json:"instances"`
+	ApplyPolicy string                  `json:"apply_policy"` // all_must_succeed (default), quorum or best_effort
+
+	// Client tunes the HTTP connections to the Data Plane API
+	Client HAProxyClientConfig `json:"client"`
+
+	// TLS secures the connections to Data Plane API endpoints served over https, e.g. with mutual TLS
+	TLS TLSConfig `json:"tls"`
+
+	// Runtime sends server state changes over the HAProxy stats socket next to the Data Plane API
+	Runtime HAProxyRuntimeConfig `json:"runtime"`
+
+	// Complexity sets how often the configuration size is measured and when it is warned about
+	Complexity HAProxyComplexityConfig `json:"complexity"`
+
+	// Logging enforces per-request logging on the managed frontends
+	Logging HAProxyLoggingConfig `json:"logging"`
+
+	// CircuitBreaker holds events back while the Data Plane API keeps failing
+	CircuitBreaker HAProxyCircuitBreakerConfig `json:"circuit_breaker"`
+}
+
+// HAProxyClientConfig tunes the HTTP connections to the Data Plane API
+type HAProxyClientConfig struct {
+	TimeoutSec         int  `json:"timeout_sec"`           // Timeout of regular requests such as version reads
+	CommitTimeoutSec   int  `json:"commit_timeout_sec"`    // Timeout of transaction commits, which reload HAProxy
+	KeepAlive          bool `json:"keep_alive"`            // Reuse connections between requests
+	IdleConnTimeoutSec int  `json:"idle_conn_timeout_sec"` // Close idle keep-alive connections after this many seconds
+	MaxIdleConns       int  `json:"max_idle_conns"`        // Idle keep-alive connections kept open
+	RetryAttempts      int  `json:"retry_attempts"`        // Retries of failed requests (0 = disabled)
+	MaxRetryAfterSec   int  `json:"max_retry_after_sec"`   // Upper bound for the wait requested via Retry-After
+	RetryBackoffMs     int  `json:"retry_backoff_ms"`      // Wait before the first retry, doubled with every further retry
+	MaxRetryBackoffMs  int  `json:"max_retry_backoff_ms"`  // Upper bound for the exponential backoff
+}
+
+// HAProxyCircuitBreakerConfig stops applying events once they keep failing on an unreachable Data
+// Plane API. The events are queued until the API answers again, then replayed and followed by a
+// full resync that also covers the events dropped from a full queue.
+type HAProxyCircuitBreakerConfig struct {
+	FailureThreshold int `json:"failure_threshold"` // Open after this many events in a row failed and the API doesn't answer (0 = disabled)
+	QueueSize        int `json:"queue_size"`        // Events held back while open, the oldest are dropped beyond
+	MinBackoffSec    int `json:"min_backoff_sec"`   // Wait before the first recovery probe, doubled after every failed probe
+	MaxBackoffSec    int `json:"max_backoff_sec"`   // Upper bound of the wait between recovery probes
+}
+
+// HAProxyRuntimeConfig is the stats socket (stats socket ... level admin) of the HAProxy behind the
+// Data Plane API. Server state changes (ready, drain, maint) don't need a reload and can be sent
+// over the socket directly.
+type HAProxyRuntimeConfig struct {
+	Socket     string `json:"socket"`      // unix socket path or tcp://host:port (empty = disabled)
+	Mode       string `json:"mode"`        // fallback (default): when the Data Plane API fails, prefer: socket first
+	TimeoutSec int    `json:"timeout_sec"` // Timeout of a single socket command
+}
+
+// TLSConfig sets up TLS connections to an API. The CA bundle replaces the system roots, the client
+// certificate is presented to servers that require mutual TLS.
+type TLSConfig struct {
+	CAFile             string `json:"ca_file"`              // PEM bundle of the CAs the server certificate is verified with
+	CertFile           string `json:"cert_file"`            // PEM client certificate for mutual TLS
+	KeyFile            string `json:"key_file"`             // PEM key of the client certificate
+	ServerName         string `json:"server_name"`          // Name the server certificate is verified against (default: host of the address)
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // Don't verify the server certificate (testing only)
+}
+
+// HAProxyComplexityConfig sets thresholds for the size of the HAProxy configuration. Large
+// configurations slow down reloads, so the connector warns before they become a problem.
+type HAProxyComplexityConfig struct {
+	IntervalSec         int `json:"interval_sec"`           // How often the raw configuration is measured (0 = disabled)
+	MaxBackends         int `json:"max_backends"`           // Warn above this many backends (0 = no limit)
+	MaxLines            int `json:"max_lines"`              // Warn above this many configuration lines (0 = no limit)
+	MaxRulesPerFrontend int `json:"max_rules_per_frontend"` // Warn above this many ACLs and rules in a frontend (0 = no limit)
+}
+
+// HAProxyLoggingConfig makes the connector keep the log settings of its frontends as configured.
+// Without log_format, http frontends get option httplog and tcp frontends option tcplog.
+type HAProxyLoggingConfig struct {
+	Enforce     bool   `json:"enforce"`
+	LogFormat   string `json:"log_format"`   // Custom log-format for all managed frontends (replaces the log options)
+	IntervalSec int    `json:"interval_sec"` // How often drift of the log settings is repaired
+}
+
+// DomainGroupConfig describes a frontend that is dedicated to all domains with a given suffix,
+// e.g. *.internal.company.com on its own bind and certificate
+type DomainGroupConfig struct {
+	Suffix      string `json:"suffix"`       // Domain suffix, e.g. "*.internal.company.com" or ".internal.company.com"
+	Frontend    string `json:"frontend"`     // Name of the frontend managed for this group
+	BindAddress string `json:"bind_address"` // Bind address (default: *)
+	Port        int    `json:"port"`         // Bind port; the frontend is created when set
+	Certificate string `json:"certificate"`  // Certificate file or directory; enables ssl on the bind
+}
+
+// DefaultBackendConfig is the backend requests go to that no rule of a frontend routes. The connector
+// creates the backend when it answers with a status, and the frontend when it has a port.
+type DefaultBackendConfig struct {
+	Frontend    string `json:"frontend"`
+	Backend     string `json:"backend"`
+	Status      int    `json:"status"`       // The backend answers every request with this status, e.g. 404 (0 = existing backend)
+	BindAddress string `json:"bind_address"` // Bind address (default: *)
+	Port        int    `json:"port"`         // Bind port; the frontend is created when set
+	Certificate string `json:"certificate"`  // Certificate file or directory; enables ssl on the bind
+}
+
+// BootstrapFrontendConfig is a frontend the connector creates when it doesn't exist. An existing
+// frontend of the same name is left as it is.
+type BootstrapFrontendConfig struct {
+	Name           string       `json:"name"`
+	Mode           string       `json:"mode"`            // http (default) or tcp
+	DefaultBackend string       `json:"default_backend"` // Backend of requests no rule routes (empty = none)
+	Binds          []BindConfig `json:"binds"`
+}
+
+// BindConfig is a bind directive of a bootstrapped frontend
+type BindConfig struct {
+	Address     string `json:"address"`     // Bind address (default: *)
+	Port        int    `json:"port"`        // Bind port
+	Certificate string `json:"certificate"` // Certificate file or directory; enables ssl on the bind
+}
+
+// HAProxyInstanceConfig describes one Data Plane API endpoint when managing multiple HAProxy instances.
+// Empty credentials fall back to the top-level haproxy credentials.
+type HAProxyInstanceConfig struct {
+	Name         string `json:"name"`
+	Address      string `json:"address"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	ReadUsername string `json:"read_username"`
+	ReadPassword string `json:"read_password"`
+
+	RuntimeSocket string `json:"runtime_socket"` // Stats socket of this instance's HAProxy (see haproxy.runtime)
+}
+
+// InstanceConfigs returns all Data Plane API endpoints to manage, with credentials and names filled in
+func (h *HAProxyConfig) InstanceConfigs() []HAProxyInstanceConfig {
+	if len(h.Instances) == 0 {
+		return []HAProxyInstanceConfig{{
+			Name:         h.Address,
+			Address:      h.Address,
+			Username:     h.Username,
+			Password:     h.Password,
+			ReadUsername: h.ReadUsername,
+			ReadPassword: h.ReadPassword,
+
+			RuntimeSocket: h.Runtime.Socket,
+		}}
+	}
+
+	instances := make([]HAProxyInstanceConfig, len(h.Instances))
+	for i, instance := range h.Instances {
+		if instance.Name == "" {
+			instance.Name = instance.Address
+		}
+		if instance.Username == "" {
+			instance.Username = h.Username
+		}
+		if instance.Password == "" {
+			instance.Password = h.Password
+		}
+		if instance.ReadUsername == "" {
+			instance.ReadUsername, instance.ReadPassword = h.ReadUsername, h.ReadPassword
+		}
+		instances[i] = instance
+	}
+	return instances
+}
+
+// DefaultFrontends returns the frontends domain rules are published to when a service
+// does not select frontends itself via the haproxy.frontend tag
+func (h *HAProxyConfig) DefaultFrontends() []string {
+	if len(h.Frontends) > 0 {
+		return h.Frontends
+	}
+	if h.Frontend == "" {
+		return nil
+	}
+	return []string{h.Frontend}
 }
 
 type LogConfig struct {
-	Level string `json:"level"`
+	Level  string `json:"level"`  // debug, info (default), warn or error
+	Format string `json:"format"` // text (default) or json
+
+	// Modules overrides the level per module (main, connector, haproxy, nomad), e.g. {"haproxy": "debug"}
+	Modules map[string]string `json:"modules"`
+}
+
+// SyncConfig controls the initial sync of existing Nomad services on startup
+type SyncConfig struct {
+	TimeoutSec       int  `json:"timeout_sec"`        // Give up the initial sync after this many seconds (0 = no limit)
+	ProgressInterval int  `json:"progress_interval"`  // Log progress every N services (0 = disabled)
+	ReadyWithoutSync bool `json:"ready_without_sync"` // Report healthy before the initial sync has completed
+	BatchWindowMs    int  `json:"batch_window_ms"`    // Coalesce events arriving within this window (0 = process each event on its own)
+	EventWorkers     int  `json:"event_workers"`      // Process up to this many events of different backends and frontends concurrently (1 = serial)
+	QueueSize        int  `json:"queue_size"`         // Events buffered for processing, the oldest are dropped beyond and caught up by a resync
+	PersistQueue     bool `json:"persist_queue"`      // Keep the unprocessed events in the state store and replay them on the next start
+
+	// Dependencies maps a service name to the services it depends on (e.g. fallback targets),
+	// in addition to haproxy.depends_on tags. Dependencies are synced first.
+	Dependencies map[string][]string `json:"dependencies"`
+}
+
+// ACMEConfig enables automatic certificates for service domains via ACME HTTP-01
+type ACMEConfig struct {
+	Enabled          bool   `json:"enabled"`
+	DirectoryURL     string `json:"directory_url"`     // ACME directory (default: Let's Encrypt production)
+	Email            string `json:"email"`             // Account contact
+	ChallengeListen  string `json:"challenge_listen"`  // Listen address of the connector's challenge server
+	ChallengeAddress string `json:"challenge_address"` // host:port HAProxy uses to reach the challenge server
+	RenewBeforeDays  int    `json:"renew_before_days"` // Renew certificates expiring within this many days
+}
+
+// DNSConfig enables managing the DNS records of service domains through an external provider
+type DNSConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Provider   string `json:"provider"`    // webhook (default) or exec
+	WebhookURL string `json:"webhook_url"` // Receives record changes as JSON POST requests
+	Command    string `json:"command"`     // Executable called with <action> <domain> <type> <target>
+	RecordType string `json:"record_type"` // A (default) or CNAME
+	Target     string `json:"target"`      // Load balancer IP (A) or hostname (CNAME) the records point at
+	TimeoutSec int    `json:"timeout_sec"` // Timeout of a single record change
+}
+
+// StateConfig selects where the connector persists its state (e.g. the ACME account key).
+// Shared backends (consul, nomad) let HA deployments use the same state without a shared disk.
+type StateConfig struct {
+	Backend       string `json:"backend"`        // file (default), consul or nomad
+	Dir           string `json:"dir"`            // Directory of the file backend
+	Prefix        string `json:"prefix"`         // Consul KV prefix or Nomad variable path
+	ConsulAddress string `json:"consul_address"` // Consul HTTP API address
+	ConsulToken   string `json:"consul_token"`   // Consul ACL token
+}
+
+// HAConfig enables active/standby operation: connector instances compete for a lock and only
+// the leader mutates HAProxy, a standby takes over once the leader's lease expires
+type HAConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Backend  string `json:"backend"`   // nomad (default, variable lock) or consul (session lock, uses the state consul settings)
+	LockPath string `json:"lock_path"` // Nomad variable path or Consul KV key of the lock
+	TTLSec   int    `json:"ttl_sec"`   // Lease TTL; a standby takes over at most this long after the leader failed
+}
+
+// DiscoveryConfig selects where the connector discovers services
+type DiscoveryConfig struct {
+	Source           string `json:"source"`            // nomad (default, Nomad native services) or consul (catalog)
+	ConsulAddress    string `json:"consul_address"`    // Consul HTTP API address of the catalog
+	ConsulToken      string `json:"consul_token"`      // Consul ACL token with service:read and node:read
+	ConsulDatacenter string `json:"consul_datacenter"` // Datacenter of the Consul catalog (default: the agent's)
+}
+
+// DockerConfig adds the containers of a Docker or Podman host with haproxy.* labels to the
+// discovered services, e.g. for a few containers running outside Nomad behind the same HAProxy
+type DockerConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Host        string `json:"host"`         // Engine API, unix:///var/run/docker.sock (default), unix:///run/podman/podman.sock or tcp://host:port
+	HostAddress string `json:"host_address"` // Address HAProxy reaches published container ports at (default: the container address)
+}
+
+// TracingConfig exports OpenTelemetry traces of the event processing over OTLP/HTTP
+type TracingConfig struct {
+	Enabled     bool              `json:"enabled"`
+	Endpoint    string            `json:"endpoint"`     // OTLP/HTTP endpoint of the collector, spans are POSTed to <endpoint>/v1/traces
+	Headers     map[string]string `json:"headers"`      // Sent with every export, e.g. the API key of a tracing backend
+	ServiceName string            `json:"service_name"` // service.name of the exported spans
+	SampleRatio float64           `json:"sample_ratio"` // Share of events traced, 0 < ratio <= 1 (default 1)
+}
+
+// AdminConfig protects the endpoints that change HAProxy or the connector: drain/ready/maint and
+// pause/resume of services and the resync. They are served on the admin listener, by default only
+// reachable from the host; on the health server they need the token.
+type AdminConfig struct {
+	Token  string `json:"token"`  // Bearer token the admin endpoints require, on the admin listener too when set
+	Listen string `json:"listen"` // Listen address of the admin server (empty = disabled)
+}
+
+// NotificationsConfig alerts webhooks about problems that otherwise only show in the logs: repeated
+// event processing failures, drift that persists and an unreachable Data Plane API
+type NotificationsConfig struct {
+	Enabled          bool     `json:"enabled"`
+	WebhookURLs      []string `json:"webhook_urls"`       // Receive alerts as JSON POST requests
+	SlackWebhookURLs []string `json:"slack_webhook_urls"` // Slack incoming webhooks, receive alerts as messages
+	FailureThreshold int      `json:"failure_threshold"`  // Alert after this many consecutive failed events
+	DriftProbes      int      `json:"drift_probes"`       // Alert after drift was found by this many consecutive probes
+	MinIntervalSec   int      `json:"min_interval_sec"`   // Repeat an alert of the same kind at most once per interval
+	TimeoutSec       int      `json:"timeout_sec"`        // Timeout of a single webhook request
+}
+
+// ManagedServicesConfig selects the services the connector manages by glob patterns. A pattern
+// matches the service name, or with a name:, job: or namespace: prefix that field of the service,
+// e.g. "job:team-a-*". Without allow patterns all services are allowed; deny patterns win.
+type ManagedServicesConfig struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// Fields matched by managed service patterns
+const (
+	ServicePatternName      = "name"
+	ServicePatternJob       = "job"
+	ServicePatternNamespace = "namespace"
+)
+
+// Manages checks if a service with this name, job ID and namespace is in scope of the connector
+func (m *ManagedServicesConfig) Manages(name, jobID, namespace string) bool {
+	fields := map[string]string{
+		ServicePatternName:      name,
+		ServicePatternJob:       jobID,
+		ServicePatternNamespace: namespace,
+	}
+	matchesAny := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			field, glob := splitServicePattern(pattern)
+			if matched, _ := path.Match(glob, fields[field]); matched {
+				return true
+			}
+		}
+		return false
+	}
+	if len(m.Allow) > 0 && !matchesAny(m.Allow) {
+		return false
+	}
+	return !matchesAny(m.Deny)
+}
+
+// splitServicePattern splits a managed service pattern into the matched field and the glob
+func splitServicePattern(pattern string) (field, glob string) {
+	if field, glob, ok := strings.Cut(pattern, ":"); ok {
+		return field, glob
+	}
+	return ServicePatternName, pattern
+}
+
+// StaticServiceConfig is a service instance outside Nomad that the connector registers and maintains
+// like a Nomad service. haproxy.enable=true is implied.
+type StaticServiceConfig struct {
+	Name    string   `json:"name"`
+	Address string   `json:"address"`
+	Port    int      `json:"port"`
+	Tags    []string `json:"tags"`
+}
+
+// HistoryConfig controls the per-service event history served by the admin API
+type HistoryConfig struct {
+	Size    int  `json:"size"`    // Events kept per service (0 = disabled)
+	Persist bool `json:"persist"` // Keep the history in the state store across restarts
 }
 
 // Load configuration from file or environment variables
@@ -42,20 +534,175 @@ func Load(configFile string) (*Config, error) {
 	cfg := &Config{
 		// Default values
 		Nomad: NomadConfig{
-			Address: getEnv("NOMAD_ADDR", "http://localhost:4646"),
-			Token:   getEnv("NOMAD_TOKEN", ""),
-			Region:  getEnv("NOMAD_REGION", "global"),
+			Address:                 getEnv("NOMAD_ADDR", "http://localhost:4646"),
+			Token:                   getEnv("NOMAD_TOKEN", ""),
+			TokenFile:               getEnv("NOMAD_TOKEN_FILE", ""),
+			TokenRefreshIntervalSec: getEnvInt("NOMAD_TOKEN_REFRESH_INTERVAL_SEC", DefaultNomadTokenRefreshIntervalSec),
+			Region:                  getEnv("NOMAD_REGION", "global"),
+			StreamStallTimeoutSec:   getEnvInt("NOMAD_STREAM_STALL_TIMEOUT_SEC", DefaultStreamStallTimeoutSec),
+			WatchNodes:              getEnvBool("NOMAD_WATCH_NODES", false),
+			AddressMode:             getEnv("NOMAD_ADDRESS_MODE", "service"),
+			// The environment variables of the Nomad CLI
+			TLS: TLSConfig{
+				CAFile:             getEnv("NOMAD_CACERT", ""),
+				CertFile:           getEnv("NOMAD_CLIENT_CERT", ""),
+				KeyFile:            getEnv("NOMAD_CLIENT_KEY", ""),
+				ServerName:         getEnv("NOMAD_TLS_SERVER_NAME", ""),
+				InsecureSkipVerify: getEnvBool("NOMAD_SKIP_VERIFY", false),
+			},
 		},
 		HAProxy: HAProxyConfig{
-			Address:         getEnv("HAPROXY_DATAPLANE_URL", "http://localhost:5555"),
-			Username:        getEnv("HAPROXY_USERNAME", "admin"),
-			Password:        getEnv("HAPROXY_PASSWORD", "adminpwd"),
-			BackendStrategy: getEnv("HAPROXY_BACKEND_STRATEGY", "use_existing"),
-			DrainTimeoutSec: getEnvInt("HAPROXY_DRAIN_TIMEOUT_SEC", DefaultDrainTimeoutSec),
-			Frontend:        getEnv("HAPROXY_FRONTEND", "https"),
+			Address:           getEnv("HAPROXY_DATAPLANE_URL", "http://localhost:5555"),
+			Username:          getEnv("HAPROXY_USERNAME", "admin"),
+			Password:          getEnv("HAPROXY_PASSWORD", "adminpwd"),
+			ReadUsername:      getEnv("HAPROXY_READ_USERNAME", ""),
+			ReadPassword:      getEnv("HAPROXY_READ_PASSWORD", ""),
+			BackendStrategy:   getEnv("HAPROXY_BACKEND_STRATEGY", "use_existing"),
+			DrainTimeoutSec:   getEnvInt("HAPROXY_DRAIN_TIMEOUT_SEC", DefaultDrainTimeoutSec),
+			MinOverlapSec:     getEnvInt("HAPROXY_MIN_OVERLAP_SEC", 0),
+			MaxOverlapWaitSec: getEnvInt("HAPROXY_MAX_OVERLAP_WAIT_SEC", DefaultMaxOverlapWaitSec),
+			ServerSlots:       getEnvInt("HAPROXY_SERVER_SLOTS", 0),
+			Frontend:          getEnv("HAPROXY_FRONTEND", "https"),
+			Frontends:         getEnvList("HAPROXY_FRONTENDS"),
+			HTTPFrontend:      getEnv("HAPROXY_HTTP_FRONTEND", "http"),
+			ApplyPolicy:       getEnv("HAPROXY_APPLY_POLICY", "all_must_succeed"),
+			Client: HAProxyClientConfig{
+				TimeoutSec:         getEnvInt("HAPROXY_CLIENT_TIMEOUT_SEC", DefaultHAProxyTimeoutSec),
+				CommitTimeoutSec:   getEnvInt("HAPROXY_CLIENT_COMMIT_TIMEOUT_SEC", DefaultHAProxyCommitTimeoutSec),
+				KeepAlive:          getEnvBool("HAPROXY_CLIENT_KEEP_ALIVE", true),
+				IdleConnTimeoutSec: getEnvInt("HAPROXY_CLIENT_IDLE_CONN_TIMEOUT_SEC", DefaultHAProxyIdleConnTimeoutSec),
+				MaxIdleConns:       getEnvInt("HAPROXY_CLIENT_MAX_IDLE_CONNS", DefaultHAProxyMaxIdleConns),
+				RetryAttempts:      getEnvInt("HAPROXY_CLIENT_RETRY_ATTEMPTS", DefaultHAProxyRetryAttempts),
+				MaxRetryAfterSec:   getEnvInt("HAPROXY_CLIENT_MAX_RETRY_AFTER_SEC", DefaultHAProxyMaxRetryAfterSec),
+				RetryBackoffMs:     getEnvInt("HAPROXY_CLIENT_RETRY_BACKOFF_MS", DefaultHAProxyRetryBackoffMs),
+				MaxRetryBackoffMs:  getEnvInt("HAPROXY_CLIENT_MAX_RETRY_BACKOFF_MS", DefaultHAProxyMaxRetryBackoffMs),
+			},
+			TLS: TLSConfig{
+				CAFile:             getEnv("HAPROXY_TLS_CA_FILE", ""),
+				CertFile:           getEnv("HAPROXY_TLS_CERT_FILE", ""),
+				KeyFile:            getEnv("HAPROXY_TLS_KEY_FILE", ""),
+				ServerName:         getEnv("HAPROXY_TLS_SERVER_NAME", ""),
+				InsecureSkipVerify: getEnvBool("HAPROXY_TLS_INSECURE_SKIP_VERIFY", false),
+			},
+			CircuitBreaker: HAProxyCircuitBreakerConfig{
+				FailureThreshold: getEnvInt("HAPROXY_CIRCUIT_BREAKER_FAILURE_THRESHOLD", DefaultCircuitBreakerFailureThreshold),
+				QueueSize:        getEnvInt("HAPROXY_CIRCUIT_BREAKER_QUEUE_SIZE", DefaultCircuitBreakerQueueSize),
+				MinBackoffSec:    getEnvInt("HAPROXY_CIRCUIT_BREAKER_MIN_BACKOFF_SEC", DefaultCircuitBreakerMinBackoffSec),
+				MaxBackoffSec:    getEnvInt("HAPROXY_CIRCUIT_BREAKER_MAX_BACKOFF_SEC", DefaultCircuitBreakerMaxBackoffSec),
+			},
+			Runtime: HAProxyRuntimeConfig{
+				Socket:     getEnv("HAPROXY_RUNTIME_SOCKET", ""),
+				Mode:       getEnv("HAPROXY_RUNTIME_MODE", "fallback"),
+				TimeoutSec: getEnvInt("HAPROXY_RUNTIME_TIMEOUT_SEC", DefaultHAProxyRuntimeTimeoutSec),
+			},
+			Complexity: HAProxyComplexityConfig{
+				IntervalSec:         getEnvInt("HAPROXY_COMPLEXITY_INTERVAL_SEC", DefaultComplexityIntervalSec),
+				MaxBackends:         getEnvInt("HAPROXY_COMPLEXITY_MAX_BACKENDS", DefaultComplexityMaxBackends),
+				MaxLines:            getEnvInt("HAPROXY_COMPLEXITY_MAX_LINES", DefaultComplexityMaxLines),
+				MaxRulesPerFrontend: getEnvInt("HAPROXY_COMPLEXITY_MAX_RULES_PER_FRONTEND", DefaultComplexityMaxRulesPerFrontend),
+			},
+			Logging: HAProxyLoggingConfig{
+				Enforce:     getEnvBool("HAPROXY_LOGGING_ENFORCE", false),
+				LogFormat:   getEnv("HAPROXY_LOGGING_LOG_FORMAT", ""),
+				IntervalSec: getEnvInt("HAPROXY_LOGGING_INTERVAL_SEC", DefaultLoggingIntervalSec),
+			},
+			ManageFrontendRules:   getEnvBool("HAPROXY_MANAGE_FRONTEND_RULES", true),
+			HostMatch:             getEnv("HAPROXY_HOST_MATCH", "header"),
+			OrphanRuleIntervalSec: getEnvInt("HAPROXY_ORPHAN_RULE_INTERVAL_SEC", 0),
+			ShutdownTimeoutSec:    getEnvInt("HAPROXY_SHUTDOWN_TIMEOUT_SEC", DefaultShutdownTimeoutSec),
+			DomainMetrics:         getEnvBool("HAPROXY_DOMAIN_METRICS", false),
+			MaintenanceBackend:    getEnv("HAPROXY_MAINTENANCE_BACKEND", ""),
+			DeleteEmptyBackends:   getEnvBool("HAPROXY_DELETE_EMPTY_BACKENDS", false),
+			EmptyBackendGraceSec:  getEnvInt("HAPROXY_EMPTY_BACKEND_GRACE_SEC", DefaultEmptyBackendGraceSec),
 		},
 		Log: LogConfig{
-			Level: getEnv("LOG_LEVEL", "info"),
+			Level:   getEnv("LOG_LEVEL", "info"),
+			Format:  getEnv("LOG_FORMAT", "text"),
+			Modules: getEnvMap("LOG_MODULES"),
+		},
+		Sync: SyncConfig{
+			TimeoutSec:       getEnvInt("SYNC_TIMEOUT_SEC", DefaultSyncTimeoutSec),
+			ProgressInterval: getEnvInt("SYNC_PROGRESS_INTERVAL", DefaultSyncProgressInterval),
+			ReadyWithoutSync: getEnvBool("SYNC_READY_WITHOUT_SYNC", false),
+			BatchWindowMs:    getEnvInt("SYNC_BATCH_WINDOW_MS", 0),
+			EventWorkers:     getEnvInt("SYNC_EVENT_WORKERS", 1),
+			QueueSize:        getEnvInt("SYNC_QUEUE_SIZE", DefaultSyncQueueSize),
+			PersistQueue:     getEnvBool("SYNC_PERSIST_QUEUE", false),
+		},
+		ACME: ACMEConfig{
+			Enabled:          getEnvBool("ACME_ENABLED", false),
+			DirectoryURL:     getEnv("ACME_DIRECTORY_URL", "https://acme-v02.api.letsencrypt.org/directory"),
+			Email:            getEnv("ACME_EMAIL", ""),
+			ChallengeListen:  getEnv("ACME_CHALLENGE_LISTEN", ":8402"),
+			ChallengeAddress: getEnv("ACME_CHALLENGE_ADDRESS", "127.0.0.1:8402"),
+			RenewBeforeDays:  getEnvInt("ACME_RENEW_BEFORE_DAYS", DefaultACMERenewBeforeDays),
+		},
+		DNS: DNSConfig{
+			Enabled:    getEnvBool("DNS_ENABLED", false),
+			Provider:   getEnv("DNS_PROVIDER", "webhook"),
+			WebhookURL: getEnv("DNS_WEBHOOK_URL", ""),
+			Command:    getEnv("DNS_COMMAND", ""),
+			RecordType: getEnv("DNS_RECORD_TYPE", "A"),
+			Target:     getEnv("DNS_TARGET", ""),
+			TimeoutSec: getEnvInt("DNS_TIMEOUT_SEC", DefaultDNSTimeoutSec),
+		},
+		State: StateConfig{
+			Backend:       getEnv("STATE_BACKEND", "file"),
+			Dir:           getEnv("STATE_DIR", "/var/lib/haproxy-nomad-connector"),
+			Prefix:        getEnv("STATE_PREFIX", "haproxy-nomad-connector"),
+			ConsulAddress: getEnv("CONSUL_HTTP_ADDR", "http://localhost:8500"),
+			ConsulToken:   getEnv("CONSUL_HTTP_TOKEN", ""),
+		},
+		HA: HAConfig{
+			Enabled:  getEnvBool("HA_ENABLED", false),
+			Backend:  getEnv("HA_BACKEND", "nomad"),
+			LockPath: getEnv("HA_LOCK_PATH", "haproxy-nomad-connector/leader"),
+			TTLSec:   getEnvInt("HA_TTL_SEC", DefaultHATTLSec),
+		},
+		History: HistoryConfig{
+			Size:    getEnvInt("HISTORY_SIZE", DefaultHistorySize),
+			Persist: getEnvBool("HISTORY_PERSIST", false),
+		},
+		Vault: VaultConfig{
+			Address:            getEnv("VAULT_ADDR", ""),
+			Token:              getEnv("VAULT_TOKEN", ""),
+			RefreshIntervalSec: getEnvInt("VAULT_REFRESH_INTERVAL_SEC", DefaultVaultRefreshIntervalSec),
+			TimeoutSec:         getEnvInt("VAULT_TIMEOUT_SEC", DefaultVaultTimeoutSec),
+		},
+		Discovery: DiscoveryConfig{
+			Source:           getEnv("DISCOVERY_SOURCE", "nomad"),
+			ConsulAddress:    getEnv("DISCOVERY_CONSUL_ADDRESS", getEnv("CONSUL_HTTP_ADDR", "http://localhost:8500")),
+			ConsulToken:      getEnv("DISCOVERY_CONSUL_TOKEN", getEnv("CONSUL_HTTP_TOKEN", "")),
+			ConsulDatacenter: getEnv("DISCOVERY_CONSUL_DATACENTER", ""),
+		},
+		Docker: DockerConfig{
+			Enabled:     getEnvBool("DOCKER_ENABLED", false),
+			Host:        getEnv("DOCKER_HOST", "unix:///var/run/docker.sock"),
+			HostAddress: getEnv("DOCKER_HOST_ADDRESS", ""),
+		},
+		Tracing: TracingConfig{
+			Enabled:     getEnvBool("TRACING_ENABLED", false),
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+			Headers:     getEnvMap("OTEL_EXPORTER_OTLP_HEADERS"),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "haproxy-nomad-connector"),
+			SampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+		},
+		Admin: AdminConfig{
+			Token:  getEnv("ADMIN_TOKEN", ""),
+			Listen: getEnv("ADMIN_LISTEN", "127.0.0.1:8081"),
+		},
+		Notifications: NotificationsConfig{
+			Enabled:          getEnvBool("NOTIFY_ENABLED", false),
+			WebhookURLs:      getEnvList("NOTIFY_WEBHOOK_URLS"),
+			SlackWebhookURLs: getEnvList("NOTIFY_SLACK_WEBHOOK_URLS"),
+			FailureThreshold: getEnvInt("NOTIFY_FAILURE_THRESHOLD", DefaultNotifyFailureThreshold),
+			DriftProbes:      getEnvInt("NOTIFY_DRIFT_PROBES", DefaultNotifyDriftProbes),
+			MinIntervalSec:   getEnvInt("NOTIFY_MIN_INTERVAL_SEC", DefaultNotifyMinIntervalSec),
+			TimeoutSec:       getEnvInt("NOTIFY_TIMEOUT_SEC", DefaultNotifyTimeoutSec),
+		},
+		ManagedServices: ManagedServicesConfig{
+			Allow: getEnvList("MANAGED_SERVICES_ALLOW"),
+			Deny:  getEnvList("MANAGED_SERVICES_DENY"),
 		},
 	}
 
@@ -67,8 +714,32 @@ func Load(configFile string) (*Config, error) {
 		}
 
 		if err := json.Unmarshal(data, cfg); err != nil {
-			return nil, fmt.Errorf("failed to parse config file: %w", err)
+			return nil, fmt.Errorf("failed to parse config file: %w", parseError(data, err))
+		}
+	}
+
+	if cfg.Nomad.TokenFile != "" {
+		token, err := ReadTokenFile(cfg.Nomad.TokenFile)
+		if err != nil {
+			return nil, err
 		}
+		cfg.Nomad.Token = token
+	}
+	for i := range cfg.Nomad.Clusters {
+		cluster := &cfg.Nomad.Clusters[i]
+		if cluster.TokenFile == "" {
+			continue
+		}
+		token, err := ReadTokenFile(cluster.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Token = token
+	}
+
+	// Credentials may reference environment variables or Vault secrets instead of being set inline
+	if err := cfg.resolveCredentials(); err != nil {
+		return nil, fmt.Errorf("failed to resolve credentials: %w", err)
 	}
 
 	return cfg, nil
@@ -81,6 +752,47 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList reads a comma-separated list, ignoring empty entries
+func getEnvList(key string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvMap reads a comma-separated list of key=value pairs, ignoring entries without a value
+func getEnvMap(key string) map[string]string {
+	items := getEnvList(key)
+	if len(items) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(items))
+	for _, item := range items {
+		if name, value, ok := strings.Cut(item, "="); ok && strings.TrimSpace(value) != "" {
+			values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -89,3 +801,12 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prefixes of credential values that reference a secret instead of containing it:
+// "env:HAPROXY_DPAPI_PASSWORD" reads an environment variable, "vault:secret/data/haproxy#password"
+// reads the key of a Vault secret (KV version 1 or 2)
+const (
+	EnvRefPrefix   = "env:"
+	VaultRefPrefix = "vault:"
+)
+
+// VaultConfig is the Vault server vault: credential references are read from
+type VaultConfig struct {
+	Address            string `json:"address"`
+	Token              string `json:"token"`
+	RefreshIntervalSec int    `json:"refresh_interval_sec"` // Read the secrets again this often to pick up rotated ones (0 = disabled)
+	TimeoutSec         int    `json:"timeout_sec"`          // Timeout of a single secret read
+}
+
+// credentialFields returns the settings that may contain a credential reference, by their config key
+func (c *Config) credentialFields() map[string]*string {
+	fields := map[string]*string{
+		"nomad.token":            &c.Nomad.Token,
+		"haproxy.username":       &c.HAProxy.Username,
+		"haproxy.password":       &c.HAProxy.Password,
+		"haproxy.read_username":  &c.HAProxy.ReadUsername,
+		"haproxy.read_password":  &c.HAProxy.ReadPassword,
+		"state.consul_token":     &c.State.ConsulToken,
+		"discovery.consul_token": &c.Discovery.ConsulToken,
+		"admin.token":            &c.Admin.Token,
+	}
+	for i := range c.HAProxy.Instances {
+		instance := &c.HAProxy.Instances[i]
+		prefix := fmt.Sprintf("haproxy.instances[%d].", i)
+		fields[prefix+"username"] = &instance.Username
+		fields[prefix+"password"] = &instance.Password
+		fields[prefix+"read_username"] = &instance.ReadUsername
+		fields[prefix+"read_password"] = &instance.ReadPassword
+	}
+	return fields
+}
+
+// resolveCredentials replaces the credential references of the configuration by their values and
+// remembers the references, so ResolveCredentials can read them again later
+func (c *Config) resolveCredentials() error {
+	c.credentialRefs = make(map[string]string)
+	for key, value := range c.credentialFields() {
+		if strings.HasPrefix(*value, EnvRefPrefix) || strings.HasPrefix(*value, VaultRefPrefix) {
+			c.credentialRefs[key] = *value
+		}
+	}
+	if len(c.credentialRefs) == 0 {
+		return nil
+	}
+
+	values, err := c.ResolveCredentials(context.Background())
+	if err != nil {
+		return err
+	}
+	c.SetCredentials(values)
+	return nil
+}
+
+// HasVaultCredentials checks if credentials are read from Vault, and can therefore rotate
+func (c *Config) HasVaultCredentials() bool {
+	for _, ref := range c.credentialRefs {
+		if strings.HasPrefix(ref, VaultRefPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveCredentials reads the current values of all credential references, by config key.
+// Every Vault secret is read once, even if several keys of it are referenced.
+func (c *Config) ResolveCredentials(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string, len(c.credentialRefs))
+	secrets := make(map[string]map[string]interface{})
+	keys := make([]string, 0, len(c.credentialRefs))
+	for key := range c.credentialRefs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		ref := c.credentialRefs[key]
+		if name, ok := strings.CutPrefix(ref, EnvRefPrefix); ok {
+			value, set := os.LookupEnv(name)
+			if !set {
+				return nil, fmt.Errorf("%s: environment variable %s is not set", key, name)
+			}
+			values[key] = value
+			continue
+		}
+
+		path, secretKey, ok := strings.Cut(strings.TrimPrefix(ref, VaultRefPrefix), "#")
+		if !ok || path == "" || secretKey == "" {
+			return nil, fmt.Errorf("%s: invalid Vault reference %q, expected vault:<path>#<key>", key, ref)
+		}
+		secret, read := secrets[path]
+		if !read {
+			var err error
+			if secret, err = c.Vault.readSecret(ctx, path); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			secrets[path] = secret
+		}
+		value, ok := secret[secretKey].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: Vault secret %s has no string key %s", key, path, secretKey)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// ReadTokenFile reads a token written to a file, without surrounding whitespace
+func ReadTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// SetCredentials sets resolved credential values, by config key
+func (c *Config) SetCredentials(values map[string]string) {
+	fields := c.credentialFields()
+	for key, value := range values {
+		if field, ok := fields[key]; ok {
+			*field = value
+		}
+	}
+}
+
+// readSecret reads the data of a Vault secret. KV version 2 secrets (path secret/data/...) wrap
+// their data in another data object next to the metadata.
+func (v *VaultConfig) readSecret(ctx context.Context, path string) (map[string]interface{}, error) {
+	if v.Address == "" || v.Token == "" {
+		return nil, fmt.Errorf("vault.address and vault.token (VAULT_ADDR, VAULT_TOKEN) are required for Vault references")
+	}
+
+	timeout := time.Duration(v.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultVaultTimeoutSec * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(v.Address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault secret %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read Vault secret %s: status %d", path, resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("failed to decode Vault secret %s: %w", path, err)
+	}
+	if data, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, versioned := secret.Data["metadata"]; versioned {
+			return data, nil
+		}
+	}
+	return secret.Data, nil
+}
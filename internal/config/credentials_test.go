@@ -0,0 +1,103 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// vaultServer serves KV version 2 secrets below secret/data/ and version 1 secrets below kv/
+func vaultServer(t *testing.T, secrets map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, ok := secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLoadResolvesCredentials(t *testing.T) {
+	vault := vaultServer(t, map[string]string{
+		"/v1/secret/data/haproxy": `{"data": {"data": {"password": "dpapi-secret"}, "metadata": {"version": 3}}}`,
+		"/v1/kv/nomad":            `{"data": {"token": "nomad-secret"}}`,
+	})
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	t.Setenv("DPAPI_READ_PASSWORD", "read-secret")
+	path := writeConfigFile(t, `{
+  "nomad": {"token": "vault:kv/nomad#token"},
+  "haproxy": {
+    "password": "vault:secret/data/haproxy#password",
+    "read_username": "reader",
+    "read_password": "env:DPAPI_READ_PASSWORD"
+  }
+}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.HAProxy.Password != "dpapi-secret" || cfg.Nomad.Token != "nomad-secret" || cfg.HAProxy.ReadPassword != "read-secret" {
+		t.Errorf("Expected the references to be resolved, got haproxy %+v, nomad %+v", cfg.HAProxy, cfg.Nomad)
+	}
+	if !cfg.HasVaultCredentials() {
+		t.Error("Expected Vault credentials to be reported")
+	}
+
+	values, err := cfg.ResolveCredentials(context.Background())
+	if err != nil || len(values) != 3 || values["haproxy.password"] != "dpapi-secret" {
+		t.Errorf("Expected the references to resolve again, got %v (%v)", values, err)
+	}
+}
+
+func TestLoadCredentialErrors(t *testing.T) {
+	vault := vaultServer(t, map[string]string{"/v1/kv/haproxy": `{"data": {"password": "secret"}}`})
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+
+	tests := map[string]string{
+		`{"haproxy": {"password": "env:UNSET_DPAPI_PASSWORD"}}`: "UNSET_DPAPI_PASSWORD is not set",
+		`{"haproxy": {"password": "vault:kv/haproxy"}}`:         "expected vault:<path>#<key>",
+		`{"haproxy": {"password": "vault:kv/haproxy#pass"}}`:    "has no string key pass",
+		`{"haproxy": {"password": "vault:kv/missing#pass"}}`:    "status 404",
+	}
+	for content, expected := range tests {
+		if _, err := Load(writeConfigFile(t, content)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q for %s, got %v", expected, content, err)
+		}
+	}
+}
+
+func TestLoadReadsTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+	t.Setenv("NOMAD_TOKEN_FILE", tokenFile)
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if cfg.Nomad.Token != "file-token" {
+		t.Errorf("Expected the token of the file, got %q", cfg.Nomad.Token)
+	}
+
+	t.Setenv("NOMAD_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "failed to read token file") {
+		t.Errorf("Expected a missing token file to fail, got %v", err)
+	}
+}
@@ -0,0 +1,546 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldError is a problem with a single setting. Line is the line of the setting in the config
+// file, 0 if it is not set there (e.g. set by an environment variable).
+type FieldError struct {
+	Field   string
+	Line    int
+	Message string
+}
+
+func (e FieldError) String() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError lists all problems found in a configuration
+type ValidationError struct {
+	File   string
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Errors))
+	for i, fieldError := range e.Errors {
+		lines[i] = fieldError.String()
+		if e.File != "" {
+			lines[i] = e.File + ": " + lines[i]
+		}
+	}
+	return fmt.Sprintf("invalid configuration:\n  %s", strings.Join(lines, "\n  "))
+}
+
+// validator collects the problems of a configuration
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field, value string) {
+	if value == "" {
+		v.add(field, "is required")
+	}
+}
+
+func (v *validator) url(field, value string) {
+	if value == "" {
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		v.add(field, "%q is not an http(s) URL, e.g. http://localhost:5555", value)
+	}
+}
+
+// dataPlaneAddress accepts http(s) URLs and unix:// socket paths
+func (v *validator) dataPlaneAddress(field, value string) {
+	if path, ok := strings.CutPrefix(value, "unix://"); ok {
+		if !strings.HasPrefix(path, "/") {
+			v.add(field, "%q is not an absolute socket path, e.g. unix:///var/run/dataplaneapi.sock", value)
+		}
+		return
+	}
+	v.url(field, value)
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+	v.add(field, "%q is not one of %s", value, strings.Join(allowed, ", "))
+}
+
+func (v *validator) notNegative(field string, value int) {
+	if value < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+// servicePattern checks a managed service pattern, [name:|job:|namespace:]<glob>
+func (v *validator) servicePattern(field, pattern string) {
+	patternField, glob := splitServicePattern(pattern)
+	switch {
+	case patternField != ServicePatternName && patternField != ServicePatternJob && patternField != ServicePatternNamespace:
+		v.add(field, "%q must match name:, job: or namespace:", pattern)
+	case glob == "":
+		v.add(field, "%q has an empty pattern", pattern)
+	default:
+		if _, err := path.Match(glob, ""); err != nil {
+			v.add(field, "%q is not a valid glob pattern: %v", pattern, err)
+		}
+	}
+}
+
+func (v *validator) tls(field string, t *TLSConfig) {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		v.add(field+".key_file", "%s.cert_file and %s.key_file must be set together", field, field)
+	}
+	files := []struct{ key, path string }{{"ca_file", t.CAFile}, {"cert_file", t.CertFile}, {"key_file", t.KeyFile}}
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			v.add(field+"."+file.key, "%v", err)
+		}
+	}
+}
+
+// Validate checks required settings, URL formats, allowed values and options that exclude each other
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.required("nomad.address", c.Nomad.Address)
+	v.url("nomad.address", c.Nomad.Address)
+	v.notNegative("nomad.stream_stall_timeout_sec", c.Nomad.StreamStallTimeoutSec)
+	v.notNegative("nomad.token_refresh_interval_sec", c.Nomad.TokenRefreshIntervalSec)
+	v.tls("nomad.tls", &c.Nomad.TLS)
+	if alias, ok := strings.CutPrefix(c.Nomad.AddressMode, "host_network:"); !ok || alias == "" {
+		v.oneOf("nomad.address_mode", c.Nomad.AddressMode, "service", "node", "host_network:<alias>")
+	}
+	clusters := make(map[string]bool)
+	prefixes := make(map[string]bool)
+	for i, cluster := range c.Nomad.Clusters {
+		field := fmt.Sprintf("nomad.clusters[%d]", i)
+		v.required(field+".name", cluster.Name)
+		v.required(field+".address", cluster.Address)
+		v.url(field+".address", cluster.Address)
+		if clusters[cluster.Name] {
+			v.add(field+".name", "duplicates the cluster %s", cluster.Name)
+		}
+		clusters[cluster.Name] = true
+		if cluster.BackendPrefix != "" && prefixes[cluster.BackendPrefix] {
+			v.add(field+".backend_prefix", "%q is used by another cluster", cluster.BackendPrefix)
+		}
+		prefixes[cluster.BackendPrefix] = true
+	}
+
+	c.HAProxy.validate(v)
+
+	logLevels := []string{"debug", "info", "warn", "error"}
+	v.oneOf("log.level", strings.ToLower(c.Log.Level), logLevels...)
+	v.oneOf("log.format", c.Log.Format, "text", "json")
+	for _, module := range sortedKeys(c.Log.Modules) {
+		v.oneOf("log.modules."+module, strings.ToLower(c.Log.Modules[module]), logLevels...)
+	}
+
+	v.notNegative("sync.timeout_sec", c.Sync.TimeoutSec)
+	v.notNegative("sync.batch_window_ms", c.Sync.BatchWindowMs)
+	v.notNegative("sync.event_workers", c.Sync.EventWorkers)
+	v.notNegative("sync.queue_size", c.Sync.QueueSize)
+
+	if c.ACME.Enabled {
+		v.url("acme.directory_url", c.ACME.DirectoryURL)
+		v.required("acme.challenge_address", c.ACME.ChallengeAddress)
+		if c.HAProxy.HTTPFrontend == "" {
+			v.add("haproxy.http_frontend", "is required with acme.enabled, it answers the HTTP-01 challenges")
+		}
+	}
+
+	if c.DNS.Enabled {
+		v.oneOf("dns.provider", c.DNS.Provider, "webhook", "exec")
+		v.oneOf("dns.record_type", c.DNS.RecordType, "A", "CNAME")
+		v.required("dns.target", c.DNS.Target)
+		switch {
+		case c.DNS.WebhookURL != "" && c.DNS.Command != "":
+			v.add("dns.command", "dns.webhook_url and dns.command are mutually exclusive")
+		case c.DNS.Provider == "exec":
+			v.required("dns.command", c.DNS.Command)
+		default:
+			v.required("dns.webhook_url", c.DNS.WebhookURL)
+			v.url("dns.webhook_url", c.DNS.WebhookURL)
+		}
+	}
+
+	v.oneOf("discovery.source", c.Discovery.Source, "nomad", "consul")
+	if c.Discovery.Source == "consul" {
+		v.required("discovery.consul_address", c.Discovery.ConsulAddress)
+		v.url("discovery.consul_address", c.Discovery.ConsulAddress)
+	}
+	if c.Discovery.Source == "consul" && c.Nomad.WatchNodes {
+		v.add("nomad.watch_nodes", "requires discovery.source nomad, node events come from the Nomad event stream")
+	}
+	if c.Discovery.Source == "consul" && c.Nomad.AddressMode != "service" {
+		v.add("nomad.address_mode", "requires discovery.source nomad, Consul services are registered with the address of the catalog")
+	}
+	if c.Discovery.Source == "consul" && len(c.Nomad.Clusters) > 0 {
+		v.add("nomad.clusters", "requires discovery.source nomad, the services of further clusters come from their Nomad APIs")
+	}
+
+	if c.Docker.Enabled && !strings.HasPrefix(c.Docker.Host, "unix://") && !strings.HasPrefix(c.Docker.Host, "tcp://") {
+		v.add("docker.host", "%q must start with unix:// or tcp://", c.Docker.Host)
+	}
+
+	if c.Tracing.Enabled {
+		v.required("tracing.endpoint", c.Tracing.Endpoint)
+		v.url("tracing.endpoint", c.Tracing.Endpoint)
+		if c.Tracing.SampleRatio <= 0 || c.Tracing.SampleRatio > 1 {
+			v.add("tracing.sample_ratio", "must be greater than 0 and at most 1, got %v", c.Tracing.SampleRatio)
+		}
+	}
+
+	if c.Notifications.Enabled {
+		if len(c.Notifications.WebhookURLs) == 0 && len(c.Notifications.SlackWebhookURLs) == 0 {
+			v.add("notifications.webhook_urls", "at least one webhook or Slack webhook URL is required")
+		}
+		for i, webhookURL := range c.Notifications.WebhookURLs {
+			v.url(fmt.Sprintf("notifications.webhook_urls[%d]", i), webhookURL)
+		}
+		for i, webhookURL := range c.Notifications.SlackWebhookURLs {
+			v.url(fmt.Sprintf("notifications.slack_webhook_urls[%d]", i), webhookURL)
+		}
+		if c.Notifications.FailureThreshold < 1 {
+			v.add("notifications.failure_threshold", "must be positive")
+		}
+		if c.Notifications.DriftProbes < 1 {
+			v.add("notifications.drift_probes", "must be positive")
+		}
+		v.notNegative("notifications.min_interval_sec", c.Notifications.MinIntervalSec)
+	}
+
+	for i, pattern := range c.ManagedServices.Allow {
+		v.servicePattern(fmt.Sprintf("managed_services.allow[%d]", i), pattern)
+	}
+	for i, pattern := range c.ManagedServices.Deny {
+		v.servicePattern(fmt.Sprintf("managed_services.deny[%d]", i), pattern)
+	}
+
+	instances := make(map[string]bool)
+	for i, svc := range c.StaticServices {
+		field := fmt.Sprintf("static_services[%d]", i)
+		v.required(field+".name", svc.Name)
+		v.required(field+".address", svc.Address)
+		if svc.Port < 1 || svc.Port > 65535 {
+			v.add(field+".port", "must be between 1 and 65535")
+		}
+		instance := fmt.Sprintf("%s/%s:%d", svc.Name, svc.Address, svc.Port)
+		if instances[instance] {
+			v.add(field, "duplicates the instance %s", instance)
+		}
+		instances[instance] = true
+	}
+
+	v.oneOf("state.backend", c.State.Backend, "file", "consul", "nomad")
+	if c.State.Backend == "consul" || (c.HA.Enabled && c.HA.Backend == "consul") {
+		v.required("state.consul_address", c.State.ConsulAddress)
+		v.url("state.consul_address", c.State.ConsulAddress)
+	}
+
+	if c.HA.Enabled {
+		v.oneOf("ha.backend", c.HA.Backend, "nomad", "consul")
+		v.required("ha.lock_path", c.HA.LockPath)
+		if c.HA.TTLSec <= 0 {
+			v.add("ha.ttl_sec", "must be positive")
+		}
+	}
+	v.notNegative("history.size", c.History.Size)
+
+	v.url("vault.address", c.Vault.Address)
+	v.notNegative("vault.refresh_interval_sec", c.Vault.RefreshIntervalSec)
+
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+func (h *HAProxyConfig) validate(v *validator) {
+	if len(h.Instances) == 0 {
+		v.required("haproxy.address", h.Address)
+		v.dataPlaneAddress("haproxy.address", h.Address)
+	}
+	for i, instance := range h.Instances {
+		field := fmt.Sprintf("haproxy.instances[%d].address", i)
+		v.required(field, instance.Address)
+		v.dataPlaneAddress(field, instance.Address)
+	}
+	if (h.ReadUsername == "") != (h.ReadPassword == "") {
+		v.add("haproxy.read_password", "haproxy.read_username and haproxy.read_password must be set together")
+	}
+
+	v.oneOf("haproxy.backend_strategy", h.BackendStrategy, "create_new", "use_existing", "fail_on_conflict")
+	v.oneOf("haproxy.apply_policy", h.ApplyPolicy, "all_must_succeed", "all_or_nothing", "quorum", "best_effort")
+	v.oneOf("haproxy.host_match", h.HostMatch, "header", "strip_port", "hdr_dom")
+	if h.ManageFrontendRules && len(h.DefaultFrontends()) == 0 {
+		v.add("haproxy.frontends", "no frontend configured for domain rules, set haproxy.frontend or haproxy.frontends")
+	}
+	for i, frontend := range h.Frontends {
+		if strings.TrimSpace(frontend) == "" || strings.ContainsAny(frontend, " \t/") {
+			v.add(fmt.Sprintf("haproxy.frontends[%d]", i), "%q is not a valid frontend name", frontend)
+		}
+	}
+
+	v.tls("haproxy.tls", &h.TLS)
+	v.oneOf("haproxy.runtime.mode", h.Runtime.Mode, "fallback", "prefer")
+	v.notNegative("haproxy.runtime.timeout_sec", h.Runtime.TimeoutSec)
+
+	v.notNegative("haproxy.drain_timeout_sec", h.DrainTimeoutSec)
+	v.notNegative("haproxy.min_overlap_sec", h.MinOverlapSec)
+	v.notNegative("haproxy.max_overlap_wait_sec", h.MaxOverlapWaitSec)
+	v.notNegative("haproxy.server_slots", h.ServerSlots)
+	v.notNegative("haproxy.empty_backend_grace_sec", h.EmptyBackendGraceSec)
+	v.notNegative("haproxy.orphan_rule_interval_sec", h.OrphanRuleIntervalSec)
+	v.notNegative("haproxy.shutdown_timeout_sec", h.ShutdownTimeoutSec)
+	v.notNegative("haproxy.client.retry_attempts", h.Client.RetryAttempts)
+	v.notNegative("haproxy.circuit_breaker.failure_threshold", h.CircuitBreaker.FailureThreshold)
+	v.notNegative("haproxy.circuit_breaker.queue_size", h.CircuitBreaker.QueueSize)
+	if h.CircuitBreaker.FailureThreshold > 0 {
+		if h.CircuitBreaker.MinBackoffSec < 1 {
+			v.add("haproxy.circuit_breaker.min_backoff_sec", "must be positive")
+		}
+		if h.CircuitBreaker.MaxBackoffSec < h.CircuitBreaker.MinBackoffSec {
+			v.add("haproxy.circuit_breaker.max_backoff_sec", "must not be less than min_backoff_sec (%d)", h.CircuitBreaker.MinBackoffSec)
+		}
+	}
+
+	for i, group := range h.DomainGroups {
+		field := fmt.Sprintf("haproxy.domain_groups[%d]", i)
+		v.required(field+".suffix", group.Suffix)
+		v.required(field+".frontend", group.Frontend)
+		if group.Certificate != "" && group.Port == 0 {
+			v.add(field+".certificate", "requires a port, frontends without port are not created")
+		}
+	}
+
+	frontends := make(map[string]bool)
+	for i, defaults := range h.DefaultBackends {
+		field := fmt.Sprintf("haproxy.default_backends[%d]", i)
+		v.required(field+".frontend", defaults.Frontend)
+		v.required(field+".backend", defaults.Backend)
+		if frontends[defaults.Frontend] {
+			v.add(field+".frontend", "%q has another default backend", defaults.Frontend)
+		}
+		frontends[defaults.Frontend] = true
+		if defaults.Status != 0 && (defaults.Status < 200 || defaults.Status > 599) {
+			v.add(field+".status", "must be between 200 and 599")
+		}
+		if defaults.Port < 0 || defaults.Port > 65535 {
+			v.add(field+".port", "must be between 1 and 65535")
+		}
+		if defaults.Certificate != "" && defaults.Port == 0 {
+			v.add(field+".certificate", "requires a port, frontends without port are not created")
+		}
+	}
+
+	bootstrapped := make(map[string]bool)
+	for i, frontend := range h.BootstrapFrontends {
+		field := fmt.Sprintf("haproxy.bootstrap_frontends[%d]", i)
+		v.required(field+".name", frontend.Name)
+		if bootstrapped[frontend.Name] {
+			v.add(field+".name", "duplicates the frontend %s", frontend.Name)
+		}
+		bootstrapped[frontend.Name] = true
+		v.oneOf(field+".mode", frontend.Mode, "http", "tcp")
+		if len(frontend.Binds) == 0 {
+			v.add(field+".binds", "at least one bind is required")
+		}
+		ports := make(map[int]bool)
+		for j, bind := range frontend.Binds {
+			if bind.Port < 1 || bind.Port > 65535 {
+				v.add(fmt.Sprintf("%s.binds[%d].port", field, j), "must be between 1 and 65535")
+			} else if ports[bind.Port] {
+				v.add(fmt.Sprintf("%s.binds[%d].port", field, j), "port %d is bound twice", bind.Port)
+			}
+			ports[bind.Port] = true
+		}
+	}
+}
+
+// ValidateFile loads the configuration like Load and validates it. In addition to Validate it
+// reports keys of the config file that are not known, e.g. misspelled settings, and the line of
+// every problem found in the file.
+func ValidateFile(configFile string) (*Config, error) {
+	cfg, err := Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if configFile == "" {
+		return cfg, cfg.Validate()
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	keyLines, err := scanKeys(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var fieldErrors []FieldError
+	for _, key := range sortedKeys(keyLines) {
+		if !knownKey(reflect.TypeOf(Config{}), strings.Split(key, ".")) {
+			fieldErrors = append(fieldErrors, FieldError{Field: key, Line: keyLines[key], Message: "unknown setting"})
+		}
+	}
+	var validationErr *ValidationError
+	if err := cfg.Validate(); errors.As(err, &validationErr) {
+		for _, fieldError := range validationErr.Errors {
+			fieldError.Line = keyLines[fieldError.Field]
+			fieldErrors = append(fieldErrors, fieldError)
+		}
+	}
+
+	if len(fieldErrors) == 0 {
+		return cfg, nil
+	}
+	return cfg, &ValidationError{File: configFile, Errors: fieldErrors}
+}
+
+// scanKeys returns the line of every key of the JSON document, by its dotted path. Array elements
+// are addressed with [i], e.g. haproxy.instances[0].address.
+func scanKeys(data []byte) (map[string]int, error) {
+	lines := make(map[string]int)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	var scan func(path string) error
+	scan = func(path string) error {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'):
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				keyPath := key.(string)
+				if path != "" {
+					keyPath = path + "." + keyPath
+				}
+				lines[keyPath] = lineAt(data, decoder.InputOffset())
+				if err := scan(keyPath); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+		case json.Delim('['):
+			for i := 0; decoder.More(); i++ {
+				if err := scan(path + "[" + strconv.Itoa(i) + "]"); err != nil {
+					return err
+				}
+			}
+			_, err = decoder.Token()
+		}
+		return err
+	}
+
+	if err := scan(""); err != nil && !errors.Is(err, io.EOF) {
+		return nil, parseError(data, err)
+	}
+	return lines, nil
+}
+
+// knownKey checks if the path of a config file key exists in the config structs
+func knownKey(t reflect.Type, path []string) bool {
+	name, _, _ := strings.Cut(path[0], "[")
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		// Map keys are names chosen by the user (e.g. log modules, service dependencies)
+		return true
+	case reflect.Struct:
+	default:
+		return false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag != name {
+			continue
+		}
+		if len(path) == 1 {
+			return true
+		}
+		return knownKey(field.Type, path[1:])
+	}
+	return false
+}
+
+// parseError adds the line and column to JSON syntax and type errors of the config file
+func parseError(data []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+		if typeErr.Field != "" {
+			err = fmt.Errorf("%s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+	default:
+		return err
+	}
+	line := lineAt(data, offset)
+	column := int(offset) - bytes.LastIndexByte(data[:offset], '\n') - 1
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
+
+// lineAt returns the 1-based line of a byte offset
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestValidateDefaults(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected the defaults to be valid, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	cfg.Nomad.Address = "nomad:4646"
+	cfg.HAProxy.BackendStrategy = "replace"
+	cfg.HAProxy.ReadUsername = "reader"
+	cfg.HAProxy.HostMatch = "port"
+	cfg.DNS = DNSConfig{Enabled: true, WebhookURL: "http://dns/hook", Command: "/bin/dns", Target: "192.0.2.1"}
+	cfg.Discovery.Source = "zookeeper"
+	cfg.Nomad.AddressMode = "host_network:"
+	cfg.StaticServices = []StaticServiceConfig{
+		{Name: "legacy", Address: "10.0.0.1", Port: 8080},
+		{Name: "legacy", Address: "10.0.0.1", Port: 8080},
+		{Address: "10.0.0.2"},
+	}
+	cfg.HAProxy.DefaultBackends = []DefaultBackendConfig{
+		{Frontend: "https", Backend: "not_found", Status: 404},
+		{Frontend: "https", Status: 99},
+	}
+	cfg.HAProxy.BootstrapFrontends = []BootstrapFrontendConfig{
+		{Name: "https", Mode: "tls", Binds: []BindConfig{{Port: 443}, {Port: 443}}},
+		{Name: "http"},
+	}
+	cfg.Nomad.Clusters = []NomadClusterConfig{
+		{Name: "edge", Address: "http://edge:4646", BackendPrefix: "edge"},
+		{Name: "edge", Address: "edge-2:4646", BackendPrefix: "edge"},
+	}
+	cfg.Tracing = TracingConfig{Enabled: true, Endpoint: "collector:4318", SampleRatio: 1.5}
+	cfg.HAProxy.CircuitBreaker = HAProxyCircuitBreakerConfig{FailureThreshold: 5, MinBackoffSec: 10, MaxBackoffSec: 5}
+	cfg.Notifications = NotificationsConfig{Enabled: true, SlackWebhookURLs: []string{"hooks.slack.com/x"}}
+	cfg.ManagedServices = ManagedServicesConfig{Allow: []string{"web-*", "team:a"}, Deny: []string{"job:[a-"}}
+
+	err = cfg.Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, fieldError := range validationErr.Errors {
+		fields[fieldError.Field] = true
+	}
+	for _, field := range []string{"nomad.address", "haproxy.backend_strategy", "haproxy.read_password", "haproxy.host_match", "dns.command", "discovery.source",
+		"static_services[1]", "static_services[2].name", "static_services[2].port",
+		"nomad.address_mode", "nomad.clusters[1].name", "nomad.clusters[1].address", "nomad.clusters[1].backend_prefix",
+		"haproxy.default_backends[1].frontend", "haproxy.default_backends[1].backend", "haproxy.default_backends[1].status",
+		"haproxy.bootstrap_frontends[0].mode", "haproxy.bootstrap_frontends[0].binds[1].port", "haproxy.bootstrap_frontends[1].binds",
+		"tracing.endpoint", "tracing.sample_ratio",
+		"haproxy.circuit_breaker.max_backoff_sec",
+		"notifications.slack_webhook_urls[0]", "notifications.failure_threshold", "notifications.drift_probes",
+		"managed_services.allow[1]", "managed_services.deny[0]"} {
+		if !fields[field] {
+			t.Errorf("Expected an error for %s, got %v", field, err)
+		}
+	}
+}
+
+func TestValidateConsulDiscovery(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	cfg.Discovery.Source = "consul"
+	cfg.Discovery.ConsulAddress = "consul:8500"
+	cfg.State.ConsulAddress = ""
+
+	err = cfg.Validate()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != "discovery.consul_address" {
+		t.Fatalf("Expected only an error for discovery.consul_address, got %v", err)
+	}
+
+	cfg.Discovery.ConsulAddress = "http://consul:8500"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected the catalog not to need the state consul settings, got %v", err)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	path := writeConfigFile(t, `{
+  "nomad": {"address": "http://nomad:4646"},
+  "haproxy": {
+    "frontned": "https",
+    "backend_strategy": "use_existing",
+    "instances": [{"address": "haproxy-1:5555"}]
+  }
+}`)
+
+	_, err := ValidateFile(path)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	expected := []FieldError{
+		{Field: "haproxy.frontned", Line: 4, Message: "unknown setting"},
+		{Field: "haproxy.instances[0].address", Line: 6},
+	}
+	if len(validationErr.Errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), err)
+	}
+	for i, fieldError := range validationErr.Errors {
+		if fieldError.Field != expected[i].Field || fieldError.Line != expected[i].Line {
+			t.Errorf("Expected %s on line %d, got %+v", expected[i].Field, expected[i].Line, fieldError)
+		}
+	}
+	if !strings.Contains(err.Error(), path+": line 4: haproxy.frontned: unknown setting") {
+		t.Errorf("Expected the file and line in the message, got %v", err)
+	}
+}
+
+func TestLoadReportsSyntaxErrorLine(t *testing.T) {
+	path := writeConfigFile(t, "{\n  \"nomad\": {\"address\": \"http://nomad:4646\",}\n}")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected the line of the syntax error, got %v", err)
+	}
+
+	path = writeConfigFile(t, "{\n  \"haproxy\": {\n    \"drain_timeout_sec\": \"10\"\n  }\n}")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "line 3") ||
+		!strings.Contains(err.Error(), "haproxy.drain_timeout_sec") {
+		t.Errorf("Expected the line and field of the type error, got %v", err)
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	cfg.HAProxy.TLS = TLSConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem"), CertFile: "/etc/ssl/client.pem"}
+
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "haproxy.tls.ca_file") ||
+		!strings.Contains(err.Error(), "haproxy.tls.cert_file and haproxy.tls.key_file must be set together") {
+		t.Errorf("Expected the missing CA bundle and key file to be reported, got %v", err)
+	}
+}
+
+func TestValidateUnixSocketAddress(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	cfg.HAProxy.Address = "unix:///var/run/dataplaneapi.sock"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected a socket path to be valid, got %v", err)
+	}
+
+	cfg.HAProxy.Address = "unix://dataplaneapi.sock"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "haproxy.address") {
+		t.Errorf("Expected a relative socket path to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+package connector
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/acme"
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+// ACME constants
+const (
+	ACMEChallengeBackend = "acme_challenge"
+	ACMEChallengeServer  = "connector"
+	ACMEChallengePath    = "/.well-known/acme-challenge/"
+	ACMEOptOutTag        = "haproxy.acme=false"
+
+	ACMEAccountKeyState = "acme_account.pem"
+
+	ACMERenewalIntervalHours = 12
+	ACMEIssueTimeoutMin      = 5
+)
+
+// challengeStore serves HTTP-01 key authorizations and implements acme.Solver
+type challengeStore struct {
+	mu     sync.RWMutex
+	tokens map[string]string
+}
+
+func newChallengeStore() *challengeStore {
+	return &challengeStore{tokens: make(map[string]string)}
+}
+
+func (s *challengeStore) Present(token, keyAuthorization string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = keyAuthorization
+	return nil
+}
+
+func (s *challengeStore) CleanUp(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, token)
+}
+
+func (s *challengeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, ACMEChallengePath)
+
+	s.mu.RLock()
+	keyAuthorization, exists := s.tokens[token]
+	s.mu.RUnlock()
+
+	if !exists || !strings.HasPrefix(r.URL.Path, ACMEChallengePath) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, keyAuthorization)
+}
+
+// certificateManager obtains, installs and renews certificates for service domains
+type certificateManager struct {
+	ctx          context.Context
+	client       haproxy.ClientInterface
+	acme         *acme.Client
+	cfg          *config.ACMEConfig
+	httpFrontend string
+	challenges   *challengeStore
+	logger       *log.Logger
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+	domains  map[string]bool
+}
+
+// newCertificateManager loads (or creates) the ACME account key and registers the account
+func newCertificateManager(
+	ctx context.Context,
+	client haproxy.ClientInterface,
+	store state.Store,
+	cfg *config.ACMEConfig,
+	httpFrontend string,
+	logger *log.Logger,
+) (*certificateManager, error) {
+	accountKey, err := loadOrCreateAccountKey(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	acmeClient := acme.NewClient(cfg.DirectoryURL, accountKey)
+	if err := acmeClient.Register(ctx, cfg.Email); err != nil {
+		return nil, err
+	}
+
+	return &certificateManager{
+		ctx:          ctx,
+		client:       client,
+		acme:         acmeClient,
+		cfg:          cfg,
+		httpFrontend: httpFrontend,
+		challenges:   newChallengeStore(),
+		logger:       logger,
+		inFlight:     make(map[string]bool),
+		domains:      make(map[string]bool),
+	}, nil
+}
+
+func loadOrCreateAccountKey(ctx context.Context, store state.Store) (*ecdsa.PrivateKey, error) {
+	data, err := store.Get(ctx, ACMEAccountKeyState)
+	if err == nil {
+		return acme.DecodeKey(data)
+	}
+	if !errors.Is(err, state.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load ACME account key: %w", err)
+	}
+
+	key, err := acme.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ACME account key: %w", err)
+	}
+	data, err = acme.EncodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Put(ctx, ACMEAccountKeyState, data); err != nil {
+		return nil, fmt.Errorf("failed to store ACME account key: %w", err)
+	}
+	return key, nil
+}
+
+// run serves HTTP-01 challenges and periodically renews known certificates until ctx is done
+func (m *certificateManager) run(ctx context.Context) {
+	server := &http.Server{
+		Addr:              m.cfg.ChallengeListen,
+		Handler:           m.challenges,
+		ReadHeaderTimeout: HealthCheckTimeoutSec * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			m.logger.Printf("Error shutting down ACME challenge server: %v", err)
+		}
+	}()
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			m.logger.Printf("ACME challenge server error: %v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(ACMERenewalIntervalHours * time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			domains := make([]string, 0, len(m.domains))
+			for domain := range m.domains {
+				domains = append(domains, domain)
+			}
+			m.mu.Unlock()
+
+			for _, domain := range domains {
+				m.request(domain)
+			}
+		}
+	}
+}
+
+// request starts issuing a certificate for domain in the background unless one is already in flight.
+// Returns false if the domain is already being processed.
+func (m *certificateManager) request(domain string) bool {
+	m.mu.Lock()
+	m.domains[domain] = true
+	if m.inFlight[domain] {
+		m.mu.Unlock()
+		return false
+	}
+	m.inFlight[domain] = true
+	m.mu.Unlock()
+
+	go func() {
+		defer func() {
+			m.mu.Lock()
+			delete(m.inFlight, domain)
+			m.mu.Unlock()
+		}()
+
+		if err := m.issue(domain); err != nil {
+			m.logger.Printf("Warning: Failed to obtain certificate for %s: %v", domain, err)
+		}
+	}()
+	return true
+}
+
+// issue obtains and installs a certificate for domain unless a valid one is already stored
+func (m *certificateManager) issue(domain string) error {
+	name := acmeCertificateName(domain)
+	existing, err := m.client.GetSSLCertificate(name)
+	if err == nil && !m.needsRenewal(existing) {
+		return nil
+	}
+
+	if err := ensureACMEChallengeRoute(m.client, m.httpFrontend, m.cfg.ChallengeAddress); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, ACMEIssueTimeoutMin*time.Minute)
+	defer cancel()
+
+	certKey, err := acme.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	chain, err := m.acme.ObtainCertificate(ctx, domain, certKey, m.challenges)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := acme.EncodeKey(certKey)
+	if err != nil {
+		return err
+	}
+	bundle := append(chain, keyPEM...)
+
+	if existing != nil {
+		_, err = m.client.ReplaceSSLCertificate(name, bundle)
+	} else {
+		_, err = m.client.CreateSSLCertificate(name, bundle)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to install certificate %s: %w", name, err)
+	}
+
+	m.logger.Printf("Installed ACME certificate %s for %s", name, domain)
+	return nil
+}
+
+func (m *certificateManager) needsRenewal(certificate *haproxy.SSLCertificate) bool {
+	if certificate.NotAfter == nil {
+		return false
+	}
+	renewBefore := time.Duration(m.cfg.RenewBeforeDays) * 24 * time.Hour
+	return time.Until(*certificate.NotAfter) < renewBefore
+}
+
+// acmeCertificateName returns the storage name of the ACME certificate of a domain
+func acmeCertificateName(domain string) string {
+	return domain + ".pem"
+}
+
+// requestACMECertificate asks the certificate manager for a certificate for the service's domain.
+// Services with their own certificate (haproxy.cert.path), haproxy.acme=false or non-exact domains are skipped.
+func (hs *handlerState) requestACMECertificate(serviceName string, tags []string, result map[string]string) {
+	if hs.certificates == nil || hasTag(tags, ACMEOptOutTag) || parseCertPath(tags) != "" {
+		return
+	}
+
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if domainMapping == nil || domainMapping.Type != haproxy.DomainTypeExact {
+		return
+	}
+
+	if hs.certificates.request(domainMapping.Domain) {
+		result["acme"] = "requested: " + domainMapping.Domain
+	}
+}
+
+// ensureACMEChallengeRoute makes sure HTTP-01 requests on the HTTP frontend reach the connector's
+// challenge server. The switching rule is checked before every issuance because frontend rule
+// updates rewrite the frontend's switching rules.
+func ensureACMEChallengeRoute(client haproxy.ClientInterface, httpFrontend, challengeAddress string) error {
+	if httpFrontend == "" {
+		return fmt.Errorf("no HTTP frontend configured for ACME challenges")
+	}
+
+	if _, err := client.GetBackend(ACMEChallengeBackend); err != nil {
+		if !haproxy.IsNotFound(err) {
+			return fmt.Errorf("failed to get backend %s: %w", ACMEChallengeBackend, err)
+		}
+		if err := createACMEChallengeBackend(client, challengeAddress); err != nil {
+			return err
+		}
+	}
+
+	rules, err := client.GetBackendSwitchingRules(httpFrontend)
+	if err != nil {
+		return fmt.Errorf("failed to get backend switching rules of frontend %s: %w", httpFrontend, err)
+	}
+	for i := range rules {
+		if rules[i].Name == ACMEChallengeBackend {
+			return nil
+		}
+	}
+
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for ACME challenge route: %w", err)
+	}
+	rule := &haproxy.BackendSwitchingRule{
+		Name:     ACMEChallengeBackend,
+		Cond:     CondIf,
+		CondTest: fmt.Sprintf("{ path_beg %s }", ACMEChallengePath),
+	}
+	if err := client.CreateBackendSwitchingRule(httpFrontend, 0, rule, version); err != nil {
+		return fmt.Errorf("failed to route ACME challenges on frontend %s: %w", httpFrontend, err)
+	}
+	return nil
+}
+
+func createACMEChallengeBackend(client haproxy.ClientInterface, challengeAddress string) error {
+	host, portValue, err := net.SplitHostPort(challengeAddress)
+	if err != nil {
+		return fmt.Errorf("invalid ACME challenge address %q: %w", challengeAddress, err)
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil {
+		return fmt.Errorf("invalid ACME challenge port %q: %w", portValue, err)
+	}
+
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for ACME challenge backend: %w", err)
+	}
+	backend := haproxy.Backend{
+		Name:    ACMEChallengeBackend,
+		Mode:    ModeHTTP,
+		Balance: haproxy.Balance{Algorithm: "roundrobin"},
+	}
+	if _, err := client.CreateBackend(backend, version); err != nil {
+		return fmt.Errorf("failed to create ACME challenge backend: %w", err)
+	}
+
+	version, err = client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for ACME challenge server: %w", err)
+	}
+	server := &haproxy.Server{Name: ACMEChallengeServer, Address: host, Port: port}
+	if _, err := client.CreateServer(ACMEChallengeBackend, server, version); err != nil {
+		return fmt.Errorf("failed to create ACME challenge server: %w", err)
+	}
+	return nil
+}
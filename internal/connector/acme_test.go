@@ -0,0 +1,88 @@
+package connector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+func TestChallengeStore_ServesKeyAuthorizations(t *testing.T) {
+	store := newChallengeStore()
+	if err := store.Present("token1", "token1.thumbprint"); err != nil {
+		t.Fatalf("Present() failed: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	store.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ACMEChallengePath+"token1", http.NoBody))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "token1.thumbprint" {
+		t.Errorf("Expected key authorization, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	store.CleanUp("token1")
+	recorder = httptest.NewRecorder()
+	store.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ACMEChallengePath+"token1", http.NoBody))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after cleanup, got %d", recorder.Code)
+	}
+}
+
+func TestEnsureACMEChallengeRoute(t *testing.T) {
+	mock := &mockHAProxyClientWithBackendTracking{}
+
+	if err := ensureACMEChallengeRoute(mock, "http", "10.0.0.2:8402"); err != nil {
+		t.Fatalf("ensureACMEChallengeRoute() failed: %v", err)
+	}
+	if mock.createdBackend.Name != ACMEChallengeBackend {
+		t.Errorf("Expected challenge backend to be created, got %+v", mock.createdBackend)
+	}
+
+	rules, _ := mock.GetBackendSwitchingRules("http")
+	if len(rules) != 1 || rules[0].Name != ACMEChallengeBackend || rules[0].CondTest != "{ path_beg /.well-known/acme-challenge/ }" {
+		t.Fatalf("Expected challenge switching rule, got %+v", rules)
+	}
+
+	// The route is only added once
+	if err := ensureACMEChallengeRoute(mock, "http", "10.0.0.2:8402"); err != nil {
+		t.Fatalf("ensureACMEChallengeRoute() failed: %v", err)
+	}
+	if rules, _ := mock.GetBackendSwitchingRules("http"); len(rules) != 1 {
+		t.Errorf("Expected a single challenge switching rule, got %+v", rules)
+	}
+}
+
+func TestRequestACMECertificate_Skips(t *testing.T) {
+	hs := newHandlerState()
+	manager := &certificateManager{
+		cfg:      &config.ACMEConfig{},
+		inFlight: map[string]bool{"shop.example.com": true},
+		domains:  make(map[string]bool),
+	}
+	hs.certificates = manager
+
+	tests := []struct {
+		name string
+		tags []string
+	}{
+		{name: "no domain", tags: []string{"haproxy.enable=true"}},
+		{name: "opt out", tags: []string{"haproxy.domain=api.example.com", ACMEOptOutTag}},
+		{name: "own certificate", tags: []string{"haproxy.domain=api.example.com", CertPathTag + "/certs/api.pem"}},
+		{name: "regex domain", tags: []string{"haproxy.domain=^api\\..*$", "haproxy.domain.type=regex"}},
+		{name: "already in flight", tags: []string{"haproxy.domain=shop.example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := make(map[string]string)
+			hs.requestACMECertificate("svc", tt.tags, result)
+			if result["acme"] != "" {
+				t.Errorf("Expected no ACME request, got %q", result["acme"])
+			}
+		})
+	}
+
+	if !manager.domains["shop.example.com"] || len(manager.domains) != 1 {
+		t.Errorf("Expected only the in-flight domain to be tracked for renewal, got %v", manager.domains)
+	}
+}
@@ -0,0 +1,178 @@
+package connector
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// ServiceAPIPrefix is the path prefix of the per-service admin API
+const ServiceAPIPrefix = "/api/v1/services/"
+
+// Bulk server actions
+const (
+	ActionDrain = "drain"
+	ActionReady = "ready"
+	ActionMaint = "maint"
+)
+
+// BulkActionResult reports the outcome of a bulk server action on a service
+type BulkActionResult struct {
+	Service string            `json:"service"`
+	Backend string            `json:"backend"`
+	Action  string            `json:"action"`
+	Servers []string          `json:"servers"`
+	Failed  map[string]string `json:"failed,omitempty"`
+}
+
+// serviceAPI applies admin state changes to all servers of a service at once:
+//
+//	POST /api/v1/services/{name}/drain
+//	POST /api/v1/services/{name}/ready
+//	POST /api/v1/services/{name}/maint
+//
+// and pauses or resumes the handling of its events:
+//
+//	POST /api/v1/services/{name}/pause
+//	POST /api/v1/services/{name}/resume
+type serviceAPI struct {
+	client      haproxy.ClientInterface
+	nomadClient nomad.NomadClient
+	handlers    func() *handlerState // the handler state of the current leadership
+	// persistPaused stores the paused services after a pause or resume
+	persistPaused func()
+}
+
+func (a *serviceAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ServiceAPIPrefix), "/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	serviceName, action := parts[0], parts[1]
+
+	var apply func(backendName, serverName string) error
+	switch action {
+	case ActionDrain:
+		apply = a.client.DrainServer
+	case ActionReady:
+		apply = a.client.ReadyServer
+	case ActionMaint:
+		apply = a.client.MaintainServer
+	case ActionPause, ActionResume:
+		a.handlePause(w, serviceName, action)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	svc, err := a.managedService(serviceName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if svc == nil {
+		http.Error(w, "service not managed by the connector", http.StatusNotFound)
+		return
+	}
+
+	result, err := a.handlers().applyToServiceServers(a.client, serviceName, stableBackendName(serviceName, serviceTags(svc.Tags, svc.Meta)), action, apply)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if len(result.Failed) > 0 {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	writeJSON(w, result)
+}
+
+// managedService returns the haproxy-enabled service with this name registered in Nomad, nil if there is none
+func (a *serviceAPI) managedService(serviceName string) (*nomad.Service, error) {
+	services, err := a.nomadClient.GetServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services {
+		if svc.ServiceName == serviceName && hasTag(serviceTags(svc.Tags, svc.Meta), "haproxy.enable=true") {
+			return svc, nil
+		}
+	}
+	return nil, nil
+}
+
+// applyToServiceServers runs a runtime admin state change on every server of the service's backend
+func (hs *handlerState) applyToServiceServers(
+	client haproxy.ClientInterface,
+	serviceName, backendName, action string,
+	apply func(backendName, serverName string) error,
+) (*BulkActionResult, error) {
+	servers, err := client.GetServers(backendName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BulkActionResult{
+		Service: serviceName,
+		Backend: backendName,
+		Action:  action,
+		Servers: []string{},
+	}
+	for _, server := range servers {
+		if err := apply(backendName, server.Name); err != nil {
+			if result.Failed == nil {
+				result.Failed = make(map[string]string)
+			}
+			result.Failed[server.Name] = err.Error()
+			continue
+		}
+		result.Servers = append(result.Servers, server.Name)
+	}
+
+	hs.recordBackendChange(backendName)
+	return result, nil
+}
+
+type adminListenerKey struct{}
+
+// adminListener marks the requests received on the admin listener
+func adminListener(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminListenerKey{}, true)))
+	})
+}
+
+// adminOnly protects the handlers that change HAProxy or the connector. With admin.token set,
+// requests need it as bearer token; without, they are only accepted on the admin listener.
+func (c *Connector) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := c.cfg().Admin.Token
+		if token == "" {
+			if onAdmin, _ := r.Context().Value(adminListenerKey{}).(bool); !onAdmin {
+				http.Error(w, "admin endpoints are only served on the admin listener or with admin.token", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="haproxy-nomad-connector"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
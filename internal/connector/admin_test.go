@@ -0,0 +1,127 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// adminMockClient records runtime admin state changes per server
+type adminMockClient struct {
+	mockHAProxyClient
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func (m *adminMockClient) setState(serverName, state string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if serverName == "api_broken" {
+		return fmt.Errorf("runtime API unavailable")
+	}
+	m.states[serverName] = state
+	return nil
+}
+
+func (m *adminMockClient) DrainServer(backendName, serverName string) error {
+	return m.setState(serverName, "drain")
+}
+
+func (m *adminMockClient) ReadyServer(backendName, serverName string) error {
+	return m.setState(serverName, "ready")
+}
+
+func (m *adminMockClient) MaintainServer(backendName, serverName string) error {
+	return m.setState(serverName, "maint")
+}
+
+func TestServiceAPI_BulkActions(t *testing.T) {
+	client := &adminMockClient{states: make(map[string]string)}
+	client.getServersServers = []haproxy.Server{{Name: "api_1"}, {Name: "api_2"}}
+
+	api := &serviceAPI{
+		client:   client,
+		handlers: newHandlerState,
+		nomadClient: &fakeNomadClient{services: []*nomad.Service{
+			{ServiceName: "api", Tags: []string{"haproxy.enable=true"}},
+			{ServiceName: "unmanaged"},
+		}},
+	}
+
+	post := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, http.NoBody))
+		return recorder
+	}
+
+	recorder := post("/api/v1/services/api/drain")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var result BulkActionResult
+	if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if result.Backend != "api" || len(result.Servers) != 2 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if client.states["api_1"] != "drain" || client.states["api_2"] != "drain" {
+		t.Errorf("Expected all servers drained, got %v", client.states)
+	}
+
+	post("/api/v1/services/api/ready")
+	if client.states["api_1"] != "ready" || client.states["api_2"] != "ready" {
+		t.Errorf("Expected all servers ready, got %v", client.states)
+	}
+
+	if code := post("/api/v1/services/unmanaged/drain").Code; code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unmanaged service, got %d", code)
+	}
+	if code := post("/api/v1/services/api/restart").Code; code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown action, got %d", code)
+	}
+
+	client.getServersServers = append(client.getServersServers, haproxy.Server{Name: "api_broken"})
+	recorder = post("/api/v1/services/api/maint")
+	if recorder.Code != http.StatusMultiStatus {
+		t.Errorf("Expected 207 on partial failure, got %d", recorder.Code)
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	c := breakerConnector(&mockHAProxyClient{})
+	handler := c.adminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	post := func(handler http.Handler, authorization string) int {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, ResyncAPIPath, http.NoBody)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	if code := post(handler, ""); code != http.StatusForbidden {
+		t.Errorf("Expected admin actions without token to be rejected on the health server, got %d", code)
+	}
+	if code := post(adminListener(handler), ""); code != http.StatusOK {
+		t.Errorf("Expected admin actions to be accepted on the admin listener, got %d", code)
+	}
+
+	c.config.Admin.Token = "secret"
+	for _, authorization := range []string{"", "Bearer wrong", "secret"} {
+		if code := post(adminListener(handler), authorization); code != http.StatusUnauthorized {
+			t.Errorf("Expected %q to be rejected once a token is set, got %d", authorization, code)
+		}
+	}
+	if code := post(handler, "Bearer secret"); code != http.StatusOK {
+		t.Errorf("Expected the token to be accepted on the health server, got %d", code)
+	}
+}
@@ -0,0 +1,58 @@
+package connector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Agent check tags, used with haproxy.check.type=external
+const (
+	CheckAgentPortTag = "haproxy.check.agent_port="
+	CheckAgentAddrTag = "haproxy.check.agent_addr="
+)
+
+// CheckAgent is the agent a service exposes on a separate control port. HAProxy polls it and
+// applies the weight ("50%") or state ("drain", "maint", "down", "up") it answers with.
+type CheckAgent struct {
+	AgentPort int
+	AgentAddr string // defaults to the server address
+}
+
+// applyCheckAgentTag sets the agent of a haproxy.check.agent_port/agent_addr tag and reports
+// whether the tag was one of them. Invalid ports are ignored.
+func applyCheckAgentTag(agent *CheckAgent, tag string) bool {
+	switch {
+	case strings.HasPrefix(tag, CheckAgentPortTag):
+		if port, err := strconv.Atoi(strings.TrimPrefix(tag, CheckAgentPortTag)); err == nil && port > 0 && port <= 65535 {
+			agent.AgentPort = port
+		}
+	case strings.HasPrefix(tag, CheckAgentAddrTag):
+		agent.AgentAddr = strings.TrimPrefix(tag, CheckAgentAddrTag)
+	default:
+		return false
+	}
+	return true
+}
+
+// applyCheckAgent enables agent-check on the default server of external checks. The regular
+// check of the service port keeps running next to it.
+func applyCheckAgent(backend *haproxy.Backend, healthCheckConfig *HealthCheckConfig) {
+	if healthCheckConfig == nil || healthCheckConfig.Disabled || healthCheckConfig.Type != CheckTypeExternal {
+		return
+	}
+	backend.DefaultServer.AgentCheck = CheckEnabled
+	backend.DefaultServer.AgentPort = healthCheckConfig.AgentPort
+	backend.DefaultServer.AgentAddr = healthCheckConfig.AgentAddr
+}
+
+// checkAgentMatches checks if the agent check of the existing backend matches the desired one
+func checkAgentMatches(existing, desired *haproxy.Backend) bool {
+	if existing.DefaultServer == nil {
+		return false
+	}
+	return existing.DefaultServer.AgentCheck == desired.DefaultServer.AgentCheck &&
+		existing.DefaultServer.AgentPort == desired.DefaultServer.AgentPort &&
+		existing.DefaultServer.AgentAddr == desired.DefaultServer.AgentAddr
+}
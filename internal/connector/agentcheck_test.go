@@ -0,0 +1,75 @@
+package connector
+
+import (
+	"io"
+	"log"
+	"testing"
+)
+
+func TestResolveHealthCheckConfig_External(t *testing.T) {
+	tests := []struct {
+		name         string
+		tags         []string
+		expectedType string
+		expected     CheckAgent
+	}{
+		{
+			name:         "agent on a control port",
+			tags:         []string{"haproxy.check.type=external", "haproxy.check.agent_port=9999"},
+			expectedType: CheckTypeExternal,
+			expected:     CheckAgent{AgentPort: 9999},
+		},
+		{
+			name:         "agent on another address",
+			tags:         []string{"haproxy.check.type=external", "haproxy.check.agent_port=9999", "haproxy.check.agent_addr=10.0.0.5"},
+			expectedType: CheckTypeExternal,
+			expected:     CheckAgent{AgentPort: 9999, AgentAddr: "10.0.0.5"},
+		},
+		{
+			name:         "missing agent port falls back to tcp",
+			tags:         []string{"haproxy.check.type=external", "haproxy.check.agent_port=http"},
+			expectedType: CheckTypeTCP,
+		},
+		{
+			name:         "agent port without external type is ignored",
+			tags:         []string{"haproxy.check.agent_port=9999"},
+			expectedType: CheckTypeTCP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := resolveHealthCheckConfig(tt.tags, nil)
+			if config == nil {
+				t.Fatal("Expected a health check config")
+			}
+			if config.Type != tt.expectedType || config.CheckAgent != tt.expected {
+				t.Errorf("Expected %s check with agent %+v, got %s with %+v", tt.expectedType, tt.expected, config.Type, config.CheckAgent)
+			}
+		})
+	}
+}
+
+func TestBuildDesiredBackend_AgentCheck(t *testing.T) {
+	tags := []string{"haproxy.enable=true", "haproxy.check.type=external", "haproxy.check.agent_port=9999"}
+	config := resolveHealthCheckConfig(tags, nil)
+	desired := buildDesiredBackend("api", config, tags)
+
+	server := desired.DefaultServer
+	if server.Check != CheckEnabled || server.AgentCheck != CheckEnabled || server.AgentPort != 9999 {
+		t.Fatalf("Expected the regular check and the agent check on the default server, got %+v", server)
+	}
+	if desired.AdvCheck != "" {
+		t.Errorf("Expected no HTTP check for an external check, got %s", desired.AdvCheck)
+	}
+
+	plain := buildDesiredBackend("api", resolveHealthCheckConfig([]string{"haproxy.enable=true"}, nil), nil)
+	if backendConfigMatches(plain, desired, nil, config) {
+		t.Error("Expected a backend without agent check to be updated")
+	}
+
+	created := createServerWithHealthCheck(&Service{ServiceName: "api", Address: "10.0.0.1", Port: 8080}, "api_1", nil, tags, log.New(io.Discard, "", 0))
+	if created.CheckType != CheckTypeExternal {
+		t.Errorf("Expected an external check type on the server, got %s", created.CheckType)
+	}
+}
@@ -0,0 +1,152 @@
+package connector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Allocation address change statuses
+const (
+	// StatusReplaced is reported when a registration replaced the allocation's server at its old address
+	StatusReplaced = "replaced"
+	// StatusAlreadyReplaced is reported for deregistrations of an address the allocation already moved away from
+	StatusAlreadyReplaced = "already_replaced"
+)
+
+type allocationServer struct {
+	backend string
+	server  string
+	node    string    // node the allocation runs on
+	since   time.Time // when the allocation was first registered as this server
+}
+
+// allocationTracker maps allocation IDs to their current server
+type allocationTracker struct {
+	mu      sync.Mutex
+	servers map[string]allocationServer
+}
+
+func newAllocationTracker() *allocationTracker {
+	return &allocationTracker{servers: make(map[string]allocationServer)}
+}
+
+// record remembers the server an allocation is registered as, and the node it runs on
+func (t *allocationTracker) record(allocID, nodeID, backendName, serverName string) {
+	if allocID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, ok := t.servers[allocID]; ok && current.backend == backendName && current.server == serverName {
+		if nodeID != "" {
+			current.node = nodeID
+			t.servers[allocID] = current
+		}
+		return
+	}
+	t.servers[allocID] = allocationServer{backend: backendName, server: serverName, node: nodeID, since: time.Now()}
+}
+
+// registeredAs checks if the allocation is still registered as the given server, e.g. when it
+// restarted in place on the same node and port
+func (t *allocationTracker) registeredAs(allocID, backendName, serverName string) bool {
+	if allocID == "" {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current, ok := t.servers[allocID]
+	return ok && current.backend == backendName && current.server == serverName
+}
+
+// onNode returns the allocations running on a node and their servers, by allocation ID
+func (t *allocationTracker) onNode(nodeID string) map[string]allocationServer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	servers := make(map[string]allocationServer)
+	for allocID, current := range t.servers {
+		if nodeID != "" && current.node == nodeID {
+			servers[allocID] = current
+		}
+	}
+	return servers
+}
+
+// registeredSince returns when an allocation was first registered as the server, false for servers
+// the connector hasn't seen registering (e.g. added before it started)
+func (t *allocationTracker) registeredSince(backendName, serverName string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, current := range t.servers {
+		if current.backend == backendName && current.server == serverName {
+			return current.since, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// previous returns the server the allocation was registered as in the backend, if it differs from serverName
+func (t *allocationTracker) previous(allocID, backendName, serverName string) (string, bool) {
+	if allocID == "" {
+		return "", false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current, ok := t.servers[allocID]
+	if !ok || current.backend != backendName || current.server == serverName {
+		return "", false
+	}
+	return current.server, true
+}
+
+// forget drops the allocation if it is still registered as the given server
+func (t *allocationTracker) forget(allocID, backendName, serverName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, ok := t.servers[allocID]; ok && current.backend == backendName && current.server == serverName {
+		delete(t.servers, allocID)
+	}
+}
+
+// swapAllocationServer replaces the server the allocation was previously registered as with the new one
+// in a single transaction. Returns false if there is no previous server to replace.
+func (hs *handlerState) swapAllocationServer(
+	client haproxy.ClientInterface,
+	allocID, backendName string,
+	server *haproxy.Server,
+	result map[string]string,
+) (bool, error) {
+	previousServer, ok := hs.allocations.previous(allocID, backendName, server.Name)
+	if !ok {
+		return false, nil
+	}
+
+	servers, err := client.GetServers(backendName)
+	if err != nil {
+		return false, fmt.Errorf("failed to get servers for backend %s: %w", backendName, err)
+	}
+	if !containsServer(servers, previousServer) {
+		return false, nil
+	}
+
+	if err := client.SwapServer(backendName, previousServer, server); err != nil {
+		return false, fmt.Errorf("failed to replace server %s with %s in backend %s: %w", previousServer, server.Name, backendName, err)
+	}
+	hs.removals.cancel(backendName, previousServer)
+	hs.recordBackendChange(backendName)
+
+	result["replaced"] = previousServer
+	return true, nil
+}
+
+func containsServer(servers []haproxy.Server, serverName string) bool {
+	for i := range servers {
+		if servers[i].Name == serverName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package connector
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAllocationMovedReplacesServer(t *testing.T) {
+	client := NewMockHAProxyClient()
+	tags := []string{"haproxy.enable=true", "haproxy.backend=dynamic"}
+	ctx := withHandlerState(context.Background(), newHandlerState())
+
+	register := func(address string) map[string]string {
+		event := ServiceEvent{
+			Type: EventTypeServiceRegistration,
+			Service: Service{
+				ServiceName: "moving-app",
+				Address:     address,
+				Port:        8080,
+				Tags:        tags,
+				AllocID:     "alloc-moving",
+			},
+		}
+		result, err := ProcessServiceEvent(ctx, client, &event, testConfig())
+		if err != nil {
+			t.Fatalf("ProcessServiceEvent() failed: %v", err)
+		}
+		return result.(map[string]string)
+	}
+
+	if result := register("10.0.0.1"); result["status"] != StatusCreated {
+		t.Fatalf("Expected status %s, got %s", StatusCreated, result["status"])
+	}
+
+	result := register("10.0.0.2")
+	if result["status"] != StatusReplaced {
+		t.Errorf("Expected status %s, got %s", StatusReplaced, result["status"])
+	}
+	if result["replaced"] != "moving_app_10_0_0_1_8080" {
+		t.Errorf("Expected replaced server moving_app_10_0_0_1_8080, got %s", result["replaced"])
+	}
+
+	servers, _ := client.GetServers("moving_app")
+	if len(servers) != 1 || servers[0].Name != "moving_app_10_0_0_2_8080" {
+		t.Fatalf("Expected only the new server to remain, got %+v", servers)
+	}
+
+	// The late deregistration of the old address must not touch the replaced server or the routing
+	event := ServiceEvent{
+		Type: EventTypeServiceDeregistration,
+		Service: Service{
+			ServiceName: "moving-app",
+			Address:     "10.0.0.1",
+			Port:        8080,
+			Tags:        tags,
+			AllocID:     "alloc-moving",
+		},
+	}
+	deregistration, err := ProcessServiceEvent(ctx, client, &event, testConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	if status := deregistration.(map[string]string)["status"]; status != StatusAlreadyReplaced {
+		t.Errorf("Expected status %s, got %s", StatusAlreadyReplaced, status)
+	}
+
+	servers, _ = client.GetServers("moving_app")
+	if len(servers) != 1 {
+		t.Errorf("Expected new server to stay registered, got %+v", servers)
+	}
+}
+
+func TestAllocationTracker_ForgetOnlyCurrentServer(t *testing.T) {
+	tracker := newAllocationTracker()
+
+	tracker.record("alloc-1", "node-1", "web", "web_10_0_0_2_80")
+	tracker.forget("alloc-1", "web", "web_10_0_0_1_80")
+
+	if previous, ok := tracker.previous("alloc-1", "web", "web_10_0_0_3_80"); !ok || previous != "web_10_0_0_2_80" {
+		t.Errorf("Expected allocation to still map to web_10_0_0_2_80, got %q", previous)
+	}
+
+	tracker.forget("alloc-1", "web", "web_10_0_0_2_80")
+	if _, ok := tracker.previous("alloc-1", "web", "web_10_0_0_3_80"); ok {
+		t.Error("Expected allocation to be forgotten")
+	}
+}
@@ -0,0 +1,196 @@
+package connector
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// StateAPIPrefix is the path prefix of the read-only HAProxy state API
+const StateAPIPrefix = "/api/v1/haproxy/"
+
+// ManagedServer is a server of a managed backend together with its runtime state
+type ManagedServer struct {
+	haproxy.Server
+	AdminState       string `json:"admin_state,omitempty"`
+	OperationalState string `json:"operational_state,omitempty"`
+}
+
+// ManagedFrontend is a managed frontend together with the connector's domain rules
+type ManagedFrontend struct {
+	Name  string                 `json:"name"`
+	Mode  string                 `json:"mode,omitempty"`
+	Rules []haproxy.FrontendRule `json:"rules"`
+}
+
+// stateAPI proxies read calls to the Data Plane API, limited to objects managed by the connector,
+// so dashboards don't need Data Plane API credentials.
+//
+//	GET /api/v1/haproxy/backends
+//	GET /api/v1/haproxy/backends/{name}
+//	GET /api/v1/haproxy/backends/{name}/servers
+//	GET /api/v1/haproxy/frontends
+//	GET /api/v1/haproxy/frontends/{name}
+type stateAPI struct {
+	client      haproxy.ClientInterface
+	nomadClient nomad.NomadClient
+	cfg         func() *config.Config // the current configuration, replaced on reload
+	handlers    func() *handlerState  // the handler state of the current leadership
+}
+
+func (a *stateAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, StateAPIPrefix), "/"), "/")
+	backends, frontends, err := a.managedObjects()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "backends":
+		a.listBackends(w, backends)
+	case len(parts) == 2 && parts[0] == "backends":
+		a.getBackend(w, backends, parts[1])
+	case len(parts) == 3 && parts[0] == "backends" && parts[2] == "servers":
+		a.getServers(w, backends, parts[1])
+	case len(parts) == 1 && parts[0] == "frontends":
+		a.listFrontends(w, frontends)
+	case len(parts) == 2 && parts[0] == "frontends":
+		a.getFrontend(w, frontends, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// managedObjects returns the names of the backends and frontends the connector manages
+func (a *stateAPI) managedObjects() (backends, frontends []string, err error) {
+	services, err := a.nomadClient.GetServices()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for backendName := range a.handlers().buildExpectedServersMap(services) {
+		backends = append(backends, backendName)
+	}
+	if a.cfg().ACME.Enabled {
+		backends = append(backends, ACMEChallengeBackend)
+	}
+	sort.Strings(backends)
+
+	frontends = managedFrontends(&a.cfg().HAProxy)
+	for _, name := range serviceTCPFrontends(services) {
+		if !containsString(frontends, name) {
+			frontends = append(frontends, name)
+		}
+	}
+
+	return backends, frontends, nil
+}
+
+func (a *stateAPI) listBackends(w http.ResponseWriter, managed []string) {
+	backends := make([]*haproxy.Backend, 0, len(managed))
+	for _, name := range managed {
+		if backend, err := a.client.GetBackend(name); err == nil {
+			backends = append(backends, backend)
+		}
+	}
+	writeJSON(w, backends)
+}
+
+func (a *stateAPI) getBackend(w http.ResponseWriter, managed []string, name string) {
+	if !containsString(managed, name) {
+		http.Error(w, "backend not managed by the connector", http.StatusNotFound)
+		return
+	}
+	backend, err := a.client.GetBackend(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, backend)
+}
+
+func (a *stateAPI) getServers(w http.ResponseWriter, managed []string, backendName string) {
+	if !containsString(managed, backendName) {
+		http.Error(w, "backend not managed by the connector", http.StatusNotFound)
+		return
+	}
+	servers, err := a.client.GetServers(backendName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	// The runtime state of all servers comes with one listing, servers missing in it show without
+	runtimeServers, _ := a.client.GetRuntimeServers(backendName)
+	states := make(map[string]haproxy.RuntimeServer, len(runtimeServers))
+	for _, runtime := range runtimeServers {
+		states[runtime.ServerName] = runtime
+	}
+
+	result := make([]ManagedServer, 0, len(servers))
+	for _, server := range servers {
+		managedServer := ManagedServer{Server: server}
+		if runtime, ok := states[server.Name]; ok {
+			managedServer.AdminState = runtime.AdminState
+			managedServer.OperationalState = runtime.OperationalState
+		}
+		result = append(result, managedServer)
+	}
+	writeJSON(w, result)
+}
+
+func (a *stateAPI) listFrontends(w http.ResponseWriter, managed []string) {
+	frontends := make([]ManagedFrontend, 0, len(managed))
+	for _, name := range managed {
+		if frontend, err := a.frontend(name); err == nil {
+			frontends = append(frontends, *frontend)
+		}
+	}
+	writeJSON(w, frontends)
+}
+
+func (a *stateAPI) getFrontend(w http.ResponseWriter, managed []string, name string) {
+	if !containsString(managed, name) {
+		http.Error(w, "frontend not managed by the connector", http.StatusNotFound)
+		return
+	}
+	frontend, err := a.frontend(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, frontend)
+}
+
+func (a *stateAPI) frontend(name string) (*ManagedFrontend, error) {
+	frontend, err := a.client.GetFrontend(name)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := a.client.GetFrontendRules(name)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = []haproxy.FrontendRule{}
+	}
+	return &ManagedFrontend{Name: frontend.Name, Mode: frontend.Mode, Rules: rules}, nil
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
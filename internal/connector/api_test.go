@@ -0,0 +1,103 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// fakeNomadClient returns a fixed list of services
+type fakeNomadClient struct {
+	services []*nomad.Service
+}
+
+func (f *fakeNomadClient) StreamServiceEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (f *fakeNomadClient) GetServices() ([]*nomad.Service, error) {
+	return f.services, nil
+}
+
+func (f *fakeNomadClient) GetServiceCheckFromJob(jobID, serviceName string) (*nomad.ServiceCheck, error) {
+	return nil, nil
+}
+
+// stateMockClient knows every backend and frontend, managed or not
+type stateMockClient struct {
+	routesMockClient
+}
+
+func (m *stateMockClient) GetBackend(name string) (*haproxy.Backend, error) {
+	return &haproxy.Backend{Name: name}, nil
+}
+
+func (m *stateMockClient) GetFrontend(name string) (*haproxy.Frontend, error) {
+	return &haproxy.Frontend{Name: name}, nil
+}
+
+func TestStateAPI_OnlyExposesManagedObjects(t *testing.T) {
+	api := &stateAPI{
+		handlers: newHandlerState,
+		client: &stateMockClient{routesMockClient{
+			rules:   map[string][]haproxy.FrontendRule{"https": {{Domain: "api.example.com", Backend: "api"}}},
+			servers: map[string][]haproxy.Server{"api": {{Name: "api_1", Address: "10.0.0.1", Port: 8080}}},
+		}},
+		nomadClient: &fakeNomadClient{services: []*nomad.Service{
+			{ServiceName: "api", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+			{ServiceName: "unmanaged", Address: "10.0.0.2", Port: 8080},
+		}},
+		cfg: func() *config.Config { return &config.Config{HAProxy: config.HAProxyConfig{Frontend: "https"}} },
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		return recorder
+	}
+
+	var backends []haproxy.Backend
+	if err := json.Unmarshal(get("/api/v1/haproxy/backends").Body.Bytes(), &backends); err != nil {
+		t.Fatalf("Invalid backends response: %v", err)
+	}
+	if len(backends) != 1 || backends[0].Name != "api" {
+		t.Errorf("Expected only the managed backend, got %+v", backends)
+	}
+
+	if code := get("/api/v1/haproxy/backends/unmanaged").Code; code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unmanaged backend, got %d", code)
+	}
+
+	var servers []ManagedServer
+	if err := json.Unmarshal(get("/api/v1/haproxy/backends/api/servers").Body.Bytes(), &servers); err != nil {
+		t.Fatalf("Invalid servers response: %v", err)
+	}
+	if len(servers) != 1 || servers[0].Name != "api_1" || servers[0].OperationalState != "up" {
+		t.Errorf("Unexpected servers %+v", servers)
+	}
+
+	var frontends []ManagedFrontend
+	if err := json.Unmarshal(get("/api/v1/haproxy/frontends").Body.Bytes(), &frontends); err != nil {
+		t.Fatalf("Invalid frontends response: %v", err)
+	}
+	if len(frontends) != 1 || frontends[0].Name != "https" || len(frontends[0].Rules) != 1 {
+		t.Errorf("Unexpected frontends %+v", frontends)
+	}
+
+	if code := get("/api/v1/haproxy/frontends/stats").Code; code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unmanaged frontend, got %d", code)
+	}
+
+	recorder := httptest.NewRecorder()
+	api.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/v1/haproxy/backends/api", http.NoBody))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected read-only API, got %d", recorder.Code)
+	}
+}
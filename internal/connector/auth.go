@@ -0,0 +1,93 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Basic auth tag and meta keys
+const (
+	AuthUserlistTag    = "haproxy.auth.userlist="
+	AuthUserTag        = "haproxy.auth.user="
+	AuthPasswordTag    = "haproxy.auth.password="
+	AuthUserlistMeta   = "haproxy_auth_userlist"
+	AuthUserMeta       = "haproxy_auth_user"
+	AuthPasswordMeta   = "haproxy_auth_password"
+	AuthUserlistPrefix = "auth_"
+)
+
+// serviceAuth describes the basic auth protection of a service's domain: either an existing userlist
+// referenced by haproxy.auth.userlist, or a connector-managed userlist holding a single user
+type serviceAuth struct {
+	Userlist     string
+	User         string // Set for connector-managed userlists
+	PasswordHash string // crypt(3) hash of the managed user's password
+}
+
+// parseServiceAuth reads the basic auth tags of a service. Returns nil if the domain is not protected.
+func parseServiceAuth(tags []string, backendName string) *serviceAuth {
+	auth := &serviceAuth{}
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, AuthUserlistTag):
+			auth.Userlist = strings.TrimPrefix(tag, AuthUserlistTag)
+		case strings.HasPrefix(tag, AuthUserTag):
+			auth.User = strings.TrimPrefix(tag, AuthUserTag)
+		case strings.HasPrefix(tag, AuthPasswordTag):
+			auth.PasswordHash = strings.TrimPrefix(tag, AuthPasswordTag)
+		}
+	}
+
+	// An explicit userlist takes precedence over credentials
+	if auth.Userlist != "" {
+		return &serviceAuth{Userlist: auth.Userlist}
+	}
+	if auth.User == "" || auth.PasswordHash == "" {
+		return nil
+	}
+	auth.Userlist = AuthUserlistPrefix + backendName
+	return auth
+}
+
+// managed reports whether the connector owns the userlist
+func (a *serviceAuth) managed() bool {
+	return a != nil && a.User != ""
+}
+
+// userlist returns the userlist protecting the domain, or "" without protection
+func (a *serviceAuth) userlist() string {
+	if a == nil {
+		return ""
+	}
+	return a.Userlist
+}
+
+// ensureAuthUserlist creates or updates the connector-managed userlist before a rule references it
+func ensureAuthUserlist(client haproxy.ClientInterface, auth *serviceAuth) error {
+	if !auth.managed() {
+		return nil
+	}
+	if err := client.EnsureUserlistUser(auth.Userlist, auth.User, auth.PasswordHash); err != nil {
+		return fmt.Errorf("failed to set up userlist %s: %w", auth.Userlist, err)
+	}
+	return nil
+}
+
+// removeAuthUserlist deletes the connector-managed userlist once no rule references it anymore
+func removeAuthUserlist(client haproxy.ClientInterface, auth *serviceAuth, result map[string]string) {
+	if !auth.managed() {
+		return
+	}
+
+	version, err := client.GetConfigVersion()
+	if err == nil {
+		err = client.DeleteUserlist(auth.Userlist, version)
+	}
+	if err != nil {
+		result["auth_warning"] = fmt.Sprintf("failed to remove userlist %s: %v", auth.Userlist, err)
+		return
+	}
+	result["auth_userlist_removed"] = auth.Userlist
+}
@@ -0,0 +1,78 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+func TestParseServiceAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		expected *serviceAuth
+	}{
+		{name: "no auth", tags: []string{"haproxy.enable=true"}},
+		{name: "existing userlist", tags: []string{"haproxy.auth.userlist=staff"}, expected: &serviceAuth{Userlist: "staff"}},
+		{name: "credentials", tags: []string{"haproxy.auth.user=admin", "haproxy.auth.password=$5$hash"},
+			expected: &serviceAuth{Userlist: "auth_staging", User: "admin", PasswordHash: "$5$hash"}},
+		{name: "userlist wins over credentials",
+			tags:     []string{"haproxy.auth.userlist=staff", "haproxy.auth.user=admin", "haproxy.auth.password=$5$hash"},
+			expected: &serviceAuth{Userlist: "staff"}},
+		{name: "user without password", tags: []string{"haproxy.auth.user=admin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := parseServiceAuth(tt.tags, "staging")
+			if (auth == nil) != (tt.expected == nil) || auth != nil && *auth != *tt.expected {
+				t.Errorf("parseServiceAuth() = %+v, expected %+v", auth, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServiceTagsAuthMeta(t *testing.T) {
+	meta := map[string]string{AuthUserMeta: "admin", AuthPasswordMeta: "$5$hash"}
+	tags := serviceTags([]string{"haproxy.enable=true", "haproxy.auth.user=ops"}, meta)
+
+	auth := parseServiceAuth(tags, "staging")
+	if auth == nil || auth.User != "ops" || auth.PasswordHash != "$5$hash" {
+		t.Errorf("Expected explicit user tag and password from meta, got %+v (tags %v)", auth, tags)
+	}
+}
+
+func TestReconcileServiceRoutingWithAuth(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{}
+	tags := []string{
+		"haproxy.enable=true",
+		"haproxy.domain=staging.example.com",
+		"haproxy.auth.user=admin",
+		"haproxy.auth.password=$5$hash",
+	}
+	haproxyCfg := &config.HAProxyConfig{Frontend: "https"}
+	result := map[string]string{}
+
+	if err := hs.reconcileServiceRouting(mock, "staging", tags, "staging", result, haproxyCfg); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+
+	if mock.userlistUsers["auth_staging/admin"] != "$5$hash" {
+		t.Errorf("Expected managed userlist with admin user, got %v", mock.userlistUsers)
+	}
+	if len(mock.setFrontendRules) != 1 || mock.setFrontendRules[0].AuthUserlist != "auth_staging" {
+		t.Fatalf("Expected frontend rule protected by auth_staging, got %+v", mock.setFrontendRules)
+	}
+	if len(mock.addFrontendRuleCalls) != 0 {
+		t.Errorf("Expected no unprotected frontend rule, got %+v", mock.addFrontendRuleCalls)
+	}
+
+	hs.removeServiceRouting(mock, "staging", tags, result, haproxyCfg)
+	if len(mock.removeFrontendRuleCalls) != 1 {
+		t.Errorf("Expected frontend rule to be removed, got %+v", mock.removeFrontendRuleCalls)
+	}
+	if len(mock.deletedUserlists) != 1 || mock.deletedUserlists[0] != "auth_staging" {
+		t.Errorf("Expected managed userlist to be deleted, got %v", mock.deletedUserlists)
+	}
+}
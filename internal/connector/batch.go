@@ -0,0 +1,312 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+type registrationQueue struct {
+	mu       sync.Mutex
+	backends map[string]int
+}
+
+func newRegistrationQueue() *registrationQueue {
+	return &registrationQueue{backends: make(map[string]int)}
+}
+
+func (q *registrationQueue) add(backendName string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.backends[backendName]++
+}
+
+func (q *registrationQueue) done(backendName string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.backends[backendName]--; q.backends[backendName] <= 0 {
+		delete(q.backends, backendName)
+	}
+}
+
+// pending returns the number of queued registrations of the backend
+func (q *registrationQueue) pending(backendName string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.backends[backendName]
+}
+
+// collectEventBatch gathers the events arriving within the batch window after the first one
+func collectEventBatch(
+	ctx context.Context,
+	events <-chan nomad.ServiceEvent,
+	first nomad.ServiceEvent,
+	window time.Duration,
+) []nomad.ServiceEvent {
+	batch := []nomad.ServiceEvent{first}
+
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return batch
+		case <-timer.C:
+			return batch
+		case event := <-events:
+			batch = append(batch, event)
+		}
+	}
+}
+
+// eventInstanceKey identifies the service instance an event is about
+func eventInstanceKey(event *nomad.ServiceEvent) string {
+	svc := event.Payload.Service
+	return svc.ServiceName + "/" + hostPort(normalizeServerAddress(svc.Address), svc.Port)
+}
+
+// coalesceEvents keeps only the latest event of every service instance, e.g. a deregistration
+// following a registration of the same instance within the batch window replaces it
+func coalesceEvents(events []nomad.ServiceEvent) []nomad.ServiceEvent {
+	latest := make(map[string]int)
+	for i := range events {
+		if events[i].Payload.Service != nil {
+			latest[eventInstanceKey(&events[i])] = i
+		}
+	}
+
+	coalesced := make([]nomad.ServiceEvent, 0, len(latest))
+	for i := range events {
+		if events[i].Payload.Service == nil || latest[eventInstanceKey(&events[i])] == i {
+			coalesced = append(coalesced, events[i])
+		}
+	}
+	return coalesced
+}
+
+// toServiceEvent converts a Nomad event into the connector's event structure
+func toServiceEvent(event *nomad.ServiceEvent) *ServiceEvent {
+	svc := event.Payload.Service
+	return &ServiceEvent{
+		Type: event.Type,
+		Service: Service{
+			ServiceName: svc.ServiceName,
+			Address:     normalizeServerAddress(svc.Address),
+			Port:        svc.Port,
+			Tags:        serviceTags(svc.Tags, svc.Meta),
+			JobID:       svc.JobID,
+			AllocID:     svc.AllocID,
+			NodeID:      svc.NodeID,
+		},
+	}
+}
+
+// batchedBackend returns the backend a registration of a dynamic service adds its server to,
+// or "" for events that are processed on their own
+func batchedBackend(event *nomad.ServiceEvent) string {
+	if event.Payload.Service == nil || event.Type != EventTypeServiceRegistration {
+		return ""
+	}
+	svc := event.Payload.Service
+	tags := serviceTags(svc.Tags, svc.Meta)
+	if classifyService(tags) != haproxy.ServiceTypeDynamic {
+		return ""
+	}
+	return serviceBackendName(svc.ServiceName, tags)
+}
+
+// registeredBackend returns the backend a registration adds its server to, or "" for other events
+func registeredBackend(event *nomad.ServiceEvent) string {
+	if event.Payload.Service == nil || event.Type != EventTypeServiceRegistration {
+		return ""
+	}
+	svc := event.Payload.Service
+	return serviceBackendName(svc.ServiceName, serviceTags(svc.Tags, svc.Meta))
+}
+
+// processEventBatch processes the events of a batch window. Registrations adding servers to the
+// same backend are applied together; all other events are processed one by one, in order.
+func (c *Connector) processEventBatch(ctx context.Context, events []nomad.ServiceEvent) {
+	hs := c.currentHandlers()
+	events = coalesceEvents(events)
+
+	// The whole batch is held back while the circuit breaker is open
+	if c.breaker.isOpen() {
+		for i := range events {
+			c.holdEvent(&events[i])
+		}
+		return
+	}
+
+	// Registrations waiting for a healthy allocation are held back
+	ready := events[:0]
+	for i := range events {
+		if !c.deferUntilHealthy(ctx, &events[i]) {
+			ready = append(ready, events[i])
+		}
+	}
+	events = ready
+
+	registrations := make(map[string][]*ServiceEvent)
+	queued := make([]string, len(events))
+	for i := range events {
+		if backendName := batchedBackend(&events[i]); backendName != "" {
+			registrations[backendName] = append(registrations[backendName], toServiceEvent(&events[i]))
+		}
+		if queued[i] = registeredBackend(&events[i]); queued[i] != "" {
+			hs.registrations.add(queued[i])
+		}
+	}
+
+	for i := range events {
+		if queued[i] != "" {
+			hs.registrations.done(queued[i])
+		}
+
+		backendName := batchedBackend(&events[i])
+		group, batched := registrations[backendName]
+		switch {
+		case backendName == "" || len(group) == 1:
+			c.applyEvent(ctx, events[i])
+		case batched:
+			// The whole group is applied at the position of its first registration
+			delete(registrations, backendName)
+			c.processRegistrationBatch(ctx, backendName, group)
+		}
+	}
+}
+
+// processRegistrationBatch registers several instances of a service in one go and records the
+// processing stats of every event
+func (c *Connector) processRegistrationBatch(ctx context.Context, backendName string, events []*ServiceEvent) {
+	hs := c.currentHandlers()
+	c.mu.Lock()
+	c.processedEvents += int64(len(events))
+	c.lastEventTime = time.Now()
+	c.mu.Unlock()
+
+	result, err := hs.registerServerBatch(c.haproxyClient, c.nomadClient, backendName, events, c.logger, &c.cfg().HAProxy)
+	for _, event := range events {
+		c.history.recordBatchEvent(event, result, err)
+	}
+	c.recordEventOutcome("backend "+backendName, err)
+	c.recordBreakerOutcome(ctx, err)
+	if err != nil {
+		c.mu.Lock()
+		c.errors += int64(len(events))
+		c.mu.Unlock()
+
+		c.logger.Printf("Error processing %d registrations for backend %s: %v", len(events), backendName, err)
+		return
+	}
+
+	c.logger.Printf("Successfully processed %d registrations for backend %s (status=%s, created=%s)",
+		len(events), backendName, result["status"], result["servers"])
+}
+
+// registerServerBatch registers several instances of the same service. New servers and the
+// replacements of moved allocations are created in a single transaction instead of one per event,
+// the backend and routing are reconciled once using the latest registration.
+func (hs *handlerState) registerServerBatch(
+	client haproxy.ClientInterface,
+	nomadClient nomad.NomadClient,
+	backendName string,
+	events []*ServiceEvent,
+	logger *log.Logger,
+	haproxyCfg *config.HAProxyConfig,
+) (map[string]string, error) {
+	defer hs.locks.lock(backendName)()
+
+	latest := &events[len(events)-1].Service
+
+	// All instances of a service share the health check of its job
+	serviceCheck := fetchNomadHealthCheck(nomadClient, latest.JobID, latest.ServiceName, logger)
+	if _, err := ensureBackendWithHealthCheck(client, backendName, latest.Tags, serviceCheck); err != nil {
+		return nil, err
+	}
+
+	existingServers, err := client.GetServers(backendName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get servers for backend %s: %w", backendName, err)
+	}
+
+	result := map[string]string{
+		"status":  StatusAlreadyExists,
+		"backend": backendName,
+	}
+
+	var create []haproxy.Server
+	var remove, created, filled []string
+	for _, event := range events {
+		svc := &event.Service
+		serverName := serviceServerName(svc)
+
+		if containsServer(existingServers, serverName) {
+			hs.cancelPendingRemoval(client, backendName, serverName, result)
+			continue
+		}
+		server := createServerWithHealthCheck(svc, serverName, serviceCheck, svc.Tags, logger)
+
+		// Slots are filled one by one, that doesn't reload HAProxy
+		if haproxyCfg != nil && haproxyCfg.ServerSlots > 0 {
+			slot, isNew, err := fillServerSlot(client, backendName, &server, haproxyCfg.ServerSlots)
+			if err != nil {
+				return nil, err
+			}
+			if slot != "" {
+				if isNew {
+					filled = append(filled, slot)
+				} else {
+					hs.cancelPendingRemoval(client, backendName, slot, result)
+				}
+				continue
+			}
+		}
+
+		// Moved allocations replace their previous server in the same transaction
+		previousServer, moved := hs.allocations.previous(svc.AllocID, backendName, serverName)
+		if moved && containsServer(existingServers, previousServer) && !containsString(remove, previousServer) {
+			remove = append(remove, previousServer)
+		}
+		create = append(create, server)
+		created = append(created, serverName)
+	}
+
+	if len(filled) > 0 {
+		hs.recordBackendChange(backendName)
+		result["status"] = StatusCreated
+		result["slots"] = strings.Join(filled, ",")
+	}
+
+	if len(create) > 0 || len(remove) > 0 {
+		if err := client.UpdateServers(backendName, remove, create); err != nil {
+			return nil, fmt.Errorf("failed to add %d servers to backend %s: %w", len(create), backendName, err)
+		}
+		for _, serverName := range remove {
+			hs.removals.cancel(backendName, serverName)
+		}
+		hs.recordBackendChange(backendName)
+		result["status"] = StatusCreated
+		result["servers"] = strings.Join(created, ",")
+		if len(remove) > 0 {
+			result["replaced"] = strings.Join(remove, ",")
+		}
+	}
+	for _, event := range events {
+		svc := &event.Service
+		hs.allocations.record(svc.AllocID, svc.NodeID, backendName, serviceServerName(svc))
+	}
+
+	if err := hs.reconcileServiceRouting(client, latest.ServiceName, latest.Tags, backendName, result, haproxyCfg); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
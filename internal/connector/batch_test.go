@@ -0,0 +1,155 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func batchTestEvent(eventType, serviceName, address string, port int) nomad.ServiceEvent {
+	return nomad.ServiceEvent{
+		Type: eventType,
+		Payload: nomad.Payload{Service: &nomad.Service{
+			ServiceName: serviceName,
+			Address:     address,
+			Port:        port,
+			Tags:        []string{"haproxy.enable=true"},
+			AllocID:     serviceName + "-" + address,
+		}},
+	}
+}
+
+func TestCoalesceEvents(t *testing.T) {
+	events := []nomad.ServiceEvent{
+		batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.1", 8080),
+		batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.2", 8080),
+		batchTestEvent(EventTypeServiceDeregistration, "web", "10.0.0.1", 8080),
+		batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.2", 8080),
+	}
+
+	coalesced := coalesceEvents(events)
+	if len(coalesced) != 2 {
+		t.Fatalf("Expected one event per instance, got %d", len(coalesced))
+	}
+	if coalesced[0].Type != EventTypeServiceDeregistration || coalesced[0].Payload.Service.Address != "10.0.0.1" {
+		t.Errorf("Expected the deregistration of 10.0.0.1 to replace its registration, got %+v", coalesced[0])
+	}
+	if coalesced[1].Type != EventTypeServiceRegistration || coalesced[1].Payload.Service.Address != "10.0.0.2" {
+		t.Errorf("Expected the latest registration of 10.0.0.2, got %+v", coalesced[1])
+	}
+}
+
+func TestCollectEventBatch(t *testing.T) {
+	events := make(chan nomad.ServiceEvent, 2)
+	events <- batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.2", 8080)
+	events <- batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.3", 8080)
+
+	first := batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.1", 8080)
+	batch := collectEventBatch(context.Background(), events, first, 20*time.Millisecond)
+	if len(batch) != 3 || batch[0].Payload.Service.Address != "10.0.0.1" {
+		t.Errorf("Expected the first and both queued events, got %d events", len(batch))
+	}
+}
+
+func TestProcessEventBatch(t *testing.T) {
+	client := NewMockHAProxyClient()
+	c := &Connector{
+		config:        testConfig(),
+		nomadClient:   &fakeNomadClient{},
+		haproxyClient: client,
+		logger:        log.New(io.Discard, "", 0),
+	}
+
+	c.processEventBatch(context.Background(), []nomad.ServiceEvent{
+		batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.1", 8080),
+		batchTestEvent(EventTypeServiceRegistration, "api", "10.0.0.5", 9090),
+		batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.2", 8080),
+		batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.3", 8080),
+	})
+
+	if client.updateServersCalls != 1 {
+		t.Errorf("Expected the web servers to be added in one transaction, got %d", client.updateServersCalls)
+	}
+	if len(client.servers["web"]) != 3 || len(client.servers["api"]) != 1 {
+		t.Errorf("Expected 3 web and 1 api server, got %v", client.servers)
+	}
+	if processed, errors, _ := c.GetStats(); processed != 4 || errors != 0 {
+		t.Errorf("Expected 4 processed events without errors, got %d processed, %d errors", processed, errors)
+	}
+
+	// Registering the same instances again changes nothing
+	c.processEventBatch(context.Background(), []nomad.ServiceEvent{
+		batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.1", 8080),
+		batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.2", 8080),
+	})
+	if client.updateServersCalls != 1 || len(client.servers["web"]) != 3 {
+		t.Errorf("Expected existing servers to be kept as they are, got %d calls, servers %v",
+			client.updateServersCalls, client.servers["web"])
+	}
+}
+
+func TestRegisterServerBatchReplacesMovedAllocation(t *testing.T) {
+	hs := newHandlerState()
+	client := NewMockHAProxyClient()
+	client.backends["web"] = &haproxy.Backend{Name: "web", Balance: haproxy.Balance{Algorithm: "roundrobin"}}
+	client.servers["web"] = []haproxy.Server{{Name: "web_10_0_0_1_8080"}}
+	hs.allocations.record("alloc-1", "node-1", "web", "web_10_0_0_1_8080")
+
+	moved := toServiceEvent(&nomad.ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Payload: nomad.Payload{Service: &nomad.Service{
+			ServiceName: "web", Address: "10.0.0.9", Port: 8080, Tags: []string{"haproxy.enable=true"}, AllocID: "alloc-1",
+		}},
+	})
+	added := toServiceEvent(&nomad.ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Payload: nomad.Payload{Service: &nomad.Service{
+			ServiceName: "web", Address: "10.0.0.2", Port: 8080, Tags: []string{"haproxy.enable=true"}, AllocID: "alloc-2",
+		}},
+	})
+
+	result, err := hs.registerServerBatch(client, nil, "web", []*ServiceEvent{moved, added}, log.New(io.Discard, "", 0), &testConfig().HAProxy)
+	if err != nil {
+		t.Fatalf("registerServerBatch() failed: %v", err)
+	}
+
+	if client.updateServersCalls != 1 || result["replaced"] != "web_10_0_0_1_8080" {
+		t.Errorf("Expected the old server to be replaced in the same transaction, got %v", result)
+	}
+	if containsServer(client.servers["web"], "web_10_0_0_1_8080") || len(client.servers["web"]) != 2 {
+		t.Errorf("Expected the moved and the new server only, got %v", client.servers["web"])
+	}
+}
+
+func TestProcessEventBatchKeepsRuleForQueuedReplacement(t *testing.T) {
+	hs := newHandlerState()
+	client := newOverlapMockClient("web_10_0_0_1_8080")
+	c := &Connector{
+		config:        testConfig(),
+		nomadClient:   &fakeNomadClient{},
+		haproxyClient: client,
+		logger:        log.New(io.Discard, "", 0),
+		handlers:      hs,
+	}
+
+	// The old instance deregisters before its replacement registers within the same batch window
+	deregistration := batchTestEvent(EventTypeServiceDeregistration, "web", "10.0.0.1", 8080)
+	registration := batchTestEvent(EventTypeServiceRegistration, "web", "10.0.0.2", 8080)
+	for _, event := range []nomad.ServiceEvent{deregistration, registration} {
+		event.Payload.Service.Tags = append(event.Payload.Service.Tags, "haproxy.domain="+testDomain)
+	}
+
+	c.processEventBatch(context.Background(), []nomad.ServiceEvent{deregistration, registration})
+
+	if calls := client.getRemoveFrontendRuleCalls(); len(calls) != 0 {
+		t.Errorf("Expected the domain rule to be kept for the replacement, got %d RemoveFrontendRule calls", len(calls))
+	}
+	if pending := hs.registrations.pending("web"); pending != 0 {
+		t.Errorf("Expected no queued registrations after the batch, got %d", pending)
+	}
+}
@@ -0,0 +1,85 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Blue/green deployment tag and meta keys
+const (
+	DeploymentTag        = "haproxy.deployment="
+	DeploymentMeta       = "haproxy_deployment"
+	ActiveDeploymentTag  = "haproxy.active="
+	ActiveDeploymentMeta = "haproxy_active"
+
+	DeploymentBlue  = "blue"
+	DeploymentGreen = "green"
+)
+
+// parseDeployment returns the color of a blue/green instance of a dynamic service, or "" if the
+// service does not use blue/green deployments
+func parseDeployment(tags []string) string {
+	if classifyService(tags) != haproxy.ServiceTypeDynamic {
+		return ""
+	}
+	for _, tag := range tags {
+		if value, ok := strings.CutPrefix(tag, DeploymentTag); ok {
+			return deploymentColor(value)
+		}
+	}
+	return ""
+}
+
+// activeDeployment returns the color the domain of a blue/green service routes to. Without
+// haproxy.active the instance's own color is active, so the last deployment takes over the domain.
+func activeDeployment(tags []string) string {
+	for _, tag := range tags {
+		if value, ok := strings.CutPrefix(tag, ActiveDeploymentTag); ok {
+			if color := deploymentColor(value); color != "" {
+				return color
+			}
+		}
+	}
+	return parseDeployment(tags)
+}
+
+func deploymentColor(value string) string {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case DeploymentBlue, DeploymentGreen:
+		return value
+	}
+	return ""
+}
+
+// isInactiveDeployment checks if the instance belongs to the blue/green color that does not
+// receive the domain's traffic. Its servers are kept ready in their own backend for a switch.
+func isInactiveDeployment(tags []string) bool {
+	color := parseDeployment(tags)
+	return color != "" && color != activeDeployment(tags)
+}
+
+// deploymentBackendName returns the backend of a blue/green color of a service
+func deploymentBackendName(serviceBackend, color string) string {
+	return serviceBackend + "_" + color
+}
+
+// reconcileInactiveDeployment sets up the backend of an inactive blue/green color. The domain rule,
+// its certificate, rate limit and redirects belong to the active color and are left alone, so
+// switching back to this color only rewrites the domain rule.
+func reconcileInactiveDeployment(
+	client haproxy.ClientInterface,
+	tags []string,
+	backendName string,
+	result map[string]string,
+) error {
+	if err := reconcileStickRule(client, backendName, parseStickyMode(tags) == StickyModeSource, result); err != nil {
+		return err
+	}
+	if err := reconcileHeaders(client, backendName, tags, result); err != nil {
+		return err
+	}
+	result["deployment"] = fmt.Sprintf("%s (inactive, %s is active)", parseDeployment(tags), activeDeployment(tags))
+	return nil
+}
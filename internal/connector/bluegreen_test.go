@@ -0,0 +1,105 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestParseDeployment(t *testing.T) {
+	tests := []struct {
+		name           string
+		tags           []string
+		expectedColor  string
+		expectedActive string
+	}{
+		{name: "no deployment", tags: []string{"haproxy.enable=true"}},
+		{name: "own color is active", tags: []string{"haproxy.enable=true", "haproxy.deployment=blue"},
+			expectedColor: "blue", expectedActive: "blue"},
+		{name: "explicit active", tags: []string{"haproxy.enable=true", "haproxy.deployment=blue", "haproxy.active=Green"},
+			expectedColor: "blue", expectedActive: "green"},
+		{name: "unknown color", tags: []string{"haproxy.enable=true", "haproxy.deployment=red"}},
+		{name: "custom backend", tags: []string{"haproxy.enable=true", "haproxy.backend=custom", "haproxy.deployment=blue"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if color := parseDeployment(tt.tags); color != tt.expectedColor {
+				t.Errorf("parseDeployment() = %q, expected %q", color, tt.expectedColor)
+			}
+			if active := activeDeployment(tt.tags); active != tt.expectedActive {
+				t.Errorf("activeDeployment() = %q, expected %q", active, tt.expectedActive)
+			}
+		})
+	}
+}
+
+func TestServiceBackendNameDeployment(t *testing.T) {
+	if name := serviceBackendName("app", []string{"haproxy.enable=true", "haproxy.deployment=green"}); name != "app_green" {
+		t.Errorf("Expected backend app_green, got %s", name)
+	}
+	meta := serviceTags([]string{"haproxy.enable=true"}, map[string]string{DeploymentMeta: "blue"})
+	if name := serviceBackendName("app", meta); name != "app_blue" {
+		t.Errorf("Expected the deployment meta to select backend app_blue, got %s", name)
+	}
+}
+
+func TestReconcileServiceRoutingBlueGreen(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{
+		frontendRules: map[string][]haproxy.FrontendRule{
+			"https": {{Domain: "app.example.com", Backend: "app_blue", Type: haproxy.DomainTypeExact}},
+		},
+	}
+	haproxyCfg := &config.HAProxyConfig{Frontend: "https"}
+	green := []string{"haproxy.enable=true", "haproxy.domain=app.example.com", "haproxy.deployment=green", "haproxy.active=blue"}
+
+	// The inactive color gets its backend ready without touching the domain rule
+	result := map[string]string{}
+	if err := hs.reconcileServiceRouting(mock, "app", green, "app_green", result, haproxyCfg); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+	if len(mock.addFrontendRuleCalls) != 0 || len(mock.setFrontendRules) != 0 {
+		t.Fatalf("Expected the inactive color not to route the domain, got %+v %+v", mock.addFrontendRuleCalls, mock.setFrontendRules)
+	}
+	if result["deployment"] == "" {
+		t.Errorf("Expected the inactive deployment in the result, got %v", result)
+	}
+
+	// Activating green switches the domain rule over to its backend
+	green[3] = "haproxy.active=green"
+	if err := hs.reconcileServiceRouting(mock, "app", green, "app_green", map[string]string{}, haproxyCfg); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+	if len(mock.addFrontendRuleCalls) != 1 || mock.addFrontendRuleCalls[0].Backend != "app_green" ||
+		mock.addFrontendRuleCalls[0].Domain != "app.example.com" {
+		t.Errorf("Expected the domain rule to switch to app_green, got %+v", mock.addFrontendRuleCalls)
+	}
+}
+
+func TestDeregisterInactiveDeploymentKeepsRule(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{getServersServers: []haproxy.Server{{Name: generateServerName("app", "10.0.0.1", 8080)}}}
+	event := &ServiceEvent{
+		Type: EventTypeServiceDeregistration,
+		Service: Service{
+			ServiceName: "app",
+			Address:     "10.0.0.1",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=app.example.com", "haproxy.deployment=green", "haproxy.active=blue"},
+		},
+	}
+
+	result, err := hs.handleServiceDeregistration(context.Background(), mock, event, testConfig())
+	if err != nil {
+		t.Fatalf("handleServiceDeregistration() failed: %v", err)
+	}
+	if backend := result.(map[string]string)["backend"]; backend != "app_green" {
+		t.Errorf("Expected the server to be removed from app_green, got %s", backend)
+	}
+	if len(mock.removeFrontendRuleCalls) != 0 {
+		t.Errorf("Expected the active color's domain rule to be kept, got %+v", mock.removeFrontendRuleCalls)
+	}
+}
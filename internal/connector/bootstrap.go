@@ -0,0 +1,45 @@
+package connector
+
+import (
+	"log"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// ensureBootstrapFrontends creates the bootstrap frontends that don't exist yet and the binds missing
+// on existing ones. The status backends of haproxy.default_backends are created first, so
+// bootstrapped frontends can use them as their default backend.
+func ensureBootstrapFrontends(client haproxy.ClientInterface, cfg *config.HAProxyConfig, logger *log.Logger) error {
+	if len(cfg.BootstrapFrontends) == 0 {
+		return nil
+	}
+	for _, d := range cfg.DefaultBackends {
+		if d.Status != 0 {
+			if err := ensureStatusBackend(client, d.Backend, d.Status, logger); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range cfg.BootstrapFrontends {
+		bootstrap := &cfg.BootstrapFrontends[i]
+		frontend := &haproxy.Frontend{Name: bootstrap.Name, Mode: bootstrap.Mode, DefaultBackend: bootstrap.DefaultBackend}
+		if frontend.Mode == "" {
+			frontend.Mode = ModeHTTP
+		}
+		binds := make([]haproxy.Bind, 0, len(bootstrap.Binds))
+		for _, bind := range bootstrap.Binds {
+			binds = append(binds, frontendBind(bootstrap.Name, bind.Address, bind.Port, bind.Certificate))
+		}
+
+		changed, err := ensureFrontend(client, frontend, binds...)
+		if err != nil {
+			return err
+		}
+		if changed {
+			logger.Printf("Bootstrapped frontend %s with %d binds", bootstrap.Name, len(bootstrap.Binds))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package connector
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestEnsureBootstrapFrontends(t *testing.T) {
+	mock := &backendCreatingClient{mockHAProxyClient{createdFrontends: []haproxy.Frontend{{Name: "http", Mode: ModeHTTP}}}}
+	cfg := &config.HAProxyConfig{
+		DefaultBackends: []config.DefaultBackendConfig{{Frontend: "https", Backend: "not_found", Status: 404}},
+		BootstrapFrontends: []config.BootstrapFrontendConfig{
+			{Name: "https", DefaultBackend: "not_found", Binds: []config.BindConfig{
+				{Port: 443, Certificate: "/etc/haproxy/certs/"},
+				{Address: "::", Port: 8443},
+			}},
+			{Name: "http", Binds: []config.BindConfig{{Port: 80}}},
+		},
+	}
+
+	for run := 0; run < 2; run++ {
+		if err := ensureBootstrapFrontends(mock, cfg, log.New(io.Discard, "", 0)); err != nil {
+			t.Fatalf("ensureBootstrapFrontends() failed: %v", err)
+		}
+	}
+
+	if mock.backends["not_found"] == nil {
+		t.Error("Expected the status backend to be created before the frontend using it")
+	}
+	if len(mock.createdFrontends) != 2 {
+		t.Fatalf("Expected only the missing frontend to be created once, got %+v", mock.createdFrontends)
+	}
+	if created := mock.createdFrontends[1]; created.Name != "https" || created.Mode != ModeHTTP || created.DefaultBackend != "not_found" {
+		t.Errorf("Unexpected frontend: %+v", created)
+	}
+	if len(mock.createdBinds) != 3 {
+		t.Fatalf("Expected 3 binds, got %+v", mock.createdBinds)
+	}
+	if bind := mock.createdBinds[0]; bind.Name != "https_443" || bind.Address != "*" || !bind.SSL {
+		t.Errorf("Unexpected bind: %+v", bind)
+	}
+	if bind := mock.createdBinds[1]; bind.Address != "::" || bind.Port != 8443 || bind.SSL {
+		t.Errorf("Unexpected bind: %+v", bind)
+	}
+	if bind := mock.createdBinds[2]; bind.Name != "http_80" {
+		t.Errorf("Expected the missing bind of the existing frontend to be created, got %+v", bind)
+	}
+}
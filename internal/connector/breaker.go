@@ -0,0 +1,193 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// circuitBreaker holds events back while the Data Plane API keeps failing, instead of letting
+// every event fail on its own and get lost. It opens once the configured number of events failed
+// in a row and a probe confirms the API doesn't answer; while open, events are queued until a
+// recovery probe succeeds.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int // events failed in a row
+	open     bool
+	queue    []nomad.ServiceEvent
+	dropped  int64 // events dropped from the full queue since the breaker opened
+	changed  bool  // queue changed since the last snapshot
+
+	// Metrics
+	trips        int64
+	droppedTotal int64
+}
+
+// breakerStats are the metrics of the circuit breaker
+type breakerStats struct {
+	open          bool
+	queued        int
+	trips         int64
+	droppedEvents int64
+}
+
+// hold queues the event if the breaker is open, the oldest event is dropped when the queue is full.
+// Returns false if the event is to be applied.
+func (b *circuitBreaker) hold(event *nomad.ServiceEvent, queueSize int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return false
+	}
+	b.changed = true
+	if queueSize <= 0 {
+		b.dropped++
+		b.droppedTotal++
+		return true
+	}
+	if len(b.queue) >= queueSize {
+		b.queue = b.queue[1:]
+		b.dropped++
+		b.droppedTotal++
+	}
+	b.queue = append(b.queue, *event)
+	return true
+}
+
+// recordOutcome counts consecutive failed events, returns true once they reach the threshold and
+// the breaker should be opened if the Data Plane API is down
+func (b *circuitBreaker) recordOutcome(err error, threshold int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	return threshold > 0 && !b.open && b.failures >= threshold
+}
+
+// trip opens the breaker, false if it was open already
+func (b *circuitBreaker) trip() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		return false
+	}
+	b.open = true
+	b.dropped = 0
+	b.trips++
+	return true
+}
+
+// reset closes the breaker and returns the queued events and how many were dropped
+func (b *circuitBreaker) reset() (queued []nomad.ServiceEvent, dropped int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queued, dropped = b.queue, b.dropped
+	b.changed = b.changed || len(b.queue) > 0
+	b.open = false
+	b.failures = 0
+	b.queue = nil
+	b.dropped = 0
+	return queued, dropped
+}
+
+// snapshot returns a copy of the held events and whether they changed since the last snapshot
+func (b *circuitBreaker) snapshot() (events []nomad.ServiceEvent, changed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	changed, b.changed = b.changed, false
+	return append([]nomad.ServiceEvent(nil), b.queue...), changed
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+func (b *circuitBreaker) stats() breakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return breakerStats{open: b.open, queued: len(b.queue), trips: b.trips, droppedEvents: b.droppedTotal}
+}
+
+// holdEvent queues the event while the circuit breaker is open
+func (c *Connector) holdEvent(event *nomad.ServiceEvent) bool {
+	return c.breaker.hold(event, c.cfg().HAProxy.CircuitBreaker.QueueSize)
+}
+
+// recordBreakerOutcome counts failed events and opens the circuit breaker once they reach the
+// threshold and the Data Plane API doesn't answer. Failures of an API that answers, e.g. rejected
+// configuration, leave the breaker closed.
+func (c *Connector) recordBreakerOutcome(ctx context.Context, err error) {
+	if !c.breaker.recordOutcome(err, c.cfg().HAProxy.CircuitBreaker.FailureThreshold) {
+		return
+	}
+	if c.conditions.probeHAProxy(c.haproxyClient) {
+		return
+	}
+	if !c.breaker.trip() {
+		return
+	}
+
+	c.logger.Printf("Warning: Data Plane API is failing, holding events back until it recovers (circuit breaker open): %s",
+		c.conditions.get(ConditionHAProxyReachable).Message)
+	c.notifyHAProxyReachability(false)
+	go c.awaitBreakerRecovery(ctx)
+}
+
+// awaitBreakerRecovery probes the Data Plane API with exponential backoff until it answers, then
+// asks the event loop to replay the held events
+func (c *Connector) awaitBreakerRecovery(ctx context.Context) {
+	cfg := &c.cfg().HAProxy.CircuitBreaker
+	backoff := time.Duration(cfg.MinBackoffSec) * time.Second
+	maxBackoff := time.Duration(cfg.MaxBackoffSec) * time.Second
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		if c.conditions.probeHAProxy(c.haproxyClient) {
+			select {
+			case c.breakerRecovered <- struct{}{}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// recoverFromOpenBreaker closes the circuit breaker, replays the held events in order and then
+// resyncs all services, which also covers events dropped from the full queue
+func (c *Connector) recoverFromOpenBreaker(ctx context.Context) {
+	events, dropped := c.breaker.reset()
+	c.logger.Printf("Data Plane API recovered, replaying %d held events (%d dropped) and resyncing (circuit breaker closed)",
+		len(events), dropped)
+	c.notifyHAProxyReachability(true)
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return
+		}
+		c.applyEvent(ctx, event)
+	}
+
+	// Failed again while replaying, the next recovery resyncs
+	if c.breaker.isOpen() || !c.resyncMu.TryLock() {
+		return
+	}
+	defer c.resyncMu.Unlock()
+	if _, _, err := SyncAndCleanupStaleServers(c.handlerContext(ctx), c.haproxyClient, c.nomadClient, c.logger, c.cfg()); err != nil {
+		c.logger.Printf("Warning: Resync after Data Plane API recovery failed: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func breakerConnector(client *mockHAProxyClient) *Connector {
+	cfg := testConfig()
+	cfg.HAProxy.CircuitBreaker = config.HAProxyCircuitBreakerConfig{FailureThreshold: 2, QueueSize: 2, MinBackoffSec: 1, MaxBackoffSec: 1}
+	return &Connector{
+		config:           cfg,
+		haproxyClient:    client,
+		nomadClient:      &fakeNomadClient{},
+		conditions:       newConditionSet(),
+		history:          newEventHistory(10),
+		breakerRecovered: make(chan struct{}, 1),
+		logger:           log.New(io.Discard, "", 0),
+	}
+}
+
+func breakerEvent(serviceName string) nomad.ServiceEvent {
+	return nomad.ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Payload: nomad.Payload{Service: &nomad.Service{
+			ServiceName: serviceName, Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true"},
+		}},
+	}
+}
+
+func TestCircuitBreakerHoldsEventsWhileDataPlaneAPIFails(t *testing.T) {
+	client := &mockHAProxyClient{getVersionError: errors.New("connection refused")}
+	c := breakerConnector(client)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c.applyEvent(ctx, breakerEvent("api"))
+	if c.breaker.isOpen() {
+		t.Fatal("Expected the breaker to stay closed below the threshold")
+	}
+	c.applyEvent(ctx, breakerEvent("api"))
+	if !c.breaker.isOpen() {
+		t.Fatal("Expected the breaker to open after two failed events")
+	}
+	if condition := c.conditions.get(ConditionHAProxyReachable); condition.Status != ConditionFalse {
+		t.Errorf("Expected HAProxy to be reported unreachable, got %+v", condition)
+	}
+
+	for _, name := range []string{"web", "admin", "shop"} {
+		c.applyEvent(ctx, breakerEvent(name))
+	}
+	stats := c.breaker.stats()
+	if c.processedEventCount() != 2 || stats.queued != 2 || stats.droppedEvents != 1 || stats.trips != 1 {
+		t.Fatalf("Expected 2 processed and 2 held events with 1 dropped, got %d processed and %+v", c.processedEventCount(), stats)
+	}
+
+	// The recovery probe of the test gives up, the recovery is run by hand
+	cancel()
+	client.getVersionError = nil
+	c.recoverFromOpenBreaker(context.Background())
+
+	if c.breaker.isOpen() {
+		t.Error("Expected the breaker to be closed after the recovery")
+	}
+	if c.processedEventCount() != 4 {
+		t.Errorf("Expected the held events to be replayed, processed %d", c.processedEventCount())
+	}
+	if stats := c.breaker.stats(); stats.queued != 0 {
+		t.Errorf("Expected an empty queue, got %+v", stats)
+	}
+}
+
+func TestCircuitBreakerStaysClosedWhileDataPlaneAPIAnswers(t *testing.T) {
+	c := breakerConnector(&mockHAProxyClient{})
+
+	for i := 0; i < 5; i++ {
+		c.recordBreakerOutcome(context.Background(), errors.New("backend rejected"))
+	}
+	if c.breaker.isOpen() {
+		t.Error("Expected failures of a reachable Data Plane API to leave the breaker closed")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	c := breakerConnector(&mockHAProxyClient{getVersionError: errors.New("connection refused")})
+	c.config.HAProxy.CircuitBreaker.FailureThreshold = 0
+
+	for i := 0; i < 5; i++ {
+		c.recordBreakerOutcome(context.Background(), errors.New("connection refused"))
+	}
+	if c.breaker.isOpen() {
+		t.Error("Expected the breaker to stay closed when disabled")
+	}
+}
+
+// conflictingClient fails the first server creations with a version conflict, as if another writer
+// changed the configuration meanwhile
+type conflictingClient struct {
+	*mockHAProxyClient
+	conflicts int
+}
+
+func (c *conflictingClient) CreateServer(backendName string, server *haproxy.Server, version int) (*haproxy.Server, error) {
+	if c.conflicts > 0 {
+		c.conflicts--
+		return nil, &haproxy.APIError{StatusCode: http.StatusConflict, Message: "version mismatch, expected 2, got 1"}
+	}
+	return c.mockHAProxyClient.CreateServer(backendName, server, version)
+}
+
+func TestVersionConflictProcessesEventAgain(t *testing.T) {
+	client := &conflictingClient{mockHAProxyClient: &mockHAProxyClient{}, conflicts: 1}
+	c := breakerConnector(client.mockHAProxyClient)
+	c.haproxyClient = client
+
+	c.applyEvent(context.Background(), breakerEvent("web"))
+	if client.conflicts != 0 || c.errors != 0 {
+		t.Errorf("Expected the event to be applied again after the conflict, got %d errors", c.errors)
+	}
+}
@@ -0,0 +1,226 @@
+package connector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Canary constants
+const (
+	CanaryPercentTag    = "haproxy.canary.percent="
+	CanaryWeightTag     = "haproxy.canary.weight=" // alias of haproxy.canary.percent
+	CanaryBackendSuffix = "_canary"
+)
+
+// parseCanaryPercent reads the share of the domain's traffic a canary instance should receive from
+// haproxy.canary.percent or haproxy.canary.weight. Returns 0 if the service is not a canary or the
+// percentage is not between 1 and 99.
+func parseCanaryPercent(tags []string) int {
+	for _, tag := range tags {
+		value, ok := strings.CutPrefix(tag, CanaryPercentTag)
+		if !ok {
+			value, ok = strings.CutPrefix(tag, CanaryWeightTag)
+		}
+		if !ok {
+			continue
+		}
+		percent, err := strconv.Atoi(value)
+		if err != nil || percent < 1 || percent > 99 {
+			return 0
+		}
+		return percent
+	}
+	return 0
+}
+
+// isCanary checks if the service instance is a canary of a dynamic service. Nomad only registers the
+// canary_tags of a service for canary allocations, so the tag marks the instances of an unpromoted deployment.
+func isCanary(tags []string) bool {
+	return parseCanaryPercent(tags) > 0 && classifyService(tags) == haproxy.ServiceTypeDynamic
+}
+
+// serviceBackendName returns the backend an instance of the service is registered in: canaries get a
+// backend of their own next to the stable one, blue/green instances one per color
+func serviceBackendName(serviceName string, tags []string) string {
+	if isCanary(tags) {
+		return canaryBackendName(stableBackendName(serviceName, tags))
+	}
+	if color := parseDeployment(tags); color != "" {
+		return deploymentBackendName(stableBackendName(serviceName, tags), color)
+	}
+	return stableBackendName(serviceName, tags)
+}
+
+// canaryBackendName returns the name of the canary backend of a stable backend
+func canaryBackendName(stableBackend string) string {
+	return stableBackend + CanaryBackendSuffix
+}
+
+// reconcileCanaryRouting sets up routing for a canary instance. The domain, its certificate, rate limit and
+// redirects belong to the stable instances; the canary only adds its share to the stable domain rule.
+func (hs *handlerState) reconcileCanaryRouting(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	backendName string,
+	result map[string]string,
+	defaultFrontends []string,
+) error {
+	if err := reconcileStickRule(client, backendName, parseStickyMode(tags) == StickyModeSource, result); err != nil {
+		return err
+	}
+	if err := reconcileHeaders(client, backendName, tags, result); err != nil {
+		return err
+	}
+
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if domainMapping == nil {
+		result["canary_warning"] = "canary has no haproxy.domain tag to split traffic of"
+		return nil
+	}
+
+	percent := parseCanaryPercent(tags)
+	stableBackend := stableBackendName(serviceName, tags)
+	if err := hs.setCanaryRule(client, parseFrontends(tags, defaultFrontends), domainMapping.Domain, stableBackend,
+		backendName, percent, result); err != nil {
+		return err
+	}
+	result["canary"] = fmt.Sprintf("%d%% of %s -> %s", percent, domainMapping.Domain, backendName)
+	return nil
+}
+
+// setCanaryRule attaches the canary backend to the stable domain rule in every frontend, or detaches it
+// again if canaryBackend is empty
+func (hs *handlerState) setCanaryRule(
+	client haproxy.ClientInterface,
+	frontends []string,
+	domain, stableBackend, canaryBackend string,
+	percent int,
+	result map[string]string,
+) error {
+	var missing []string
+	for _, frontendName := range frontends {
+		rules, err := client.GetFrontendRules(frontendName)
+		if err != nil {
+			return fmt.Errorf("failed to get frontend rules of %s: %w", frontendName, err)
+		}
+
+		found := false
+		for _, rule := range rules {
+			if rule.Domain != domain || rule.Backend != stableBackend {
+				continue
+			}
+			found = true
+			if rule.CanaryBackend == canaryBackend && rule.CanaryPercent == percent {
+				break
+			}
+			rule.CanaryBackend = canaryBackend
+			rule.CanaryPercent = percent
+			if err := client.SetFrontendRule(frontendName, rule); err != nil {
+				return fmt.Errorf("failed to update canary of domain %s in frontend %s: %w", domain, frontendName, err)
+			}
+			hs.recordBackendChange(stableBackend)
+			break
+		}
+		if !found {
+			missing = append(missing, frontendName)
+		}
+	}
+
+	// Without stable rule there is nothing to split; a canary for a brand new domain gets no traffic
+	if len(missing) > 0 && canaryBackend != "" {
+		result["canary_warning"] = fmt.Sprintf("no rule for %s -> %s in frontend %s", domain, stableBackend,
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// removeCanaryRouting stops sending traffic to the canary backend once its last instance is gone,
+// e.g. when a deployment failed or was reverted. The empty backend is deleted by the next promotion check.
+func (hs *handlerState) removeCanaryRouting(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	result map[string]string,
+	defaultFrontends []string,
+) {
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if domainMapping == nil {
+		return
+	}
+	err := hs.setCanaryRule(client, parseFrontends(tags, defaultFrontends), domainMapping.Domain,
+		stableBackendName(serviceName, tags), "", 0, result)
+	if err != nil {
+		result["canary_warning"] = err.Error()
+		return
+	}
+	result["canary_removed"] = canaryBackendName(stableBackendName(serviceName, tags))
+}
+
+// promoteCanary cleans up after a canary deployment was promoted. Promoted allocations register with the
+// stable tags, so their servers are moved out of the canary backend; once it is empty the canary rule and
+// backend are removed.
+func (hs *handlerState) promoteCanary(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	backendName string,
+	result map[string]string,
+	defaultFrontends []string,
+) error {
+	canaryBackend := canaryBackendName(backendName)
+	if _, err := client.GetBackend(canaryBackend); haproxy.IsNotFound(err) {
+		// No canary backend, nothing to promote
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get canary backend %s: %w", canaryBackend, err)
+	}
+
+	canaryServers, err := client.GetServers(canaryBackend)
+	if err != nil {
+		return fmt.Errorf("failed to get servers of canary backend %s: %w", canaryBackend, err)
+	}
+	stableServers, err := client.GetServers(backendName)
+	if err != nil {
+		return fmt.Errorf("failed to get servers of backend %s: %w", backendName, err)
+	}
+
+	remaining := 0
+	for _, server := range canaryServers {
+		if !containsServer(stableServers, server.Name) {
+			remaining++
+			continue
+		}
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for canary promotion: %w", err)
+		}
+		if err := client.DeleteServer(canaryBackend, server.Name, version); err != nil {
+			return fmt.Errorf("failed to remove promoted server %s from %s: %w", server.Name, canaryBackend, err)
+		}
+	}
+	if remaining > 0 {
+		return nil
+	}
+
+	if domainMapping := parseDomainMapping(serviceName, tags); domainMapping != nil {
+		if err := hs.setCanaryRule(client, parseFrontends(tags, defaultFrontends), domainMapping.Domain, backendName,
+			"", 0, result); err != nil {
+			return err
+		}
+	}
+
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for canary backend removal: %w", err)
+	}
+	if err := client.DeleteBackend(canaryBackend, version); err != nil {
+		return fmt.Errorf("failed to delete canary backend %s: %w", canaryBackend, err)
+	}
+	hs.recordBackendChange(canaryBackend)
+	result["canary_promoted"] = canaryBackend
+	return nil
+}
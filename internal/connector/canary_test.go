@@ -0,0 +1,159 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestParseCanaryPercent(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		expected int
+	}{
+		{name: "no canary", tags: []string{"haproxy.enable=true"}, expected: 0},
+		{name: "valid", tags: []string{"haproxy.canary.percent=20"}, expected: 20},
+		{name: "zero", tags: []string{"haproxy.canary.percent=0"}, expected: 0},
+		{name: "all traffic", tags: []string{"haproxy.canary.percent=100"}, expected: 0},
+		{name: "not a number", tags: []string{"haproxy.canary.percent=half"}, expected: 0},
+		{name: "weight alias", tags: []string{"haproxy.canary.weight=10"}, expected: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if percent := parseCanaryPercent(tt.tags); percent != tt.expected {
+				t.Errorf("parseCanaryPercent() = %d, expected %d", percent, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServiceBackendName(t *testing.T) {
+	stable := []string{"haproxy.enable=true", "haproxy.domain=app.example.com"}
+	canary := append([]string{"haproxy.canary.percent=20"}, stable...)
+	custom := []string{"haproxy.enable=true", "haproxy.backend=custom", "haproxy.canary.percent=20"}
+
+	if name := serviceBackendName("app", stable); name != "app" {
+		t.Errorf("Expected stable backend app, got %s", name)
+	}
+	if name := serviceBackendName("app", canary); name != "app_canary" {
+		t.Errorf("Expected canary backend app_canary, got %s", name)
+	}
+	if name := serviceBackendName("app", custom); name != "app" {
+		t.Errorf("Expected canary tag to be ignored for custom backends, got %s", name)
+	}
+}
+
+func TestReconcileServiceRoutingCanary(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{
+		frontendRules: map[string][]haproxy.FrontendRule{
+			"https": {{Domain: "app.example.com", Backend: "app", Type: haproxy.DomainTypeExact}},
+		},
+	}
+	tags := []string{"haproxy.enable=true", "haproxy.domain=app.example.com", "haproxy.canary.percent=20"}
+	haproxyCfg := &config.HAProxyConfig{Frontend: "https"}
+	result := map[string]string{}
+
+	if err := hs.reconcileServiceRouting(mock, "app", tags, "app_canary", result, haproxyCfg); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+
+	if len(mock.addFrontendRuleCalls) != 0 {
+		t.Errorf("Expected canary not to get a domain rule of its own, got %+v", mock.addFrontendRuleCalls)
+	}
+	if len(mock.setFrontendRules) != 1 {
+		t.Fatalf("Expected stable rule to be updated once, got %+v", mock.setFrontendRules)
+	}
+	rule := mock.setFrontendRules[0]
+	if rule.Backend != "app" || rule.CanaryBackend != "app_canary" || rule.CanaryPercent != 20 {
+		t.Errorf("Expected 20%% of app.example.com to go to app_canary, got %+v", rule)
+	}
+
+	// Re-registering another canary instance leaves the rule alone
+	if err := hs.reconcileServiceRouting(mock, "app", tags, "app_canary", result, haproxyCfg); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+	if len(mock.setFrontendRules) != 1 {
+		t.Errorf("Expected unchanged canary rule not to be rewritten, got %+v", mock.setFrontendRules)
+	}
+}
+
+func TestReconcileServiceRoutingCanaryWithoutStableRule(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{}
+	tags := []string{"haproxy.enable=true", "haproxy.domain=app.example.com", "haproxy.canary.percent=20"}
+	result := map[string]string{}
+
+	if err := hs.reconcileServiceRouting(mock, "app", tags, "app_canary", result, &config.HAProxyConfig{Frontend: "https"}); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+	if len(mock.setFrontendRules) != 0 || len(mock.addFrontendRuleCalls) != 0 {
+		t.Errorf("Expected no frontend rule changes, got %+v %+v", mock.setFrontendRules, mock.addFrontendRuleCalls)
+	}
+	if result["canary_warning"] == "" {
+		t.Error("Expected a warning about the missing stable rule")
+	}
+}
+
+func TestPromoteCanary(t *testing.T) {
+	hs := newHandlerState()
+	promoted := haproxy.Server{Name: "app_10_0_0_2_8080"}
+	mock := &mockHAProxyClient{
+		backends: map[string]*haproxy.Backend{"app_canary": {Name: "app_canary"}},
+		backendServers: map[string][]haproxy.Server{
+			"app":        {{Name: "app_10_0_0_1_8080"}, promoted},
+			"app_canary": {promoted},
+		},
+		frontendRules: map[string][]haproxy.FrontendRule{
+			"https": {{Domain: "app.example.com", Backend: "app", CanaryBackend: "app_canary", CanaryPercent: 20}},
+		},
+	}
+	tags := []string{"haproxy.enable=true", "haproxy.domain=app.example.com"}
+	result := map[string]string{}
+
+	if err := hs.reconcileServiceRouting(mock, "app", tags, "app", result, &config.HAProxyConfig{Frontend: "https"}); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+
+	if len(mock.deletedServers) != 1 || mock.deletedServers[0] != "app_canary/app_10_0_0_2_8080" {
+		t.Errorf("Expected promoted server to leave the canary backend, got %v", mock.deletedServers)
+	}
+	if len(mock.deletedBackends) != 1 || mock.deletedBackends[0] != "app_canary" {
+		t.Errorf("Expected canary backend to be deleted, got %v", mock.deletedBackends)
+	}
+	if rule := mock.frontendRules["https"][0]; rule.CanaryBackend != "" || rule.CanaryPercent != 0 {
+		t.Errorf("Expected canary rule to be removed, got %+v", rule)
+	}
+	if result["canary_promoted"] != "app_canary" {
+		t.Errorf("Expected promotion in result, got %v", result)
+	}
+}
+
+func TestPromoteCanaryKeepsUnpromotedInstances(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{
+		backends: map[string]*haproxy.Backend{"app_canary": {Name: "app_canary"}},
+		backendServers: map[string][]haproxy.Server{
+			"app":        {{Name: "app_10_0_0_1_8080"}},
+			"app_canary": {{Name: "app_10_0_0_2_8080"}},
+		},
+		frontendRules: map[string][]haproxy.FrontendRule{
+			"https": {{Domain: "app.example.com", Backend: "app", CanaryBackend: "app_canary", CanaryPercent: 20}},
+		},
+	}
+	tags := []string{"haproxy.enable=true", "haproxy.domain=app.example.com"}
+
+	if err := hs.reconcileServiceRouting(mock, "app", tags, "app", map[string]string{}, &config.HAProxyConfig{Frontend: "https"}); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+
+	if len(mock.deletedServers) != 0 || len(mock.deletedBackends) != 0 {
+		t.Errorf("Expected running canary to be kept, got servers %v, backends %v", mock.deletedServers, mock.deletedBackends)
+	}
+	if rule := mock.frontendRules["https"][0]; rule.CanaryBackend != "app_canary" {
+		t.Errorf("Expected canary rule to be kept, got %+v", rule)
+	}
+}
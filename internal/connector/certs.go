@@ -0,0 +1,146 @@
+package connector
+
+import (
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Certificate tag and meta keys
+const (
+	CertPathTag  = "haproxy.cert.path="
+	CertPathMeta = "haproxy_cert_path"
+)
+
+// metaTags lists the supported meta keys and the tags they are equivalent to
+var metaTags = []struct {
+	Meta string
+	Tag  string
+}{
+	{CertPathMeta, CertPathTag},
+	{AuthUserlistMeta, AuthUserlistTag},
+	{AuthUserMeta, AuthUserTag},
+	{AuthPasswordMeta, AuthPasswordTag},
+	{DeploymentMeta, DeploymentTag},
+	{ActiveDeploymentMeta, ActiveDeploymentTag},
+}
+
+// metaTagPrefix marks meta keys named like a tag, e.g. haproxy.domain, which are taken as key=value tags
+const metaTagPrefix = "haproxy."
+
+// serviceTags returns the service tags extended with tag equivalents of supported meta keys and of
+// meta keys named like a tag. Meta values are taken whole, so they may contain spaces and '='.
+// Explicit tags take precedence over meta.
+func serviceTags(tags []string, meta map[string]string) []string {
+	extended := tags
+	add := func(tag, value string) {
+		if value == "" || hasTagPrefix(tags, tag) || hasTagPrefix(extended, tag) {
+			return
+		}
+		extended = append(append([]string{}, extended...), tag+value)
+	}
+	for _, mapping := range metaTags {
+		add(mapping.Tag, meta[mapping.Meta])
+	}
+
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		if strings.HasPrefix(key, metaTagPrefix) && !strings.Contains(key, "=") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add(key+"=", meta[key])
+	}
+	return extended
+}
+
+// hasTagPrefix checks if any tag starts with prefix
+func hasTagPrefix(tags []string, prefix string) bool {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCertPath returns the PEM file referenced by the haproxy.cert.path tag
+func parseCertPath(tags []string) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, CertPathTag) {
+			return strings.TrimPrefix(tag, CertPathTag)
+		}
+	}
+	return ""
+}
+
+// certificateFingerprint returns the SHA-256 fingerprint of the first certificate in a PEM bundle,
+// in the uppercase hex format the Data Plane API reports
+func certificateFingerprint(data []byte) (string, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return "", fmt.Errorf("no certificate found in PEM data")
+		}
+		if block.Type == "CERTIFICATE" {
+			return fmt.Sprintf("%X", sha256.Sum256(block.Bytes)), nil
+		}
+	}
+}
+
+// fingerprintsMatch compares fingerprints ignoring case and colon separators
+func fingerprintsMatch(a, b string) bool {
+	normalize := func(s string) string { return strings.ToUpper(strings.ReplaceAll(s, ":", "")) }
+	return a != "" && normalize(a) == normalize(b)
+}
+
+// reconcileCertificate uploads or refreshes the PEM referenced by haproxy.cert.path in the
+// Data Plane API storage, so it is in place before the frontend rule for the domain is added
+func reconcileCertificate(client haproxy.ClientInterface, tags []string, result map[string]string) error {
+	certPath := parseCertPath(tags)
+	if certPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate %s: %w", certPath, err)
+	}
+	fingerprint, err := certificateFingerprint(data)
+	if err != nil {
+		return fmt.Errorf("invalid certificate %s: %w", certPath, err)
+	}
+
+	name := filepath.Base(certPath)
+	existing, err := client.GetSSLCertificate(name)
+	if err != nil && !haproxy.IsNotFound(err) {
+		return fmt.Errorf("failed to get certificate %s: %w", name, err)
+	}
+	if err != nil {
+		if _, err := client.CreateSSLCertificate(name, data); err != nil {
+			return fmt.Errorf("failed to upload certificate %s: %w", name, err)
+		}
+		result["certificate"] = "installed: " + name
+		return nil
+	}
+
+	if fingerprintsMatch(existing.SHA256FingerPrint, fingerprint) {
+		result["certificate"] = "exists: " + name
+		return nil
+	}
+
+	if _, err := client.ReplaceSSLCertificate(name, data); err != nil {
+		return fmt.Errorf("failed to refresh certificate %s: %w", name, err)
+	}
+	result["certificate"] = "refreshed: " + name
+	return nil
+}
@@ -0,0 +1,160 @@
+package connector
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// writeTestCertificate writes a self-signed certificate and key for domain as PEM bundle
+func writeTestCertificate(t *testing.T, path, domain string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+}
+
+func TestServiceTags_CertPathFromMeta(t *testing.T) {
+	tags := []string{"haproxy.enable=true"}
+
+	got := serviceTags(tags, map[string]string{CertPathMeta: "/certs/a.pem"})
+	if parseCertPath(got) != "/certs/a.pem" {
+		t.Errorf("Expected cert path from meta, got %v", got)
+	}
+	if len(tags) != 1 {
+		t.Errorf("serviceTags must not modify the original tags, got %v", tags)
+	}
+
+	got = serviceTags([]string{CertPathTag + "/certs/tag.pem"}, map[string]string{CertPathMeta: "/certs/meta.pem"})
+	if parseCertPath(got) != "/certs/tag.pem" {
+		t.Errorf("Expected tag to take precedence over meta, got %v", got)
+	}
+}
+
+func TestServiceTags_TagNamedMeta(t *testing.T) {
+	meta := map[string]string{
+		"haproxy.enable":                "true",
+		"haproxy.domain":                `^(www|shop)\.example\.com$`,
+		"haproxy.domain.type":           "regex",
+		"haproxy.header.request.X-Note": "a=b c",
+		"haproxy.frontend":              "http",
+		"version":                       "1.2",
+	}
+	tags := serviceTags([]string{"haproxy.frontend=https"}, meta)
+
+	if !hasTag(tags, "haproxy.enable=true") {
+		t.Errorf("Expected haproxy.enable from meta, got %v", tags)
+	}
+	mapping := parseDomainMapping("shop", tags)
+	if mapping == nil || mapping.Domain != `^(www|shop)\.example\.com$` || mapping.Type != haproxy.DomainTypeRegex {
+		t.Errorf("Expected the regex domain from meta, got %+v", mapping)
+	}
+	if !hasTag(tags, "haproxy.header.request.X-Note=a=b c") {
+		t.Errorf("Expected the meta value to be kept whole, got %v", tags)
+	}
+	if hasTag(tags, "haproxy.frontend=http") {
+		t.Errorf("Expected the tag to take precedence over meta, got %v", tags)
+	}
+	if hasTagPrefix(tags, "version") {
+		t.Errorf("Expected other meta keys to be ignored, got %v", tags)
+	}
+}
+
+func TestCertificateInstalledBeforeFrontendRule(t *testing.T) {
+	certPath := filepath.Join(t.TempDir(), "shop.example.com.pem")
+	writeTestCertificate(t, certPath, "shop.example.com")
+
+	mock := &mockHAProxyClient{}
+	event := &ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Service: Service{
+			ServiceName: "shop",
+			Address:     "10.0.0.7",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=shop.example.com", CertPathTag + certPath},
+		},
+	}
+
+	result, err := ProcessServiceEvent(context.Background(), mock, event, testConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	if got := result.(map[string]string)["certificate"]; got != "installed: shop.example.com.pem" {
+		t.Errorf("Expected certificate to be installed, got %q", got)
+	}
+	if _, exists := mock.sslCertificates["shop.example.com.pem"]; !exists {
+		t.Fatalf("Expected certificate in storage, got %v", mock.sslCertificates)
+	}
+
+	// Unchanged certificate is left alone
+	result, err = ProcessServiceEvent(context.Background(), mock, event, testConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	if got := result.(map[string]string)["certificate"]; got != "exists: shop.example.com.pem" {
+		t.Errorf("Expected certificate to be unchanged, got %q", got)
+	}
+
+	// Renewed certificate is refreshed
+	writeTestCertificate(t, certPath, "shop.example.com")
+	if _, err := ProcessServiceEvent(context.Background(), mock, event, testConfig()); err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	if len(mock.replacedCertificates) != 1 {
+		t.Errorf("Expected renewed certificate to be replaced, got %v", mock.replacedCertificates)
+	}
+}
+
+func TestCertificateFailureBlocksFrontendRule(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	event := &ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Service: Service{
+			ServiceName: "shop",
+			Address:     "10.0.0.7",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=shop.example.com", CertPathTag + "/nonexistent/shop.pem"},
+		},
+	}
+
+	if _, err := ProcessServiceEvent(context.Background(), mock, event, testConfig()); err == nil {
+		t.Fatal("Expected error for missing certificate")
+	}
+	if len(mock.addFrontendRuleCalls) != 0 {
+		t.Errorf("Expected no frontend rule without certificate, got %v", mock.addFrontendRuleCalls)
+	}
+}
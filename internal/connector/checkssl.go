@@ -0,0 +1,98 @@
+package connector
+
+import (
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// Health check TLS tags
+const (
+	CheckSSLTag    = "haproxy.check.ssl="
+	CheckVerifyTag = "haproxy.check.verify="
+	CheckCAFileTag = "haproxy.check.ca_file="
+)
+
+// Certificate verification of TLS health checks
+const (
+	SSLVerifyNone     = "none"
+	SSLVerifyRequired = "required"
+
+	// SystemCAFile verifies server certificates against the system's trusted CAs
+	SystemCAFile = "@system-ca"
+)
+
+// CheckTLS runs the health checks of TLS-only upstreams over TLS (check-ssl)
+type CheckTLS struct {
+	SSL    bool
+	Verify string // none or required
+	CAFile string // only used with verify required
+}
+
+// nomadCheckTLS derives the TLS of a Nomad check: https checks verify the certificate against
+// the system CAs like Nomad does, unless tls_skip_verify is set
+func nomadCheckTLS(nomadCheck *nomad.ServiceCheck) CheckTLS {
+	if nomadCheck.Type != "https" && nomadCheck.Protocol != "https" {
+		return CheckTLS{}
+	}
+	if nomadCheck.TLSSkipVerify {
+		return CheckTLS{SSL: true, Verify: SSLVerifyNone}
+	}
+	return CheckTLS{SSL: true, Verify: SSLVerifyRequired}
+}
+
+// applyCheckTLSTag sets the TLS of a haproxy.check.ssl/verify/ca_file tag and reports whether
+// the tag was one of them
+func applyCheckTLSTag(checkTLS *CheckTLS, tag string) bool {
+	switch {
+	case strings.HasPrefix(tag, CheckSSLTag):
+		checkTLS.SSL = strings.TrimPrefix(tag, CheckSSLTag) == "true"
+	case strings.HasPrefix(tag, CheckVerifyTag):
+		if verify := strings.TrimPrefix(tag, CheckVerifyTag); verify == SSLVerifyNone || verify == SSLVerifyRequired {
+			checkTLS.Verify = verify
+		}
+	case strings.HasPrefix(tag, CheckCAFileTag):
+		checkTLS.CAFile = strings.TrimPrefix(tag, CheckCAFileTag)
+	default:
+		return false
+	}
+	return true
+}
+
+// normalize fills the defaults of enabled TLS checks: no verification unless required, and the
+// system CAs when verification is required without a CA file
+func (t CheckTLS) normalize() CheckTLS {
+	if !t.SSL {
+		return CheckTLS{}
+	}
+	if t.Verify == "" {
+		t.Verify = SSLVerifyNone
+	}
+	if t.Verify == SSLVerifyNone {
+		t.CAFile = ""
+	} else if t.CAFile == "" {
+		t.CAFile = SystemCAFile
+	}
+	return t
+}
+
+// applyCheckTLS configures check-ssl, verify and ca-file on the default server
+func applyCheckTLS(backend *haproxy.Backend, healthCheckConfig *HealthCheckConfig) {
+	if healthCheckConfig == nil || healthCheckConfig.Disabled || !healthCheckConfig.SSL {
+		return
+	}
+	backend.DefaultServer.CheckSSL = CheckEnabled
+	backend.DefaultServer.Verify = healthCheckConfig.Verify
+	backend.DefaultServer.SSLCAFile = healthCheckConfig.CAFile
+}
+
+// checkTLSMatches checks if the check TLS of the existing backend matches the desired one
+func checkTLSMatches(existing, desired *haproxy.Backend) bool {
+	if existing.DefaultServer == nil {
+		return false
+	}
+	return existing.DefaultServer.CheckSSL == desired.DefaultServer.CheckSSL &&
+		existing.DefaultServer.Verify == desired.DefaultServer.Verify &&
+		existing.DefaultServer.SSLCAFile == desired.DefaultServer.SSLCAFile
+}
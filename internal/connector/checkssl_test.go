@@ -0,0 +1,80 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func TestResolveHealthCheckConfig_TLS(t *testing.T) {
+	tests := []struct {
+		name       string
+		tags       []string
+		nomadCheck *nomad.ServiceCheck
+		expected   CheckTLS
+	}{
+		{
+			name:       "nomad https protocol verifies against the system CAs",
+			nomadCheck: &nomad.ServiceCheck{Type: "http", Protocol: "https", Path: "/health"},
+			expected:   CheckTLS{SSL: true, Verify: SSLVerifyRequired, CAFile: SystemCAFile},
+		},
+		{
+			name:       "nomad tls_skip_verify",
+			nomadCheck: &nomad.ServiceCheck{Type: "http", Protocol: "https", Path: "/health", TLSSkipVerify: true},
+			expected:   CheckTLS{SSL: true, Verify: SSLVerifyNone},
+		},
+		{
+			name:     "ssl tag without verification",
+			tags:     []string{"haproxy.check.path=/health", "haproxy.check.ssl=true"},
+			expected: CheckTLS{SSL: true, Verify: SSLVerifyNone},
+		},
+		{
+			name:     "ssl tag with own CA",
+			tags:     []string{"haproxy.check.ssl=true", "haproxy.check.verify=required", "haproxy.check.ca_file=/etc/haproxy/ca.pem"},
+			expected: CheckTLS{SSL: true, Verify: SSLVerifyRequired, CAFile: "/etc/haproxy/ca.pem"},
+		},
+		{
+			name:       "ssl tag disables TLS of the nomad check",
+			tags:       []string{"haproxy.check.ssl=false"},
+			nomadCheck: &nomad.ServiceCheck{Type: "https", Path: "/health"},
+			expected:   CheckTLS{},
+		},
+		{
+			name:       "plain http check",
+			nomadCheck: &nomad.ServiceCheck{Type: "http", Path: "/health"},
+			expected:   CheckTLS{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := resolveHealthCheckConfig(tt.tags, tt.nomadCheck)
+			if config == nil {
+				t.Fatal("Expected a health check config")
+			}
+			if config.CheckTLS != tt.expected {
+				t.Errorf("Expected TLS %+v, got %+v", tt.expected, config.CheckTLS)
+			}
+		})
+	}
+}
+
+func TestBuildDesiredBackend_CheckTLS(t *testing.T) {
+	nomadCheck := &nomad.ServiceCheck{Type: "http", Protocol: "https", Path: "/health", Method: "POST"}
+	tags := []string{"haproxy.enable=true", "haproxy.check.ssl=true"}
+	config := resolveHealthCheckConfig(tags, nomadCheck)
+	if config.Method != "POST" {
+		t.Errorf("Expected the TLS tag to keep the method of the Nomad check, got %s", config.Method)
+	}
+
+	desired := buildDesiredBackend("api", config, tags)
+	server := desired.DefaultServer
+	if server.CheckSSL != CheckEnabled || server.Verify != SSLVerifyRequired || server.SSLCAFile != SystemCAFile {
+		t.Fatalf("Expected check-ssl with verification on the default server, got %+v", server)
+	}
+
+	plain := buildDesiredBackend("api", resolveHealthCheckConfig([]string{"haproxy.check.path=/health"}, nil), nil)
+	if plain.DefaultServer.CheckSSL != "" || backendConfigMatches(plain, desired, nil, config) {
+		t.Errorf("Expected a plain backend without check-ssl to be updated, got %+v", plain.DefaultServer)
+	}
+}
@@ -0,0 +1,73 @@
+package connector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Health check timing tags
+const (
+	CheckIntervalTag = "haproxy.check.interval="
+	CheckTimeoutTag  = "haproxy.check.timeout="
+	CheckRiseTag     = "haproxy.check.rise="
+	CheckFallTag     = "haproxy.check.fall="
+)
+
+// CheckTiming tunes how often servers are checked and how many checks flip their state.
+// Zero values leave the HAProxy defaults (inter 2s, rise 2, fall 3, timeout check unset).
+type CheckTiming struct {
+	Interval int // milliseconds
+	Timeout  int // milliseconds
+	Rise     int
+	Fall     int
+}
+
+// applyCheckTimingTag sets the timing of a haproxy.check.interval/timeout/rise/fall tag and reports
+// whether the tag was one of them. Invalid values are ignored.
+func applyCheckTimingTag(timing *CheckTiming, tag string) bool {
+	switch {
+	case strings.HasPrefix(tag, CheckIntervalTag):
+		if interval := parseTimeoutMs(strings.TrimPrefix(tag, CheckIntervalTag)); interval > 0 {
+			timing.Interval = interval
+		}
+	case strings.HasPrefix(tag, CheckTimeoutTag):
+		if timeout := parseTimeoutMs(strings.TrimPrefix(tag, CheckTimeoutTag)); timeout > 0 {
+			timing.Timeout = timeout
+		}
+	case strings.HasPrefix(tag, CheckRiseTag):
+		if rise, err := strconv.Atoi(strings.TrimPrefix(tag, CheckRiseTag)); err == nil && rise > 0 {
+			timing.Rise = rise
+		}
+	case strings.HasPrefix(tag, CheckFallTag):
+		if fall, err := strconv.Atoi(strings.TrimPrefix(tag, CheckFallTag)); err == nil && fall > 0 {
+			timing.Fall = fall
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// applyCheckTiming configures inter, rise and fall on the default server and the check timeout on the backend
+func applyCheckTiming(backend *haproxy.Backend, healthCheckConfig *HealthCheckConfig) {
+	if healthCheckConfig == nil || healthCheckConfig.Disabled {
+		return
+	}
+	backend.DefaultServer.Inter = healthCheckConfig.Interval
+	backend.DefaultServer.Rise = healthCheckConfig.Rise
+	backend.DefaultServer.Fall = healthCheckConfig.Fall
+	backend.CheckTimeout = healthCheckConfig.Timeout
+}
+
+// checkTimingMatches checks if the check timing of the existing backend matches the desired one,
+// so changed or removed tags are reconciled
+func checkTimingMatches(existing, desired *haproxy.Backend) bool {
+	if existing.CheckTimeout != desired.CheckTimeout || existing.DefaultServer == nil {
+		return false
+	}
+	return existing.DefaultServer.Inter == desired.DefaultServer.Inter &&
+		existing.DefaultServer.Rise == desired.DefaultServer.Rise &&
+		existing.DefaultServer.Fall == desired.DefaultServer.Fall
+}
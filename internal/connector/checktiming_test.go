@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func TestResolveHealthCheckConfig_Timing(t *testing.T) {
+	nomadCheck := &nomad.ServiceCheck{Type: "http", Path: "/ready", Method: "HEAD", Interval: 5 * time.Second, Timeout: time.Second}
+
+	tests := []struct {
+		name       string
+		tags       []string
+		nomadCheck *nomad.ServiceCheck
+		expected   CheckTiming
+		method     string
+	}{
+		{
+			name:       "nomad check interval and timeout",
+			tags:       []string{"haproxy.enable=true"},
+			nomadCheck: nomadCheck,
+			expected:   CheckTiming{Interval: 5000, Timeout: 1000},
+			method:     "HEAD",
+		},
+		{
+			name:       "tags override nomad check, path and method are kept",
+			tags:       []string{"haproxy.check.interval=10s", "haproxy.check.rise=3", "haproxy.check.fall=5"},
+			nomadCheck: nomadCheck,
+			expected:   CheckTiming{Interval: 10000, Timeout: 1000, Rise: 3, Fall: 5},
+			method:     "HEAD",
+		},
+		{
+			name:     "timing tags alone",
+			tags:     []string{"haproxy.check.interval=1500", "haproxy.check.timeout=2s"},
+			expected: CheckTiming{Interval: 1500, Timeout: 2000},
+		},
+		{
+			name:     "invalid values are ignored",
+			tags:     []string{"haproxy.check.interval=often", "haproxy.check.rise=0", "haproxy.check.fall=-1"},
+			expected: CheckTiming{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := resolveHealthCheckConfig(tt.tags, tt.nomadCheck)
+			if config == nil {
+				t.Fatal("Expected a health check config")
+			}
+			if config.CheckTiming != tt.expected {
+				t.Errorf("Expected timing %+v, got %+v", tt.expected, config.CheckTiming)
+			}
+			if tt.method != "" && config.Method != tt.method {
+				t.Errorf("Expected method %s, got %s", tt.method, config.Method)
+			}
+		})
+	}
+}
+
+func TestBuildDesiredBackend_CheckTiming(t *testing.T) {
+	tags := []string{"haproxy.enable=true", "haproxy.check.interval=5s", "haproxy.check.timeout=1s", "haproxy.check.rise=3", "haproxy.check.fall=2"}
+	config := resolveHealthCheckConfig(tags, nil)
+	desired := buildDesiredBackend("api", config, tags)
+
+	if desired.DefaultServer.Inter != 5000 || desired.DefaultServer.Rise != 3 || desired.DefaultServer.Fall != 2 || desired.CheckTimeout != 1000 {
+		t.Fatalf("Unexpected check timing: %+v (check timeout %d)", desired.DefaultServer, desired.CheckTimeout)
+	}
+
+	// A backend without the timing, e.g. created before the tags were added, is updated
+	existing := buildDesiredBackend("api", resolveHealthCheckConfig([]string{"haproxy.enable=true"}, nil), nil)
+	if backendConfigMatches(existing, desired, nil, config) {
+		t.Error("Expected a backend without the check timing not to match")
+	}
+	if !backendConfigMatches(desired, desired, nil, config) {
+		t.Error("Expected a backend with the check timing to match")
+	}
+}
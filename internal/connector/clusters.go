@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// nomadCluster is a further Nomad cluster or region watched alongside the primary one. Its service
+// names get the backend prefix of the cluster, so equally named services of different clusters
+// don't share a backend unless wanted.
+type nomadCluster struct {
+	clusterClient
+	name   string
+	prefix string
+}
+
+var _ nomad.NomadClient = (*nomadCluster)(nil)
+
+// clusterClient is the Nomad client of a cluster
+type clusterClient interface {
+	nomad.NomadClient
+	allocationHealthChecker
+}
+
+// newNomadCluster connects to a further cluster with the TLS, stall timeout, node watch and address
+// mode settings of the primary one
+func newNomadCluster(cfg *config.Config, cluster *config.NomadClusterConfig) (*nomadCluster, error) {
+	client, err := nomad.NewClientWithTLS(
+		cluster.Address,
+		cluster.Token,
+		cluster.Region,
+		nomad.APITLSConfig(&cfg.Nomad.TLS),
+		logging.StdLogger(logging.ModuleNomad),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Nomad client of cluster %s: %w", cluster.Name, err)
+	}
+	client.SetStallTimeout(time.Duration(cfg.Nomad.StreamStallTimeoutSec) * time.Second)
+	client.SetTokenFile(cluster.TokenFile)
+	client.SetWatchNodes(cfg.Nomad.WatchNodes)
+	client.SetAddressMode(cfg.Nomad.AddressMode)
+	return &nomadCluster{clusterClient: client, name: cluster.Name, prefix: cluster.BackendPrefix}, nil
+}
+
+// GetServices returns the services of the cluster with prefixed names
+func (c *nomadCluster) GetServices() ([]*nomad.Service, error) {
+	services, err := c.clusterClient.GetServices()
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", c.name, err)
+	}
+	for i, svc := range services {
+		services[i] = c.prefixed(svc)
+	}
+	return services, nil
+}
+
+// StreamServiceEvents streams the events of the cluster with prefixed service names
+func (c *nomadCluster) StreamServiceEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	events := make(chan nomad.ServiceEvent, EventChannelBuffer)
+	done := make(chan error, 1)
+	go func() { done <- c.clusterClient.StreamServiceEvents(ctx, events) }()
+
+	for {
+		select {
+		case event := <-events:
+			if event.Payload.Service != nil {
+				event.Payload.Service = c.prefixed(event.Payload.Service)
+			}
+			select {
+			case eventChan <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+// GetServiceCheckFromJob returns the check of a service of this cluster, nil for services of others
+func (c *nomadCluster) GetServiceCheckFromJob(jobID, serviceName string) (*nomad.ServiceCheck, error) {
+	name, ok := c.unprefixed(serviceName)
+	if !ok {
+		return nil, nil
+	}
+	return c.clusterClient.GetServiceCheckFromJob(jobID, name)
+}
+
+// AllocationHealthy checks the health of an allocation of this cluster
+func (c *nomadCluster) AllocationHealthy(allocID, serviceName string) (bool, error) {
+	name, _ := c.unprefixed(serviceName)
+	return c.clusterClient.AllocationHealthy(allocID, name)
+}
+
+func (c *nomadCluster) prefixed(svc *nomad.Service) *nomad.Service {
+	if c.prefix == "" {
+		return svc
+	}
+	renamed := *svc
+	renamed.ServiceName = c.prefix + svc.ServiceName
+	return &renamed
+}
+
+func (c *nomadCluster) unprefixed(serviceName string) (string, bool) {
+	if !strings.HasPrefix(serviceName, c.prefix) {
+		return serviceName, false
+	}
+	return strings.TrimPrefix(serviceName, c.prefix), true
+}
@@ -0,0 +1,92 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// clusterNomadClient is a further cluster knowing one job's check and emitting one event
+type clusterNomadClient struct {
+	healthNomadClient
+	checkJob string
+	event    nomad.ServiceEvent
+}
+
+func (f *clusterNomadClient) GetServiceCheckFromJob(jobID, serviceName string) (*nomad.ServiceCheck, error) {
+	if jobID != f.checkJob || serviceName != "web" {
+		return nil, errors.New("job not found")
+	}
+	return &nomad.ServiceCheck{Type: "http", Path: "/health"}, nil
+}
+
+func (f *clusterNomadClient) StreamServiceEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	eventChan <- f.event
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestNomadClusterPrefixesServiceNames(t *testing.T) {
+	web := &nomad.Service{ServiceName: "web", Address: "10.1.0.1", Port: 8080}
+	cluster := &nomadCluster{
+		clusterClient: &clusterNomadClient{
+			healthNomadClient: healthNomadClient{fakeNomadClient: fakeNomadClient{services: []*nomad.Service{web}}},
+			checkJob:          "web",
+			event:             nomad.ServiceEvent{Type: EventTypeServiceRegistration, Payload: nomad.Payload{Service: web}},
+		},
+		name:   "edge",
+		prefix: "edge_",
+	}
+
+	services, err := cluster.GetServices()
+	if err != nil {
+		t.Fatalf("GetServices() failed: %v", err)
+	}
+	if services[0].ServiceName != "edge_web" || web.ServiceName != "web" {
+		t.Errorf("Expected a prefixed copy of the service, got %s (original %s)", services[0].ServiceName, web.ServiceName)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan nomad.ServiceEvent, 1)
+	go func() { _ = cluster.StreamServiceEvents(ctx, events) }()
+	select {
+	case event := <-events:
+		if event.Payload.Service.ServiceName != "edge_web" {
+			t.Errorf("Expected the event of a prefixed service, got %s", event.Payload.Service.ServiceName)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the event of the cluster")
+	}
+
+	if check, err := cluster.GetServiceCheckFromJob("web", "edge_web"); err != nil || check == nil {
+		t.Errorf("Expected the check of the unprefixed service, got %v, %v", check, err)
+	}
+	if check, err := cluster.GetServiceCheckFromJob("web", "web"); err != nil || check != nil {
+		t.Errorf("Expected no check for services of other clusters, got %v, %v", check, err)
+	}
+}
+
+func TestDiscoverySourcesAskFurtherClusters(t *testing.T) {
+	primary := &healthNomadClient{err: errors.New("allocation not found")}
+	cluster := &nomadCluster{
+		clusterClient: &clusterNomadClient{healthNomadClient: healthNomadClient{healthy: true}, checkJob: "web"},
+		name:          "edge",
+	}
+	sources := &discoverySources{NomadClient: primary, extra: []nomad.NomadClient{newConfiguredServices(nil), cluster}}
+
+	if check, err := sources.GetServiceCheckFromJob("web", "web"); err != nil || check == nil || check.Path != "/health" {
+		t.Errorf("Expected the check of the cluster running the job, got %v, %v", check, err)
+	}
+	if healthy, err := sources.AllocationHealthy("alloc-1", "web"); err != nil || !healthy {
+		t.Errorf("Expected the health of the cluster knowing the allocation, got %v, %v", healthy, err)
+	}
+
+	cluster.clusterClient.(*clusterNomadClient).err = errors.New("allocation not found")
+	if _, err := sources.AllocationHealthy("alloc-1", "web"); err == nil || err.Error() != "allocation not found" {
+		t.Errorf("Expected the error of the primary source, got %v", err)
+	}
+}
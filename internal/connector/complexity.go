@@ -0,0 +1,176 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// ComplexityAPIPath is the admin API endpoint reporting the size of the HAProxy configuration
+const ComplexityAPIPath = "/api/v1/complexity"
+
+// frontendRuleKeywords start the lines counted as rules of a frontend
+var frontendRuleKeywords = []string{
+	"acl", "use_backend", "default_backend", "redirect",
+	"http-request", "http-response", "tcp-request", "tcp-response",
+}
+
+// ConfigComplexity describes the size of the HAProxy configuration file
+type ConfigComplexity struct {
+	Lines            int            `json:"lines"`
+	Bytes            int            `json:"bytes"`
+	Backends         int            `json:"backends"`
+	Frontends        int            `json:"frontends"`
+	Servers          int            `json:"servers"`
+	RulesPerFrontend map[string]int `json:"rules_per_frontend"`
+	Warnings         []string       `json:"warnings,omitempty"`
+	MeasuredAt       time.Time      `json:"measured_at"`
+}
+
+// measureConfigComplexity counts sections, servers and frontend rules of a raw HAProxy configuration.
+// Empty lines and comments are not counted as lines.
+func measureConfigComplexity(raw string) ConfigComplexity {
+	complexity := ConfigComplexity{Bytes: len(raw), RulesPerFrontend: make(map[string]int)}
+
+	section, sectionName := "", ""
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		complexity.Lines++
+
+		// Section keywords start at the beginning of the line, their settings are indented
+		if line[0] != ' ' && line[0] != '\t' {
+			section, sectionName = fields[0], ""
+			if len(fields) > 1 {
+				sectionName = fields[1]
+			}
+			switch section {
+			case "backend":
+				complexity.Backends++
+			case "frontend":
+				complexity.Frontends++
+				complexity.RulesPerFrontend[sectionName] = 0
+			}
+			continue
+		}
+
+		switch {
+		case (section == "backend" || section == "listen") && fields[0] == "server":
+			complexity.Servers++
+		case section == "frontend" && containsString(frontendRuleKeywords, fields[0]):
+			complexity.RulesPerFrontend[sectionName]++
+		}
+	}
+
+	return complexity
+}
+
+// complexityWarnings lists the thresholds the configuration exceeds
+func complexityWarnings(complexity *ConfigComplexity, cfg *config.HAProxyComplexityConfig) []string {
+	var warnings []string
+	if cfg.MaxBackends > 0 && complexity.Backends > cfg.MaxBackends {
+		warnings = append(warnings, fmt.Sprintf("%d backends exceed the limit of %d", complexity.Backends, cfg.MaxBackends))
+	}
+	if cfg.MaxLines > 0 && complexity.Lines > cfg.MaxLines {
+		warnings = append(warnings, fmt.Sprintf("%d configuration lines exceed the limit of %d", complexity.Lines, cfg.MaxLines))
+	}
+	if cfg.MaxRulesPerFrontend > 0 {
+		frontends := make([]string, 0, len(complexity.RulesPerFrontend))
+		for frontend := range complexity.RulesPerFrontend {
+			frontends = append(frontends, frontend)
+		}
+		sort.Strings(frontends)
+		for _, frontend := range frontends {
+			if rules := complexity.RulesPerFrontend[frontend]; rules > cfg.MaxRulesPerFrontend {
+				warnings = append(warnings, fmt.Sprintf("frontend %s has %d rules, exceeding the limit of %d",
+					frontend, rules, cfg.MaxRulesPerFrontend))
+			}
+		}
+	}
+	return warnings
+}
+
+// maxFrontendRules returns the rule count of the frontend with the most rules
+func (c *ConfigComplexity) maxFrontendRules() int {
+	maxRules := 0
+	for _, rules := range c.RulesPerFrontend {
+		maxRules = max(maxRules, rules)
+	}
+	return maxRules
+}
+
+// measureComplexity fetches the raw configuration and records its complexity, logging new warnings
+func (c *Connector) measureComplexity() error {
+	raw, err := c.haproxyClient.GetRawConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to get raw configuration: %w", err)
+	}
+
+	complexity := measureConfigComplexity(raw)
+	complexity.Warnings = complexityWarnings(&complexity, &c.cfg().HAProxy.Complexity)
+	complexity.MeasuredAt = time.Now()
+
+	c.mu.Lock()
+	previous := c.complexity
+	c.complexity = &complexity
+	c.mu.Unlock()
+
+	// Only log when the warnings change, not on every measurement
+	if previous == nil || strings.Join(previous.Warnings, "\n") != strings.Join(complexity.Warnings, "\n") {
+		for _, warning := range complexity.Warnings {
+			c.logger.Printf("Warning: HAProxy configuration is getting large, reloads may slow down: %s", warning)
+		}
+	}
+	return nil
+}
+
+// runComplexityProbe periodically measures the size of the HAProxy configuration
+func (c *Connector) runComplexityProbe(ctx context.Context) {
+	interval := c.cfg().HAProxy.Complexity.IntervalSec
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := c.measureComplexity(); err != nil {
+			c.logger.Printf("Warning: Failed to measure configuration complexity: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// configComplexity returns the latest measurement, or nil before the first one
+func (c *Connector) configComplexity() *ConfigComplexity {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.complexity
+}
+
+// handleComplexity serves the latest configuration complexity measurement on the admin API
+func (c *Connector) handleComplexity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	complexity := c.configComplexity()
+	if complexity == nil {
+		http.Error(w, "configuration not measured yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, complexity)
+}
@@ -0,0 +1,103 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+const complexityTestConfig = `# _version=42
+global
+    daemon
+
+frontend https
+    bind :443
+    acl is_web_1 hdr(host) web.example.com
+    acl is_api_2 hdr(host) api.example.com
+    use_backend web if is_web_1
+    use_backend api if is_api_2
+    http-request auth realm api if is_api_2 !{ http_auth(staff) }
+
+frontend http
+    bind :80
+    http-request redirect scheme https
+
+backend web
+    balance roundrobin
+    server web_1 10.0.0.1:8080 check
+    server web_2 10.0.0.2:8080 check
+
+backend api
+    server api_1 10.0.0.3:8080
+`
+
+func TestMeasureConfigComplexity(t *testing.T) {
+	complexity := measureConfigComplexity(complexityTestConfig)
+
+	if complexity.Lines != 18 {
+		t.Errorf("Expected 18 lines without comments and empty lines, got %d", complexity.Lines)
+	}
+	if complexity.Backends != 2 || complexity.Frontends != 2 || complexity.Servers != 3 {
+		t.Errorf("Expected 2 backends, 2 frontends and 3 servers, got %+v", complexity)
+	}
+	if complexity.RulesPerFrontend["https"] != 5 || complexity.RulesPerFrontend["http"] != 1 {
+		t.Errorf("Expected 5 rules in https and 1 in http, got %v", complexity.RulesPerFrontend)
+	}
+	if complexity.maxFrontendRules() != 5 {
+		t.Errorf("Expected max of 5 frontend rules, got %d", complexity.maxFrontendRules())
+	}
+}
+
+func TestComplexityWarnings(t *testing.T) {
+	complexity := measureConfigComplexity(complexityTestConfig)
+
+	limits := &config.HAProxyComplexityConfig{MaxBackends: 1, MaxLines: 100, MaxRulesPerFrontend: 4}
+	warnings := complexityWarnings(&complexity, limits)
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "2 backends") || !strings.Contains(warnings[1], "frontend https") {
+		t.Errorf("Expected backend and https rule warnings, got %v", warnings)
+	}
+
+	if warnings := complexityWarnings(&complexity, &config.HAProxyComplexityConfig{}); len(warnings) != 0 {
+		t.Errorf("Expected no warnings without limits, got %v", warnings)
+	}
+}
+
+func TestMeasureComplexityLogsWarningsOnce(t *testing.T) {
+	var logs bytes.Buffer
+	c := &Connector{
+		config:        &config.Config{HAProxy: config.HAProxyConfig{Complexity: config.HAProxyComplexityConfig{MaxBackends: 1}}},
+		haproxyClient: &mockHAProxyClient{rawConfiguration: complexityTestConfig},
+		logger:        log.New(&logs, "", 0),
+	}
+
+	recorder := httptest.NewRecorder()
+	c.handleComplexity(recorder, httptest.NewRequest(http.MethodGet, ComplexityAPIPath, http.NoBody))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the first measurement, got %d", recorder.Code)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.measureComplexity(); err != nil {
+			t.Fatalf("measureComplexity() failed: %v", err)
+		}
+	}
+	if count := strings.Count(logs.String(), "2 backends"); count != 1 {
+		t.Errorf("Expected the warning to be logged once, got %d times:\n%s", count, logs.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	c.handleComplexity(recorder, httptest.NewRequest(http.MethodGet, ComplexityAPIPath, http.NoBody))
+	var complexity ConfigComplexity
+	if err := json.NewDecoder(recorder.Body).Decode(&complexity); err != nil {
+		t.Fatalf("Failed to decode complexity: %v", err)
+	}
+	if complexity.Backends != 2 || len(complexity.Warnings) != 1 {
+		t.Errorf("Expected measurement with one warning, got %+v", complexity)
+	}
+}
@@ -0,0 +1,77 @@
+package connector
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Compression tags
+const (
+	CompressionTag      = "haproxy.compression="
+	CompressionTypesTag = "haproxy.compression.types="
+)
+
+// compressionAlgorithms are the algorithms HAProxy compresses responses with
+var compressionAlgorithms = []string{"gzip", "deflate", "raw-deflate", "identity"}
+
+// applyCompression enables the compression of responses on the desired backend with
+// haproxy.compression=gzip, limited to the content types of haproxy.compression.types. Both take
+// comma separated lists; tcp services ignore them.
+func applyCompression(backend *haproxy.Backend, tags []string) {
+	if isTCPMode(tags) {
+		return
+	}
+	var algorithms, types []string
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, CompressionTag):
+			algorithms = splitList(strings.TrimPrefix(tag, CompressionTag))
+		case strings.HasPrefix(tag, CompressionTypesTag):
+			types = splitList(strings.TrimPrefix(tag, CompressionTypesTag))
+		}
+	}
+	algorithms = slices.DeleteFunc(algorithms, func(algorithm string) bool {
+		return !slices.Contains(compressionAlgorithms, algorithm)
+	})
+	if len(algorithms) == 0 {
+		return
+	}
+	backend.Compression = &haproxy.Compression{Algorithms: algorithms, Types: types}
+}
+
+// compressionMatches checks if the compression of the existing backend matches the desired one
+func compressionMatches(existing, desired *haproxy.Backend) bool {
+	if existing.Compression == nil || desired.Compression == nil {
+		return existing.Compression == desired.Compression
+	}
+	return slices.Equal(existing.Compression.Algorithms, desired.Compression.Algorithms) &&
+		slices.Equal(existing.Compression.Types, desired.Compression.Types)
+}
+
+// splitList splits a comma separated tag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// compressionValue checks a comma separated list of compression algorithms
+func compressionValue(value string) error {
+	algorithms := splitList(value)
+	if len(algorithms) == 0 {
+		return fmt.Errorf("empty value")
+	}
+	for _, algorithm := range algorithms {
+		if !slices.Contains(compressionAlgorithms, algorithm) {
+			return fmt.Errorf("%q must be one of %s", algorithm, strings.Join(compressionAlgorithms, ", "))
+		}
+	}
+	return nil
+}
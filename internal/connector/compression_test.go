@@ -0,0 +1,61 @@
+package connector
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBuildDesiredBackendCompression(t *testing.T) {
+	tests := []struct {
+		name       string
+		tags       []string
+		algorithms []string
+		types      []string
+	}{
+		{name: "no compression tags", tags: []string{"haproxy.enable=true"}},
+		{name: "gzip", tags: []string{"haproxy.compression=gzip"}, algorithms: []string{"gzip"}},
+		{name: "types", tags: []string{"haproxy.compression=gzip,deflate", "haproxy.compression.types=text/html, application/json"},
+			algorithms: []string{"gzip", "deflate"}, types: []string{"text/html", "application/json"}},
+		{name: "types without algorithm", tags: []string{"haproxy.compression.types=text/html"}},
+		{name: "unknown algorithm ignored", tags: []string{"haproxy.compression=brotli"}},
+		{name: "tcp mode", tags: []string{"haproxy.mode=tcp", "haproxy.compression=gzip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := buildDesiredBackend("web", nil, tt.tags)
+			if tt.algorithms == nil {
+				if backend.Compression != nil {
+					t.Errorf("Expected no compression, got %+v", backend.Compression)
+				}
+				return
+			}
+			if backend.Compression == nil || !slices.Equal(backend.Compression.Algorithms, tt.algorithms) ||
+				!slices.Equal(backend.Compression.Types, tt.types) {
+				t.Errorf("Expected algorithms %v and types %v, got %+v", tt.algorithms, tt.types, backend.Compression)
+			}
+		})
+	}
+}
+
+func TestBackendConfigMatchesCompression(t *testing.T) {
+	plain := buildDesiredBackend("web", nil, nil)
+	gzip := buildDesiredBackend("web", nil, []string{"haproxy.compression=gzip"})
+	html := buildDesiredBackend("web", nil, []string{"haproxy.compression=gzip", "haproxy.compression.types=text/html"})
+
+	if !backendConfigMatches(gzip, gzip, nil, nil) {
+		t.Error("Expected identical backends to match")
+	}
+	if backendConfigMatches(plain, gzip, nil, nil) {
+		t.Error("Expected enabling compression to require an update")
+	}
+	if backendConfigMatches(gzip, html, nil, nil) {
+		t.Error("Expected changed types to require an update")
+	}
+	if backendConfigMatches(html, plain, nil, nil) {
+		t.Error("Expected disabling compression to require an update")
+	}
+	if problem := checkTag("haproxy.compression=brotli"); problem == "" {
+		t.Error("Expected an unknown algorithm to be reported")
+	}
+}
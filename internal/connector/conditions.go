@@ -0,0 +1,271 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// ConditionsAPIPath is the admin API endpoint listing the connector's conditions
+const ConditionsAPIPath = "/api/v1/conditions"
+
+// ReadyPath is the readiness endpoint, unlike /health it fails while the connector can't follow Nomad
+const ReadyPath = "/ready"
+
+// ConditionProbeIntervalSec is how often HAProxy reachability and drift are checked
+const ConditionProbeIntervalSec = 30
+
+// ConditionType names an aspect of the connector's health
+type ConditionType string
+
+const (
+	ConditionNomadStreamHealthy ConditionType = "NomadStreamHealthy"
+	ConditionHAProxyReachable   ConditionType = "HAProxyReachable"
+	ConditionSyncCompleted      ConditionType = "SyncCompleted"
+	ConditionDriftDetected      ConditionType = "DriftDetected"
+)
+
+// ConditionStatus is the state of a condition, as in Kubernetes
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// conditionOrder is the order conditions are reported in
+var conditionOrder = []ConditionType{
+	ConditionNomadStreamHealthy,
+	ConditionHAProxyReachable,
+	ConditionSyncCompleted,
+	ConditionDriftDetected,
+}
+
+// readinessConditions must all be True for the connector to be ready
+var readinessConditions = []ConditionType{
+	ConditionNomadStreamHealthy,
+	ConditionHAProxyReachable,
+	ConditionSyncCompleted,
+}
+
+// Condition is one typed aspect of the connector's health. LastTransitionTime only changes
+// when the status does, so monitoring can tell how long a condition has been in its state.
+type Condition struct {
+	Type               ConditionType   `json:"type"`
+	Status             ConditionStatus `json:"status"`
+	Reason             string          `json:"reason"`
+	Message            string          `json:"message,omitempty"`
+	LastTransitionTime time.Time       `json:"lastTransitionTime"`
+}
+
+// conditionSet holds the current conditions of the connector
+type conditionSet struct {
+	mu         sync.RWMutex
+	conditions map[ConditionType]*Condition
+}
+
+// newConditionSet creates a set with all conditions in status Unknown
+func newConditionSet() *conditionSet {
+	now := time.Now()
+	set := &conditionSet{conditions: make(map[ConditionType]*Condition)}
+	for _, conditionType := range conditionOrder {
+		set.conditions[conditionType] = &Condition{
+			Type:               conditionType,
+			Status:             ConditionUnknown,
+			Reason:             "Pending",
+			LastTransitionTime: now,
+		}
+	}
+	return set
+}
+
+// set updates a condition, keeping its transition time if the status is unchanged
+func (s *conditionSet) set(conditionType ConditionType, status ConditionStatus, reason, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	condition, ok := s.conditions[conditionType]
+	if !ok {
+		condition = &Condition{Type: conditionType}
+		s.conditions[conditionType] = condition
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = time.Now()
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// get returns a copy of a condition
+func (s *conditionSet) get(conditionType ConditionType) Condition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if condition, ok := s.conditions[conditionType]; ok {
+		return *condition
+	}
+	return Condition{Type: conditionType, Status: ConditionUnknown}
+}
+
+// list returns copies of all conditions in reporting order
+func (s *conditionSet) list() []Condition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conditions := make([]Condition, 0, len(s.conditions))
+	for _, conditionType := range conditionOrder {
+		if condition, ok := s.conditions[conditionType]; ok {
+			conditions = append(conditions, *condition)
+		}
+	}
+	return conditions
+}
+
+// setStream records the state of the Nomad event stream
+func (s *conditionSet) setStream(err error) {
+	if err != nil {
+		s.set(ConditionNomadStreamHealthy, ConditionFalse, "StreamError", err.Error())
+		return
+	}
+	s.set(ConditionNomadStreamHealthy, ConditionTrue, "Connected", "")
+}
+
+// setSync records the outcome of the initial sync
+func (s *conditionSet) setSync(err error) {
+	if err != nil {
+		s.set(ConditionSyncCompleted, ConditionFalse, "SyncFailed", err.Error())
+		return
+	}
+	s.set(ConditionSyncCompleted, ConditionTrue, "InitialSyncSucceeded", "")
+}
+
+// probeHAProxy checks that the Data Plane API answers
+func (s *conditionSet) probeHAProxy(client haproxy.ClientInterface) bool {
+	if _, err := client.GetConfigVersion(); err != nil {
+		s.set(ConditionHAProxyReachable, ConditionFalse, "DataPlaneAPIError", err.Error())
+		return false
+	}
+	s.set(ConditionHAProxyReachable, ConditionTrue, "DataPlaneAPIReachable", "")
+	return true
+}
+
+// probeDrift compares the servers of managed backends with the service instances registered in Nomad
+func (s *conditionSet) probeDrift(client haproxy.ClientInterface, nomadClient nomad.NomadClient, hs *handlerState) {
+	services, err := nomadClient.GetServices()
+	if err != nil {
+		s.set(ConditionDriftDetected, ConditionUnknown, "NomadError", err.Error())
+		return
+	}
+
+	missing, stale, err := countServerDrift(client, hs.buildExpectedServersMap(services))
+	if err != nil {
+		s.set(ConditionDriftDetected, ConditionUnknown, "DataPlaneAPIError", err.Error())
+		return
+	}
+	if missing == 0 && stale == 0 {
+		s.set(ConditionDriftDetected, ConditionFalse, "InSync", "")
+		return
+	}
+	s.set(ConditionDriftDetected, ConditionTrue, "ServersDiffer",
+		fmt.Sprintf("%d servers missing in HAProxy, %d stale servers", missing, stale))
+}
+
+// countServerDrift counts expected servers missing from HAProxy and servers HAProxy has in addition
+func countServerDrift(client haproxy.ClientInterface, expectedServersByBackend map[string]map[string]bool) (missing, stale int, err error) {
+	drift, err := serverDrift(client, expectedServersByBackend)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, backendDrift := range drift {
+		missing += len(backendDrift.Missing)
+		stale += len(backendDrift.Stale)
+	}
+	return missing, stale, nil
+}
+
+// runConditionProbes periodically refreshes the HAProxy and drift conditions and alerts about them.
+// Drift is only meaningful once the initial sync has finished.
+func (c *Connector) runConditionProbes(ctx context.Context) {
+	ticker := time.NewTicker(ConditionProbeIntervalSec * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// The recovery of an open circuit breaker probes the Data Plane API itself
+		if c.breaker.isOpen() {
+			continue
+		}
+		reachable := c.conditions.probeHAProxy(c.haproxyClient)
+		c.notifyHAProxyReachability(reachable)
+		if !reachable {
+			continue
+		}
+		if c.conditions.get(ConditionSyncCompleted).Status != ConditionUnknown {
+			c.conditions.probeDrift(c.haproxyClient, c.nomadClient, c.currentHandlers())
+			c.notifyDrift()
+		}
+	}
+}
+
+// handleConditions serves the connector's conditions on the admin API
+func (c *Connector) handleConditions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"conditions": c.conditions.list()})
+}
+
+// ReadyStatus is the body of the /ready endpoint
+type ReadyStatus struct {
+	Status     string      `json:"status"`         // ready, not_ready or standby
+	Role       string      `json:"role,omitempty"` // leader or standby in HA mode
+	Conditions []Condition `json:"conditions"`     // the readiness conditions that are not True
+}
+
+// handleReady reports ready once the Nomad event stream is connected, the Data Plane API is
+// reachable and the initial sync has completed (the latter is skipped with sync.ready_without_sync).
+// A standby in HA mode doesn't follow Nomad and is ready while it waits.
+func (c *Connector) handleReady(w http.ResponseWriter, _ *http.Request) {
+	c.mu.RLock()
+	leading := c.leading
+	c.mu.RUnlock()
+
+	ready := ReadyStatus{Status: "ready", Conditions: []Condition{}}
+	if c.lock != nil {
+		ready.Role = RoleLeader
+		if !leading {
+			ready.Role = RoleStandby
+			ready.Status = RoleStandby
+			writeJSON(w, ready)
+			return
+		}
+	}
+
+	for _, conditionType := range readinessConditions {
+		if conditionType == ConditionSyncCompleted && c.cfg().Sync.ReadyWithoutSync {
+			continue
+		}
+		if condition := c.conditions.get(conditionType); condition.Status != ConditionTrue {
+			ready.Conditions = append(ready.Conditions, condition)
+		}
+	}
+
+	if len(ready.Conditions) > 0 {
+		ready.Status = "not_ready"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, ready)
+}
@@ -0,0 +1,153 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func TestConditionSetTransitions(t *testing.T) {
+	set := newConditionSet()
+	if condition := set.get(ConditionNomadStreamHealthy); condition.Status != ConditionUnknown {
+		t.Fatalf("Expected Unknown initial status, got %+v", condition)
+	}
+
+	set.setStream(nil)
+	connected := set.get(ConditionNomadStreamHealthy)
+	if connected.Status != ConditionTrue || connected.Reason != "Connected" {
+		t.Fatalf("Expected connected stream, got %+v", connected)
+	}
+
+	// Same status keeps the transition time, a new status moves it
+	time.Sleep(time.Millisecond)
+	set.setStream(nil)
+	if condition := set.get(ConditionNomadStreamHealthy); !condition.LastTransitionTime.Equal(connected.LastTransitionTime) {
+		t.Errorf("Expected unchanged transition time, got %v (was %v)", condition.LastTransitionTime, connected.LastTransitionTime)
+	}
+	set.setStream(errors.New("connection reset"))
+	failed := set.get(ConditionNomadStreamHealthy)
+	if failed.Status != ConditionFalse || failed.Message != "connection reset" || !failed.LastTransitionTime.After(connected.LastTransitionTime) {
+		t.Errorf("Expected failed stream with new transition time, got %+v", failed)
+	}
+}
+
+func TestProbeDrift(t *testing.T) {
+	nomadClient := &fakeNomadClient{services: []*nomad.Service{
+		{ServiceName: "api", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+		{ServiceName: "api", Address: "10.0.0.2", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+	}}
+
+	tests := []struct {
+		name           string
+		servers        []haproxy.Server
+		serversError   error
+		expectedStatus ConditionStatus
+	}{
+		{
+			name: "in sync",
+			servers: []haproxy.Server{
+				{Name: generateServerName("api", "10.0.0.1", 8080)},
+				{Name: generateServerName("api", "10.0.0.2", 8080)},
+			},
+			expectedStatus: ConditionFalse,
+		},
+		{
+			name:           "missing and stale servers",
+			servers:        []haproxy.Server{{Name: generateServerName("api", "10.0.0.1", 8080)}, {Name: "api_old"}},
+			expectedStatus: ConditionTrue,
+		},
+		{name: "api error", serversError: errors.New("timeout"), expectedStatus: ConditionUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := newConditionSet()
+			set.probeDrift(&mockHAProxyClient{getServersServers: tt.servers, getServersError: tt.serversError}, nomadClient, newHandlerState())
+
+			condition := set.get(ConditionDriftDetected)
+			if condition.Status != tt.expectedStatus {
+				t.Errorf("Expected status %s, got %+v", tt.expectedStatus, condition)
+			}
+		})
+	}
+}
+
+func TestHandleHealthReportsConditions(t *testing.T) {
+	c := &Connector{
+		config:          &config.Config{},
+		initialSyncDone: true,
+		conditions:      newConditionSet(),
+	}
+	c.conditions.setSync(nil)
+
+	recorder := httptest.NewRecorder()
+	c.handleHealth(recorder, httptest.NewRequest(http.MethodGet, "/health", http.NoBody))
+
+	var health HealthStatus
+	if err := json.NewDecoder(recorder.Body).Decode(&health); err != nil {
+		t.Fatalf("Failed to decode health: %v", err)
+	}
+	if health.Status != "healthy" || len(health.Conditions) != len(conditionOrder) {
+		t.Fatalf("Expected healthy status with all conditions, got %+v", health)
+	}
+	if sync := health.Conditions[2]; sync.Type != ConditionSyncCompleted || sync.Status != ConditionTrue {
+		t.Errorf("Expected SyncCompleted=True, got %+v", sync)
+	}
+
+	recorder = httptest.NewRecorder()
+	c.handleConditions(recorder, httptest.NewRequest(http.MethodGet, ConditionsAPIPath, http.NoBody))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected conditions API to answer with 200, got %d", recorder.Code)
+	}
+}
+
+func TestHandleReady(t *testing.T) {
+	tests := []struct {
+		name             string
+		streamErr        error
+		syncDone         bool
+		readyWithoutSync bool
+		expectedStatus   int
+		expectedUnmet    int
+	}{
+		{name: "all conditions true", syncDone: true, expectedStatus: http.StatusOK},
+		{name: "stream down", streamErr: errors.New("connection reset"), syncDone: true, expectedStatus: http.StatusServiceUnavailable, expectedUnmet: 1},
+		{name: "sync pending", expectedStatus: http.StatusServiceUnavailable, expectedUnmet: 1},
+		{name: "ready without sync", readyWithoutSync: true, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Connector{
+				config:     &config.Config{Sync: config.SyncConfig{ReadyWithoutSync: tt.readyWithoutSync}},
+				conditions: newConditionSet(),
+			}
+			c.conditions.set(ConditionHAProxyReachable, ConditionTrue, "DataPlaneAPIReachable", "")
+			c.conditions.setStream(tt.streamErr)
+			if tt.syncDone {
+				c.conditions.setSync(nil)
+			}
+
+			recorder := httptest.NewRecorder()
+			c.handleReady(recorder, httptest.NewRequest(http.MethodGet, ReadyPath, http.NoBody))
+			if recorder.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d (%s)", tt.expectedStatus, recorder.Code, recorder.Body.String())
+			}
+
+			var ready ReadyStatus
+			if err := json.NewDecoder(recorder.Body).Decode(&ready); err != nil {
+				t.Fatalf("Failed to decode readiness: %v", err)
+			}
+			if len(ready.Conditions) != tt.expectedUnmet {
+				t.Errorf("Expected %d unmet conditions, got %+v", tt.expectedUnmet, ready.Conditions)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package connector
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,98 +12,496 @@ import (
 	"time"
 
 	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/consul"
+	"github.com/pscheit/haproxy-nomad-connector/internal/dns"
+	"github.com/pscheit/haproxy-nomad-connector/internal/docker"
 	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/leader"
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
 	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+	"github.com/pscheit/haproxy-nomad-connector/internal/notify"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+	"github.com/pscheit/haproxy-nomad-connector/internal/tracing"
 )
 
 // Buffer sizes and timeouts
 const (
-	EventChannelBuffer    = 100
-	HealthCheckTimeoutSec = 10
+	EventChannelBuffer      = 100
+	HealthCheckTimeoutSec   = 10
+	InstanceHealIntervalSec = 30
 )
 
 // Connector manages the integration between Nomad and HAProxy
 type Connector struct {
-	config        *config.Config
+	config        *config.Config // read through cfg(), replaced as a whole on reload
+	configMu      sync.RWMutex
 	nomadClient   nomad.NomadClient
-	haproxyClient *haproxy.Client
+	haproxyClient haproxy.ClientInterface
+	multiClient   *haproxy.MultiClient // set when managing more than one HAProxy instance
+	state         state.Store
+	conditions    *conditionSet
+	history       *eventHistory
+	eventOrder    eventOrderGuard
+	lock          leader.Lock      // set in HA mode; only the lock holder mutates HAProxy
+	notifier      *notify.Notifier // nil without notifications
 	logger        *log.Logger
 
+	// resyncRequests is signaled when the event stream reconnected after a failure and may have missed events
+	resyncRequests chan struct{}
+
+	// healthyEvents receives the registrations held back until their allocation became healthy
+	healthyEvents chan nomad.ServiceEvent
+	healthWaits   healthWaits
+
+	// breaker holds events back while the Data Plane API fails, breakerRecovered is signaled once
+	// it answers again
+	breaker          circuitBreaker
+	breakerRecovered chan struct{}
+
+	// events buffers the streamed events until they are processed
+	events eventQueue
+
+	// staticServices are the services of the config file, updated on reload
+	staticServices *configuredServices
+
 	// Metrics and state
 	mu              sync.RWMutex
 	processedEvents int64
 	errors          int64
 	lastEventTime   time.Time
+	initialSyncDone bool
+	leading         bool
+	complexity      *ConfigComplexity
+	resyncMu        sync.Mutex // held while a resync runs, requested on the admin API or after a stream failure
+	streamDown      bool
+	streamFailures  int64
+	streamResyncs   int64
+	authFailures    int64 // event stream connects rejected because of the Nomad ACL token
+
+	// handlers is the state of the event handlers of the current leadership
+	handlers *handlerState
+
+	// orphanRulesRemoved counts the domain rules removed by the orphan rule cleanup
+	orphanRulesRemoved int64
+
+	// consecutiveFailures and driftProbes count how long a problem lasts before it is alerted
+	consecutiveFailures int
+	driftProbes         int
 }
 
 // New creates a new connector instance
 func New(cfg *config.Config) (*Connector, error) {
-	logger := log.New(log.Writer(), "[connector] ", log.LstdFlags|log.Lshortfile)
+	logger := logging.StdLogger(logging.ModuleConnector)
 
-	// Create HAProxy client
-	haproxyClient := haproxy.NewClient(
-		cfg.HAProxy.Address,
-		cfg.HAProxy.Username,
-		cfg.HAProxy.Password,
-	)
-
-	// Test HAProxy connection
-	info, err := haproxyClient.GetInfo()
+	// Create HAProxy client(s)
+	haproxyClient, multiClient, err := newHAProxyClient(cfg, logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to HAProxy Data Plane API: %w", err)
+		return nil, err
 	}
-	logger.Printf("Connected to HAProxy Data Plane API version %s", info.API.Version)
 
 	// Create Nomad client
-	nomadClient, err := nomad.NewClient(
+	nomadClient, err := nomad.NewClientWithTLS(
 		cfg.Nomad.Address,
 		cfg.Nomad.Token,
 		cfg.Nomad.Region,
-		logger,
+		nomad.APITLSConfig(&cfg.Nomad.TLS),
+		logging.StdLogger(logging.ModuleNomad),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Nomad client: %w", err)
 	}
 
-	return &Connector{
-		config:        cfg,
-		nomadClient:   nomadClient,
-		haproxyClient: haproxyClient,
-		logger:        logger,
-	}, nil
+	// Create state store
+	store, err := state.NewStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create state store: %w", err)
+	}
+
+	// Create leader lock for active/standby pairs
+	var lock leader.Lock
+	if cfg.HA.Enabled {
+		lock, err = leader.NewLock(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create leader lock: %w", err)
+		}
+	}
+
+	// The Data Plane API answered while creating the client
+	conditions := newConditionSet()
+	conditions.set(ConditionHAProxyReachable, ConditionTrue, "DataPlaneAPIReachable", "")
+
+	c := &Connector{
+		config:         cfg,
+		nomadClient:    nomadClient,
+		haproxyClient:  haproxyClient,
+		multiClient:    multiClient,
+		state:          store,
+		conditions:     conditions,
+		history:        newEventHistory(cfg.History.Size),
+		lock:           lock,
+		notifier:       notify.New(&cfg.Notifications),
+		logger:         logger,
+		resyncRequests: make(chan struct{}, 1),
+		healthyEvents:  make(chan nomad.ServiceEvent, EventChannelBuffer),
+
+		breakerRecovered: make(chan struct{}, 1),
+	}
+	nomadClient.SetStreamStatusHandler(c.onStreamStatus)
+	nomadClient.SetStallTimeout(time.Duration(cfg.Nomad.StreamStallTimeoutSec) * time.Second)
+	nomadClient.SetTokenFile(cfg.Nomad.TokenFile)
+	nomadClient.SetWatchNodes(cfg.Nomad.WatchNodes)
+	nomadClient.SetAddressMode(cfg.Nomad.AddressMode)
+
+	// Services registered in Consul are discovered in its catalog instead
+	if cfg.Discovery.Source == "consul" {
+		consulClient := consul.NewClient(cfg.Discovery.ConsulAddress, cfg.Discovery.ConsulToken, cfg.Discovery.ConsulDatacenter,
+			logging.StdLogger(logging.ModuleConsul))
+		consulClient.SetStreamStatusHandler(c.onStreamStatus)
+		c.nomadClient = consulClient
+	}
+
+	// The static services of the config file, further Nomad clusters and the containers of a Docker
+	// or Podman host are discovered alongside
+	c.staticServices = newConfiguredServices(cfg.StaticServices)
+	sources := &discoverySources{NomadClient: c.nomadClient, extra: []nomad.NomadClient{c.staticServices}}
+	for i := range cfg.Nomad.Clusters {
+		cluster, err := newNomadCluster(cfg, &cfg.Nomad.Clusters[i])
+		if err != nil {
+			return nil, err
+		}
+		sources.extra = append(sources.extra, cluster)
+	}
+	if cfg.Docker.Enabled {
+		dockerClient, err := docker.NewClient(cfg.Docker.Host, cfg.Docker.HostAddress, logging.StdLogger(logging.ModuleDocker))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Docker client: %w", err)
+		}
+		sources.extra = append(sources.extra, dockerClient)
+	}
+	if len(cfg.ManagedServices.Allow) > 0 || len(cfg.ManagedServices.Deny) > 0 {
+		logger.Printf("Managing only services allowed by %v and not denied by %v (managed_services)",
+			cfg.ManagedServices.Allow, cfg.ManagedServices.Deny)
+		sources.scope = &cfg.ManagedServices
+	}
+	c.nomadClient = sources
+	return c, nil
 }
 
-// Start begins the connector's main processing loop
+// newHAProxyClient connects to all configured Data Plane API endpoints. With more than one
+// endpoint the returned client fans changes out according to the configured apply policy.
+func newHAProxyClient(cfg *config.Config, logger *log.Logger) (haproxy.ClientInterface, *haproxy.MultiClient, error) {
+	tlsConfig, err := haproxyTLSConfig(&cfg.HAProxy.TLS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	instanceConfigs := cfg.HAProxy.InstanceConfigs()
+	instances := make([]haproxy.Instance, 0, len(instanceConfigs))
+	unreachable := make(map[string]error)
+	for _, instanceCfg := range instanceConfigs {
+		clientOptions := haproxyClientOptions(&cfg.HAProxy.Client)
+		clientOptions.TLSConfig = tlsConfig
+		clientOptions.RuntimeSocket = instanceCfg.RuntimeSocket
+		clientOptions.RuntimeMode = cfg.HAProxy.Runtime.Mode
+		clientOptions.RuntimeTimeout = time.Duration(cfg.HAProxy.Runtime.TimeoutSec) * time.Second
+		clientOptions.ReadUsername, clientOptions.ReadPassword = instanceCfg.ReadUsername, instanceCfg.ReadPassword
+		client := haproxy.NewClientWithOptions(instanceCfg.Address, instanceCfg.Username, instanceCfg.Password, clientOptions)
+		instances = append(instances, haproxy.Instance{Name: instanceCfg.Name, Client: client})
+
+		// Test HAProxy connection
+		info, err := client.GetInfo()
+		if err != nil {
+			err = fmt.Errorf("failed to connect to HAProxy Data Plane API %s: %w", instanceCfg.Name, err)
+			if len(instanceConfigs) == 1 {
+				return nil, nil, err
+			}
+			// One node being down must not stop the others from being managed
+			logger.Printf("Warning: %v", err)
+			unreachable[instanceCfg.Name] = err
+			continue
+		}
+		logger.Printf("Connected to HAProxy Data Plane API %s version %s", instanceCfg.Name, info.API.Version)
+	}
+
+	if len(instances) == 1 {
+		return instances[0].Client, nil, nil
+	}
+	if len(unreachable) == len(instances) {
+		return nil, nil, fmt.Errorf("none of the %d HAProxy Data Plane APIs is reachable", len(instances))
+	}
+
+	multiClient, err := haproxy.NewMultiClient(instances, haproxy.ApplyPolicy(cfg.HAProxy.ApplyPolicy))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create multi-instance HAProxy client: %w", err)
+	}
+	// Unreachable instances are resynced by the healing loop once they are back
+	for name, err := range unreachable {
+		multiClient.MarkInconsistent(name, err)
+	}
+	logger.Printf("Managing %d HAProxy instances with apply policy %s", len(instances), cfg.HAProxy.ApplyPolicy)
+
+	return multiClient, multiClient, nil
+}
+
+// haproxyClientOptions converts the configured HTTP client tuning into Data Plane API client options
+func haproxyClientOptions(cfg *config.HAProxyClientConfig) haproxy.ClientOptions {
+	return haproxy.ClientOptions{
+		Timeout:           time.Duration(cfg.TimeoutSec) * time.Second,
+		CommitTimeout:     time.Duration(cfg.CommitTimeoutSec) * time.Second,
+		DisableKeepAlives: !cfg.KeepAlive,
+		IdleConnTimeout:   time.Duration(cfg.IdleConnTimeoutSec) * time.Second,
+		MaxIdleConns:      cfg.MaxIdleConns,
+		RetryAttempts:     cfg.RetryAttempts,
+		MaxRetryAfter:     time.Duration(cfg.MaxRetryAfterSec) * time.Second,
+		RetryBackoff:      time.Duration(cfg.RetryBackoffMs) * time.Millisecond,
+		MaxRetryBackoff:   time.Duration(cfg.MaxRetryBackoffMs) * time.Millisecond,
+	}
+}
+
+// haproxyTLSConfig loads the CA bundle and client certificate of the Data Plane API connections,
+// nil when none are configured
+func haproxyTLSConfig(cfg *config.TLSConfig) (*tls.Config, error) {
+	if *cfg == (config.TLSConfig{}) {
+		return nil, nil
+	}
+	tlsConfig, err := haproxy.NewTLSConfig(cfg.CAFile, cfg.CertFile, cfg.KeyFile, cfg.ServerName, cfg.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("invalid haproxy.tls configuration: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+// Start begins the connector's main processing loop. In HA mode the connector waits as standby
+// until it holds the leader lock and stops mutating HAProxy as soon as it loses the lock.
 func (c *Connector) Start(ctx context.Context) error {
 	c.logger.Println("Starting haproxy-nomad-connector")
 
+	// Start health check server; it reports not ready until the initial sync has finished
+	go c.startHealthServer(ctx)
+
+	// Pick up rotated Vault-sourced credentials
+	go c.runCredentialRefresh(ctx)
+	go c.runTokenFileRefresh(ctx)
+
+	if c.lock == nil {
+		return c.lead(ctx, ctx.Done())
+	}
+
+	c.logger.Printf("HA mode enabled, waiting for leadership (%s backend)", c.cfg().HA.Backend)
+	leader.Run(ctx, c.lock, c.logger, func(leaderCtx context.Context) {
+		c.setLeading(true)
+		defer c.setLeading(false)
+		if err := c.lead(leaderCtx, ctx.Done()); err != nil {
+			c.logger.Printf("Warning: Leader loop failed: %v", err)
+		}
+	})
+	return nil
+}
+
+// setLeading records whether this instance currently holds the leader lock. A new leader
+// has to run the initial sync again before it reports healthy.
+func (c *Connector) setLeading(leading bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leading = leading
+	c.initialSyncDone = false
+	c.streamDown = false
+}
+
+// lead syncs all services and then processes Nomad events until ctx is canceled, either because the
+// leadership was lost or on shutdown, when shutdown is closed as well
+func (c *Connector) lead(ctx context.Context, shutdown <-chan struct{}) error {
+	// Events held back by a previous leadership are covered by the initial sync
+	c.breaker.reset()
+	select {
+	case <-c.breakerRecovered:
+	default:
+	}
+
+	// Transactions left open by a previous run count against the Data Plane API's transaction limit
+	if deleted, err := c.haproxyClient.DeleteStaleTransactions(); err != nil {
+		c.logger.Printf("Warning: Failed to delete stale transactions: %v", err)
+	} else if deleted > 0 {
+		c.logger.Printf("Deleted %d stale HAProxy transactions", deleted)
+	}
+
+	// Nothing the handlers tracked during a previous leadership is carried over, the event handlers
+	// of this one find their state in ctx
+	hs := c.startHandlers()
+	ctx = withHandlerState(ctx, hs)
+	hs.holdBack = func(event *nomad.ServiceEvent) bool { return c.deferUntilHealthy(ctx, event) }
+
+	// Routing is static, only backends and servers are managed
+	if hs.rulesUnmanaged {
+		c.logger.Println("Frontend rule management disabled, domain rules are left unchanged")
+	}
+
+	// Create the configured frontends a fresh HAProxy lacks, rules can't be published without them
+	if err := ensureBootstrapFrontends(c.haproxyClient, &c.cfg().HAProxy, c.logger); err != nil {
+		c.logger.Printf("Warning: Failed to bootstrap frontends: %v", err)
+	}
+
+	// Create dedicated frontends for domain groups
+	if err := ensureDomainGroupFrontends(c.haproxyClient, c.cfg().HAProxy.DomainGroups, c.logger); err != nil {
+		c.logger.Printf("Warning: Failed to create domain group frontends: %v", err)
+	}
+
+	// Bootstrap the default backends of frontends, including status backends such as a 404
+	if err := ensureDefaultBackends(c.haproxyClient, c.cfg().HAProxy.DefaultBackends, c.logger); err != nil {
+		c.logger.Printf("Warning: Failed to set up default backends: %v", err)
+	}
+
+	// Obtain certificates for service domains via ACME
+	if c.cfg().ACME.Enabled {
+		manager, err := newCertificateManager(ctx, c.haproxyClient, c.state, &c.cfg().ACME, c.cfg().HAProxy.HTTPFrontend, c.logger)
+		if err != nil {
+			c.logger.Printf("Warning: ACME disabled, failed to set up account: %v", err)
+		} else {
+			hs.certificates = manager
+			go manager.run(ctx)
+		}
+	}
+
+	// Point the DNS records of service domains at the load balancer
+	if c.cfg().DNS.Enabled {
+		provider, err := dns.NewProvider(&c.cfg().DNS)
+		if err != nil {
+			c.logger.Printf("Warning: DNS records disabled: %v", err)
+		} else {
+			hs.dnsRecords = &dnsManager{provider: provider, recordType: c.cfg().DNS.RecordType, target: c.cfg().DNS.Target}
+		}
+	}
+
+	// Complete the removals the previous run (or leader) left pending; the sync cancels those of
+	// servers that registered again
+	c.restorePendingRemovals(ctx)
+
+	// Continue the event history of the previous run (or leader)
+	c.restoreHistory(ctx)
+
+	// Tell the rules this connector created apart from those of others writing to the same frontends
+	c.restoreOwnedRules(ctx)
+
+	// Keep the services paused and the backends put into maintenance by the previous run (or leader)
+	c.restorePausedServices(ctx)
+	c.restoreMaintenanceBackends(ctx)
+
+	// Apply the events the previous run (or leader) didn't get to, once the state they are handled
+	// with is restored. The sync that follows corrects what changed since.
+	c.replayEventQueue(ctx)
+
 	// Perform initial sync of existing services
-	if err := c.syncExistingServices(ctx); err != nil {
-		c.logger.Printf("Warning: Initial sync failed: %v", err)
+	syncErr := c.syncExistingServices(ctx)
+	if syncErr != nil {
+		c.logger.Printf("Warning: Initial sync failed: %v", syncErr)
 	}
+	c.conditions.setSync(syncErr)
+	hs.ownedRules.settle()
+	c.persistOwnedRules()
+	c.persistMaintenanceBackends()
+	c.mu.Lock()
+	c.initialSyncDone = true
+	c.mu.Unlock()
 
-	// Start health check server
-	go c.startHealthServer(ctx)
+	// Keep the HAProxy reachability and drift conditions up to date
+	go c.runConditionProbes(ctx)
+
+	// Track the growth of the HAProxy configuration
+	go c.runComplexityProbe(ctx)
+
+	// Keep per-request logging enabled on the managed frontends
+	go c.runLoggingEnforcement(ctx)
+
+	// Remove domain rules whose backend or service is gone
+	go c.runOrphanRuleCleanup(ctx)
+
+	// Resync HAProxy instances that missed changes
+	if c.multiClient != nil {
+		go c.healInconsistentInstances(ctx)
+	}
 
 	// Start event processing
-	eventChan := make(chan nomad.ServiceEvent, EventChannelBuffer)
+	streamed := make(chan nomad.ServiceEvent, EventChannelBuffer)
+	eventChan := make(chan nomad.ServiceEvent)
+
+	// Start event stream in background, the initial sync covers everything before. Streamed events
+	// are queued instead of blocking the stream while the processing is busy.
+	select {
+	case <-c.resyncRequests:
+	default:
+	}
+	go c.events.run(ctx, streamed, eventChan, c.cfg().Sync.QueueSize, c.onEventQueueOverflow)
+	go c.runEventStream(ctx, streamed)
+	if c.cfg().Sync.PersistQueue {
+		go c.runEventQueuePersistence(ctx)
+	}
 
-	// Start event stream in background
-	go func() {
-		if err := c.nomadClient.StreamServiceEvents(ctx, eventChan); err != nil && ctx.Err() == nil {
-			c.logger.Printf("Event stream ended: %v", err)
+	// Process events, coalescing those arriving within the batch window (e.g. during a deployment).
+	// Without batching, events of different backends and frontends can be processed concurrently.
+	batchWindow := time.Duration(c.cfg().Sync.BatchWindowMs) * time.Millisecond
+	var workers *eventPool
+	if c.cfg().Sync.EventWorkers > 1 {
+		if batchWindow > 0 {
+			c.logger.Println("Warning: sync.event_workers is ignored with sync.batch_window_ms, batches are processed in order")
+		} else {
+			workers = newEventPool(c.cfg().Sync.EventWorkers, EventChannelBuffer, func(event nomad.ServiceEvent) {
+				c.processEvent(ctx, event)
+			})
 		}
-	}()
-
-	// Process events
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			c.logger.Println("Connector stopping...")
+			if workers != nil {
+				workers.wait()
+			}
+			select {
+			case <-shutdown:
+				c.finishPendingRemovals()
+			default:
+				// The new leader completes them
+				c.handOverPendingRemovals()
+			}
+			if canceled := hs.emptyBackends.stop(); canceled > 0 {
+				c.logger.Printf("Canceled %d pending deletions of empty backends", canceled)
+			}
+			c.persistHistory()
+			c.persistOwnedRules()
+			c.persistMaintenanceBackends()
+			c.persistEventQueue(true)
 			return nil
 
+		case <-c.resyncRequests:
+			if workers != nil {
+				workers.wait()
+			}
+			c.resyncAfterStreamFailure(ctx)
+
+		case <-c.breakerRecovered:
+			if workers != nil {
+				workers.wait()
+			}
+			c.recoverFromOpenBreaker(ctx)
+
 		case event := <-eventChan:
-			c.processEvent(ctx, event)
+			switch {
+			case batchWindow > 0:
+				c.processEventBatch(ctx, c.acceptedEvents(collectEventBatch(ctx, eventChan, event, batchWindow)))
+			case !c.acceptEvent(&event):
+			case workers != nil:
+				workers.submit(event, hs.eventKeys(&event, &c.cfg().HAProxy))
+			default:
+				c.processEvent(ctx, event)
+			}
+
+		case event := <-c.healthyEvents:
+			// Already accepted when it arrived, it is processed like a new event
+			if workers != nil {
+				workers.submit(event, hs.eventKeys(&event, &c.cfg().HAProxy))
+			} else {
+				c.processEvent(ctx, event)
+			}
 		}
 	}
 }
@@ -114,25 +514,13 @@ func (c *Connector) processNomadServiceEventWithConfig(ctx context.Context, even
 
 	svc := event.Payload.Service
 
-	// Convert to internal event structure
-	serviceEvent := ServiceEvent{
-		Type: event.Type,
-		Service: Service{
-			ServiceName: svc.ServiceName,
-			Address:     svc.Address,
-			Port:        svc.Port,
-			Tags:        svc.Tags,
-			JobID:       svc.JobID,
-		},
-	}
-
 	result, err := ProcessServiceEventWithHealthCheckAndConfig(
-		ctx,
+		c.handlerContext(ctx),
 		c.haproxyClient,
 		c.nomadClient,
-		&serviceEvent,
+		toServiceEvent(&event),
 		c.logger,
-		c.config,
+		c.cfg(),
 	)
 
 	// Enhanced logging with frontend rule status
@@ -143,16 +531,19 @@ func (c *Connector) processNomadServiceEventWithConfig(ctx context.Context, even
 		}
 	}
 
-	c.logger.Printf("Successfully processed %s for service %s at %s:%d%s",
-		event.Type, svc.ServiceName, svc.Address, svc.Port, frontendInfo)
+	c.logger.Printf("Successfully processed %s for service %s at %s%s",
+		event.Type, svc.ServiceName, hostPort(svc.Address, svc.Port), frontendInfo)
 
 	return result, err
 }
 
 // syncExistingServices performs initial sync of all registered Nomad services
-// and cleans up stale servers that no longer exist in Nomad
+// and cleans up stale servers that no longer exist in Nomad.
+// The sync is bounded by sync.timeout_sec; a timed out sync reports how far it got.
 func (c *Connector) syncExistingServices(ctx context.Context) error {
 	c.logger.Println("Performing initial sync of existing services...")
+	hs := c.currentHandlers()
+	ctx = withHandlerState(ctx, hs)
 
 	services, err := c.nomadClient.GetServices()
 	if err != nil {
@@ -161,51 +552,60 @@ func (c *Connector) syncExistingServices(ctx context.Context) error {
 
 	// Build a map of backend -> expected server names from Nomad
 	// This allows us to identify stale servers after syncing
-	expectedServersByBackend := buildExpectedServersMap(services)
+	expectedServersByBackend := hs.buildExpectedServersMap(services)
 
-	synced := 0
-	for _, svc := range services {
-		// Create fake registration event for existing services
-		event := nomad.ServiceEvent{
-			Type:  "ServiceRegistration",
-			Topic: "Service",
-			Payload: nomad.Payload{
-				Service: svc,
-			},
-		}
+	syncCtx := ctx
+	if c.cfg().Sync.TimeoutSec > 0 {
+		var cancel context.CancelFunc
+		syncCtx, cancel = context.WithTimeout(ctx, time.Duration(c.cfg().Sync.TimeoutSec)*time.Second)
+		defer cancel()
+	}
 
-		if result, err := ProcessNomadServiceEvent(ctx, c.haproxyClient, c.nomadClient, event, c.logger, c.config); err != nil {
-			c.logger.Printf("Failed to sync service %s: %v", svc.ServiceName, err)
-		} else {
-			if resultMap, ok := result.(map[string]string); ok && resultMap["status"] == StatusCreated {
-				synced++
-			}
+	services = orderServicesByDependencies(services, c.cfg().Sync.Dependencies, c.logger)
+	report := syncServices(syncCtx, services, c.cfg().Sync.ProgressInterval, c.logger, func(svc *nomad.Service) (interface{}, error) {
+		event := registrationEvent(svc)
+		if hs.heldBackUntilHealthy(&event) {
+			return map[string]string{"status": StatusHeldBack}, nil
 		}
+		return ProcessNomadServiceEvent(syncCtx, c.haproxyClient, c.nomadClient, event, c.logger, c.cfg())
+	})
+
+	if report.TimedOut {
+		return fmt.Errorf("initial sync timed out after %s: %d/%d services processed (%d synced, %d failed)",
+			report.Duration.Round(time.Millisecond), report.Processed, report.Total, report.Synced, report.Failed)
 	}
 
 	// Clean up stale servers from HAProxy that no longer exist in Nomad
-	removed, cleanupErr := c.cleanupStaleServers(expectedServersByBackend)
+	removed, cleanupErr := hs.cleanupStaleServersFromBackends(c.haproxyClient, expectedServersByBackend, c.logger)
 	if cleanupErr != nil {
 		c.logger.Printf("Warning: Error during stale server cleanup: %v", cleanupErr)
 	}
 
-	c.logger.Printf("Initial sync complete: %d services synced, %d stale servers removed", synced, removed)
+	c.logger.Printf("Initial sync complete in %s: %d services synced, %d failed, %d stale servers removed",
+		report.Duration.Round(time.Millisecond), report.Synced, report.Failed, removed)
 	return nil
 }
 
 // buildExpectedServersMap creates a map of backend name -> set of expected server names
 // based on current Nomad service instances
-func buildExpectedServersMap(services []*nomad.Service) map[string]map[string]bool {
+func (hs *handlerState) buildExpectedServersMap(services []*nomad.Service) map[string]map[string]bool {
 	result := make(map[string]map[string]bool)
+	paused := make(map[string]bool)
 
 	for _, svc := range services {
 		// Only process services that are managed by the connector
-		if !hasTag(svc.Tags, "haproxy.enable=true") {
+		tags := serviceTags(svc.Tags, svc.Meta)
+		if !hasTag(tags, "haproxy.enable=true") {
 			continue
 		}
 
-		backendName := sanitizeServiceName(svc.ServiceName)
-		serverName := generateServerName(svc.ServiceName, svc.Address, svc.Port)
+		backendName := serviceBackendName(svc.ServiceName, tags)
+		if hs.isPaused(svc.ServiceName, tags) {
+			// Left as it is until the service is resumed
+			paused[backendName] = true
+			continue
+		}
+		serverName := serviceServerName(&Service{ServiceName: svc.ServiceName, Address: svc.Address, Port: svc.Port, Tags: tags, AllocID: svc.AllocID})
 
 		if result[backendName] == nil {
 			result[backendName] = make(map[string]bool)
@@ -213,15 +613,12 @@ func buildExpectedServersMap(services []*nomad.Service) map[string]map[string]bo
 		result[backendName][serverName] = true
 	}
 
+	for backendName := range paused {
+		delete(result, backendName)
+	}
 	return result
 }
 
-// cleanupStaleServers removes servers from HAProxy backends that are not in the expected set
-// Returns the number of servers removed and any error encountered
-func (c *Connector) cleanupStaleServers(expectedServersByBackend map[string]map[string]bool) (int, error) {
-	return cleanupStaleServersFromBackends(c.haproxyClient, expectedServersByBackend, c.logger)
-}
-
 // SyncAndCleanupStaleServers performs a full sync cycle: registers current Nomad services
 // and removes stale servers from HAProxy that no longer exist in Nomad.
 // This is exported for testing purposes.
@@ -233,6 +630,8 @@ func SyncAndCleanupStaleServers(
 	cfg *config.Config,
 ) (synced, removed int, err error) {
 	logger.Println("Performing sync and cleanup of services...")
+	hs := handlerStateFrom(ctx)
+	ctx = withHandlerState(ctx, hs)
 
 	services, err := nomadClient.GetServices()
 	if err != nil {
@@ -240,29 +639,21 @@ func SyncAndCleanupStaleServers(
 	}
 
 	// Build a map of backend -> expected server names from Nomad
-	expectedServersByBackend := buildExpectedServersMap(services)
-
-	// Sync all services from Nomad
-	for _, svc := range services {
-		event := nomad.ServiceEvent{
-			Type:  "ServiceRegistration",
-			Topic: "Service",
-			Payload: nomad.Payload{
-				Service: svc,
-			},
+	expectedServersByBackend := hs.buildExpectedServersMap(services)
+
+	// Sync all services from Nomad, dependencies first
+	services = orderServicesByDependencies(services, cfg.Sync.Dependencies, logger)
+	report := syncServices(ctx, services, cfg.Sync.ProgressInterval, logger, func(svc *nomad.Service) (interface{}, error) {
+		event := registrationEvent(svc)
+		if hs.heldBackUntilHealthy(&event) {
+			return map[string]string{"status": StatusHeldBack}, nil
 		}
-
-		if result, procErr := ProcessNomadServiceEvent(ctx, haproxyClient, nomadClient, event, logger, cfg); procErr != nil {
-			logger.Printf("Failed to sync service %s: %v", svc.ServiceName, procErr)
-		} else {
-			if resultMap, ok := result.(map[string]string); ok && resultMap["status"] == StatusCreated {
-				synced++
-			}
-		}
-	}
+		return ProcessNomadServiceEvent(ctx, haproxyClient, nomadClient, event, logger, cfg)
+	})
+	synced = report.Synced
 
 	// Clean up stale servers
-	removed, cleanupErr := cleanupStaleServersFromBackends(haproxyClient, expectedServersByBackend, logger)
+	removed, cleanupErr := hs.cleanupStaleServersFromBackends(haproxyClient, expectedServersByBackend, logger)
 	if cleanupErr != nil {
 		logger.Printf("Warning: Error during stale server cleanup: %v", cleanupErr)
 	}
@@ -273,7 +664,7 @@ func SyncAndCleanupStaleServers(
 
 // cleanupStaleServersFromBackends removes servers from HAProxy backends that are not in the expected set
 // This is a standalone function that can be used by both the Connector method and the exported function
-func cleanupStaleServersFromBackends(
+func (hs *handlerState) cleanupStaleServersFromBackends(
 	haproxyClient haproxy.ClientInterface,
 	expectedServersByBackend map[string]map[string]bool,
 	logger *log.Logger,
@@ -282,52 +673,159 @@ func cleanupStaleServersFromBackends(
 	var lastErr error
 
 	for backendName, expectedServers := range expectedServersByBackend {
-		// Get current servers in HAProxy for this backend
-		haproxyServers, err := haproxyClient.GetServers(backendName)
+		count, err := hs.cleanupStaleServersFromBackend(haproxyClient, backendName, expectedServers, logger)
+		removed += count
 		if err != nil {
-			// Backend might not exist yet, skip
-			logger.Printf("Could not get servers for backend %s: %v", backendName, err)
+			lastErr = err
+		}
+	}
+
+	return removed, lastErr
+}
+
+// cleanupStaleServersFromBackend removes the servers of a backend that are not in the expected set.
+// Holds the backend lock so a registration can't add a server between listing and removal.
+func (hs *handlerState) cleanupStaleServersFromBackend(
+	haproxyClient haproxy.ClientInterface,
+	backendName string,
+	expectedServers map[string]bool,
+	logger *log.Logger,
+) (int, error) {
+	defer hs.locks.lock(backendName)()
+
+	// Get current servers in HAProxy for this backend
+	haproxyServers, err := haproxyClient.GetServers(backendName)
+	if err != nil {
+		// Backend might not exist yet, skip
+		logger.Printf("Could not get servers for backend %s: %v", backendName, err)
+		return 0, nil
+	}
+
+	removed := 0
+	var lastErr error
+
+	// Find and remove stale servers
+	for _, server := range haproxyServers {
+		if expectedServers[server.Name] {
+			// Server exists in Nomad, keep it
+			continue
+		}
+		if isSlotServer(server.Name) && (isFreeSlot(&server) || slotExpected(&server, expectedServers)) {
 			continue
 		}
 
-		// Find and remove stale servers
-		for _, server := range haproxyServers {
-			if expectedServers[server.Name] {
-				// Server exists in Nomad, keep it
-				continue
-			}
+		// This server is in HAProxy but not in Nomad - it's stale
+		logger.Printf("Removing stale server %s from backend %s", server.Name, backendName)
 
-			// This server is in HAProxy but not in Nomad - it's stale
-			logger.Printf("Removing stale server %s from backend %s", server.Name, backendName)
+		version, err := haproxyClient.GetConfigVersion()
+		if err != nil {
+			logger.Printf("Failed to get config version for stale server removal: %v", err)
+			lastErr = err
+			continue
+		}
 
-			version, err := haproxyClient.GetConfigVersion()
-			if err != nil {
-				logger.Printf("Failed to get config version for stale server removal: %v", err)
-				lastErr = err
+		if err := removeServer(haproxyClient, backendName, server.Name, version); err != nil {
+			logger.Printf("Failed to remove stale server %s: %v", server.Name, err)
+			lastErr = err
+			continue
+		}
+
+		removed++
+	}
+
+	return removed, lastErr
+}
+
+// healInconsistentInstances periodically resyncs HAProxy instances that failed to apply a change
+func (c *Connector) healInconsistentInstances(ctx context.Context) {
+	ticker := time.NewTicker(InstanceHealIntervalSec * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		inconsistent := c.multiClient.Inconsistent()
+		for _, instance := range c.multiClient.Instances() {
+			if !containsString(inconsistent, instance.Name) {
 				continue
 			}
 
-			if err := haproxyClient.DeleteServer(backendName, server.Name, version); err != nil {
-				logger.Printf("Failed to remove stale server %s: %v", server.Name, err)
-				lastErr = err
+			c.logger.Printf("HAProxy instance %s is inconsistent, resyncing", instance.Name)
+			if _, _, err := SyncAndCleanupStaleServers(c.handlerContext(ctx), instance.Client, c.nomadClient, c.logger, c.cfg()); err != nil {
+				c.logger.Printf("Warning: Failed to heal HAProxy instance %s: %v", instance.Name, err)
 				continue
 			}
-
-			removed++
+			c.multiClient.MarkHealed(instance.Name)
 		}
 	}
+}
 
-	return removed, lastErr
+// containsString checks if a string slice contains a specific value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
-// processEvent handles individual Nomad service events
+// processEvent handles individual Nomad service events, registrations waiting for a healthy
+// allocation are held back
 func (c *Connector) processEvent(ctx context.Context, event nomad.ServiceEvent) {
+	if c.deferUntilHealthy(ctx, &event) {
+		return
+	}
+	c.applyEvent(ctx, event)
+}
+
+// applyEvent applies a Nomad service event to HAProxy and records the outcome. While the circuit
+// breaker is open the event is held back instead.
+func (c *Connector) applyEvent(ctx context.Context, event nomad.ServiceEvent) {
+	if c.holdEvent(&event) {
+		return
+	}
+
 	c.mu.Lock()
 	c.processedEvents++
 	c.lastEventTime = time.Now()
 	c.mu.Unlock()
 
+	if event.Payload.Node != nil {
+		err := c.applyNodeEvent(&event)
+		if err != nil {
+			c.mu.Lock()
+			c.errors++
+			c.mu.Unlock()
+			c.logger.Printf("Error processing %s for node %s: %v", event.Type, event.Payload.Node.ID, err)
+		}
+		c.recordEventOutcome("node "+event.Payload.Node.ID, err)
+		c.recordBreakerOutcome(ctx, err)
+		return
+	}
+
+	ctx, span := tracing.Start(ctx, "process event",
+		tracing.String("event.type", event.Type),
+		tracing.String("service.name", event.Payload.Service.ServiceName),
+		tracing.String("alloc.id", event.Payload.Service.AllocID))
+	defer span.End()
+
 	result, err := c.processNomadServiceEventWithConfig(ctx, event)
+	if haproxy.IsVersionConflict(err) {
+		// Another writer changed the configuration meanwhile, the event is applied again to what
+		// HAProxy looks like now
+		c.logger.Printf("Configuration changed while processing event for service %s, processing it again",
+			event.Payload.Service.ServiceName)
+		result, err = c.processNomadServiceEventWithConfig(ctx, event)
+	}
+	c.history.recordEvent(&event, result, err)
+	span.RecordError(err)
+	c.recordEventOutcome("service "+event.Payload.Service.ServiceName, err)
+	c.recordBreakerOutcome(ctx, err)
 	if err != nil {
 		c.mu.Lock()
 		c.errors++
@@ -354,6 +852,9 @@ func (c *Connector) processEvent(ctx context.Context, event nomad.ServiceEvent)
 		if frontendRuleRemoved := resultMap["frontend_rule_removed"]; frontendRuleRemoved != "" {
 			logDetails = append(logDetails, "frontend_rule_removed="+frontendRuleRemoved)
 		}
+		if frontendRuleSkipped := resultMap["frontend_rule_skipped"]; frontendRuleSkipped != "" {
+			logDetails = append(logDetails, "frontend_rule_skipped="+frontendRuleSkipped)
+		}
 
 		// Add backend info if present
 		if backend := resultMap["backend"]; backend != "" {
@@ -383,12 +884,11 @@ func (c *Connector) processEvent(ctx context.Context, event nomad.ServiceEvent)
 func (c *Connector) startHealthServer(ctx context.Context) {
 	mux := http.NewServeMux()
 
-	// Health check endpoint
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"healthy","service":"haproxy-nomad-connector"}`)
-	})
+	// Liveness endpoint
+	mux.HandleFunc("/health", c.handleHealth)
+
+	// Readiness endpoint, failing while the event stream, HAProxy or the initial sync is not ok
+	mux.HandleFunc(ReadyPath, c.handleReady)
 
 	// Metrics endpoint
 	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
@@ -396,16 +896,142 @@ func (c *Connector) startHealthServer(ctx context.Context) {
 		processed := c.processedEvents
 		errors := c.errors
 		lastEvent := c.lastEventTime
+		streamFailures := c.streamFailures
+		streamResyncs := c.streamResyncs
+		authFailures := c.authFailures
+		orphanRulesRemoved := c.orphanRulesRemoved
 		c.mu.RUnlock()
 
+		queue := c.events.stats()
+		handlers := c.currentHandlers()
+		pausedCount := handlers.paused.len()
+		breaker := c.breaker.stats()
+		breakerOpen := 0
+		if breaker.open {
+			breakerOpen = 1
+		}
+
+		removals := handlers.removals.stats()
+
+		inconsistentInstances := 0
+		if c.multiClient != nil {
+			inconsistentInstances = len(c.multiClient.Inconsistent())
+		}
+
+		complexity := c.configComplexity()
+		if complexity == nil {
+			complexity = &ConfigComplexity{}
+		}
+
+		domainRequests := []byte("[]")
+		if c.cfg().HAProxy.DomainMetrics {
+			if hits, err := collectDomainHits(c.haproxyClient, managedFrontends(&c.cfg().HAProxy)); err != nil {
+				c.logger.Printf("Warning: Failed to collect domain metrics: %v", err)
+			} else if data, err := json.Marshal(hits); err == nil {
+				domainRequests = data
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, `{
 			"processed_events": %d,
 			"errors": %d,
 			"last_event_time": "%s",
-			"uptime_seconds": %.0f
-		}`, processed, errors, lastEvent.Format(time.RFC3339), time.Since(lastEvent).Seconds())
+			"uptime_seconds": %.0f,
+			"stream_last_activity_seconds": %.0f,
+			"stream_failures": %d,
+			"stream_resyncs": %d,
+			"stale_events_skipped_total": %d,
+			"nomad_auth_failures": %d,
+			"orphan_rules_removed_total": %d,
+			"event_queue_length": %d,
+			"event_queue_max_length": %d,
+			"event_queue_dropped_total": %d,
+			"paused_services": %d,
+			"circuit_breaker_open": %d,
+			"circuit_breaker_trips_total": %d,
+			"circuit_breaker_queued_events": %d,
+			"circuit_breaker_dropped_events_total": %d,
+			"pending_removals": %d,
+			"pending_removals_max_age_seconds": %.0f,
+			"removals_canceled_total": %d,
+			"inconsistent_instances": %d,
+			"config_lines": %d,
+			"config_backends": %d,
+			"config_servers": %d,
+			"config_max_frontend_rules": %d,
+			"config_complexity_warnings": %d,
+			"regex_domains_quarantined_total": %d,
+			"domain_requests": %s
+		}`, processed, errors, lastEvent.Format(time.RFC3339), time.Since(lastEvent).Seconds(),
+			c.streamActivityAge().Seconds(), streamFailures, streamResyncs, c.eventOrder.skippedEvents(), authFailures, orphanRulesRemoved,
+			queue.length, queue.highWatermark, queue.dropped, pausedCount,
+			breakerOpen, breaker.trips, breaker.queued, breaker.droppedEvents,
+			removals.Pending, removals.MaxAge.Seconds(), removals.Canceled, inconsistentInstances,
+			complexity.Lines, complexity.Backends, complexity.Servers, complexity.maxFrontendRules(), len(complexity.Warnings),
+			quarantinedDomains.Load(), domainRequests)
+	})
+
+	// Managed routing table endpoint (?format=json|csv|table, optional ?frontend=name)
+	mux.HandleFunc("/routes", func(w http.ResponseWriter, r *http.Request) {
+		frontends := managedFrontends(&c.cfg().HAProxy)
+		if requested := r.URL.Query()["frontend"]; len(requested) > 0 {
+			frontends = requested
+		}
+
+		routes, err := c.currentHandlers().buildRoutingTable(c.haproxyClient, frontends)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		switch format {
+		case RouteFormatCSV:
+			w.Header().Set("Content-Type", "text/csv")
+		case RouteFormatTable:
+			w.Header().Set("Content-Type", "text/plain")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+		}
+
+		if err := WriteRoutes(w, routes, format); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	})
+
+	// Read-only view of the HAProxy objects managed by the connector
+	mux.Handle(StateAPIPrefix, &stateAPI{client: c.haproxyClient, nomadClient: c.nomadClient, cfg: c.cfg, handlers: c.currentHandlers})
+
+	// Typed health conditions for monitoring
+	mux.HandleFunc(ConditionsAPIPath, c.handleConditions)
+
+	// Size of the HAProxy configuration
+	mux.HandleFunc(ComplexityAPIPath, c.handleComplexity)
+
+	// Servers draining and waiting for their removal
+	mux.HandleFunc(RemovalsAPIPath, c.handleRemovals)
+
+	// Managed services, pending drift, manual resync and the last events of all services
+	mux.HandleFunc(ServicesAPIPath, c.handleServices)
+	mux.HandleFunc(DiffAPIPath, c.handleDiff)
+	mux.Handle(ResyncAPIPath, c.adminOnly(c.leaderOnly(http.HandlerFunc(c.handleResync))))
+	mux.HandleFunc(RecentEventsAPIPath, c.handleRecentEvents)
+
+	// Bulk drain/ready/maint of all servers of a service, and its event history
+	serviceActions := c.adminOnly(c.leaderOnly(&serviceAPI{
+		client:        c.haproxyClient,
+		nomadClient:   c.nomadClient,
+		handlers:      c.currentHandlers,
+		persistPaused: c.persistPausedServices,
+	}))
+	mux.HandleFunc(ServiceAPIPrefix, func(w http.ResponseWriter, r *http.Request) {
+		if isHistoryRequest(r) {
+			c.handleServiceHistory(w, r)
+			return
+		}
+		serviceActions.ServeHTTP(w, r)
 	})
 
 	server := &http.Server{
@@ -416,6 +1042,10 @@ func (c *Connector) startHealthServer(ctx context.Context) {
 
 	c.logger.Printf("Starting health server on :8080")
 
+	if listen := c.cfg().Admin.Listen; listen != "" {
+		go c.startAdminServer(ctx, listen, mux)
+	}
+
 	go func() {
 		<-ctx.Done()
 		if err := server.Shutdown(context.Background()); err != nil {
@@ -428,6 +1058,86 @@ func (c *Connector) startHealthServer(ctx context.Context) {
 	}
 }
 
+// startAdminServer serves the endpoints of the health server on the admin listen address, where the
+// admin endpoints are accepted without admin.token
+func (c *Connector) startAdminServer(ctx context.Context, listen string, mux http.Handler) {
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           adminListener(mux),
+		ReadHeaderTimeout: HealthCheckTimeoutSec * time.Second,
+	}
+	c.logger.Printf("Starting admin server on %s", listen)
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			c.logger.Printf("Error shutting down admin server: %v", err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		c.logger.Printf("Admin server error: %v", err)
+	}
+}
+
+// HealthStatus is the body of the /health endpoint
+type HealthStatus struct {
+	Status     string      `json:"status"`
+	Service    string      `json:"service"`
+	Role       string      `json:"role,omitempty"` // leader or standby in HA mode
+	Conditions []Condition `json:"conditions"`
+
+	// Instances reports each HAProxy instance when managing more than one
+	Instances []haproxy.InstanceStatus `json:"instances,omitempty"`
+}
+
+// Roles of connector instances in HA mode
+const (
+	RoleLeader  = "leader"
+	RoleStandby = "standby"
+)
+
+// handleHealth is the liveness endpoint: it answers 200 as long as the connector runs, reporting its
+// role, the typed conditions and status syncing until the initial sync has finished (or never with
+// sync.ready_without_sync). Gating traffic and restarts on the sync is the job of /ready.
+func (c *Connector) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	c.mu.RLock()
+	synced := c.initialSyncDone || c.cfg().Sync.ReadyWithoutSync
+	leading := c.leading
+	c.mu.RUnlock()
+
+	health := HealthStatus{Status: "healthy", Service: "haproxy-nomad-connector", Conditions: c.conditions.list()}
+	if c.multiClient != nil {
+		health.Instances = c.multiClient.Status()
+	}
+	if !synced {
+		health.Status = "syncing"
+	}
+	if c.lock != nil {
+		health.Role = RoleLeader
+		if !leading {
+			health.Role = RoleStandby
+			health.Status = RoleStandby
+		}
+	}
+	writeJSON(w, health)
+}
+
+// leaderOnly rejects requests of handlers that mutate HAProxy while this instance is a standby
+func (c *Connector) leaderOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.RLock()
+		standby := c.lock != nil && !c.leading
+		c.mu.RUnlock()
+
+		if standby {
+			http.Error(w, "standby instance, send the request to the leader", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // GetStats returns connector statistics
 func (c *Connector) GetStats() (processed, errors int64, lastEvent time.Time) {
 	c.mu.RLock()
@@ -0,0 +1,141 @@
+package connector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// credentialSetter is implemented by Data Plane API clients whose credentials can be replaced
+type credentialSetter interface {
+	SetCredentials(username, password, readUsername, readPassword string)
+}
+
+// tokenSetter is implemented by Nomad clients whose ACL token can be replaced
+type tokenSetter interface {
+	SetToken(token string)
+}
+
+// tokenReloader is implemented by Nomad clients that read their ACL token from a file
+type tokenReloader interface {
+	ReloadToken() (changed bool, err error)
+}
+
+// runTokenFileRefresh reads nomad.token_file again every nomad.token_refresh_interval_sec, so a
+// rotated token is used by API requests before the event stream reconnects
+func (c *Connector) runTokenFileRefresh(ctx context.Context) {
+	cfg := c.cfg()
+	reloader, ok := primaryDiscovery(c.nomadClient).(tokenReloader)
+	if !ok || cfg.Nomad.TokenFile == "" || cfg.Nomad.TokenRefreshIntervalSec <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cfg.Nomad.TokenRefreshIntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := reloader.ReloadToken()
+			if err != nil {
+				c.logger.Printf("Warning: Failed to read Nomad token file, keeping the current token: %v", err)
+			} else if changed {
+				c.logger.Println("Rotated credentials: nomad token file")
+			}
+		}
+	}
+}
+
+// runCredentialRefresh reads Vault-sourced credentials again every vault.refresh_interval_sec and
+// hands rotated ones to the Data Plane API and Nomad clients
+func (c *Connector) runCredentialRefresh(ctx context.Context) {
+	cfg := c.cfg()
+	if !cfg.HasVaultCredentials() || cfg.Vault.RefreshIntervalSec <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cfg.Vault.RefreshIntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.refreshCredentials(ctx); err != nil {
+				c.logger.Printf("Warning: Failed to refresh credentials, keeping the current ones: %v", err)
+			}
+		}
+	}
+}
+
+// refreshCredentials resolves the credential references again and applies changed credentials
+func (c *Connector) refreshCredentials(ctx context.Context) error {
+	current := c.cfg()
+	values, err := current.ResolveCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	updated := *current
+	updated.HAProxy.Instances = append([]config.HAProxyInstanceConfig(nil), current.HAProxy.Instances...)
+	updated.SetCredentials(values)
+
+	var rotated []string
+	if instances := updated.HAProxy.InstanceConfigs(); !reflect.DeepEqual(instances, current.HAProxy.InstanceConfigs()) {
+		c.setHAProxyCredentials(instances)
+		rotated = append(rotated, "haproxy")
+	}
+	if updated.Nomad.Token != current.Nomad.Token {
+		if setter, ok := primaryDiscovery(c.nomadClient).(tokenSetter); ok {
+			setter.SetToken(updated.Nomad.Token)
+		}
+		rotated = append(rotated, "nomad")
+	}
+	consulRotated := false
+	if updated.State.ConsulToken != current.State.ConsulToken {
+		c.logger.Println("Warning: state.consul_token rotated, it takes effect after a restart")
+		consulRotated = true
+	}
+	if updated.Discovery.ConsulToken != current.Discovery.ConsulToken {
+		c.logger.Println("Warning: discovery.consul_token rotated, it takes effect after a restart")
+		consulRotated = true
+	}
+	if len(rotated) == 0 && !consulRotated {
+		return nil
+	}
+
+	c.configMu.Lock()
+	c.config = &updated
+	c.configMu.Unlock()
+	if len(rotated) > 0 {
+		c.logger.Printf("Rotated credentials: %s", strings.Join(rotated, ", "))
+	}
+	return nil
+}
+
+// setHAProxyCredentials hands the credentials of every Data Plane API endpoint to its client
+func (c *Connector) setHAProxyCredentials(instances []config.HAProxyInstanceConfig) {
+	set := func(client interface{}, instance *config.HAProxyInstanceConfig) {
+		if setter, ok := client.(credentialSetter); ok {
+			setter.SetCredentials(instance.Username, instance.Password, instance.ReadUsername, instance.ReadPassword)
+		}
+	}
+
+	if c.multiClient == nil {
+		set(c.haproxyClient, &instances[0])
+		return
+	}
+	for _, managed := range c.multiClient.Instances() {
+		for i := range instances {
+			if instances[i].Name == managed.Name {
+				set(managed.Client, &instances[i])
+			}
+		}
+	}
+}
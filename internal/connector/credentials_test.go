@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// mockHAProxyClientWithCredentials records the credentials handed to the client
+type mockHAProxyClientWithCredentials struct {
+	mockHAProxyClient
+	credentialsMu sync.Mutex
+	password      string
+	calls         int
+}
+
+func (m *mockHAProxyClientWithCredentials) SetCredentials(username, password, readUsername, readPassword string) {
+	m.credentialsMu.Lock()
+	defer m.credentialsMu.Unlock()
+	m.password = password
+	m.calls++
+}
+
+type tokenRecordingNomadClient struct {
+	fakeNomadClient
+	token string
+}
+
+func (f *tokenRecordingNomadClient) SetToken(token string) {
+	f.token = token
+}
+
+func TestRefreshCredentials(t *testing.T) {
+	var mu sync.Mutex
+	version := 1
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, `{"data": {"data": {"password": "secret-%d"}, "metadata": {"version": %d}}}`, version, version)
+	}))
+	defer vault.Close()
+
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	t.Setenv("NOMAD_TOKEN_REF", "nomad-token")
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"nomad": {"token": "env:NOMAD_TOKEN_REF"}, "haproxy": {"password": "vault:secret/data/haproxy#password"}}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	client := &mockHAProxyClientWithCredentials{}
+	nomadClient := &tokenRecordingNomadClient{}
+	c := &Connector{config: cfg, haproxyClient: client, nomadClient: nomadClient, logger: log.New(io.Discard, "", 0)}
+
+	if err := c.refreshCredentials(context.Background()); err != nil {
+		t.Fatalf("refreshCredentials() failed: %v", err)
+	}
+	if client.calls != 0 || c.cfg() != cfg {
+		t.Error("Expected unchanged credentials to be left alone")
+	}
+
+	mu.Lock()
+	version = 2
+	mu.Unlock()
+	if err := c.refreshCredentials(context.Background()); err != nil {
+		t.Fatalf("refreshCredentials() failed: %v", err)
+	}
+	if client.calls != 1 || client.password != "secret-2" {
+		t.Errorf("Expected the rotated password to be handed to the client, got %d calls with %q", client.calls, client.password)
+	}
+	if c.cfg().HAProxy.Password != "secret-2" || cfg.HAProxy.Password != "secret-1" {
+		t.Errorf("Expected the configuration to be replaced, got %q (previous %q)", c.cfg().HAProxy.Password, cfg.HAProxy.Password)
+	}
+	if nomadClient.token != "" {
+		t.Errorf("Expected the unchanged Nomad token to be left alone, got %q", nomadClient.token)
+	}
+
+	t.Setenv("NOMAD_TOKEN_REF", "rotated-token")
+	if err := c.refreshCredentials(context.Background()); err != nil {
+		t.Fatalf("refreshCredentials() failed: %v", err)
+	}
+	if nomadClient.token != "rotated-token" || client.calls != 1 {
+		t.Errorf("Expected only the Nomad token to rotate, got %q and %d client calls", nomadClient.token, client.calls)
+	}
+}
@@ -0,0 +1,104 @@
+package connector
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// statusRule is the only rule of a status backend, answering every request with the status
+func statusRule(status int) haproxy.HTTPRequestRule {
+	return haproxy.HTTPRequestRule{Type: "deny", DenyStatus: status}
+}
+
+// ensureDefaultBackends sets the configured default backends of frontends. Status backends are
+// created, or their rules repaired, first; missing frontends are created when they declare a port.
+func ensureDefaultBackends(client haproxy.ClientInterface, defaults []config.DefaultBackendConfig, logger *log.Logger) error {
+	for i := range defaults {
+		d := &defaults[i]
+		if d.Status != 0 {
+			if err := ensureStatusBackend(client, d.Backend, d.Status, logger); err != nil {
+				return err
+			}
+		}
+		if err := ensureFrontendDefaultBackend(client, d, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureStatusBackend makes backendName answer every request with status. The backend is managed
+// by the connector entirely, other rules in it are removed.
+func ensureStatusBackend(client haproxy.ClientInterface, backendName string, status int, logger *log.Logger) error {
+	if _, err := client.GetBackend(backendName); haproxy.IsNotFound(err) {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for backend %s: %w", backendName, err)
+		}
+		if _, err := client.CreateBackend(haproxy.Backend{Name: backendName, Mode: ModeHTTP}, version); err != nil {
+			return fmt.Errorf("failed to create backend %s: %w", backendName, err)
+		}
+		logger.Printf("Created backend %s answering %d", backendName, status)
+	} else if err != nil {
+		return fmt.Errorf("failed to get backend %s: %w", backendName, err)
+	}
+
+	rules, err := client.GetHTTPRequestRules(haproxy.ParentTypeBackend, backendName)
+	if err != nil {
+		return fmt.Errorf("failed to get rules of backend %s: %w", backendName, err)
+	}
+	desired := statusRule(status)
+	if len(rules) == 1 && rules[0] == desired {
+		return nil
+	}
+
+	for i := len(rules) - 1; i >= 0; i-- {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for backend %s: %w", backendName, err)
+		}
+		if err := client.DeleteHTTPRequestRule(haproxy.ParentTypeBackend, backendName, i, version); err != nil {
+			return fmt.Errorf("failed to delete rule of backend %s: %w", backendName, err)
+		}
+	}
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for backend %s: %w", backendName, err)
+	}
+	if err := client.CreateHTTPRequestRule(haproxy.ParentTypeBackend, backendName, 0, &desired, version); err != nil {
+		return fmt.Errorf("failed to set status %d of backend %s: %w", status, backendName, err)
+	}
+	return nil
+}
+
+// ensureFrontendDefaultBackend points the default_backend of a frontend at the configured backend,
+// creating the frontend if it is missing and declares a port
+func ensureFrontendDefaultBackend(client haproxy.ClientInterface, d *config.DefaultBackendConfig, logger *log.Logger) error {
+	frontend, err := client.GetFrontend(d.Frontend)
+	switch {
+	case haproxy.IsNotFound(err) && d.Port != 0:
+		created := &haproxy.Frontend{Name: d.Frontend, Mode: ModeHTTP, DefaultBackend: d.Backend}
+		if _, err := ensureFrontend(client, created, frontendBind(d.Frontend, d.BindAddress, d.Port, d.Certificate)); err != nil {
+			return err
+		}
+		logger.Printf("Created frontend %s on port %d with default backend %s", d.Frontend, d.Port, d.Backend)
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to get frontend %s: %w", d.Frontend, err)
+	case frontend.DefaultBackend == d.Backend:
+		return nil
+	}
+
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for frontend %s: %w", d.Frontend, err)
+	}
+	if err := client.SetFrontendDefaultBackend(d.Frontend, d.Backend, version); err != nil {
+		return fmt.Errorf("failed to set default backend of frontend %s: %w", d.Frontend, err)
+	}
+	logger.Printf("Set default backend of frontend %s to %s (was %q)", d.Frontend, d.Backend, frontend.DefaultBackend)
+	return nil
+}
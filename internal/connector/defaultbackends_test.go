@@ -0,0 +1,77 @@
+package connector
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// backendCreatingClient remembers the backends it created
+type backendCreatingClient struct {
+	mockHAProxyClient
+}
+
+//nolint:gocritic // Matches interface signature
+func (m *backendCreatingClient) CreateBackend(backend haproxy.Backend, version int) (*haproxy.Backend, error) {
+	if m.backends == nil {
+		m.backends = make(map[string]*haproxy.Backend)
+	}
+	m.backends[backend.Name] = &backend
+	return &backend, nil
+}
+
+func TestEnsureDefaultBackends(t *testing.T) {
+	mock := &backendCreatingClient{mockHAProxyClient{createdFrontends: []haproxy.Frontend{{Name: "https", DefaultBackend: "legacy"}}}}
+	logger := log.New(io.Discard, "", 0)
+	defaults := []config.DefaultBackendConfig{
+		{Frontend: "https", Backend: "not_found", Status: 404},
+		{Frontend: "http", Backend: "not_found", Port: 80},
+	}
+
+	for run := 0; run < 2; run++ {
+		if err := ensureDefaultBackends(mock, defaults, logger); err != nil {
+			t.Fatalf("ensureDefaultBackends() failed: %v", err)
+		}
+	}
+
+	if mock.backends["not_found"] == nil {
+		t.Fatal("Expected the status backend to be created")
+	}
+	rules := mock.httpRequestRules[haproxy.ParentTypeBackend+"/not_found"]
+	if len(rules) != 1 || rules[0] != statusRule(404) {
+		t.Errorf("Expected the status backend to deny with 404 once, got %+v", rules)
+	}
+	if frontend, _ := mock.GetFrontend("https"); frontend.DefaultBackend != "not_found" {
+		t.Errorf("Expected the default backend of the existing frontend to be replaced, got %q", frontend.DefaultBackend)
+	}
+	if len(mock.createdFrontends) != 2 || mock.createdFrontends[1].DefaultBackend != "not_found" || mock.createdBinds[0].Port != 80 {
+		t.Errorf("Expected the missing frontend to be created once with its default backend, got %+v", mock.createdFrontends)
+	}
+}
+
+func TestEnsureStatusBackendRepairsRules(t *testing.T) {
+	mock := &backendCreatingClient{mockHAProxyClient{
+		backends: map[string]*haproxy.Backend{"not_found": {Name: "not_found"}},
+		httpRequestRules: map[string][]haproxy.HTTPRequestRule{
+			haproxy.ParentTypeBackend + "/not_found": {statusRule(503), {Type: "set-header", HdrName: "X-Test"}},
+		},
+	}}
+
+	if err := ensureStatusBackend(mock, "not_found", 404, log.New(io.Discard, "", 0)); err != nil {
+		t.Fatalf("ensureStatusBackend() failed: %v", err)
+	}
+	rules := mock.httpRequestRules[haproxy.ParentTypeBackend+"/not_found"]
+	if len(rules) != 1 || rules[0] != statusRule(404) {
+		t.Errorf("Expected the rules to be replaced by the 404 rule, got %+v", rules)
+	}
+}
+
+func TestEnsureDefaultBackendsRequiresFrontend(t *testing.T) {
+	defaults := []config.DefaultBackendConfig{{Frontend: "https", Backend: "fallback"}}
+	if err := ensureDefaultBackends(&mockHAProxyClient{}, defaults, log.New(io.Discard, "", 0)); err == nil {
+		t.Error("Expected an error for a missing frontend without port")
+	}
+}
@@ -0,0 +1,61 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/dns"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// DNSOptOutTag keeps the connector from managing the DNS record of a service's domain
+const DNSOptOutTag = "haproxy.dns=false"
+
+// dnsManager points the records of service domains at the load balancer via a DNS provider
+type dnsManager struct {
+	provider   dns.Provider
+	recordType string
+	target     string
+}
+
+// apply creates or deletes the record of a domain
+func (m *dnsManager) apply(action, domain string) (dns.Record, error) {
+	record := dns.Record{Action: action, Domain: domain, Type: m.recordType, Target: m.target}
+	return record, m.provider.Apply(context.Background(), record)
+}
+
+// dnsDomain returns the domain whose record the connector manages for the service, or "" if none.
+// Regex and prefix domains can't be expressed as a single record and are skipped.
+func (hs *handlerState) dnsDomain(serviceName string, tags []string) string {
+	if hs.dnsRecords == nil || hasTag(tags, DNSOptOutTag) {
+		return ""
+	}
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if domainMapping == nil || domainMapping.Type != haproxy.DomainTypeExact {
+		return ""
+	}
+	return domainMapping.Domain
+}
+
+// publishDNSRecord creates the record of the service's domain after its domain rule was added.
+// Failures don't fail the registration, the domain is routed already.
+func (hs *handlerState) publishDNSRecord(serviceName string, tags []string, result map[string]string) {
+	hs.changeDNSRecord(dns.ActionCreate, hs.dnsDomain(serviceName, tags), result)
+}
+
+// unpublishDNSRecord deletes the record of the service's domain after its domain rule was removed
+func (hs *handlerState) unpublishDNSRecord(serviceName string, tags []string, result map[string]string) {
+	hs.changeDNSRecord(dns.ActionDelete, hs.dnsDomain(serviceName, tags), result)
+}
+
+func (hs *handlerState) changeDNSRecord(action, domain string, result map[string]string) {
+	if domain == "" {
+		return
+	}
+	record, err := hs.dnsRecords.apply(action, domain)
+	if err != nil {
+		result["dns_warning"] = err.Error()
+		return
+	}
+	result["dns"] = fmt.Sprintf("%s %s record: %s -> %s", action, record.Type, record.Domain, record.Target)
+}
@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/dns"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// recordingDNSProvider records the applied DNS records
+type recordingDNSProvider struct {
+	records []dns.Record
+	err     error
+}
+
+func (p *recordingDNSProvider) Apply(_ context.Context, record dns.Record) error {
+	p.records = append(p.records, record)
+	return p.err
+}
+
+// withDNSProvider returns a handler state publishing the DNS records of service domains to provider
+func withDNSProvider(provider dns.Provider) *handlerState {
+	hs := newHandlerState()
+	hs.dnsRecords = &dnsManager{provider: provider, recordType: dns.RecordTypeA, target: "192.0.2.1"}
+	return hs
+}
+
+func TestReconcileFrontendRulePublishesDNSRecord(t *testing.T) {
+	provider := &recordingDNSProvider{}
+	hs := withDNSProvider(provider)
+
+	tags := []string{"haproxy.enable=true", "haproxy.domain=app.example.com"}
+	result := map[string]string{}
+	if err := hs.reconcileFrontendRule(&mockHAProxyClient{}, "app", tags, "app", result, []string{"https"}); err != nil {
+		t.Fatalf("reconcileFrontendRule() failed: %v", err)
+	}
+
+	expected := dns.Record{Action: dns.ActionCreate, Domain: "app.example.com", Type: dns.RecordTypeA, Target: "192.0.2.1"}
+	if len(provider.records) != 1 || provider.records[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, provider.records)
+	}
+	if result["dns"] != "create A record: app.example.com -> 192.0.2.1" {
+		t.Errorf("Expected DNS change in result, got %v", result)
+	}
+
+	// An existing rule doesn't touch the record again
+	existing := &mockHAProxyClient{frontendRules: map[string][]haproxy.FrontendRule{
+		"https": {{Domain: "app.example.com", Backend: "app"}},
+	}}
+	if err := hs.reconcileFrontendRule(existing, "app", tags, "app", map[string]string{}, []string{"https"}); err != nil {
+		t.Fatalf("reconcileFrontendRule() failed: %v", err)
+	}
+	if len(provider.records) != 1 {
+		t.Errorf("Expected no record change for existing rule, got %+v", provider.records)
+	}
+}
+
+func TestRemoveFrontendRuleDeletesDNSRecord(t *testing.T) {
+	provider := &recordingDNSProvider{err: errors.New("zone not found")}
+	hs := withDNSProvider(provider)
+
+	result := map[string]string{}
+	hs.removeFrontendRule(&mockHAProxyClient{}, "app", []string{"haproxy.domain=app.example.com"}, result, []string{"https"})
+
+	if len(provider.records) != 1 || provider.records[0].Action != dns.ActionDelete {
+		t.Errorf("Expected record deletion, got %+v", provider.records)
+	}
+	if result["frontend_rule_removed"] != "app.example.com" || result["dns_warning"] != "zone not found" {
+		t.Errorf("Expected removed rule with DNS warning, got %v", result)
+	}
+}
+
+func TestDNSDomainSkips(t *testing.T) {
+	hs := withDNSProvider(&recordingDNSProvider{})
+
+	tests := []struct {
+		name string
+		tags []string
+	}{
+		{name: "no domain", tags: []string{"haproxy.enable=true"}},
+		{name: "opt out", tags: []string{"haproxy.domain=app.example.com", DNSOptOutTag}},
+		{name: "regex domain", tags: []string{"haproxy.domain=^app\\..*$", "haproxy.domain.type=regex"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if domain := hs.dnsDomain("app", tt.tags); domain != "" {
+				t.Errorf("Expected no DNS record, got %s", domain)
+			}
+		})
+	}
+
+	hs.dnsRecords = nil
+	if domain := hs.dnsDomain("app", []string{"haproxy.domain=app.example.com"}); domain != "" {
+		t.Errorf("Expected no DNS record while disabled, got %s", domain)
+	}
+}
@@ -1,7 +1,12 @@
 package connector
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
 	"strings"
+	"sync/atomic"
 
 	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
 )
@@ -22,6 +27,8 @@ func parseDomainMapping(serviceName string, tags []string) *haproxy.DomainMappin
 				domainType = haproxy.DomainTypeExact
 			case "prefix":
 				domainType = haproxy.DomainTypePrefix
+			case "suffix":
+				domainType = haproxy.DomainTypeSuffix
 			case "regex":
 				domainType = haproxy.DomainTypeRegex
 			}
@@ -32,14 +39,119 @@ func parseDomainMapping(serviceName string, tags []string) *haproxy.DomainMappin
 	if domain == "" {
 		return nil
 	}
+	if domainType != haproxy.DomainTypeRegex && strings.Contains(domain, "*") {
+		domain, domainType = wildcardDomain(domain)
+	}
 
 	return &haproxy.DomainMapping{
 		Domain:      domain,
-		BackendName: sanitizeServiceName(serviceName),
+		BackendName: stableBackendName(serviceName, tags),
 		Type:        domainType,
 	}
 }
 
+// wildcardDomain converts the wildcard syntax of a domain: a leading "*." matches all subdomains
+// by suffix, "*.example.com" becomes ".example.com", other wildcards match a single label each
+// through a regex, "api-*.example.com" becomes "^api-[^.]+\.example\.com$"
+func wildcardDomain(domain string) (string, haproxy.DomainType) {
+	if rest := strings.TrimPrefix(domain, "*"); strings.HasPrefix(rest, ".") && !strings.Contains(rest, "*") {
+		return rest, haproxy.DomainTypeSuffix
+	}
+
+	parts := strings.Split(domain, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return "^" + strings.Join(parts, "[^.]+") + "$", haproxy.DomainTypeRegex
+}
+
+// quarantinedDomains counts the registrations whose regex domain was skipped because HAProxy would reject it
+var quarantinedDomains atomic.Int64
+
+// quarantineInvalidRegexDomain drops the domain tags of a service whose haproxy.domain.type=regex pattern
+// HAProxy would reject. The service is routed without its domain instead of committing a broken ACL,
+// which would fail the whole transaction and block the updates of other services.
+func quarantineInvalidRegexDomain(serviceName string, tags []string, result map[string]string) []string {
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if domainMapping == nil || domainMapping.Type != haproxy.DomainTypeRegex {
+		return tags
+	}
+	err := validateRegexDomain(domainMapping.Domain)
+	if err == nil {
+		return tags
+	}
+
+	quarantinedDomains.Add(1)
+	handlerLog.Warn("Skipping rules of invalid regex domain", "service", serviceName, "error", err)
+	result["domain_quarantined"] = err.Error()
+
+	var withoutDomain []string
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "haproxy.domain=") && !strings.HasPrefix(tag, "haproxy.domain.type=") {
+			withoutDomain = append(withoutDomain, tag)
+		}
+	}
+	return withoutDomain
+}
+
+// pcreOnlyPrefixes start constructs Go's regexp rejects but HAProxy's PCRE supports:
+// lookarounds, atomic groups and branch reset groups
+var pcreOnlyPrefixes = []string{"(?=", "(?!", "(?<=", "(?<!", "(?>", "(?|"}
+
+// pcreOnlyEscapes are escapes Go's regexp rejects but PCRE supports: backreferences, \Z, \h, ...
+const pcreOnlyEscapes = "123456789ZGKRXhHvVgk"
+
+// validateRegexDomain checks a haproxy.domain.type=regex pattern before it is committed as -m reg ACL,
+// so a pattern HAProxy rejects fails the registration with a precise error instead of the whole
+// transaction. The check is soft: PCRE constructs Go's regexp doesn't know are let through.
+func validateRegexDomain(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i+1 < len(pattern) && pattern[i+1] == 'x' && !isHexEscape(pattern[i+2:]) {
+				return fmt.Errorf("invalid regex domain %q: HAProxy only accepts \\x escapes with two hex digits (\\xHH)", pattern)
+			}
+			i++
+		case ' ', '\t':
+			return fmt.Errorf("invalid regex domain %q: whitespace separates ACL arguments in HAProxy, use \\s", pattern)
+		case '#':
+			return fmt.Errorf("invalid regex domain %q: # starts a comment in HAProxy, use \\x23", pattern)
+		case '"', '\'':
+			return fmt.Errorf("invalid regex domain %q: quotes are interpreted by the HAProxy configuration parser, use \\x22 or \\x27", pattern)
+		}
+	}
+
+	_, err := syntax.Parse(pattern, syntax.Perl)
+	var syntaxErr *syntax.Error
+	if err == nil || (errors.As(err, &syntaxErr) && isPCREOnly(syntaxErr)) {
+		return nil
+	}
+	return fmt.Errorf("invalid regex domain %q: %w", pattern, err)
+}
+
+// isHexEscape checks if s starts with the two hex digits of a \xHH escape
+func isHexEscape(s string) bool {
+	const hexDigits = "0123456789abcdefABCDEF"
+	return len(s) >= 2 && strings.IndexByte(hexDigits, s[0]) >= 0 && strings.IndexByte(hexDigits, s[1]) >= 0
+}
+
+// isPCREOnly checks if Go's regexp rejected a construct that is valid in PCRE
+func isPCREOnly(err *syntax.Error) bool {
+	for _, prefix := range pcreOnlyPrefixes {
+		if strings.HasPrefix(err.Expr, prefix) {
+			return true
+		}
+	}
+	switch err.Code {
+	case syntax.ErrInvalidEscape:
+		return len(err.Expr) == 2 && strings.ContainsRune(pcreOnlyEscapes, rune(err.Expr[1]))
+	case syntax.ErrInvalidRepeatOp:
+		// Possessive quantifiers such as a++
+		return len(err.Expr) == 2 && err.Expr[1] == '+'
+	}
+	return false
+}
+
 // hasDomainMapping checks if service has domain mapping tags
 func hasDomainMapping(tags []string) bool {
 	for _, tag := range tags {
@@ -49,3 +161,48 @@ func hasDomainMapping(tags []string) bool {
 	}
 	return false
 }
+
+// parseFrontends returns the frontends a service publishes its domain rules to.
+// The haproxy.frontend=http,https tag overrides the configured default frontends.
+func parseFrontends(tags, defaultFrontends []string) []string {
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, "haproxy.frontend=") {
+			continue
+		}
+
+		var frontends []string
+		for _, name := range strings.Split(strings.TrimPrefix(tag, "haproxy.frontend="), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				frontends = append(frontends, name)
+			}
+		}
+		if len(frontends) > 0 {
+			return frontends
+		}
+	}
+
+	return defaultFrontends
+}
+
+// hostCondition builds an anonymous ACL condition matching the Host header of a domain mapping
+func (hs *handlerState) hostCondition(domainMapping *haproxy.DomainMapping) string {
+	match := hs.hostMatch.ForType(domainMapping.Type)
+	switch {
+	case domainMapping.Type == haproxy.DomainTypePrefix:
+		return fmt.Sprintf("{ hdr_beg(host) -i %s }", domainMapping.Domain)
+	case match == haproxy.HostMatchStripPort && domainMapping.Type == haproxy.DomainTypeRegex:
+		return fmt.Sprintf("{ hdr(host),field(1,:) -m reg %s }", domainMapping.Domain)
+	case match == haproxy.HostMatchStripPort && domainMapping.Type == haproxy.DomainTypeSuffix:
+		return fmt.Sprintf("{ hdr(host),field(1,:) -m end -i %s }", domainMapping.Domain)
+	case match == haproxy.HostMatchStripPort:
+		return fmt.Sprintf("{ hdr(host),field(1,:) -i %s }", domainMapping.Domain)
+	case match == haproxy.HostMatchDomain:
+		return fmt.Sprintf("{ hdr_dom(host) -i %s }", domainMapping.Domain)
+	case domainMapping.Type == haproxy.DomainTypeRegex:
+		return fmt.Sprintf("{ hdr_reg(host) %s }", domainMapping.Domain)
+	case domainMapping.Type == haproxy.DomainTypeSuffix:
+		return fmt.Sprintf("{ hdr_end(host) -i %s }", domainMapping.Domain)
+	default:
+		return fmt.Sprintf("{ hdr(host) -i %s }", domainMapping.Domain)
+	}
+}
@@ -1,6 +1,8 @@
 package connector
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
@@ -53,6 +55,46 @@ func TestParseDomainMapping(t *testing.T) {
 				Type:        haproxy.DomainTypeRegex,
 			},
 		},
+		{
+			name:        "domain with suffix type",
+			serviceName: "tenants",
+			tags:        []string{"haproxy.domain=.tenants.example.com", "haproxy.domain.type=suffix"},
+			expected: &haproxy.DomainMapping{
+				Domain:      ".tenants.example.com",
+				BackendName: "tenants",
+				Type:        haproxy.DomainTypeSuffix,
+			},
+		},
+		{
+			name:        "leading wildcard becomes suffix",
+			serviceName: "tenants",
+			tags:        []string{"haproxy.domain=*.tenants.example.com"},
+			expected: &haproxy.DomainMapping{
+				Domain:      ".tenants.example.com",
+				BackendName: "tenants",
+				Type:        haproxy.DomainTypeSuffix,
+			},
+		},
+		{
+			name:        "inner wildcard becomes regex",
+			serviceName: "previews",
+			tags:        []string{"haproxy.domain=pr-*.preview.example.com"},
+			expected: &haproxy.DomainMapping{
+				Domain:      "^pr-[^.]+\\.preview\\.example\\.com$",
+				BackendName: "previews",
+				Type:        haproxy.DomainTypeRegex,
+			},
+		},
+		{
+			name:        "regex with star is kept",
+			serviceName: "assets",
+			tags:        []string{"haproxy.domain=^.*\\.example\\.com$", "haproxy.domain.type=regex"},
+			expected: &haproxy.DomainMapping{
+				Domain:      "^.*\\.example\\.com$",
+				BackendName: "assets",
+				Type:        haproxy.DomainTypeRegex,
+			},
+		},
 		{
 			name:        "no domain tag",
 			serviceName: "database",
@@ -160,3 +202,154 @@ func TestHasDomainMapping(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFrontends(t *testing.T) {
+	defaults := []string{"https"}
+
+	tests := []struct {
+		name     string
+		tags     []string
+		expected []string
+	}{
+		{
+			name:     "no frontend tag uses defaults",
+			tags:     []string{"haproxy.enable=true", "haproxy.domain=api.example.com"},
+			expected: []string{"https"},
+		},
+		{
+			name:     "single frontend",
+			tags:     []string{"haproxy.frontend=http"},
+			expected: []string{"http"},
+		},
+		{
+			name:     "multiple frontends with whitespace",
+			tags:     []string{"haproxy.frontend=http, https"},
+			expected: []string{"http", "https"},
+		},
+		{
+			name:     "empty frontend tag uses defaults",
+			tags:     []string{"haproxy.frontend="},
+			expected: []string{"https"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseFrontends(tt.tags, defaults)
+			if strings.Join(result, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("parseFrontends() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateRegexDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr string
+	}{
+		{name: "valid pattern", pattern: `^(www\.)?example\.com$`},
+		{name: "hex escape", pattern: `^example\x2ecom$`},
+		{name: "PCRE lookahead", pattern: `^(?!admin\.).*\.example\.com$`},
+		{name: "PCRE lookbehind", pattern: `(?<=api)\.example\.com$`},
+		{name: "PCRE backreference", pattern: `^(a+)\.\1\.example\.com$`},
+		{name: "PCRE possessive quantifier", pattern: `^[a-z]++\.example\.com$`},
+		{name: "unbalanced parenthesis", pattern: `^(www\.example\.com$`, wantErr: "missing closing )"},
+		{name: "missing repetition argument", pattern: `*.example.com`, wantErr: "missing argument to repetition operator"},
+		{name: "whitespace", pattern: `^example\.com| www\.example\.com$`, wantErr: "whitespace"},
+		{name: "comment", pattern: `^example\.com#$`, wantErr: "comment"},
+		{name: "quote", pattern: `^"example\.com$`, wantErr: "quotes"},
+		{name: "braced hex escape", pattern: `^example\x{2e}com$`, wantErr: `\xHH`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRegexDomain(tt.pattern)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateRegexDomain(%q) = %v, expected no error", tt.pattern, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateRegexDomain(%q) = %v, expected error containing %q", tt.pattern, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReconcileFrontendRule_RejectsInvalidRegexDomain(t *testing.T) {
+	hs := newHandlerState()
+	mockClient := &mockHAProxyClient{}
+	tags := []string{"haproxy.enable=true", "haproxy.domain=^(api\\.example\\.com$", "haproxy.domain.type=regex"}
+
+	err := hs.reconcileFrontendRule(mockClient, "api", tags, "api", map[string]string{}, []string{"https"})
+	if err == nil || !strings.Contains(err.Error(), "invalid regex domain") {
+		t.Fatalf("Expected a regex validation error, got %v", err)
+	}
+	if calls := mockClient.getAddFrontendRuleCalls(); len(calls) != 0 {
+		t.Errorf("Expected no AddFrontendRule calls, got %d", len(calls))
+	}
+}
+
+func TestReconcileFrontendRule_RewritesRuleForHostMatch(t *testing.T) {
+	hs := newHandlerState()
+	hs.hostMatch = haproxy.HostMatchStripPort
+
+	mockClient := &mockHAProxyClient{frontendRules: map[string][]haproxy.FrontendRule{
+		"https": {{Domain: "api.example.com", Backend: "api", Type: haproxy.DomainTypeExact, Managed: true}},
+	}}
+	tags := []string{"haproxy.enable=true", "haproxy.domain=api.example.com"}
+
+	// The rule matching the Host header as sent is rewritten to ignore the port
+	if err := hs.reconcileFrontendRule(mockClient, "api", tags, "api", map[string]string{}, []string{"https"}); err != nil {
+		t.Fatalf("reconcileFrontendRule() failed: %v", err)
+	}
+	if len(mockClient.setFrontendRules) != 1 || mockClient.setFrontendRules[0].HostMatch != haproxy.HostMatchStripPort {
+		t.Fatalf("Expected the rule to be rewritten without port, got %+v", mockClient.setFrontendRules)
+	}
+
+	// Afterwards it is up to date
+	if err := hs.reconcileFrontendRule(mockClient, "api", tags, "api", map[string]string{}, []string{"https"}); err != nil {
+		t.Fatalf("reconcileFrontendRule() failed: %v", err)
+	}
+	if len(mockClient.setFrontendRules) != 1 {
+		t.Errorf("Expected no further rewrite, got %+v", mockClient.setFrontendRules)
+	}
+}
+
+func TestInvalidRegexDomainQuarantined(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	event := &ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Service: Service{
+			ServiceName: "shop",
+			Address:     "10.0.0.7",
+			Port:        8080,
+			Tags: []string{"haproxy.enable=true", "haproxy.domain=^(shop|store\\.example\\.com$",
+				"haproxy.domain.type=regex", "haproxy.redirect.https=true"},
+		},
+	}
+	quarantined := quarantinedDomains.Load()
+
+	result, err := ProcessServiceEvent(context.Background(), mock, event, redirectTestConfig())
+	if err != nil {
+		t.Fatalf("Expected the service to be registered without its domain, got %v", err)
+	}
+	if result.(map[string]string)["status"] != StatusCreated {
+		t.Errorf("Expected the server to be added, got %v", result)
+	}
+	if rules, _ := mock.GetFrontendRules("https"); len(rules) != 0 {
+		t.Errorf("Expected no frontend rule for the invalid regex, got %+v", rules)
+	}
+	if rules, _ := mock.GetHTTPRequestRules(haproxy.ParentTypeFrontend, "http"); len(rules) != 0 {
+		t.Errorf("Expected no redirect rule for the invalid regex, got %+v", rules)
+	}
+	if !strings.Contains(result.(map[string]string)["domain_quarantined"], "invalid regex domain") {
+		t.Errorf("Expected domain_quarantined in result, got %v", result)
+	}
+	if quarantinedDomains.Load() != quarantined+1 {
+		t.Error("Expected the quarantined domain to be counted")
+	}
+}
@@ -0,0 +1,107 @@
+package connector
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// normalizeDomainSuffix turns "*.example.com" and "example.com" into ".example.com"
+func normalizeDomainSuffix(suffix string) string {
+	suffix = strings.TrimPrefix(suffix, "*")
+	if !strings.HasPrefix(suffix, ".") {
+		suffix = "." + suffix
+	}
+	return strings.ToLower(suffix)
+}
+
+// matchDomainGroup returns the domain group whose suffix matches the domain, preferring the longest suffix
+func matchDomainGroup(domain string, groups []config.DomainGroupConfig) *config.DomainGroupConfig {
+	domain = strings.ToLower(domain)
+
+	var best *config.DomainGroupConfig
+	bestLen := 0
+	for i := range groups {
+		suffix := normalizeDomainSuffix(groups[i].Suffix)
+		if strings.HasSuffix(domain, suffix) && len(suffix) > bestLen {
+			best = &groups[i]
+			bestLen = len(suffix)
+		}
+	}
+	return best
+}
+
+// serviceFrontends returns the default frontends for a service: the frontend of the domain group
+// matching its domain, or the configured default frontends. Explicit haproxy.frontend tags still
+// take precedence when the rules are reconciled.
+func serviceFrontends(serviceName string, tags []string, cfg *config.HAProxyConfig) []string {
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if domainMapping != nil && domainMapping.Type != haproxy.DomainTypeRegex {
+		if group := matchDomainGroup(domainMapping.Domain, cfg.DomainGroups); group != nil {
+			return []string{group.Frontend}
+		}
+	}
+	return cfg.DefaultFrontends()
+}
+
+// managedFrontends returns all frontends the connector publishes rules to by default
+func managedFrontends(cfg *config.HAProxyConfig) []string {
+	frontends := append([]string{}, cfg.DefaultFrontends()...)
+	for _, group := range cfg.DomainGroups {
+		if !containsString(frontends, group.Frontend) {
+			frontends = append(frontends, group.Frontend)
+		}
+	}
+	return frontends
+}
+
+// ensureDomainGroupFrontends creates the dedicated frontends of all domain groups that declare a port
+// and keeps the binds of existing ones on the configured port
+func ensureDomainGroupFrontends(client haproxy.ClientInterface, groups []config.DomainGroupConfig, logger *log.Logger) error {
+	for i := range groups {
+		group := &groups[i]
+		if group.Frontend == "" || group.Port == 0 {
+			continue
+		}
+
+		frontend := &haproxy.Frontend{Name: group.Frontend, Mode: ModeHTTP}
+		changed, err := ensureFrontend(client, frontend, frontendBind(group.Frontend, group.BindAddress, group.Port, group.Certificate))
+		if err != nil {
+			return err
+		}
+		if changed {
+			logger.Printf("Set up frontend %s for domain group %s on port %d", group.Frontend, group.Suffix, group.Port)
+		}
+	}
+	return nil
+}
+
+// ensureFrontend creates the frontend with its binds if it is missing and repairs the binds of an
+// existing one, in a single transaction. Returns whether anything changed.
+func ensureFrontend(client haproxy.ClientInterface, frontend *haproxy.Frontend, binds ...haproxy.Bind) (bool, error) {
+	changed, err := client.EnsureFrontend(frontend, binds)
+	if err != nil {
+		return false, fmt.Errorf("failed to set up frontend %s: %w", frontend.Name, err)
+	}
+	return changed, nil
+}
+
+// frontendBind returns the bind of a frontend to a port, with ssl when a certificate is set
+func frontendBind(frontendName, bindAddress string, port int, certificate string) haproxy.Bind {
+	bind := haproxy.Bind{
+		Name:    fmt.Sprintf("%s_%d", frontendName, port),
+		Address: bindAddress,
+		Port:    port,
+	}
+	if bind.Address == "" {
+		bind.Address = DefaultBindAddress
+	}
+	if certificate != "" {
+		bind.SSL = true
+		bind.SSLCertificate = certificate
+	}
+	return bind
+}
@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestServiceFrontends_DomainGroups(t *testing.T) {
+	cfg := &config.HAProxyConfig{
+		Frontend: "https",
+		DomainGroups: []config.DomainGroupConfig{
+			{Suffix: "*.internal.company.com", Frontend: "internal"},
+			{Suffix: ".db.internal.company.com", Frontend: "internal_db"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		tags     []string
+		expected []string
+	}{
+		{"no domain uses defaults", []string{"haproxy.enable=true"}, []string{"https"}},
+		{"unmatched domain uses defaults", []string{"haproxy.domain=api.example.com"}, []string{"https"}},
+		{"matching suffix", []string{"haproxy.domain=wiki.internal.company.com"}, []string{"internal"}},
+		{"longest suffix wins", []string{"haproxy.domain=pg.db.internal.company.com"}, []string{"internal_db"}},
+		{"suffix match is case insensitive", []string{"haproxy.domain=Wiki.Internal.Company.com"}, []string{"internal"}},
+		{
+			"regex domains are not grouped",
+			[]string{"haproxy.domain=^.+\\.internal\\.company\\.com$", "haproxy.domain.type=regex"},
+			[]string{"https"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serviceFrontends("svc", tt.tags, cfg)
+			if strings.Join(result, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("serviceFrontends() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+
+	if managed := managedFrontends(cfg); strings.Join(managed, ",") != "https,internal,internal_db" {
+		t.Errorf("managedFrontends() = %v", managed)
+	}
+}
+
+func TestEnsureDomainGroupFrontends(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	logger := log.New(os.Stdout, "test: ", log.LstdFlags)
+
+	groups := []config.DomainGroupConfig{
+		{Suffix: "*.internal.company.com", Frontend: "internal", Port: 8443, Certificate: "/etc/ssl/internal.pem"},
+		{Suffix: "*.other.com", Frontend: "https"}, // no port: frontend is managed outside the connector
+	}
+
+	if err := ensureDomainGroupFrontends(mock, groups, logger); err != nil {
+		t.Fatalf("ensureDomainGroupFrontends() failed: %v", err)
+	}
+	// Second run must not recreate the existing frontend
+	if err := ensureDomainGroupFrontends(mock, groups, logger); err != nil {
+		t.Fatalf("ensureDomainGroupFrontends() failed: %v", err)
+	}
+
+	if len(mock.createdFrontends) != 1 || mock.createdFrontends[0].Name != "internal" {
+		t.Fatalf("Expected only the internal frontend to be created once, got %+v", mock.createdFrontends)
+	}
+	bind := mock.createdBinds[0]
+	if bind.Port != 8443 || !bind.SSL || bind.SSLCertificate != "/etc/ssl/internal.pem" || bind.Address != "*" {
+		t.Errorf("Unexpected bind: %+v", bind)
+	}
+}
+
+func TestEnsureDomainGroupFrontends_RepairsBinds(t *testing.T) {
+	mock := &mockHAProxyClient{createdFrontends: []haproxy.Frontend{{Name: "internal", Mode: ModeHTTP}}}
+	logger := log.New(io.Discard, "", 0)
+	groups := []config.DomainGroupConfig{{Suffix: "*.internal.company.com", Frontend: "internal", Port: 8443}}
+
+	if err := ensureDomainGroupFrontends(mock, groups, logger); err != nil {
+		t.Fatalf("ensureDomainGroupFrontends() failed: %v", err)
+	}
+	if len(mock.createdFrontends) != 1 || len(mock.createdBinds) != 1 || mock.createdBinds[0].Port != 8443 {
+		t.Fatalf("Expected the missing bind of the existing frontend to be created, got %+v", mock.createdBinds)
+	}
+
+	groups[0].Port = 9443
+	if err := ensureDomainGroupFrontends(mock, groups, logger); err != nil {
+		t.Fatalf("ensureDomainGroupFrontends() failed: %v", err)
+	}
+	if len(mock.createdBinds) != 1 || mock.createdBinds[0].Name != "internal_9443" {
+		t.Errorf("Expected the bind to move to the new port, got %+v", mock.createdBinds)
+	}
+}
@@ -0,0 +1,206 @@
+package connector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Domain metrics constants
+const (
+	// DomainHitsTable is the table-only backend counting the requests of every managed domain rule
+	DomainHitsTable         = "domain_hits"
+	DomainHitsTableSize     = 10000
+	DomainHitsExpireMs      = 24 * 60 * 60 * 1000
+	DomainHitsRatePeriodSec = 60
+	StickTableTypeString    = "string"
+
+	// DomainHitsStickCounter leaves sticky counter 0 to the rate limits
+	DomainHitsStickCounter = 1
+)
+
+// DomainHits is the request count of a domain rule in one frontend as reported by /metrics
+type DomainHits struct {
+	Frontend    string `json:"frontend"`
+	Domain      string `json:"domain"`
+	Backend     string `json:"backend"`
+	Requests    int64  `json:"requests"`     // Requests since the rule received its first one
+	RequestRate int64  `json:"request_rate"` // Requests within the last minute
+}
+
+// domainHitsKey is the stick table key of a domain rule: the backend names are unique per frontend
+// and, unlike regex domains, safe to use as str() argument
+func domainHitsKey(frontendName, backendName string) string {
+	return frontendName + "/" + backendName
+}
+
+// domainHitsTableBackend builds the table-only backend counting requests per domain rule
+func domainHitsTableBackend() haproxy.Backend {
+	return haproxy.Backend{
+		Name:    DomainHitsTable,
+		Mode:    ModeHTTP,
+		Balance: haproxy.Balance{Algorithm: "roundrobin"},
+		StickTable: &haproxy.StickTable{
+			Type:   StickTableTypeString,
+			Size:   DomainHitsTableSize,
+			Expire: DomainHitsExpireMs,
+			Store:  fmt.Sprintf("http_req_cnt,http_req_rate(%ds)", DomainHitsRatePeriodSec),
+		},
+	}
+}
+
+// domainHitsRule builds the frontend rule counting the requests matching a domain rule
+func (hs *handlerState) domainHitsRule(domainMapping *haproxy.DomainMapping, frontendName, backendName string) haproxy.HTTPRequestRule {
+	return haproxy.HTTPRequestRule{
+		Type:                RuleTypeTrackSC,
+		TrackSCKey:          fmt.Sprintf("str(%s)", domainHitsKey(frontendName, backendName)),
+		TrackSCTable:        DomainHitsTable,
+		TrackSCStickCounter: DomainHitsStickCounter,
+		Cond:                CondIf,
+		CondTest:            hs.hostCondition(domainMapping),
+	}
+}
+
+// findDomainHitsRule returns the index of the rule counting the requests of a backend, or -1
+func findDomainHitsRule(rules []haproxy.HTTPRequestRule, frontendName, backendName string) int {
+	key := fmt.Sprintf("str(%s)", domainHitsKey(frontendName, backendName))
+	for i := range rules {
+		if rules[i].Type == RuleTypeTrackSC && rules[i].TrackSCTable == DomainHitsTable && rules[i].TrackSCKey == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// reconcileDomainMetrics counts the requests of the service's domain rule in every frontend it is
+// published to, when haproxy.domain_metrics is enabled
+func (hs *handlerState) reconcileDomainMetrics(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	backendName string,
+	result map[string]string,
+	frontends []string,
+) error {
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if domainMapping == nil {
+		return nil
+	}
+
+	if _, err := client.GetBackend(DomainHitsTable); err != nil {
+		if !haproxy.IsNotFound(err) {
+			return fmt.Errorf("failed to get domain metrics table %s: %w", DomainHitsTable, err)
+		}
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for domain metrics table: %w", err)
+		}
+		if _, err := client.CreateBackend(domainHitsTableBackend(), version); err != nil {
+			return fmt.Errorf("failed to create domain metrics table %s: %w", DomainHitsTable, err)
+		}
+	}
+
+	for _, frontendName := range parseFrontends(tags, frontends) {
+		if err := reconcileDomainHitsRuleIn(client, frontendName, backendName, hs.domainHitsRule(domainMapping, frontendName, backendName)); err != nil {
+			return err
+		}
+	}
+
+	result["domain_metrics"] = domainMapping.Domain
+	return nil
+}
+
+// reconcileDomainHitsRuleIn replaces the counting rule of a backend in a frontend if it differs from the desired one
+func reconcileDomainHitsRuleIn(client haproxy.ClientInterface, frontendName, backendName string, desired haproxy.HTTPRequestRule) error {
+	rules, err := client.GetHTTPRequestRules(haproxy.ParentTypeFrontend, frontendName)
+	if err != nil {
+		return fmt.Errorf("failed to get http-request rules of frontend %s: %w", frontendName, err)
+	}
+
+	index := findDomainHitsRule(rules, frontendName, backendName)
+	if index >= 0 && rules[index] == desired {
+		return nil
+	}
+
+	position := len(rules)
+	if index >= 0 {
+		if err := deleteHTTPRequestRules(client, frontendName, []int{index}); err != nil {
+			return fmt.Errorf("failed to remove outdated domain metrics rule from frontend %s: %w", frontendName, err)
+		}
+		position--
+	}
+
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for domain metrics rule: %w", err)
+	}
+	if err := client.CreateHTTPRequestRule(haproxy.ParentTypeFrontend, frontendName, position, &desired, version); err != nil {
+		return fmt.Errorf("failed to create domain metrics rule in frontend %s: %w", frontendName, err)
+	}
+	return nil
+}
+
+// removeDomainMetrics removes the counting rules of a service from its frontends. The table is
+// shared by all services and stays.
+func removeDomainMetrics(client haproxy.ClientInterface, backendName string, result map[string]string, frontends []string) {
+	var warnings []string
+	for _, frontendName := range frontends {
+		rules, err := client.GetHTTPRequestRules(haproxy.ParentTypeFrontend, frontendName)
+		if err == nil {
+			if index := findDomainHitsRule(rules, frontendName, backendName); index >= 0 {
+				err = deleteHTTPRequestRules(client, frontendName, []int{index})
+			}
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to remove domain metrics rule from %s: %v", frontendName, err))
+		}
+	}
+	if len(warnings) > 0 {
+		result["domain_metrics_warning"] = strings.Join(warnings, "; ")
+	}
+}
+
+// collectDomainHits reads the request counts of the domain rules in the given frontends from the
+// stick table, resolving the domain of every entry through the frontend's rules
+func collectDomainHits(client haproxy.ClientInterface, frontends []string) ([]DomainHits, error) {
+	entries, err := client.GetStickTableEntries(DomainHitsTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stick table %s: %w", DomainHitsTable, err)
+	}
+
+	domains := make(map[string]string)
+	for _, frontendName := range frontends {
+		rules, err := client.GetFrontendRules(frontendName)
+		if err != nil {
+			continue
+		}
+		for _, rule := range rules {
+			domains[domainHitsKey(frontendName, rule.Backend)] = rule.Domain
+		}
+	}
+
+	hits := make([]DomainHits, 0, len(entries))
+	for _, entry := range entries {
+		frontendName, backendName, ok := strings.Cut(entry.Key, "/")
+		if !ok || !containsString(frontends, frontendName) {
+			continue
+		}
+		hits = append(hits, DomainHits{
+			Frontend:    frontendName,
+			Domain:      domains[entry.Key], // empty once the rule is gone and until the entry expires
+			Backend:     backendName,
+			Requests:    entry.HTTPReqCnt,
+			RequestRate: entry.HTTPReqRate,
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Frontend != hits[j].Frontend {
+			return hits[i].Frontend < hits[j].Frontend
+		}
+		return hits[i].Domain < hits[j].Domain
+	})
+	return hits, nil
+}
@@ -0,0 +1,81 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestDomainHitsTableBackend(t *testing.T) {
+	table := domainHitsTableBackend()
+	if table.Name != DomainHitsTable || table.StickTable == nil || table.StickTable.Type != StickTableTypeString ||
+		table.StickTable.Store != "http_req_cnt,http_req_rate(60s)" {
+		t.Errorf("Unexpected domain metrics table: %+v", table)
+	}
+}
+
+func TestReconcileDomainMetrics(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{}
+	tags := []string{"haproxy.enable=true", "haproxy.domain=api.example.com", "haproxy.frontend=http,https"}
+
+	result := map[string]string{}
+	if err := hs.reconcileDomainMetrics(mock, "api", tags, "api", result, nil); err != nil {
+		t.Fatalf("reconcileDomainMetrics() failed: %v", err)
+	}
+
+	rules := mock.httpRequestRules["frontends/https"]
+	if len(rules) != 1 || rules[0].TrackSCKey != "str(https/api)" || rules[0].TrackSCStickCounter != DomainHitsStickCounter ||
+		rules[0].CondTest != "{ hdr(host) -i api.example.com }" {
+		t.Fatalf("Expected a track-sc1 rule for the domain, got %+v", rules)
+	}
+	if len(mock.httpRequestRules["frontends/http"]) != 1 || result["domain_metrics"] != "api.example.com" {
+		t.Errorf("Expected the rule in both frontends, got %+v (result %v)", mock.httpRequestRules, result)
+	}
+
+	// Reconciling again keeps the rule, removing the routing drops it
+	if err := hs.reconcileDomainMetrics(mock, "api", tags, "api", result, nil); err != nil {
+		t.Fatalf("reconcileDomainMetrics() failed: %v", err)
+	}
+	if len(mock.httpRequestRules["frontends/https"]) != 1 {
+		t.Fatalf("Expected the rule to be kept, got %+v", mock.httpRequestRules["frontends/https"])
+	}
+
+	removeDomainMetrics(mock, "api", result, []string{"http", "https"})
+	if len(mock.httpRequestRules["frontends/https"]) != 0 || len(mock.httpRequestRules["frontends/http"]) != 0 {
+		t.Errorf("Expected the rules to be removed, got %+v", mock.httpRequestRules)
+	}
+	if result["domain_metrics_warning"] != "" {
+		t.Errorf("Unexpected warning: %s", result["domain_metrics_warning"])
+	}
+}
+
+func TestCollectDomainHits(t *testing.T) {
+	mock := &mockHAProxyClient{
+		frontendRules: map[string][]haproxy.FrontendRule{
+			"https": {
+				{Domain: "api.example.com", Backend: "api"},
+				{Domain: "www.example.com", Backend: "web"},
+			},
+		},
+		stickTableEntries: map[string][]haproxy.StickTableEntry{
+			DomainHitsTable: {
+				{Key: "https/web", HTTPReqCnt: 120, HTTPReqRate: 4},
+				{Key: "https/api", HTTPReqCnt: 7, HTTPReqRate: 1},
+				{Key: "internal/admin", HTTPReqCnt: 3},
+			},
+		},
+	}
+
+	hits, err := collectDomainHits(mock, []string{"https"})
+	if err != nil {
+		t.Fatalf("collectDomainHits() failed: %v", err)
+	}
+	if len(hits) != 2 {
+		t.Fatalf("Expected the hits of the managed frontend only, got %+v", hits)
+	}
+	expected := DomainHits{Frontend: "https", Domain: "api.example.com", Backend: "api", Requests: 7, RequestRate: 1}
+	if hits[0] != expected || hits[1].Domain != "www.example.com" || hits[1].Requests != 120 {
+		t.Errorf("Unexpected domain hits: %+v", hits)
+	}
+}
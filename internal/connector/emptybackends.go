@@ -0,0 +1,181 @@
+package connector
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// KeepBackendTag keeps the backend of a service when its last server left, even with
+// haproxy.delete_empty_backends enabled
+const KeepBackendTag = "haproxy.backend.keep=true"
+
+// emptyBackendTracker schedules the deletion of empty backends, a registration in the backend
+// before the deletion is due cancels it
+type emptyBackendTracker struct {
+	mu      sync.Mutex
+	pending map[string]*pendingBackendDeletion
+	stopped bool
+
+	locks *keyedMutex
+	// deleted is called with the name of every backend deleted
+	deleted func(backendName string)
+}
+
+type pendingBackendDeletion struct {
+	timer *time.Timer
+}
+
+func newEmptyBackendTracker(locks *keyedMutex, deleted func(backendName string)) *emptyBackendTracker {
+	return &emptyBackendTracker{pending: make(map[string]*pendingBackendDeletion), locks: locks, deleted: deleted}
+}
+
+// schedule deletes the backend after delay unless it gets canceled before.
+// Scheduling a backend that is already pending restarts its grace period.
+func (t *emptyBackendTracker) schedule(
+	client haproxy.ClientInterface,
+	backendName string,
+	delay time.Duration,
+	logger *log.Logger,
+) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped {
+		return
+	}
+	if existing, ok := t.pending[backendName]; ok {
+		existing.timer.Stop()
+	}
+
+	deletion := &pendingBackendDeletion{}
+	deletion.timer = time.AfterFunc(delay, func() {
+		t.execute(client, backendName, deletion, logger)
+	})
+	t.pending[backendName] = deletion
+}
+
+// cancel aborts a pending deletion, returning true if one was pending
+func (t *emptyBackendTracker) cancel(backendName string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deletion, ok := t.pending[backendName]
+	if !ok {
+		return false
+	}
+	deletion.timer.Stop()
+	delete(t.pending, backendName)
+	return true
+}
+
+// stop cancels the pending deletions and ignores further ones once the leadership ends, a former
+// leader must not delete backends. The empty backends are left in place. Returns how many deletions
+// were pending.
+func (t *emptyBackendTracker) stop() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stopped = true
+	canceled := len(t.pending)
+	for backendName, deletion := range t.pending {
+		deletion.timer.Stop()
+		delete(t.pending, backendName)
+	}
+	return canceled
+}
+
+// has checks if the deletion of a backend is pending
+func (t *emptyBackendTracker) has(backendName string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.pending[backendName]
+	return ok
+}
+
+// take drops the pending deletion if it is still the scheduled one, a registration holding the
+// backend lock meanwhile may have canceled it
+func (t *emptyBackendTracker) take(backendName string, deletion *pendingBackendDeletion) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending[backendName] != deletion {
+		return false
+	}
+	delete(t.pending, backendName)
+	return true
+}
+
+// execute deletes the backend while holding the backend lock if it is still empty. Free server
+// slots don't count, they are deleted along with the backend, as are its HTTP checks.
+func (t *emptyBackendTracker) execute(
+	client haproxy.ClientInterface,
+	backendName string,
+	deletion *pendingBackendDeletion,
+	logger *log.Logger,
+) {
+	defer t.locks.lock(backendName)()
+	if !t.take(backendName, deletion) {
+		return
+	}
+
+	servers, err := client.GetServers(backendName)
+	if err != nil {
+		if !haproxy.IsNotFound(err) && logger != nil {
+			logger.Printf("Warning: failed to get servers of empty backend %s: %v", backendName, err)
+		}
+		return
+	}
+	for i := range servers {
+		if !isFreeSlot(&servers[i]) {
+			handlerLog.Debug("Keeping backend, servers registered meanwhile", "backend", backendName)
+			return
+		}
+	}
+
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		if logger != nil {
+			logger.Printf("Warning: failed to get config version for deletion of empty backend %s: %v", backendName, err)
+		}
+		return
+	}
+	if err := client.DeleteBackend(backendName, version); err != nil {
+		if logger != nil {
+			logger.Printf("Warning: failed to delete empty backend %s: %v", backendName, err)
+		}
+		return
+	}
+
+	t.deleted(backendName)
+	if logger != nil {
+		logger.Printf("Deleted backend %s after its last server left", backendName)
+	}
+}
+
+// scheduleEmptyBackendDeletion schedules the deletion of a backend whose last server is being
+// removed, once the server's drain period and the grace period are over
+func (hs *handlerState) scheduleEmptyBackendDeletion(
+	client haproxy.ClientInterface,
+	backendName string,
+	tags []string,
+	delay time.Duration,
+	logger *log.Logger,
+	result map[string]string,
+) {
+	if hasTag(tags, KeepBackendTag) {
+		result["backend_deletion"] = "kept"
+		return
+	}
+	hs.emptyBackends.schedule(client, backendName, delay, logger)
+	result["backend_deletion"] = "scheduled"
+}
+
+// cancelEmptyBackendDeletion keeps a backend a server registers in again
+func (hs *handlerState) cancelEmptyBackendDeletion(backendName string) {
+	if hs.emptyBackends.cancel(backendName) {
+		handlerLog.Debug("Canceled deletion of empty backend, server registered", "backend", backendName)
+	}
+}
@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// waitForDeletedBackends waits until the mock deleted the expected number of backends
+func waitForDeletedBackends(client *mockHAProxyClient, expected int) []string {
+	deadline := time.Now().Add(time.Second)
+	for {
+		client.mu.Lock()
+		deleted := append([]string{}, client.deletedBackends...)
+		client.mu.Unlock()
+		if len(deleted) >= expected || time.Now().After(deadline) {
+			return deleted
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEmptyBackendTracker_DeletesEmptyBackends(t *testing.T) {
+	tracker := newHandlerState().emptyBackends
+	client := &mockHAProxyClient{backendServers: map[string][]haproxy.Server{
+		"empty_web":    {{Name: "empty_web_slot1", Address: SlotPlaceholderAddress, Maintenance: MaintenanceEnabled}},
+		"occupied_web": {{Name: "occupied_web_10_0_0_1_80", Address: "10.0.0.1", Port: 80}},
+	}}
+
+	tracker.schedule(client, "empty_web", 10*time.Millisecond, nil)
+	tracker.schedule(client, "occupied_web", 10*time.Millisecond, nil)
+	tracker.schedule(client, "canceled_web", 10*time.Millisecond, nil)
+	if !tracker.cancel("canceled_web") {
+		t.Error("Expected cancel to report a pending deletion")
+	}
+
+	deleted := waitForDeletedBackends(client, 1)
+	time.Sleep(50 * time.Millisecond)
+	if len(deleted) != 1 || deleted[0] != "empty_web" {
+		t.Errorf("Expected only the backend with free slots to be deleted, got %v", deleted)
+	}
+	if tracker.has("empty_web") || tracker.has("occupied_web") {
+		t.Error("Expected executed deletions not to be pending anymore")
+	}
+}
+
+func TestEmptyBackendTracker_StopCancelsDeletions(t *testing.T) {
+	tracker := newHandlerState().emptyBackends
+	client := &mockHAProxyClient{backendServers: map[string][]haproxy.Server{"empty_web": {}}}
+
+	tracker.schedule(client, "empty_web", 10*time.Millisecond, nil)
+	if canceled := tracker.stop(); canceled != 1 {
+		t.Errorf("Expected 1 pending deletion to be canceled, got %d", canceled)
+	}
+	tracker.schedule(client, "empty_web", 10*time.Millisecond, nil)
+
+	time.Sleep(50 * time.Millisecond)
+	if deleted := waitForDeletedBackends(client, 0); len(deleted) != 0 || tracker.has("empty_web") {
+		t.Errorf("Expected no backend to be deleted after the leadership ended, got %v", deleted)
+	}
+}
+
+func TestDeregistrationSchedulesEmptyBackendDeletion(t *testing.T) {
+	hs := newHandlerState()
+	cfg := testConfig()
+	cfg.HAProxy.DeleteEmptyBackends = true
+	cfg.HAProxy.EmptyBackendGraceSec = 3600
+
+	deregister := func(serviceName string, tags []string) map[string]string {
+		t.Helper()
+		event := &ServiceEvent{
+			Type:    EventTypeServiceDeregistration,
+			Service: Service{ServiceName: serviceName, Address: "10.0.0.7", Port: 8080, Tags: tags},
+		}
+		result, err := hs.handleServiceDeregistrationWithDrainTimeout(context.Background(), &mockHAProxyClient{}, event, cfg, 0, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return result.(map[string]string)
+	}
+
+	result := deregister("empty-service", []string{"haproxy.enable=true"})
+	if result["backend_deletion"] != "scheduled" || !hs.emptyBackends.has("empty_service") {
+		t.Errorf("Expected the deletion of the empty backend to be scheduled, got %v", result)
+	}
+
+	// A registration keeps the backend
+	hs.cancelEmptyBackendDeletion("empty_service")
+	if hs.emptyBackends.has("empty_service") {
+		t.Error("Expected the registration to cancel the deletion")
+	}
+
+	result = deregister("kept-service", []string{"haproxy.enable=true", KeepBackendTag})
+	if result["backend_deletion"] != "kept" || hs.emptyBackends.has("kept_service") {
+		t.Errorf("Expected the backend of a service tagged %s to be kept, got %v", KeepBackendTag, result)
+	}
+}
@@ -0,0 +1,112 @@
+package connector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// eventOrderRetention is how long the last event of a service instance is remembered
+const eventOrderRetention = time.Hour
+
+// eventOrderGuard drops duplicated and re-ordered events, which Nomad can deliver after the event
+// stream reconnected. It remembers the last event accepted for every service instance, so a stale
+// deregistration can't remove the server a newer registration just added. The zero value is ready to use.
+type eventOrderGuard struct {
+	mu        sync.Mutex
+	instances map[string]acceptedEvent
+	skipped   int64
+	lastPrune time.Time
+}
+
+type acceptedEvent struct {
+	index    uint64
+	typ      string
+	accepted time.Time
+}
+
+// eventOrderKey identifies the service instance of an event by its registration and allocation
+func eventOrderKey(svc *nomad.Service) string {
+	if svc.ID == "" {
+		return ""
+	}
+	return svc.ID + "/" + svc.AllocID
+}
+
+// eventIndex returns the Raft index of an event, the modify index of its service if the event has none
+func eventIndex(event *nomad.ServiceEvent) uint64 {
+	return max(event.Index, event.Payload.Service.ModifyIndex)
+}
+
+// accept checks if an event is newer than the last one accepted for its service instance and records it.
+// Events without service ID or index can't be ordered and are always accepted.
+func (g *eventOrderGuard) accept(event *nomad.ServiceEvent) bool {
+	if event.Payload.Service == nil {
+		return true
+	}
+	key := eventOrderKey(event.Payload.Service)
+	index := eventIndex(event)
+	if key == "" || index == 0 {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.prune(now)
+	if last, ok := g.instances[key]; ok {
+		if index < last.index || (index == last.index && event.Type == last.typ) {
+			g.skipped++
+			return false
+		}
+	}
+	if g.instances == nil {
+		g.instances = make(map[string]acceptedEvent)
+	}
+	g.instances[key] = acceptedEvent{index: index, typ: event.Type, accepted: now}
+	return true
+}
+
+// prune forgets the instances whose last event is older than the retention. The caller holds mu.
+func (g *eventOrderGuard) prune(now time.Time) {
+	if now.Sub(g.lastPrune) < eventOrderRetention/10 {
+		return
+	}
+	g.lastPrune = now
+	for key, last := range g.instances {
+		if now.Sub(last.accepted) > eventOrderRetention {
+			delete(g.instances, key)
+		}
+	}
+}
+
+// skippedEvents returns the number of duplicated and stale events dropped so far
+func (g *eventOrderGuard) skippedEvents() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.skipped
+}
+
+// acceptEvent drops duplicated and stale events of the event stream
+func (c *Connector) acceptEvent(event *nomad.ServiceEvent) bool {
+	if c.eventOrder.accept(event) {
+		return true
+	}
+	svc := event.Payload.Service
+	c.logger.Printf("Skipping duplicated or stale %s for service %s at %s (index %d)",
+		event.Type, svc.ServiceName, hostPort(svc.Address, svc.Port), eventIndex(event))
+	return false
+}
+
+// acceptedEvents returns the events of a batch that are neither duplicated nor stale, in order
+func (c *Connector) acceptedEvents(events []nomad.ServiceEvent) []nomad.ServiceEvent {
+	accepted := events[:0]
+	for i := range events {
+		if c.acceptEvent(&events[i]) {
+			accepted = append(accepted, events[i])
+		}
+	}
+	return accepted
+}
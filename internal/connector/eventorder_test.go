@@ -0,0 +1,95 @@
+package connector
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func orderTestEvent(eventType string, index uint64) nomad.ServiceEvent {
+	return nomad.ServiceEvent{
+		Type:  eventType,
+		Index: index,
+		Payload: nomad.Payload{Service: &nomad.Service{
+			ID: "_nomad-task-a1-web-http", ServiceName: "web", AllocID: "a1", Address: "10.0.0.1", Port: 8080, ModifyIndex: 10,
+		}},
+	}
+}
+
+func TestEventOrderGuard(t *testing.T) {
+	var guard eventOrderGuard
+
+	steps := []struct {
+		name     string
+		event    nomad.ServiceEvent
+		accepted bool
+	}{
+		{name: "registration", event: orderTestEvent(EventTypeServiceRegistration, 10), accepted: true},
+		{name: "duplicated registration", event: orderTestEvent(EventTypeServiceRegistration, 10), accepted: false},
+		{name: "deregistration", event: orderTestEvent(EventTypeServiceDeregistration, 20), accepted: true},
+		{name: "stale registration", event: orderTestEvent(EventTypeServiceRegistration, 15), accepted: false},
+		{name: "newer registration", event: orderTestEvent(EventTypeServiceRegistration, 30), accepted: true},
+		{name: "stale deregistration", event: orderTestEvent(EventTypeServiceDeregistration, 20), accepted: false},
+	}
+	for _, step := range steps {
+		if accepted := guard.accept(&step.event); accepted != step.accepted {
+			t.Errorf("%s: accept() = %v, expected %v", step.name, accepted, step.accepted)
+		}
+	}
+	if skipped := guard.skippedEvents(); skipped != 3 {
+		t.Errorf("Expected 3 skipped events, got %d", skipped)
+	}
+
+	// Other instances are tracked on their own
+	other := orderTestEvent(EventTypeServiceDeregistration, 5)
+	other.Payload.Service.AllocID = "a2"
+	if !guard.accept(&other) {
+		t.Error("Expected the event of another allocation to be accepted")
+	}
+}
+
+func TestEventOrderGuard_AcceptsEventsWithoutIndex(t *testing.T) {
+	var guard eventOrderGuard
+
+	unordered := orderTestEvent(EventTypeServiceRegistration, 0)
+	unordered.Payload.Service.ModifyIndex = 0
+	noID := orderTestEvent(EventTypeServiceRegistration, 10)
+	noID.Payload.Service.ID = ""
+
+	for _, event := range []nomad.ServiceEvent{unordered, unordered, noID, noID, {Type: EventTypeServiceRegistration}} {
+		if !guard.accept(&event) {
+			t.Errorf("Expected event %+v to be accepted", event)
+		}
+	}
+}
+
+func TestEventOrderGuard_Prunes(t *testing.T) {
+	var guard eventOrderGuard
+	event := orderTestEvent(EventTypeServiceRegistration, 10)
+	guard.accept(&event)
+
+	guard.mu.Lock()
+	guard.prune(time.Now().Add(2 * eventOrderRetention))
+	remembered := len(guard.instances)
+	guard.mu.Unlock()
+	if remembered != 0 {
+		t.Errorf("Expected old instances to be forgotten, %d left", remembered)
+	}
+}
+
+func TestAcceptedEvents_FiltersBatch(t *testing.T) {
+	c := &Connector{logger: log.New(io.Discard, "", 0)}
+
+	batch := []nomad.ServiceEvent{
+		orderTestEvent(EventTypeServiceRegistration, 10),
+		orderTestEvent(EventTypeServiceDeregistration, 20),
+		orderTestEvent(EventTypeServiceRegistration, 10),
+	}
+	accepted := c.acceptedEvents(batch)
+	if len(accepted) != 2 || accepted[1].Type != EventTypeServiceDeregistration {
+		t.Errorf("Expected the stale registration to be dropped, got %+v", accepted)
+	}
+}
@@ -0,0 +1,226 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+// EventQueueState is the state key of the events left unprocessed by the previous run
+const EventQueueState = "event_queue.json"
+
+// eventQueuePersistInterval is how often a changed queue is persisted with sync.persist_queue
+const eventQueuePersistInterval = 5 * time.Second
+
+// eventQueue buffers the events between the event stream and their processing, so a burst larger
+// than the stream channel or a slow Data Plane API doesn't block the stream. Beyond its size the
+// oldest events are dropped and a resync is requested to catch up on them.
+type eventQueue struct {
+	mu          sync.Mutex
+	events      []nomad.ServiceEvent
+	overflowing bool // events were dropped since the queue was last below its size
+	changed     bool // not persisted since the last change
+
+	// Metrics
+	dropped       int64
+	highWatermark int
+}
+
+// eventQueueStats are the metrics of the event queue
+type eventQueueStats struct {
+	length        int
+	highWatermark int
+	dropped       int64
+}
+
+// run moves events from in to out until ctx is canceled, queueing them while out is busy.
+// onOverflow is called when events start being dropped.
+func (q *eventQueue) run(ctx context.Context, in <-chan nomad.ServiceEvent, out chan<- nomad.ServiceEvent, size int, onOverflow func()) {
+	for {
+		var send chan<- nomad.ServiceEvent
+		next, ok := q.peek()
+		if ok {
+			send = out
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-in:
+			if q.push(event, size) {
+				onOverflow()
+			}
+		case send <- next:
+			q.pop()
+		}
+	}
+}
+
+// push appends an event, dropping the oldest one if the queue is full. Returns true when the queue
+// starts overflowing.
+func (q *eventQueue) push(event nomad.ServiceEvent, size int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.changed = true
+	if size <= 0 {
+		size = config.DefaultSyncQueueSize
+	}
+	started := false
+	if len(q.events) >= size {
+		q.events = q.events[1:]
+		q.dropped++
+		started = !q.overflowing
+		q.overflowing = true
+	}
+	q.events = append(q.events, event)
+	if len(q.events) > q.highWatermark {
+		q.highWatermark = len(q.events)
+	}
+	return started
+}
+
+func (q *eventQueue) peek() (nomad.ServiceEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.events) == 0 {
+		return nomad.ServiceEvent{}, false
+	}
+	return q.events[0], true
+}
+
+func (q *eventQueue) pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.events) == 0 {
+		return
+	}
+	q.events = q.events[1:]
+	q.changed = true
+	if len(q.events) == 0 {
+		// Release the backing array of a burst and rearm the overflow warning
+		q.events = nil
+		q.overflowing = false
+	}
+}
+
+// snapshot returns a copy of the queued events and whether they changed since the last snapshot
+func (q *eventQueue) snapshot() (events []nomad.ServiceEvent, changed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	changed, q.changed = q.changed, false
+	return append([]nomad.ServiceEvent(nil), q.events...), changed
+}
+
+func (q *eventQueue) stats() eventQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return eventQueueStats{length: len(q.events), highWatermark: q.highWatermark, dropped: q.dropped}
+}
+
+// onEventQueueOverflow warns about dropped events and requests a resync to catch up on them
+func (c *Connector) onEventQueueOverflow() {
+	c.logger.Printf("Warning: Event queue is full (sync.queue_size %d), dropping the oldest events until a resync catches up",
+		c.cfg().Sync.QueueSize)
+	select {
+	case c.resyncRequests <- struct{}{}:
+	default: // a resync is already pending
+	}
+}
+
+// runEventQueuePersistence persists the unprocessed events whenever they changed, so events of a
+// killed process are replayed on the next start
+func (c *Connector) runEventQueuePersistence(ctx context.Context) {
+	ticker := time.NewTicker(eventQueuePersistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.persistEventQueue(false)
+		}
+	}
+}
+
+// persistEventQueue stores the events waiting in the queue and those held back by the circuit
+// breaker when sync.persist_queue is set. Unless forced, an unchanged queue isn't written again.
+func (c *Connector) persistEventQueue(force bool) {
+	if !c.cfg().Sync.PersistQueue {
+		return
+	}
+	queued, queueChanged := c.events.snapshot()
+	held, heldChanged := c.breaker.snapshot()
+	if !force && !queueChanged && !heldChanged {
+		return
+	}
+
+	// Held events arrived before the ones still queued
+	data, err := json.Marshal(append(held, queued...))
+	if err != nil {
+		c.logger.Printf("Warning: Failed to encode event queue: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+	if err := c.state.Put(ctx, EventQueueState, data); err != nil {
+		c.logger.Printf("Warning: Failed to persist event queue: %v", err)
+	}
+}
+
+// replayEventQueue applies the events the previous run (or leader) left unprocessed, before the
+// initial sync settles the final state. Registrations are skipped: the sync registers the instances
+// that are still there, while a replayed one could add a server that is long gone until the sync
+// removes it again. Deregistrations are replayed, the sync doesn't clean up the servers of a service
+// that disappeared completely. The persisted queue is cleared, so the events are replayed once.
+func (c *Connector) replayEventQueue(ctx context.Context) {
+	if !c.cfg().Sync.PersistQueue {
+		return
+	}
+	events, err := loadEventQueue(ctx, c.state)
+	if err != nil {
+		c.logger.Printf("Warning: Failed to load event queue: %v", err)
+		return
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	c.logger.Printf("Replaying %d events left unprocessed by the previous run", len(events))
+	for i := range events {
+		if ctx.Err() != nil {
+			return
+		}
+		if events[i].Type == EventTypeServiceRegistration {
+			continue
+		}
+		if c.acceptEvent(&events[i]) {
+			c.applyEvent(ctx, events[i])
+		}
+	}
+	c.persistEventQueue(true)
+}
+
+func loadEventQueue(ctx context.Context, store state.Store) ([]nomad.ServiceEvent, error) {
+	data, err := store.Get(ctx, EventQueueState)
+	if errors.Is(err, state.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var events []nomad.ServiceEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("invalid event queue state: %w", err)
+	}
+	return events, nil
+}
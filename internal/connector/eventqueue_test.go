@@ -0,0 +1,97 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+func TestEventQueue_DropsOldestBeyondSize(t *testing.T) {
+	var q eventQueue
+	overflows := 0
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if q.push(breakerEvent(name), 3) {
+			overflows++
+		}
+	}
+
+	events, _ := q.snapshot()
+	if len(events) != 3 || events[0].Payload.Service.ServiceName != "c" {
+		t.Fatalf("Expected the oldest events to be dropped, got %+v", events)
+	}
+	if overflows != 1 {
+		t.Errorf("Expected one overflow to be reported until the queue drains, got %d", overflows)
+	}
+	if stats := q.stats(); stats.length != 3 || stats.highWatermark != 3 || stats.dropped != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	for i := 0; i < 3; i++ {
+		q.pop()
+	}
+	q.push(breakerEvent("f"), 1)
+	if !q.push(breakerEvent("g"), 1) {
+		t.Error("Expected a drained queue to report the next overflow again")
+	}
+}
+
+func TestEventQueue_RunKeepsOrder(t *testing.T) {
+	var q eventQueue
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan nomad.ServiceEvent)
+	out := make(chan nomad.ServiceEvent)
+	go q.run(ctx, in, out, 10, func() { t.Error("Unexpected overflow") })
+
+	// Nothing is read from out yet, the stream must not block
+	names := []string{"a", "b", "c", "d"}
+	for _, name := range names {
+		select {
+		case in <- breakerEvent(name):
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the queue to accept events while processing is busy")
+		}
+	}
+
+	for _, name := range names {
+		event := <-out
+		if event.Payload.Service.ServiceName != name {
+			t.Fatalf("Expected event %s, got %s", name, event.Payload.Service.ServiceName)
+		}
+	}
+}
+
+func TestEventQueue_PersistAndReplay(t *testing.T) {
+	store := state.NewFileStore(t.TempDir())
+
+	c := breakerConnector(&mockHAProxyClient{})
+	c.config.Sync.PersistQueue = true
+	c.state = store
+	deregistration := breakerEvent("api")
+	deregistration.Type = EventTypeServiceDeregistration
+	c.events.push(breakerEvent("web"), 10)
+	c.events.push(deregistration, 10)
+	c.persistEventQueue(false)
+
+	events, err := loadEventQueue(context.Background(), store)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Expected 2 persisted events, got %+v (%v)", events, err)
+	}
+
+	// The next run replays the deregistration once, the initial sync covers the registration
+	next := breakerConnector(&mockHAProxyClient{})
+	next.config.Sync.PersistQueue = true
+	next.state = store
+	next.replayEventQueue(context.Background())
+
+	if next.processedEventCount() != 1 {
+		t.Errorf("Expected the persisted deregistration to be replayed, processed %d", next.processedEventCount())
+	}
+	if events, _ := loadEventQueue(context.Background(), store); len(events) != 0 {
+		t.Errorf("Expected the replayed events to be cleared, got %+v", events)
+	}
+}
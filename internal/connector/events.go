@@ -0,0 +1,116 @@
+package connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// Event output formats
+const (
+	EventFormatText = "text"
+	EventFormatJSON = "json"
+)
+
+// EventClassification describes how the connector handles a Nomad service event
+type EventClassification struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Service   string    `json:"service"`
+	Address   string    `json:"address"`
+	Port      int       `json:"port"`
+	AllocID   string    `json:"alloc_id,omitempty"`
+	Tags      []string  `json:"tags"`
+	Class     string    `json:"class"` // dynamic, custom or static
+	Backend   string    `json:"backend,omitempty"`
+	Server    string    `json:"server,omitempty"`
+	Domain    string    `json:"domain,omitempty"`
+	Frontends []string  `json:"frontends,omitempty"`
+	Action    string    `json:"action"`
+	Problems  []string  `json:"problems,omitempty"` // unknown and invalid haproxy.* tags
+}
+
+// ClassifyEvent explains what the connector does with a service event, using the same tag
+// parsing as the event handlers
+func ClassifyEvent(event *nomad.ServiceEvent, cfg *config.HAProxyConfig) EventClassification {
+	svc := event.Payload.Service
+	serviceEvent := toServiceEvent(event)
+	tags := serviceEvent.Service.Tags
+	spec := parseServiceSpec(svc.ServiceName, tags)
+
+	classification := EventClassification{
+		Time:    time.Now(),
+		Type:    event.Type,
+		Service: svc.ServiceName,
+		Address: svc.Address,
+		Port:    svc.Port,
+		AllocID: svc.AllocID,
+		Tags:    tags,
+		Class:   string(spec.Type),
+	}
+
+	if spec.Type == haproxy.ServiceTypeStatic {
+		classification.Action = "ignored: no haproxy.enable=true tag"
+		return classification
+	}
+
+	classification.Backend = spec.Backend
+	classification.Server = serviceServerName(&serviceEvent.Service)
+	classification.Problems = spec.Problems
+	if spec.Domain != nil {
+		classification.Domain = spec.Domain.Domain
+		classification.Frontends = parseFrontends(tags, serviceFrontends(svc.ServiceName, tags, cfg))
+	}
+
+	switch event.Type {
+	case EventTypeServiceRegistration:
+		classification.Action = "add server"
+		if spec.Type == haproxy.ServiceTypeCustom {
+			classification.Action = "add server to existing backend"
+		}
+		if spec.Canary {
+			classification.Action += fmt.Sprintf(" (canary, %d%% of traffic)", parseCanaryPercent(tags))
+		}
+		if registerOnHealthy(tags) {
+			classification.Action += " once the allocation is healthy"
+		}
+	case EventTypeServiceDeregistration, EventTypeNodeEvent, EventTypeNodeDeregistration:
+		classification.Action = "drain and remove server"
+	case EventTypeAllocationUpdated:
+		classification.Action = "drain and remove server, unless the allocation restarted in place"
+	default:
+		classification.Action = "skipped: unknown event type"
+	}
+	return classification
+}
+
+// WriteEvent renders a classified event as a line of text or JSON
+func WriteEvent(w io.Writer, event *EventClassification, format string) error {
+	switch format {
+	case EventFormatText, "":
+		line := fmt.Sprintf("%s %-22s %s %s [%s] %s", event.Time.Format(time.TimeOnly), event.Type,
+			event.Service, hostPort(event.Address, event.Port), event.Class, event.Action)
+		if event.Backend != "" {
+			line += fmt.Sprintf(" backend=%s server=%s", event.Backend, event.Server)
+		}
+		if event.Domain != "" {
+			line += fmt.Sprintf(" domain=%s frontends=%s", event.Domain, strings.Join(event.Frontends, ","))
+		}
+		line = fmt.Sprintf("%s\n    tags: %s", line, strings.Join(event.Tags, " "))
+		for _, problem := range event.Problems {
+			line += "\n    warning: " + problem
+		}
+		_, err := fmt.Fprintln(w, line)
+		return err
+	case EventFormatJSON:
+		return json.NewEncoder(w).Encode(event)
+	default:
+		return fmt.Errorf("unknown event format %q (expected text or json)", format)
+	}
+}
@@ -0,0 +1,91 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func classifyTestEvent(eventType string, tags []string) EventClassification {
+	event := nomad.ServiceEvent{
+		Type: eventType,
+		Payload: nomad.Payload{Service: &nomad.Service{
+			ServiceName: "web", Address: "10.0.0.1", Port: 8080, Tags: tags,
+		}},
+	}
+	return ClassifyEvent(&event, &config.HAProxyConfig{Frontend: "https"})
+}
+
+func TestClassifyEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		tags      []string
+		class     string
+		backend   string
+		domain    string
+		action    string
+	}{
+		{name: "not enabled", eventType: EventTypeServiceRegistration, tags: []string{"http"},
+			class: "static", action: "ignored: no haproxy.enable=true tag"},
+		{name: "dynamic with domain", eventType: EventTypeServiceRegistration,
+			tags:  []string{"haproxy.enable=true", "haproxy.domain=web.example.com"},
+			class: "dynamic", backend: "web", domain: "web.example.com", action: "add server"},
+		{name: "custom", eventType: EventTypeServiceRegistration, tags: []string{"haproxy.enable=true", "haproxy.backend=custom"},
+			class: "custom", backend: "web", action: "add server to existing backend"},
+		{name: "canary", eventType: EventTypeServiceRegistration, tags: []string{"haproxy.enable=true", "haproxy.canary.percent=10"},
+			class: "dynamic", backend: "web_canary", action: "add server (canary, 10% of traffic)"},
+		{name: "deregistration", eventType: EventTypeServiceDeregistration, tags: []string{"haproxy.enable=true"},
+			class: "dynamic", backend: "web", action: "drain and remove server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classification := classifyTestEvent(tt.eventType, tt.tags)
+			if classification.Class != tt.class || classification.Backend != tt.backend ||
+				classification.Domain != tt.domain || classification.Action != tt.action {
+				t.Errorf("Unexpected classification %+v", classification)
+			}
+		})
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	classification := classifyTestEvent(EventTypeServiceRegistration, []string{"haproxy.enable=true", "haproxy.domain=web.example.com"})
+
+	var text bytes.Buffer
+	if err := WriteEvent(&text, &classification, EventFormatText); err != nil {
+		t.Fatalf("WriteEvent() failed: %v", err)
+	}
+	for _, expected := range []string{"ServiceRegistration", "web 10.0.0.1:8080 [dynamic] add server", "domain=web.example.com frontends=https"} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, text.String())
+		}
+	}
+
+	var jsonOutput bytes.Buffer
+	if err := WriteEvent(&jsonOutput, &classification, EventFormatJSON); err != nil {
+		t.Fatalf("WriteEvent() failed: %v", err)
+	}
+	var decoded EventClassification
+	if err := json.Unmarshal(jsonOutput.Bytes(), &decoded); err != nil || decoded.Backend != "web" {
+		t.Errorf("Expected JSON classification, got %s (%v)", jsonOutput.String(), err)
+	}
+
+	typo := classifyTestEvent(EventTypeServiceRegistration, []string{"haproxy.enable=true", "haproxy.domian=web.example.com"})
+	text.Reset()
+	if err := WriteEvent(&text, &typo, EventFormatText); err != nil {
+		t.Fatalf("WriteEvent() failed: %v", err)
+	}
+	if !strings.Contains(text.String(), `warning: unknown tag "haproxy.domian=web.example.com"`) {
+		t.Errorf("Expected the unknown tag to be reported:\n%s", text.String())
+	}
+
+	if err := WriteEvent(&text, &classification, "yaml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
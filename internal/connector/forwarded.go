@@ -0,0 +1,61 @@
+package connector
+
+import (
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Forwarded header tags
+const (
+	ForwardforTag     = "haproxy.forwardfor="
+	ForwardedProtoTag = "haproxy.xfp="
+
+	ForwardedProtoHeader = "X-Forwarded-Proto"
+	ForwardedProtoAuto   = "auto"
+
+	// forwardedProtoFromConnection is the scheme the client connected with
+	forwardedProtoFromConnection = "%[ssl_fc,iif(https,http)]"
+)
+
+// applyForwardfor enables option forwardfor on the desired backend with haproxy.forwardfor=true,
+// so the service sees the client IP in X-Forwarded-For
+func applyForwardfor(backend *haproxy.Backend, tags []string) {
+	if isTCPMode(tags) || !hasTag(tags, ForwardforTag+"true") {
+		return
+	}
+	backend.Forwardfor = &haproxy.Forwardfor{Enabled: CheckEnabled}
+}
+
+// forwardforMatches checks if option forwardfor of the existing backend matches the desired one
+func forwardforMatches(existing, desired *haproxy.Backend) bool {
+	if existing.Forwardfor == nil || desired.Forwardfor == nil {
+		return existing.Forwardfor == desired.Forwardfor
+	}
+	return *existing.Forwardfor == *desired.Forwardfor
+}
+
+// withForwardedProto adds the X-Forwarded-Proto header of the haproxy.xfp tag to the request headers:
+// a fixed scheme (https, http) or auto for the scheme the client connected with. An explicit
+// haproxy.header.request.X-Forwarded-Proto tag takes precedence.
+func withForwardedProto(headers []headerValue, tags []string) []headerValue {
+	var value string
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, ForwardedProtoTag) {
+			value = strings.TrimPrefix(tag, ForwardedProtoTag)
+		}
+	}
+	if value == "" {
+		return headers
+	}
+	if value == ForwardedProtoAuto {
+		value = forwardedProtoFromConnection
+	}
+
+	for _, header := range headers {
+		if strings.EqualFold(header.Name, ForwardedProtoHeader) {
+			return headers
+		}
+	}
+	return sortHeaders(append(headers, headerValue{Name: ForwardedProtoHeader, Value: value}))
+}
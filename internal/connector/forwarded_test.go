@@ -0,0 +1,71 @@
+package connector
+
+import (
+	"testing"
+)
+
+func TestWithForwardedProto(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		expected []headerValue
+	}{
+		{name: "no tag", tags: []string{"haproxy.enable=true"}},
+		{
+			name:     "fixed scheme",
+			tags:     []string{"haproxy.xfp=https"},
+			expected: []headerValue{{Name: ForwardedProtoHeader, Value: "https"}},
+		},
+		{
+			name:     "scheme of the connection",
+			tags:     []string{"haproxy.xfp=auto"},
+			expected: []headerValue{{Name: ForwardedProtoHeader, Value: "%[ssl_fc,iif(https,http)]"}},
+		},
+		{
+			name:     "explicit header tag wins",
+			tags:     []string{"haproxy.xfp=https", "haproxy.header.request.X-Forwarded-Proto=http"},
+			expected: []headerValue{{Name: ForwardedProtoHeader, Value: "http"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := withForwardedProto(parseHeaders(tt.tags, RequestHeaderTagPrefix), tt.tags)
+			if !headersMatch(headers, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, headers)
+			}
+		})
+	}
+}
+
+func TestReconcileHeaders_ForwardedProto(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	tags := []string{"haproxy.enable=true", "haproxy.xfp=https", "haproxy.header.request.X-Forwarded-Prefix=/api"}
+
+	result := map[string]string{}
+	if err := reconcileHeaders(mock, "api", tags, result); err != nil {
+		t.Fatalf("reconcileHeaders() failed: %v", err)
+	}
+	rules := mock.httpRequestRules["backends/api"]
+	if len(rules) != 2 || rules[0].HdrName != "X-Forwarded-Prefix" || rules[1].HdrName != ForwardedProtoHeader || rules[1].HdrFormat != "https" {
+		t.Errorf("Expected both set-header rules sorted by name, got %+v", rules)
+	}
+}
+
+func TestBuildDesiredBackend_Forwardfor(t *testing.T) {
+	tags := []string{"haproxy.enable=true", "haproxy.forwardfor=true"}
+	desired := buildDesiredBackend("api", nil, tags)
+	if desired.Forwardfor == nil || desired.Forwardfor.Enabled != CheckEnabled {
+		t.Fatalf("Expected option forwardfor, got %+v", desired.Forwardfor)
+	}
+
+	plain := buildDesiredBackend("api", nil, []string{"haproxy.enable=true"})
+	if plain.Forwardfor != nil || backendConfigMatches(plain, desired, nil, nil) || backendConfigMatches(desired, plain, nil, nil) {
+		t.Error("Expected adding and removing the tag to update the backend")
+	}
+
+	tcp := buildDesiredBackend("db", nil, []string{"haproxy.enable=true", "haproxy.mode=tcp", "haproxy.forwardfor=true"})
+	if tcp.Forwardfor != nil {
+		t.Error("Expected no option forwardfor on tcp-mode backends")
+	}
+}
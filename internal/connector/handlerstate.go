@@ -0,0 +1,114 @@
+package connector
+
+import (
+	"context"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// handlerState is what the event handlers remember between events: pending removals and backend
+// deletions, the servers of allocations, the rules the connector owns and so on. The connector
+// starts a fresh one for every leadership, so nothing a previous leadership tracked leaks into the
+// next one; what has to survive a failover is persisted in the state store.
+type handlerState struct {
+	removals      *removalTracker
+	emptyBackends *emptyBackendTracker
+	allocations   *allocationTracker
+	registrations *registrationQueue
+	drainingNodes *nodeSet
+	ownedRules    *ownedRuleTracker
+	changes       *changeTracker
+
+	// locks serializes the mutations of a backend while changes to different backends run in parallel
+	locks *keyedMutex
+
+	// maintenance and paused are persisted by the connector and restored by the next leadership
+	maintenance *backendSet
+	paused      *pauseSet
+
+	// certificates and dnsRecords are nil unless ACME and DNS records are enabled
+	certificates *certificateManager
+	dnsRecords   *dnsManager
+
+	// rulesUnmanaged turns adding and removing domain rules into no-ops when routing is static
+	rulesUnmanaged bool
+	// hostMatch is how domain rules and host conditions read the Host header
+	hostMatch haproxy.HostMatch
+	// holdBack holds back the registration of an instance until its allocation is healthy, nil
+	// outside of a leadership
+	holdBack func(event *nomad.ServiceEvent) bool
+}
+
+func newHandlerState() *handlerState {
+	hs := &handlerState{
+		allocations:   newAllocationTracker(),
+		registrations: newRegistrationQueue(),
+		drainingNodes: newNodeSet(),
+		ownedRules:    newOwnedRuleTracker(),
+		changes:       &changeTracker{changes: make(map[string]time.Time)},
+		locks:         newKeyedMutex(),
+		maintenance:   newBackendSet(),
+		paused:        newPauseSet(),
+		hostMatch:     haproxy.HostMatchHeader,
+	}
+	hs.removals = newRemovalTracker(hs.locks)
+	hs.emptyBackends = newEmptyBackendTracker(hs.locks, hs.forgetBackend)
+	return hs
+}
+
+// forgetBackend drops what is tracked about a deleted backend
+func (hs *handlerState) forgetBackend(backendName string) {
+	hs.maintenance.remove(backendName)
+	hs.recordBackendChange(backendName)
+}
+
+type handlerStateKey struct{}
+
+// withHandlerState returns a context carrying the handler state of the current leadership
+func withHandlerState(ctx context.Context, hs *handlerState) context.Context {
+	return context.WithValue(ctx, handlerStateKey{}, hs)
+}
+
+// handlerStateFrom returns the handler state ctx carries. Callers outside of a leadership, such as
+// tests, get a fresh state for the call.
+func handlerStateFrom(ctx context.Context) *handlerState {
+	if hs, ok := ctx.Value(handlerStateKey{}).(*handlerState); ok {
+		return hs
+	}
+	return newHandlerState()
+}
+
+// currentHandlers returns the handler state of the current leadership. Before the first one, it is
+// an empty state the admin API reads from.
+func (c *Connector) currentHandlers() *handlerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.handlers == nil {
+		c.handlers = newHandlerState()
+	}
+	return c.handlers
+}
+
+// startHandlers replaces the handler state with a fresh one for a new leadership, set up from the
+// current configuration. Only the paused services are carried over.
+func (c *Connector) startHandlers() *handlerState {
+	hs := newHandlerState()
+	hs.paused = c.currentHandlers().paused
+	hs.rulesUnmanaged = !c.cfg().HAProxy.ManageFrontendRules
+	if c.cfg().HAProxy.HostMatch != "" {
+		hs.hostMatch = haproxy.HostMatch(c.cfg().HAProxy.HostMatch)
+	}
+
+	c.mu.Lock()
+	c.handlers = hs
+	c.mu.Unlock()
+	return hs
+}
+
+// handlerContext returns ctx carrying the handler state of the current leadership, for the calls of
+// the event handlers outside of the leader loop, such as a resync requested on the admin API
+func (c *Connector) handlerContext(ctx context.Context) context.Context {
+	return withHandlerState(ctx, c.currentHandlers())
+}
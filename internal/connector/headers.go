@@ -0,0 +1,179 @@
+package connector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Header injection constants
+const (
+	RequestHeaderTagPrefix  = "haproxy.header.request."
+	ResponseHeaderTagPrefix = "haproxy.header.response."
+	RuleTypeSetHeader       = "set-header"
+)
+
+// headerValue is a header set on requests or responses of a service's backend
+type headerValue struct {
+	Name  string
+	Value string
+}
+
+// parseHeaders reads the headers of tags like haproxy.header.request.X-Foo=bar, sorted by name.
+// The value may be empty and may itself contain "=".
+func parseHeaders(tags []string, prefix string) []headerValue {
+	var headers []headerValue
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(tag, prefix), "=")
+		if !ok || name == "" {
+			continue
+		}
+		headers = append(headers, headerValue{Name: name, Value: value})
+	}
+	return sortHeaders(headers)
+}
+
+// sortHeaders orders headers by name, the order their rules are installed in
+func sortHeaders(headers []headerValue) []headerValue {
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+// headersMatch checks if the existing set-header rules are exactly the desired headers
+func headersMatch(existing, desired []headerValue) bool {
+	if len(existing) != len(desired) {
+		return false
+	}
+	for i := range existing {
+		if existing[i] != desired[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcileHeaders installs the set-header rules of haproxy.header.request.* and haproxy.header.response.*
+// tags in the service's dynamic backend. The connector owns all set-header rules of dynamic backends, so
+// headers whose tag is gone are removed again; other http-request/http-response rules are kept.
+func reconcileHeaders(client haproxy.ClientInterface, backendName string, tags []string, result map[string]string) error {
+	requestHeaders := withForwardedProto(parseHeaders(tags, RequestHeaderTagPrefix), tags)
+	responseHeaders := parseHeaders(tags, ResponseHeaderTagPrefix)
+	tagged := len(requestHeaders) > 0 || len(responseHeaders) > 0
+
+	// Hand-written set-header rules of custom backends must survive
+	if classifyService(tags) != haproxy.ServiceTypeDynamic {
+		if tagged {
+			result["headers_warning"] = "header tags are only supported for dynamic backends"
+		}
+		return nil
+	}
+	if isTCPMode(tags) {
+		if tagged {
+			result["headers_warning"] = "header tags are ignored for tcp-mode backends"
+		}
+		return nil
+	}
+
+	if err := reconcileRequestHeaders(client, backendName, requestHeaders); err != nil {
+		return err
+	}
+	if err := reconcileResponseHeaders(client, backendName, responseHeaders); err != nil {
+		return err
+	}
+
+	if tagged {
+		result["headers"] = fmt.Sprintf("%d request, %d response", len(requestHeaders), len(responseHeaders))
+	}
+	return nil
+}
+
+// reconcileRequestHeaders replaces the http-request set-header rules of a backend if they differ from the desired headers
+func reconcileRequestHeaders(client haproxy.ClientInterface, backendName string, desired []headerValue) error {
+	rules, err := client.GetHTTPRequestRules(haproxy.ParentTypeBackend, backendName)
+	if err != nil {
+		return fmt.Errorf("failed to get http-request rules of backend %s: %w", backendName, err)
+	}
+
+	var indexes []int
+	var existing []headerValue
+	for i := range rules {
+		if rules[i].Type == RuleTypeSetHeader {
+			indexes = append(indexes, i)
+			existing = append(existing, headerValue{Name: rules[i].HdrName, Value: rules[i].HdrFormat})
+		}
+	}
+	if headersMatch(existing, desired) {
+		return nil
+	}
+
+	for i := len(indexes) - 1; i >= 0; i-- {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for header rule: %w", err)
+		}
+		if err := client.DeleteHTTPRequestRule(haproxy.ParentTypeBackend, backendName, indexes[i], version); err != nil {
+			return fmt.Errorf("failed to delete request header rule of backend %s: %w", backendName, err)
+		}
+	}
+
+	position := len(rules) - len(indexes)
+	for i, header := range desired {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for header rule: %w", err)
+		}
+		rule := &haproxy.HTTPRequestRule{Type: RuleTypeSetHeader, HdrName: header.Name, HdrFormat: header.Value}
+		if err := client.CreateHTTPRequestRule(haproxy.ParentTypeBackend, backendName, position+i, rule, version); err != nil {
+			return fmt.Errorf("failed to create request header rule %s in backend %s: %w", header.Name, backendName, err)
+		}
+	}
+	return nil
+}
+
+// reconcileResponseHeaders replaces the http-response set-header rules of a backend if they differ from the desired headers
+func reconcileResponseHeaders(client haproxy.ClientInterface, backendName string, desired []headerValue) error {
+	rules, err := client.GetHTTPResponseRules(haproxy.ParentTypeBackend, backendName)
+	if err != nil {
+		return fmt.Errorf("failed to get http-response rules of backend %s: %w", backendName, err)
+	}
+
+	var indexes []int
+	var existing []headerValue
+	for i := range rules {
+		if rules[i].Type == RuleTypeSetHeader {
+			indexes = append(indexes, i)
+			existing = append(existing, headerValue{Name: rules[i].HdrName, Value: rules[i].HdrFormat})
+		}
+	}
+	if headersMatch(existing, desired) {
+		return nil
+	}
+
+	for i := len(indexes) - 1; i >= 0; i-- {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for header rule: %w", err)
+		}
+		if err := client.DeleteHTTPResponseRule(haproxy.ParentTypeBackend, backendName, indexes[i], version); err != nil {
+			return fmt.Errorf("failed to delete response header rule of backend %s: %w", backendName, err)
+		}
+	}
+
+	position := len(rules) - len(indexes)
+	for i, header := range desired {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for header rule: %w", err)
+		}
+		rule := &haproxy.HTTPResponseRule{Type: RuleTypeSetHeader, HdrName: header.Name, HdrFormat: header.Value}
+		if err := client.CreateHTTPResponseRule(haproxy.ParentTypeBackend, backendName, position+i, rule, version); err != nil {
+			return fmt.Errorf("failed to create response header rule %s in backend %s: %w", header.Name, backendName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestParseHeaders(t *testing.T) {
+	tags := []string{
+		"haproxy.enable=true",
+		"haproxy.header.request.X-Forwarded-Prefix=/api",
+		"haproxy.header.request.X-Query=a=b",
+		"haproxy.header.request.X-Empty=",
+		"haproxy.header.request.=invalid",
+		"haproxy.header.response.Strict-Transport-Security=max-age=31536000",
+	}
+
+	request := parseHeaders(tags, RequestHeaderTagPrefix)
+	expected := []headerValue{{Name: "X-Empty"}, {Name: "X-Forwarded-Prefix", Value: "/api"}, {Name: "X-Query", Value: "a=b"}}
+	if !headersMatch(request, expected) {
+		t.Errorf("parseHeaders(request) = %+v, expected %+v", request, expected)
+	}
+
+	response := parseHeaders(tags, ResponseHeaderTagPrefix)
+	if len(response) != 1 || response[0].Value != "max-age=31536000" {
+		t.Errorf("parseHeaders(response) = %+v", response)
+	}
+}
+
+func TestReconcileHeaders(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	existing := haproxy.HTTPRequestRule{Type: "deny", CondTest: "{ path_beg /admin }"}
+	mock.httpRequestRules = map[string][]haproxy.HTTPRequestRule{
+		"backends/api": {existing, {Type: RuleTypeSetHeader, HdrName: "X-Stale", HdrFormat: "old"}},
+	}
+
+	tags := []string{
+		"haproxy.enable=true",
+		"haproxy.header.request.X-Forwarded-Prefix=/api",
+		"haproxy.header.response.X-Frame-Options=DENY",
+	}
+	result := map[string]string{}
+	if err := reconcileHeaders(mock, "api", tags, result); err != nil {
+		t.Fatalf("reconcileHeaders() failed: %v", err)
+	}
+
+	requestRules := mock.httpRequestRules["backends/api"]
+	if len(requestRules) != 2 || requestRules[0] != existing || requestRules[1].HdrName != "X-Forwarded-Prefix" || requestRules[1].HdrFormat != "/api" {
+		t.Errorf("Expected stale header replaced after the existing rule, got %+v", requestRules)
+	}
+	responseRules := mock.httpResponseRules["backends/api"]
+	if len(responseRules) != 1 || responseRules[0].Type != RuleTypeSetHeader || responseRules[0].HdrName != "X-Frame-Options" {
+		t.Errorf("Expected response header rule, got %+v", responseRules)
+	}
+	if result["headers"] != "1 request, 1 response" {
+		t.Errorf("Expected headers result, got %v", result)
+	}
+
+	// Removing the tags removes the managed rules but keeps the others
+	if err := reconcileHeaders(mock, "api", []string{"haproxy.enable=true"}, result); err != nil {
+		t.Fatalf("reconcileHeaders() failed: %v", err)
+	}
+	if rules := mock.httpRequestRules["backends/api"]; len(rules) != 1 || rules[0] != existing {
+		t.Errorf("Expected only the existing rule to remain, got %+v", rules)
+	}
+	if rules := mock.httpResponseRules["backends/api"]; len(rules) != 0 {
+		t.Errorf("Expected response header rule to be removed, got %+v", rules)
+	}
+}
+
+func TestReconcileHeadersCustomBackend(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	handWritten := haproxy.HTTPRequestRule{Type: RuleTypeSetHeader, HdrName: "X-Legacy", HdrFormat: "1"}
+	mock.httpRequestRules = map[string][]haproxy.HTTPRequestRule{"backends/legacy": {handWritten}}
+
+	tags := []string{"haproxy.enable=true", "haproxy.backend=custom", "haproxy.header.request.X-Foo=bar"}
+	result := map[string]string{}
+	if err := reconcileHeaders(mock, "legacy", tags, result); err != nil {
+		t.Fatalf("reconcileHeaders() failed: %v", err)
+	}
+
+	if rules := mock.httpRequestRules["backends/legacy"]; len(rules) != 1 || rules[0] != handWritten {
+		t.Errorf("Expected hand-written rules of custom backends to be kept, got %+v", rules)
+	}
+	if result["headers_warning"] == "" {
+		t.Errorf("Expected headers_warning for custom backend, got %v", result)
+	}
+}
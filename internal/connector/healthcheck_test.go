@@ -174,16 +174,17 @@ func TestConvertNomadToHAProxyCheck(t *testing.T) {
 			},
 		},
 		{
-			name: "HTTPS check maps to HTTP",
+			name: "HTTPS check maps to HTTP over TLS",
 			nomad: &nomad.ServiceCheck{
 				Type:   "https",
 				Path:   "/secure-health",
 				Method: "POST",
 			},
 			expected: &HealthCheckConfig{
-				Type:   "http",
-				Path:   "/secure-health",
-				Method: "POST",
+				Type:     "http",
+				Path:     "/secure-health",
+				Method:   "POST",
+				CheckTLS: CheckTLS{SSL: true, Verify: SSLVerifyRequired},
 			},
 		},
 		{
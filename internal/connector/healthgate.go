@@ -0,0 +1,176 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// Registration gating tag
+const (
+	RegisterOnTag     = "haproxy.register.on="
+	RegisterOnRunning = "running" // add the server as soon as the instance registers (default)
+	RegisterOnHealthy = "healthy" // add the server once the checks of the allocation pass
+)
+
+// StatusHeldBack is the sync result of an instance whose registration waits for a healthy allocation
+const StatusHeldBack = "held_back"
+
+var (
+	// registerHealthyPollInterval is how often the health of a held back registration is checked
+	registerHealthyPollInterval = 2 * time.Second
+	// registerHealthyTimeout is how long a registration is waited for at most, a later resync checks
+	// the health again and adds the server once the allocation is healthy
+	registerHealthyTimeout = 10 * time.Minute
+)
+
+// allocationHealthChecker is implemented by Nomad clients that can report the health of an allocation
+type allocationHealthChecker interface {
+	AllocationHealthy(allocID, serviceName string) (bool, error)
+}
+
+// registerOnHealthy checks if the service asked to be added once its allocation is healthy
+func registerOnHealthy(tags []string) bool {
+	return hasTag(tags, RegisterOnTag+RegisterOnHealthy)
+}
+
+// healthWaits tracks the registrations held back until their allocation is healthy, by instance.
+// The zero value is ready to use.
+type healthWaits struct {
+	mu      sync.Mutex
+	waiting map[string]*healthWait
+}
+
+type healthWait struct {
+	cancel context.CancelFunc
+}
+
+// start registers a wait for an instance, false if the instance is already waited for
+func (h *healthWaits) start(key string, wait *healthWait) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.waiting[key]; ok {
+		return false
+	}
+	if h.waiting == nil {
+		h.waiting = make(map[string]*healthWait)
+	}
+	h.waiting[key] = wait
+	return true
+}
+
+// done removes the wait of an instance, unless it was replaced meanwhile
+func (h *healthWaits) done(key string, wait *healthWait) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.waiting[key] == wait {
+		delete(h.waiting, key)
+	}
+}
+
+// cancel stops waiting for an instance, e.g. because it deregistered
+func (h *healthWaits) cancel(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	wait, ok := h.waiting[key]
+	if ok {
+		wait.cancel()
+		delete(h.waiting, key)
+	}
+	return ok
+}
+
+// deferUntilHealthy holds back the registration of an instance tagged haproxy.register.on=healthy
+// until the checks of its allocation pass, then hands the event to the event loop again. A
+// deregistration ends the wait. Returns true if the event was held back.
+func (c *Connector) deferUntilHealthy(ctx context.Context, event *nomad.ServiceEvent) bool {
+	svc := event.Payload.Service
+	if svc == nil {
+		return false
+	}
+	key := eventInstanceKey(event)
+	if event.Type != EventTypeServiceRegistration {
+		if c.healthWaits.cancel(key) {
+			c.logger.Printf("Stopped waiting for %s to become healthy: %s", key, event.Type)
+		}
+		return false
+	}
+
+	checker, ok := primaryDiscovery(c.nomadClient).(allocationHealthChecker)
+	if sources, combined := c.nomadClient.(*discoverySources); ok && combined {
+		// Allocations of further Nomad clusters are asked there
+		checker = sources
+	}
+	if !ok || svc.AllocID == "" || !registerOnHealthy(serviceTags(svc.Tags, svc.Meta)) {
+		return false
+	}
+	healthy, err := checker.AllocationHealthy(svc.AllocID, svc.ServiceName)
+	if err != nil {
+		// Without the health the server is added right away, HAProxy's own checks still apply
+		c.logger.Printf("Warning: Failed to get health of allocation %s, registering %s now: %v", svc.AllocID, key, err)
+		return false
+	}
+	if healthy {
+		return false
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, registerHealthyTimeout)
+	wait := &healthWait{cancel: cancel}
+	if !c.healthWaits.start(key, wait) {
+		cancel()
+		return true
+	}
+	c.logger.Printf("Holding back registration of %s until allocation %s is healthy", key, svc.AllocID)
+	go c.waitUntilHealthy(waitCtx, key, wait, *event, checker)
+	return true
+}
+
+// waitUntilHealthy polls the health of a held back registration and queues the event again once healthy
+func (c *Connector) waitUntilHealthy(
+	ctx context.Context,
+	key string,
+	wait *healthWait,
+	event nomad.ServiceEvent,
+	checker allocationHealthChecker,
+) {
+	defer wait.cancel()
+
+	ticker := time.NewTicker(registerHealthyPollInterval)
+	defer ticker.Stop()
+	svc := event.Payload.Service
+	for {
+		select {
+		case <-ctx.Done():
+			c.healthWaits.done(key, wait)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				c.logger.Printf("Warning: Allocation %s did not become healthy within %s, %s is not registered until a resync finds it healthy",
+					svc.AllocID, registerHealthyTimeout, key)
+			}
+			return
+		case <-ticker.C:
+			if healthy, err := checker.AllocationHealthy(svc.AllocID, svc.ServiceName); err != nil || !healthy {
+				continue
+			}
+			// Done before queueing, so the event is held back again should the allocation turn unhealthy
+			c.healthWaits.done(key, wait)
+			select {
+			case c.healthyEvents <- event:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}
+}
+
+// heldBackUntilHealthy applies the haproxy.register.on=healthy gate to the registrations of a sync,
+// so a sync or resync doesn't add an instance whose allocation isn't healthy yet; it is waited for
+// like a registration event instead. Servers already in HAProxy are kept. Outside of a leadership
+// nothing is held back.
+func (hs *handlerState) heldBackUntilHealthy(event *nomad.ServiceEvent) bool {
+	return hs.holdBack != nil && hs.holdBack(event)
+}
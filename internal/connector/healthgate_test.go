@@ -0,0 +1,171 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// healthNomadClient reports a configurable allocation health
+type healthNomadClient struct {
+	fakeNomadClient
+	mu      sync.Mutex
+	healthy bool
+	err     error
+}
+
+func (f *healthNomadClient) AllocationHealthy(allocID, serviceName string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.healthy, f.err
+}
+
+func (f *healthNomadClient) setHealthy(healthy bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.healthy = healthy
+}
+
+func healthGateConnector(t *testing.T, nomadClient nomad.NomadClient) *Connector {
+	previousInterval := registerHealthyPollInterval
+	t.Cleanup(func() { registerHealthyPollInterval = previousInterval })
+	registerHealthyPollInterval = 10 * time.Millisecond
+
+	return &Connector{
+		config:        testConfig(),
+		haproxyClient: &mockHAProxyClient{},
+		nomadClient:   nomadClient,
+		history:       newEventHistory(10),
+		healthyEvents: make(chan nomad.ServiceEvent, 1),
+		logger:        log.New(io.Discard, "", 0),
+	}
+}
+
+func healthGateEvent(eventType string, tags ...string) nomad.ServiceEvent {
+	return nomad.ServiceEvent{
+		Type: eventType,
+		Payload: nomad.Payload{Service: &nomad.Service{
+			ServiceName: "web", Address: "10.0.0.1", Port: 8080, AllocID: "a1", Tags: tags,
+		}},
+	}
+}
+
+func (c *Connector) processedEventCount() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.processedEvents
+}
+
+func TestRegistrationHeldBackUntilHealthy(t *testing.T) {
+	nomadClient := &healthNomadClient{}
+	c := healthGateConnector(t, nomadClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	event := healthGateEvent(EventTypeServiceRegistration, "haproxy.enable=true", RegisterOnTag+RegisterOnHealthy)
+	c.processEvent(ctx, event)
+	if c.processedEventCount() != 0 {
+		t.Fatal("Expected the registration of an unhealthy allocation to be held back")
+	}
+
+	// A repeated registration doesn't start a second wait
+	c.processEvent(ctx, event)
+
+	nomadClient.setHealthy(true)
+	select {
+	case queued := <-c.healthyEvents:
+		c.processEvent(ctx, queued)
+	case <-time.After(time.Second):
+		t.Fatal("Expected the registration to be queued once the allocation is healthy")
+	}
+	if c.processedEventCount() != 1 {
+		t.Errorf("Expected the registration to be processed once healthy, processed %d", c.processedEventCount())
+	}
+	select {
+	case <-c.healthyEvents:
+		t.Error("Expected the registration to be queued only once")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeregistrationStopsWaitingForHealth(t *testing.T) {
+	nomadClient := &healthNomadClient{}
+	c := healthGateConnector(t, nomadClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.processEvent(ctx, healthGateEvent(EventTypeServiceRegistration, "haproxy.enable=true", RegisterOnTag+RegisterOnHealthy))
+	c.processEvent(ctx, healthGateEvent(EventTypeServiceDeregistration, "haproxy.enable=true", RegisterOnTag+RegisterOnHealthy))
+
+	nomadClient.setHealthy(true)
+	select {
+	case <-c.healthyEvents:
+		t.Error("Expected no registration after the instance deregistered")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if c.processedEventCount() != 1 {
+		t.Errorf("Expected only the deregistration to be processed, processed %d", c.processedEventCount())
+	}
+}
+
+func TestRegistrationNotHeldBack(t *testing.T) {
+	tests := []struct {
+		name        string
+		nomadClient nomad.NomadClient
+		tags        []string
+	}{
+		{name: "without tag", nomadClient: &healthNomadClient{}, tags: []string{"haproxy.enable=true"}},
+		{name: "register on running", nomadClient: &healthNomadClient{},
+			tags: []string{"haproxy.enable=true", RegisterOnTag + RegisterOnRunning}},
+		{name: "healthy", nomadClient: &healthNomadClient{healthy: true},
+			tags: []string{"haproxy.enable=true", RegisterOnTag + RegisterOnHealthy}},
+		{name: "health unknown", nomadClient: &healthNomadClient{err: errors.New("connection refused")},
+			tags: []string{"haproxy.enable=true", RegisterOnTag + RegisterOnHealthy}},
+		{name: "client without health", nomadClient: &fakeNomadClient{},
+			tags: []string{"haproxy.enable=true", RegisterOnTag + RegisterOnHealthy}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := healthGateConnector(t, tt.nomadClient)
+			c.processEvent(context.Background(), healthGateEvent(EventTypeServiceRegistration, tt.tags...))
+			if c.processedEventCount() != 1 {
+				t.Error("Expected the registration to be processed right away")
+			}
+		})
+	}
+}
+
+func TestResyncHoldsBackUnhealthyAllocations(t *testing.T) {
+	event := healthGateEvent(EventTypeServiceRegistration, "haproxy.enable=true", RegisterOnTag+RegisterOnHealthy)
+	nomadClient := &healthNomadClient{fakeNomadClient: fakeNomadClient{services: []*nomad.Service{event.Payload.Service}}}
+	c := healthGateConnector(t, nomadClient)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hs := newHandlerState()
+	hs.holdBack = func(event *nomad.ServiceEvent) bool { return c.deferUntilHealthy(ctx, event) }
+	synced, _, err := SyncAndCleanupStaleServers(withHandlerState(ctx, hs), c.haproxyClient, nomadClient, c.logger, c.cfg())
+	if err != nil {
+		t.Fatalf("SyncAndCleanupStaleServers() failed: %v", err)
+	}
+	if synced != 0 {
+		t.Fatalf("Expected the instance of the unhealthy allocation to be held back by the resync, %d synced", synced)
+	}
+
+	nomadClient.setHealthy(true)
+	select {
+	case healthy := <-c.healthyEvents:
+		if healthy.Payload.Service.AllocID != "a1" {
+			t.Errorf("Unexpected event: %+v", healthy)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the held back instance to be registered once healthy")
+	}
+}
@@ -0,0 +1,188 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+// History constants
+const (
+	// HistoryAction is the service API action returning the event history of a service
+	HistoryAction = "history"
+
+	// EventHistoryState is the state key the event history is persisted under
+	EventHistoryState = "event_history.json"
+)
+
+// HistoryEntry is a processed event of a service together with what the connector did about it
+type HistoryEntry struct {
+	Time    time.Time         `json:"time"`
+	Event   string            `json:"event"`
+	Address string            `json:"address,omitempty"`
+	Port    int               `json:"port,omitempty"`
+	Status  string            `json:"status,omitempty"`
+	Result  map[string]string `json:"result,omitempty"` // everything the handler reported, e.g. backend, server, frontend_rule
+	Error   string            `json:"error,omitempty"`
+}
+
+// ServiceHistory is the response of GET /api/v1/services/{name}/history
+type ServiceHistory struct {
+	Service string         `json:"service"`
+	Events  []HistoryEntry `json:"events"`
+}
+
+// eventHistory keeps the last events of every service, oldest first
+type eventHistory struct {
+	mu       sync.Mutex
+	size     int
+	services map[string][]HistoryEntry
+}
+
+func newEventHistory(size int) *eventHistory {
+	return &eventHistory{size: size, services: make(map[string][]HistoryEntry)}
+}
+
+// record appends an entry to the service's history, dropping the oldest beyond the history size
+func (h *eventHistory) record(serviceName string, entry HistoryEntry) {
+	if h == nil || h.size <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := append(h.services[serviceName], entry)
+	if len(entries) > h.size {
+		entries = append([]HistoryEntry(nil), entries[len(entries)-h.size:]...)
+	}
+	h.services[serviceName] = entries
+}
+
+// recordEvent records the outcome of processing a Nomad event
+func (h *eventHistory) recordEvent(event *nomad.ServiceEvent, result interface{}, err error) {
+	svc := event.Payload.Service
+	if svc == nil {
+		return
+	}
+
+	h.record(svc.ServiceName, newHistoryEntry(event.Type, svc.Address, svc.Port, result, err))
+}
+
+// recordBatchEvent records the outcome of a batched registration for one of its events
+func (h *eventHistory) recordBatchEvent(event *ServiceEvent, result map[string]string, err error) {
+	h.record(event.Service.ServiceName, newHistoryEntry(event.Type, event.Service.Address, event.Service.Port, result, err))
+}
+
+func newHistoryEntry(eventType, address string, port int, result interface{}, err error) HistoryEntry {
+	entry := HistoryEntry{Time: time.Now(), Event: eventType, Address: address, Port: port}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if resultMap, ok := result.(map[string]string); ok && resultMap != nil {
+		entry.Status = resultMap["status"]
+		entry.Result = make(map[string]string, len(resultMap))
+		for key, value := range resultMap {
+			entry.Result[key] = value
+		}
+	}
+	return entry
+}
+
+// get returns a copy of the service's history
+func (h *eventHistory) get(serviceName string) []HistoryEntry {
+	if h == nil {
+		return []HistoryEntry{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]HistoryEntry{}, h.services[serviceName]...)
+}
+
+// save persists the history of all services
+func (h *eventHistory) save(ctx context.Context, store state.Store) error {
+	h.mu.Lock()
+	data, err := json.Marshal(h.services)
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, EventHistoryState, data)
+}
+
+// load restores the history persisted by a previous run, keeping the entries recorded since
+func (h *eventHistory) load(ctx context.Context, store state.Store) error {
+	data, err := store.Get(ctx, EventHistoryState)
+	if errors.Is(err, state.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var services map[string][]HistoryEntry
+	if err := json.Unmarshal(data, &services); err != nil {
+		return fmt.Errorf("invalid event history state: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for serviceName, entries := range services {
+		entries = append(entries, h.services[serviceName]...)
+		if len(entries) > h.size {
+			entries = entries[len(entries)-h.size:]
+		}
+		h.services[serviceName] = entries
+	}
+	return nil
+}
+
+// restoreHistory loads the history persisted by the previous run when history.persist is set
+func (c *Connector) restoreHistory(ctx context.Context) {
+	if !c.cfg().History.Persist {
+		return
+	}
+	if err := c.history.load(ctx, c.state); err != nil {
+		c.logger.Printf("Warning: Failed to load event history: %v", err)
+	}
+}
+
+// persistHistory stores the history for the next run when history.persist is set
+func (c *Connector) persistHistory() {
+	if !c.cfg().History.Persist {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+
+	if err := c.history.save(ctx, c.state); err != nil {
+		c.logger.Printf("Warning: Failed to persist event history: %v", err)
+	}
+}
+
+// handleServiceHistory serves GET /api/v1/services/{name}/history
+func (c *Connector) handleServiceHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, ServiceAPIPrefix), "/"), "/")
+	if len(parts) != 2 || parts[1] != HistoryAction {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, ServiceHistory{Service: parts[0], Events: c.history.get(parts[0])})
+}
+
+// isHistoryRequest checks if a service API request asks for the event history
+func isHistoryRequest(r *http.Request) bool {
+	return strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/"+HistoryAction)
+}
@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+func TestEventHistory_Bounded(t *testing.T) {
+	history := newEventHistory(3)
+	for _, event := range []string{"a", "b", "c", "d", "e"} {
+		history.record("web", HistoryEntry{Event: event})
+	}
+
+	entries := history.get("web")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Event != "c" || entries[2].Event != "e" {
+		t.Errorf("Expected the oldest entries to be dropped, got %+v", entries)
+	}
+	if len(history.get("api")) != 0 {
+		t.Error("Expected no history for an unknown service")
+	}
+}
+
+func TestEventHistory_Disabled(t *testing.T) {
+	history := newEventHistory(0)
+	history.record("web", HistoryEntry{Event: "ServiceRegistration"})
+	if len(history.get("web")) != 0 {
+		t.Error("Expected a history size of 0 to disable the history")
+	}
+}
+
+func TestEventHistory_RecordEvent(t *testing.T) {
+	history := newEventHistory(10)
+	event := &nomad.ServiceEvent{
+		Type:    "ServiceRegistration",
+		Payload: nomad.Payload{Service: &nomad.Service{ServiceName: "web", Address: "10.0.0.1", Port: 8080}},
+	}
+
+	history.recordEvent(event, map[string]string{"status": StatusCreated, "backend": "web"}, nil)
+	history.recordEvent(event, nil, errors.New("backend locked"))
+
+	entries := history.get("web")
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Status != StatusCreated || entries[0].Result["backend"] != "web" || entries[0].Address != "10.0.0.1" {
+		t.Errorf("Unexpected entry of the processed event: %+v", entries[0])
+	}
+	if entries[1].Error != "backend locked" {
+		t.Errorf("Expected the error to be recorded, got %+v", entries[1])
+	}
+}
+
+func TestHandleServiceHistory(t *testing.T) {
+	c := &Connector{history: newEventHistory(10)}
+	c.history.record("web", HistoryEntry{Event: "ServiceRegistration", Status: StatusCreated})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, ServiceAPIPrefix+"web/history", http.NoBody)
+	if !isHistoryRequest(request) {
+		t.Fatal("Expected a history request")
+	}
+	c.handleServiceHistory(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+
+	var history ServiceHistory
+	if err := json.Unmarshal(recorder.Body.Bytes(), &history); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if history.Service != "web" || len(history.Events) != 1 || history.Events[0].Status != StatusCreated {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+
+	recorder = httptest.NewRecorder()
+	c.handleServiceHistory(recorder, httptest.NewRequest(http.MethodPost, ServiceAPIPrefix+"web/history", http.NoBody))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", recorder.Code)
+	}
+}
+
+func TestEventHistory_SaveLoad(t *testing.T) {
+	store := state.NewFileStore(t.TempDir())
+	ctx := context.Background()
+
+	previous := newEventHistory(3)
+	previous.record("web", HistoryEntry{Event: "a"})
+	previous.record("web", HistoryEntry{Event: "b"})
+	if err := previous.save(ctx, store); err != nil {
+		t.Fatalf("save() failed: %v", err)
+	}
+
+	// Events recorded before the persisted history was loaded are kept as the newest
+	history := newEventHistory(3)
+	history.record("web", HistoryEntry{Event: "c"})
+	history.record("web", HistoryEntry{Event: "d"})
+	if err := history.load(ctx, store); err != nil {
+		t.Fatalf("load() failed: %v", err)
+	}
+
+	entries := history.get("web")
+	if len(entries) != 3 || entries[0].Event != "b" || entries[2].Event != "d" {
+		t.Errorf("Unexpected merged history: %+v", entries)
+	}
+}
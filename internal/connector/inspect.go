@@ -0,0 +1,236 @@
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// Admin API paths for inspection and manual actions
+const (
+	ServicesAPIPath     = "/api/v1/services"
+	DiffAPIPath         = "/api/v1/diff"
+	ResyncAPIPath       = "/api/v1/resync"
+	RecentEventsAPIPath = "/api/v1/events/recent"
+
+	// DefaultRecentEvents is the number of events /api/v1/events/recent returns without ?limit
+	DefaultRecentEvents = 50
+)
+
+// ManagedService is a haproxy-enabled Nomad service as listed by GET /api/v1/services
+type ManagedService struct {
+	Name      string   `json:"name"`
+	Backend   string   `json:"backend"`
+	Domain    string   `json:"domain,omitempty"`
+	Instances []string `json:"instances"` // address:port of the instances registered in Nomad
+	Servers   int      `json:"servers"`   // servers of the backend in HAProxy
+	Paused    bool     `json:"paused,omitempty"`
+}
+
+// BackendDrift lists how the servers of a backend differ from the instances registered in Nomad
+type BackendDrift struct {
+	Backend string   `json:"backend"`
+	Missing []string `json:"missing,omitempty"` // registered in Nomad, not in HAProxy
+	Stale   []string `json:"stale,omitempty"`   // in HAProxy, no longer registered in Nomad
+}
+
+// ResyncResult is the response of POST /api/v1/resync
+type ResyncResult struct {
+	Synced   int    `json:"synced"`
+	Removed  int    `json:"removed"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RecentEvent is a history entry together with its service, as listed by GET /api/v1/events/recent
+type RecentEvent struct {
+	Service string `json:"service"`
+	HistoryEntry
+}
+
+// listManagedServices groups the haproxy-enabled instances registered in Nomad by service
+func (hs *handlerState) listManagedServices(client haproxy.ClientInterface, nomadClient nomad.NomadClient) ([]ManagedService, error) {
+	services, err := nomadClient.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*ManagedService)
+	for _, svc := range services {
+		tags := serviceTags(svc.Tags, svc.Meta)
+		if !hasTag(tags, "haproxy.enable=true") {
+			continue
+		}
+		managed, ok := byName[svc.ServiceName]
+		if !ok {
+			managed = &ManagedService{Name: svc.ServiceName, Backend: serviceBackendName(svc.ServiceName, tags), Instances: []string{}}
+			managed.Paused = hs.isPaused(svc.ServiceName, tags)
+			if domainMapping := parseDomainMapping(svc.ServiceName, tags); domainMapping != nil {
+				managed.Domain = domainMapping.Domain
+			}
+			byName[svc.ServiceName] = managed
+		}
+		managed.Instances = append(managed.Instances, hostPort(svc.Address, svc.Port))
+	}
+
+	result := make([]ManagedService, 0, len(byName))
+	for _, managed := range byName {
+		servers, err := client.GetServers(managed.Backend)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get servers of backend %s: %w", managed.Backend, err)
+		}
+		managed.Servers = len(servers)
+		sort.Strings(managed.Instances)
+		result = append(result, *managed)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// serverDrift lists the backends whose servers differ from the expected ones
+func serverDrift(client haproxy.ClientInterface, expectedServersByBackend map[string]map[string]bool) ([]BackendDrift, error) {
+	drift := []BackendDrift{}
+	for backendName, expectedServers := range expectedServersByBackend {
+		servers, err := client.GetServers(backendName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get servers of backend %s: %w", backendName, err)
+		}
+
+		backendDrift := BackendDrift{Backend: backendName}
+		found := make(map[string]bool, len(servers))
+		for _, server := range servers {
+			found[server.Name] = true
+			if !expectedServers[server.Name] {
+				backendDrift.Stale = append(backendDrift.Stale, server.Name)
+			}
+		}
+		for serverName := range expectedServers {
+			if !found[serverName] {
+				backendDrift.Missing = append(backendDrift.Missing, serverName)
+			}
+		}
+
+		if len(backendDrift.Missing) > 0 || len(backendDrift.Stale) > 0 {
+			sort.Strings(backendDrift.Missing)
+			sort.Strings(backendDrift.Stale)
+			drift = append(drift, backendDrift)
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Backend < drift[j].Backend })
+	return drift, nil
+}
+
+// recent returns the last events of all services, newest first
+func (h *eventHistory) recent(limit int) []RecentEvent {
+	events := []RecentEvent{}
+	if h == nil {
+		return events
+	}
+	h.mu.Lock()
+	for serviceName, entries := range h.services {
+		for _, entry := range entries {
+			events = append(events, RecentEvent{Service: serviceName, HistoryEntry: entry})
+		}
+	}
+	h.mu.Unlock()
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.After(events[j].Time) })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events
+}
+
+// handleServices serves GET /api/v1/services, the services the connector manages
+func (c *Connector) handleServices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	services, err := c.currentHandlers().listManagedServices(c.haproxyClient, c.nomadClient)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"services": services})
+}
+
+// handleDiff serves GET /api/v1/diff, the servers a resync would add or remove
+func (c *Connector) handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	services, err := c.nomadClient.GetServices()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	drift, err := serverDrift(c.haproxyClient, c.currentHandlers().buildExpectedServersMap(services))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"backends": drift})
+}
+
+// handleResync serves POST /api/v1/resync: it registers all Nomad services again and removes stale
+// servers, like the initial sync, and refreshes the drift condition afterwards
+func (c *Connector) handleResync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.mu.RLock()
+	initialSyncDone := c.initialSyncDone
+	c.mu.RUnlock()
+	if !initialSyncDone {
+		http.Error(w, "initial sync in progress", http.StatusConflict)
+		return
+	}
+	if !c.resyncMu.TryLock() {
+		http.Error(w, "resync already in progress", http.StatusConflict)
+		return
+	}
+	defer c.resyncMu.Unlock()
+
+	c.logger.Println("Resync requested on the admin API")
+	start := time.Now()
+	synced, removed, err := SyncAndCleanupStaleServers(c.handlerContext(r.Context()), c.haproxyClient, c.nomadClient, c.logger, c.cfg())
+	result := ResyncResult{Synced: synced, Removed: removed, Duration: time.Since(start).Round(time.Millisecond).String()}
+	if err != nil {
+		result.Error = err.Error()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	c.conditions.probeDrift(c.haproxyClient, c.nomadClient, c.currentHandlers())
+	writeJSON(w, result)
+}
+
+// handleRecentEvents serves GET /api/v1/events/recent?limit=N, the last events of all services
+func (c *Connector) handleRecentEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := DefaultRecentEvents
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	writeJSON(w, map[string]interface{}{"events": c.history.recent(limit)})
+}
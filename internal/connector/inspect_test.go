@@ -0,0 +1,139 @@
+package connector
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func TestListManagedServices(t *testing.T) {
+	hs := newHandlerState()
+	client := &mockHAProxyClient{getServersServers: []haproxy.Server{{Name: "api_1"}}}
+	nomadClient := &fakeNomadClient{services: []*nomad.Service{
+		{ServiceName: "api", Address: "10.0.0.2", Port: 8080, Tags: []string{"haproxy.enable=true", "haproxy.domain=api.example.com"}},
+		{ServiceName: "api", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true", "haproxy.domain=api.example.com"}},
+		{ServiceName: "unmanaged", Address: "10.0.0.3", Port: 9000},
+	}}
+
+	services, err := hs.listManagedServices(client, nomadClient)
+	if err != nil {
+		t.Fatalf("listManagedServices() failed: %v", err)
+	}
+	if len(services) != 1 {
+		t.Fatalf("Expected only the managed service, got %+v", services)
+	}
+	api := services[0]
+	if api.Name != "api" || api.Backend != "api" || api.Domain != "api.example.com" || api.Servers != 1 {
+		t.Errorf("Unexpected service: %+v", api)
+	}
+	if len(api.Instances) != 2 || api.Instances[0] != "10.0.0.1:8080" {
+		t.Errorf("Expected both sorted instances, got %v", api.Instances)
+	}
+}
+
+func TestServerDrift(t *testing.T) {
+	hs := newHandlerState()
+	client := &mockHAProxyClient{getServersServers: []haproxy.Server{
+		{Name: generateServerName("api", "10.0.0.1", 8080)},
+		{Name: "api_old"},
+	}}
+	expected := hs.buildExpectedServersMap([]*nomad.Service{
+		{ServiceName: "api", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+		{ServiceName: "api", Address: "10.0.0.2", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+	})
+
+	drift, err := serverDrift(client, expected)
+	if err != nil {
+		t.Fatalf("serverDrift() failed: %v", err)
+	}
+	if len(drift) != 1 || drift[0].Backend != "api" {
+		t.Fatalf("Expected drift of backend api, got %+v", drift)
+	}
+	if len(drift[0].Missing) != 1 || drift[0].Missing[0] != generateServerName("api", "10.0.0.2", 8080) ||
+		len(drift[0].Stale) != 1 || drift[0].Stale[0] != "api_old" {
+		t.Errorf("Unexpected drift: %+v", drift[0])
+	}
+}
+
+func TestEventHistory_Recent(t *testing.T) {
+	history := newEventHistory(10)
+	start := time.Now()
+	history.record("web", HistoryEntry{Time: start, Event: "a"})
+	history.record("api", HistoryEntry{Time: start.Add(time.Second), Event: "b"})
+	history.record("web", HistoryEntry{Time: start.Add(2 * time.Second), Event: "c"})
+
+	events := history.recent(2)
+	if len(events) != 2 || events[0].Event != "c" || events[0].Service != "web" || events[1].Service != "api" {
+		t.Errorf("Expected the 2 newest events of all services, got %+v", events)
+	}
+	if len((*eventHistory)(nil).recent(5)) != 0 {
+		t.Error("Expected no events without a history")
+	}
+}
+
+func TestHandleRecentEvents(t *testing.T) {
+	c := &Connector{history: newEventHistory(10)}
+	c.history.record("web", HistoryEntry{Time: time.Now(), Event: "ServiceRegistration", Status: StatusCreated})
+
+	recorder := httptest.NewRecorder()
+	c.handleRecentEvents(recorder, httptest.NewRequest(http.MethodGet, RecentEventsAPIPath+"?limit=10", http.NoBody))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+	var response struct {
+		Events []RecentEvent `json:"events"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if len(response.Events) != 1 || response.Events[0].Service != "web" || response.Events[0].Status != StatusCreated {
+		t.Errorf("Unexpected events: %+v", response.Events)
+	}
+
+	recorder = httptest.NewRecorder()
+	c.handleRecentEvents(recorder, httptest.NewRequest(http.MethodGet, RecentEventsAPIPath+"?limit=all", http.NoBody))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", recorder.Code)
+	}
+}
+
+func TestHandleResync(t *testing.T) {
+	c := &Connector{
+		config:        testConfig(),
+		haproxyClient: &mockHAProxyClient{},
+		nomadClient:   &fakeNomadClient{},
+		conditions:    newConditionSet(),
+		logger:        log.New(io.Discard, "", 0),
+	}
+	post := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		c.handleResync(recorder, httptest.NewRequest(http.MethodPost, ResyncAPIPath, http.NoBody))
+		return recorder
+	}
+
+	if recorder := post(); recorder.Code != http.StatusConflict {
+		t.Errorf("Expected 409 during the initial sync, got %d", recorder.Code)
+	}
+
+	c.initialSyncDone = true
+	c.resyncMu.Lock()
+	if recorder := post(); recorder.Code != http.StatusConflict {
+		t.Errorf("Expected 409 while a resync runs, got %d", recorder.Code)
+	}
+	c.resyncMu.Unlock()
+
+	recorder := post()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if condition := c.conditions.get(ConditionDriftDetected); condition.Status != ConditionFalse {
+		t.Errorf("Expected the drift condition to be refreshed, got %+v", condition)
+	}
+}
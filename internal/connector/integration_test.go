@@ -22,6 +22,8 @@ type MockHAProxyClient struct {
 	backends map[string]*haproxy.Backend
 	servers  map[string][]haproxy.Server
 	version  int
+
+	updateServersCalls int
 }
 
 func NewMockHAProxyClient() *MockHAProxyClient {
@@ -32,10 +34,30 @@ func NewMockHAProxyClient() *MockHAProxyClient {
 	}
 }
 
+func (m *MockHAProxyClient) GetInfo() (*haproxy.APIInfo, error) {
+	return &haproxy.APIInfo{}, nil
+}
+
 func (m *MockHAProxyClient) GetConfigVersion() (int, error) {
 	return m.version, nil
 }
 
+func (m *MockHAProxyClient) GetRawConfiguration() (string, error) {
+	return "", nil
+}
+
+func (m *MockHAProxyClient) DeleteStaleTransactions() (int, error) {
+	return 0, nil
+}
+
+func (m *MockHAProxyClient) GetBackends() ([]haproxy.Backend, error) {
+	backends := make([]haproxy.Backend, 0, len(m.backends))
+	for _, backend := range m.backends {
+		backends = append(backends, *backend)
+	}
+	return backends, nil
+}
+
 func (m *MockHAProxyClient) GetBackend(name string) (*haproxy.Backend, error) {
 	backend, exists := m.backends[name]
 	if !exists {
@@ -57,6 +79,12 @@ func (m *MockHAProxyClient) ReplaceBackend(backend *haproxy.Backend, version int
 	return backend, nil
 }
 
+func (m *MockHAProxyClient) DeleteBackend(name string, version int) error {
+	delete(m.backends, name)
+	m.version++
+	return nil
+}
+
 func (m *MockHAProxyClient) GetServers(backendName string) ([]haproxy.Server, error) {
 	servers, exists := m.servers[backendName]
 	if !exists {
@@ -74,6 +102,43 @@ func (m *MockHAProxyClient) CreateServer(backendName string, server *haproxy.Ser
 	return server, nil
 }
 
+func (m *MockHAProxyClient) ReplaceServer(backendName string, server *haproxy.Server, version int) error {
+	servers := m.servers[backendName]
+	for i := range servers {
+		if servers[i].Name == server.Name {
+			servers[i] = *server
+			m.version++
+			return nil
+		}
+	}
+	return &haproxy.APIError{StatusCode: 404}
+}
+
+func (m *MockHAProxyClient) SwapServer(backendName, oldServerName string, server *haproxy.Server) error {
+	servers := m.servers[backendName]
+	for i := range servers {
+		if servers[i].Name == oldServerName {
+			servers[i] = *server
+			m.version++
+			return nil
+		}
+	}
+	return &haproxy.APIError{StatusCode: 404}
+}
+
+func (m *MockHAProxyClient) UpdateServers(backendName string, remove []string, create []haproxy.Server) error {
+	var kept []haproxy.Server
+	for _, server := range m.servers[backendName] {
+		if !containsString(remove, server.Name) {
+			kept = append(kept, server)
+		}
+	}
+	m.servers[backendName] = append(kept, create...)
+	m.version++
+	m.updateServersCalls++
+	return nil
+}
+
 func (m *MockHAProxyClient) DeleteServer(backendName, serverName string, version int) error {
 	servers, exists := m.servers[backendName]
 	if !exists {
@@ -99,6 +164,18 @@ func (m *MockHAProxyClient) GetRuntimeServer(backendName, serverName string) (*h
 	}, nil
 }
 
+func (m *MockHAProxyClient) GetRuntimeServers(backendName string) ([]haproxy.RuntimeServer, error) {
+	var servers []haproxy.RuntimeServer
+	for _, server := range m.servers[backendName] {
+		servers = append(servers, haproxy.RuntimeServer{AdminState: "ready", ServerName: server.Name})
+	}
+	return servers, nil
+}
+
+func (m *MockHAProxyClient) GetStickTableEntries(table string) ([]haproxy.StickTableEntry, error) {
+	return []haproxy.StickTableEntry{}, nil
+}
+
 func (m *MockHAProxyClient) SetServerState(ctx context.Context, backendName, serverName, adminState string) error {
 	// For mock, just return success
 	return nil
@@ -126,11 +203,30 @@ func (m *MockHAProxyClient) AddFrontendRuleWithType(frontend, domain, backend st
 	return m.AddFrontendRule(frontend, domain, backend)
 }
 
+func (m *MockHAProxyClient) SetFrontendRule(frontend string, rule haproxy.FrontendRule) error {
+	return nil
+}
+
+func (m *MockHAProxyClient) EnsureUserlistUser(userlist, username, passwordHash string) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) DeleteUserlist(name string, version int) error {
+	m.version++
+	return nil
+}
+
 func (m *MockHAProxyClient) RemoveFrontendRule(frontend, domain string) error {
 	// Mock implementation - no-op for existing tests
 	return nil
 }
 
+func (m *MockHAProxyClient) ResetFrontendRules(frontend string) error {
+	// Mock implementation - no-op for existing tests
+	return nil
+}
+
 func (m *MockHAProxyClient) GetFrontendRules(frontend string) ([]haproxy.FrontendRule, error) {
 	// Mock implementation - return empty rules for existing tests
 	return []haproxy.FrontendRule{}, nil
@@ -146,6 +242,120 @@ func (m *MockHAProxyClient) SetHTTPChecks(backendName string, checks []haproxy.H
 	return nil
 }
 
+func (m *MockHAProxyClient) GetFrontend(name string) (*haproxy.Frontend, error) {
+	return nil, &haproxy.APIError{StatusCode: 404}
+}
+
+func (m *MockHAProxyClient) CreateFrontend(frontend *haproxy.Frontend, version int) (*haproxy.Frontend, error) {
+	m.version++
+	return frontend, nil
+}
+
+func (m *MockHAProxyClient) UpdateFrontendLogging(frontend *haproxy.Frontend, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) SetFrontendDefaultBackend(frontendName, backendName string, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) DeleteFrontend(name string, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) CreateBind(frontendName string, bind *haproxy.Bind, version int) (*haproxy.Bind, error) {
+	m.version++
+	return bind, nil
+}
+
+func (m *MockHAProxyClient) EnsureFrontend(frontend *haproxy.Frontend, binds []haproxy.Bind) (bool, error) {
+	m.version++
+	return true, nil
+}
+
+func (m *MockHAProxyClient) GetHTTPRequestRules(parentType, parentName string) ([]haproxy.HTTPRequestRule, error) {
+	return []haproxy.HTTPRequestRule{}, nil
+}
+
+func (m *MockHAProxyClient) CreateHTTPRequestRule(
+	parentType, parentName string, index int, rule *haproxy.HTTPRequestRule, version int,
+) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) DeleteHTTPRequestRule(parentType, parentName string, index, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) GetHTTPResponseRules(parentType, parentName string) ([]haproxy.HTTPResponseRule, error) {
+	return []haproxy.HTTPResponseRule{}, nil
+}
+
+func (m *MockHAProxyClient) CreateHTTPResponseRule(
+	parentType, parentName string, index int, rule *haproxy.HTTPResponseRule, version int,
+) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) DeleteHTTPResponseRule(parentType, parentName string, index, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) GetBackendSwitchingRules(frontend string) ([]haproxy.BackendSwitchingRule, error) {
+	return []haproxy.BackendSwitchingRule{}, nil
+}
+
+func (m *MockHAProxyClient) CreateBackendSwitchingRule(frontend string, index int, rule *haproxy.BackendSwitchingRule, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) DeleteBackendSwitchingRule(frontend string, index, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) GetStickRules(backend string) ([]haproxy.StickRule, error) {
+	return []haproxy.StickRule{}, nil
+}
+
+func (m *MockHAProxyClient) CreateStickRule(backend string, index int, rule *haproxy.StickRule, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) DeleteStickRule(backend string, index, version int) error {
+	m.version++
+	return nil
+}
+
+func (m *MockHAProxyClient) GetSSLCertificates() ([]haproxy.SSLCertificate, error) {
+	return []haproxy.SSLCertificate{}, nil
+}
+
+func (m *MockHAProxyClient) GetSSLCertificate(name string) (*haproxy.SSLCertificate, error) {
+	return nil, &haproxy.APIError{StatusCode: 404}
+}
+
+func (m *MockHAProxyClient) CreateSSLCertificate(name string, pem []byte) (*haproxy.SSLCertificate, error) {
+	return &haproxy.SSLCertificate{StorageName: name}, nil
+}
+
+func (m *MockHAProxyClient) ReplaceSSLCertificate(name string, pem []byte) (*haproxy.SSLCertificate, error) {
+	return &haproxy.SSLCertificate{StorageName: name}, nil
+}
+
+func (m *MockHAProxyClient) DeleteSSLCertificate(name string) error {
+	return nil
+}
+
 func TestServiceRegistrationWithDomainMapping(t *testing.T) {
 	// Setup
 	client := NewMockHAProxyClient()
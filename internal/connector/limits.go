@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Per-service timeout and connection limit tags
+const (
+	TimeoutServerTag  = "haproxy.timeout.server="
+	TimeoutConnectTag = "haproxy.timeout.connect="
+	TimeoutTunnelTag  = "haproxy.timeout.tunnel="
+	MaxconnTag        = "haproxy.maxconn="
+	SlowstartTag      = "haproxy.slowstart="
+)
+
+// parseTimeoutMs parses a timeout tag value as Go duration ("90s", "2m") or plain milliseconds ("90000").
+// Returns 0 for invalid or non-positive values.
+func parseTimeoutMs(value string) int {
+	if ms, err := strconv.Atoi(value); err == nil {
+		return max(ms, 0)
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0
+	}
+	return int(duration.Milliseconds())
+}
+
+// applyServiceLimits configures timeouts on the desired backend and the connection limit and
+// slow start on its default server from the haproxy.timeout.*, haproxy.maxconn and haproxy.slowstart
+// tags. Invalid values are ignored.
+func applyServiceLimits(backend *haproxy.Backend, tags []string) {
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, TimeoutServerTag):
+			backend.ServerTimeout = parseTimeoutMs(strings.TrimPrefix(tag, TimeoutServerTag))
+		case strings.HasPrefix(tag, TimeoutConnectTag):
+			backend.ConnectTimeout = parseTimeoutMs(strings.TrimPrefix(tag, TimeoutConnectTag))
+		case strings.HasPrefix(tag, TimeoutTunnelTag):
+			backend.TunnelTimeout = parseTimeoutMs(strings.TrimPrefix(tag, TimeoutTunnelTag))
+		case strings.HasPrefix(tag, MaxconnTag):
+			if maxconn, err := strconv.Atoi(strings.TrimPrefix(tag, MaxconnTag)); err == nil && maxconn > 0 {
+				backend.DefaultServer.Maxconn = maxconn
+			}
+		case strings.HasPrefix(tag, SlowstartTag):
+			backend.DefaultServer.Slowstart = parseTimeoutMs(strings.TrimPrefix(tag, SlowstartTag))
+		}
+	}
+}
+
+// serviceLimitsMatch checks if timeouts, connection limit and slow start of the existing backend match
+// the desired ones, so changed or removed tags are reconciled
+func serviceLimitsMatch(existing, desired *haproxy.Backend) bool {
+	if existing.ServerTimeout != desired.ServerTimeout || existing.ConnectTimeout != desired.ConnectTimeout ||
+		existing.TunnelTimeout != desired.TunnelTimeout {
+		return false
+	}
+	return existing.DefaultServer != nil && existing.DefaultServer.Maxconn == desired.DefaultServer.Maxconn &&
+		existing.DefaultServer.Slowstart == desired.DefaultServer.Slowstart
+}
@@ -0,0 +1,85 @@
+package connector
+
+import "testing"
+
+func TestBuildDesiredBackendServiceLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		tags           []string
+		serverTimeout  int
+		connectTimeout int
+		tunnelTimeout  int
+		maxconn        int
+		slowstart      int
+	}{
+		{name: "no limit tags", tags: []string{"haproxy.enable=true"}},
+		{name: "duration values", tags: []string{"haproxy.timeout.server=2m", "haproxy.timeout.connect=5s"},
+			serverTimeout: 120000, connectTimeout: 5000},
+		{name: "websocket tunnel", tags: []string{"haproxy.timeout.tunnel=1h"}, tunnelTimeout: 3600000},
+		{name: "millisecond values", tags: []string{"haproxy.timeout.server=90000"}, serverTimeout: 90000},
+		{name: "maxconn", tags: []string{"haproxy.maxconn=25"}, maxconn: 25},
+		{name: "slowstart", tags: []string{"haproxy.slowstart=30s"}, slowstart: 30000},
+		{name: "invalid values ignored", tags: []string{"haproxy.timeout.server=soon", "haproxy.maxconn=-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := buildDesiredBackend("reports", nil, tt.tags)
+			if backend.ServerTimeout != tt.serverTimeout {
+				t.Errorf("ServerTimeout = %d, expected %d", backend.ServerTimeout, tt.serverTimeout)
+			}
+			if backend.ConnectTimeout != tt.connectTimeout {
+				t.Errorf("ConnectTimeout = %d, expected %d", backend.ConnectTimeout, tt.connectTimeout)
+			}
+			if backend.TunnelTimeout != tt.tunnelTimeout {
+				t.Errorf("TunnelTimeout = %d, expected %d", backend.TunnelTimeout, tt.tunnelTimeout)
+			}
+			if backend.DefaultServer.Maxconn != tt.maxconn {
+				t.Errorf("DefaultServer.Maxconn = %d, expected %d", backend.DefaultServer.Maxconn, tt.maxconn)
+			}
+			if backend.DefaultServer.Slowstart != tt.slowstart {
+				t.Errorf("DefaultServer.Slowstart = %d, expected %d", backend.DefaultServer.Slowstart, tt.slowstart)
+			}
+		})
+	}
+}
+
+func TestBackendConfigMatchesServiceLimits(t *testing.T) {
+	plain := buildDesiredBackend("reports", nil, nil)
+	slow := buildDesiredBackend("reports", nil, []string{"haproxy.timeout.server=5m"})
+	slower := buildDesiredBackend("reports", nil, []string{"haproxy.timeout.server=10m"})
+	limited := buildDesiredBackend("reports", nil, []string{"haproxy.maxconn=10"})
+	websocket := buildDesiredBackend("reports", nil, []string{"haproxy.timeout.tunnel=1h"})
+	warming := buildDesiredBackend("reports", nil, []string{"haproxy.slowstart=30s"})
+
+	if !backendConfigMatches(slow, slow, nil, nil) {
+		t.Error("Expected identical backends to match")
+	}
+	if backendConfigMatches(plain, slow, nil, nil) {
+		t.Error("Expected adding a server timeout to require an update")
+	}
+	if backendConfigMatches(slow, slower, nil, nil) {
+		t.Error("Expected a changed server timeout to require an update")
+	}
+	if backendConfigMatches(plain, websocket, nil, nil) {
+		t.Error("Expected adding a tunnel timeout to require an update")
+	}
+	if backendConfigMatches(plain, warming, nil, nil) {
+		t.Error("Expected adding slow start to require an update")
+	}
+	if backendConfigMatches(limited, plain, nil, nil) {
+		t.Error("Expected removing maxconn to require an update")
+	}
+}
+
+func TestCheckTagSlowstart(t *testing.T) {
+	for tag, valid := range map[string]bool{
+		"haproxy.slowstart=30s":   true,
+		"haproxy.slowstart=30000": true,
+		"haproxy.slowstart=soon":  false,
+	} {
+		if problem := checkTag(tag); (problem == "") != valid {
+			t.Errorf("checkTag(%q) = %q, expected valid: %v", tag, problem, valid)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package connector
+
+import "sync"
+
+// keyedMutex hands out one mutex per key, entries are dropped once nobody holds or waits for them
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]*keyedLock)}
+}
+
+// lock blocks until the key is free and returns the function releasing it
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	entry, ok := k.locks[key]
+	if !ok {
+		entry = &keyedLock{}
+		k.locks[key] = entry
+	}
+	entry.refs++
+	k.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
+
+// size returns the number of keys currently held or waited for
+func (k *keyedMutex) size() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.locks)
+}
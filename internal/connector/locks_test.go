@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex_SerializesSameKey(t *testing.T) {
+	locks := newKeyedMutex()
+	var mu sync.Mutex
+	var active, maxActive int
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer locks.lock("web")()
+
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("Expected mutations of one backend to be serialized, got %d at once", maxActive)
+	}
+	if size := locks.size(); size != 0 {
+		t.Errorf("Expected released locks to be dropped, got %d", size)
+	}
+}
+
+func TestKeyedMutex_DifferentKeysInParallel(t *testing.T) {
+	locks := newKeyedMutex()
+	unlock := locks.lock("web")
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer locks.lock("api")()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected another backend not to wait for the lock")
+	}
+}
+
+func TestDelayedRemovalCanceledWhileWaitingForLock(t *testing.T) {
+	hs := newHandlerState()
+	client := &mockHAProxyClient{}
+	tracker := hs.removals
+	unlock := hs.locks.lock("locked_backend")
+
+	// The drain period is over, but a registration holds the backend and keeps the server
+	tracker.scheduleRemoval(client, "locked_backend", "web_1", time.Now(), nil)
+	time.Sleep(20 * time.Millisecond)
+	tracker.cancel("locked_backend", "web_1")
+	unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	if client.wasDeleteCalled() {
+		t.Error("Expected the re-registered server not to be removed")
+	}
+}
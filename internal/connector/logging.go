@@ -0,0 +1,110 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// desiredFrontendLogging returns the log settings a managed frontend should have. A custom
+// log-format replaces the log options, which would otherwise override it.
+func desiredFrontendLogging(frontend *haproxy.Frontend, cfg *config.HAProxyLoggingConfig) *haproxy.Frontend {
+	desired := &haproxy.Frontend{Name: frontend.Name}
+	switch {
+	case cfg.LogFormat != "":
+		desired.LogFormat = cfg.LogFormat
+	case frontend.Mode == ModeTCP:
+		desired.TCPLog = true
+	default:
+		desired.HTTPLog = true
+	}
+	return desired
+}
+
+// frontendLoggingMatches checks if a frontend already has the desired log settings
+func frontendLoggingMatches(existing, desired *haproxy.Frontend) bool {
+	return existing.LogFormat == desired.LogFormat && existing.HTTPLog == desired.HTTPLog && existing.TCPLog == desired.TCPLog
+}
+
+// enforceFrontendLogging repairs the log settings of the given frontends and returns the repaired ones.
+// Frontends that don't exist (yet) are skipped.
+func enforceFrontendLogging(client haproxy.ClientInterface, frontends []string, cfg *config.HAProxyLoggingConfig) ([]string, error) {
+	var repaired []string
+	for _, name := range frontends {
+		frontend, err := client.GetFrontend(name)
+		if err != nil {
+			continue
+		}
+
+		desired := desiredFrontendLogging(frontend, cfg)
+		if frontendLoggingMatches(frontend, desired) {
+			continue
+		}
+
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return repaired, fmt.Errorf("failed to get config version for frontend logging: %w", err)
+		}
+		if err := client.UpdateFrontendLogging(desired, version); err != nil {
+			return repaired, fmt.Errorf("failed to set logging of frontend %s: %w", name, err)
+		}
+		repaired = append(repaired, name)
+	}
+	return repaired, nil
+}
+
+// loggedFrontends returns all frontends the connector manages: the domain rule frontends, the
+// plain HTTP frontend and the dedicated tcp frontends of services
+func (c *Connector) loggedFrontends() []string {
+	frontends := managedFrontends(&c.cfg().HAProxy)
+	if httpFrontend := c.cfg().HAProxy.HTTPFrontend; httpFrontend != "" && !containsString(frontends, httpFrontend) {
+		frontends = append(frontends, httpFrontend)
+	}
+
+	services, err := c.nomadClient.GetServices()
+	if err != nil {
+		c.logger.Printf("Warning: Failed to get services for tcp frontend logging: %v", err)
+		return frontends
+	}
+	for _, name := range serviceTCPFrontends(services) {
+		if !containsString(frontends, name) {
+			frontends = append(frontends, name)
+		}
+	}
+	return frontends
+}
+
+// runLoggingEnforcement keeps the log settings of the managed frontends as configured, so the
+// per-request logs needed to debug routing stay available
+func (c *Connector) runLoggingEnforcement(ctx context.Context) {
+	cfg := &c.cfg().HAProxy.Logging
+	if !cfg.Enforce {
+		return
+	}
+
+	interval := cfg.IntervalSec
+	if interval <= 0 {
+		interval = config.DefaultLoggingIntervalSec
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		repaired, err := enforceFrontendLogging(c.haproxyClient, c.loggedFrontends(), cfg)
+		if err != nil {
+			c.logger.Printf("Warning: Failed to enforce frontend logging: %v", err)
+		}
+		for _, name := range repaired {
+			c.logger.Printf("Repaired log settings of frontend %s", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestDesiredFrontendLogging(t *testing.T) {
+	httpFrontend := &haproxy.Frontend{Name: "https", Mode: ModeHTTP}
+	tcpFrontend := &haproxy.Frontend{Name: "tcp_db", Mode: ModeTCP}
+
+	if desired := desiredFrontendLogging(httpFrontend, &config.HAProxyLoggingConfig{}); !desired.HTTPLog || desired.TCPLog {
+		t.Errorf("Expected option httplog for http frontends, got %+v", desired)
+	}
+	if desired := desiredFrontendLogging(tcpFrontend, &config.HAProxyLoggingConfig{}); !desired.TCPLog || desired.HTTPLog {
+		t.Errorf("Expected option tcplog for tcp frontends, got %+v", desired)
+	}
+
+	cfg := &config.HAProxyLoggingConfig{LogFormat: "%ci:%cp [%tr] %ft %b/%s %ST"}
+	if desired := desiredFrontendLogging(httpFrontend, cfg); desired.LogFormat != cfg.LogFormat || desired.HTTPLog {
+		t.Errorf("Expected custom log-format without log option, got %+v", desired)
+	}
+}
+
+func TestEnforceFrontendLogging(t *testing.T) {
+	mock := &mockHAProxyClient{createdFrontends: []haproxy.Frontend{
+		{Name: "https", Mode: ModeHTTP},
+		{Name: "http", Mode: ModeHTTP, HTTPLog: true},
+		{Name: "tcp_db", Mode: ModeTCP, HTTPLog: true},
+	}}
+	cfg := &config.HAProxyLoggingConfig{Enforce: true}
+
+	repaired, err := enforceFrontendLogging(mock, []string{"https", "http", "tcp_db", "missing"}, cfg)
+	if err != nil {
+		t.Fatalf("enforceFrontendLogging() failed: %v", err)
+	}
+	if len(repaired) != 2 || repaired[0] != "https" || repaired[1] != "tcp_db" {
+		t.Errorf("Expected https and tcp_db to be repaired, got %v", repaired)
+	}
+	if db := mock.createdFrontends[2]; !db.TCPLog || db.HTTPLog {
+		t.Errorf("Expected tcp_db to log with option tcplog only, got %+v", db)
+	}
+
+	// Once repaired, nothing drifts anymore
+	repaired, err = enforceFrontendLogging(mock, []string{"https", "http", "tcp_db"}, cfg)
+	if err != nil || len(repaired) != 0 {
+		t.Errorf("Expected no further repairs, got %v (%v)", repaired, err)
+	}
+}
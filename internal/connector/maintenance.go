@@ -0,0 +1,176 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+// MaintenanceTag puts all servers of the service into maintenance
+const MaintenanceTag = "haproxy.maint=true"
+
+// MaintenanceBackendsState is the state key of the backends the tag put into maintenance. They are
+// remembered so they are only taken out again when the tag is removed, and not after a manual maint
+// on the admin API.
+const MaintenanceBackendsState = "maintenance_backends.json"
+
+// backendSet is a set of backend names safe for concurrent use
+type backendSet struct {
+	mu       sync.Mutex
+	backends map[string]bool
+}
+
+func newBackendSet() *backendSet {
+	return &backendSet{backends: make(map[string]bool)}
+}
+
+func (s *backendSet) add(backendName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backends[backendName] = true
+}
+
+// remove removes the backend, returns false if it was not in the set
+func (s *backendSet) remove(backendName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.backends[backendName] {
+		return false
+	}
+	delete(s.backends, backendName)
+	return true
+}
+
+// names returns the backends of the set in order
+func (s *backendSet) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.backends))
+	for backendName := range s.backends {
+		names = append(names, backendName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isMaintenance checks if the service is tagged haproxy.maint=true
+func isMaintenance(tags []string) bool {
+	return hasTag(tags, MaintenanceTag)
+}
+
+// reconcileMaintenance puts all servers of the backend into maint through the runtime API. With a
+// haproxy.maintenance_backend configured the domain is routed there until maintenance ends; the rest
+// of the service's routing is left as it is.
+func (hs *handlerState) reconcileMaintenance(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	backendName string,
+	result map[string]string,
+	haproxyCfg *config.HAProxyConfig,
+) error {
+	hs.maintenance.add(backendName)
+	if err := hs.setBackendServersState(client, backendName, client.MaintainServer); err != nil {
+		result["maintenance_warning"] = err.Error()
+	}
+	result["maintenance"] = backendName
+
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if haproxyCfg.MaintenanceBackend == "" || domainMapping == nil || hs.rulesUnmanaged {
+		return nil
+	}
+	for _, frontendName := range parseFrontends(tags, serviceFrontends(serviceName, tags, haproxyCfg)) {
+		if _, err := hs.reconcileFrontendRuleIn(client, frontendName, domainMapping, haproxyCfg.MaintenanceBackend, ""); err != nil {
+			return err
+		}
+	}
+	result["maintenance_route"] = fmt.Sprintf("%s -> %s", domainMapping.Domain, haproxyCfg.MaintenanceBackend)
+	return nil
+}
+
+// clearMaintenance puts the servers of a backend the tag put into maintenance back into rotation once
+// the tag is gone. Routing the domain back to the backend is left to the regular frontend rule reconcile.
+func (hs *handlerState) clearMaintenance(client haproxy.ClientInterface, backendName string, result map[string]string) {
+	if !hs.maintenance.remove(backendName) {
+		return
+	}
+	if err := hs.setBackendServersState(client, backendName, client.ReadyServer); err != nil {
+		result["maintenance_warning"] = err.Error()
+	}
+	result["maintenance_cleared"] = backendName
+}
+
+// setBackendServersState applies a runtime admin state change to the servers of a backend. Free slots
+// and servers waiting for their removal keep their state.
+func (hs *handlerState) setBackendServersState(
+	client haproxy.ClientInterface,
+	backendName string,
+	apply func(backendName, serverName string) error,
+) error {
+	servers, err := client.GetServers(backendName)
+	if err != nil {
+		return fmt.Errorf("failed to get servers of backend %s: %w", backendName, err)
+	}
+
+	var failed []string
+	for i := range servers {
+		server := &servers[i]
+		if isFreeSlot(server) || hs.removals.has(backendName, server.Name) {
+			continue
+		}
+		if err := apply(backendName, server.Name); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", server.Name, err))
+		}
+	}
+	hs.recordBackendChange(backendName)
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("failed to change state of servers of %s: %s", backendName, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// restoreMaintenanceBackends loads the backends the previous run (or leader) put into maintenance
+func (c *Connector) restoreMaintenanceBackends(ctx context.Context) {
+	data, err := c.state.Get(ctx, MaintenanceBackendsState)
+	if errors.Is(err, state.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		c.logger.Printf("Warning: Failed to load maintenance backends: %v", err)
+		return
+	}
+
+	var backends []string
+	if err := json.Unmarshal(data, &backends); err != nil {
+		c.logger.Printf("Warning: Invalid maintenance backends state: %v", err)
+		return
+	}
+	hs := c.currentHandlers()
+	for _, backendName := range backends {
+		hs.maintenance.add(backendName)
+	}
+}
+
+// persistMaintenanceBackends stores the backends the tag put into maintenance
+func (c *Connector) persistMaintenanceBackends() {
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(c.currentHandlers().maintenance.names())
+	if err == nil {
+		err = c.state.Put(ctx, MaintenanceBackendsState, data)
+	}
+	if err != nil {
+		c.logger.Printf("Warning: Failed to persist maintenance backends: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestReconcileServiceRoutingMaintenance(t *testing.T) {
+	hs := newHandlerState()
+	client := &adminMockClient{states: make(map[string]string)}
+	client.getServersServers = []haproxy.Server{{Name: "web_1"}, {Name: "web_2"}}
+	client.frontendRules = map[string][]haproxy.FrontendRule{
+		"https": {{Domain: "web.example.com", Backend: "web", Type: haproxy.DomainTypeExact}},
+	}
+	haproxyCfg := &config.HAProxyConfig{Frontend: "https", MaintenanceBackend: "maintenance"}
+	tags := []string{"haproxy.enable=true", "haproxy.domain=web.example.com"}
+
+	result := map[string]string{}
+	if err := hs.reconcileServiceRouting(client, "web", append([]string{MaintenanceTag}, tags...), "web", result, haproxyCfg); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+	if client.states["web_1"] != "maint" || client.states["web_2"] != "maint" {
+		t.Errorf("Expected all servers in maint, got %v", client.states)
+	}
+	if len(client.addFrontendRuleCalls) != 1 || client.addFrontendRuleCalls[0].Backend != "maintenance" {
+		t.Fatalf("Expected the domain to be routed to the maintenance backend, got %+v", client.addFrontendRuleCalls)
+	}
+	if result["maintenance_route"] != "web.example.com -> maintenance" {
+		t.Errorf("Unexpected result: %v", result)
+	}
+
+	// Registering without the tag ends the maintenance and routes the domain back
+	client.frontendRules["https"][0].Backend = "maintenance"
+	result = map[string]string{}
+	if err := hs.reconcileServiceRouting(client, "web", tags, "web", result, haproxyCfg); err != nil {
+		t.Fatalf("reconcileServiceRouting() failed: %v", err)
+	}
+	if client.states["web_1"] != "ready" || client.states["web_2"] != "ready" || result["maintenance_cleared"] != "web" {
+		t.Errorf("Expected the servers back in rotation, got %v (result %v)", client.states, result)
+	}
+	if len(client.addFrontendRuleCalls) != 2 || client.addFrontendRuleCalls[1].Backend != "web" {
+		t.Errorf("Expected the domain to be routed back to web, got %+v", client.addFrontendRuleCalls)
+	}
+}
+
+func TestClearMaintenanceOnlyAfterTag(t *testing.T) {
+	hs := newHandlerState()
+	client := &adminMockClient{states: make(map[string]string)}
+	client.getServersServers = []haproxy.Server{{Name: "web_1"}}
+
+	// Servers put into maint on the admin API stay there when the service registers
+	result := map[string]string{}
+	hs.clearMaintenance(client, "web", result)
+	if len(client.states) != 0 || result["maintenance_cleared"] != "" {
+		t.Errorf("Expected no state change without tag maintenance, got %v (result %v)", client.states, result)
+	}
+}
+
+func TestDeregisterInMaintenanceKeepsRule(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{getServersServers: []haproxy.Server{{Name: generateServerName("web", "10.0.0.1", 8080)}}}
+	event := &ServiceEvent{
+		Type: EventTypeServiceDeregistration,
+		Service: Service{
+			ServiceName: "web",
+			Address:     "10.0.0.1",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=web.example.com", MaintenanceTag},
+		},
+	}
+
+	if _, err := hs.handleServiceDeregistration(context.Background(), mock, event, testConfig()); err != nil {
+		t.Fatalf("handleServiceDeregistration() failed: %v", err)
+	}
+	if len(mock.removeFrontendRuleCalls) != 0 {
+		t.Errorf("Expected the domain rule to be kept during maintenance, got %+v", mock.removeFrontendRuleCalls)
+	}
+}
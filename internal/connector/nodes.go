@@ -0,0 +1,160 @@
+package connector
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// StatusRestartedInPlace is reported for allocation updates of an allocation that is still registered
+// as the same server, e.g. after a task restart on the same node and port
+const StatusRestartedInPlace = "restarted_in_place"
+
+// Actions taken for the servers of a node
+const (
+	nodeActionDrain  = "drain"
+	nodeActionReady  = "ready"
+	nodeActionRemove = "remove"
+)
+
+type nodeSet struct {
+	mu    sync.Mutex
+	nodes map[string]bool
+}
+
+func newNodeSet() *nodeSet {
+	return &nodeSet{nodes: make(map[string]bool)}
+}
+
+func (s *nodeSet) add(nodeID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[nodeID] = true
+}
+
+// remove forgets the node, false if it wasn't in the set
+func (s *nodeSet) remove(nodeID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.nodes[nodeID] {
+		return false
+	}
+	delete(s.nodes, nodeID)
+	return true
+}
+
+// restartedInPlace checks if an allocation update is about an allocation still registered as the
+// same server. Nothing changed for HAProxy then, unlike an update of an allocation that moved or stopped.
+func (hs *handlerState) restartedInPlace(event *ServiceEvent, backendName string) (map[string]string, bool) {
+	if event.Type != EventTypeAllocationUpdated {
+		return nil, false
+	}
+	serverName := serviceServerName(&event.Service)
+	if !hs.allocations.registeredAs(event.Service.AllocID, backendName, serverName) {
+		return nil, false
+	}
+	return map[string]string{
+		"status":  StatusRestartedInPlace,
+		"backend": backendName,
+		"server":  serverName,
+	}, true
+}
+
+// nodeAction decides what a node event means for the servers of the allocations on the node:
+// a draining node drains them, a node that is down or deregistered removes them and a node whose
+// drain ended makes the remaining ones ready again. Other node events change nothing.
+func (hs *handlerState) nodeAction(event *nomad.ServiceEvent) string {
+	node := event.Payload.Node
+	switch {
+	case event.Type == EventTypeNodeDeregistration || node.Status == nomad.NodeStatusDown:
+		return nodeActionRemove
+	case node.Draining():
+		return nodeActionDrain
+	case node.Status == nomad.NodeStatusReady && hs.drainingNodes.remove(node.ID):
+		return nodeActionReady
+	}
+	return ""
+}
+
+// nodeEventKeys returns the backends of the servers on the node of a node event
+func (hs *handlerState) nodeEventKeys(event *nomad.ServiceEvent) []string {
+	var keys []string
+	for _, current := range hs.allocations.onNode(event.Payload.Node.ID) {
+		if key := "backend/" + current.backend; !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyNodeEvent drains, removes or readies the servers of the allocations on a node. The service
+// deregistrations Nomad sends for the allocations later find their servers already gone.
+func (c *Connector) applyNodeEvent(event *nomad.ServiceEvent) error {
+	hs := c.currentHandlers()
+	node := event.Payload.Node
+	action := hs.nodeAction(event)
+	if action == "" {
+		return nil
+	}
+	switch action {
+	case nodeActionDrain:
+		hs.drainingNodes.add(node.ID)
+	case nodeActionRemove:
+		hs.drainingNodes.remove(node.ID)
+	}
+
+	allocations := hs.allocations.onNode(node.ID)
+	allocIDs := make([]string, 0, len(allocations))
+	for allocID := range allocations {
+		allocIDs = append(allocIDs, allocID)
+	}
+	sort.Strings(allocIDs)
+
+	var lastErr error
+	for _, allocID := range allocIDs {
+		current := allocations[allocID]
+		if err := c.applyNodeAction(action, allocID, current); err != nil {
+			c.logger.Printf("Failed to %s server %s of node %s in backend %s: %v",
+				action, current.server, node.ID, current.backend, err)
+			lastErr = err
+			continue
+		}
+		c.logger.Printf("Node %s (%s) %s: %s server %s in backend %s",
+			node.ID, node.Name, event.Type, action, current.server, current.backend)
+	}
+	return lastErr
+}
+
+// applyNodeAction applies a node action to the server of one allocation
+func (c *Connector) applyNodeAction(action, allocID string, current allocationServer) error {
+	hs := c.currentHandlers()
+	defer hs.locks.lock(current.backend)()
+
+	switch action {
+	case nodeActionDrain:
+		return c.haproxyClient.DrainServer(current.backend, current.server)
+	case nodeActionReady:
+		return c.haproxyClient.ReadyServer(current.backend, current.server)
+	}
+
+	servers, err := c.haproxyClient.GetServers(current.backend)
+	if err != nil {
+		return fmt.Errorf("failed to get servers: %w", err)
+	}
+	if containsServer(servers, current.server) {
+		version, err := c.haproxyClient.GetConfigVersion()
+		if err != nil {
+			return err
+		}
+		if err := removeServer(c.haproxyClient, current.backend, current.server, version); err != nil {
+			return err
+		}
+		hs.recordBackendChange(current.backend)
+	}
+	hs.removals.cancel(current.backend, current.server)
+	hs.allocations.forget(allocID, current.backend, current.server)
+	return nil
+}
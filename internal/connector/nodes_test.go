@@ -0,0 +1,208 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// stateRecordingClient records the admin state changes of servers
+type stateRecordingClient struct {
+	*mockHAProxyClient
+	stateMu sync.Mutex
+	states  map[string]string
+}
+
+func (c *stateRecordingClient) DrainServer(backendName, serverName string) error {
+	return c.setState(backendName, serverName, "drain")
+}
+
+func (c *stateRecordingClient) ReadyServer(backendName, serverName string) error {
+	return c.setState(backendName, serverName, "ready")
+}
+
+func (c *stateRecordingClient) setState(backendName, serverName, state string) error {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.states == nil {
+		c.states = make(map[string]string)
+	}
+	c.states[backendName+"/"+serverName] = state
+	return nil
+}
+
+func newNodeTestConnector(client haproxy.ClientInterface, hs *handlerState) *Connector {
+	return &Connector{
+		config:        testConfig(),
+		haproxyClient: client,
+		nomadClient:   &fakeNomadClient{},
+		history:       newEventHistory(10),
+		logger:        log.New(io.Discard, "", 0),
+		handlers:      hs,
+	}
+}
+
+func nodeEvent(eventType, nodeID, status string, draining bool) *nomad.ServiceEvent {
+	node := &nomad.Node{ID: nodeID, Name: nodeID, Status: status}
+	if draining {
+		node.DrainStrategy = &nomad.DrainStrategy{}
+	}
+	return &nomad.ServiceEvent{Type: eventType, Topic: "Node", Payload: nomad.Payload{Node: node}}
+}
+
+func TestRestartedInPlace(t *testing.T) {
+	hs := newHandlerState()
+	hs.allocations.record("alloc-1", "node-1", "web", "web_10_0_0_1_8080")
+
+	event := &ServiceEvent{
+		Type:    EventTypeAllocationUpdated,
+		Service: Service{ServiceName: "web", Address: "10.0.0.1", Port: 8080, AllocID: "alloc-1"},
+	}
+	result, ok := hs.restartedInPlace(event, "web")
+	if !ok || result["status"] != StatusRestartedInPlace {
+		t.Fatalf("Expected an in place restart, got %v %v", result, ok)
+	}
+
+	moved := *event
+	moved.Service.Port = 9090
+	if _, ok := hs.restartedInPlace(&moved, "web"); ok {
+		t.Error("Expected an allocation with a new port not to count as restarted in place")
+	}
+
+	deregistration := *event
+	deregistration.Type = EventTypeServiceDeregistration
+	if _, ok := hs.restartedInPlace(&deregistration, "web"); ok {
+		t.Error("Expected only allocation updates to be checked")
+	}
+}
+
+func TestAllocationUpdatedRestartedInPlaceKeepsServer(t *testing.T) {
+	hs := newHandlerState()
+	hs.allocations.record("alloc-1", "node-1", "web", "web_10_0_0_1_8080")
+	client := &mockHAProxyClient{getServersServers: []haproxy.Server{{Name: "web_10_0_0_1_8080"}}}
+
+	event := &ServiceEvent{
+		Type: EventTypeAllocationUpdated,
+		Service: Service{
+			ServiceName: "web", Address: "10.0.0.1", Port: 8080, AllocID: "alloc-1", NodeID: "node-1",
+			Tags: []string{"haproxy.enable=true"},
+		},
+	}
+	result, err := hs.processDynamicService(context.Background(), client, event, testConfig())
+	if err != nil {
+		t.Fatalf("processDynamicService() failed: %v", err)
+	}
+	if resultMap := result.(map[string]string); resultMap["status"] != StatusRestartedInPlace {
+		t.Errorf("Expected status %s, got %v", StatusRestartedInPlace, resultMap)
+	}
+	if client.deleteCalled || client.drainCalled {
+		t.Error("Expected the server of an allocation restarted in place to be left alone")
+	}
+}
+
+func TestApplyNodeEvent(t *testing.T) {
+	tests := []struct {
+		name        string
+		drained     bool // the node was draining before
+		event       *nomad.ServiceEvent
+		wantStates  map[string]string
+		wantDeleted []string
+	}{
+		{
+			name:  "drain start drains the servers of the node",
+			event: nodeEvent("NodeDrain", "node-1", nomad.NodeStatusReady, true),
+			wantStates: map[string]string{
+				"api/api_10_0_0_1_9090": "drain",
+				"web/web_10_0_0_1_8080": "drain",
+			},
+		},
+		{
+			name:        "node down removes the servers of the node",
+			event:       nodeEvent(EventTypeNodeEvent, "node-1", nomad.NodeStatusDown, false),
+			wantDeleted: []string{"api/api_10_0_0_1_9090", "web/web_10_0_0_1_8080"},
+		},
+		{
+			name:        "node deregistration removes the servers of the node",
+			event:       nodeEvent(EventTypeNodeDeregistration, "node-1", nomad.NodeStatusReady, false),
+			wantDeleted: []string{"api/api_10_0_0_1_9090", "web/web_10_0_0_1_8080"},
+		},
+		{
+			name:    "drain end makes the remaining servers ready",
+			drained: true,
+			event:   nodeEvent("NodeDrain", "node-1", nomad.NodeStatusReady, false),
+			wantStates: map[string]string{
+				"api/api_10_0_0_1_9090": "ready",
+				"web/web_10_0_0_1_8080": "ready",
+			},
+		},
+		{
+			name:  "ready node that wasn't draining changes nothing",
+			event: nodeEvent(EventTypeNodeEvent, "node-1", nomad.NodeStatusReady, false),
+		},
+		{
+			name:  "other nodes change nothing",
+			event: nodeEvent("NodeDrain", "node-2", nomad.NodeStatusReady, true),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hs := newHandlerState()
+			hs.allocations.record("alloc-web", "node-1", "web", "web_10_0_0_1_8080")
+			hs.allocations.record("alloc-api", "node-1", "api", "api_10_0_0_1_9090")
+			hs.allocations.record("alloc-other", "node-3", "web", "web_10_0_0_3_8080")
+			if tt.drained {
+				hs.drainingNodes.add("node-1")
+			}
+
+			client := &stateRecordingClient{mockHAProxyClient: &mockHAProxyClient{
+				backendServers: map[string][]haproxy.Server{
+					"web": {{Name: "web_10_0_0_1_8080"}, {Name: "web_10_0_0_3_8080"}},
+					"api": {{Name: "api_10_0_0_1_9090"}},
+				},
+			}}
+			if err := newNodeTestConnector(client, hs).applyNodeEvent(tt.event); err != nil {
+				t.Fatalf("applyNodeEvent() failed: %v", err)
+			}
+
+			if len(client.states) != len(tt.wantStates) {
+				t.Errorf("Expected states %v, got %v", tt.wantStates, client.states)
+			}
+			for server, state := range tt.wantStates {
+				if client.states[server] != state {
+					t.Errorf("Expected %s to be %s, got %q", server, state, client.states[server])
+				}
+			}
+			sort.Strings(client.deletedServers)
+			if len(client.deletedServers) != len(tt.wantDeleted) {
+				t.Fatalf("Expected deleted servers %v, got %v", tt.wantDeleted, client.deletedServers)
+			}
+			for i := range tt.wantDeleted {
+				if client.deletedServers[i] != tt.wantDeleted[i] {
+					t.Errorf("Expected deleted servers %v, got %v", tt.wantDeleted, client.deletedServers)
+				}
+			}
+			if len(tt.wantDeleted) > 0 && len(hs.allocations.onNode("node-1")) != 0 {
+				t.Error("Expected the allocations of the removed node to be forgotten")
+			}
+		})
+	}
+}
+
+func TestNodeEventKeys(t *testing.T) {
+	hs := newHandlerState()
+	hs.allocations.record("alloc-1", "node-1", "web", "web_10_0_0_1_8080")
+	hs.allocations.record("alloc-2", "node-1", "web", "web_10_0_0_1_8081")
+	hs.allocations.record("alloc-3", "node-1", "api", "api_10_0_0_1_9090")
+
+	keys := hs.eventKeys(nodeEvent("NodeDrain", "node-1", nomad.NodeStatusReady, true), &testConfig().HAProxy)
+	if len(keys) != 2 || keys[0] != "backend/api" || keys[1] != "backend/web" {
+		t.Errorf("Expected the backends of the node, got %v", keys)
+	}
+}
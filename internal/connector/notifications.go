@@ -0,0 +1,71 @@
+package connector
+
+import (
+	"fmt"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/notify"
+)
+
+// recordEventOutcome counts consecutive failed events and alerts once they reach the configured
+// threshold; a single failure is usually a transient conflict the next event repairs. The first
+// event processed successfully afterwards resolves the alert.
+func (c *Connector) recordEventOutcome(subject string, err error) {
+	if c.notifier == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if err == nil {
+		c.consecutiveFailures = 0
+	} else {
+		c.consecutiveFailures++
+	}
+	failures := c.consecutiveFailures
+	c.mu.Unlock()
+
+	if err == nil {
+		c.notifier.Resolve(notify.KindEventFailures, "Events are processed successfully again")
+		return
+	}
+	if failures >= c.cfg().Notifications.FailureThreshold {
+		c.notifier.Fire(notify.KindEventFailures,
+			fmt.Sprintf("%d events in a row failed to apply to HAProxy", failures),
+			fmt.Sprintf("last failure for %s: %v", subject, err))
+	}
+}
+
+// notifyHAProxyReachability alerts while the Data Plane API doesn't answer the condition probes
+func (c *Connector) notifyHAProxyReachability(reachable bool) {
+	if reachable {
+		c.notifier.Resolve(notify.KindHAProxyUnavailable, "HAProxy Data Plane API is reachable again")
+		return
+	}
+	c.notifier.Fire(notify.KindHAProxyUnavailable, "HAProxy Data Plane API is unreachable",
+		c.conditions.get(ConditionHAProxyReachable).Message)
+}
+
+// notifyDrift alerts once drift was found by the configured number of consecutive probes, it then
+// outlasted the events and resyncs that would correct it
+func (c *Connector) notifyDrift() {
+	if c.notifier == nil {
+		return
+	}
+
+	condition := c.conditions.get(ConditionDriftDetected)
+	c.mu.Lock()
+	switch condition.Status {
+	case ConditionTrue:
+		c.driftProbes++
+	case ConditionFalse:
+		c.driftProbes = 0
+	}
+	probes := c.driftProbes
+	c.mu.Unlock()
+
+	switch {
+	case condition.Status == ConditionFalse:
+		c.notifier.Resolve(notify.KindDrift, "HAProxy servers match the registered services again")
+	case condition.Status == ConditionTrue && probes >= c.cfg().Notifications.DriftProbes:
+		c.notifier.Fire(notify.KindDrift, "HAProxy servers differ from the registered services", condition.Message)
+	}
+}
@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/notify"
+)
+
+// alertReceiver records the alerts posted to a notification webhook
+type alertReceiver struct {
+	mu     sync.Mutex
+	alerts []notify.Alert
+}
+
+func (r *alertReceiver) ServeHTTP(_ http.ResponseWriter, req *http.Request) {
+	var alert notify.Alert
+	if err := json.NewDecoder(req.Body).Decode(&alert); err == nil {
+		r.mu.Lock()
+		r.alerts = append(r.alerts, alert)
+		r.mu.Unlock()
+	}
+}
+
+func (r *alertReceiver) wait(t *testing.T, n int) []notify.Alert {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		alerts := append([]notify.Alert(nil), r.alerts...)
+		r.mu.Unlock()
+		if len(alerts) >= n || time.Now().After(deadline) {
+			if len(alerts) != n {
+				t.Fatalf("Expected %d alerts, got %+v", n, alerts)
+			}
+			return alerts
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newNotifyingConnector(t *testing.T) (*Connector, *alertReceiver) {
+	t.Helper()
+	receiver := &alertReceiver{}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{Notifications: config.NotificationsConfig{
+		Enabled:          true,
+		WebhookURLs:      []string{server.URL},
+		FailureThreshold: 3,
+		DriftProbes:      2,
+	}}
+	return &Connector{config: cfg, conditions: newConditionSet(), notifier: notify.New(&cfg.Notifications)}, receiver
+}
+
+func TestRecordEventOutcomeAlertsRepeatedFailures(t *testing.T) {
+	c, receiver := newNotifyingConnector(t)
+
+	c.recordEventOutcome("service api", errors.New("conflict"))
+	c.recordEventOutcome("service api", nil)
+	c.recordEventOutcome("service api", errors.New("conflict"))
+	c.recordEventOutcome("service api", errors.New("conflict"))
+	c.recordEventOutcome("service web", errors.New("backend missing"))
+	c.recordEventOutcome("service api", nil)
+
+	alerts := receiver.wait(t, 2)
+	if alerts[0].Kind != notify.KindEventFailures || alerts[0].Status != notify.StatusFiring ||
+		alerts[0].Details != "last failure for service web: backend missing" {
+		t.Errorf("Expected an alert after the third failure in a row, got %+v", alerts[0])
+	}
+	if alerts[1].Status != notify.StatusResolved {
+		t.Errorf("Expected the alert to be resolved by the next success, got %+v", alerts[1])
+	}
+}
+
+func TestNotifyDriftAfterConsecutiveProbes(t *testing.T) {
+	c, receiver := newNotifyingConnector(t)
+
+	c.conditions.set(ConditionDriftDetected, ConditionTrue, "ServersDiffer", "1 servers missing in HAProxy, 0 stale servers")
+	c.notifyDrift()
+	c.conditions.set(ConditionDriftDetected, ConditionFalse, "InSync", "")
+	c.notifyDrift()
+	c.conditions.set(ConditionDriftDetected, ConditionTrue, "ServersDiffer", "0 servers missing in HAProxy, 2 stale servers")
+	c.notifyDrift()
+	c.notifyDrift()
+	c.conditions.set(ConditionDriftDetected, ConditionFalse, "InSync", "")
+	c.notifyDrift()
+
+	alerts := receiver.wait(t, 2)
+	if alerts[0].Kind != notify.KindDrift || alerts[0].Details != "0 servers missing in HAProxy, 2 stale servers" {
+		t.Errorf("Expected a drift alert after two probes in a row, got %+v", alerts[0])
+	}
+	if alerts[1].Status != notify.StatusResolved {
+		t.Errorf("Expected the drift alert to be resolved, got %+v", alerts[1])
+	}
+}
+
+func TestNotifyHAProxyReachability(t *testing.T) {
+	c, receiver := newNotifyingConnector(t)
+
+	c.conditions.set(ConditionHAProxyReachable, ConditionFalse, "DataPlaneAPIError", "connection refused")
+	c.notifyHAProxyReachability(false)
+	c.conditions.set(ConditionHAProxyReachable, ConditionTrue, "DataPlaneAPIReachable", "")
+	c.notifyHAProxyReachability(true)
+
+	alerts := receiver.wait(t, 2)
+	if alerts[0].Kind != notify.KindHAProxyUnavailable || alerts[0].Details != "connection refused" {
+		t.Errorf("Expected an unreachable alert, got %+v", alerts[0])
+	}
+	if alerts[1].Status != notify.StatusResolved {
+		t.Errorf("Expected the alert to be resolved, got %+v", alerts[1])
+	}
+}
@@ -0,0 +1,164 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// Reasons for a domain rule to be an orphan
+const (
+	OrphanReasonBackendMissing = "backend missing"
+	OrphanReasonNoService      = "no service"
+)
+
+// orphanRule is a domain rule created by the connector that doesn't route to a live service anymore
+type orphanRule struct {
+	Frontend string
+	Domain   string
+	Backend  string
+	Reason   string
+}
+
+// findOrphanRules returns the connector's domain rules in the frontends whose backend doesn't
+// exist or whose domain no enabled Nomad service publishes anymore. Rules written by hand or
+// created by another connector are never orphans, nor are the rules of services outside the
+// managed_services scope. The rules are read before the backends and services, so a service
+// registering meanwhile is seen with its rule.
+func (hs *handlerState) findOrphanRules(client haproxy.ClientInterface, nomadClient nomad.NomadClient, frontends []string) ([]orphanRule, error) {
+	rulesByFrontend := make(map[string][]haproxy.FrontendRule)
+	for _, frontend := range frontends {
+		rules, err := client.GetFrontendRules(frontend)
+		if err != nil {
+			// Domain group frontends may not exist (yet)
+			if haproxy.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get rules of frontend %s: %w", frontend, err)
+		}
+		rulesByFrontend[frontend] = rules
+	}
+
+	backends, err := client.GetBackends()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backends: %w", err)
+	}
+	existing := make(map[string]bool, len(backends))
+	for i := range backends {
+		existing[backends[i].Name] = true
+	}
+
+	services, err := nomadClient.GetServices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get services: %w", err)
+	}
+	published := make(map[string]bool)
+	for _, svc := range services {
+		tags := serviceTags(svc.Tags, svc.Meta)
+		if classifyService(tags) == haproxy.ServiceTypeStatic {
+			continue
+		}
+		if mapping := parseDomainMapping(svc.ServiceName, tags); mapping != nil {
+			published[mapping.Domain] = true
+		}
+	}
+
+	// The services outside the scope are left out of the listing above, their rules would look
+	// like orphans
+	foreignBackends := make(map[string]bool)
+	foreignDomains := make(map[string]bool)
+	if sources, ok := nomadClient.(*discoverySources); ok {
+		foreign, err := sources.outOfScope()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get services outside the managed scope: %w", err)
+		}
+		for _, svc := range foreign {
+			tags := serviceTags(svc.Tags, svc.Meta)
+			foreignBackends[stableBackendName(svc.ServiceName, tags)] = true
+			foreignBackends[serviceBackendName(svc.ServiceName, tags)] = true
+			if mapping := parseDomainMapping(svc.ServiceName, tags); mapping != nil {
+				foreignDomains[mapping.Domain] = true
+			}
+		}
+	}
+
+	var orphans []orphanRule
+	for _, frontend := range frontends {
+		for _, rule := range rulesByFrontend[frontend] {
+			if !rule.Managed || !hs.ownedRules.owns(frontend, rule.Domain) {
+				continue
+			}
+			if foreignBackends[rule.Backend] || foreignDomains[rule.Domain] {
+				continue
+			}
+			orphan := orphanRule{Frontend: frontend, Domain: rule.Domain, Backend: rule.Backend}
+			switch {
+			case !existing[rule.Backend]:
+				orphan.Reason = OrphanReasonBackendMissing
+			case !published[rule.Domain]:
+				orphan.Reason = OrphanReasonNoService
+			default:
+				continue
+			}
+			orphans = append(orphans, orphan)
+		}
+	}
+	return orphans, nil
+}
+
+// removeOrphanRules removes the orphan rules of the managed frontends and returns the removed ones
+func (c *Connector) removeOrphanRules() ([]orphanRule, error) {
+	hs := c.currentHandlers()
+	orphans, err := hs.findOrphanRules(c.haproxyClient, c.nomadClient, managedFrontends(&c.cfg().HAProxy))
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []orphanRule
+	for _, orphan := range orphans {
+		if err := c.haproxyClient.RemoveFrontendRule(orphan.Frontend, orphan.Domain); err != nil {
+			return removed, fmt.Errorf("failed to remove rule for %s from frontend %s: %w", orphan.Domain, orphan.Frontend, err)
+		}
+		hs.ownedRules.remove(orphan.Frontend, orphan.Domain)
+		hs.recordBackendChange(orphan.Backend)
+		removed = append(removed, orphan)
+	}
+
+	c.mu.Lock()
+	c.orphanRulesRemoved += int64(len(removed))
+	c.mu.Unlock()
+	return removed, nil
+}
+
+// runOrphanRuleCleanup periodically removes domain rules left behind, e.g. after a backend was
+// deleted by hand, which would otherwise answer their domain with a 503
+func (c *Connector) runOrphanRuleCleanup(ctx context.Context) {
+	hs := c.currentHandlers()
+	interval := c.cfg().HAProxy.OrphanRuleIntervalSec
+	if interval <= 0 || hs.rulesUnmanaged {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		removed, err := c.removeOrphanRules()
+		if err != nil {
+			c.logger.Printf("Warning: Failed to remove orphan frontend rules: %v", err)
+		}
+		for _, orphan := range removed {
+			c.logger.Printf("Removed orphan rule %s -> %s from frontend %s: %s",
+				orphan.Domain, orphan.Backend, orphan.Frontend, orphan.Reason)
+		}
+		c.persistOwnedRules()
+	}
+}
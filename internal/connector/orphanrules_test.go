@@ -0,0 +1,94 @@
+package connector
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func TestRemoveOrphanRules(t *testing.T) {
+	client := &mockHAProxyClient{
+		backends: map[string]*haproxy.Backend{
+			"api":     {Name: "api"},
+			"old_app": {Name: "old_app"},
+		},
+		frontendRules: map[string][]haproxy.FrontendRule{
+			"https": {
+				{Domain: "api.example.com", Backend: "api", Managed: true},
+				{Domain: "deleted.example.com", Backend: "deleted", Managed: true},
+				{Domain: "old.example.com", Backend: "old_app", Managed: true},
+				{Domain: "manual.example.com", Backend: "manual", Managed: false},
+			},
+		},
+	}
+	nomadClient := &fakeNomadClient{services: []*nomad.Service{
+		{ServiceName: "api", Tags: []string{"haproxy.enable=true", "haproxy.domain=api.example.com"}},
+		{ServiceName: "static", Tags: []string{"haproxy.domain=old.example.com"}},
+	}}
+	c := &Connector{
+		config:        &config.Config{HAProxy: config.HAProxyConfig{Frontend: "https"}},
+		haproxyClient: client,
+		nomadClient:   nomadClient,
+		logger:        log.New(io.Discard, "", 0),
+	}
+
+	removed, err := c.removeOrphanRules()
+	if err != nil {
+		t.Fatalf("removeOrphanRules() failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"deleted.example.com": OrphanReasonBackendMissing,
+		"old.example.com":     OrphanReasonNoService,
+	}
+	if len(removed) != len(expected) {
+		t.Fatalf("Expected %d orphan rules, got %+v", len(expected), removed)
+	}
+	for _, orphan := range removed {
+		if expected[orphan.Domain] != orphan.Reason || orphan.Frontend != "https" {
+			t.Errorf("Unexpected orphan rule %+v", orphan)
+		}
+	}
+	if len(client.removeFrontendRuleCalls) != 2 {
+		t.Errorf("Expected 2 rules to be removed, got %+v", client.removeFrontendRuleCalls)
+	}
+	if c.orphanRulesRemoved != 2 {
+		t.Errorf("Expected the removed rules to be counted, got %d", c.orphanRulesRemoved)
+	}
+}
+
+func TestRemoveOrphanRules_LeavesServicesOutOfScope(t *testing.T) {
+	client := &mockHAProxyClient{
+		backends: map[string]*haproxy.Backend{"api": {Name: "api"}, "billing": {Name: "billing"}},
+		frontendRules: map[string][]haproxy.FrontendRule{
+			"https": {
+				{Domain: "api.example.com", Backend: "api", Managed: true},
+				{Domain: "billing.example.com", Backend: "billing", Managed: true},
+			},
+		},
+	}
+	c := &Connector{
+		config:        &config.Config{HAProxy: config.HAProxyConfig{Frontend: "https"}},
+		haproxyClient: client,
+		nomadClient: &discoverySources{
+			NomadClient: &fakeNomadClient{services: []*nomad.Service{
+				{ServiceName: "api", Tags: []string{"haproxy.enable=true", "haproxy.domain=api.example.com"}},
+				{ServiceName: "billing", JobID: "team-b-billing", Tags: []string{"haproxy.enable=true", "haproxy.domain=billing.example.com"}},
+			}},
+			scope: &config.ManagedServicesConfig{Deny: []string{"job:team-b-*"}},
+		},
+		logger: log.New(io.Discard, "", 0),
+	}
+
+	removed, err := c.removeOrphanRules()
+	if err != nil {
+		t.Fatalf("removeOrphanRules() failed: %v", err)
+	}
+	if len(removed) != 0 || len(client.removeFrontendRuleCalls) != 0 {
+		t.Errorf("Expected the rule of the service out of scope to be kept, removed %+v", removed)
+	}
+}
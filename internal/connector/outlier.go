@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Outlier detection tags
+const (
+	CheckObserveTag    = "haproxy.check.observe="
+	CheckOnErrorTag    = "haproxy.check.on_error="
+	CheckErrorLimitTag = "haproxy.check.error_limit="
+)
+
+// Traffic HAProxy observes for errors
+const (
+	ObserveLayer4 = "layer4"
+	ObserveLayer7 = "layer7"
+)
+
+// onErrorActions are the reactions of HAProxy once a server reached its error limit
+var onErrorActions = []string{"fastinter", "fail-check", "sudden-death", "mark-down"}
+
+// applyOutlierDetection configures observe, on-error and error-limit on the default server, so
+// servers failing live traffic are marked down between health checks. It needs health checks, and
+// layer7 needs an HTTP backend; on-error and error-limit only apply while traffic is observed.
+func applyOutlierDetection(backend *haproxy.Backend, healthCheckConfig *HealthCheckConfig, tags []string) {
+	if healthCheckConfig != nil && healthCheckConfig.Disabled {
+		return
+	}
+	server := backend.DefaultServer
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, CheckObserveTag):
+			server.Observe = strings.TrimPrefix(tag, CheckObserveTag)
+		case strings.HasPrefix(tag, CheckOnErrorTag):
+			server.OnError = strings.TrimPrefix(tag, CheckOnErrorTag)
+		case strings.HasPrefix(tag, CheckErrorLimitTag):
+			if limit, err := strconv.Atoi(strings.TrimPrefix(tag, CheckErrorLimitTag)); err == nil && limit > 0 {
+				server.ErrorLimit = limit
+			}
+		}
+	}
+	if server.Observe != ObserveLayer4 && (server.Observe != ObserveLayer7 || backend.Mode == ModeTCP) {
+		server.Observe = ""
+	}
+	if server.Observe == "" || !containsString(onErrorActions, server.OnError) {
+		server.OnError = ""
+	}
+	if server.Observe == "" {
+		server.ErrorLimit = 0
+	}
+}
+
+// outlierDetectionMatches checks if observe, on-error and error-limit of the existing default
+// server match the desired ones
+func outlierDetectionMatches(existing, desired *haproxy.Backend) bool {
+	return existing.DefaultServer != nil &&
+		existing.DefaultServer.Observe == desired.DefaultServer.Observe &&
+		existing.DefaultServer.OnError == desired.DefaultServer.OnError &&
+		existing.DefaultServer.ErrorLimit == desired.DefaultServer.ErrorLimit
+}
@@ -0,0 +1,70 @@
+package connector
+
+import "testing"
+
+func TestBuildDesiredBackendOutlierDetection(t *testing.T) {
+	tests := []struct {
+		name       string
+		tags       []string
+		disabled   bool
+		observe    string
+		onError    string
+		errorLimit int
+	}{
+		{name: "no outlier tags", tags: []string{"haproxy.enable=true"}},
+		{name: "layer7 mark-down",
+			tags:    []string{"haproxy.check.observe=layer7", "haproxy.check.on_error=mark-down", "haproxy.check.error_limit=5"},
+			observe: "layer7", onError: "mark-down", errorLimit: 5},
+		{name: "layer7 not in tcp mode", tags: []string{"haproxy.mode=tcp", "haproxy.check.observe=layer7", "haproxy.check.on_error=mark-down"}},
+		{name: "layer4 in tcp mode", tags: []string{"haproxy.mode=tcp", "haproxy.check.observe=layer4"}, observe: "layer4"},
+		{name: "on_error without observe", tags: []string{"haproxy.check.on_error=mark-down", "haproxy.check.error_limit=5"}},
+		{name: "invalid action ignored", tags: []string{"haproxy.check.observe=layer4", "haproxy.check.on_error=panic"}, observe: "layer4"},
+		{name: "checks disabled", tags: []string{"haproxy.check.observe=layer4"}, disabled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := buildDesiredBackend("api", &HealthCheckConfig{Disabled: tt.disabled}, tt.tags)
+			server := backend.DefaultServer
+			if server.Observe != tt.observe || server.OnError != tt.onError || server.ErrorLimit != tt.errorLimit {
+				t.Errorf("Got observe %q, on-error %q, error-limit %d, expected %q, %q, %d",
+					server.Observe, server.OnError, server.ErrorLimit, tt.observe, tt.onError, tt.errorLimit)
+			}
+		})
+	}
+}
+
+func TestBackendConfigMatchesOutlierDetection(t *testing.T) {
+	plain := buildDesiredBackend("api", nil, nil)
+	observed := buildDesiredBackend("api", nil, []string{"haproxy.check.observe=layer7", "haproxy.check.on_error=mark-down"})
+	limited := buildDesiredBackend("api", nil, []string{"haproxy.check.observe=layer7", "haproxy.check.on_error=mark-down",
+		"haproxy.check.error_limit=3"})
+
+	if !backendConfigMatches(observed, observed, nil, nil) {
+		t.Error("Expected identical backends to match")
+	}
+	if backendConfigMatches(plain, observed, nil, nil) {
+		t.Error("Expected enabling outlier detection to require an update")
+	}
+	if backendConfigMatches(observed, limited, nil, nil) {
+		t.Error("Expected a changed error limit to require an update")
+	}
+	if backendConfigMatches(limited, plain, nil, nil) {
+		t.Error("Expected removing outlier detection to require an update")
+	}
+}
+
+func TestCheckTagOutlierDetection(t *testing.T) {
+	for tag, valid := range map[string]bool{
+		"haproxy.check.observe=layer7":        true,
+		"haproxy.check.observe=layer3":        false,
+		"haproxy.check.on_error=sudden-death": true,
+		"haproxy.check.on_error=restart":      false,
+		"haproxy.check.error_limit=5":         true,
+		"haproxy.check.error_limit=0":         false,
+	} {
+		if problem := checkTag(tag); (problem == "") != valid {
+			t.Errorf("checkTag(%q) = %q, expected valid: %v", tag, problem, valid)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package connector
+
+import (
+	"log"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Overlap constants
+const (
+	// StatusWaitingForOverlap is reported for deregistered servers kept until a replacement is established
+	StatusWaitingForOverlap = "waiting_for_overlap"
+
+	OverlapPollInterval = time.Second
+)
+
+// overlapSatisfied checks if the backend has another ready and healthy server that has been registered
+// for at least minOverlap, so draining serverName doesn't leave the backend without working servers.
+// Servers the connector hasn't seen registering count as established.
+func (hs *handlerState) overlapSatisfied(client haproxy.ClientInterface, backendName, serverName string, minOverlap time.Duration) bool {
+	servers, err := client.GetServers(backendName)
+	if err != nil {
+		return false
+	}
+
+	for _, server := range servers {
+		if server.Name == serverName {
+			continue
+		}
+		if since, tracked := hs.allocations.registeredSince(backendName, server.Name); tracked && time.Since(since) < minOverlap {
+			continue
+		}
+		runtime, err := client.GetRuntimeServer(backendName, server.Name)
+		if err != nil || runtime.AdminState != "ready" || runtime.OperationalState != "up" {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// servingServers counts the servers of the backend that keep serving traffic once serverName is
+// removed: ready servers that are healthy, or still starting after the connector registered them.
+// Free slots, servers waiting for their removal and servers in drain or maintenance don't count.
+// Servers whose runtime state can't be read count, to rather keep the routing than cut it.
+func (hs *handlerState) servingServers(client haproxy.ClientInterface, backendName, serverName string, servers []haproxy.Server) int {
+	serving := 0
+	for i := range servers {
+		server := &servers[i]
+		if server.Name == serverName || isFreeSlot(server) || hs.removals.has(backendName, server.Name) {
+			continue
+		}
+		runtime, err := client.GetRuntimeServer(backendName, server.Name)
+		if err != nil {
+			serving++
+			continue
+		}
+		if runtime.AdminState != "ready" {
+			continue
+		}
+		if _, starting := hs.allocations.registeredSince(backendName, server.Name); runtime.OperationalState == "up" || starting {
+			serving++
+		}
+	}
+	return serving
+}
+
+// drainAfterOverlap keeps a deregistered server in rotation until another healthy server has been
+// up for minOverlap (or maxWait passed), then drains and removes it. During fast redeploys this
+// prevents draining the old allocation before the new one has taken over.
+// Aborts if the server registers again in the meantime.
+func (hs *handlerState) drainAfterOverlap(
+	client haproxy.ClientInterface,
+	backendName, serverName string,
+	minOverlap, maxWait time.Duration,
+	drainTimeoutSec int,
+	logger *log.Logger,
+) {
+	cancelCh := hs.removals.schedule(backendName, serverName, time.Time{})
+
+	ticker := time.NewTicker(OverlapPollInterval)
+	defer ticker.Stop()
+	deadline := time.After(maxWait)
+
+wait:
+	for !hs.overlapSatisfied(client, backendName, serverName, minOverlap) {
+		select {
+		case <-cancelCh:
+			if logger != nil {
+				logger.Printf("Kept server %s in backend %s: server re-registered", serverName, backendName)
+			}
+			return
+		case <-hs.removals.done():
+			// Handed over to the next leader with the pending removals
+			return
+		case <-deadline:
+			if logger != nil {
+				logger.Printf("Warning: no established replacement for server %s in backend %s after %s, draining anyway",
+					serverName, backendName, maxWait)
+			}
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	defer hs.locks.lock(backendName)()
+	if removalCanceled(cancelCh) {
+		if logger != nil {
+			logger.Printf("Kept server %s in backend %s: server re-registered", serverName, backendName)
+		}
+		return
+	}
+	hs.removals.finish(backendName, serverName, cancelCh)
+	hs.drainLater(client, backendName, serverName, drainTimeoutSec, logger)
+}
+
+// maxOverlapWait returns how long to wait for an established replacement before draining anyway
+func maxOverlapWait(cfg *config.HAProxyConfig) time.Duration {
+	if cfg.MaxOverlapWaitSec <= 0 {
+		return config.DefaultMaxOverlapWaitSec * time.Second
+	}
+	return time.Duration(cfg.MaxOverlapWaitSec) * time.Second
+}
+
+// drainLater drains and removes a server outside of event processing, logging failures
+func (hs *handlerState) drainLater(client haproxy.ClientInterface, backendName, serverName string, drainTimeoutSec int, logger *log.Logger) {
+	if err := hs.drainAndRemoveServer(client, backendName, serverName, drainTimeoutSec, logger, map[string]string{}); err != nil && logger != nil {
+		logger.Printf("Warning: failed to drain server %s from backend %s: %v", serverName, backendName, err)
+	}
+}
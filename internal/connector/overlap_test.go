@@ -0,0 +1,141 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// overlapMockClient reports runtime states per server
+type overlapMockClient struct {
+	mockHAProxyClient
+	runtime map[string]haproxy.RuntimeServer
+}
+
+func (m *overlapMockClient) GetRuntimeServer(backendName, serverName string) (*haproxy.RuntimeServer, error) {
+	runtime := m.runtime[serverName]
+	return &runtime, nil
+}
+
+func (m *overlapMockClient) drained() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.drainCalled
+}
+
+func newOverlapMockClient(servers ...string) *overlapMockClient {
+	client := &overlapMockClient{runtime: make(map[string]haproxy.RuntimeServer)}
+	client.backendServers = map[string][]haproxy.Server{}
+	for _, name := range servers {
+		client.backendServers["web"] = append(client.backendServers["web"], haproxy.Server{Name: name})
+		client.runtime[name] = haproxy.RuntimeServer{AdminState: "ready", OperationalState: "up"}
+	}
+	return client
+}
+
+func TestOverlapSatisfied(t *testing.T) {
+	hs := newHandlerState()
+	client := newOverlapMockClient("web_old", "web_new")
+	hs.allocations.record("alloc-new", "node-1", "web", "web_new")
+
+	if hs.overlapSatisfied(client, "web", "web_old", time.Hour) {
+		t.Error("Expected a server registered just now not to count as established")
+	}
+	if !hs.overlapSatisfied(client, "web", "web_old", 0) {
+		t.Error("Expected the healthy new server to satisfy an overlap of 0")
+	}
+
+	client.runtime["web_new"] = haproxy.RuntimeServer{AdminState: "ready", OperationalState: "down"}
+	if hs.overlapSatisfied(client, "web", "web_old", 0) {
+		t.Error("Expected an unhealthy server not to count")
+	}
+
+	// Servers registered before the connector started count as established
+	client.backendServers["web"] = append(client.backendServers["web"], haproxy.Server{Name: "web_other"})
+	client.runtime["web_other"] = haproxy.RuntimeServer{AdminState: "ready", OperationalState: "up"}
+	if !hs.overlapSatisfied(client, "web", "web_old", time.Hour) {
+		t.Error("Expected the untracked healthy server to count as established")
+	}
+}
+
+func TestDeregistrationWaitsForOverlap(t *testing.T) {
+	hs := newHandlerState()
+	client := newOverlapMockClient("web_10_0_0_1_8080", "web_10_0_0_2_8080")
+	hs.allocations.record("alloc-new", "node-1", "web", "web_10_0_0_2_8080")
+
+	cfg := &config.Config{HAProxy: config.HAProxyConfig{MinOverlapSec: 60, MaxOverlapWaitSec: 60}}
+	event := &ServiceEvent{
+		Type:    EventTypeServiceDeregistration,
+		Service: Service{ServiceName: "web", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+	}
+
+	result, err := hs.handleServiceDeregistrationWithDrainTimeout(context.Background(), client, event, cfg, 0, nil)
+	if err != nil {
+		t.Fatalf("Deregistration failed: %v", err)
+	}
+	if status := result.(map[string]string)["status"]; status != StatusWaitingForOverlap {
+		t.Fatalf("Expected status %s, got %s", StatusWaitingForOverlap, status)
+	}
+
+	// Re-registering the old server keeps it
+	time.Sleep(10 * time.Millisecond)
+	if !hs.removals.cancel("web", "web_10_0_0_1_8080") {
+		t.Fatal("Expected the server to wait as pending removal")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if client.drained() {
+		t.Error("Expected the re-registered server not to be drained")
+	}
+}
+
+func TestDrainAfterOverlapGivesUp(t *testing.T) {
+	hs := newHandlerState()
+	client := newOverlapMockClient("web_old", "web_new")
+	client.runtime["web_new"] = haproxy.RuntimeServer{AdminState: "ready", OperationalState: "down"}
+
+	hs.drainAfterOverlap(client, "web", "web_old", time.Minute, 10*time.Millisecond, 0, nil)
+	if !client.drained() {
+		t.Error("Expected the server to be drained after the maximum wait")
+	}
+}
+
+func TestServingServers(t *testing.T) {
+	hs := newHandlerState()
+	client := newOverlapMockClient("web_old", "web_up", "web_down", "web_drain", "web_starting", "web_leaving")
+	client.runtime["web_down"] = haproxy.RuntimeServer{AdminState: "ready", OperationalState: "down"}
+	client.runtime["web_drain"] = haproxy.RuntimeServer{AdminState: "drain", OperationalState: "up"}
+	client.runtime["web_starting"] = haproxy.RuntimeServer{AdminState: "ready", OperationalState: "down"}
+	hs.allocations.record("alloc-starting", "node-1", "web", "web_starting")
+	hs.removals.schedule("web", "web_leaving", time.Time{})
+
+	// web_up is healthy, web_starting was registered by the connector and is still starting
+	if serving := hs.servingServers(client, "web", "web_old", client.backendServers["web"]); serving != 2 {
+		t.Errorf("Expected 2 serving servers, got %d", serving)
+	}
+}
+
+func TestDeregistrationRemovesRuleWhenOnlyDrainingServersRemain(t *testing.T) {
+	hs := newHandlerState()
+	client := newOverlapMockClient("web_10_0_0_1_8080", "web_10_0_0_2_8080")
+	client.runtime["web_10_0_0_2_8080"] = haproxy.RuntimeServer{AdminState: "drain", OperationalState: "up"}
+	event := &ServiceEvent{
+		Type: EventTypeServiceDeregistration,
+		Service: Service{
+			ServiceName: "web",
+			Address:     "10.0.0.1",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=" + testDomain},
+		},
+	}
+
+	result, err := hs.handleServiceDeregistrationWithDrainTimeout(context.Background(), client, event, &config.Config{}, 60, nil)
+	if err != nil {
+		t.Fatalf("Deregistration failed: %v", err)
+	}
+	if removed := result.(map[string]string)["frontend_rule_removed"]; removed != testDomain {
+		t.Errorf("Expected the domain rule to be removed, got %v", result)
+	}
+}
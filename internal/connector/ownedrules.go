@@ -0,0 +1,166 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+// OwnedRulesState is the state key of the domain rules the connector created
+const OwnedRulesState = "owned_rules.json"
+
+// ownedRule is a domain rule the connector created in a frontend
+type ownedRule struct {
+	Frontend string `json:"frontend"`
+	Domain   string `json:"domain"`
+	Backend  string `json:"backend"`
+}
+
+type ownedRuleTracker struct {
+	mu    sync.Mutex
+	rules map[string]ownedRule
+	// authoritative is set once a record was loaded or the initial sync recorded the rules of this
+	// run; before, every rule named the connector's way counts as owned
+	authoritative bool
+	dirty         bool
+}
+
+func newOwnedRuleTracker() *ownedRuleTracker {
+	return &ownedRuleTracker{rules: make(map[string]ownedRule)}
+}
+
+func ownedRuleKey(frontend, domain string) string {
+	return frontend + "|" + domain
+}
+
+// add records a rule the connector created or found in place for one of its services
+func (t *ownedRuleTracker) add(frontend, domain, backend string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := ownedRuleKey(frontend, domain)
+	rule := ownedRule{Frontend: frontend, Domain: domain, Backend: backend}
+	if t.rules[key] != rule {
+		t.rules[key] = rule
+		t.dirty = true
+	}
+}
+
+// remove forgets a rule the connector removed
+func (t *ownedRuleTracker) remove(frontend, domain string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := ownedRuleKey(frontend, domain)
+	if _, ok := t.rules[key]; ok {
+		delete(t.rules, key)
+		t.dirty = true
+	}
+}
+
+// owns checks if the rule of a domain in a frontend was created by the connector
+func (t *ownedRuleTracker) owns(frontend, domain string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.authoritative {
+		return true
+	}
+	_, ok := t.rules[ownedRuleKey(frontend, domain)]
+	return ok
+}
+
+// restore merges the persisted record into the rules recorded since the start
+func (t *ownedRuleTracker) restore(rules []ownedRule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, rule := range rules {
+		key := ownedRuleKey(rule.Frontend, rule.Domain)
+		if _, ok := t.rules[key]; !ok {
+			t.rules[key] = rule
+		}
+	}
+	t.authoritative = true
+}
+
+// settle makes the record authoritative after the initial sync recorded the rules of all services,
+// so rules of others named the connector's way are no longer taken for the connector's
+func (t *ownedRuleTracker) settle() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.authoritative {
+		t.authoritative = true
+		t.dirty = true
+	}
+}
+
+// takeSnapshot returns the recorded rules if they changed since the last snapshot
+func (t *ownedRuleTracker) takeSnapshot() ([]ownedRule, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.dirty {
+		return nil, false
+	}
+	rules := make([]ownedRule, 0, len(t.rules))
+	for _, rule := range t.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return ownedRuleKey(rules[i].Frontend, rules[i].Domain) < ownedRuleKey(rules[j].Frontend, rules[j].Domain)
+	})
+	t.dirty = false
+	return rules, true
+}
+
+// markDirty makes the next snapshot return the rules again, after persisting them failed
+func (t *ownedRuleTracker) markDirty() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dirty = true
+}
+
+// restoreOwnedRules loads the record of the rules created by the previous run (or leader)
+func (c *Connector) restoreOwnedRules(ctx context.Context) {
+	hs := c.currentHandlers()
+	data, err := c.state.Get(ctx, OwnedRulesState)
+	if errors.Is(err, state.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		c.logger.Printf("Warning: Failed to load owned frontend rules: %v", err)
+		return
+	}
+
+	var rules []ownedRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		c.logger.Printf("Warning: Invalid owned frontend rules state: %v", err)
+		return
+	}
+	hs.ownedRules.restore(rules)
+}
+
+// persistOwnedRules stores the record of the created rules if it changed
+func (c *Connector) persistOwnedRules() {
+	hs := c.currentHandlers()
+	rules, changed := hs.ownedRules.takeSnapshot()
+	if !changed {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(rules)
+	if err == nil {
+		err = c.state.Put(ctx, OwnedRulesState, data)
+	}
+	if err != nil {
+		hs.ownedRules.markDirty()
+		c.logger.Printf("Warning: Failed to persist owned frontend rules: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+func TestOwnedRulesPersistedAndRestored(t *testing.T) {
+	c := &Connector{
+		config: &config.Config{},
+		state:  state.NewFileStore(t.TempDir()),
+		logger: log.New(io.Discard, "", 0),
+	}
+	hs := c.currentHandlers()
+
+	// Without a record every rule named the connector's way counts as owned
+	if !hs.ownedRules.owns("https", "other.example.com") {
+		t.Fatal("Expected rules to be owned before a record exists")
+	}
+
+	hs.ownedRules.add("https", "api.example.com", "api")
+	hs.ownedRules.add("https", "old.example.com", "old")
+	hs.ownedRules.remove("https", "old.example.com")
+	c.persistOwnedRules()
+
+	// The next leadership knows its rules
+	hs = c.startHandlers()
+	c.restoreOwnedRules(context.Background())
+	if !hs.ownedRules.owns("https", "api.example.com") {
+		t.Error("Expected the recorded rule to be owned")
+	}
+	if hs.ownedRules.owns("https", "old.example.com") || hs.ownedRules.owns("https", "other.example.com") {
+		t.Error("Expected rules missing in the record not to be owned")
+	}
+	if _, changed := hs.ownedRules.takeSnapshot(); changed {
+		t.Error("Expected restoring not to require persisting the record again")
+	}
+}
+
+func TestRemoveOrphanRules_SkipsRulesOfOtherConnectors(t *testing.T) {
+	hs := newHandlerState()
+	hs.ownedRules.restore([]ownedRule{{Frontend: "https", Domain: "gone.example.com", Backend: "gone"}})
+
+	client := &mockHAProxyClient{
+		backends: map[string]*haproxy.Backend{},
+		frontendRules: map[string][]haproxy.FrontendRule{
+			"https": {
+				{Domain: "gone.example.com", Backend: "gone", Managed: true},
+				{Domain: "elsewhere.example.com", Backend: "elsewhere", Managed: true},
+			},
+		},
+	}
+	c := &Connector{
+		config:        &config.Config{HAProxy: config.HAProxyConfig{Frontend: "https"}},
+		haproxyClient: client,
+		nomadClient:   &fakeNomadClient{services: []*nomad.Service{}},
+		logger:        log.New(io.Discard, "", 0),
+		handlers:      hs,
+	}
+
+	removed, err := c.removeOrphanRules()
+	if err != nil {
+		t.Fatalf("removeOrphanRules() failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Domain != "gone.example.com" {
+		t.Fatalf("Expected only the connector's own rule to be removed, got %+v", removed)
+	}
+	if hs.ownedRules.owns("https", "gone.example.com") {
+		t.Error("Expected the removed rule to be dropped from the record")
+	}
+}
+
+func TestOwnedRulesAuthoritativeAfterInitialSync(t *testing.T) {
+	hs := newHandlerState()
+	hs.ownedRules.add("https", "api.example.com", "api")
+	hs.ownedRules.settle()
+
+	if !hs.ownedRules.owns("https", "api.example.com") {
+		t.Error("Expected the rule recorded by the sync to be owned")
+	}
+	if hs.ownedRules.owns("https", "other.example.com") {
+		t.Error("Expected rules the sync didn't record not to be owned, even without a persisted record")
+	}
+	if _, changed := hs.ownedRules.takeSnapshot(); !changed {
+		t.Error("Expected the settled record to be persisted, so the next run starts authoritative")
+	}
+}
+
+func TestExistingRuleWrittenByHandNotClaimed(t *testing.T) {
+	hs := newHandlerState()
+	hs.ownedRules.settle()
+	client := &mockHAProxyClient{frontendRules: map[string][]haproxy.FrontendRule{
+		"https": {
+			{Domain: "hand.example.com", Backend: "api"},
+			{Domain: "api.example.com", Backend: "api", Managed: true},
+		},
+	}}
+
+	for _, domain := range []string{"hand.example.com", "api.example.com"} {
+		mapping := &haproxy.DomainMapping{Domain: domain, BackendName: "api", Type: haproxy.DomainTypeExact}
+		if _, err := hs.reconcileFrontendRuleIn(client, "https", mapping, "api", ""); err != nil {
+			t.Fatalf("reconcileFrontendRuleIn() failed: %v", err)
+		}
+	}
+	if hs.ownedRules.owns("https", "hand.example.com") {
+		t.Error("Expected the rule written by hand to stay someone else's")
+	}
+	if !hs.ownedRules.owns("https", "api.example.com") {
+		t.Error("Expected the existing rule named the connector's way to be claimed")
+	}
+}
@@ -0,0 +1,160 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+// PauseTag makes the connector ignore the events of the service, leaving HAProxy as it is
+const PauseTag = "haproxy.pause=true"
+
+// PausedServicesState is the state key of the services paused on the admin API
+const PausedServicesState = "paused_services.json"
+
+// StatusPaused is the result status of an event ignored because its service is paused
+const StatusPaused = "paused"
+
+// Pause actions of the per-service admin API
+const (
+	ActionPause  = "pause"
+	ActionResume = "resume"
+)
+
+// PauseResult is the response of POST /api/v1/services/{name}/pause and /resume
+type PauseResult struct {
+	Service string     `json:"service"`
+	Paused  bool       `json:"paused"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// pauseSet is a set of paused service names with the time they were paused, safe for concurrent use
+type pauseSet struct {
+	mu       sync.Mutex
+	services map[string]time.Time
+}
+
+func newPauseSet() *pauseSet {
+	return &pauseSet{services: make(map[string]time.Time)}
+}
+
+// pause pauses the service, returns when it was paused
+func (s *pauseSet) pause(serviceName string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since, ok := s.services[serviceName]
+	if !ok {
+		since = time.Now()
+		s.services[serviceName] = since
+	}
+	return since
+}
+
+// resume resumes the service, returns false if it was not paused
+func (s *pauseSet) resume(serviceName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.services[serviceName]; !ok {
+		return false
+	}
+	delete(s.services, serviceName)
+	return true
+}
+
+func (s *pauseSet) has(serviceName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.services[serviceName]
+	return ok
+}
+
+func (s *pauseSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.services)
+}
+
+// snapshot returns the paused services and when they were paused
+func (s *pauseSet) snapshot() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	services := make(map[string]time.Time, len(s.services))
+	for name, since := range s.services {
+		services[name] = since
+	}
+	return services
+}
+
+// replace replaces the paused services with a persisted set
+func (s *pauseSet) replace(services map[string]time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services = make(map[string]time.Time, len(services))
+	for name, since := range services {
+		s.services[name] = since
+	}
+}
+
+// isPaused checks if the service was paused on the admin API or is tagged haproxy.pause=true
+func (hs *handlerState) isPaused(serviceName string, tags []string) bool {
+	return hasTag(tags, PauseTag) || hs.paused.has(serviceName)
+}
+
+// handlePause pauses or resumes a service. Events of a paused service are ignored and its backend is
+// left out of the stale server cleanup, until it is resumed; resuming doesn't replay the ignored
+// events, a resync catches up on them.
+func (a *serviceAPI) handlePause(w http.ResponseWriter, serviceName, action string) {
+	paused := a.handlers().paused
+	result := PauseResult{Service: serviceName}
+	if action == ActionPause {
+		since := paused.pause(serviceName)
+		result.Paused, result.Since = true, &since
+	} else {
+		paused.resume(serviceName)
+	}
+	if a.persistPaused != nil {
+		a.persistPaused()
+	}
+	writeJSON(w, result)
+}
+
+// persistPausedServices stores the paused services, so they stay paused after a restart or failover
+func (c *Connector) persistPausedServices() {
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(c.currentHandlers().paused.snapshot())
+	if err == nil {
+		err = c.state.Put(ctx, PausedServicesState, data)
+	}
+	if err != nil {
+		c.logger.Printf("Warning: Failed to persist paused services: %v", err)
+	}
+}
+
+// restorePausedServices loads the services paused on the admin API of the previous run (or leader)
+func (c *Connector) restorePausedServices(ctx context.Context) {
+	data, err := c.state.Get(ctx, PausedServicesState)
+	if errors.Is(err, state.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		c.logger.Printf("Warning: Failed to load paused services: %v", err)
+		return
+	}
+
+	var services map[string]time.Time
+	if err := json.Unmarshal(data, &services); err != nil {
+		c.logger.Printf("Warning: Invalid paused services state: %v", err)
+		return
+	}
+	c.currentHandlers().paused.replace(services)
+	if len(services) > 0 {
+		c.logger.Printf("Restored %d paused services", len(services))
+	}
+}
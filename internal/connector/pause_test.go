@@ -0,0 +1,81 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func pauseTestEvent(tags ...string) nomad.ServiceEvent {
+	return nomad.ServiceEvent{
+		Type: EventTypeServiceDeregistration,
+		Payload: nomad.Payload{Service: &nomad.Service{
+			ServiceName: "api", Address: "10.0.0.1", Port: 8080, Tags: append([]string{"haproxy.enable=true"}, tags...),
+		}},
+	}
+}
+
+func TestServiceAPI_PauseAndResume(t *testing.T) {
+	hs := newHandlerState()
+	ctx := withHandlerState(context.Background(), hs)
+	api := &serviceAPI{
+		client:      &mockHAProxyClient{},
+		nomadClient: &fakeNomadClient{},
+		handlers:    func() *handlerState { return hs },
+	}
+	logger := log.New(io.Discard, "", 0)
+
+	post := func(path string) PauseResult {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, http.NoBody))
+		var result PauseResult
+		if recorder.Code != http.StatusOK || json.Unmarshal(recorder.Body.Bytes(), &result) != nil {
+			t.Fatalf("Expected 200 with a result, got %d: %s", recorder.Code, recorder.Body.String())
+		}
+		return result
+	}
+
+	if result := post("/api/v1/services/api/pause"); !result.Paused || result.Since == nil {
+		t.Fatalf("Expected the service to be paused, got %+v", result)
+	}
+
+	client := &mockHAProxyClient{}
+	result, err := ProcessNomadServiceEvent(ctx, client, &fakeNomadClient{}, pauseTestEvent(), logger, testConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status := result.(map[string]string)["status"]; status != StatusPaused || client.drainCalled {
+		t.Errorf("Expected the event of the paused service to be ignored, got status %q", status)
+	}
+	expected := hs.buildExpectedServersMap([]*nomad.Service{pauseTestEvent().Payload.Service})
+	if _, ok := expected["api"]; ok {
+		t.Error("Expected the backend of the paused service to be left out of the cleanup")
+	}
+
+	if result := post("/api/v1/services/api/resume"); result.Paused {
+		t.Fatalf("Expected the service to be resumed, got %+v", result)
+	}
+	result, _ = ProcessNomadServiceEvent(ctx, client, &fakeNomadClient{}, pauseTestEvent(), logger, testConfig())
+	if status := result.(map[string]string)["status"]; status == StatusPaused {
+		t.Error("Expected the events of the resumed service to be processed")
+	}
+}
+
+func TestPauseTag(t *testing.T) {
+	client := &mockHAProxyClient{}
+	result, err := ProcessNomadServiceEvent(context.Background(), client, &fakeNomadClient{},
+		pauseTestEvent(PauseTag), log.New(io.Discard, "", 0), testConfig())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status := result.(map[string]string)["status"]; status != StatusPaused || client.drainCalled {
+		t.Errorf("Expected the event of the tagged service to be ignored, got status %q", status)
+	}
+}
@@ -0,0 +1,48 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Upstream protocol tags
+const (
+	ProtoTag = "haproxy.proto="
+	ALPNTag  = "haproxy.alpn="
+)
+
+// applyServerProtocol sets the protocol HAProxy speaks to the servers on the desired default server:
+// haproxy.proto=h2 for HTTP/2-only upstreams such as gRPC (h2c), haproxy.alpn=h2,http/1.1 for the
+// protocols offered to servers reached over TLS. proto is an HTTP mode setting, tcp services
+// ignore it.
+func applyServerProtocol(backend *haproxy.Backend, tags []string) {
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, ProtoTag):
+			if !isTCPMode(tags) {
+				backend.DefaultServer.Proto = strings.TrimPrefix(tag, ProtoTag)
+			}
+		case strings.HasPrefix(tag, ALPNTag):
+			backend.DefaultServer.ALPN = strings.TrimPrefix(tag, ALPNTag)
+		}
+	}
+}
+
+// serverProtocolMatches checks if proto and alpn of the existing default server match the desired ones
+func serverProtocolMatches(existing, desired *haproxy.Backend) bool {
+	return existing.DefaultServer != nil &&
+		existing.DefaultServer.Proto == desired.DefaultServer.Proto &&
+		existing.DefaultServer.ALPN == desired.DefaultServer.ALPN
+}
+
+// alpnValue checks a comma separated list of ALPN protocol names, e.g. h2,http/1.1
+func alpnValue(value string) error {
+	for _, protocol := range strings.Split(value, ",") {
+		if protocol == "" || strings.ContainsAny(protocol, " \t") {
+			return fmt.Errorf("expected a comma separated list of protocols, e.g. h2,http/1.1")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package connector
+
+import "testing"
+
+func TestBuildDesiredBackendServerProtocol(t *testing.T) {
+	tests := []struct {
+		name  string
+		tags  []string
+		proto string
+		alpn  string
+	}{
+		{name: "no protocol tags", tags: []string{"haproxy.enable=true"}},
+		{name: "h2c upstream", tags: []string{"haproxy.proto=h2"}, proto: "h2"},
+		{name: "alpn", tags: []string{"haproxy.alpn=h2,http/1.1"}, alpn: "h2,http/1.1"},
+		{name: "proto ignored in tcp mode", tags: []string{"haproxy.mode=tcp", "haproxy.proto=h2", "haproxy.alpn=h2"}, alpn: "h2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := buildDesiredBackend("grpc", nil, tt.tags)
+			if backend.DefaultServer.Proto != tt.proto {
+				t.Errorf("DefaultServer.Proto = %q, expected %q", backend.DefaultServer.Proto, tt.proto)
+			}
+			if backend.DefaultServer.ALPN != tt.alpn {
+				t.Errorf("DefaultServer.ALPN = %q, expected %q", backend.DefaultServer.ALPN, tt.alpn)
+			}
+		})
+	}
+}
+
+func TestBackendConfigMatchesServerProtocol(t *testing.T) {
+	plain := buildDesiredBackend("grpc", nil, nil)
+	h2 := buildDesiredBackend("grpc", nil, []string{"haproxy.proto=h2"})
+	alpn := buildDesiredBackend("grpc", nil, []string{"haproxy.alpn=h2,http/1.1"})
+
+	if !backendConfigMatches(h2, h2, nil, nil) {
+		t.Error("Expected identical backends to match")
+	}
+	if backendConfigMatches(plain, h2, nil, nil) {
+		t.Error("Expected adding proto to require an update")
+	}
+	if backendConfigMatches(alpn, plain, nil, nil) {
+		t.Error("Expected removing alpn to require an update")
+	}
+}
+
+func TestCheckTagServerProtocol(t *testing.T) {
+	for tag, valid := range map[string]bool{
+		"haproxy.proto=h2":          true,
+		"haproxy.proto=h3":          false,
+		"haproxy.alpn=h2,http/1.1":  true,
+		"haproxy.alpn=h2,,http/1.1": false,
+	} {
+		if problem := checkTag(tag); (problem == "") != valid {
+			t.Errorf("checkTag(%q) = %q, expected valid: %v", tag, problem, valid)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Rate limiting constants
+const (
+	RateLimitRPSTag        = "haproxy.ratelimit.rps="
+	RateLimitBurstTag      = "haproxy.ratelimit.burst="
+	RateLimitTablePrefix   = "ratelimit_"
+	RateLimitPeriodSec     = 10
+	RateLimitTableSize     = 100000
+	RuleTypeTrackSC        = "track-sc"
+	RuleTypeDeny           = "deny"
+	RateLimitTrackKey      = "src"
+	RateLimitStickCounter0 = 0
+)
+
+// rateLimit is the per-client request rate allowed for a service's domain
+type rateLimit struct {
+	RPS   int
+	Burst int
+}
+
+// parseRateLimit reads haproxy.ratelimit.rps and haproxy.ratelimit.burst tags.
+// Returns nil if the service has no valid rps tag.
+func parseRateLimit(tags []string) *rateLimit {
+	limit := &rateLimit{}
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, RateLimitRPSTag):
+			limit.RPS, _ = strconv.Atoi(strings.TrimPrefix(tag, RateLimitRPSTag))
+		case strings.HasPrefix(tag, RateLimitBurstTag):
+			limit.Burst, _ = strconv.Atoi(strings.TrimPrefix(tag, RateLimitBurstTag))
+		}
+	}
+	if limit.RPS <= 0 {
+		return nil
+	}
+	limit.Burst = max(limit.Burst, 0)
+	return limit
+}
+
+// maxRequests is the number of requests a client may send per rate period: the sustained rate
+// plus the burst allowance
+func (l *rateLimit) maxRequests() int {
+	return l.RPS*RateLimitPeriodSec + l.Burst
+}
+
+// rateLimitTable returns the name of the backend holding the stick table of a service's rate limit
+func rateLimitTable(backendName string) string {
+	return RateLimitTablePrefix + backendName
+}
+
+// rateLimitTableBackend builds the table-only backend counting the request rate per client address
+func rateLimitTableBackend(backendName string) haproxy.Backend {
+	return haproxy.Backend{
+		Name:    rateLimitTable(backendName),
+		Mode:    ModeHTTP,
+		Balance: haproxy.Balance{Algorithm: "roundrobin"},
+		StickTable: &haproxy.StickTable{
+			Type:   StickTableTypeIP,
+			Size:   RateLimitTableSize,
+			Expire: RateLimitPeriodSec * 1000,
+			Store:  fmt.Sprintf("http_req_rate(%ds)", RateLimitPeriodSec),
+		},
+	}
+}
+
+// rateLimitRules builds the frontend rules tracking clients of the domain and denying them with 429
+// once they exceed the limit
+func (hs *handlerState) rateLimitRules(domainMapping *haproxy.DomainMapping, backendName string, limit *rateLimit) []haproxy.HTTPRequestRule {
+	table := rateLimitTable(backendName)
+	host := hs.hostCondition(domainMapping)
+	return []haproxy.HTTPRequestRule{
+		{
+			Type:                RuleTypeTrackSC,
+			TrackSCKey:          RateLimitTrackKey,
+			TrackSCTable:        table,
+			TrackSCStickCounter: RateLimitStickCounter0,
+			Cond:                CondIf,
+			CondTest:            host,
+		},
+		{
+			Type:       RuleTypeDeny,
+			DenyStatus: http.StatusTooManyRequests,
+			Cond:       CondIf,
+			CondTest:   fmt.Sprintf("%s { sc_http_req_rate(%d,%s) gt %d }", host, RateLimitStickCounter0, table, limit.maxRequests()),
+		},
+	}
+}
+
+// findRateLimitRules returns the indexes of the connector-managed rate limit rules of a backend, in order
+func findRateLimitRules(rules []haproxy.HTTPRequestRule, backendName string) []int {
+	table := rateLimitTable(backendName)
+	var indexes []int
+	for i := range rules {
+		switch {
+		case rules[i].Type == RuleTypeTrackSC && rules[i].TrackSCTable == table:
+			indexes = append(indexes, i)
+		case rules[i].Type == RuleTypeDeny && strings.Contains(rules[i].CondTest, ","+table+")"):
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// rateLimitRulesMatch checks if the managed rules found at indexes are exactly the desired rules
+func rateLimitRulesMatch(rules []haproxy.HTTPRequestRule, indexes []int, desired []haproxy.HTTPRequestRule) bool {
+	if len(indexes) != len(desired) {
+		return false
+	}
+	for i, index := range indexes {
+		if rules[index] != desired[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcileRateLimit installs the rate limit of services tagged with haproxy.ratelimit.rps on every frontend
+// the domain is published to, and removes it again once the tag is gone
+func (hs *handlerState) reconcileRateLimit(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	backendName string,
+	result map[string]string,
+	frontends []string,
+) error {
+	limit := parseRateLimit(tags)
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if limit == nil || domainMapping == nil {
+		if _, err := client.GetBackend(rateLimitTable(backendName)); err == nil {
+			removeRateLimit(client, backendName, result, parseFrontends(tags, frontends))
+		}
+		return nil
+	}
+
+	if _, err := client.GetBackend(rateLimitTable(backendName)); err != nil {
+		if !haproxy.IsNotFound(err) {
+			return fmt.Errorf("failed to get rate limit table: %w", err)
+		}
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for rate limit table: %w", err)
+		}
+		if _, err := client.CreateBackend(rateLimitTableBackend(backendName), version); err != nil {
+			return fmt.Errorf("failed to create rate limit table %s: %w", rateLimitTable(backendName), err)
+		}
+	}
+
+	desired := hs.rateLimitRules(domainMapping, backendName, limit)
+	for _, frontendName := range parseFrontends(tags, frontends) {
+		if err := reconcileRateLimitRulesIn(client, frontendName, backendName, desired); err != nil {
+			return err
+		}
+	}
+
+	result["ratelimit"] = fmt.Sprintf("%s: %d rps, burst %d", domainMapping.Domain, limit.RPS, limit.Burst)
+	return nil
+}
+
+// reconcileRateLimitRulesIn replaces the managed rate limit rules of a frontend if they differ from the desired ones
+func reconcileRateLimitRulesIn(client haproxy.ClientInterface, frontendName, backendName string, desired []haproxy.HTTPRequestRule) error {
+	rules, err := client.GetHTTPRequestRules(haproxy.ParentTypeFrontend, frontendName)
+	if err != nil {
+		return fmt.Errorf("failed to get http-request rules of frontend %s: %w", frontendName, err)
+	}
+
+	indexes := findRateLimitRules(rules, backendName)
+	if rateLimitRulesMatch(rules, indexes, desired) {
+		return nil
+	}
+
+	if err := deleteHTTPRequestRules(client, frontendName, indexes); err != nil {
+		return fmt.Errorf("failed to remove outdated rate limit rules from frontend %s: %w", frontendName, err)
+	}
+
+	// The track rule must precede the deny rule reading its counter
+	position := len(rules) - len(indexes)
+	for i := range desired {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version for rate limit rule: %w", err)
+		}
+		if err := client.CreateHTTPRequestRule(haproxy.ParentTypeFrontend, frontendName, position+i, &desired[i], version); err != nil {
+			return fmt.Errorf("failed to create rate limit rule in frontend %s: %w", frontendName, err)
+		}
+	}
+	return nil
+}
+
+// removeRateLimit removes the rate limit rules of a service from its frontends and then its stick table
+func removeRateLimit(client haproxy.ClientInterface, backendName string, result map[string]string, frontends []string) {
+	var warnings []string
+	for _, frontendName := range frontends {
+		rules, err := client.GetHTTPRequestRules(haproxy.ParentTypeFrontend, frontendName)
+		if err == nil {
+			err = deleteHTTPRequestRules(client, frontendName, findRateLimitRules(rules, backendName))
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to remove rate limit rules from %s: %v", frontendName, err))
+		}
+	}
+	if len(warnings) > 0 {
+		// The rules still reference the table, so it has to stay
+		result["ratelimit_warning"] = strings.Join(warnings, "; ")
+		return
+	}
+
+	version, err := client.GetConfigVersion()
+	if err == nil {
+		err = client.DeleteBackend(rateLimitTable(backendName), version)
+	}
+	if err != nil {
+		result["ratelimit_warning"] = fmt.Sprintf("failed to remove rate limit table: %v", err)
+		return
+	}
+	result["ratelimit_removed"] = rateLimitTable(backendName)
+}
+
+// deleteHTTPRequestRules deletes the frontend rules at the given ascending indexes, last first so
+// the remaining indexes stay valid
+func deleteHTTPRequestRules(client haproxy.ClientInterface, frontendName string, indexes []int) error {
+	for i := len(indexes) - 1; i >= 0; i-- {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return err
+		}
+		if err := client.DeleteHTTPRequestRule(haproxy.ParentTypeFrontend, frontendName, indexes[i], version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
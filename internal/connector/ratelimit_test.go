@@ -0,0 +1,100 @@
+package connector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		expected *rateLimit
+	}{
+		{name: "no tags", tags: []string{"haproxy.enable=true"}},
+		{name: "rps only", tags: []string{"haproxy.ratelimit.rps=20"}, expected: &rateLimit{RPS: 20}},
+		{name: "rps and burst", tags: []string{"haproxy.ratelimit.rps=20", "haproxy.ratelimit.burst=50"},
+			expected: &rateLimit{RPS: 20, Burst: 50}},
+		{name: "burst without rps", tags: []string{"haproxy.ratelimit.burst=50"}},
+		{name: "invalid rps", tags: []string{"haproxy.ratelimit.rps=many"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := parseRateLimit(tt.tags)
+			if (limit == nil) != (tt.expected == nil) || limit != nil && *limit != *tt.expected {
+				t.Errorf("parseRateLimit() = %+v, expected %+v", limit, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReconcileRateLimit(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{}
+	existing := haproxy.HTTPRequestRule{Type: "set-header", CondTest: "{ hdr(host) -i other.example.com }"}
+	mock.httpRequestRules = map[string][]haproxy.HTTPRequestRule{"frontends/https": {existing}}
+
+	tags := []string{"haproxy.enable=true", "haproxy.domain=api.example.com", "haproxy.ratelimit.rps=5"}
+	result := map[string]string{}
+	if err := hs.reconcileRateLimit(mock, "api", tags, "api", result, []string{"https"}); err != nil {
+		t.Fatalf("reconcileRateLimit() failed: %v", err)
+	}
+
+	rules := mock.httpRequestRules["frontends/https"]
+	if len(rules) != 3 || rules[0] != existing {
+		t.Fatalf("Expected rate limit rules after the existing rule, got %+v", rules)
+	}
+	if rules[1].Type != RuleTypeTrackSC || rules[1].TrackSCTable != "ratelimit_api" || rules[1].CondTest != "{ hdr(host) -i api.example.com }" {
+		t.Errorf("Expected track-sc rule for the domain, got %+v", rules[1])
+	}
+	if rules[2].Type != RuleTypeDeny || rules[2].DenyStatus != 429 || !strings.HasSuffix(rules[2].CondTest, "gt 50 }") {
+		t.Errorf("Expected deny rule above 50 requests per period, got %+v", rules[2])
+	}
+	if result["ratelimit"] == "" {
+		t.Errorf("Expected ratelimit result, got %v", result)
+	}
+
+	// Unchanged limit keeps the rules, a changed one replaces them
+	if err := hs.reconcileRateLimit(mock, "api", tags, "api", result, []string{"https"}); err != nil {
+		t.Fatalf("reconcileRateLimit() failed: %v", err)
+	}
+	if len(mock.httpRequestRules["frontends/https"]) != 3 {
+		t.Fatalf("Expected rules to be kept, got %+v", mock.httpRequestRules["frontends/https"])
+	}
+
+	tags = append(tags, "haproxy.ratelimit.burst=10")
+	if err := hs.reconcileRateLimit(mock, "api", tags, "api", result, []string{"https"}); err != nil {
+		t.Fatalf("reconcileRateLimit() failed: %v", err)
+	}
+	rules = mock.httpRequestRules["frontends/https"]
+	if len(rules) != 3 || rules[1].Type != RuleTypeTrackSC || !strings.HasSuffix(rules[2].CondTest, "gt 60 }") {
+		t.Errorf("Expected rules to be replaced with the burst allowance, got %+v", rules)
+	}
+}
+
+func TestRemoveRateLimit(t *testing.T) {
+	hs := newHandlerState()
+	mock := &mockHAProxyClient{}
+	limit := &rateLimit{RPS: 5}
+	domainMapping := &haproxy.DomainMapping{Domain: "api.example.com", Type: haproxy.DomainTypeExact}
+	mock.httpRequestRules = map[string][]haproxy.HTTPRequestRule{
+		"frontends/https": append(hs.rateLimitRules(domainMapping, "api", limit), hs.rateLimitRules(domainMapping, "web", limit)...),
+	}
+
+	result := map[string]string{}
+	removeRateLimit(mock, "api", result, []string{"https"})
+
+	rules := mock.httpRequestRules["frontends/https"]
+	if len(rules) != 2 || rules[0].TrackSCTable != "ratelimit_web" {
+		t.Errorf("Expected only the rules of the other service to remain, got %+v", rules)
+	}
+	if len(mock.deletedBackends) != 1 || mock.deletedBackends[0] != "ratelimit_api" {
+		t.Errorf("Expected rate limit table to be deleted, got %v", mock.deletedBackends)
+	}
+	if result["ratelimit_removed"] != "ratelimit_api" {
+		t.Errorf("Expected ratelimit_removed result, got %v", result)
+	}
+}
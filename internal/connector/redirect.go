@@ -0,0 +1,128 @@
+package connector
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Redirect rule constants
+const (
+	RedirectTypeScheme  = "scheme"
+	RedirectSchemeHTTPS = "https"
+	RuleTypeRedirect    = "redirect"
+	CondIf              = "if"
+
+	// RedirectMarker ends the condition of the https redirects the connector creates. The always
+	// true test doesn't change the condition, it tells them apart from redirects written by hand.
+	RedirectMarker = "{ always_true }"
+)
+
+// httpsRedirectRule builds the http-request redirect rule for a domain mapping
+func (hs *handlerState) httpsRedirectRule(domainMapping *haproxy.DomainMapping) *haproxy.HTTPRequestRule {
+	return &haproxy.HTTPRequestRule{
+		Type:       RuleTypeRedirect,
+		RedirType:  RedirectTypeScheme,
+		RedirValue: RedirectSchemeHTTPS,
+		RedirCode:  http.StatusMovedPermanently,
+		Cond:       CondIf,
+		CondTest:   hs.hostCondition(domainMapping) + " " + RedirectMarker,
+	}
+}
+
+// findHTTPSRedirect returns the index of the connector-managed https redirect for a condition, or -1.
+// Redirects written by hand lack the marker of the condition and are never found.
+func findHTTPSRedirect(rules []haproxy.HTTPRequestRule, condTest string) int {
+	for i := range rules {
+		if rules[i].Type == RuleTypeRedirect && rules[i].RedirType == RedirectTypeScheme && rules[i].CondTest == condTest &&
+			strings.HasSuffix(rules[i].CondTest, RedirectMarker) {
+			return i
+		}
+	}
+	return -1
+}
+
+// reconcileHTTPSRedirect installs a redirect scheme https rule on the HTTP frontend for
+// services tagged with haproxy.redirect.https=true, and removes it again once the tag is gone
+func (hs *handlerState) reconcileHTTPSRedirect(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	result map[string]string,
+	httpFrontend string,
+) error {
+	if httpFrontend == "" {
+		return nil
+	}
+	domainMapping := parseDomainMapping(serviceName, tags)
+	if domainMapping == nil {
+		return nil
+	}
+	if !hasTag(tags, "haproxy.redirect.https=true") {
+		hs.deleteHTTPSRedirect(client, domainMapping, result, httpFrontend)
+		return nil
+	}
+
+	rule := hs.httpsRedirectRule(domainMapping)
+	rules, err := client.GetHTTPRequestRules(haproxy.ParentTypeFrontend, httpFrontend)
+	if err != nil {
+		return fmt.Errorf("failed to get http-request rules of frontend %s: %w", httpFrontend, err)
+	}
+	if findHTTPSRedirect(rules, rule.CondTest) >= 0 {
+		result["https_redirect"] = "exists: " + domainMapping.Domain
+		return nil
+	}
+
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for https redirect: %w", err)
+	}
+	if err := client.CreateHTTPRequestRule(haproxy.ParentTypeFrontend, httpFrontend, len(rules), rule, version); err != nil {
+		return fmt.Errorf("failed to create https redirect for domain %s: %w", domainMapping.Domain, err)
+	}
+
+	result["https_redirect"] = "added: " + domainMapping.Domain
+	return nil
+}
+
+// removeHTTPSRedirect removes the https redirect rule of a service from the HTTP frontend
+func (hs *handlerState) removeHTTPSRedirect(client haproxy.ClientInterface, serviceName string, tags []string, result map[string]string, httpFrontend string) {
+	if httpFrontend == "" || !hasTag(tags, "haproxy.redirect.https=true") {
+		return
+	}
+	if domainMapping := parseDomainMapping(serviceName, tags); domainMapping != nil {
+		hs.deleteHTTPSRedirect(client, domainMapping, result, httpFrontend)
+	}
+}
+
+// deleteHTTPSRedirect deletes the https redirect the connector created for a domain, if any
+func (hs *handlerState) deleteHTTPSRedirect(
+	client haproxy.ClientInterface,
+	domainMapping *haproxy.DomainMapping,
+	result map[string]string,
+	httpFrontend string,
+) {
+	rules, err := client.GetHTTPRequestRules(haproxy.ParentTypeFrontend, httpFrontend)
+	if err != nil {
+		result["https_redirect_warning"] = fmt.Sprintf("failed to get http-request rules: %v", err)
+		return
+	}
+
+	index := findHTTPSRedirect(rules, hs.httpsRedirectRule(domainMapping).CondTest)
+	if index < 0 {
+		return
+	}
+
+	version, err := client.GetConfigVersion()
+	if err == nil {
+		err = client.DeleteHTTPRequestRule(haproxy.ParentTypeFrontend, httpFrontend, index, version)
+	}
+	if err != nil {
+		result["https_redirect_warning"] = fmt.Sprintf("failed to remove https redirect: %v", err)
+		return
+	}
+
+	result["https_redirect_removed"] = domainMapping.Domain
+}
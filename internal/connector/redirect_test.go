@@ -0,0 +1,185 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestHostCondition(t *testing.T) {
+	hs := newHandlerState()
+	tests := []struct {
+		name     string
+		mapping  haproxy.DomainMapping
+		expected string
+	}{
+		{
+			name:     "exact",
+			mapping:  haproxy.DomainMapping{Domain: "api.example.com", Type: haproxy.DomainTypeExact},
+			expected: "{ hdr(host) -i api.example.com }",
+		},
+		{name: "prefix", mapping: haproxy.DomainMapping{Domain: "api.", Type: haproxy.DomainTypePrefix}, expected: "{ hdr_beg(host) -i api. }"},
+		{
+			name:     "suffix",
+			mapping:  haproxy.DomainMapping{Domain: ".example.com", Type: haproxy.DomainTypeSuffix},
+			expected: "{ hdr_end(host) -i .example.com }",
+		},
+		{
+			name:     "regex",
+			mapping:  haproxy.DomainMapping{Domain: "^api\\..*$", Type: haproxy.DomainTypeRegex},
+			expected: "{ hdr_reg(host) ^api\\..*$ }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hs.hostCondition(&tt.mapping); got != tt.expected {
+				t.Errorf("hostCondition() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHostCondition_IgnoringPort(t *testing.T) {
+	hs := newHandlerState()
+
+	exact := haproxy.DomainMapping{Domain: "api.example.com", Type: haproxy.DomainTypeExact}
+	suffix := haproxy.DomainMapping{Domain: ".example.com", Type: haproxy.DomainTypeSuffix}
+
+	hs.hostMatch = haproxy.HostMatchStripPort
+	if got := hs.hostCondition(&exact); got != "{ hdr(host),field(1,:) -i api.example.com }" {
+		t.Errorf("Unexpected exact condition without port: %q", got)
+	}
+
+	hs.hostMatch = haproxy.HostMatchDomain
+	if got := hs.hostCondition(&exact); got != "{ hdr_dom(host) -i api.example.com }" {
+		t.Errorf("Unexpected exact hdr_dom condition: %q", got)
+	}
+	if got := hs.hostCondition(&suffix); got != "{ hdr(host),field(1,:) -m end -i .example.com }" {
+		t.Errorf("Expected suffix to strip the port with hdr_dom, got %q", got)
+	}
+}
+
+func redirectTestConfig() *config.Config {
+	cfg := testConfig()
+	cfg.HAProxy.HTTPFrontend = "http"
+	return cfg
+}
+
+func TestHTTPSRedirectTagInstallsAndRemovesRule(t *testing.T) {
+	mock := &mockHAProxyClient{}
+
+	event := &ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Service: Service{
+			ServiceName: "shop",
+			Address:     "10.0.0.7",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=shop.example.com", "haproxy.redirect.https=true"},
+		},
+	}
+
+	result, err := ProcessServiceEvent(context.Background(), mock, event, redirectTestConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+
+	rules, _ := mock.GetHTTPRequestRules(haproxy.ParentTypeFrontend, "http")
+	if len(rules) != 1 {
+		t.Fatalf("Expected one http-request rule on frontend http, got %+v", rules)
+	}
+	rule := rules[0]
+	if rule.Type != "redirect" || rule.RedirType != "scheme" || rule.RedirValue != "https" || rule.RedirCode != 301 {
+		t.Errorf("Unexpected redirect rule %+v", rule)
+	}
+	if rule.Cond != "if" || rule.CondTest != "{ hdr(host) -i shop.example.com } "+RedirectMarker {
+		t.Errorf("Unexpected redirect condition %q %q", rule.Cond, rule.CondTest)
+	}
+	if result.(map[string]string)["https_redirect"] == "" {
+		t.Errorf("Expected https_redirect in result, got %v", result)
+	}
+
+	// Registering a second instance must not duplicate the rule
+	event.Service.Address = "10.0.0.8"
+	if _, err := ProcessServiceEvent(context.Background(), mock, event, redirectTestConfig()); err != nil {
+		t.Fatalf("ProcessServiceEvent() second registration failed: %v", err)
+	}
+	if rules, _ := mock.GetHTTPRequestRules(haproxy.ParentTypeFrontend, "http"); len(rules) != 1 {
+		t.Fatalf("Expected redirect rule not to be duplicated, got %+v", rules)
+	}
+
+	event.Type = EventTypeServiceDeregistration
+	result, err = ProcessServiceEvent(context.Background(), mock, event, redirectTestConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() deregistration failed: %v", err)
+	}
+	if rules, _ := mock.GetHTTPRequestRules(haproxy.ParentTypeFrontend, "http"); len(rules) != 0 {
+		t.Errorf("Expected redirect rule to be removed, got %+v", rules)
+	}
+	if result.(map[string]string)["https_redirect_removed"] != "shop.example.com" {
+		t.Errorf("Expected https_redirect_removed in result, got %v", result)
+	}
+}
+
+func TestHTTPSRedirectNotInstalledWithoutTag(t *testing.T) {
+	mock := &mockHAProxyClient{}
+
+	event := &ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Service: Service{
+			ServiceName: "shop",
+			Address:     "10.0.0.7",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=shop.example.com"},
+		},
+	}
+
+	if _, err := ProcessServiceEvent(context.Background(), mock, event, redirectTestConfig()); err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	if rules, _ := mock.GetHTTPRequestRules(haproxy.ParentTypeFrontend, "http"); len(rules) != 0 {
+		t.Errorf("Expected no http-request rules, got %+v", rules)
+	}
+}
+
+func TestHTTPSRedirectRemovedWhenTagDropped(t *testing.T) {
+	manual := haproxy.HTTPRequestRule{
+		Type: RuleTypeRedirect, RedirType: RedirectTypeScheme, RedirValue: RedirectSchemeHTTPS,
+		Cond: CondIf, CondTest: "{ hdr(host) -i shop.example.com }",
+	}
+	mock := &mockHAProxyClient{}
+	if err := mock.CreateHTTPRequestRule(haproxy.ParentTypeFrontend, "http", 0, &manual, 1); err != nil {
+		t.Fatalf("CreateHTTPRequestRule() failed: %v", err)
+	}
+	ctx := withHandlerState(context.Background(), newHandlerState())
+
+	event := &ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Service: Service{
+			ServiceName: "shop", Address: "10.0.0.7", Port: 8080,
+			Tags: []string{"haproxy.enable=true", "haproxy.domain=shop.example.com", "haproxy.redirect.https=true"},
+		},
+	}
+	if _, err := ProcessServiceEvent(ctx, mock, event, redirectTestConfig()); err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	if rules, _ := mock.GetHTTPRequestRules(haproxy.ParentTypeFrontend, "http"); len(rules) != 2 {
+		t.Fatalf("Expected the redirect written by hand not to be taken for the connector's, got %+v", rules)
+	}
+
+	// The service is registered again without the tag
+	event.Service.Tags = []string{"haproxy.enable=true", "haproxy.domain=shop.example.com"}
+	result, err := ProcessServiceEvent(ctx, mock, event, redirectTestConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	rules, _ := mock.GetHTTPRequestRules(haproxy.ParentTypeFrontend, "http")
+	if len(rules) != 1 || rules[0] != manual {
+		t.Errorf("Expected only the connector's redirect to be removed, got %+v", rules)
+	}
+	if result.(map[string]string)["https_redirect_removed"] != "shop.example.com" {
+		t.Errorf("Expected https_redirect_removed in result, got %v", result)
+	}
+}
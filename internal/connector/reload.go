@@ -0,0 +1,120 @@
+package connector
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
+)
+
+// cfg returns the current configuration. A reload replaces it as a whole, so callers can keep
+// using the returned configuration for the event they process.
+func (c *Connector) cfg() *config.Config {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+	return c.config
+}
+
+// Reload applies the settings of a reloaded configuration that are read while processing events:
+// the log and tracing settings, drain and overlap timeouts, frontend names, backend strategy and maintenance
+// backend. They take effect with the next event. Added, changed and removed static services are
+// applied right away. Settings used to set up clients, frontends and
+// background tasks keep their value until the connector is restarted.
+// An invalid configuration is rejected as a whole and the current one is kept.
+func (c *Connector) Reload(cfg *config.Config) error {
+	if err := validateReloadable(cfg); err != nil {
+		return err
+	}
+
+	current := c.cfg()
+	updated := *current
+	updated.Log = cfg.Log
+	updated.Tracing = cfg.Tracing
+	reloadable := reloadableHAProxyFields(&cfg.HAProxy)
+	updated.HAProxy = applyHAProxyFields(current.HAProxy, reloadable)
+
+	for _, section := range restartRequiredChanges(current, cfg) {
+		c.logger.Printf("Warning: %s settings changed, they take effect after a restart", section)
+	}
+
+	updated.StaticServices = cfg.StaticServices
+
+	c.configMu.Lock()
+	c.config = &updated
+	c.configMu.Unlock()
+
+	if c.staticServices != nil {
+		c.staticServices.update(cfg.StaticServices)
+	}
+
+	c.logger.Printf("Configuration reloaded (frontends %s, drain timeout %ds)",
+		strings.Join(updated.HAProxy.DefaultFrontends(), ", "), updated.HAProxy.DrainTimeoutSec)
+	return nil
+}
+
+// validateReloadable checks the configuration before any of it is applied
+func validateReloadable(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := logging.Validate(&cfg.Log); err != nil {
+		return fmt.Errorf("invalid log configuration: %w", err)
+	}
+	return nil
+}
+
+// reloadableHAProxyFields returns the HAProxy settings a reload applies, all others zeroed
+func reloadableHAProxyFields(cfg *config.HAProxyConfig) config.HAProxyConfig {
+	return config.HAProxyConfig{
+		BackendStrategy:    cfg.BackendStrategy,
+		DrainTimeoutSec:    cfg.DrainTimeoutSec,
+		MinOverlapSec:      cfg.MinOverlapSec,
+		MaxOverlapWaitSec:  cfg.MaxOverlapWaitSec,
+		Frontend:           cfg.Frontend,
+		Frontends:          cfg.Frontends,
+		HTTPFrontend:       cfg.HTTPFrontend,
+		MaintenanceBackend: cfg.MaintenanceBackend,
+	}
+}
+
+// applyHAProxyFields returns cfg with the reloadable settings taken from reloadable
+func applyHAProxyFields(cfg, reloadable config.HAProxyConfig) config.HAProxyConfig {
+	cfg.BackendStrategy = reloadable.BackendStrategy
+	cfg.DrainTimeoutSec = reloadable.DrainTimeoutSec
+	cfg.MinOverlapSec = reloadable.MinOverlapSec
+	cfg.MaxOverlapWaitSec = reloadable.MaxOverlapWaitSec
+	cfg.Frontend = reloadable.Frontend
+	cfg.Frontends = reloadable.Frontends
+	cfg.HTTPFrontend = reloadable.HTTPFrontend
+	cfg.MaintenanceBackend = reloadable.MaintenanceBackend
+	return cfg
+}
+
+// restartRequiredChanges lists the config sections with changed settings a reload doesn't apply
+func restartRequiredChanges(current, reloaded *config.Config) []string {
+	var changed []string
+	fixedHAProxy := applyHAProxyFields(reloaded.HAProxy, reloadableHAProxyFields(&current.HAProxy))
+	sections := []struct {
+		name              string
+		current, reloaded interface{}
+	}{
+		{"nomad", current.Nomad, reloaded.Nomad},
+		{"haproxy", current.HAProxy, fixedHAProxy},
+		{"sync", current.Sync, reloaded.Sync},
+		{"acme", current.ACME, reloaded.ACME},
+		{"dns", current.DNS, reloaded.DNS},
+		{"state", current.State, reloaded.State},
+		{"ha", current.HA, reloaded.HA},
+		{"history", current.History, reloaded.History},
+		{"notifications", current.Notifications, reloaded.Notifications},
+		{"managed_services", current.ManagedServices, reloaded.ManagedServices},
+	}
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.current, section.reloaded) {
+			changed = append(changed, section.name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,84 @@
+package connector
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// validConfig returns a configuration that passes validation
+func validConfig() *config.Config {
+	cfg := testConfig()
+	cfg.Nomad.Address = "http://nomad:4646"
+	cfg.HAProxy.Address = "http://haproxy:5555"
+	cfg.HAProxy.BackendStrategy = "use_existing"
+	cfg.HAProxy.ManageFrontendRules = true
+	return cfg
+}
+
+func TestReload(t *testing.T) {
+	current := validConfig()
+	c := &Connector{config: current, logger: log.New(io.Discard, "", 0)}
+
+	reloaded := *current
+	reloaded.Log = config.LogConfig{Level: "debug"}
+	reloaded.HAProxy.Address = "http://other:5555"
+	reloaded.HAProxy.DrainTimeoutSec = 42
+	reloaded.HAProxy.Frontends = []string{"https", "internal"}
+	reloaded.HAProxy.BackendStrategy = "create_new"
+
+	if err := c.Reload(&reloaded); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	cfg := c.cfg()
+	if cfg.HAProxy.DrainTimeoutSec != 42 || cfg.HAProxy.BackendStrategy != "create_new" || cfg.Log.Level != "debug" ||
+		!reflect.DeepEqual(cfg.HAProxy.DefaultFrontends(), []string{"https", "internal"}) {
+		t.Errorf("Expected the reloadable settings to be applied, got %+v", cfg.HAProxy)
+	}
+	if cfg.HAProxy.Address != "http://haproxy:5555" {
+		t.Errorf("Expected the Data Plane API address to need a restart, got %s", cfg.HAProxy.Address)
+	}
+	if current.HAProxy.DrainTimeoutSec == 42 {
+		t.Error("Expected the previous configuration to stay unchanged for events in progress")
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	current := validConfig()
+	c := &Connector{config: current, logger: log.New(io.Discard, "", 0)}
+
+	invalid := []func(cfg *config.Config){
+		func(cfg *config.Config) { cfg.Log.Level = "verbose" },
+		func(cfg *config.Config) { cfg.HAProxy.DrainTimeoutSec = -1 },
+		func(cfg *config.Config) { cfg.HAProxy.BackendStrategy = "replace" },
+		func(cfg *config.Config) { cfg.HAProxy.Frontend, cfg.HAProxy.Frontends = "", nil },
+	}
+	for i, modify := range invalid {
+		reloaded := *current
+		modify(&reloaded)
+		if err := c.Reload(&reloaded); err == nil {
+			t.Errorf("Expected invalid config %d to be rejected", i)
+		}
+		if c.cfg() != current {
+			t.Fatalf("Expected the current config to be kept after invalid config %d", i)
+		}
+	}
+}
+
+func TestRestartRequiredChanges(t *testing.T) {
+	current := testConfig()
+	reloaded := *current
+	reloaded.HAProxy.DrainTimeoutSec++
+	if changed := restartRequiredChanges(current, &reloaded); len(changed) != 0 {
+		t.Errorf("Expected reloadable changes only, got %v", changed)
+	}
+
+	reloaded.Nomad.Address = "http://other:4646"
+	reloaded.HAProxy.ManageFrontendRules = !current.HAProxy.ManageFrontendRules
+	if changed := restartRequiredChanges(current, &reloaded); !reflect.DeepEqual(changed, []string{"nomad", "haproxy"}) {
+		t.Errorf("Expected nomad and haproxy to need a restart, got %v", changed)
+	}
+}
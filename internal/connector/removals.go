@@ -0,0 +1,338 @@
+package connector
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// RemovalsAPIPath is the admin API endpoint listing the pending server removals
+const RemovalsAPIPath = "/api/v1/removals"
+
+// removalTracker keeps track of scheduled delayed server removals and executes them once their
+// drain period is over, from a single scheduler goroutine instead of one sleeping goroutine each
+type removalTracker struct {
+	mu       sync.Mutex
+	pending  map[string]*pendingRemoval
+	canceled int64
+
+	start   sync.Once
+	wake    chan struct{}
+	halt    sync.Once
+	stopped chan struct{}
+
+	// locks is held while a removal is executed, a registration holding it meanwhile may cancel it
+	locks *keyedMutex
+}
+
+type pendingRemoval struct {
+	backend     string
+	server      string
+	scheduledAt time.Time
+	dueAt       time.Time // zero while waiting for a replacement to be established
+	cancel      chan struct{}
+
+	// client executes the removal; nil for removals that wait for an overlap and drain themselves
+	client haproxy.ClientInterface
+	logger *log.Logger
+}
+
+// PendingRemoval is a pending server removal as reported by the admin API
+type PendingRemoval struct {
+	Backend     string     `json:"backend"`
+	Server      string     `json:"server"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	DueAt       *time.Time `json:"due_at,omitempty"` // not set while waiting for an overlap
+}
+
+// persistedRemoval is a pending removal as kept in the state store across restarts
+type persistedRemoval struct {
+	Backend string    `json:"backend"`
+	Server  string    `json:"server"`
+	DueAt   time.Time `json:"due_at"`
+}
+
+// RemovalStats is a point-in-time snapshot of delayed removal state
+type RemovalStats struct {
+	Pending  int           // servers currently draining and scheduled for removal
+	MaxAge   time.Duration // age of the oldest pending removal
+	Canceled int64         // removals canceled because the server re-registered
+}
+
+func newRemovalTracker(locks *keyedMutex) *removalTracker {
+	return &removalTracker{
+		pending: make(map[string]*pendingRemoval),
+		wake:    make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+		locks:   locks,
+	}
+}
+
+func removalKey(backendName, serverName string) string {
+	return backendName + "/" + serverName
+}
+
+// schedule registers a pending removal due at dueAt (zero while waiting for an overlap) and returns
+// a channel that is closed when it gets canceled.
+// Scheduling a server that is already pending replaces the previous entry.
+func (t *removalTracker) schedule(backendName, serverName string, dueAt time.Time) <-chan struct{} {
+	return t.add(&pendingRemoval{backend: backendName, server: serverName, dueAt: dueAt})
+}
+
+// scheduleRemoval registers the removal of a draining server, which the scheduler executes at dueAt
+// unless the server registers again before
+func (t *removalTracker) scheduleRemoval(
+	client haproxy.ClientInterface,
+	backendName, serverName string,
+	dueAt time.Time,
+	logger *log.Logger,
+) {
+	t.add(&pendingRemoval{backend: backendName, server: serverName, dueAt: dueAt, client: client, logger: logger})
+	t.start.Do(func() { go t.run() })
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (t *removalTracker) add(removal *pendingRemoval) <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := removalKey(removal.backend, removal.server)
+	if existing, ok := t.pending[key]; ok {
+		close(existing.cancel)
+	}
+
+	removal.scheduledAt = time.Now()
+	removal.cancel = make(chan struct{})
+	t.pending[key] = removal
+	return removal.cancel
+}
+
+// run executes the removals that are due and sleeps until the next one is, until the tracker is
+// stopped
+func (t *removalTracker) run() {
+	for {
+		if removalCanceled(t.stopped) {
+			return
+		}
+		due, next := t.due(time.Now())
+		for _, removal := range due {
+			t.execute(removal)
+		}
+		if len(due) > 0 {
+			continue
+		}
+
+		wait := time.Hour
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-t.wake:
+		case <-t.stopped:
+		}
+		timer.Stop()
+	}
+}
+
+// stop stops executing removals, those still pending are left for snapshot to hand over
+func (t *removalTracker) stop() {
+	t.halt.Do(func() { close(t.stopped) })
+}
+
+// done returns a channel that is closed when the tracker is stopped
+func (t *removalTracker) done() <-chan struct{} {
+	return t.stopped
+}
+
+// due returns the removals whose drain period is over and when the next one is due
+func (t *removalTracker) due(now time.Time) (due []*pendingRemoval, next time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, removal := range t.pending {
+		if removal.client == nil || removalCanceled(removal.cancel) {
+			continue
+		}
+		if !removal.dueAt.After(now) {
+			due = append(due, removal)
+		} else if next.IsZero() || removal.dueAt.Before(next) {
+			next = removal.dueAt
+		}
+	}
+	return due, next
+}
+
+// execute removes the server while holding the backend lock, a registration holding it meanwhile
+// may still cancel the removal
+func (t *removalTracker) execute(removal *pendingRemoval) {
+	defer t.finish(removal.backend, removal.server, removal.cancel)
+	defer t.locks.lock(removal.backend)()
+	if removalCanceled(removal.cancel) {
+		return
+	}
+
+	logger := removal.logger
+	version, err := removal.client.GetConfigVersion()
+	if err != nil {
+		if logger != nil {
+			logger.Printf("Warning: failed to get config version for delayed deletion: %v", err)
+		}
+		return
+	}
+
+	if err := removeServer(removal.client, removal.backend, removal.server, version); err != nil {
+		if logger != nil {
+			logger.Printf("Warning: failed delayed deletion of server %s from backend %s: %v", removal.server, removal.backend, err)
+		}
+	} else if logger != nil {
+		logger.Printf("Gracefully removed server %s from backend %s after drain", removal.server, removal.backend)
+	}
+}
+
+// finish drops a pending removal once it has been executed or abandoned
+func (t *removalTracker) finish(backendName, serverName string, cancelCh <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := removalKey(backendName, serverName)
+	if existing, ok := t.pending[key]; ok && existing.cancel == cancelCh {
+		delete(t.pending, key)
+	}
+}
+
+// cancel aborts a pending removal, returning true if one was pending
+func (t *removalTracker) cancel(backendName, serverName string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := removalKey(backendName, serverName)
+	existing, ok := t.pending[key]
+	if !ok {
+		return false
+	}
+
+	close(existing.cancel)
+	delete(t.pending, key)
+	t.canceled++
+	if existing.logger != nil {
+		existing.logger.Printf("Canceled delayed removal of server %s from backend %s: server re-registered",
+			serverName, backendName)
+	}
+	return true
+}
+
+// has checks if the removal of a server is pending
+func (t *removalTracker) has(backendName, serverName string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.pending[removalKey(backendName, serverName)]
+	return ok
+}
+
+// removalCanceled checks if a removal got canceled, e.g. while waiting for the backend lock
+func removalCanceled(cancelCh <-chan struct{}) bool {
+	select {
+	case <-cancelCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// stats returns a snapshot of the pending removals
+func (t *removalTracker) stats() RemovalStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := RemovalStats{
+		Pending:  len(t.pending),
+		Canceled: t.canceled,
+	}
+
+	now := time.Now()
+	for _, removal := range t.pending {
+		if age := now.Sub(removal.scheduledAt); age > stats.MaxAge {
+			stats.MaxAge = age
+		}
+	}
+
+	return stats
+}
+
+// wait blocks until no removal is pending or the timeout passed
+func (t *removalTracker) wait(timeout time.Duration) bool {
+	ticker := time.NewTicker(ShutdownPollInterval)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for t.stats().Pending > 0 {
+		select {
+		case <-deadline:
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+// snapshot returns the pending removals ordered by backend and server
+func (t *removalTracker) snapshot() []persistedRemoval {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	removals := make([]persistedRemoval, 0, len(t.pending))
+	for _, removal := range t.pending {
+		removals = append(removals, persistedRemoval{Backend: removal.backend, Server: removal.server, DueAt: removal.dueAt})
+	}
+	sort.Slice(removals, func(i, j int) bool {
+		return removalKey(removals[i].Backend, removals[i].Server) < removalKey(removals[j].Backend, removals[j].Server)
+	})
+	return removals
+}
+
+// list returns the pending removals for the admin API, the next due first and those waiting for
+// an overlap last
+func (t *removalTracker) list() []PendingRemoval {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	listed := make([]PendingRemoval, 0, len(t.pending))
+	for _, removal := range t.pending {
+		entry := PendingRemoval{Backend: removal.backend, Server: removal.server, ScheduledAt: removal.scheduledAt}
+		if !removal.dueAt.IsZero() {
+			dueAt := removal.dueAt
+			entry.DueAt = &dueAt
+		}
+		listed = append(listed, entry)
+	}
+	sort.Slice(listed, func(i, j int) bool {
+		a, b := listed[i], listed[j]
+		if (a.DueAt == nil) != (b.DueAt == nil) {
+			return b.DueAt == nil
+		}
+		if a.DueAt != nil && !a.DueAt.Equal(*b.DueAt) {
+			return a.DueAt.Before(*b.DueAt)
+		}
+		return removalKey(a.Backend, a.Server) < removalKey(b.Backend, b.Server)
+	})
+	return listed
+}
+
+// handleRemovals lists the pending server removals
+func (c *Connector) handleRemovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, c.currentHandlers().removals.list())
+}
@@ -0,0 +1,156 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRemovalTracker_Stats(t *testing.T) {
+	tracker := newRemovalTracker(newKeyedMutex())
+
+	tracker.schedule("web", "web_10_0_0_1_80", time.Time{})
+	time.Sleep(20 * time.Millisecond)
+	tracker.schedule("web", "web_10_0_0_2_80", time.Time{})
+
+	stats := tracker.stats()
+	if stats.Pending != 2 {
+		t.Errorf("Expected 2 pending removals, got %d", stats.Pending)
+	}
+	if stats.MaxAge < 20*time.Millisecond {
+		t.Errorf("Expected max age >= 20ms, got %v", stats.MaxAge)
+	}
+
+	if !tracker.cancel("web", "web_10_0_0_1_80") {
+		t.Error("Expected cancel to report a pending removal")
+	}
+	if tracker.cancel("web", "web_10_0_0_1_80") {
+		t.Error("Expected second cancel to be a no-op")
+	}
+
+	stats = tracker.stats()
+	if stats.Pending != 1 || stats.Canceled != 1 {
+		t.Errorf("Expected 1 pending and 1 canceled, got %d pending and %d canceled", stats.Pending, stats.Canceled)
+	}
+}
+
+func TestRemovalTracker_FinishIgnoresReplacedEntry(t *testing.T) {
+	tracker := newRemovalTracker(newKeyedMutex())
+
+	first := tracker.schedule("web", "srv", time.Time{})
+	tracker.schedule("web", "srv", time.Time{})
+
+	select {
+	case <-first:
+	default:
+		t.Fatal("Expected rescheduling to cancel the previous removal")
+	}
+
+	tracker.finish("web", "srv", first)
+	if stats := tracker.stats(); stats.Pending != 1 {
+		t.Errorf("Expected replacement removal to stay pending, got %d", stats.Pending)
+	}
+}
+
+func TestReRegistrationCancelsDelayedRemoval(t *testing.T) {
+	hs := newHandlerState()
+	mockClient := &mockHAProxyClient{}
+	logger := log.New(os.Stdout, "test: ", log.LstdFlags)
+
+	service := Service{
+		ServiceName: "rereg-service",
+		Address:     "10.0.0.9",
+		Port:        8080,
+		Tags:        []string{"haproxy.enable=true"},
+	}
+	backendName := sanitizeServiceName(service.ServiceName)
+	serverName := generateServerName(service.ServiceName, service.Address, service.Port)
+
+	_, err := hs.handleServiceDeregistrationWithDrainTimeout(
+		context.Background(), mockClient, &ServiceEvent{Type: EventTypeServiceDeregistration, Service: service},
+		testConfig(), 1, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	before := hs.removals.stats().Canceled
+
+	result := map[string]string{}
+	hs.cancelPendingRemoval(mockClient, backendName, serverName, result)
+
+	if result["removal_canceled"] != "true" {
+		t.Errorf("Expected removal to be canceled, got result %v", result)
+	}
+	if hs.removals.stats().Canceled != before+1 {
+		t.Error("Expected canceled counter to increase")
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if mockClient.wasDeleteCalled() {
+		t.Error("Expected DeleteServer not to be called after removal was canceled")
+	}
+}
+
+func TestRemovalTracker_ExecutesDueRemovals(t *testing.T) {
+	tracker := newRemovalTracker(newKeyedMutex())
+	client := &mockHAProxyClient{}
+
+	tracker.scheduleRemoval(client, "sched_web", "web_late", time.Now().Add(time.Hour), nil)
+	tracker.scheduleRemoval(client, "sched_web", "web_due", time.Now().Add(20*time.Millisecond), nil)
+
+	deadline := time.Now().Add(time.Second)
+	for tracker.stats().Pending > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	client.mu.Lock()
+	deleted := append([]string{}, client.deletedServers...)
+	client.mu.Unlock()
+	if len(deleted) != 1 || deleted[0] != "sched_web/web_due" {
+		t.Errorf("Expected only the due server to be removed, got %v", deleted)
+	}
+
+	listed := tracker.list()
+	if len(listed) != 1 || listed[0].Server != "web_late" || listed[0].DueAt == nil {
+		t.Errorf("Expected the later removal to stay pending, got %+v", listed)
+	}
+}
+
+func TestHandleRemovals(t *testing.T) {
+	c := &Connector{}
+	c.currentHandlers().removals.schedule("listed_web", "web_1", time.Time{})
+
+	recorder := httptest.NewRecorder()
+	c.handleRemovals(recorder, httptest.NewRequest(http.MethodGet, RemovalsAPIPath, http.NoBody))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+
+	var removals []PendingRemoval
+	if err := json.Unmarshal(recorder.Body.Bytes(), &removals); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	found := false
+	for _, removal := range removals {
+		if removal.Backend == "listed_web" && removal.Server == "web_1" {
+			found = true
+			if removal.DueAt != nil {
+				t.Errorf("Expected no due time while waiting for an overlap, got %v", removal.DueAt)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the pending removal to be listed, got %+v", removals)
+	}
+
+	recorder = httptest.NewRecorder()
+	c.handleRemovals(recorder, httptest.NewRequest(http.MethodPost, RemovalsAPIPath, http.NoBody))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,164 @@
+package connector
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Routing table output formats
+const (
+	RouteFormatTable = "table"
+	RouteFormatJSON  = "json"
+	RouteFormatCSV   = "csv"
+)
+
+// Route is a single entry of the managed routing table
+type Route struct {
+	Frontend       string    `json:"frontend"`
+	Domain         string    `json:"domain"`
+	Type           string    `json:"type"`
+	Backend        string    `json:"backend"`
+	Servers        int       `json:"servers"`
+	HealthyServers int       `json:"healthy_servers"`
+	LastChange     time.Time `json:"last_change,omitempty"`
+}
+
+// changeTracker remembers when each backend last changed, for the routing table
+type changeTracker struct {
+	mu      sync.RWMutex
+	changes map[string]time.Time
+}
+
+func (t *changeTracker) record(backendName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.changes[backendName] = time.Now()
+}
+
+func (t *changeTracker) get(backendName string) time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.changes[backendName]
+}
+
+// recordBackendChange marks a backend as changed now
+func (hs *handlerState) recordBackendChange(backendName string) {
+	hs.changes.record(backendName)
+}
+
+// buildRoutingTable collects the domain routing rules of the given frontends together with
+// server counts and runtime health of the backends they point to. The servers of each backend are
+// listed once, however many rules point to it.
+func (hs *handlerState) buildRoutingTable(client haproxy.ClientInterface, frontends []string) ([]Route, error) {
+	var routes []Route
+	backends := make(map[string][]haproxy.RuntimeServer)
+
+	for _, frontendName := range frontends {
+		rules, err := client.GetFrontendRules(frontendName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rules for frontend %s: %w", frontendName, err)
+		}
+
+		for _, rule := range rules {
+			route := Route{
+				Frontend:   frontendName,
+				Domain:     rule.Domain,
+				Type:       string(rule.Type),
+				Backend:    rule.Backend,
+				LastChange: hs.changes.get(rule.Backend),
+			}
+			if route.Type == "" {
+				route.Type = string(haproxy.DomainTypeExact)
+			}
+
+			servers, listed := backends[rule.Backend]
+			if !listed {
+				// A backend that can't be listed shows without servers
+				servers, _ = client.GetRuntimeServers(rule.Backend)
+				backends[rule.Backend] = servers
+			}
+			route.Servers = len(servers)
+			route.HealthyServers = countHealthyServers(servers)
+
+			routes = append(routes, route)
+		}
+	}
+
+	return routes, nil
+}
+
+// countHealthyServers counts servers whose runtime operational state is up
+func countHealthyServers(servers []haproxy.RuntimeServer) int {
+	healthy := 0
+	for i := range servers {
+		if servers[i].OperationalState == "up" {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// WriteRoutes renders the routing table in the requested format (table, json or csv)
+func WriteRoutes(w io.Writer, routes []Route, format string) error {
+	switch format {
+	case RouteFormatJSON, "":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if routes == nil {
+			routes = []Route{}
+		}
+		return encoder.Encode(routes)
+	case RouteFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(routeHeader()); err != nil {
+			return err
+		}
+		for i := range routes {
+			if err := writer.Write(routeRecord(&routes[i])); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case RouteFormatTable:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "FRONTEND\tDOMAIN\tTYPE\tBACKEND\tSERVERS\tHEALTHY\tLAST CHANGE")
+		for i := range routes {
+			record := routeRecord(&routes[i])
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				record[0], record[1], record[2], record[3], record[4], record[5], record[6])
+		}
+		return writer.Flush()
+	default:
+		return fmt.Errorf("unknown routes format %q (expected table, json or csv)", format)
+	}
+}
+
+func routeHeader() []string {
+	return []string{"frontend", "domain", "type", "backend", "servers", "healthy_servers", "last_change"}
+}
+
+func routeRecord(route *Route) []string {
+	lastChange := "-"
+	if !route.LastChange.IsZero() {
+		lastChange = route.LastChange.Format(time.RFC3339)
+	}
+
+	return []string{
+		route.Frontend,
+		route.Domain,
+		route.Type,
+		route.Backend,
+		strconv.Itoa(route.Servers),
+		strconv.Itoa(route.HealthyServers),
+		lastChange,
+	}
+}
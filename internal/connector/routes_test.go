@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// routesMockClient serves a fixed set of frontend rules and servers and counts the listings
+type routesMockClient struct {
+	mockHAProxyClient
+	rules    map[string][]haproxy.FrontendRule
+	servers  map[string][]haproxy.Server
+	listings int
+}
+
+func (m *routesMockClient) GetFrontendRules(frontend string) ([]haproxy.FrontendRule, error) {
+	return m.rules[frontend], nil
+}
+
+func (m *routesMockClient) GetServers(backendName string) ([]haproxy.Server, error) {
+	return m.servers[backendName], nil
+}
+
+func (m *routesMockClient) GetRuntimeServers(backendName string) ([]haproxy.RuntimeServer, error) {
+	m.listings++
+	var runtime []haproxy.RuntimeServer
+	for _, server := range m.servers[backendName] {
+		state := "up"
+		if strings.HasSuffix(server.Name, "_down") {
+			state = "down"
+		}
+		runtime = append(runtime, haproxy.RuntimeServer{ServerName: server.Name, OperationalState: state})
+	}
+	return runtime, nil
+}
+
+func TestBuildRoutingTable(t *testing.T) {
+	hs := newHandlerState()
+	client := &routesMockClient{
+		rules: map[string][]haproxy.FrontendRule{
+			"https": {
+				{Domain: testDomain, Backend: testBackend, Type: haproxy.DomainTypeExact},
+				{Domain: "^.+\\.example\\.com$", Backend: "wildcard", Type: haproxy.DomainTypeRegex},
+			},
+			"http": {
+				{Domain: testDomain, Backend: testBackend, Type: haproxy.DomainTypeExact},
+			},
+		},
+		servers: map[string][]haproxy.Server{
+			testBackend: {{Name: "api_1"}, {Name: "api_2_down"}},
+		},
+	}
+	hs.recordBackendChange(testBackend)
+
+	routes, err := hs.buildRoutingTable(client, []string{"https", "http"})
+	if err != nil {
+		t.Fatalf("buildRoutingTable() failed: %v", err)
+	}
+
+	if len(routes) != 3 {
+		t.Fatalf("Expected 3 routes, got %d", len(routes))
+	}
+	if client.listings != 2 {
+		t.Errorf("Expected the servers of each backend to be listed once, got %d listings", client.listings)
+	}
+	if routes[2].Servers != 2 || routes[2].HealthyServers != 1 {
+		t.Errorf("Expected the shared backend's counts on the http route too, got %+v", routes[2])
+	}
+	if routes[0].Servers != 2 || routes[0].HealthyServers != 1 {
+		t.Errorf("Expected 2 servers with 1 healthy, got %+v", routes[0])
+	}
+	if routes[0].LastChange.IsZero() {
+		t.Error("Expected last change time to be recorded")
+	}
+	if routes[1].Type != string(haproxy.DomainTypeRegex) || routes[1].Servers != 0 {
+		t.Errorf("Unexpected regex route: %+v", routes[1])
+	}
+}
+
+func TestWriteRoutes(t *testing.T) {
+	routes := []Route{{Frontend: "https", Domain: testDomain, Type: "exact", Backend: testBackend, Servers: 2, HealthyServers: 2}}
+
+	var buf bytes.Buffer
+	if err := WriteRoutes(&buf, routes, RouteFormatJSON); err != nil {
+		t.Fatalf("WriteRoutes(json) failed: %v", err)
+	}
+	var decoded []Route
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 1 {
+		t.Errorf("Expected JSON with one route, got %q (%v)", buf.String(), err)
+	}
+
+	buf.Reset()
+	if err := WriteRoutes(&buf, routes, RouteFormatCSV); err != nil {
+		t.Fatalf("WriteRoutes(csv) failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "https,api.example.com,exact,api_service,2,2,-") {
+		t.Errorf("Unexpected CSV output: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteRoutes(&buf, routes, RouteFormatTable); err != nil {
+		t.Fatalf("WriteRoutes(table) failed: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "FRONTEND") {
+		t.Errorf("Expected table header, got %q", buf.String())
+	}
+
+	if err := WriteRoutes(&buf, routes, "yaml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
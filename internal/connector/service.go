@@ -2,14 +2,21 @@ package connector
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"log"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pscheit/haproxy-nomad-connector/internal/config"
 	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
 	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+	"github.com/pscheit/haproxy-nomad-connector/internal/tracing"
 )
 
 // Health check type constants
@@ -17,6 +24,7 @@ const (
 	CheckTypeHTTP     = "http"
 	CheckTypeTCP      = "tcp"
 	CheckTypeDisabled = "disabled"
+	CheckTypeExternal = "external" // agent-check, the service reports its own weight and state
 	CheckEnabled      = "enabled"
 	AdvCheckHTTP      = "httpchk"
 	HTTPMethodGET     = "GET"
@@ -32,6 +40,13 @@ const (
 	MethodImmediateDeletion = "immediate_deletion"
 )
 
+// Server naming schemes of the haproxy.server_name tag
+const (
+	ServerNameTag     = "haproxy.server_name="
+	ServerNameAddress = "address" // <service>_<address>_<port> (default)
+	ServerNameAlloc   = "alloc"   // <service>_<short alloc ID>
+)
+
 // Event type constants
 const (
 	EventTypeServiceRegistration   = "ServiceRegistration"
@@ -41,6 +56,9 @@ const (
 	EventTypeAllocationUpdated     = "AllocationUpdated"
 )
 
+// handlerLog is the structured logger of the event handlers
+var handlerLog = logging.Logger(logging.ModuleConnector)
+
 // ServiceEvent represents a Nomad service registration/deregistration event
 type ServiceEvent struct {
 	Type    string
@@ -53,24 +71,29 @@ type Service struct {
 	Port        int
 	Tags        []string
 	JobID       string // Job ID for health check lookup
+	AllocID     string // Allocation ID to correlate address changes
+	NodeID      string // Node the allocation runs on, to find the servers of drained and failed nodes
 }
 
-// ProcessServiceEvent processes a Nomad service event and updates HAProxy
+// ProcessServiceEvent processes a Nomad service event and updates HAProxy, with the handler state
+// ctx carries
 func ProcessServiceEvent(
 	ctx context.Context,
 	client haproxy.ClientInterface,
 	event *ServiceEvent,
 	cfg *config.Config,
 ) (interface{}, error) {
-	// Classify service based on tags
-	serviceType := classifyService(event.Service.Tags)
-	fmt.Printf("DEBUG: Service %s classified as %s with tags: %v\n", event.Service.ServiceName, serviceType, event.Service.Tags)
+	hs := handlerStateFrom(ctx)
+	spec := parseServiceSpec(event.Service.ServiceName, event.Service.Tags)
+	handlerLog.Debug("Classified service", "service", event.Service.ServiceName, "event_type", event.Type,
+		"service_type", spec.Type, "tags", event.Service.Tags)
+	reportTagProblems(event, spec)
 
-	switch serviceType {
+	switch spec.Type {
 	case haproxy.ServiceTypeDynamic:
-		return processDynamicService(ctx, client, event, cfg)
+		return hs.processDynamicService(ctx, client, event, cfg)
 	case haproxy.ServiceTypeCustom:
-		return processCustomService(ctx, client, event, cfg)
+		return hs.processCustomService(ctx, client, event, cfg)
 	case haproxy.ServiceTypeStatic:
 		// Static services - no action needed
 		return map[string]string{"status": "ignored", "reason": "static service"}, nil
@@ -93,26 +116,33 @@ func ProcessNomadServiceEvent(
 	}
 
 	svc := event.Payload.Service
+	hs := handlerStateFrom(ctx)
 
 	// Convert to our internal event structure
 	serviceEvent := ServiceEvent{
 		Type: event.Type,
 		Service: Service{
 			ServiceName: svc.ServiceName,
-			Address:     svc.Address,
+			Address:     normalizeServerAddress(svc.Address),
 			Port:        svc.Port,
-			Tags:        svc.Tags,
+			Tags:        serviceTags(svc.Tags, svc.Meta),
 			JobID:       svc.JobID, // Pass JobID for health check lookup
+			AllocID:     svc.AllocID,
+			NodeID:      svc.NodeID,
 		},
 	}
 
-	logger.Printf("Processing %s for service %s at %s:%d",
-		event.Type, svc.ServiceName, svc.Address, svc.Port)
+	if hs.isPaused(svc.ServiceName, serviceEvent.Service.Tags) {
+		logger.Printf("Ignoring %s for paused service %s at %s",
+			event.Type, svc.ServiceName, hostPort(svc.Address, svc.Port))
+		return map[string]string{"status": StatusPaused}, nil
+	}
 
-	return ProcessServiceEventWithHealthCheckAndConfig(ctx, haproxyClient, nomadClient, &serviceEvent, logger, cfg)
-}
+	logger.Printf("Processing %s for service %s at %s",
+		event.Type, svc.ServiceName, hostPort(svc.Address, svc.Port))
 
-// ProcessServiceEventWithHealthCheck processes a service event with health check synchronization from Nomad
+	return hs.processServiceEventWithHealthCheck(ctx, haproxyClient, nomadClient, &serviceEvent, logger, cfg)
+}
 
 // ProcessServiceEventWithHealthCheckAndConfig processes a service event with configurable drain timeout
 func ProcessServiceEventWithHealthCheckAndConfig(
@@ -123,15 +153,32 @@ func ProcessServiceEventWithHealthCheckAndConfig(
 	logger *log.Logger,
 	cfg *config.Config,
 ) (interface{}, error) {
-	// Classify service based on tags
-	serviceType := classifyService(event.Service.Tags)
+	return handlerStateFrom(ctx).processServiceEventWithHealthCheck(ctx, haproxyClient, nomadClient, event, logger, cfg)
+}
+
+// processServiceEventWithHealthCheck processes a service event with health check synchronization from Nomad
+func (hs *handlerState) processServiceEventWithHealthCheck(
+	ctx context.Context,
+	haproxyClient haproxy.ClientInterface,
+	nomadClient nomad.NomadClient,
+	event *ServiceEvent,
+	logger *log.Logger,
+	cfg *config.Config,
+) (interface{}, error) {
+	haproxyClient = haproxy.WithContext(ctx, haproxyClient)
 
-	switch serviceType {
+	_, span := tracing.Start(ctx, "parse tags", tracing.Int("tags", len(event.Service.Tags)))
+	spec := parseServiceSpec(event.Service.ServiceName, event.Service.Tags)
+	span.SetAttributes(tracing.String("service.type", string(spec.Type)), tracing.Int("tag.problems", len(spec.Problems)))
+	span.End()
+	reportTagProblems(event, spec)
+
+	switch spec.Type {
 	case haproxy.ServiceTypeDynamic:
-		return processDynamicServiceWithHealthCheckAndConfig(ctx, haproxyClient, nomadClient, event, logger, cfg.HAProxy.DrainTimeoutSec, cfg)
+		return hs.processDynamicServiceWithHealthCheckAndConfig(ctx, haproxyClient, nomadClient, event, logger, cfg.HAProxy.DrainTimeoutSec, cfg)
 	case haproxy.ServiceTypeCustom:
 		// TODO: Implement custom service with health check and drain timeout
-		return ProcessServiceEvent(ctx, haproxyClient, event, cfg)
+		return hs.processCustomService(ctx, haproxyClient, event, cfg)
 	case haproxy.ServiceTypeStatic:
 		return map[string]string{"status": "ignored", "reason": "static service"}, nil
 	default:
@@ -139,6 +186,17 @@ func ProcessServiceEventWithHealthCheckAndConfig(
 	}
 }
 
+// reportTagProblems warns about unknown and invalid tags of a registered managed service. Deregistrations
+// carry the same tags, they are not reported twice.
+func reportTagProblems(event *ServiceEvent, spec *ServiceSpec) {
+	if event.Type != EventTypeServiceRegistration || spec.Type == haproxy.ServiceTypeStatic {
+		return
+	}
+	for _, problem := range spec.Problems {
+		handlerLog.Warn("Ignoring tag", "service", event.Service.ServiceName, "problem", problem)
+	}
+}
+
 // classifyService determines service type from tags
 func classifyService(tags []string) haproxy.ServiceType {
 	hasEnable := false
@@ -168,29 +226,34 @@ func classifyService(tags []string) haproxy.ServiceType {
 }
 
 // processDynamicService creates a new backend for the service
-func processDynamicService(
+func (hs *handlerState) processDynamicService(
 	ctx context.Context,
 	client haproxy.ClientInterface,
 	event *ServiceEvent,
 	cfg *config.Config,
 ) (interface{}, error) {
+	defer hs.locks.lock(serviceBackendName(event.Service.ServiceName, event.Service.Tags))()
+
 	switch event.Type {
 	case EventTypeServiceRegistration:
-		return handleServiceRegistration(ctx, client, event, cfg)
+		return hs.handleServiceRegistration(ctx, client, event, cfg)
 	case EventTypeServiceDeregistration:
-		return handleServiceDeregistration(ctx, client, event, cfg)
+		return hs.handleServiceDeregistration(ctx, client, event, cfg)
 	case EventTypeNodeEvent, EventTypeNodeDeregistration, EventTypeAllocationUpdated:
 		// Fix Bug #2: Handle events that can affect service availability
 		// These events may indicate a service instance is no longer available
-		// and should be treated as service deregistration
-		return handleServiceDeregistration(ctx, client, event, cfg)
+		// and should be treated as service deregistration, unless the allocation restarted in place
+		if result, ok := hs.restartedInPlace(event, serviceBackendName(event.Service.ServiceName, event.Service.Tags)); ok {
+			return result, nil
+		}
+		return hs.handleServiceDeregistration(ctx, client, event, cfg)
 	default:
 		return map[string]string{"status": "skipped", "reason": "unknown event type"}, nil
 	}
 }
 
 // processDynamicServiceWithHealthCheckAndConfig creates a new backend for the service with configurable drain timeout
-func processDynamicServiceWithHealthCheckAndConfig(
+func (hs *handlerState) processDynamicServiceWithHealthCheckAndConfig(
 	ctx context.Context,
 	client haproxy.ClientInterface,
 	nomadClient nomad.NomadClient,
@@ -199,22 +262,28 @@ func processDynamicServiceWithHealthCheckAndConfig(
 	drainTimeoutSec int,
 	cfg *config.Config,
 ) (interface{}, error) {
+	defer hs.locks.lock(serviceBackendName(event.Service.ServiceName, event.Service.Tags))()
+
 	switch event.Type {
 	case EventTypeServiceRegistration:
-		return handleServiceRegistrationWithHealthCheck(ctx, client, nomadClient, event, logger, cfg.HAProxy.Frontend)
+		return hs.handleServiceRegistrationWithHealthCheck(ctx, client, nomadClient, event, logger, &cfg.HAProxy)
 	case EventTypeServiceDeregistration:
-		return handleServiceDeregistrationWithDrainTimeout(ctx, client, event, cfg, drainTimeoutSec, logger)
+		return hs.handleServiceDeregistrationWithDrainTimeout(ctx, client, event, cfg, drainTimeoutSec, logger)
 	case EventTypeNodeEvent, EventTypeNodeDeregistration, EventTypeAllocationUpdated:
 		// Fix Bug #2: Handle events that can affect service availability
 		// These events may indicate a service instance is no longer available
-		// and should be treated as service deregistration with drain timeout
-		return handleServiceDeregistrationWithDrainTimeout(ctx, client, event, cfg, drainTimeoutSec, logger)
+		// and should be treated as service deregistration with drain timeout, unless the allocation
+		// restarted in place
+		if result, ok := hs.restartedInPlace(event, serviceBackendName(event.Service.ServiceName, event.Service.Tags)); ok {
+			return result, nil
+		}
+		return hs.handleServiceDeregistrationWithDrainTimeout(ctx, client, event, cfg, drainTimeoutSec, logger)
 	default:
 		return map[string]string{"status": "skipped", "reason": "unknown event type"}, nil
 	}
 }
 
-func handleServiceRegistration(
+func (hs *handlerState) handleServiceRegistration(
 	_ context.Context,
 	client haproxy.ClientInterface,
 	event *ServiceEvent,
@@ -225,7 +294,8 @@ func handleServiceRegistration(
 		return nil, err
 	}
 
-	backendName := sanitizeServiceName(event.Service.ServiceName)
+	backendName := serviceBackendName(event.Service.ServiceName, event.Service.Tags)
+	hs.cancelEmptyBackendDeletion(backendName)
 
 	// Ensure backend exists and is compatible
 	version, err = ensureBackend(client, backendName, version, event.Service.Tags)
@@ -233,7 +303,7 @@ func handleServiceRegistration(
 		return nil, err
 	}
 
-	serverName := generateServerName(event.Service.ServiceName, event.Service.Address, event.Service.Port)
+	serverName := serviceServerName(&event.Service)
 
 	// Initialize result map
 	result := map[string]string{
@@ -242,18 +312,18 @@ func handleServiceRegistration(
 	}
 
 	// Ensure server exists
-	serverExists, err := ensureServer(client, backendName, serverName, event.Service.Address, event.Service.Port, version)
+	status, err := hs.ensureServer(client, backendName, serverName, &event.Service, version, result)
 	if err != nil {
 		return nil, err
 	}
-	if serverExists {
-		result["status"] = StatusAlreadyExists
-	} else {
-		result["status"] = StatusCreated
+	result["status"] = status
+	if status == StatusAlreadyExists {
+		hs.cancelPendingRemoval(client, backendName, serverName, result)
 	}
+	hs.allocations.record(event.Service.AllocID, event.Service.NodeID, backendName, serverName)
 
 	// ALWAYS reconcile frontend rules (regardless of server existence)
-	err = reconcileFrontendRule(client, event.Service.ServiceName, event.Service.Tags, backendName, result, cfg.HAProxy.Frontend)
+	err = hs.reconcileServiceRouting(client, event.Service.ServiceName, event.Service.Tags, backendName, result, &cfg.HAProxy)
 	if err != nil {
 		return nil, err
 	}
@@ -319,10 +389,11 @@ func updateBackendHealthChecks(
 	backendName string,
 	existingBackend *haproxy.Backend,
 	healthCheckConfig *HealthCheckConfig,
+	tags []string,
 	version int,
 ) (newVersion int, err error) {
 	// Build DESIRED backend configuration from health check config
-	desiredBackend := buildDesiredBackend(backendName, healthCheckConfig)
+	desiredBackend := buildDesiredBackend(backendName, healthCheckConfig, tags)
 
 	// Fetch actual HTTP checks for complete comparison
 	var existingHTTPChecks []haproxy.HTTPCheck
@@ -352,6 +423,17 @@ func applyBackendUpdate(
 	healthCheckConfig *HealthCheckConfig,
 	version int,
 ) (int, error) {
+	if desiredBackend.StickTable == nil {
+		// A leftover stick rule would reference the stick table removed by the replace
+		if err := reconcileStickRule(client, backendName, false, map[string]string{}); err != nil {
+			return version, err
+		}
+		var err error
+		if version, err = client.GetConfigVersion(); err != nil {
+			return version, fmt.Errorf("failed to get config version for backend update: %w", err)
+		}
+	}
+
 	_, err := client.ReplaceBackend(desiredBackend, version)
 	if err != nil {
 		return version, fmt.Errorf("failed to update backend %s with health check configuration: %w", backendName, err)
@@ -360,8 +442,8 @@ func applyBackendUpdate(
 	return applyHTTPChecksToBackend(client, backendName, healthCheckConfig, version)
 }
 
-// buildDesiredBackend constructs the desired backend configuration from health check config
-func buildDesiredBackend(backendName string, healthCheckConfig *HealthCheckConfig) *haproxy.Backend {
+// buildDesiredBackend constructs the desired backend configuration from health check config and service tags
+func buildDesiredBackend(backendName string, healthCheckConfig *HealthCheckConfig, tags []string) *haproxy.Backend {
 	backend := &haproxy.Backend{
 		Name: backendName,
 		Balance: haproxy.Balance{
@@ -382,6 +464,20 @@ func buildDesiredBackend(backendName string, healthCheckConfig *HealthCheckConfi
 		}
 	}
 
+	if isTCPMode(tags) {
+		backend.Mode = ModeTCP
+	}
+
+	applyStickyMode(backend, tags)
+	applyServiceLimits(backend, tags)
+	applyForwardfor(backend, tags)
+	applyServerProtocol(backend, tags)
+	applyCompression(backend, tags)
+	applyCheckTiming(backend, healthCheckConfig)
+	applyCheckTLS(backend, healthCheckConfig)
+	applyCheckAgent(backend, healthCheckConfig)
+	applyOutlierDetection(backend, healthCheckConfig, tags)
+
 	return backend
 }
 
@@ -398,6 +494,56 @@ func backendConfigMatches(
 		return false
 	}
 
+	// Explicitly requested mode (e.g. tcp) must match
+	if desired.Mode != "" && existing.Mode != desired.Mode {
+		return false
+	}
+
+	// Session persistence (haproxy.sticky) must match
+	if !stickyMatches(existing, desired) {
+		return false
+	}
+
+	// Timeouts and connection limit (haproxy.timeout.*, haproxy.maxconn) must match
+	if !serviceLimitsMatch(existing, desired) {
+		return false
+	}
+
+	// option forwardfor (haproxy.forwardfor) must match
+	if !forwardforMatches(existing, desired) {
+		return false
+	}
+
+	// Compression (haproxy.compression, haproxy.compression.types) must match
+	if !compressionMatches(existing, desired) {
+		return false
+	}
+
+	// Upstream protocol (haproxy.proto, haproxy.alpn) must match
+	if !serverProtocolMatches(existing, desired) {
+		return false
+	}
+
+	// Check interval, timeout, rise and fall (haproxy.check.*, Nomad check) must match
+	if !checkTimingMatches(existing, desired) {
+		return false
+	}
+
+	// TLS checks (check-ssl, verify, ca-file) must match
+	if !checkTLSMatches(existing, desired) {
+		return false
+	}
+
+	// Outlier detection (haproxy.check.observe, on_error, error_limit) must match
+	if !outlierDetectionMatches(existing, desired) {
+		return false
+	}
+
+	// Agent check (haproxy.check.type=external) must match
+	if !checkAgentMatches(existing, desired) {
+		return false
+	}
+
 	// If no HTTP health check configured, we only care about DefaultServer check
 	if !isHTTPHealthCheckConfigured(healthCheckConfig) {
 		return true
@@ -477,110 +623,251 @@ func httpCheckHostMatches(existingHTTPChecks []haproxy.HTTPCheck, desiredHost st
 func ensureBackend(client haproxy.ClientInterface, backendName string, version int, tags []string) (int, error) {
 	healthCheckConfig := resolveHealthCheckConfig(tags, nil)
 
-	existingBackend, err := client.GetBackend(backendName)
-	if err == nil {
-		// Backend exists - verify compatibility and reconcile configuration
-		if !haproxy.IsBackendCompatibleForDynamicService(existingBackend) {
-			return version, fmt.Errorf("backend %s already exists with incompatible configuration (algorithm: %s, expected: roundrobin)",
-				backendName, existingBackend.Balance.Algorithm)
-		}
-
-		// Reconcile: Update existing backend if configuration differs
-		return updateBackendHealthChecks(client, backendName, existingBackend, healthCheckConfig, version)
-	}
-
-	// Backend doesn't exist - create with desired configuration
-	desiredBackend := buildDesiredBackend(backendName, healthCheckConfig)
-
-	_, err = client.CreateBackend(*desiredBackend, version)
-	if err != nil {
-		return version, fmt.Errorf("failed to create backend %s: %w", backendName, err)
-	}
-
-	return applyHTTPChecksToBackend(client, backendName, healthCheckConfig, version)
+	return reconcileBackend(client, backendName, healthCheckConfig, tags, version)
 }
 
-// ensureServer ensures the server exists in the backend
-func ensureServer(client haproxy.ClientInterface, backendName, serverName, address string, port, version int) (bool, error) {
+// ensureServer ensures the server exists in the backend, replacing the server the service's allocation
+// was previously registered as. Returns StatusAlreadyExists, StatusReplaced or StatusCreated.
+func (hs *handlerState) ensureServer(
+	client haproxy.ClientInterface,
+	backendName, serverName string,
+	service *Service,
+	version int,
+	result map[string]string,
+) (string, error) {
 	existingServers, err := client.GetServers(backendName)
 	if err != nil {
-		return false, fmt.Errorf("failed to get existing servers for backend %s: %w", backendName, err)
+		return "", fmt.Errorf("failed to get existing servers for backend %s: %w", backendName, err)
 	}
 
-	for _, existingServer := range existingServers {
-		if existingServer.Name == serverName {
-			return true, nil
-		}
+	if containsServer(existingServers, serverName) {
+		return StatusAlreadyExists, nil
 	}
 
 	server := haproxy.Server{
 		Name:    serverName,
-		Address: address,
-		Port:    port,
+		Address: service.Address,
+		Port:    service.Port,
 		Check:   CheckEnabled,
 	}
 
+	replaced, err := hs.swapAllocationServer(client, service.AllocID, backendName, &server, result)
+	if err != nil {
+		return "", err
+	}
+	if replaced {
+		return StatusReplaced, nil
+	}
+
 	_, err = client.CreateServer(backendName, &server, version)
 	if err != nil {
-		return false, fmt.Errorf("failed to create server %s in backend %s: %w", serverName, backendName, err)
+		return "", fmt.Errorf("failed to create server %s in backend %s: %w", serverName, backendName, err)
 	}
+	hs.recordBackendChange(backendName)
 
 	// Note: Health checks are enabled automatically when backend has default_server.check=enabled
 	// No socket commands or Runtime API calls needed in HAProxy 3.0
 
-	return false, nil
+	return StatusCreated, nil
+}
+
+// reconcileServiceRouting ensures everything that routes traffic to the service's backend exists
+func (hs *handlerState) reconcileServiceRouting(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	backendName string,
+	result map[string]string,
+	haproxyCfg *config.HAProxyConfig,
+) error {
+	tags = quarantineInvalidRegexDomain(serviceName, tags, result)
+	if isMaintenance(tags) {
+		return hs.reconcileMaintenance(client, serviceName, tags, backendName, result, haproxyCfg)
+	}
+	hs.clearMaintenance(client, backendName, result)
+	if isCanary(tags) {
+		return hs.reconcileCanaryRouting(client, serviceName, tags, backendName, result, serviceFrontends(serviceName, tags, haproxyCfg))
+	}
+	if isInactiveDeployment(tags) {
+		return reconcileInactiveDeployment(client, tags, backendName, result)
+	}
+	if err := hs.reconcileTCPFrontend(client, tags, backendName, result); err != nil {
+		return err
+	}
+	if err := reconcileCertificate(client, tags, result); err != nil {
+		return err
+	}
+	if err := reconcileStickRule(client, backendName, parseStickyMode(tags) == StickyModeSource, result); err != nil {
+		return err
+	}
+	if err := reconcileHeaders(client, backendName, tags, result); err != nil {
+		return err
+	}
+	hs.requestACMECertificate(serviceName, tags, result)
+	frontends := serviceFrontends(serviceName, tags, haproxyCfg)
+	if err := hs.reconcileFrontendRule(client, serviceName, tags, backendName, result, frontends); err != nil {
+		return err
+	}
+	if err := hs.reconcileRateLimit(client, serviceName, tags, backendName, result, frontends); err != nil {
+		return err
+	}
+	if haproxyCfg.DomainMetrics && !hs.rulesUnmanaged {
+		if err := hs.reconcileDomainMetrics(client, serviceName, tags, backendName, result, frontends); err != nil {
+			return err
+		}
+	}
+	if classifyService(tags) == haproxy.ServiceTypeDynamic {
+		if err := hs.promoteCanary(client, serviceName, tags, backendName, result, frontends); err != nil {
+			return err
+		}
+	}
+	return hs.reconcileHTTPSRedirect(client, serviceName, tags, result, haproxyCfg.HTTPFrontend)
+}
+
+// removeServiceRouting removes everything that routes traffic to the service's backend
+func (hs *handlerState) removeServiceRouting(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	result map[string]string,
+	haproxyCfg *config.HAProxyConfig,
+) {
+	frontends := serviceFrontends(serviceName, tags, haproxyCfg)
+	hs.removeFrontendRule(client, serviceName, tags, result, frontends)
+	backendName := stableBackendName(serviceName, tags)
+	removeAuthUserlist(client, parseServiceAuth(tags, backendName), result)
+	if parseRateLimit(tags) != nil {
+		removeRateLimit(client, backendName, result, parseFrontends(tags, frontends))
+	}
+	if haproxyCfg.DomainMetrics && !hs.rulesUnmanaged && hasDomainMapping(tags) {
+		removeDomainMetrics(client, backendName, result, parseFrontends(tags, frontends))
+	}
+	hs.removeHTTPSRedirect(client, serviceName, tags, result, haproxyCfg.HTTPFrontend)
+	removeTCPFrontend(client, tags, backendName, result)
 }
 
 // reconcileFrontendRule ensures the frontend rule exists for domain-tagged services
-func reconcileFrontendRule(
+// in every frontend the service publishes to
+func (hs *handlerState) reconcileFrontendRule(
 	client haproxy.ClientInterface,
 	serviceName string,
 	tags []string,
 	backendName string,
 	result map[string]string,
-	frontendName string,
+	defaultFrontends []string,
 ) error {
 	domainMapping := parseDomainMapping(serviceName, tags)
 	if domainMapping == nil {
-		fmt.Printf("DEBUG: No domain mapping found for service %s with tags: %v\n", serviceName, tags)
+		handlerLog.Debug("No domain mapping", "service", serviceName, "tags", tags)
+		return nil
+	}
+	if hs.rulesUnmanaged {
+		result["frontend_rule_skipped"] = domainMapping.Domain
 		return nil
 	}
+	if isTCPMode(tags) {
+		// A tcp-mode backend can't be selected by the Host header, it has its own frontend
+		result["frontend_rule_skipped"] = domainMapping.Domain + " (tcp mode)"
+		return nil
+	}
+	if domainMapping.Type == haproxy.DomainTypeRegex {
+		if err := validateRegexDomain(domainMapping.Domain); err != nil {
+			return err
+		}
+	}
 
-	fmt.Printf("DEBUG: Reconciling frontend rule for service %s: %s -> %s\n", serviceName, domainMapping.Domain, backendName)
+	auth := parseServiceAuth(tags, backendName)
+	if err := ensureAuthUserlist(client, auth); err != nil {
+		return err
+	}
+
+	var ruleInfo []string
+	added := false
+	for _, frontendName := range parseFrontends(tags, defaultFrontends) {
+		info, err := hs.reconcileFrontendRuleIn(client, frontendName, domainMapping, backendName, auth.userlist())
+		if err != nil {
+			return err
+		}
+		ruleInfo = append(ruleInfo, info)
+		added = added || strings.HasPrefix(info, "added rule")
+	}
+
+	if len(ruleInfo) > 0 {
+		result["frontend_rule"] = strings.Join(ruleInfo, "; ")
+	}
+	if added {
+		hs.publishDNSRecord(serviceName, tags, result)
+	}
+	return nil
+}
+
+// reconcileFrontendRuleIn ensures the frontend rule exists in a single frontend, protected by
+// basic auth against authUserlist if set
+func (hs *handlerState) reconcileFrontendRuleIn(
+	client haproxy.ClientInterface,
+	frontendName string,
+	domainMapping *haproxy.DomainMapping,
+	backendName string,
+	authUserlist string,
+) (string, error) {
+	ruleLog := handlerLog.With("frontend", frontendName, "domain", domainMapping.Domain, "backend", backendName)
+	ruleLog.Debug("Reconciling frontend rule")
 
 	// Check if rule already exists
 	existingRules, err := client.GetFrontendRules(frontendName)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to get existing rules: %v\n", err)
+		ruleLog.Debug("Failed to get existing frontend rules", "error", err)
 	}
 
+	var canary haproxy.FrontendRule
 	for _, rule := range existingRules {
+		if rule.Domain == domainMapping.Domain && rule.Backend == backendName && rule.AuthUserlist == authUserlist &&
+			rule.HostMatch == hs.hostMatch.ForType(domainMapping.Type) {
+			ruleLog.Debug("Frontend rule already exists")
+			// A rule written by hand for the same domain and backend stays someone else's
+			if rule.Managed {
+				hs.ownedRules.add(frontendName, domainMapping.Domain, backendName)
+			}
+			return fmt.Sprintf("rule exists: %s -> %s", domainMapping.Domain, backendName), nil
+		}
+		// A running canary deployment keeps its share when the rule is rewritten
 		if rule.Domain == domainMapping.Domain && rule.Backend == backendName {
-			result["frontend_rule"] = fmt.Sprintf("rule exists: %s -> %s", domainMapping.Domain, backendName)
-			fmt.Printf("DEBUG: Frontend rule already exists: %s -> %s\n", domainMapping.Domain, backendName)
-			return nil
+			canary = rule
 		}
 	}
 
-	err = client.AddFrontendRuleWithType(frontendName, domainMapping.Domain, backendName, domainMapping.Type)
+	if authUserlist == "" && canary.CanaryBackend == "" && hs.hostMatch == haproxy.HostMatchHeader {
+		err = client.AddFrontendRuleWithType(frontendName, domainMapping.Domain, backendName, domainMapping.Type)
+	} else {
+		err = client.SetFrontendRule(frontendName, haproxy.FrontendRule{
+			Domain:        domainMapping.Domain,
+			Backend:       backendName,
+			Type:          domainMapping.Type,
+			AuthUserlist:  authUserlist,
+			HostMatch:     hs.hostMatch,
+			CanaryBackend: canary.CanaryBackend,
+			CanaryPercent: canary.CanaryPercent,
+		})
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create frontend rule for domain %s: %w", domainMapping.Domain, err)
+		return "", fmt.Errorf("failed to create frontend rule for domain %s in frontend %s: %w", domainMapping.Domain, frontendName, err)
 	}
-	result["frontend_rule"] = fmt.Sprintf("added rule: %s -> %s", domainMapping.Domain, backendName)
-	fmt.Printf("DEBUG: Successfully created frontend rule: %s -> %s\n", domainMapping.Domain, backendName)
-	return nil
+	ruleLog.Debug("Created frontend rule", "domain_type", domainMapping.Type)
+	hs.ownedRules.add(frontendName, domainMapping.Domain, backendName)
+	hs.recordBackendChange(backendName)
+	return fmt.Sprintf("added rule: %s -> %s", domainMapping.Domain, backendName), nil
 }
 
-func handleServiceDeregistration(
+func (hs *handlerState) handleServiceDeregistration(
 	ctx context.Context,
 	client haproxy.ClientInterface,
 	event *ServiceEvent,
 	cfg *config.Config,
 ) (interface{}, error) {
-	return handleServiceDeregistrationWithDrainTimeout(ctx, client, event, cfg, config.DefaultDrainTimeoutSec, nil)
+	return hs.handleServiceDeregistrationWithDrainTimeout(ctx, client, event, cfg, config.DefaultDrainTimeoutSec, nil)
 }
 
-func handleServiceDeregistrationWithDrainTimeout(
+func (hs *handlerState) handleServiceDeregistrationWithDrainTimeout(
 	_ context.Context,
 	client haproxy.ClientInterface,
 	event *ServiceEvent,
@@ -588,8 +875,8 @@ func handleServiceDeregistrationWithDrainTimeout(
 	drainTimeoutSec int,
 	logger *log.Logger,
 ) (interface{}, error) {
-	backendName := sanitizeServiceName(event.Service.ServiceName)
-	serverName := generateServerName(event.Service.ServiceName, event.Service.Address, event.Service.Port)
+	backendName := serviceBackendName(event.Service.ServiceName, event.Service.Tags)
+	serverName := serviceServerName(&event.Service)
 
 	result := map[string]string{
 		"backend": backendName,
@@ -602,29 +889,61 @@ func handleServiceDeregistrationWithDrainTimeout(
 		return nil, fmt.Errorf("failed to get servers for backend %s: %w", backendName, err)
 	}
 
-	// Count remaining servers after this removal (exclude the server being removed)
-	remainingServers := 0
-	for _, server := range existingServers {
-		if server.Name != serverName {
-			remainingServers++
-		}
+	// Servers filled into a slot are found by their address
+	haproxyServer := serverName
+	if slot, ok := findSlot(existingServers, event.Service.Address, event.Service.Port); ok {
+		haproxyServer = slot
+		result["slot"] = slot
+	}
+
+	// The allocation already moved to a new address and its old server was replaced in place
+	if _, moved := hs.allocations.previous(event.Service.AllocID, backendName, serverName); moved &&
+		!containsServer(existingServers, haproxyServer) {
+		result["status"] = StatusAlreadyReplaced
+		return result, nil
+	}
+
+	// Count the servers that keep serving traffic after this removal, including replacements that
+	// register later in the same batch
+	remainingServers := hs.servingServers(client, backendName, haproxyServer, existingServers) +
+		hs.registrations.pending(backendName)
+
+	// Keep the server until a replacement is established, unless none is left to wait for
+	minOverlap := time.Duration(cfg.HAProxy.MinOverlapSec) * time.Second
+	if minOverlap > 0 && remainingServers > 0 && !hs.overlapSatisfied(client, backendName, haproxyServer, minOverlap) {
+		result["status"] = StatusWaitingForOverlap
+		hs.allocations.forget(event.Service.AllocID, backendName, serverName)
+		go hs.drainAfterOverlap(client, backendName, haproxyServer, minOverlap, maxOverlapWait(&cfg.HAProxy), drainTimeoutSec, logger)
+		return result, nil
 	}
 
 	// Handle server drain/deletion
-	if err := drainAndRemoveServer(client, backendName, serverName, drainTimeoutSec, logger, result); err != nil {
+	if err := hs.drainAndRemoveServer(client, backendName, haproxyServer, drainTimeoutSec, logger, result); err != nil {
 		return nil, err
 	}
+	hs.allocations.forget(event.Service.AllocID, backendName, serverName)
 
-	// Only remove frontend rule if NO servers will remain after this removal
+	// Only remove frontend rule if NO serving servers will remain after this removal. Services in
+	// maintenance keep their routing, their servers never count as serving.
 	if remainingServers == 0 {
-		removeFrontendRule(client, event.Service.ServiceName, event.Service.Tags, result, cfg.HAProxy.Frontend)
+		if isCanary(event.Service.Tags) {
+			hs.removeCanaryRouting(client, event.Service.ServiceName, event.Service.Tags, result,
+				serviceFrontends(event.Service.ServiceName, event.Service.Tags, &cfg.HAProxy))
+		} else if !isInactiveDeployment(event.Service.Tags) && !isMaintenance(event.Service.Tags) {
+			hs.removeServiceRouting(client, event.Service.ServiceName, event.Service.Tags, result, &cfg.HAProxy)
+		}
+		// Services in maintenance keep routing to their backend, it can't be deleted
+		if cfg.HAProxy.DeleteEmptyBackends && !isMaintenance(event.Service.Tags) {
+			delay := time.Duration(drainTimeoutSec+cfg.HAProxy.EmptyBackendGraceSec) * time.Second
+			hs.scheduleEmptyBackendDeletion(client, backendName, event.Service.Tags, delay, logger, result)
+		}
 	}
 
 	return result, nil
 }
 
 // drainAndRemoveServer handles graceful draining and removal of a server
-func drainAndRemoveServer(
+func (hs *handlerState) drainAndRemoveServer(
 	client haproxy.ClientInterface,
 	backendName, serverName string,
 	drainTimeoutSec int,
@@ -640,100 +959,110 @@ func drainAndRemoveServer(
 			return fmt.Errorf("failed to get config version for fallback deletion: %w", versionErr)
 		}
 
-		err = client.DeleteServer(backendName, serverName, version)
+		err = removeServer(client, backendName, serverName, version)
 		if err != nil {
 			return fmt.Errorf("failed to delete server %s from backend %s: %w", serverName, backendName, err)
 		}
 
 		result["status"] = StatusDeleted
 		result["method"] = MethodImmediateDeletion
+		hs.recordBackendChange(backendName)
 		return nil
 	}
 
 	result["status"] = StatusDraining
 	result["method"] = MethodGracefulDrain
+	hs.recordBackendChange(backendName)
 
 	// Schedule delayed removal after drain period
-	go scheduleDelayedServerRemoval(client, backendName, serverName, drainTimeoutSec, logger)
+	dueAt := time.Now().Add(time.Duration(drainTimeoutSec) * time.Second)
+	hs.removals.scheduleRemoval(client, backendName, serverName, dueAt, logger)
 	return nil
 }
 
-// scheduleDelayedServerRemoval removes a server after drain timeout
-func scheduleDelayedServerRemoval(
-	client haproxy.ClientInterface,
-	backendName, serverName string,
-	drainTimeoutSec int,
-	logger *log.Logger,
-) {
-	drainDuration := time.Duration(drainTimeoutSec) * time.Second
-	time.Sleep(drainDuration)
-
-	version, versionErr := client.GetConfigVersion()
-	if versionErr != nil {
-		if logger != nil {
-			logger.Printf("Warning: failed to get config version for delayed deletion: %v", versionErr)
-		}
+// cancelPendingRemoval aborts a scheduled removal for a server that registered again while draining
+// and puts the server back into ready state
+func (hs *handlerState) cancelPendingRemoval(client haproxy.ClientInterface, backendName, serverName string, result map[string]string) {
+	if !hs.removals.cancel(backendName, serverName) {
 		return
 	}
 
-	deleteErr := client.DeleteServer(backendName, serverName, version)
-	if deleteErr != nil {
-		if logger != nil {
-			logger.Printf("Warning: failed delayed deletion of server %s from backend %s: %v", serverName, backendName, deleteErr)
-		}
-	} else {
-		if logger != nil {
-			logger.Printf("Gracefully removed server %s from backend %s after %ds drain",
-				serverName, backendName, drainTimeoutSec)
-		}
+	result["removal_canceled"] = "true"
+	if err := client.ReadyServer(backendName, serverName); err != nil {
+		result["ready_warning"] = fmt.Sprintf("failed to ready server after canceled removal: %v", err)
 	}
 }
 
-// removeFrontendRule removes frontend rule when service has domain tags
-func removeFrontendRule(client haproxy.ClientInterface, serviceName string, tags []string, result map[string]string, frontendName string) {
+// removeFrontendRule removes frontend rules when service has domain tags
+func (hs *handlerState) removeFrontendRule(
+	client haproxy.ClientInterface,
+	serviceName string,
+	tags []string,
+	result map[string]string,
+	defaultFrontends []string,
+) {
 	domainMapping := parseDomainMapping(serviceName, tags)
 	if domainMapping == nil {
 		return
 	}
+	if hs.rulesUnmanaged {
+		result["frontend_rule_skipped"] = domainMapping.Domain
+		return
+	}
 
-	err := client.RemoveFrontendRule(frontendName, domainMapping.Domain)
-	if err != nil {
-		result["frontend_rule_warning"] = fmt.Sprintf("failed to remove frontend rule: %v", err)
+	var warnings []string
+	for _, frontendName := range parseFrontends(tags, defaultFrontends) {
+		if err := client.RemoveFrontendRule(frontendName, domainMapping.Domain); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to remove frontend rule from %s: %v", frontendName, err))
+			continue
+		}
+		hs.ownedRules.remove(frontendName, domainMapping.Domain)
+	}
+
+	if len(warnings) > 0 {
+		result["frontend_rule_warning"] = strings.Join(warnings, "; ")
 	} else {
 		result["frontend_rule_removed"] = domainMapping.Domain
+		hs.recordBackendChange(domainMapping.BackendName)
+		hs.unpublishDNSRecord(serviceName, tags, result)
 	}
 }
 
 // processCustomService adds servers to existing backends
-func processCustomService(
+func (hs *handlerState) processCustomService(
 	ctx context.Context,
 	client haproxy.ClientInterface,
 	event *ServiceEvent,
 	cfg *config.Config,
 ) (interface{}, error) {
+	defer hs.locks.lock(serviceBackendName(event.Service.ServiceName, event.Service.Tags))()
+
 	switch event.Type {
 	case EventTypeServiceRegistration:
-		return handleCustomServiceRegistration(ctx, client, event, cfg)
+		return hs.handleCustomServiceRegistration(ctx, client, event, cfg)
 	case EventTypeServiceDeregistration:
-		return handleCustomServiceDeregistration(ctx, client, event, cfg)
+		return hs.handleCustomServiceDeregistration(ctx, client, event, cfg)
 	case EventTypeNodeEvent, EventTypeNodeDeregistration, EventTypeAllocationUpdated:
 		// Fix Bug #2: Handle events that can affect service availability
 		// These events may indicate a service instance is no longer available
-		// and should be treated as service deregistration
-		return handleCustomServiceDeregistration(ctx, client, event, cfg)
+		// and should be treated as service deregistration, unless the allocation restarted in place
+		if result, ok := hs.restartedInPlace(event, stableBackendName(event.Service.ServiceName, event.Service.Tags)); ok {
+			return result, nil
+		}
+		return hs.handleCustomServiceDeregistration(ctx, client, event, cfg)
 	default:
 		return map[string]string{"status": "skipped", "reason": "unknown event type"}, nil
 	}
 }
 
 // handleCustomServiceRegistration adds servers to existing custom backends
-func handleCustomServiceRegistration(
+func (hs *handlerState) handleCustomServiceRegistration(
 	_ context.Context,
 	client haproxy.ClientInterface,
 	event *ServiceEvent,
 	cfg *config.Config,
 ) (interface{}, error) {
-	backendName := sanitizeServiceName(event.Service.ServiceName)
+	backendName := stableBackendName(event.Service.ServiceName, event.Service.Tags)
 
 	// Ensure the custom backend exists
 	_, err := client.GetBackend(backendName)
@@ -746,7 +1075,7 @@ func handleCustomServiceRegistration(
 		return nil, err
 	}
 
-	serverName := generateServerName(event.Service.ServiceName, event.Service.Address, event.Service.Port)
+	serverName := serviceServerName(&event.Service)
 
 	// Initialize result map
 	result := map[string]string{
@@ -755,18 +1084,18 @@ func handleCustomServiceRegistration(
 	}
 
 	// Ensure server exists in the custom backend
-	serverExists, err := ensureServer(client, backendName, serverName, event.Service.Address, event.Service.Port, version)
+	status, err := hs.ensureServer(client, backendName, serverName, &event.Service, version, result)
 	if err != nil {
 		return nil, err
 	}
-	if serverExists {
-		result["status"] = StatusAlreadyExists
-	} else {
-		result["status"] = StatusCreated
+	result["status"] = status
+	if status == StatusAlreadyExists {
+		hs.cancelPendingRemoval(client, backendName, serverName, result)
 	}
+	hs.allocations.record(event.Service.AllocID, event.Service.NodeID, backendName, serverName)
 
 	// ALWAYS reconcile frontend rules (regardless of server existence)
-	err = reconcileFrontendRule(client, event.Service.ServiceName, event.Service.Tags, backendName, result, cfg.HAProxy.Frontend)
+	err = hs.reconcileServiceRouting(client, event.Service.ServiceName, event.Service.Tags, backendName, result, &cfg.HAProxy)
 	if err != nil {
 		return nil, err
 	}
@@ -775,27 +1104,28 @@ func handleCustomServiceRegistration(
 }
 
 // handleCustomServiceDeregistration removes servers from custom backends
-func handleCustomServiceDeregistration(
+func (hs *handlerState) handleCustomServiceDeregistration(
 	ctx context.Context,
 	client haproxy.ClientInterface,
 	event *ServiceEvent,
 	cfg *config.Config,
 ) (interface{}, error) {
 	// Use the same logic as dynamic services but don't delete the backend
-	return handleServiceDeregistrationWithDrainTimeout(ctx, client, event, cfg, config.DefaultDrainTimeoutSec, nil)
+	return hs.handleServiceDeregistrationWithDrainTimeout(ctx, client, event, cfg, config.DefaultDrainTimeoutSec, nil)
 }
 
 // handleServiceRegistrationWithHealthCheck handles service registration with health check synchronization
-func handleServiceRegistrationWithHealthCheck(
+func (hs *handlerState) handleServiceRegistrationWithHealthCheck(
 	_ context.Context,
 	client haproxy.ClientInterface,
 	nomadClient nomad.NomadClient,
 	event *ServiceEvent,
 	logger *log.Logger,
-	frontendName string,
+	haproxyCfg *config.HAProxyConfig,
 ) (interface{}, error) {
-	backendName := sanitizeServiceName(event.Service.ServiceName)
-	serverName := generateServerName(event.Service.ServiceName, event.Service.Address, event.Service.Port)
+	backendName := serviceBackendName(event.Service.ServiceName, event.Service.Tags)
+	serverName := serviceServerName(&event.Service)
+	hs.cancelEmptyBackendDeletion(backendName)
 
 	// Fetch health check from Nomad if available (needed for backend AND server)
 	serviceCheck := fetchNomadHealthCheck(nomadClient, event.Service.JobID, event.Service.ServiceName, logger)
@@ -807,23 +1137,19 @@ func handleServiceRegistrationWithHealthCheck(
 	}
 
 	// Check if server already exists
-	serverExists, existingResult, err := checkServerExists(
-		client, backendName, serverName, event.Service.ServiceName, event.Service.Tags, frontendName)
+	serverExists, existingResult, err := hs.checkServerExists(
+		client, backendName, serverName, event.Service.ServiceName, event.Service.Tags, haproxyCfg)
 	if err != nil {
 		return nil, err
 	}
 	if serverExists {
+		hs.allocations.record(event.Service.AllocID, event.Service.NodeID, backendName, serverName)
 		return existingResult, nil
 	}
 
 	// Create server with health check configuration
 	server := createServerWithHealthCheck(&event.Service, serverName, serviceCheck, event.Service.Tags, logger)
 
-	_, err = client.CreateServer(backendName, &server, version)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create server %s in backend %s: %w", serverName, backendName, err)
-	}
-
 	// Initialize result map
 	result := map[string]string{
 		"status":     StatusCreated,
@@ -832,30 +1158,65 @@ func handleServiceRegistrationWithHealthCheck(
 		"check_type": server.CheckType,
 	}
 
+	// Fill a pre-provisioned slot instead of adding a server, which would reload HAProxy
+	if haproxyCfg != nil && haproxyCfg.ServerSlots > 0 {
+		slot, filled, err := fillServerSlot(client, backendName, &server, haproxyCfg.ServerSlots)
+		if err != nil {
+			return nil, err
+		}
+		if slot != "" {
+			result["slot"] = slot
+			if filled {
+				hs.recordBackendChange(backendName)
+			} else {
+				result["status"] = StatusAlreadyExists
+				hs.cancelPendingRemoval(client, backendName, slot, result)
+			}
+			hs.allocations.record(event.Service.AllocID, event.Service.NodeID, backendName, serverName)
+			if err := hs.reconcileServiceRouting(client, event.Service.ServiceName, event.Service.Tags, backendName, result, haproxyCfg); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	// Replace the allocation's previous server in one transaction if it moved to a new address
+	replaced, err := hs.swapAllocationServer(client, event.Service.AllocID, backendName, &server, result)
+	if err != nil {
+		return nil, err
+	}
+	if replaced {
+		result["status"] = StatusReplaced
+	} else {
+		_, err = client.CreateServer(backendName, &server, version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create server %s in backend %s: %w", serverName, backendName, err)
+		}
+		hs.recordBackendChange(backendName)
+	}
+	hs.allocations.record(event.Service.AllocID, event.Service.NodeID, backendName, serverName)
+
 	// ALWAYS reconcile frontend rules
-	if err := reconcileFrontendRule(client, event.Service.ServiceName, event.Service.Tags, backendName, result, frontendName); err != nil {
+	if err := hs.reconcileServiceRouting(client, event.Service.ServiceName, event.Service.Tags, backendName, result, haproxyCfg); err != nil {
 		return nil, err
 	}
 
 	return result, nil
 }
 
-// ensureBackendWithHealthCheck ensures backend exists and has proper health check configuration (uses reconciliation pattern)
-func ensureBackendWithHealthCheck(
+// reconcileBackend creates the backend of a dynamic service, or updates the health checks of the
+// existing one. Only a backend that doesn't exist (404) is created, other errors are returned.
+func reconcileBackend(
 	client haproxy.ClientInterface,
 	backendName string,
+	healthCheckConfig *HealthCheckConfig,
 	tags []string,
-	nomadCheck *nomad.ServiceCheck,
+	version int,
 ) (int, error) {
-	version, err := client.GetConfigVersion()
-	if err != nil {
-		return 0, err
-	}
-
-	// Use resolveHealthCheckConfig to properly handle priority
-	healthCheckConfig := resolveHealthCheckConfig(tags, nomadCheck)
-
 	existingBackend, err := client.GetBackend(backendName)
+	if err != nil && !haproxy.IsNotFound(err) {
+		return version, fmt.Errorf("failed to get backend %s: %w", backendName, err)
+	}
 	if err == nil {
 		// Backend exists - verify compatibility and reconcile configuration
 		if !haproxy.IsBackendCompatibleForDynamicService(existingBackend) {
@@ -864,26 +1225,60 @@ func ensureBackendWithHealthCheck(
 		}
 
 		// Reconcile: Update existing backend if configuration differs
-		return updateBackendHealthChecks(client, backendName, existingBackend, healthCheckConfig, version)
+		return updateBackendHealthChecks(client, backendName, existingBackend, healthCheckConfig, tags, version)
 	}
 
 	// Backend doesn't exist - create with desired configuration
-	desiredBackend := buildDesiredBackend(backendName, healthCheckConfig)
+	desiredBackend := buildDesiredBackend(backendName, healthCheckConfig, tags)
 
 	_, err = client.CreateBackend(*desiredBackend, version)
-	if err != nil {
+	if haproxy.IsVersionConflict(err) {
+		// Another writer changed the configuration meanwhile, create it on the current version
+		if version, err = client.GetConfigVersion(); err == nil {
+			_, err = client.CreateBackend(*desiredBackend, version)
+		}
+	}
+	switch {
+	case haproxy.IsConflict(err) && !haproxy.IsVersionConflict(err):
+		// Another writer created the backend meanwhile, reconcile it like an existing one
+		if _, getErr := client.GetBackend(backendName); getErr == nil {
+			return reconcileBackend(client, backendName, healthCheckConfig, tags, version)
+		}
+		return version, fmt.Errorf("failed to create backend %s: %w", backendName, err)
+	case haproxy.IsBadRequest(err):
+		handlerLog.Error("Data Plane API rejected the generated backend configuration", "backend", backendName, "error", err)
+		return version, fmt.Errorf("invalid configuration generated for backend %s: %w", backendName, err)
+	case err != nil:
 		return version, fmt.Errorf("failed to create backend %s: %w", backendName, err)
 	}
 
 	return applyHTTPChecksToBackend(client, backendName, healthCheckConfig, version)
 }
 
+// ensureBackendWithHealthCheck ensures backend exists and has proper health check configuration (uses reconciliation pattern)
+func ensureBackendWithHealthCheck(
+	client haproxy.ClientInterface,
+	backendName string,
+	tags []string,
+	nomadCheck *nomad.ServiceCheck,
+) (int, error) {
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return 0, err
+	}
+
+	// Use resolveHealthCheckConfig to properly handle priority
+	healthCheckConfig := resolveHealthCheckConfig(tags, nomadCheck)
+
+	return reconcileBackend(client, backendName, healthCheckConfig, tags, version)
+}
+
 // checkServerExists checks if server already exists and returns result if it does
-func checkServerExists(
+func (hs *handlerState) checkServerExists(
 	client haproxy.ClientInterface,
 	backendName, serverName, serviceName string,
 	tags []string,
-	frontendName string,
+	haproxyCfg *config.HAProxyConfig,
 ) (exists bool, result interface{}, err error) {
 	existingServers, err := client.GetServers(backendName)
 	if err != nil {
@@ -897,9 +1292,10 @@ func checkServerExists(
 				"backend": backendName,
 				"server":  serverName,
 			}
+			hs.cancelPendingRemoval(client, backendName, serverName, result)
 
 			// ALWAYS reconcile frontend rules
-			if err := reconcileFrontendRule(client, serviceName, tags, backendName, result, frontendName); err != nil {
+			if err := hs.reconcileServiceRouting(client, serviceName, tags, backendName, result, haproxyCfg); err != nil {
 				return true, nil, fmt.Errorf("failed to reconcile frontend rule: %w", err)
 			}
 
@@ -1017,6 +1413,9 @@ func resolveHealthCheckConfig(tags []string, nomadCheck *nomad.ServiceCheck) *He
 		if nomadConfig.Type != "" {
 			healthConfig.Type = nomadConfig.Type
 		}
+		// Interval, timeout and TLS of the Nomad check apply to HAProxy's checks too
+		healthConfig.CheckTiming = nomadConfig.CheckTiming
+		healthConfig.CheckTLS = nomadConfig.CheckTLS
 		// Host is NOT overridden - preserve from domain fallback
 	}
 
@@ -1025,7 +1424,14 @@ func resolveHealthCheckConfig(tags []string, nomadCheck *nomad.ServiceCheck) *He
 	explicitMethod := false
 	explicitType := false
 	hasPath := false
+	hasCheckOptions := false
 	for _, tag := range tags {
+		// Timing and TLS tags tune the check without replacing the Nomad check's path and method
+		if applyCheckTimingTag(&healthConfig.CheckTiming, tag) || applyCheckTLSTag(&healthConfig.CheckTLS, tag) ||
+			applyCheckAgentTag(&healthConfig.CheckAgent, tag) {
+			hasCheckOptions = true
+			continue
+		}
 		if strings.HasPrefix(tag, "haproxy.check.") {
 			hasExplicitTags = true
 			switch {
@@ -1047,6 +1453,14 @@ func resolveHealthCheckConfig(tags []string, nomadCheck *nomad.ServiceCheck) *He
 		}
 	}
 
+	// An external check needs the port of the agent, otherwise the service port is checked
+	if healthConfig.Type == CheckTypeExternal && healthConfig.AgentPort == 0 {
+		healthConfig.Type = CheckTypeTCP
+	}
+	if healthConfig.Type != CheckTypeExternal {
+		healthConfig.CheckAgent = CheckAgent{}
+	}
+
 	// If explicit tags specify path, infer HTTP type unless explicitly set otherwise
 	if hasPath && !explicitType {
 		healthConfig.Type = CheckTypeHTTP
@@ -1064,7 +1478,7 @@ func resolveHealthCheckConfig(tags []string, nomadCheck *nomad.ServiceCheck) *He
 	}
 
 	// If no configuration found at all, return nil
-	if healthConfig.Type == "" && healthConfig.Path == "" && domainMapping == nil && !hasExplicitTags {
+	if healthConfig.Type == "" && healthConfig.Path == "" && domainMapping == nil && !hasExplicitTags && !hasCheckOptions {
 		return nil
 	}
 
@@ -1082,6 +1496,12 @@ func resolveHealthCheckConfig(tags []string, nomadCheck *nomad.ServiceCheck) *He
 		healthConfig.Method = HTTPMethodGET
 	}
 
+	// tcp-mode backends cannot run HTTP checks
+	if isTCPMode(tags) && healthConfig.Type == CheckTypeHTTP {
+		return &HealthCheckConfig{Type: CheckTypeTCP, CheckTiming: healthConfig.CheckTiming, CheckTLS: healthConfig.CheckTLS.normalize()}
+	}
+
+	healthConfig.CheckTLS = healthConfig.CheckTLS.normalize()
 	return healthConfig
 }
 
@@ -1092,6 +1512,9 @@ type HealthCheckConfig struct {
 	Method   string
 	Host     string
 	Disabled bool
+	CheckTiming
+	CheckTLS
+	CheckAgent
 }
 
 // convertNomadToHAProxyCheck converts Nomad check to HAProxy format
@@ -1100,6 +1523,11 @@ func convertNomadToHAProxyCheck(nomadCheck *nomad.ServiceCheck) *HealthCheckConf
 		Type:   nomadCheck.Type,
 		Path:   nomadCheck.Path,
 		Method: nomadCheck.Method,
+		CheckTiming: CheckTiming{
+			Interval: int(nomadCheck.Interval.Milliseconds()),
+			Timeout:  int(nomadCheck.Timeout.Milliseconds()),
+		},
+		CheckTLS: nomadCheckTLS(nomadCheck),
 	}
 
 	// Map Nomad check types to HAProxy equivalents
@@ -1142,16 +1570,69 @@ func applyHealthCheckToServer(server *haproxy.Server, healthCheckConfig *HealthC
 	case CheckTypeTCP:
 		server.CheckType = CheckTypeTCP
 		logger.Printf("Configured TCP health check for server %s (source: %s)", server.Name, source)
+	case CheckTypeExternal:
+		server.CheckType = CheckTypeExternal
+		logger.Printf("Configured agent check for server %s on port %d (source: %s)", server.Name, healthCheckConfig.AgentPort, source)
 	default:
 		server.CheckType = CheckTypeTCP
 		logger.Printf("Using TCP fallback health check for server %s (source: %s)", server.Name, source)
 	}
 }
 
-// sanitizeServiceName converts service name to valid HAProxy backend name
+// BackendNameTagPrefix chooses the backend of a service instead of deriving it from the service name
+const BackendNameTagPrefix = "haproxy.backend.name="
+
+// MaxBackendNameLength bounds backend names derived from service names, longer names are cut and
+// suffixed with a hash of the full name so they stay unique. Canary and deployment suffixes come on top.
+const MaxBackendNameLength = 48
+
+// validBackendName matches names the Data Plane API accepts for backends as they are
+var validBackendName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:-]*$`)
+
+// sanitizeServiceName converts service name to valid HAProxy backend name. Hyphens become
+// underscores as they always did, so names the Data Plane API accepts keep their backend. Names it
+// would reject are rewritten to lowercase letters, digits and underscores, starting with a letter
+// or underscore.
 func sanitizeServiceName(name string) string {
-	// Replace hyphens with underscores for HAProxy compatibility
-	return strings.ReplaceAll(name, "-", "_")
+	legacy := strings.ReplaceAll(name, "-", "_")
+	if validBackendName.MatchString(legacy) && len(legacy) <= MaxBackendNameLength {
+		return legacy
+	}
+
+	sanitized := []byte(strings.ToLower(name))
+	for i, c := range sanitized {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			sanitized[i] = '_'
+		}
+	}
+	result := string(sanitized)
+	if result == "" || (result[0] >= '0' && result[0] <= '9') {
+		result = "svc_" + result
+	}
+	if len(result) > MaxBackendNameLength {
+		hash := sha256.Sum256([]byte(name))
+		result = fmt.Sprintf("%s_%x", result[:MaxBackendNameLength-9], hash[:4])
+	}
+	return result
+}
+
+// stableBackendName returns the backend of a service: the name set via haproxy.backend.name, or the
+// sanitized service name. An explicit name the Data Plane API would reject is sanitized as well.
+func stableBackendName(serviceName string, tags []string) string {
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, BackendNameTagPrefix) {
+			continue
+		}
+		name := strings.TrimPrefix(tag, BackendNameTagPrefix)
+		if validBackendName.MatchString(name) && len(name) <= MaxBackendNameLength {
+			return name
+		}
+		if name != "" {
+			handlerLog.Warn("Sanitizing invalid backend name", "service", serviceName, "backend", name)
+			return sanitizeServiceName(name)
+		}
+	}
+	return sanitizeServiceName(serviceName)
 }
 
 // hasTag checks if a tag slice contains a specific tag
@@ -1164,10 +1645,58 @@ func hasTag(tags []string, tag string) bool {
 	return false
 }
 
+// serviceServerName returns the server name of a service instance. With haproxy.server_name=alloc it
+// is keyed on the allocation, <service>_<short alloc ID>, so an allocation reusing the address and
+// port of a stopped one on the same host gets a server of its own. Instances without allocation,
+// like static services and containers, are always named by address.
+func serviceServerName(svc *Service) string {
+	if svc.AllocID != "" && hasTag(svc.Tags, ServerNameTag+ServerNameAlloc) {
+		return fmt.Sprintf("%s_%s", sanitizeServiceName(svc.ServiceName), shortAllocID(svc.AllocID))
+	}
+	return generateServerName(svc.ServiceName, svc.Address, svc.Port)
+}
+
+// shortAllocID returns the 8-character prefix Nomad shows for allocation IDs
+func shortAllocID(allocID string) string {
+	if len(allocID) > 8 {
+		return allocID[:8]
+	}
+	return allocID
+}
+
 // generateServerName creates a unique server name based on service, address, and port
 func generateServerName(serviceName, address string, port int) string {
 	// Create deterministic server name: servicename_address_port
 	sanitizedService := sanitizeServiceName(serviceName)
-	sanitizedAddress := strings.ReplaceAll(address, ".", "_")
-	return fmt.Sprintf("%s_%s_%d", sanitizedService, sanitizedAddress, port)
+	return fmt.Sprintf("%s_%s_%d", sanitizedService, serverNameAddress(address), port)
+}
+
+// serverNameAddress converts an address into the address part of server names. IPv6 addresses are
+// written in their compressed form with "_" for ":", so every spelling of an address gets the same
+// name, e.g. 2001_db8__1 for [2001:db8:0::1]. Dots and other characters server names can't hold
+// become "_" as well.
+func serverNameAddress(address string) string {
+	address = normalizeServerAddress(address)
+	sanitized := []byte(address)
+	for i, c := range sanitized {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+			sanitized[i] = '_'
+		}
+	}
+	return string(sanitized)
+}
+
+// normalizeServerAddress returns IP addresses in their canonical form without brackets, as the Data
+// Plane API expects them: 2001:db8::1 for [2001:DB8:0::1]. Hostnames are returned as they are.
+func normalizeServerAddress(address string) string {
+	ip, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"))
+	if err != nil {
+		return address
+	}
+	return ip.String()
+}
+
+// hostPort formats an address and port for logs and reports, with brackets around IPv6 addresses
+func hostPort(address string, port int) string {
+	return net.JoinHostPort(address, strconv.Itoa(port))
 }
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
 )
 
 // Test constants
@@ -78,6 +80,14 @@ func TestSanitizeServiceName(t *testing.T) {
 		{"simple", "simple"},
 		{"already_sanitized", "already_sanitized"},
 		{"multi-dash-name", "multi_dash_name"},
+		{"api.v2", "api.v2"},
+		{"Foo-bar", "Foo_bar"},
+		{"MyService", "MyService"},
+		{"svc:grpc", "svc:grpc"},
+		{"team/web", "team_web"},
+		{"My Service", "my_service"},
+		{"3scale", "svc_3scale"},
+		{strings.Repeat("long-service-name-", 4), "long_service_name_long_service_name_lon_ea72ec39"},
 	}
 
 	for _, tt := range tests {
@@ -86,8 +96,57 @@ func TestSanitizeServiceName(t *testing.T) {
 			if result != tt.expected {
 				t.Errorf("sanitizeServiceName(%q) = %q, expected %q", tt.input, result, tt.expected)
 			}
+			if len(result) > MaxBackendNameLength {
+				t.Errorf("sanitizeServiceName(%q) exceeds %d characters", tt.input, MaxBackendNameLength)
+			}
+		})
+	}
+}
+
+func TestSanitizeServiceName_KeepsExistingBackends(t *testing.T) {
+	// Names that were valid backends before the sanitization was hardened keep their backend
+	for _, name := range []string{"Foo-bar", "api.v2", "LegacyWeb", "grpc:internal", "web-app-v2"} {
+		if got, before := sanitizeServiceName(name), strings.ReplaceAll(name, "-", "_"); got != before {
+			t.Errorf("Expected %q to keep the backend %q, got %q", name, before, got)
+		}
+	}
+
+	client := &mockHAProxyClient{backends: map[string]*haproxy.Backend{"Legacy.Web": {Name: "Legacy.Web"}}}
+	event := &ServiceEvent{Type: EventTypeServiceRegistration, Service: Service{
+		ServiceName: "Legacy.Web", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true", "haproxy.backend=custom"},
+	}}
+	if _, err := newHandlerState().handleCustomServiceRegistration(context.Background(), client, event, testConfig()); err != nil {
+		t.Fatalf("Expected the custom backend Legacy.Web to be found, got %v", err)
+	}
+}
+
+func TestStableBackendName(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		expected string
+	}{
+		{"derived from service name", []string{"haproxy.enable=true"}, "web_app"},
+		{"explicit name", []string{"haproxy.backend.name=Legacy-Web.v1"}, "Legacy-Web.v1"},
+		{"invalid explicit name is sanitized", []string{"haproxy.backend.name=team/web"}, "team_web"},
+		{"empty explicit name is ignored", []string{"haproxy.backend.name="}, "web_app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stableBackendName("web-app", tt.tags); got != tt.expected {
+				t.Errorf("stableBackendName() = %q, expected %q", got, tt.expected)
+			}
 		})
 	}
+
+	tags := []string{"haproxy.enable=true", "haproxy.backend.name=legacy_web", "haproxy.domain=web.example.com"}
+	if mapping := parseDomainMapping("web-app", tags); mapping.BackendName != "legacy_web" {
+		t.Errorf("Expected the domain to route to the explicit backend, got %s", mapping.BackendName)
+	}
+	if got := serviceBackendName("web-app", append(tags, "haproxy.backend=dynamic", "haproxy.canary.percent=20")); got != "legacy_web"+CanaryBackendSuffix {
+		t.Errorf("Expected the canary backend of the explicit backend, got %s", got)
+	}
 }
 
 func TestGenerateServerName(t *testing.T) {
@@ -100,6 +159,10 @@ func TestGenerateServerName(t *testing.T) {
 		{"api-service", "192.168.1.10", 8080, "api_service_192_168_1_10_8080"},
 		{"web", "127.0.0.1", 3000, "web_127_0_0_1_3000"},
 		{"database", "10.0.0.5", 5432, "database_10_0_0_5_5432"},
+		{"ipv6", "2001:db8::1", 8080, "ipv6_2001_db8__1_8080"},
+		{"ipv6-bracketed", "[2001:DB8:0:0::1]", 8080, "ipv6_bracketed_2001_db8__1_8080"},
+		{"ipv6-zone", "fe80::1%eth0", 8080, "ipv6_zone_fe80__1_eth0_8080"},
+		{"hostname", "web-1.internal", 80, "hostname_web-1_internal_80"},
 	}
 
 	for _, tt := range tests {
@@ -113,6 +176,54 @@ func TestGenerateServerName(t *testing.T) {
 	}
 }
 
+func TestServiceServerName(t *testing.T) {
+	hs := newHandlerState()
+	tags := []string{"haproxy.enable=true", "haproxy.server_name=alloc"}
+	tests := []struct {
+		name     string
+		service  Service
+		expected string
+	}{
+		{"address scheme", Service{ServiceName: "api", Address: "10.0.0.1", Port: 8080, AllocID: "0f1e2d3c-aaaa-bbbb"}, "api_10_0_0_1_8080"},
+		{"alloc scheme", Service{ServiceName: "api", Address: "10.0.0.1", Port: 8080, AllocID: "0f1e2d3c-aaaa-bbbb", Tags: tags}, "api_0f1e2d3c"},
+		{"without allocation", Service{ServiceName: "api", Address: "10.0.0.1", Port: 8080, Tags: tags}, "api_10_0_0_1_8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serviceServerName(&tt.service); got != tt.expected {
+				t.Errorf("serviceServerName() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+
+	// An allocation reusing the port of a stopped one on the same host must not share its server
+	expected := hs.buildExpectedServersMap([]*nomad.Service{
+		{ServiceName: "api", Address: "10.0.0.1", Port: 8080, AllocID: "11111111-old", Tags: tags},
+		{ServiceName: "api", Address: "10.0.0.1", Port: 8080, AllocID: "22222222-new", Tags: tags},
+	})
+	if len(expected["api"]) != 2 || !expected["api"]["api_22222222"] {
+		t.Errorf("Expected a server per allocation, got %v", expected["api"])
+	}
+}
+
+func TestNormalizeServerAddress(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1":           "10.0.0.1",
+		"2001:db8::1":        "2001:db8::1",
+		"[2001:DB8:0:0::1]":  "2001:db8::1",
+		"::ffff:10.0.0.1":    "::ffff:10.0.0.1",
+		"web.service.consul": "web.service.consul",
+	}
+	for address, expected := range tests {
+		if got := normalizeServerAddress(address); got != expected {
+			t.Errorf("normalizeServerAddress(%q) = %q, expected %q", address, got, expected)
+		}
+	}
+	if got := hostPort("2001:db8::1", 8080); got != "[2001:db8::1]:8080" {
+		t.Errorf("Expected a bracketed IPv6 address, got %s", got)
+	}
+}
+
 // mockHAProxyClient implements haproxy.ClientInterface for testing
 type mockHAProxyClient struct {
 	mu                      sync.Mutex
@@ -127,6 +238,27 @@ type mockHAProxyClient struct {
 	addFrontendRuleError    error
 	removeFrontendRuleCalls []RemoveFrontendRuleCall
 	removeFrontendRuleError error
+	createdFrontends        []haproxy.Frontend
+	createdBinds            []haproxy.Bind
+	deletedFrontends        []string
+	deletedBackends         []string
+	setFrontendRules        []haproxy.FrontendRule
+	userlistUsers           map[string]string
+	deletedUserlists        []string
+	httpRequestRules        map[string][]haproxy.HTTPRequestRule
+	httpResponseRules       map[string][]haproxy.HTTPResponseRule
+	backendSwitchingRules   map[string][]haproxy.BackendSwitchingRule
+	stickRules              map[string][]haproxy.StickRule
+	swappedServers          []string
+	sslCertificates         map[string]haproxy.SSLCertificate
+	replacedCertificates    []string
+	backends                map[string]*haproxy.Backend
+	backendServers          map[string][]haproxy.Server
+	frontendRules           map[string][]haproxy.FrontendRule
+	deletedServers          []string
+	rawConfiguration        string
+	updatedFrontends        []string
+	stickTableEntries       map[string][]haproxy.StickTableEntry
 }
 
 type FrontendRuleCall struct {
@@ -140,11 +272,34 @@ type RemoveFrontendRuleCall struct {
 	Domain   string
 }
 
+func (m *mockHAProxyClient) GetInfo() (*haproxy.APIInfo, error) {
+	return &haproxy.APIInfo{}, m.getVersionError
+}
+
 func (m *mockHAProxyClient) GetConfigVersion() (int, error) {
 	return 1, m.getVersionError
 }
 
+func (m *mockHAProxyClient) GetRawConfiguration() (string, error) {
+	return m.rawConfiguration, m.getVersionError
+}
+
+func (m *mockHAProxyClient) DeleteStaleTransactions() (int, error) {
+	return 0, nil
+}
+
+func (m *mockHAProxyClient) GetBackends() ([]haproxy.Backend, error) {
+	backends := make([]haproxy.Backend, 0, len(m.backends))
+	for _, backend := range m.backends {
+		backends = append(backends, *backend)
+	}
+	return backends, nil
+}
+
 func (m *mockHAProxyClient) GetBackend(name string) (*haproxy.Backend, error) {
+	if backend, ok := m.backends[name]; ok {
+		return backend, nil
+	}
 	return nil, &haproxy.APIError{StatusCode: 404}
 }
 
@@ -157,7 +312,17 @@ func (m *mockHAProxyClient) ReplaceBackend(backend *haproxy.Backend, version int
 	return backend, nil
 }
 
+func (m *mockHAProxyClient) DeleteBackend(name string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletedBackends = append(m.deletedBackends, name)
+	return nil
+}
+
 func (m *mockHAProxyClient) GetServers(backendName string) ([]haproxy.Server, error) {
+	if servers, ok := m.backendServers[backendName]; ok {
+		return servers, m.getServersError
+	}
 	return m.getServersServers, m.getServersError
 }
 
@@ -169,13 +334,62 @@ func (m *mockHAProxyClient) DeleteServer(backendName, serverName string, version
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.deleteCalled = true
+	m.deletedServers = append(m.deletedServers, backendName+"/"+serverName)
 	return m.deleteError
 }
 
+func (m *mockHAProxyClient) ReplaceServer(backendName string, server *haproxy.Server, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	servers := m.backendServers[backendName]
+	for i := range servers {
+		if servers[i].Name == server.Name {
+			servers[i] = *server
+			return nil
+		}
+	}
+	return &haproxy.APIError{StatusCode: 404}
+}
+
+func (m *mockHAProxyClient) SwapServer(backendName, oldServerName string, server *haproxy.Server) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.swappedServers = append(m.swappedServers, oldServerName+"->"+server.Name)
+	return nil
+}
+
+func (m *mockHAProxyClient) UpdateServers(backendName string, remove []string, create []haproxy.Server) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, serverName := range remove {
+		m.deletedServers = append(m.deletedServers, backendName+"/"+serverName)
+	}
+	if m.backendServers == nil {
+		m.backendServers = make(map[string][]haproxy.Server)
+	}
+	m.backendServers[backendName] = append(m.backendServers[backendName], create...)
+	return nil
+}
+
 func (m *mockHAProxyClient) GetRuntimeServer(backendName, serverName string) (*haproxy.RuntimeServer, error) {
 	return &haproxy.RuntimeServer{}, nil
 }
 
+func (m *mockHAProxyClient) GetRuntimeServers(backendName string) ([]haproxy.RuntimeServer, error) {
+	servers, err := m.GetServers(backendName)
+	runtime := make([]haproxy.RuntimeServer, 0, len(servers))
+	for _, server := range servers {
+		runtime = append(runtime, haproxy.RuntimeServer{ServerName: server.Name})
+	}
+	return runtime, err
+}
+
+func (m *mockHAProxyClient) GetStickTableEntries(table string) ([]haproxy.StickTableEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]haproxy.StickTableEntry{}, m.stickTableEntries[table]...), nil
+}
+
 func (m *mockHAProxyClient) SetServerState(ctx context.Context, backendName, serverName, adminState string) error {
 	return nil
 }
@@ -211,6 +425,35 @@ func (m *mockHAProxyClient) AddFrontendRuleWithType(frontend, domain, backend st
 	return m.AddFrontendRule(frontend, domain, backend)
 }
 
+func (m *mockHAProxyClient) SetFrontendRule(frontend string, rule haproxy.FrontendRule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setFrontendRules = append(m.setFrontendRules, rule)
+	for i := range m.frontendRules[frontend] {
+		if m.frontendRules[frontend][i].Domain == rule.Domain {
+			m.frontendRules[frontend][i] = rule
+		}
+	}
+	return nil
+}
+
+func (m *mockHAProxyClient) EnsureUserlistUser(userlist, username, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userlistUsers == nil {
+		m.userlistUsers = make(map[string]string)
+	}
+	m.userlistUsers[userlist+"/"+username] = passwordHash
+	return nil
+}
+
+func (m *mockHAProxyClient) DeleteUserlist(name string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletedUserlists = append(m.deletedUserlists, name)
+	return nil
+}
+
 func (m *mockHAProxyClient) RemoveFrontendRule(frontend, domain string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -221,9 +464,17 @@ func (m *mockHAProxyClient) RemoveFrontendRule(frontend, domain string) error {
 	return m.removeFrontendRuleError
 }
 
+func (m *mockHAProxyClient) ResetFrontendRules(frontend string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.frontendRules, frontend)
+	return nil
+}
+
 func (m *mockHAProxyClient) GetFrontendRules(frontend string) ([]haproxy.FrontendRule, error) {
-	// Mock implementation - return empty rules for existing tests
-	return []haproxy.FrontendRule{}, nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]haproxy.FrontendRule{}, m.frontendRules[frontend]...), nil
 }
 
 func (m *mockHAProxyClient) GetHTTPChecks(backendName string) ([]haproxy.HTTPCheck, error) {
@@ -236,6 +487,267 @@ func (m *mockHAProxyClient) SetHTTPChecks(backendName string, checks []haproxy.H
 	return nil
 }
 
+func (m *mockHAProxyClient) GetFrontend(name string) (*haproxy.Frontend, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.createdFrontends {
+		if m.createdFrontends[i].Name == name {
+			return &m.createdFrontends[i], nil
+		}
+	}
+	return nil, &haproxy.APIError{StatusCode: 404}
+}
+
+func (m *mockHAProxyClient) UpdateFrontendLogging(frontend *haproxy.Frontend, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.createdFrontends {
+		if m.createdFrontends[i].Name == frontend.Name {
+			m.createdFrontends[i].LogFormat = frontend.LogFormat
+			m.createdFrontends[i].HTTPLog = frontend.HTTPLog
+			m.createdFrontends[i].TCPLog = frontend.TCPLog
+		}
+	}
+	m.updatedFrontends = append(m.updatedFrontends, frontend.Name)
+	return nil
+}
+
+func (m *mockHAProxyClient) SetFrontendDefaultBackend(frontendName, backendName string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.createdFrontends {
+		if m.createdFrontends[i].Name == frontendName {
+			m.createdFrontends[i].DefaultBackend = backendName
+		}
+	}
+	return nil
+}
+
+func (m *mockHAProxyClient) CreateFrontend(frontend *haproxy.Frontend, version int) (*haproxy.Frontend, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.createdFrontends = append(m.createdFrontends, *frontend)
+	return frontend, nil
+}
+
+func (m *mockHAProxyClient) DeleteFrontend(name string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deletedFrontends = append(m.deletedFrontends, name)
+	return nil
+}
+
+func (m *mockHAProxyClient) CreateBind(frontendName string, bind *haproxy.Bind, version int) (*haproxy.Bind, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.createdBinds = append(m.createdBinds, *bind)
+	return bind, nil
+}
+
+func (m *mockHAProxyClient) EnsureFrontend(frontend *haproxy.Frontend, binds []haproxy.Bind) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := true
+	for i := range m.createdFrontends {
+		if m.createdFrontends[i].Name == frontend.Name {
+			changed = false
+		}
+	}
+	if changed {
+		m.createdFrontends = append(m.createdFrontends, *frontend)
+	}
+
+	wanted := make(map[string]bool, len(binds))
+	for _, bind := range binds {
+		wanted[bind.Name] = true
+	}
+	kept := m.createdBinds[:0]
+	for _, bind := range m.createdBinds {
+		if strings.HasPrefix(bind.Name, frontend.Name+"_") && !wanted[bind.Name] {
+			changed = true
+			continue
+		}
+		kept = append(kept, bind)
+	}
+	m.createdBinds = kept
+	for _, bind := range binds {
+		found := false
+		for i := range m.createdBinds {
+			if m.createdBinds[i].Name == bind.Name {
+				found = true
+				if m.createdBinds[i] != bind {
+					m.createdBinds[i], changed = bind, true
+				}
+			}
+		}
+		if !found {
+			m.createdBinds, changed = append(m.createdBinds, bind), true
+		}
+	}
+	return changed, nil
+}
+
+func (m *mockHAProxyClient) GetHTTPRequestRules(parentType, parentName string) ([]haproxy.HTTPRequestRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]haproxy.HTTPRequestRule{}, m.httpRequestRules[parentType+"/"+parentName]...), nil
+}
+
+func (m *mockHAProxyClient) CreateHTTPRequestRule(
+	parentType, parentName string, index int, rule *haproxy.HTTPRequestRule, version int,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.httpRequestRules == nil {
+		m.httpRequestRules = make(map[string][]haproxy.HTTPRequestRule)
+	}
+	key := parentType + "/" + parentName
+	rules := m.httpRequestRules[key]
+	rules = append(rules[:index], append([]haproxy.HTTPRequestRule{*rule}, rules[index:]...)...)
+	m.httpRequestRules[key] = rules
+	return nil
+}
+
+func (m *mockHAProxyClient) DeleteHTTPRequestRule(parentType, parentName string, index, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := parentType + "/" + parentName
+	rules := m.httpRequestRules[key]
+	m.httpRequestRules[key] = append(rules[:index], rules[index+1:]...)
+	return nil
+}
+
+func (m *mockHAProxyClient) GetHTTPResponseRules(parentType, parentName string) ([]haproxy.HTTPResponseRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]haproxy.HTTPResponseRule{}, m.httpResponseRules[parentType+"/"+parentName]...), nil
+}
+
+func (m *mockHAProxyClient) CreateHTTPResponseRule(
+	parentType, parentName string, index int, rule *haproxy.HTTPResponseRule, version int,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.httpResponseRules == nil {
+		m.httpResponseRules = make(map[string][]haproxy.HTTPResponseRule)
+	}
+	key := parentType + "/" + parentName
+	rules := m.httpResponseRules[key]
+	rules = append(rules[:index], append([]haproxy.HTTPResponseRule{*rule}, rules[index:]...)...)
+	m.httpResponseRules[key] = rules
+	return nil
+}
+
+func (m *mockHAProxyClient) DeleteHTTPResponseRule(parentType, parentName string, index, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := parentType + "/" + parentName
+	rules := m.httpResponseRules[key]
+	m.httpResponseRules[key] = append(rules[:index], rules[index+1:]...)
+	return nil
+}
+
+func (m *mockHAProxyClient) GetBackendSwitchingRules(frontend string) ([]haproxy.BackendSwitchingRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]haproxy.BackendSwitchingRule{}, m.backendSwitchingRules[frontend]...), nil
+}
+
+func (m *mockHAProxyClient) CreateBackendSwitchingRule(frontend string, index int, rule *haproxy.BackendSwitchingRule, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.backendSwitchingRules == nil {
+		m.backendSwitchingRules = make(map[string][]haproxy.BackendSwitchingRule)
+	}
+	rules := m.backendSwitchingRules[frontend]
+	rules = append(rules[:index], append([]haproxy.BackendSwitchingRule{*rule}, rules[index:]...)...)
+	m.backendSwitchingRules[frontend] = rules
+	return nil
+}
+
+func (m *mockHAProxyClient) DeleteBackendSwitchingRule(frontend string, index, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := m.backendSwitchingRules[frontend]
+	m.backendSwitchingRules[frontend] = append(rules[:index], rules[index+1:]...)
+	return nil
+}
+
+func (m *mockHAProxyClient) GetStickRules(backend string) ([]haproxy.StickRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]haproxy.StickRule{}, m.stickRules[backend]...), nil
+}
+
+func (m *mockHAProxyClient) CreateStickRule(backend string, index int, rule *haproxy.StickRule, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stickRules == nil {
+		m.stickRules = make(map[string][]haproxy.StickRule)
+	}
+	rules := m.stickRules[backend]
+	rules = append(rules[:index], append([]haproxy.StickRule{*rule}, rules[index:]...)...)
+	m.stickRules[backend] = rules
+	return nil
+}
+
+func (m *mockHAProxyClient) DeleteStickRule(backend string, index, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := m.stickRules[backend]
+	m.stickRules[backend] = append(rules[:index], rules[index+1:]...)
+	return nil
+}
+
+func (m *mockHAProxyClient) GetSSLCertificates() ([]haproxy.SSLCertificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	certificates := make([]haproxy.SSLCertificate, 0, len(m.sslCertificates))
+	for _, certificate := range m.sslCertificates {
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+func (m *mockHAProxyClient) GetSSLCertificate(name string) (*haproxy.SSLCertificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	certificate, exists := m.sslCertificates[name]
+	if !exists {
+		return nil, &haproxy.APIError{StatusCode: 404}
+	}
+	return &certificate, nil
+}
+
+func (m *mockHAProxyClient) CreateSSLCertificate(name string, pem []byte) (*haproxy.SSLCertificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sslCertificates == nil {
+		m.sslCertificates = make(map[string]haproxy.SSLCertificate)
+	}
+	fingerprint, _ := certificateFingerprint(pem)
+	certificate := haproxy.SSLCertificate{StorageName: name, SHA256FingerPrint: fingerprint}
+	m.sslCertificates[name] = certificate
+	return &certificate, nil
+}
+
+func (m *mockHAProxyClient) ReplaceSSLCertificate(name string, pem []byte) (*haproxy.SSLCertificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fingerprint, _ := certificateFingerprint(pem)
+	certificate := haproxy.SSLCertificate{StorageName: name, SHA256FingerPrint: fingerprint}
+	m.sslCertificates[name] = certificate
+	m.replacedCertificates = append(m.replacedCertificates, name)
+	return &certificate, nil
+}
+
+func (m *mockHAProxyClient) DeleteSSLCertificate(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sslCertificates, name)
+	return nil
+}
+
 // Helper methods for thread-safe access to test state
 func (m *mockHAProxyClient) wasDrainCalled() bool {
 	m.mu.Lock()
@@ -262,6 +774,7 @@ func (m *mockHAProxyClient) getRemoveFrontendRuleCalls() []RemoveFrontendRuleCal
 }
 
 func TestHandleServiceDeregistrationWithDrainTimeout_DrainSuccess(t *testing.T) {
+	hs := newHandlerState()
 	mockClient := &mockHAProxyClient{}
 	logger := log.New(os.Stdout, "test: ", log.LstdFlags)
 
@@ -275,7 +788,7 @@ func TestHandleServiceDeregistrationWithDrainTimeout_DrainSuccess(t *testing.T)
 		},
 	}
 
-	result, err := handleServiceDeregistrationWithDrainTimeout(
+	result, err := hs.handleServiceDeregistrationWithDrainTimeout(
 		context.Background(),
 		mockClient,
 		event,
@@ -314,6 +827,7 @@ func TestHandleServiceDeregistrationWithDrainTimeout_DrainSuccess(t *testing.T)
 }
 
 func TestHandleServiceDeregistrationWithDrainTimeout_DrainFails(t *testing.T) {
+	hs := newHandlerState()
 	mockClient := &mockHAProxyClient{
 		drainError: fmt.Errorf("drain failed"),
 	}
@@ -329,7 +843,7 @@ func TestHandleServiceDeregistrationWithDrainTimeout_DrainFails(t *testing.T) {
 		},
 	}
 
-	result, err := handleServiceDeregistrationWithDrainTimeout(
+	result, err := hs.handleServiceDeregistrationWithDrainTimeout(
 		context.Background(),
 		mockClient,
 		event,
@@ -576,6 +1090,7 @@ func TestProcessServiceEventWithHealthCheckAndConfig_WithDomainTag(t *testing.T)
 
 // TestHandleServiceRegistrationWithHealthCheck_WithDomainTag tests the specific function
 func TestHandleServiceRegistrationWithHealthCheck_WithDomainTag(t *testing.T) {
+	hs := newHandlerState()
 	mockHAProxyClient := &mockHAProxyClient{}
 	logger := log.New(os.Stderr, "[test] ", log.LstdFlags)
 
@@ -590,13 +1105,13 @@ func TestHandleServiceRegistrationWithHealthCheck_WithDomainTag(t *testing.T) {
 		},
 	}
 
-	result, err := handleServiceRegistrationWithHealthCheck(
+	result, err := hs.handleServiceRegistrationWithHealthCheck(
 		context.Background(),
 		mockHAProxyClient,
 		nil, // nil nomad client for testing
 		event,
 		logger,
-		expectedFrontend,
+		&testConfig().HAProxy,
 	)
 
 	if err != nil {
@@ -719,3 +1234,127 @@ func TestHealthCheckWithDomainTagIntegration(t *testing.T) {
 		t.Logf("Frontend rule removal warning (acceptable): %s", warning)
 	}
 }
+
+func TestProcessServiceEventWithFrontendTag_PublishesToAllFrontends(t *testing.T) {
+	mockClient := &mockHAProxyClient{}
+
+	event := &ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Service: Service{
+			ServiceName: "api-service",
+			Address:     "192.168.1.10",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=" + testDomain, "haproxy.frontend=http,https"},
+		},
+	}
+
+	_, err := ProcessServiceEvent(context.Background(), mockClient, event, testConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+
+	calls := mockClient.getAddFrontendRuleCalls()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 AddFrontendRule calls, got %d", len(calls))
+	}
+	if calls[0].Frontend != "http" || calls[1].Frontend != "https" {
+		t.Errorf("Expected rules in http and https, got %+v", calls)
+	}
+
+	event.Type = eventTypeServiceDeregister
+	_, err = ProcessServiceEvent(context.Background(), mockClient, event, testConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+
+	if removed := mockClient.getRemoveFrontendRuleCalls(); len(removed) != 2 {
+		t.Errorf("Expected 2 RemoveFrontendRule calls, got %d", len(removed))
+	}
+}
+
+func TestProcessServiceEventWithDomainTag_FrontendRulesUnmanaged(t *testing.T) {
+	hs := newHandlerState()
+	hs.rulesUnmanaged = true
+	ctx := withHandlerState(context.Background(), hs)
+
+	mockClient := &mockHAProxyClient{
+		getServersServers: []haproxy.Server{
+			{Name: testBackend + "_10_0_0_1_8080"},
+		},
+	}
+	event := &ServiceEvent{
+		Type: "ServiceRegistration",
+		Service: Service{
+			ServiceName: "api-service",
+			Address:     "10.0.0.2",
+			Port:        8080,
+			Tags:        []string{"haproxy.enable=true", "haproxy.domain=" + testDomain},
+		},
+	}
+
+	result, err := ProcessServiceEvent(ctx, mockClient, event, testConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	resultMap := result.(map[string]string)
+	if resultMap["status"] != StatusCreated || resultMap["frontend_rule_skipped"] != testDomain {
+		t.Errorf("Expected the server to be created and the rule skipped, got %v", resultMap)
+	}
+	if calls := mockClient.getAddFrontendRuleCalls(); len(calls) != 0 {
+		t.Errorf("Expected no AddFrontendRule calls, got %d", len(calls))
+	}
+
+	event.Type = eventTypeServiceDeregister
+	event.Service.Address = "10.0.0.1"
+	if _, err := ProcessServiceEvent(ctx, mockClient, event, testConfig()); err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+	if !mockClient.wasDrainCalled() {
+		t.Error("Expected the server to be drained")
+	}
+	if calls := mockClient.getRemoveFrontendRuleCalls(); len(calls) != 0 {
+		t.Errorf("Expected no RemoveFrontendRule calls, got %d", len(calls))
+	}
+}
+
+// backendErrorClient fails GetBackend and CreateBackend with the given errors
+type backendErrorClient struct {
+	mockHAProxyClient
+	getBackendErr    error
+	createBackendErr error
+	createCalls      int
+}
+
+func (m *backendErrorClient) GetBackend(name string) (*haproxy.Backend, error) {
+	if m.getBackendErr != nil {
+		return nil, m.getBackendErr
+	}
+	return m.mockHAProxyClient.GetBackend(name)
+}
+
+//nolint:gocritic // Matches interface signature
+func (m *backendErrorClient) CreateBackend(backend haproxy.Backend, version int) (*haproxy.Backend, error) {
+	m.createCalls++
+	if m.createBackendErr != nil {
+		return nil, m.createBackendErr
+	}
+	return &backend, nil
+}
+
+func TestEnsureBackendClassifiesErrors(t *testing.T) {
+	// Only a missing backend is created, other errors must not lead to a create
+	client := &backendErrorClient{getBackendErr: &haproxy.APIError{StatusCode: 500}}
+	if _, err := ensureBackend(client, "web", 1, nil); err == nil || client.createCalls != 0 {
+		t.Errorf("Expected the error to be returned without create, got %v and %d creates", err, client.createCalls)
+	}
+
+	client = &backendErrorClient{createBackendErr: &haproxy.APIError{StatusCode: 400, Message: "invalid balance"}}
+	if _, err := ensureBackend(client, "web", 1, nil); err == nil || !strings.Contains(err.Error(), "invalid configuration generated") {
+		t.Errorf("Expected a rejected configuration to be reported, got %v", err)
+	}
+
+	client = &backendErrorClient{createBackendErr: &haproxy.APIError{StatusCode: 409, Message: "version mismatch"}}
+	if _, err := ensureBackend(client, "web", 1, nil); err == nil || client.createCalls != 2 {
+		t.Errorf("Expected a version conflict to be retried once, got %v and %d creates", err, client.createCalls)
+	}
+}
@@ -0,0 +1,124 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+// Shutdown constants
+const (
+	// PendingRemovalsState is the state key of the removals left pending by the previous run
+	PendingRemovalsState = "pending_removals.json"
+
+	ShutdownPollInterval = 100 * time.Millisecond
+	stateTimeout         = 10 * time.Second
+)
+
+// finishPendingRemovals gives the pending server removals up to shutdown_timeout_sec to complete
+// and persists the remaining ones, so the next run (or the next leader) restores them instead of
+// leaving drained servers behind. They are persisted right away as well, in case the process is
+// killed before the timeout.
+func (c *Connector) finishPendingRemovals() {
+	hs := c.currentHandlers()
+	if hs.removals.stats().Pending == 0 {
+		hs.removals.stop()
+		return
+	}
+	c.persistPendingRemovals()
+
+	timeout := time.Duration(c.cfg().HAProxy.ShutdownTimeoutSec) * time.Second
+	c.logger.Printf("Waiting up to %s for %d pending server removals", timeout, hs.removals.stats().Pending)
+	if !hs.removals.wait(timeout) {
+		c.logger.Printf("Warning: %d server removals still pending after %s", hs.removals.stats().Pending, timeout)
+	}
+
+	hs.removals.stop()
+	c.persistPendingRemovals()
+}
+
+// handOverPendingRemovals stops executing the pending server removals when the leadership is lost
+// and persists them for the new leader, which may already be writing to HAProxy
+func (c *Connector) handOverPendingRemovals() {
+	hs := c.currentHandlers()
+	hs.removals.stop()
+	if hs.removals.stats().Pending == 0 {
+		return
+	}
+	c.persistPendingRemovals()
+}
+
+func (c *Connector) persistPendingRemovals() {
+	hs := c.currentHandlers()
+	ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+	defer cancel()
+
+	removals := hs.removals.snapshot()
+	if err := storePendingRemovals(ctx, c.state, removals); err != nil {
+		c.logger.Printf("Warning: Failed to persist %d pending server removals: %v", len(removals), err)
+		return
+	}
+	if len(removals) > 0 {
+		c.logger.Printf("Persisted %d pending server removals for the next start", len(removals))
+	}
+}
+
+// restorePendingRemovals reschedules the removals persisted by the previous run. Removals whose
+// drain period passed meanwhile are executed right away, unless the server registers again first.
+func (c *Connector) restorePendingRemovals(ctx context.Context) {
+	hs := c.currentHandlers()
+	removals, err := loadPendingRemovals(ctx, c.state)
+	if err != nil {
+		c.logger.Printf("Warning: Failed to load pending server removals: %v", err)
+		return
+	}
+	if len(removals) == 0 {
+		return
+	}
+
+	for _, removal := range removals {
+		if removal.DueAt.IsZero() {
+			go hs.drainAfterOverlap(c.haproxyClient, removal.Backend, removal.Server,
+				time.Duration(c.cfg().HAProxy.MinOverlapSec)*time.Second, maxOverlapWait(&c.cfg().HAProxy),
+				c.cfg().HAProxy.DrainTimeoutSec, c.logger)
+			continue
+		}
+		hs.removals.scheduleRemoval(c.haproxyClient, removal.Backend, removal.Server, removal.DueAt, c.logger)
+	}
+	c.logger.Printf("Restored %d pending server removals", len(removals))
+
+	if err := storePendingRemovals(ctx, c.state, nil); err != nil {
+		c.logger.Printf("Warning: Failed to clear persisted server removals: %v", err)
+	}
+}
+
+func storePendingRemovals(ctx context.Context, store state.Store, removals []persistedRemoval) error {
+	if removals == nil {
+		removals = []persistedRemoval{}
+	}
+	data, err := json.Marshal(removals)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, PendingRemovalsState, data)
+}
+
+func loadPendingRemovals(ctx context.Context, store state.Store) ([]persistedRemoval, error) {
+	data, err := store.Get(ctx, PendingRemovalsState)
+	if errors.Is(err, state.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var removals []persistedRemoval
+	if err := json.Unmarshal(data, &removals); err != nil {
+		return nil, fmt.Errorf("invalid pending removals state: %w", err)
+	}
+	return removals, nil
+}
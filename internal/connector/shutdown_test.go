@@ -0,0 +1,110 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/state"
+)
+
+func TestRemovalTracker_Wait(t *testing.T) {
+	tracker := newRemovalTracker(newKeyedMutex())
+	cancelCh := tracker.schedule("web", "web_1", time.Now())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.finish("web", "web_1", cancelCh)
+	}()
+
+	if !tracker.wait(time.Second) {
+		t.Fatal("Expected the pending removal to complete")
+	}
+
+	tracker.schedule("web", "web_2", time.Now())
+	if tracker.wait(10 * time.Millisecond) {
+		t.Error("Expected wait to time out while a removal is pending")
+	}
+}
+
+func TestPendingRemovalsRestoredOnStart(t *testing.T) {
+	hs := newHandlerState()
+	store := state.NewFileStore(t.TempDir())
+	client := &mockHAProxyClient{}
+	c := &Connector{
+		config:        &config.Config{},
+		haproxyClient: client,
+		state:         store,
+		logger:        log.New(io.Discard, "", 0),
+		handlers:      hs,
+	}
+
+	// The drain period of the removal is still running on shutdown
+	cancelCh := hs.removals.schedule("restored_web", "web_1", time.Now().Add(-time.Second))
+	c.finishPendingRemovals()
+	hs.removals.finish("restored_web", "web_1", cancelCh)
+
+	removals, err := loadPendingRemovals(context.Background(), store)
+	if err != nil {
+		t.Fatalf("loadPendingRemovals() failed: %v", err)
+	}
+	if !containsRemoval(removals, "restored_web", "web_1") {
+		t.Fatalf("Expected the pending removal to be persisted, got %+v", removals)
+	}
+
+	// The next leadership executes it, its drain period passed meanwhile
+	c.startHandlers()
+	c.restorePendingRemovals(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for !client.wasDeleteCalled() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !client.wasDeleteCalled() {
+		t.Error("Expected the restored removal to remove the server")
+	}
+
+	removals, err = loadPendingRemovals(context.Background(), store)
+	if err != nil || len(removals) != 0 {
+		t.Errorf("Expected the persisted removals to be cleared, got %+v (err: %v)", removals, err)
+	}
+}
+
+func TestPendingRemovalsHandedOverOnLeadershipLoss(t *testing.T) {
+	hs := newHandlerState()
+	store := state.NewFileStore(t.TempDir())
+	client := &mockHAProxyClient{}
+	c := &Connector{
+		config:        &config.Config{HAProxy: config.HAProxyConfig{ShutdownTimeoutSec: 30}},
+		haproxyClient: client,
+		state:         store,
+		logger:        log.New(io.Discard, "", 0),
+		handlers:      hs,
+	}
+
+	hs.removals.scheduleRemoval(client, "web", "web_1", time.Now().Add(50*time.Millisecond), nil)
+	started := time.Now()
+	c.handOverPendingRemovals()
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("Expected the removals to be handed over without waiting, took %s", elapsed)
+	}
+
+	removals, err := loadPendingRemovals(context.Background(), store)
+	if err != nil || !containsRemoval(removals, "web", "web_1") {
+		t.Fatalf("Expected the pending removal to be persisted for the new leader, got %+v (err: %v)", removals, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if client.wasDeleteCalled() {
+		t.Error("Expected the former leader not to execute the removal")
+	}
+}
+
+func containsRemoval(removals []persistedRemoval, backendName, serverName string) bool {
+	for _, removal := range removals {
+		if removal.Backend == backendName && removal.Server == serverName {
+			return true
+		}
+	}
+	return false
+}
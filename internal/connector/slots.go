@@ -0,0 +1,161 @@
+package connector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Server slot constants
+const (
+	// Free slots point to a placeholder address and are kept in maintenance
+	SlotPlaceholderAddress = "127.0.0.1"
+	SlotPlaceholderPort    = 1
+
+	MaintenanceEnabled  = "enabled"
+	MaintenanceDisabled = "disabled"
+)
+
+// slotNamePattern matches slot names, generated server names always end in _<address>_<port>
+var slotNamePattern = regexp.MustCompile(`_slot\d+$`)
+
+func slotName(backendName string, index int) string {
+	return fmt.Sprintf("%s_slot%d", backendName, index)
+}
+
+func isSlotServer(serverName string) bool {
+	return slotNamePattern.MatchString(serverName)
+}
+
+func isFreeSlot(server *haproxy.Server) bool {
+	return isSlotServer(server.Name) && server.Maintenance == MaintenanceEnabled
+}
+
+// findSlot returns the slot currently holding the address
+func findSlot(servers []haproxy.Server, address string, port int) (string, bool) {
+	for i := range servers {
+		if isSlotServer(servers[i].Name) && !isFreeSlot(&servers[i]) &&
+			servers[i].Address == address && servers[i].Port == port {
+			return servers[i].Name, true
+		}
+	}
+	return "", false
+}
+
+// slotExpected checks if the address held by a slot belongs to one of the expected servers
+func slotExpected(server *haproxy.Server, expectedServers map[string]bool) bool {
+	suffix := fmt.Sprintf("_%s_%d", strings.ReplaceAll(server.Address, ".", "_"), server.Port)
+	for serverName := range expectedServers {
+		if strings.HasSuffix(serverName, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureServerSlots creates the missing slots of a backend in a single transaction. Slots take the
+// health check settings of the template, so filling them later only changes address, port and
+// maintenance state. Returns the servers of the backend.
+func ensureServerSlots(
+	client haproxy.ClientInterface,
+	backendName string,
+	slots int,
+	template *haproxy.Server,
+) ([]haproxy.Server, error) {
+	servers, err := client.GetServers(backendName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get servers for backend %s: %w", backendName, err)
+	}
+
+	var create []haproxy.Server
+	for i := 1; i <= slots; i++ {
+		name := slotName(backendName, i)
+		if containsServer(servers, name) {
+			continue
+		}
+		slot := *template
+		slot.Name = name
+		slot.Address = SlotPlaceholderAddress
+		slot.Port = SlotPlaceholderPort
+		slot.Maintenance = MaintenanceEnabled
+		create = append(create, slot)
+	}
+	if len(create) == 0 {
+		return servers, nil
+	}
+
+	if err := client.UpdateServers(backendName, nil, create); err != nil {
+		return nil, fmt.Errorf("failed to provision %d server slots in backend %s: %w", len(create), backendName, err)
+	}
+	return append(servers, create...), nil
+}
+
+// fillServerSlot puts the server into a free slot of the backend. Data Plane API applies the
+// address change through the runtime API, so unlike creating a server it doesn't reload HAProxy.
+// Returns the slot and true if it was filled, the slot and false if it already holds the server's
+// address, or an empty slot if none is free.
+func fillServerSlot(
+	client haproxy.ClientInterface,
+	backendName string,
+	server *haproxy.Server,
+	slots int,
+) (string, bool, error) {
+	servers, err := ensureServerSlots(client, backendName, slots, server)
+	if err != nil {
+		return "", false, err
+	}
+
+	if slot, ok := findSlot(servers, server.Address, server.Port); ok {
+		return slot, false, nil
+	}
+
+	for i := range servers {
+		if !isFreeSlot(&servers[i]) {
+			continue
+		}
+		slot := *server
+		slot.Name = servers[i].Name
+		slot.Maintenance = MaintenanceDisabled
+
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return "", false, err
+		}
+		if err := client.ReplaceServer(backendName, &slot, version); err != nil {
+			return "", false, fmt.Errorf("failed to fill slot %s in backend %s: %w", slot.Name, backendName, err)
+		}
+		return slot.Name, true, nil
+	}
+
+	return "", false, nil
+}
+
+// releaseServerSlot moves a slot back to the placeholder address and into maintenance
+func releaseServerSlot(client haproxy.ClientInterface, backendName, serverName string, version int) error {
+	servers, err := client.GetServers(backendName)
+	if err != nil {
+		return fmt.Errorf("failed to get servers for backend %s: %w", backendName, err)
+	}
+
+	for i := range servers {
+		if servers[i].Name != serverName {
+			continue
+		}
+		slot := servers[i]
+		slot.Address = SlotPlaceholderAddress
+		slot.Port = SlotPlaceholderPort
+		slot.Maintenance = MaintenanceEnabled
+		return client.ReplaceServer(backendName, &slot, version)
+	}
+	return nil
+}
+
+// removeServer deletes a server from the backend, slots are released instead
+func removeServer(client haproxy.ClientInterface, backendName, serverName string, version int) error {
+	if isSlotServer(serverName) {
+		return releaseServerSlot(client, backendName, serverName, version)
+	}
+	return client.DeleteServer(backendName, serverName, version)
+}
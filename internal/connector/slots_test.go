@@ -0,0 +1,154 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func newSlotMockClient() *mockHAProxyClient {
+	return &mockHAProxyClient{backendServers: map[string][]haproxy.Server{}}
+}
+
+func TestIsSlotServer(t *testing.T) {
+	tests := map[string]bool{
+		"web_slot1":           true,
+		"my_app_slot12":       true,
+		"web_10_0_0_1_8080":   false,
+		"slot_10_0_0_1_8080":  false,
+		"web_slot_10_0_0_1_1": false,
+	}
+	for name, expected := range tests {
+		if got := isSlotServer(name); got != expected {
+			t.Errorf("isSlotServer(%q) = %v, expected %v", name, got, expected)
+		}
+	}
+}
+
+func TestFillServerSlot(t *testing.T) {
+	client := newSlotMockClient()
+	server := haproxy.Server{Name: "web_10_0_0_1_8080", Address: "10.0.0.1", Port: 8080, Check: CheckEnabled, CheckType: CheckTypeTCP}
+
+	slot, filled, err := fillServerSlot(client, "web", &server, 2)
+	if err != nil {
+		t.Fatalf("fillServerSlot() failed: %v", err)
+	}
+	if slot != "web_slot1" || !filled {
+		t.Fatalf("Expected web_slot1 to be filled, got %q (filled: %v)", slot, filled)
+	}
+
+	servers := client.backendServers["web"]
+	if len(servers) != 2 {
+		t.Fatalf("Expected 2 provisioned slots, got %d", len(servers))
+	}
+	if servers[0].Address != "10.0.0.1" || servers[0].Maintenance != MaintenanceDisabled || servers[0].CheckType != CheckTypeTCP {
+		t.Errorf("Expected web_slot1 to hold the server, got %+v", servers[0])
+	}
+	if !isFreeSlot(&servers[1]) || servers[1].Address != SlotPlaceholderAddress || servers[1].CheckType != CheckTypeTCP {
+		t.Errorf("Expected web_slot2 to be a free slot with the server's checks, got %+v", servers[1])
+	}
+
+	// The same address keeps its slot
+	slot, filled, err = fillServerSlot(client, "web", &server, 2)
+	if err != nil || slot != "web_slot1" || filled {
+		t.Errorf("Expected web_slot1 to already hold the server, got %q (filled: %v, err: %v)", slot, filled, err)
+	}
+
+	other := haproxy.Server{Name: "web_10_0_0_2_8080", Address: "10.0.0.2", Port: 8080}
+	if slot, _, _ = fillServerSlot(client, "web", &other, 2); slot != "web_slot2" {
+		t.Errorf("Expected web_slot2 to be filled, got %q", slot)
+	}
+
+	third := haproxy.Server{Name: "web_10_0_0_3_8080", Address: "10.0.0.3", Port: 8080}
+	if slot, _, _ = fillServerSlot(client, "web", &third, 2); slot != "" {
+		t.Errorf("Expected no free slot, got %q", slot)
+	}
+}
+
+func TestRegistrationFillsSlot(t *testing.T) {
+	hs := newHandlerState()
+	client := newSlotMockClient()
+	event := &ServiceEvent{
+		Type:    EventTypeServiceRegistration,
+		Service: Service{ServiceName: "web", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+	}
+	haproxyCfg := &config.HAProxyConfig{ServerSlots: 1}
+	logger := log.New(io.Discard, "", 0)
+
+	result, err := hs.handleServiceRegistrationWithHealthCheck(context.Background(), client, nil, event, logger, haproxyCfg)
+	if err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+	resultMap := result.(map[string]string)
+	if resultMap["status"] != StatusCreated || resultMap["slot"] != "web_slot1" {
+		t.Errorf("Expected the server to be created in web_slot1, got %v", resultMap)
+	}
+
+	// A second instance doesn't find a free slot and is added as a server
+	event.Service.Address = "10.0.0.2"
+	result, err = hs.handleServiceRegistrationWithHealthCheck(context.Background(), client, nil, event, logger, haproxyCfg)
+	if err != nil {
+		t.Fatalf("Registration failed: %v", err)
+	}
+	if slot, ok := result.(map[string]string)["slot"]; ok {
+		t.Errorf("Expected no slot without a free one, got %s", slot)
+	}
+}
+
+func TestDeregistrationReleasesSlot(t *testing.T) {
+	hs := newHandlerState()
+	client := newSlotMockClient()
+	client.drainError = errors.New("drain failed")
+	client.backendServers["web"] = []haproxy.Server{
+		{Name: "web_slot1", Address: "10.0.0.1", Port: 8080, Maintenance: MaintenanceDisabled},
+		{Name: "web_slot2", Address: SlotPlaceholderAddress, Port: SlotPlaceholderPort, Maintenance: MaintenanceEnabled},
+	}
+	event := &ServiceEvent{
+		Type:    EventTypeServiceDeregistration,
+		Service: Service{ServiceName: "web", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+	}
+
+	result, err := hs.handleServiceDeregistrationWithDrainTimeout(context.Background(), client, event, &config.Config{}, 0, nil)
+	if err != nil {
+		t.Fatalf("Deregistration failed: %v", err)
+	}
+	if slot := result.(map[string]string)["slot"]; slot != "web_slot1" {
+		t.Errorf("Expected the server to be found in web_slot1, got %q", slot)
+	}
+	if client.deleteCalled {
+		t.Error("Expected the slot to be released instead of deleted")
+	}
+	if !isFreeSlot(&client.backendServers["web"][0]) || client.backendServers["web"][0].Address != SlotPlaceholderAddress {
+		t.Errorf("Expected web_slot1 to be free again, got %+v", client.backendServers["web"][0])
+	}
+}
+
+func TestCleanupKeepsSlots(t *testing.T) {
+	hs := newHandlerState()
+	client := newSlotMockClient()
+	client.backendServers["web"] = []haproxy.Server{
+		{Name: "web_slot1", Address: "10.0.0.1", Port: 8080, Maintenance: MaintenanceDisabled},
+		{Name: "web_slot2", Address: "10.0.0.9", Port: 8080, Maintenance: MaintenanceDisabled},
+		{Name: "web_slot3", Address: SlotPlaceholderAddress, Port: SlotPlaceholderPort, Maintenance: MaintenanceEnabled},
+	}
+	expected := map[string]map[string]bool{"web": {"web_10_0_0_1_8080": true}}
+
+	removed, err := hs.cleanupStaleServersFromBackends(client, expected, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if removed != 1 || client.deleteCalled {
+		t.Errorf("Expected one slot to be released, got %d removed (deleted: %v)", removed, client.deleteCalled)
+	}
+	if client.backendServers["web"][0].Maintenance != MaintenanceDisabled {
+		t.Error("Expected the slot of an expected server to be kept")
+	}
+	if !isFreeSlot(&client.backendServers["web"][1]) {
+		t.Error("Expected the slot of a stale server to be released")
+	}
+}
@@ -0,0 +1,172 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// discoverySources adds services of further sources, e.g. the containers of a Docker host, to those
+// of the primary discovery client. Sync, cleanup and the admin API see all of them, so the servers
+// of one source aren't removed as stale by the others. Services outside the managed_services scope
+// are left out, so they are neither registered nor cleaned up.
+type discoverySources struct {
+	nomad.NomadClient // primary, Nomad or the Consul catalog
+	extra             []nomad.NomadClient
+	scope             *config.ManagedServicesConfig // nil manages all services
+}
+
+// GetServices gets the services of all sources. A failing source fails the listing, its servers
+// would otherwise be removed as stale.
+func (s *discoverySources) GetServices() ([]*nomad.Service, error) {
+	services, err := s.allServices()
+	if err != nil || s.scope == nil {
+		return services, err
+	}
+
+	scoped := services[:0]
+	for _, svc := range services {
+		if s.manages(svc) {
+			scoped = append(scoped, svc)
+		}
+	}
+	return scoped, nil
+}
+
+// outOfScope gets the services of all sources outside the managed_services scope, whose backends
+// and domain rules the connector must leave alone
+func (s *discoverySources) outOfScope() ([]*nomad.Service, error) {
+	if s.scope == nil {
+		return nil, nil
+	}
+	services, err := s.allServices()
+	if err != nil {
+		return nil, err
+	}
+	var foreign []*nomad.Service
+	for _, svc := range services {
+		if !s.manages(svc) {
+			foreign = append(foreign, svc)
+		}
+	}
+	return foreign, nil
+}
+
+// allServices gets the services of all sources regardless of the scope
+func (s *discoverySources) allServices() ([]*nomad.Service, error) {
+	services, err := s.NomadClient.GetServices()
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range s.extra {
+		extra, err := source.GetServices()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list services of additional source: %w", err)
+		}
+		services = append(services, extra...)
+	}
+	return services, nil
+}
+
+// manages checks if the service is in the managed_services scope
+func (s *discoverySources) manages(svc *nomad.Service) bool {
+	return s.scope == nil || s.scope.Manages(svc.ServiceName, svc.JobID, svc.Namespace)
+}
+
+// StreamServiceEvents streams the events of all sources into eventChan while the stream of the
+// primary source runs, and returns its result
+func (s *discoverySources) StreamServiceEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	if s.scope != nil {
+		scoped := make(chan nomad.ServiceEvent, EventChannelBuffer)
+		wg.Add(1)
+		go func(out chan<- nomad.ServiceEvent) {
+			defer wg.Done()
+			s.forwardInScope(streamCtx, scoped, out)
+		}(eventChan)
+		eventChan = scoped
+	}
+	for _, source := range s.extra {
+		wg.Add(1)
+		go func(source nomad.NomadClient) {
+			defer wg.Done()
+			_ = source.StreamServiceEvents(streamCtx, eventChan)
+		}(source)
+	}
+
+	err := s.NomadClient.StreamServiceEvents(streamCtx, eventChan)
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// forwardInScope forwards the events of services in the managed_services scope until ctx is
+// canceled. Node events concern all services and are forwarded as they are.
+func (s *discoverySources) forwardInScope(ctx context.Context, in <-chan nomad.ServiceEvent, out chan<- nomad.ServiceEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-in:
+			if event.Payload.Service != nil && !s.manages(event.Payload.Service) {
+				continue
+			}
+			select {
+			case out <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// GetServiceCheckFromJob returns the check of the first source knowing the service, e.g. the further
+// Nomad cluster running its job
+func (s *discoverySources) GetServiceCheckFromJob(jobID, serviceName string) (*nomad.ServiceCheck, error) {
+	check, err := s.NomadClient.GetServiceCheckFromJob(jobID, serviceName)
+	if check != nil {
+		return check, nil
+	}
+	for _, source := range s.extra {
+		if extra, extraErr := source.GetServiceCheckFromJob(jobID, serviceName); extra != nil && extraErr == nil {
+			return extra, nil
+		}
+	}
+	return nil, err
+}
+
+// AllocationHealthy asks the primary source and then the further Nomad clusters for the health of
+// an allocation, the first one knowing the allocation answers
+func (s *discoverySources) AllocationHealthy(allocID, serviceName string) (bool, error) {
+	var firstErr error
+	for _, source := range append([]nomad.NomadClient{s.NomadClient}, s.extra...) {
+		checker, ok := source.(allocationHealthChecker)
+		if !ok {
+			continue
+		}
+		healthy, err := checker.AllocationHealthy(allocID, serviceName)
+		if err == nil {
+			return healthy, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("no discovery source knows allocation %s", allocID)
+	}
+	return false, firstErr
+}
+
+// primaryDiscovery returns the primary discovery client, whose optional capabilities (token
+// rotation, allocation health, stream activity) the connector uses
+func primaryDiscovery(client nomad.NomadClient) nomad.NomadClient {
+	if sources, ok := client.(*discoverySources); ok {
+		return sources.NomadClient
+	}
+	return client
+}
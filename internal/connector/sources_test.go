@@ -0,0 +1,147 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// emittingSource sends one event and streams until canceled
+type emittingSource struct {
+	fakeNomadClient
+	event    nomad.ServiceEvent
+	err      error
+	canceled chan struct{}
+}
+
+func (s *emittingSource) StreamServiceEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	eventChan <- s.event
+	<-ctx.Done()
+	close(s.canceled)
+	return nil
+}
+
+func (s *emittingSource) GetServices() ([]*nomad.Service, error) {
+	return s.services, s.err
+}
+
+func TestDiscoverySourcesGetServices(t *testing.T) {
+	extra := &emittingSource{fakeNomadClient: fakeNomadClient{services: []*nomad.Service{{ServiceName: "blog"}}}}
+	sources := &discoverySources{
+		NomadClient: &fakeNomadClient{services: []*nomad.Service{{ServiceName: "web"}}},
+		extra:       []nomad.NomadClient{extra},
+	}
+
+	services, err := sources.GetServices()
+	if err != nil {
+		t.Fatalf("GetServices() failed: %v", err)
+	}
+	if len(services) != 2 || services[0].ServiceName != "web" || services[1].ServiceName != "blog" {
+		t.Errorf("Expected the services of both sources, got %v", services)
+	}
+
+	extra.err = errors.New("docker unreachable")
+	if _, err := sources.GetServices(); err == nil {
+		t.Error("Expected a failing source to fail the listing, its servers would be removed as stale")
+	}
+}
+
+// endingSource ends its stream right away
+type endingSource struct {
+	fakeNomadClient
+}
+
+func (s *endingSource) StreamServiceEvents(context.Context, chan<- nomad.ServiceEvent) error {
+	return errors.New("stream ended")
+}
+
+func TestDiscoverySourcesStreamServiceEvents(t *testing.T) {
+	extra := &emittingSource{
+		event:    nomad.ServiceEvent{Type: EventTypeServiceRegistration, Payload: nomad.Payload{Service: &nomad.Service{ServiceName: "blog"}}},
+		canceled: make(chan struct{}),
+	}
+	sources := &discoverySources{NomadClient: &endingSource{}, extra: []nomad.NomadClient{extra}}
+
+	events := make(chan nomad.ServiceEvent, 1)
+	if err := sources.StreamServiceEvents(context.Background(), events); err == nil || err.Error() != "stream ended" {
+		t.Errorf("Expected the result of the primary stream, got %v", err)
+	}
+	select {
+	case <-extra.canceled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the additional streams to end with the primary one")
+	}
+	if event := <-events; event.Payload.Service.ServiceName != "blog" {
+		t.Errorf("Expected the event of the additional source, got %v", event)
+	}
+}
+
+func TestPrimaryDiscovery(t *testing.T) {
+	primary := &fakeNomadClient{}
+	if primaryDiscovery(&discoverySources{NomadClient: primary}) != primary {
+		t.Error("Expected the primary client of combined sources")
+	}
+	if primaryDiscovery(primary) != primary {
+		t.Error("Expected a single client to be returned as is")
+	}
+}
+
+func TestDiscoverySourcesManagedServicesScope(t *testing.T) {
+	scope := &config.ManagedServicesConfig{
+		Allow: []string{"namespace:team-a", "job:legacy-*"},
+		Deny:  []string{"*-debug"},
+	}
+	sources := &discoverySources{
+		NomadClient: &fakeNomadClient{services: []*nomad.Service{
+			{ServiceName: "web", Namespace: "team-a"},
+			{ServiceName: "web-debug", Namespace: "team-a"},
+			{ServiceName: "shop", Namespace: "team-b"},
+			{ServiceName: "crm", Namespace: "team-b", JobID: "legacy-crm"},
+		}},
+		scope: scope,
+	}
+
+	services, err := sources.GetServices()
+	if err != nil {
+		t.Fatalf("GetServices() failed: %v", err)
+	}
+	if len(services) != 2 || services[0].ServiceName != "web" || services[1].ServiceName != "crm" {
+		t.Errorf("Expected only the services in scope, got %v", services)
+	}
+
+	denied := &emittingSource{
+		event:    nomad.ServiceEvent{Type: EventTypeServiceRegistration, Payload: nomad.Payload{Service: &nomad.Service{ServiceName: "shop", Namespace: "team-b"}}},
+		canceled: make(chan struct{}),
+	}
+	allowed := &emittingSource{
+		event:    nomad.ServiceEvent{Type: EventTypeServiceRegistration, Payload: nomad.Payload{Service: &nomad.Service{ServiceName: "web", Namespace: "team-a"}}},
+		canceled: make(chan struct{}),
+	}
+	sources = &discoverySources{NomadClient: denied, extra: []nomad.NomadClient{allowed}, scope: scope}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan nomad.ServiceEvent, 2)
+	done := make(chan struct{})
+	go func() {
+		_ = sources.StreamServiceEvents(ctx, events)
+		close(done)
+	}()
+
+	select {
+	case event := <-events:
+		if event.Payload.Service.ServiceName != "web" {
+			t.Errorf("Expected only the event of the service in scope, got %v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the event of the service in scope")
+	}
+	cancel()
+	<-done
+	if len(events) != 0 {
+		t.Errorf("Expected the event of the service out of scope to be dropped, got %v", <-events)
+	}
+}
@@ -0,0 +1,132 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// staticServiceIDPrefix starts the IDs of the services defined in the config file
+const staticServiceIDPrefix = "static:"
+
+// configuredServices is the discovery source of the static services defined in the config file. A
+// reload that changes them reports the added, changed and removed instances as events.
+type configuredServices struct {
+	mu       sync.Mutex
+	services map[string]*nomad.Service // by ID
+	// stream receives the events of reloads while the event stream runs (nil = not streaming)
+	stream    chan<- nomad.ServiceEvent
+	streamCtx context.Context
+}
+
+var _ nomad.NomadClient = (*configuredServices)(nil)
+
+func newConfiguredServices(services []config.StaticServiceConfig) *configuredServices {
+	return &configuredServices{services: staticServices(services)}
+}
+
+// staticServices converts the static services of the config file into Nomad services, by ID
+func staticServices(services []config.StaticServiceConfig) map[string]*nomad.Service {
+	converted := make(map[string]*nomad.Service, len(services))
+	for i := range services {
+		svc := &services[i]
+		tags := append([]string(nil), svc.Tags...)
+		if !hasTag(tags, "haproxy.enable=true") {
+			tags = append([]string{"haproxy.enable=true"}, tags...)
+		}
+		id := fmt.Sprintf("%s%s/%s:%d", staticServiceIDPrefix, svc.Name, svc.Address, svc.Port)
+		converted[id] = &nomad.Service{
+			ID:          id,
+			ServiceName: svc.Name,
+			Tags:        tags,
+			Address:     svc.Address,
+			Port:        svc.Port,
+		}
+	}
+	return converted
+}
+
+// GetServices returns the static services, in a stable order
+func (s *configuredServices) GetServices() ([]*nomad.Service, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	services := make([]*nomad.Service, 0, len(s.services))
+	for _, id := range sortedServiceIDs(s.services) {
+		services = append(services, s.services[id])
+	}
+	return services, nil
+}
+
+// GetServiceCheckFromJob returns no check, static services configure their checks with haproxy.check.* tags
+func (s *configuredServices) GetServiceCheckFromJob(_, _ string) (*nomad.ServiceCheck, error) {
+	return nil, nil
+}
+
+// StreamServiceEvents passes the events of reloads to eventChan until ctx is done
+func (s *configuredServices) StreamServiceEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	s.mu.Lock()
+	s.stream, s.streamCtx = eventChan, ctx
+	s.mu.Unlock()
+
+	<-ctx.Done()
+
+	s.mu.Lock()
+	if s.streamCtx == ctx {
+		s.stream, s.streamCtx = nil, nil
+	}
+	s.mu.Unlock()
+	return ctx.Err()
+}
+
+// update replaces the static services and reports the differences: deregistrations of removed
+// instances, registrations of added ones and of those whose tags changed. Without running event
+// stream (e.g. on a standby) only the services are replaced, the next sync applies them.
+func (s *configuredServices) update(services []config.StaticServiceConfig) {
+	updated := staticServices(services)
+
+	s.mu.Lock()
+	var events []nomad.ServiceEvent
+	for _, id := range sortedServiceIDs(s.services) {
+		if _, ok := updated[id]; !ok {
+			events = append(events, staticServiceEvent(EventTypeServiceDeregistration, s.services[id]))
+		}
+	}
+	for _, id := range sortedServiceIDs(updated) {
+		if previous, ok := s.services[id]; !ok || !slices.Equal(previous.Tags, updated[id].Tags) {
+			events = append(events, staticServiceEvent(EventTypeServiceRegistration, updated[id]))
+		}
+	}
+	s.services = updated
+	stream, ctx := s.stream, s.streamCtx
+	s.mu.Unlock()
+
+	if stream == nil {
+		return
+	}
+	for _, event := range events {
+		select {
+		case stream <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func staticServiceEvent(eventType string, svc *nomad.Service) nomad.ServiceEvent {
+	return nomad.ServiceEvent{Type: eventType, Topic: "Service", Payload: nomad.Payload{Service: svc}}
+}
+
+func sortedServiceIDs(services map[string]*nomad.Service) []string {
+	ids := make([]string, 0, len(services))
+	for id := range services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
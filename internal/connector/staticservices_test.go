@@ -0,0 +1,116 @@
+package connector
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func TestConfiguredServicesGetServices(t *testing.T) {
+	source := newConfiguredServices([]config.StaticServiceConfig{
+		{Name: "legacy", Address: "10.0.0.2", Port: 8080, Tags: []string{"haproxy.domain=legacy.example.com"}},
+		{Name: "legacy", Address: "10.0.0.1", Port: 8080, Tags: []string{"haproxy.enable=true"}},
+	})
+
+	services, err := source.GetServices()
+	if err != nil {
+		t.Fatalf("GetServices() failed: %v", err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("Expected 2 services, got %d", len(services))
+	}
+	if services[0].ID != "static:legacy/10.0.0.1:8080" || services[0].Address != "10.0.0.1" {
+		t.Errorf("Expected the instances ordered by ID, got %+v", services[0])
+	}
+	if !hasTag(services[1].Tags, "haproxy.enable=true") || !hasTag(services[1].Tags, "haproxy.domain=legacy.example.com") {
+		t.Errorf("Expected haproxy.enable=true to be implied, got %v", services[1].Tags)
+	}
+	if len(services[0].Tags) != 1 {
+		t.Errorf("Expected haproxy.enable=true not to be added twice, got %v", services[0].Tags)
+	}
+}
+
+func TestConfiguredServicesUpdate(t *testing.T) {
+	source := newConfiguredServices([]config.StaticServiceConfig{
+		{Name: "legacy", Address: "10.0.0.1", Port: 8080},
+		{Name: "legacy", Address: "10.0.0.2", Port: 8080},
+		{Name: "intranet", Address: "10.0.0.9", Port: 80},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan nomad.ServiceEvent, 10)
+	go func() { _ = source.StreamServiceEvents(ctx, events) }()
+	waitForStream(t, source)
+
+	source.update([]config.StaticServiceConfig{
+		{Name: "legacy", Address: "10.0.0.1", Port: 8080},
+		{Name: "legacy", Address: "10.0.0.3", Port: 8080},
+		{Name: "intranet", Address: "10.0.0.9", Port: 80, Tags: []string{"haproxy.domain=intranet.example.com"}},
+	})
+
+	expected := []string{
+		"ServiceDeregistration 10.0.0.2",
+		"ServiceRegistration 10.0.0.9",
+		"ServiceRegistration 10.0.0.3",
+	}
+	for _, want := range expected {
+		select {
+		case event := <-events:
+			if got := event.Type + " " + event.Payload.Service.Address; got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s", want)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected unchanged instances not to be reported, got %v", <-events)
+	}
+}
+
+func TestConfiguredServicesUpdateWithoutStream(t *testing.T) {
+	source := newConfiguredServices(nil)
+	source.update([]config.StaticServiceConfig{{Name: "legacy", Address: "10.0.0.1", Port: 8080}})
+
+	services, _ := source.GetServices()
+	if len(services) != 1 {
+		t.Errorf("Expected the services to be replaced for the next sync, got %v", services)
+	}
+}
+
+func TestReloadUpdatesStaticServices(t *testing.T) {
+	current := validConfig()
+	c := &Connector{config: current, logger: log.New(io.Discard, "", 0), staticServices: newConfiguredServices(nil)}
+
+	reloaded := *current
+	reloaded.StaticServices = []config.StaticServiceConfig{{Name: "legacy", Address: "10.0.0.1", Port: 8080}}
+	if err := c.Reload(&reloaded); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+
+	services, _ := c.staticServices.GetServices()
+	if len(services) != 1 || len(c.cfg().StaticServices) != 1 {
+		t.Errorf("Expected the static services to be reloaded, got %v", services)
+	}
+}
+
+func waitForStream(t *testing.T, source *configuredServices) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		source.mu.Lock()
+		streaming := source.stream != nil
+		source.mu.Unlock()
+		if streaming {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("Expected the event stream to start")
+}
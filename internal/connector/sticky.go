@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+// Sticky session constants
+const (
+	StickyTag          = "haproxy.sticky="
+	StickyModeCookie   = "cookie"
+	StickyModeSource   = "source"
+	StickyCookieName   = "SERVERID"
+	StickyCookieInsert = "insert"
+	StickTableTypeIP   = "ip"
+	StickTableSize     = 100000
+	StickTableExpireMs = 30 * 60 * 1000
+	StickRuleTypeOn    = "on"
+	StickPatternSource = "src"
+)
+
+// parseStickyMode returns the session persistence requested by the haproxy.sticky tag, or ""
+func parseStickyMode(tags []string) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, StickyTag) {
+			return strings.TrimPrefix(tag, StickyTag)
+		}
+	}
+	return ""
+}
+
+// applyStickyMode configures session persistence on the desired backend:
+// haproxy.sticky=cookie inserts a dynamic server cookie (http mode only),
+// haproxy.sticky=source adds an IP stick table used by a "stick on src" rule
+func applyStickyMode(backend *haproxy.Backend, tags []string) {
+	switch parseStickyMode(tags) {
+	case StickyModeCookie:
+		if backend.Mode == ModeTCP {
+			return
+		}
+		backend.Cookie = &haproxy.Cookie{
+			Name:     StickyCookieName,
+			Type:     StickyCookieInsert,
+			Indirect: true,
+			Nocache:  true,
+			Dynamic:  true,
+		}
+		backend.DynamicCookieKey = backend.Name
+	case StickyModeSource:
+		backend.StickTable = &haproxy.StickTable{
+			Type:   StickTableTypeIP,
+			Size:   StickTableSize,
+			Expire: StickTableExpireMs,
+		}
+	}
+}
+
+// stickyMatches checks if the session persistence of the existing backend matches the desired one
+func stickyMatches(existing, desired *haproxy.Backend) bool {
+	if (existing.Cookie == nil) != (desired.Cookie == nil) || (existing.StickTable == nil) != (desired.StickTable == nil) {
+		return false
+	}
+	if desired.Cookie != nil && (existing.Cookie.Name != desired.Cookie.Name || !existing.Cookie.Dynamic) {
+		return false
+	}
+	if desired.StickTable != nil && existing.StickTable.Type != desired.StickTable.Type {
+		return false
+	}
+	return true
+}
+
+// findSourceStickRule returns the index of the connector-managed "stick on src" rule, or -1
+func findSourceStickRule(rules []haproxy.StickRule) int {
+	for i := range rules {
+		if rules[i].Type == StickRuleTypeOn && rules[i].Pattern == StickPatternSource && rules[i].CondTest == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// reconcileStickRule installs the "stick on src" rule for haproxy.sticky=source and removes it otherwise.
+// The rule must be removed before the stick table it refers to.
+func reconcileStickRule(client haproxy.ClientInterface, backendName string, wanted bool, result map[string]string) error {
+	rules, err := client.GetStickRules(backendName)
+	if err != nil {
+		return fmt.Errorf("failed to get stick rules of backend %s: %w", backendName, err)
+	}
+
+	index := findSourceStickRule(rules)
+	if (index >= 0) == wanted {
+		return nil
+	}
+
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get config version for stick rule: %w", err)
+	}
+	if wanted {
+		rule := &haproxy.StickRule{Type: StickRuleTypeOn, Pattern: StickPatternSource}
+		if err := client.CreateStickRule(backendName, len(rules), rule, version); err != nil {
+			return fmt.Errorf("failed to create stick rule for backend %s: %w", backendName, err)
+		}
+		result["sticky"] = StickyModeSource
+		return nil
+	}
+
+	if err := client.DeleteStickRule(backendName, index, version); err != nil {
+		return fmt.Errorf("failed to delete stick rule of backend %s: %w", backendName, err)
+	}
+	result["sticky_removed"] = StickyModeSource
+	return nil
+}
@@ -0,0 +1,84 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestBuildDesiredBackendStickyMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		tags       []string
+		cookie     bool
+		stickTable bool
+	}{
+		{name: "no sticky tag", tags: []string{"haproxy.enable=true"}},
+		{name: "cookie", tags: []string{"haproxy.sticky=cookie"}, cookie: true},
+		{name: "source", tags: []string{"haproxy.sticky=source"}, stickTable: true},
+		{name: "cookie ignored in tcp mode", tags: []string{"haproxy.mode=tcp", "haproxy.sticky=cookie"}},
+		{name: "unknown mode", tags: []string{"haproxy.sticky=header"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := buildDesiredBackend("shop", nil, tt.tags)
+			if (backend.Cookie != nil) != tt.cookie {
+				t.Errorf("Cookie = %+v, expected cookie: %v", backend.Cookie, tt.cookie)
+			}
+			if tt.cookie && (!backend.Cookie.Dynamic || backend.DynamicCookieKey == "") {
+				t.Errorf("Expected dynamic server cookies, got %+v (key %q)", backend.Cookie, backend.DynamicCookieKey)
+			}
+			if (backend.StickTable != nil) != tt.stickTable {
+				t.Errorf("StickTable = %+v, expected stick table: %v", backend.StickTable, tt.stickTable)
+			}
+		})
+	}
+}
+
+func TestBackendConfigMatchesStickyMode(t *testing.T) {
+	plain := buildDesiredBackend("shop", nil, nil)
+	cookie := buildDesiredBackend("shop", nil, []string{"haproxy.sticky=cookie"})
+	source := buildDesiredBackend("shop", nil, []string{"haproxy.sticky=source"})
+
+	if !backendConfigMatches(cookie, cookie, nil, nil) {
+		t.Error("Expected identical sticky backends to match")
+	}
+	if backendConfigMatches(plain, cookie, nil, nil) {
+		t.Error("Expected adding cookie persistence to require an update")
+	}
+	if backendConfigMatches(source, plain, nil, nil) {
+		t.Error("Expected removing the stick table to require an update")
+	}
+	if backendConfigMatches(cookie, source, nil, nil) {
+		t.Error("Expected switching from cookie to source to require an update")
+	}
+}
+
+func TestReconcileStickRule(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	result := map[string]string{}
+
+	if err := reconcileStickRule(mock, "shop", true, result); err != nil {
+		t.Fatalf("reconcileStickRule() failed: %v", err)
+	}
+	if err := reconcileStickRule(mock, "shop", true, result); err != nil {
+		t.Fatalf("reconcileStickRule() failed: %v", err)
+	}
+	if len(mock.stickRules["shop"]) != 1 || mock.stickRules["shop"][0] != (haproxy.StickRule{Type: "on", Pattern: "src"}) {
+		t.Fatalf("Expected a single stick on src rule, got %+v", mock.stickRules["shop"])
+	}
+	if result["sticky"] != StickyModeSource {
+		t.Errorf("Expected sticky result, got %v", result)
+	}
+
+	if err := reconcileStickRule(mock, "shop", false, result); err != nil {
+		t.Fatalf("reconcileStickRule() failed: %v", err)
+	}
+	if len(mock.stickRules["shop"]) != 0 {
+		t.Errorf("Expected stick rule to be removed, got %+v", mock.stickRules["shop"])
+	}
+	if result["sticky_removed"] != StickyModeSource {
+		t.Errorf("Expected sticky_removed result, got %v", result)
+	}
+}
@@ -0,0 +1,95 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// streamMonitor is implemented by Nomad clients that report when their event stream last received data
+type streamMonitor interface {
+	LastActivity() time.Time
+}
+
+// onStreamStatus records the state of the Nomad event stream. A stream that connects again after
+// a failure may have missed events, so it requests a resync.
+func (c *Connector) onStreamStatus(err error) {
+	c.conditions.setStream(err)
+	if errors.Is(err, nomad.ErrUnauthorized) {
+		c.logger.Printf("Error: Nomad authentication failed, check the ACL token: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if errors.Is(err, nomad.ErrUnauthorized) {
+		c.authFailures++
+	}
+	if err != nil {
+		if !c.streamDown {
+			c.streamFailures++
+		}
+		c.streamDown = true
+		return
+	}
+	if c.streamDown {
+		c.streamDown = false
+		select {
+		case c.resyncRequests <- struct{}{}:
+		default: // a resync is already pending
+		}
+	}
+}
+
+// runEventStream streams Nomad events until ctx is canceled, restarting the stream if it ends
+func (c *Connector) runEventStream(ctx context.Context, eventChan chan<- nomad.ServiceEvent) {
+	for {
+		err := c.nomadClient.StreamServiceEvents(ctx, eventChan)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("event stream ended")
+		}
+		c.logger.Printf("Warning: Event stream ended, restarting: %v", err)
+		c.onStreamStatus(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(nomad.StreamReconnectDelaySec * time.Second):
+		}
+	}
+}
+
+// resyncAfterStreamFailure syncs all services again, since events may have been lost while the
+// event stream was down. It is skipped while a resync requested on the admin API runs.
+func (c *Connector) resyncAfterStreamFailure(ctx context.Context) {
+	if !c.resyncMu.TryLock() {
+		return
+	}
+	defer c.resyncMu.Unlock()
+
+	c.logger.Println("Event stream reconnected, resyncing services to catch up on missed events")
+	if _, _, err := SyncAndCleanupStaleServers(c.handlerContext(ctx), c.haproxyClient, c.nomadClient, c.logger, c.cfg()); err != nil {
+		c.logger.Printf("Warning: Resync after event stream failure failed: %v", err)
+	}
+
+	c.mu.Lock()
+	c.streamResyncs++
+	c.mu.Unlock()
+}
+
+// streamActivityAge returns how long ago the event stream last received data, 0 if unknown
+func (c *Connector) streamActivityAge() time.Duration {
+	monitor, ok := primaryDiscovery(c.nomadClient).(streamMonitor)
+	if !ok {
+		return 0
+	}
+	lastActivity := monitor.LastActivity()
+	if lastActivity.IsZero() {
+		return 0
+	}
+	return time.Since(lastActivity)
+}
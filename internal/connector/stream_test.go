@@ -0,0 +1,73 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func TestOnStreamStatusRequestsResyncAfterFailure(t *testing.T) {
+	c := &Connector{conditions: newConditionSet(), resyncRequests: make(chan struct{}, 1)}
+
+	// The first connect is covered by the initial sync
+	c.onStreamStatus(nil)
+	if len(c.resyncRequests) != 0 {
+		t.Fatal("Expected no resync on the first connect")
+	}
+
+	c.onStreamStatus(errors.New("event stream stalled"))
+	c.onStreamStatus(errors.New("connection refused"))
+	if condition := c.conditions.get(ConditionNomadStreamHealthy); condition.Status != ConditionFalse {
+		t.Errorf("Expected the stream condition to be False, got %+v", condition)
+	}
+	if c.streamFailures != 1 {
+		t.Errorf("Expected one failure until the stream is back, got %d", c.streamFailures)
+	}
+
+	c.onStreamStatus(nil)
+	if len(c.resyncRequests) != 1 {
+		t.Fatal("Expected a resync to be requested on reconnect")
+	}
+	if condition := c.conditions.get(ConditionNomadStreamHealthy); condition.Status != ConditionTrue {
+		t.Errorf("Expected the stream condition to be True, got %+v", condition)
+	}
+}
+
+func TestResyncAfterStreamFailure(t *testing.T) {
+	c := &Connector{
+		config:        testConfig(),
+		haproxyClient: &mockHAProxyClient{},
+		nomadClient:   &fakeNomadClient{},
+		logger:        log.New(io.Discard, "", 0),
+	}
+
+	// Skipped while a resync requested on the admin API runs
+	c.resyncMu.Lock()
+	c.resyncAfterStreamFailure(context.Background())
+	c.resyncMu.Unlock()
+	if c.streamResyncs != 0 {
+		t.Fatalf("Expected the resync to be skipped, got %d", c.streamResyncs)
+	}
+
+	c.resyncAfterStreamFailure(context.Background())
+	if c.streamResyncs != 1 {
+		t.Errorf("Expected one resync, got %d", c.streamResyncs)
+	}
+}
+
+func TestOnStreamStatusCountsAuthFailures(t *testing.T) {
+	c := &Connector{conditions: newConditionSet(), resyncRequests: make(chan struct{}, 1), logger: log.New(io.Discard, "", 0)}
+
+	unauthorized := fmt.Errorf("%w: event stream returned status 403", nomad.ErrUnauthorized)
+	c.onStreamStatus(unauthorized)
+	c.onStreamStatus(unauthorized)
+	c.onStreamStatus(errors.New("connection refused"))
+	if c.authFailures != 2 || c.streamFailures != 1 {
+		t.Errorf("Expected 2 auth failures within 1 stream failure, got %d and %d", c.authFailures, c.streamFailures)
+	}
+}
@@ -0,0 +1,137 @@
+package connector
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// SyncReport summarizes a sync run over existing Nomad services
+type SyncReport struct {
+	Total     int           // services returned by Nomad
+	Processed int           // services handled before the sync finished or timed out
+	Synced    int           // services that resulted in a newly created server
+	Failed    int           // services that failed to sync
+	TimedOut  bool          // the sync stopped early because its deadline was exceeded
+	Duration  time.Duration // wall time spent syncing services
+}
+
+// syncServices runs process for every service until all are done or ctx expires,
+// logging progress every progressInterval services
+func syncServices(
+	ctx context.Context,
+	services []*nomad.Service,
+	progressInterval int,
+	logger *log.Logger,
+	process func(svc *nomad.Service) (interface{}, error),
+) SyncReport {
+	report := SyncReport{Total: len(services)}
+	start := time.Now()
+
+	for _, svc := range services {
+		if ctx.Err() != nil {
+			report.TimedOut = true
+			break
+		}
+
+		if result, err := process(svc); err != nil {
+			report.Failed++
+			logger.Printf("Failed to sync service %s: %v", svc.ServiceName, err)
+		} else if resultMap, ok := result.(map[string]string); ok && resultMap["status"] == StatusCreated {
+			report.Synced++
+		}
+		report.Processed++
+
+		if progressInterval > 0 && report.Processed%progressInterval == 0 && report.Processed < report.Total {
+			logger.Printf("Sync progress: %d/%d services processed (%d synced, %d failed) after %s",
+				report.Processed, report.Total, report.Synced, report.Failed, time.Since(start).Round(time.Millisecond))
+		}
+	}
+
+	report.Duration = time.Since(start)
+	return report
+}
+
+// registrationEvent wraps an existing service into a registration event for syncing
+func registrationEvent(svc *nomad.Service) nomad.ServiceEvent {
+	return nomad.ServiceEvent{
+		Type:  "ServiceRegistration",
+		Topic: "Service",
+		Payload: nomad.Payload{
+			Service: svc,
+		},
+	}
+}
+
+// DependsOnTag declares services that must be synced before this one, e.g. fallback targets
+const DependsOnTag = "haproxy.depends_on="
+
+// serviceDependencies returns the services a service depends on from its haproxy.depends_on
+// tags and the configured dependencies
+func serviceDependencies(svc *nomad.Service, configured map[string][]string) []string {
+	dependencies := append([]string{}, configured[svc.ServiceName]...)
+	for _, tag := range serviceTags(svc.Tags, svc.Meta) {
+		if !strings.HasPrefix(tag, DependsOnTag) {
+			continue
+		}
+		for _, name := range strings.Split(strings.TrimPrefix(tag, DependsOnTag), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				dependencies = append(dependencies, name)
+			}
+		}
+	}
+	return dependencies
+}
+
+// orderServicesByDependencies orders services so that every service comes after the services it
+// depends on, keeping the original order otherwise. Dependency cycles are logged and broken;
+// dependencies on services that are not registered are ignored.
+func orderServicesByDependencies(services []*nomad.Service, configured map[string][]string, logger *log.Logger) []*nomad.Service {
+	instances := make(map[string][]*nomad.Service)
+	dependencies := make(map[string][]string)
+	var names []string
+	for _, svc := range services {
+		if _, seen := instances[svc.ServiceName]; !seen {
+			names = append(names, svc.ServiceName)
+		}
+		instances[svc.ServiceName] = append(instances[svc.ServiceName], svc)
+		dependencies[svc.ServiceName] = append(dependencies[svc.ServiceName], serviceDependencies(svc, configured)...)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	ordered := make([]*nomad.Service, 0, len(services))
+
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		for _, dependency := range dependencies[name] {
+			if _, registered := instances[dependency]; !registered {
+				continue
+			}
+			switch state[dependency] {
+			case visiting:
+				logger.Printf("Warning: Dependency cycle between services %s and %s, ignoring %s -> %s",
+					name, dependency, name, dependency)
+			case unvisited:
+				visit(dependency)
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, instances[name]...)
+	}
+
+	for _, name := range names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,187 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func testServices(n int) []*nomad.Service {
+	services := make([]*nomad.Service, n)
+	for i := range services {
+		services[i] = &nomad.Service{ServiceName: fmt.Sprintf("svc%d", i), Address: "10.0.0.1", Port: 8000 + i}
+	}
+	return services
+}
+
+func TestSyncServices_ReportsProgress(t *testing.T) {
+	var logs bytes.Buffer
+	logger := log.New(&logs, "", 0)
+
+	report := syncServices(context.Background(), testServices(5), 2, logger, func(svc *nomad.Service) (interface{}, error) {
+		if svc.ServiceName == "svc3" {
+			return nil, fmt.Errorf("boom")
+		}
+		return map[string]string{"status": StatusCreated}, nil
+	})
+
+	if report.Total != 5 || report.Processed != 5 || report.Synced != 4 || report.Failed != 1 || report.TimedOut {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if got := strings.Count(logs.String(), "Sync progress:"); got != 2 {
+		t.Errorf("Expected 2 progress lines, got %d:\n%s", got, logs.String())
+	}
+}
+
+func TestSyncServices_StopsWhenContextExpires(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	logger := log.New(&bytes.Buffer{}, "", 0)
+
+	report := syncServices(ctx, testServices(10), 0, logger, func(svc *nomad.Service) (interface{}, error) {
+		if svc.ServiceName == "svc2" {
+			cancel()
+		}
+		return map[string]string{"status": StatusCreated}, nil
+	})
+
+	if !report.TimedOut {
+		t.Fatal("Expected sync to report a timeout")
+	}
+	if report.Processed != 3 || report.Total != 10 {
+		t.Errorf("Expected 3/10 services processed, got %d/%d", report.Processed, report.Total)
+	}
+}
+
+func TestHandleHealth_LivenessDuringInitialSync(t *testing.T) {
+	tests := []struct {
+		name             string
+		syncDone         bool
+		readyWithoutSync bool
+		expectedStatus   string
+	}{
+		{name: "sync pending", expectedStatus: "syncing"},
+		{name: "sync done", syncDone: true, expectedStatus: "healthy"},
+		{name: "ready without sync", readyWithoutSync: true, expectedStatus: "healthy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Connector{
+				config:          &config.Config{Sync: config.SyncConfig{ReadyWithoutSync: tt.readyWithoutSync}},
+				initialSyncDone: tt.syncDone,
+				conditions:      newConditionSet(),
+			}
+
+			recorder := httptest.NewRecorder()
+			c.handleHealth(recorder, httptest.NewRequest(http.MethodGet, "/health", http.NoBody))
+
+			// The sync gate is on /ready, a liveness probe must not restart a connector that is syncing
+			if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"status": "`+tt.expectedStatus+`"`) {
+				t.Errorf("Expected 200 with status %s, got %d (%s)", tt.expectedStatus, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// heldLock is a leader lock that is always available
+type heldLock struct{}
+
+func (heldLock) Acquire(context.Context) error { return nil }
+func (heldLock) Renew(context.Context) error   { return nil }
+func (heldLock) Release(context.Context) error { return nil }
+func (heldLock) TTL() time.Duration            { return time.Second }
+
+func TestHandleHealth_StandbyInHAMode(t *testing.T) {
+	c := &Connector{config: &config.Config{}, conditions: newConditionSet(), lock: heldLock{}}
+
+	recorder := httptest.NewRecorder()
+	c.handleHealth(recorder, httptest.NewRequest(http.MethodGet, "/health", http.NoBody))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"role": "standby"`) {
+		t.Errorf("Expected healthy standby, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Mutating admin endpoints are rejected on the standby
+	handler := c.leaderOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ServiceAPIPrefix+"api/drain", http.NoBody))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected standby to reject admin actions, got %d", recorder.Code)
+	}
+
+	// A new leader is syncing until the initial sync has finished, and still alive
+	c.setLeading(true)
+	recorder = httptest.NewRecorder()
+	c.handleHealth(recorder, httptest.NewRequest(http.MethodGet, "/health", http.NoBody))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"status": "syncing"`) ||
+		!strings.Contains(recorder.Body.String(), `"role": "leader"`) {
+		t.Errorf("Expected syncing leader, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestOrderServicesByDependencies(t *testing.T) {
+	service := func(name string, tags ...string) *nomad.Service {
+		return &nomad.Service{ServiceName: name, Tags: tags}
+	}
+
+	tests := []struct {
+		name       string
+		services   []*nomad.Service
+		configured map[string][]string
+		expected   []string
+	}{
+		{
+			name:     "no dependencies keeps order",
+			services: []*nomad.Service{service("a"), service("b"), service("c")},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "tag dependency moves target first",
+			services: []*nomad.Service{service("web", DependsOnTag+"maintenance"), service("api"), service("maintenance")},
+			expected: []string{"maintenance", "web", "api"},
+		},
+		{
+			name:       "configured dependency",
+			services:   []*nomad.Service{service("web"), service("fallback")},
+			configured: map[string][]string{"web": {"fallback"}},
+			expected:   []string{"fallback", "web"},
+		},
+		{
+			name:     "all instances of a dependency come first",
+			services: []*nomad.Service{service("web", DependsOnTag+"fallback"), service("fallback"), service("fallback")},
+			expected: []string{"fallback", "fallback", "web"},
+		},
+		{
+			name:     "unregistered dependency is ignored",
+			services: []*nomad.Service{service("web", DependsOnTag+"missing"), service("api")},
+			expected: []string{"web", "api"},
+		},
+		{
+			name:     "cycle is broken",
+			services: []*nomad.Service{service("a", DependsOnTag+"b"), service("b", DependsOnTag+"a")},
+			expected: []string{"b", "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered := orderServicesByDependencies(tt.services, tt.configured, log.New(&bytes.Buffer{}, "", 0))
+
+			names := make([]string, len(ordered))
+			for i, svc := range ordered {
+				names[i] = svc.ServiceName
+			}
+			if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected order %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package connector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// TagPrefix starts all tags read by the connector
+const TagPrefix = "haproxy."
+
+// ServiceSpec is what registration and deregistration decide on before touching HAProxy: the service
+// type, backend, domain, mode and canary flag. Feature tags (limits, checks, headers, sticky
+// sessions, tcp binds, ...) are still read by their features from the tags; all tags are validated
+// here against knownTags, so their problems are reported once per event.
+type ServiceSpec struct {
+	Type    haproxy.ServiceType
+	Backend string
+	Domain  *haproxy.DomainMapping
+	Mode    string
+	Canary  bool
+	// Problems lists unknown haproxy.* tags and invalid values. The connector ignores them,
+	// they are reported so typos don't go unnoticed.
+	Problems []string
+}
+
+// tagValidator checks the value of a tag, it returns why the value is invalid
+type tagValidator func(value string) error
+
+// knownTags lists the keys of all haproxy.* tags and how their values are validated, flags set by their
+// key alone have no validator
+var knownTags = map[string]tagValidator{
+	"haproxy.enable":            boolValue,
+	"haproxy.address":           addressModeValue,
+	"haproxy.server_name":       enumValue(ServerNameAddress, ServerNameAlloc),
+	"haproxy.backend":           enumValue(string(haproxy.ServiceTypeDynamic), string(haproxy.ServiceTypeCustom)),
+	"haproxy.backend.name":      anyValue,
+	"haproxy.backend.keep":      boolValue,
+	"haproxy.mode":              enumValue(ModeHTTP, ModeTCP),
+	"haproxy.tcp.port":          intValue(1, 65535),
+	"haproxy.tcp.bind":          anyValue,
+	"haproxy.domain":            anyValue,
+	"haproxy.domain.type":       enumValue("exact", "prefix", "suffix", "regex"),
+	"haproxy.frontend":          anyValue,
+	"haproxy.redirect.https":    boolValue,
+	"haproxy.ratelimit.rps":     intValue(1, 0),
+	"haproxy.ratelimit.burst":   intValue(0, 0),
+	"haproxy.auth.userlist":     anyValue,
+	"haproxy.auth.user":         anyValue,
+	"haproxy.auth.password":     anyValue,
+	"haproxy.canary.percent":    intValue(1, 99),
+	"haproxy.canary.weight":     intValue(1, 99),
+	"haproxy.deployment":        colorValue,
+	"haproxy.active":            colorValue,
+	"haproxy.maint":             boolValue,
+	"haproxy.pause":             boolValue,
+	"haproxy.register.on":       enumValue(RegisterOnRunning, RegisterOnHealthy),
+	"haproxy.cert.path":         anyValue,
+	"haproxy.acme":              boolValue,
+	"haproxy.dns":               boolValue,
+	"haproxy.depends_on":        anyValue,
+	"haproxy.sticky":            enumValue(StickyModeCookie, StickyModeSource),
+	"haproxy.timeout.server":    durationValue,
+	"haproxy.timeout.connect":   durationValue,
+	"haproxy.timeout.tunnel":    durationValue,
+	"haproxy.maxconn":           intValue(1, 0),
+	"haproxy.slowstart":         durationValue,
+	"haproxy.forwardfor":        boolValue,
+	"haproxy.xfp":               enumValue("http", "https", ForwardedProtoAuto),
+	"haproxy.proto":             enumValue("h1", "h2"),
+	"haproxy.compression":       compressionValue,
+	"haproxy.compression.types": anyValue,
+	"haproxy.alpn":              alpnValue,
+	"haproxy.check.path":        anyValue,
+	"haproxy.check.method":      anyValue,
+	"haproxy.check.host":        anyValue,
+	"haproxy.check.type":        enumValue(CheckTypeHTTP, CheckTypeTCP, CheckTypeExternal),
+	"haproxy.check.disabled":    nil,
+	"haproxy.check.interval":    durationValue,
+	"haproxy.check.timeout":     durationValue,
+	"haproxy.check.rise":        intValue(1, 0),
+	"haproxy.check.fall":        intValue(1, 0),
+	"haproxy.check.ssl":         boolValue,
+	"haproxy.check.verify":      enumValue(SSLVerifyNone, SSLVerifyRequired),
+	"haproxy.check.ca_file":     anyValue,
+	"haproxy.check.agent_port":  intValue(1, 65535),
+	"haproxy.check.agent_addr":  anyValue,
+	"haproxy.check.observe":     enumValue(ObserveLayer4, ObserveLayer7),
+	"haproxy.check.on_error":    enumValue(onErrorActions...),
+	"haproxy.check.error_limit": intValue(1, 0),
+}
+
+// knownTagPrefixes lists the tags carrying a name in their key, like haproxy.header.request.X-Foo
+var knownTagPrefixes = []string{RequestHeaderTagPrefix, ResponseHeaderTagPrefix}
+
+// parseServiceSpec parses the haproxy.* tags of a service instance in one pass
+func parseServiceSpec(serviceName string, tags []string) *ServiceSpec {
+	spec := &ServiceSpec{
+		Type:    classifyService(tags),
+		Backend: serviceBackendName(serviceName, tags),
+		Domain:  parseDomainMapping(serviceName, tags),
+		Mode:    parseServiceMode(tags),
+		Canary:  isCanary(tags),
+	}
+	for _, tag := range tags {
+		if problem := checkTag(tag); problem != "" {
+			spec.Problems = append(spec.Problems, problem)
+		}
+	}
+	if spec.Domain != nil && spec.Domain.Type == haproxy.DomainTypeRegex {
+		if err := validateRegexDomain(spec.Domain.Domain); err != nil {
+			spec.Problems = append(spec.Problems, err.Error())
+		}
+	}
+	return spec
+}
+
+// checkTag validates a single tag, it returns a description of the problem or "" for valid tags
+// and tags not meant for the connector
+func checkTag(tag string) string {
+	if !strings.HasPrefix(tag, TagPrefix) {
+		return ""
+	}
+	key, value, hasValue := strings.Cut(tag, "=")
+	for _, prefix := range knownTagPrefixes {
+		if name, ok := strings.CutPrefix(key, prefix); ok {
+			if name == "" || !hasValue {
+				return fmt.Sprintf("invalid tag %q: expected %s<name>=<value>", tag, prefix)
+			}
+			return ""
+		}
+	}
+
+	validate, ok := knownTags[key]
+	if !ok {
+		return fmt.Sprintf("unknown tag %q", tag)
+	}
+	if validate == nil {
+		return ""
+	}
+	if !hasValue {
+		return fmt.Sprintf("invalid tag %q: missing =<value>", tag)
+	}
+	if err := validate(value); err != nil {
+		return fmt.Sprintf("invalid tag %q: %v", tag, err)
+	}
+	return ""
+}
+
+// addressModeValue accepts the address modes of instances: service, node or host_network:<alias>
+func addressModeValue(value string) error {
+	if !nomad.ValidAddressMode(value) {
+		return fmt.Errorf("must be one of service, node, host_network:<alias>")
+	}
+	return nil
+}
+
+func anyValue(value string) error {
+	if value == "" {
+		return fmt.Errorf("empty value")
+	}
+	return nil
+}
+
+func boolValue(value string) error {
+	return enumValue("true", "false")(value)
+}
+
+// enumValue accepts one of values
+func enumValue(values ...string) tagValidator {
+	return func(value string) error {
+		for _, allowed := range values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+}
+
+// intValue accepts integers from minimum to maximum, a maximum of 0 means no upper bound
+func intValue(minimum, maximum int) tagValidator {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		switch {
+		case err != nil:
+			return fmt.Errorf("not an integer")
+		case n < minimum:
+			return fmt.Errorf("must be at least %d", minimum)
+		case maximum > 0 && n > maximum:
+			return fmt.Errorf("must be at most %d", maximum)
+		}
+		return nil
+	}
+}
+
+// colorValue accepts the blue/green colors like deploymentColor
+func colorValue(value string) error {
+	if deploymentColor(value) == "" {
+		return fmt.Errorf("must be one of %s, %s", DeploymentBlue, DeploymentGreen)
+	}
+	return nil
+}
+
+// durationValue accepts positive Go durations and plain milliseconds like parseTimeoutMs
+func durationValue(value string) error {
+	if parseTimeoutMs(value) <= 0 {
+		return fmt.Errorf("not a positive duration (e.g. 5s) or milliseconds")
+	}
+	return nil
+}
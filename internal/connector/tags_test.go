@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+)
+
+func TestParseServiceSpec(t *testing.T) {
+	spec := parseServiceSpec("web", []string{
+		"haproxy.enable=true",
+		"haproxy.domain=web.example.com",
+		"haproxy.canary.percent=10",
+		"haproxy.header.request.X-Forwarded-Prefix=/api",
+		"haproxy.check.disabled",
+		"http",
+	})
+
+	if spec.Type != haproxy.ServiceTypeDynamic || spec.Backend != "web_canary" || spec.Mode != ModeHTTP || !spec.Canary {
+		t.Errorf("Unexpected spec %+v", spec)
+	}
+	if spec.Domain == nil || spec.Domain.Domain != "web.example.com" || spec.Domain.BackendName != "web" {
+		t.Errorf("Expected the domain mapping of the stable backend, got %+v", spec.Domain)
+	}
+	if len(spec.Problems) != 0 {
+		t.Errorf("Expected no problems, got %v", spec.Problems)
+	}
+}
+
+func TestParseServiceSpec_Problems(t *testing.T) {
+	tests := []struct {
+		tag     string
+		problem string
+	}{
+		{tag: "haproxy.domian=web.example.com", problem: `unknown tag "haproxy.domian=web.example.com"`},
+		{tag: "haproxy.maxconn=lots", problem: "not an integer"},
+		{tag: "haproxy.canary.percent=100", problem: "must be at most 99"},
+		{tag: "haproxy.ratelimit.rps=0", problem: "must be at least 1"},
+		{tag: "haproxy.sticky=ip", problem: "must be one of cookie, source"},
+		{tag: "haproxy.forwardfor=yes", problem: "must be one of true, false"},
+		{tag: "haproxy.check.interval=soon", problem: "not a positive duration"},
+		{tag: "haproxy.address=host_network:", problem: "must be one of service, node, host_network:<alias>"},
+		{tag: "haproxy.domain", problem: "missing =<value>"},
+		{tag: "haproxy.header.response.=DENY", problem: "expected haproxy.header.response.<name>=<value>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			spec := parseServiceSpec("web", []string{"haproxy.enable=true", tt.tag})
+			if len(spec.Problems) != 1 || !strings.Contains(spec.Problems[0], tt.problem) {
+				t.Errorf("Expected problem %q, got %v", tt.problem, spec.Problems)
+			}
+		})
+	}
+}
+
+func TestParseServiceSpec_RegexDomain(t *testing.T) {
+	spec := parseServiceSpec("web", []string{"haproxy.enable=true", "haproxy.domain=^(web", "haproxy.domain.type=regex"})
+	if len(spec.Problems) != 1 || !strings.Contains(spec.Problems[0], "invalid regex domain") {
+		t.Errorf("Expected the regex to be compiled, got %v", spec.Problems)
+	}
+}
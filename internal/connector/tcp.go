@@ -0,0 +1,136 @@
+package connector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/haproxy"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// Proxy mode constants
+const (
+	ModeHTTP = "http"
+	ModeTCP  = "tcp"
+
+	DefaultBindAddress = "*"
+)
+
+// parseServiceMode returns the proxy mode requested via the haproxy.mode tag (default: http)
+func parseServiceMode(tags []string) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, "haproxy.mode=") {
+			if mode := strings.TrimPrefix(tag, "haproxy.mode="); mode == ModeTCP {
+				return ModeTCP
+			}
+		}
+	}
+	return ModeHTTP
+}
+
+// isTCPMode checks if the service requested a tcp-mode backend
+func isTCPMode(tags []string) bool {
+	return parseServiceMode(tags) == ModeTCP
+}
+
+// tcpBinding describes a dedicated frontend exposing a tcp-mode backend on a port
+type tcpBinding struct {
+	Address string
+	Port    int
+}
+
+// parseTCPBinding extracts the dedicated frontend binding from haproxy.tcp.port and
+// haproxy.tcp.bind tags. Returns nil if the service is not tcp-mode or has no port.
+func parseTCPBinding(tags []string) (*tcpBinding, error) {
+	if !isTCPMode(tags) {
+		return nil, nil
+	}
+
+	binding := &tcpBinding{Address: DefaultBindAddress}
+	for _, tag := range tags {
+		switch {
+		case strings.HasPrefix(tag, "haproxy.tcp.port="):
+			port, err := strconv.Atoi(strings.TrimPrefix(tag, "haproxy.tcp.port="))
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("invalid haproxy.tcp.port tag %q", tag)
+			}
+			binding.Port = port
+		case strings.HasPrefix(tag, "haproxy.tcp.bind="):
+			binding.Address = strings.TrimPrefix(tag, "haproxy.tcp.bind=")
+		}
+	}
+
+	if binding.Port == 0 {
+		return nil, nil
+	}
+	return binding, nil
+}
+
+// tcpFrontendName returns the name of the dedicated frontend for a tcp-mode backend
+func tcpFrontendName(backendName string) string {
+	return "tcp_" + backendName
+}
+
+// serviceTCPFrontends returns the dedicated tcp frontends of all managed services with a haproxy.bind tag
+func serviceTCPFrontends(services []*nomad.Service) []string {
+	var frontends []string
+	for _, svc := range services {
+		tags := serviceTags(svc.Tags, svc.Meta)
+		if binding, err := parseTCPBinding(tags); err == nil && binding != nil && hasTag(tags, "haproxy.enable=true") {
+			if name := tcpFrontendName(stableBackendName(svc.ServiceName, tags)); !containsString(frontends, name) {
+				frontends = append(frontends, name)
+			}
+		}
+	}
+	return frontends
+}
+
+// reconcileTCPFrontend ensures a dedicated tcp frontend with a bind on the requested port
+// exists for tcp-mode services declaring haproxy.tcp.port, moving the bind when the port changes
+func (hs *handlerState) reconcileTCPFrontend(client haproxy.ClientInterface, tags []string, backendName string, result map[string]string) error {
+	binding, err := parseTCPBinding(tags)
+	if err != nil || binding == nil {
+		return err
+	}
+
+	frontendName := tcpFrontendName(backendName)
+	frontend := &haproxy.Frontend{
+		Name:           frontendName,
+		Mode:           ModeTCP,
+		DefaultBackend: backendName,
+	}
+	changed, err := ensureFrontend(client, frontend, frontendBind(frontendName, binding.Address, binding.Port, ""))
+	if err != nil {
+		return err
+	}
+	if !changed {
+		result["tcp_frontend"] = "exists: " + frontendName
+		return nil
+	}
+
+	hs.recordBackendChange(backendName)
+	result["tcp_frontend"] = fmt.Sprintf("set up: %s on %s:%d", frontendName, binding.Address, binding.Port)
+	return nil
+}
+
+// removeTCPFrontend deletes the dedicated tcp frontend of a service
+func removeTCPFrontend(client haproxy.ClientInterface, tags []string, backendName string, result map[string]string) {
+	binding, err := parseTCPBinding(tags)
+	if err != nil || binding == nil {
+		return
+	}
+
+	frontendName := tcpFrontendName(backendName)
+	version, err := client.GetConfigVersion()
+	if err == nil {
+		err = client.DeleteFrontend(frontendName, version)
+	}
+
+	if err != nil {
+		result["tcp_frontend_warning"] = fmt.Sprintf("failed to remove tcp frontend %s: %v", frontendName, err)
+		return
+	}
+
+	result["tcp_frontend_removed"] = frontendName
+}
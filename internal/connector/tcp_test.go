@@ -0,0 +1,138 @@
+package connector
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseTCPBinding(t *testing.T) {
+	tests := []struct {
+		name        string
+		tags        []string
+		expectPort  int
+		expectAddr  string
+		expectError bool
+	}{
+		{name: "http service", tags: []string{"haproxy.enable=true", "haproxy.tcp.port=5432"}},
+		{name: "tcp without port", tags: []string{"haproxy.mode=tcp"}},
+		{name: "tcp with port", tags: []string{"haproxy.mode=tcp", "haproxy.tcp.port=5432"}, expectPort: 5432, expectAddr: "*"},
+		{
+			name:       "tcp with bind address",
+			tags:       []string{"haproxy.mode=tcp", "haproxy.tcp.port=3306", "haproxy.tcp.bind=10.0.0.1"},
+			expectPort: 3306,
+			expectAddr: "10.0.0.1",
+		},
+		{name: "invalid port", tags: []string{"haproxy.mode=tcp", "haproxy.tcp.port=abc"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binding, err := parseTCPBinding(tt.tags)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("parseTCPBinding() error = %v, expectError %v", err, tt.expectError)
+			}
+			if tt.expectPort == 0 {
+				if binding != nil {
+					t.Errorf("Expected no binding, got %+v", binding)
+				}
+				return
+			}
+			if binding == nil || binding.Port != tt.expectPort || binding.Address != tt.expectAddr {
+				t.Errorf("parseTCPBinding() = %+v, expected %s:%d", binding, tt.expectAddr, tt.expectPort)
+			}
+		})
+	}
+}
+
+func TestTCPModeServiceCreatesTCPBackendAndFrontend(t *testing.T) {
+	mock := &mockHAProxyClientWithBackendTracking{}
+
+	event := &ServiceEvent{
+		Type: EventTypeServiceRegistration,
+		Service: Service{
+			ServiceName: "postgres",
+			Address:     "10.0.0.5",
+			Port:        5432,
+			Tags:        []string{"haproxy.enable=true", "haproxy.mode=tcp", "haproxy.tcp.port=15432", "haproxy.check.path=/health"},
+		},
+	}
+
+	result, err := ProcessServiceEvent(context.Background(), mock, event, testConfig())
+	if err != nil {
+		t.Fatalf("ProcessServiceEvent() failed: %v", err)
+	}
+
+	if mock.createdBackend.Mode != ModeTCP {
+		t.Errorf("Expected tcp backend, got mode %q", mock.createdBackend.Mode)
+	}
+	if mock.createdBackend.AdvCheck != "" {
+		t.Errorf("Expected no HTTP check on tcp backend, got %q", mock.createdBackend.AdvCheck)
+	}
+
+	if len(mock.createdFrontends) != 1 || mock.createdFrontends[0].Name != "tcp_postgres" ||
+		mock.createdFrontends[0].DefaultBackend != "postgres" {
+		t.Fatalf("Expected dedicated tcp frontend, got %+v", mock.createdFrontends)
+	}
+	if len(mock.createdBinds) != 1 || mock.createdBinds[0].Port != 15432 {
+		t.Errorf("Expected bind on port 15432, got %+v", mock.createdBinds)
+	}
+
+	resultMap := result.(map[string]string)
+	if resultMap["tcp_frontend"] == "" {
+		t.Errorf("Expected tcp_frontend in result, got %v", resultMap)
+	}
+
+	event.Type = EventTypeServiceDeregistration
+	if _, err := ProcessServiceEvent(context.Background(), mock, event, testConfig()); err != nil {
+		t.Fatalf("ProcessServiceEvent() deregistration failed: %v", err)
+	}
+	if len(mock.deletedFrontends) != 1 || mock.deletedFrontends[0] != "tcp_postgres" {
+		t.Errorf("Expected tcp frontend removal, got %v", mock.deletedFrontends)
+	}
+}
+
+func TestReconcileTCPFrontend_MovesBindOnPortChange(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	hs := newHandlerState()
+	tags := []string{"haproxy.enable=true", "haproxy.mode=tcp", "haproxy.tcp.port=15432"}
+
+	result := map[string]string{}
+	if err := hs.reconcileTCPFrontend(mock, tags, "postgres", result); err != nil {
+		t.Fatalf("reconcileTCPFrontend() failed: %v", err)
+	}
+	result = map[string]string{}
+	if err := hs.reconcileTCPFrontend(mock, tags, "postgres", result); err != nil {
+		t.Fatalf("reconcileTCPFrontend() failed: %v", err)
+	}
+	if result["tcp_frontend"] != "exists: tcp_postgres" {
+		t.Errorf("Expected the unchanged frontend to be left alone, got %v", result)
+	}
+
+	tags[2] = "haproxy.tcp.port=25432"
+	if err := hs.reconcileTCPFrontend(mock, tags, "postgres", map[string]string{}); err != nil {
+		t.Fatalf("reconcileTCPFrontend() failed: %v", err)
+	}
+	if len(mock.createdFrontends) != 1 {
+		t.Errorf("Expected the frontend to be created once, got %+v", mock.createdFrontends)
+	}
+	if len(mock.createdBinds) != 1 || mock.createdBinds[0].Name != "tcp_postgres_25432" || mock.createdBinds[0].Port != 25432 {
+		t.Errorf("Expected the bind to move to the new port, got %+v", mock.createdBinds)
+	}
+}
+
+func TestTCPModeServiceGetsNoDomainRule(t *testing.T) {
+	mock := &mockHAProxyClient{}
+	hs := newHandlerState()
+	tags := []string{"haproxy.enable=true", "haproxy.mode=tcp", "haproxy.tcp.port=15432", "haproxy.domain=db.example.com"}
+
+	result := map[string]string{}
+	if err := hs.reconcileFrontendRule(mock, "postgres", tags, "postgres", result, []string{"https"}); err != nil {
+		t.Fatalf("reconcileFrontendRule() failed: %v", err)
+	}
+	if len(mock.frontendRules["https"]) != 0 {
+		t.Errorf("Expected no domain rule for a tcp-mode service, got %+v", mock.frontendRules)
+	}
+	if result["frontend_rule_skipped"] == "" {
+		t.Errorf("Expected the skipped rule in the result, got %v", result)
+	}
+}
@@ -0,0 +1,130 @@
+package connector
+
+import (
+	"sync"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// eventKeys returns the backend and the frontends an event changes. The stable backend also stands
+// for its canary and blue/green backends, they share the domain rule. Events sharing a key are
+// processed one at a time, in order, so their read-modify-write changes don't conflict.
+func (hs *handlerState) eventKeys(event *nomad.ServiceEvent, cfg *config.HAProxyConfig) []string {
+	if event.Payload.Node != nil {
+		return hs.nodeEventKeys(event)
+	}
+	svc := event.Payload.Service
+	if svc == nil {
+		return nil
+	}
+	tags := serviceTags(svc.Tags, svc.Meta)
+
+	keys := []string{"backend/" + stableBackendName(svc.ServiceName, tags)}
+	if hasDomainMapping(tags) {
+		for _, frontend := range parseFrontends(tags, serviceFrontends(svc.ServiceName, tags, cfg)) {
+			keys = append(keys, "frontend/"+frontend)
+		}
+		// Redirects to HTTPS are added to the plain HTTP frontend
+		if cfg.HTTPFrontend != "" && !containsString(keys, "frontend/"+cfg.HTTPFrontend) {
+			keys = append(keys, "frontend/"+cfg.HTTPFrontend)
+		}
+	}
+	return keys
+}
+
+// eventPool processes events concurrently, up to a limit. An event is started once no running or
+// earlier queued event shares one of its keys, so events of the same backend or frontend keep their order.
+type eventPool struct {
+	process  func(nomad.ServiceEvent)
+	limit    int
+	maxQueue int
+
+	mu      sync.Mutex
+	changed *sync.Cond
+	queue   []*queuedEvent
+	busy    map[string]bool
+	running int
+}
+
+type queuedEvent struct {
+	event nomad.ServiceEvent
+	keys  []string
+}
+
+func newEventPool(limit, maxQueue int, process func(nomad.ServiceEvent)) *eventPool {
+	p := &eventPool{
+		process:  process,
+		limit:    max(limit, 1),
+		maxQueue: max(maxQueue, 1),
+		busy:     make(map[string]bool),
+	}
+	p.changed = sync.NewCond(&p.mu)
+	return p
+}
+
+// submit queues an event, it blocks while the queue is full
+func (p *eventPool) submit(event nomad.ServiceEvent, keys []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.queue) >= p.maxQueue {
+		p.changed.Wait()
+	}
+	p.queue = append(p.queue, &queuedEvent{event: event, keys: keys})
+	p.startReady()
+}
+
+// startReady starts the queued events whose keys are free, in order. The caller holds mu.
+func (p *eventPool) startReady() {
+	blocked := make(map[string]bool)
+	remaining := p.queue[:0]
+	for _, queued := range p.queue {
+		if p.running < p.limit && !p.conflicts(queued.keys, blocked) {
+			p.running++
+			for _, key := range queued.keys {
+				p.busy[key] = true
+			}
+			go p.run(queued)
+			continue
+		}
+		// Later events must not overtake this one
+		for _, key := range queued.keys {
+			blocked[key] = true
+		}
+		remaining = append(remaining, queued)
+	}
+	clear(p.queue[len(remaining):])
+	p.queue = remaining
+}
+
+func (p *eventPool) conflicts(keys []string, blocked map[string]bool) bool {
+	for _, key := range keys {
+		if p.busy[key] || blocked[key] {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *eventPool) run(queued *queuedEvent) {
+	p.process(queued.event)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+	for _, key := range queued.keys {
+		delete(p.busy, key)
+	}
+	p.startReady()
+	p.changed.Broadcast()
+}
+
+// wait blocks until all submitted events are processed
+func (p *eventPool) wait() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.running > 0 || len(p.queue) > 0 {
+		p.changed.Wait()
+	}
+}
@@ -0,0 +1,151 @@
+package connector
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+func workerTestEvent(serviceName string, tags ...string) nomad.ServiceEvent {
+	return nomad.ServiceEvent{
+		Type:    EventTypeServiceRegistration,
+		Payload: nomad.Payload{Service: &nomad.Service{ServiceName: serviceName, Address: "10.0.0.1", Port: 8080, Tags: tags}},
+	}
+}
+
+func TestEventKeys(t *testing.T) {
+	hs := newHandlerState()
+	cfg := &config.HAProxyConfig{Frontend: "https", HTTPFrontend: "http"}
+
+	tests := []struct {
+		name     string
+		event    nomad.ServiceEvent
+		expected []string
+	}{
+		{name: "backend only", event: workerTestEvent("api", "haproxy.enable=true"),
+			expected: []string{"backend/api"}},
+		{name: "domain", event: workerTestEvent("web", "haproxy.enable=true", "haproxy.domain=web.example.com"),
+			expected: []string{"backend/web", "frontend/https", "frontend/http"}},
+		{name: "canary shares the stable backend", event: workerTestEvent("web", "haproxy.enable=true", "haproxy.canary.percent=10"),
+			expected: []string{"backend/web"}},
+		{name: "explicit frontends", event: workerTestEvent("web", "haproxy.enable=true", "haproxy.domain=web.example.com", "haproxy.frontend=http,internal"),
+			expected: []string{"backend/web", "frontend/http", "frontend/internal"}},
+		{name: "no service", event: nomad.ServiceEvent{Type: EventTypeServiceRegistration}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if keys := hs.eventKeys(&tt.event, cfg); !reflect.DeepEqual(keys, tt.expected) {
+				t.Errorf("eventKeys() = %v, expected %v", keys, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEventPool_SerializesSharedKeys(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 3)
+	var mu sync.Mutex
+	var finished []string
+
+	pool := newEventPool(4, 10, func(event nomad.ServiceEvent) {
+		name := event.Payload.Service.ServiceName
+		started <- name
+		if name == "slow" {
+			<-release
+		}
+		mu.Lock()
+		finished = append(finished, name)
+		mu.Unlock()
+	})
+
+	pool.submit(workerTestEvent("slow"), []string{"backend/web", "frontend/https"})
+	pool.submit(workerTestEvent("same-frontend"), []string{"backend/api", "frontend/https"})
+	pool.submit(workerTestEvent("other"), []string{"backend/db"})
+
+	// Events without a shared key don't wait for the slow one
+	running := map[string]bool{}
+	for len(running) < 2 {
+		select {
+		case name := <-started:
+			running[name] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Expected slow and other to start, got %v", running)
+		}
+	}
+	if !running["slow"] || !running["other"] {
+		t.Fatalf("Expected slow and other to start, got %v", running)
+	}
+	select {
+	case name := <-started:
+		t.Fatalf("Expected %s to wait for the event sharing its frontend", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	pool.wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(finished) != 3 || finished[len(finished)-1] != "same-frontend" {
+		t.Errorf("Expected the event sharing the frontend to run last, got %v", finished)
+	}
+}
+
+func TestEventPool_KeepsOrderBehindBlockedEvents(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+
+	pool := newEventPool(4, 10, func(event nomad.ServiceEvent) {
+		name := event.Payload.Service.ServiceName
+		if name == "first" {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, name)
+		mu.Unlock()
+	})
+
+	// "third" only shares a key with "second", which waits for "first": it must not overtake "second"
+	pool.submit(workerTestEvent("first"), []string{"backend/web"})
+	pool.submit(workerTestEvent("second"), []string{"backend/web", "frontend/https"})
+	pool.submit(workerTestEvent("third"), []string{"frontend/https"})
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	pool.wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(order, []string{"first", "second", "third"}) {
+		t.Errorf("Expected events sharing keys to keep their order, got %v", order)
+	}
+}
+
+func TestEventPool_LimitsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+
+	pool := newEventPool(2, 1, func(nomad.ServiceEvent) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		pool.submit(workerTestEvent(name), []string{"backend/" + name})
+	}
+	pool.wait()
+
+	if peak != 2 {
+		t.Errorf("Expected at most 2 events at a time, got %d", peak)
+	}
+}
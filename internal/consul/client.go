@@ -0,0 +1,392 @@
+// Package consul discovers services in the Consul catalog. Its client implements the same
+// discovery interface as the Nomad client, so services registered in Consul are handled by the
+// connector like Nomad native services.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+const (
+	// DefaultWaitTime is how long a blocking catalog query waits for a change
+	DefaultWaitTime = 5 * time.Minute
+
+	// DefaultRequestTimeoutSec bounds the non-blocking Consul requests
+	DefaultRequestTimeoutSec = 10
+
+	// nomadServiceIDPrefix starts the IDs of services Nomad registers in Consul, followed by the allocation ID
+	nomadServiceIDPrefix = "_nomad-task-"
+	allocIDLength        = 36
+
+	tagPrefix = "haproxy."
+)
+
+// Client watches the Consul catalog for services with haproxy.* tags
+type Client struct {
+	address    string
+	token      string
+	datacenter string
+	wait       time.Duration
+	httpClient *http.Client
+	logger     *log.Logger
+
+	// streamStatus is notified when watching the catalog starts (nil) or fails (error)
+	streamStatus func(err error)
+	lastActivity atomic.Int64 // unix nanoseconds of the last catalog response
+
+	mu    sync.Mutex
+	known map[string]*nomad.Service // instances seen last, by instanceKey
+	index uint64                    // catalog index of known (0 = nothing known yet)
+}
+
+var _ nomad.NomadClient = (*Client)(nil)
+
+// NewClient creates a client for the Consul HTTP API at address. An empty datacenter uses the
+// datacenter of the Consul agent.
+func NewClient(address, token, datacenter string, logger *log.Logger) *Client {
+	return &Client{
+		address:    strings.TrimSuffix(address, "/"),
+		token:      token,
+		datacenter: datacenter,
+		wait:       DefaultWaitTime,
+		// Blocking queries are bounded by their wait time, the context cancels them
+		httpClient: &http.Client{},
+		logger:     logger,
+	}
+}
+
+// SetStreamStatusHandler registers a callback that is notified whenever watching the catalog
+// starts (nil error) or fails (the error causing the retry)
+func (c *Client) SetStreamStatusHandler(handler func(err error)) {
+	c.streamStatus = handler
+}
+
+// LastActivity returns when the catalog last answered a query
+func (c *Client) LastActivity() time.Time {
+	if nanos := c.lastActivity.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+func (c *Client) reportStreamStatus(err error) {
+	if c.streamStatus != nil {
+		c.streamStatus(err)
+	}
+}
+
+// GetServices gets all instances of the services with haproxy.* tags (for initial sync). The
+// instances are the starting point for the changes StreamServiceEvents reports.
+func (c *Client) GetServices() ([]*nomad.Service, error) {
+	c.logger.Printf("Fetching existing services from Consul for initial sync...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeoutSec*time.Second)
+	defer cancel()
+
+	names, index, err := c.catalogServices(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := c.instances(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.known, c.index = instances, index
+	c.mu.Unlock()
+
+	services := make([]*nomad.Service, 0, len(instances))
+	for _, key := range sortedKeys(instances) {
+		services = append(services, instances[key])
+	}
+	c.logger.Printf("Found %d existing services in Consul", len(services))
+	return services, nil
+}
+
+// GetServiceCheckFromJob returns no check, the checks of Consul services are configured with the
+// haproxy.check.* tags
+func (c *Client) GetServiceCheckFromJob(_, _ string) (*nomad.ServiceCheck, error) {
+	return nil, nil
+}
+
+// StreamServiceEvents watches the catalog with blocking queries and reports the instances that were
+// added, changed or removed as service registration and deregistration events
+func (c *Client) StreamServiceEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	for {
+		err := c.watch(ctx, eventChan)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.reportStreamStatus(err)
+		c.logger.Printf("Consul catalog watch error: %v", err)
+		c.logger.Printf("Retrying in %d seconds...", nomad.StreamReconnectDelaySec)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(nomad.StreamReconnectDelaySec * time.Second):
+		}
+	}
+}
+
+// watch reports catalog changes until a query fails
+func (c *Client) watch(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	connected := false
+	for {
+		c.mu.Lock()
+		lastIndex := c.index
+		c.mu.Unlock()
+
+		instances, index, err := c.poll(ctx, lastIndex)
+		if err != nil {
+			return err
+		}
+		c.lastActivity.Store(time.Now().UnixNano())
+		if !connected {
+			connected = true
+			c.logger.Printf("Watching Consul catalog: %s", c.address)
+			c.reportStreamStatus(nil)
+		}
+		if index == lastIndex {
+			// The wait time passed without changes
+			continue
+		}
+		if err := c.publishChanges(ctx, instances, index, eventChan); err != nil {
+			return err
+		}
+	}
+}
+
+// poll waits for the catalog to change after lastIndex and gets the instances of the services
+func (c *Client) poll(ctx context.Context, lastIndex uint64) (map[string]*nomad.Service, uint64, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, c.wait+DefaultRequestTimeoutSec*time.Second)
+	defer cancel()
+
+	names, index, err := c.catalogServices(queryCtx, lastIndex)
+	if err != nil || index == lastIndex {
+		return nil, index, err
+	}
+	instances, err := c.instances(queryCtx, names)
+	return instances, index, err
+}
+
+// publishChanges sends the events turning the known instances into the current ones and remembers them
+func (c *Client) publishChanges(
+	ctx context.Context,
+	instances map[string]*nomad.Service,
+	index uint64,
+	eventChan chan<- nomad.ServiceEvent,
+) error {
+	c.mu.Lock()
+	known := c.known
+	c.mu.Unlock()
+
+	var events []nomad.ServiceEvent
+	if known != nil {
+		events = changeEvents(known, instances, index)
+	}
+	for i := range events {
+		select {
+		case eventChan <- events[i]:
+			c.logger.Printf("Processed %s event for service %s", events[i].Type, events[i].Payload.Service.ServiceName)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	c.mu.Lock()
+	c.known, c.index = instances, index
+	c.mu.Unlock()
+	return nil
+}
+
+// changeEvents returns the events turning the known instances into the current ones: deregistrations
+// of removed instances and of the old address of moved ones, then registrations of new and changed ones
+func changeEvents(known, current map[string]*nomad.Service, index uint64) []nomad.ServiceEvent {
+	event := func(eventType string, svc *nomad.Service) nomad.ServiceEvent {
+		return nomad.ServiceEvent{Type: eventType, Topic: "Service", Index: index, Payload: nomad.Payload{Service: svc}}
+	}
+
+	var events []nomad.ServiceEvent
+	for _, key := range sortedKeys(known) {
+		previous := known[key]
+		svc, ok := current[key]
+		if !ok || svc.Address != previous.Address || svc.Port != previous.Port {
+			events = append(events, event("ServiceDeregistration", previous))
+		}
+	}
+	for _, key := range sortedKeys(current) {
+		svc := current[key]
+		if previous, ok := known[key]; !ok || svc.ModifyIndex != previous.ModifyIndex {
+			events = append(events, event("ServiceRegistration", svc))
+		}
+	}
+	return events
+}
+
+// catalogServices lists the services with haproxy.* tags, blocking until the catalog index
+// passes the given one (0 = no blocking)
+func (c *Client) catalogServices(ctx context.Context, index uint64) ([]string, uint64, error) {
+	var services map[string][]string
+	newIndex, err := c.get(ctx, "/v1/catalog/services", index, &services)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list services from Consul: %w", err)
+	}
+	// An index going backwards means the catalog was restored, a missing one would make the next
+	// query return right away. Both start over from the lowest index that still blocks.
+	if newIndex < index || newIndex == 0 {
+		newIndex = 1
+	}
+
+	var names []string
+	for name, tags := range services {
+		if hasHAProxyTag(tags) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, newIndex, nil
+}
+
+// catalogEntry is an instance of a service as returned by /v1/catalog/service/:name
+type catalogEntry struct {
+	ID             string            `json:"ID"`
+	Node           string            `json:"Node"`
+	Address        string            `json:"Address"`
+	Datacenter     string            `json:"Datacenter"`
+	ServiceID      string            `json:"ServiceID"`
+	ServiceName    string            `json:"ServiceName"`
+	ServiceTags    []string          `json:"ServiceTags"`
+	ServiceAddress string            `json:"ServiceAddress"`
+	ServicePort    int               `json:"ServicePort"`
+	ServiceMeta    map[string]string `json:"ServiceMeta"`
+	Namespace      string            `json:"Namespace"`
+	CreateIndex    uint64            `json:"CreateIndex"`
+	ModifyIndex    uint64            `json:"ModifyIndex"`
+}
+
+// instances gets the instances of the services, by instanceKey
+func (c *Client) instances(ctx context.Context, names []string) (map[string]*nomad.Service, error) {
+	instances := make(map[string]*nomad.Service)
+	for _, name := range names {
+		var entries []catalogEntry
+		if _, err := c.get(ctx, "/v1/catalog/service/"+url.PathEscape(name), 0, &entries); err != nil {
+			return nil, fmt.Errorf("failed to get instances of service %s from Consul: %w", name, err)
+		}
+		for i := range entries {
+			svc := toService(&entries[i])
+			instances[instanceKey(svc)] = svc
+		}
+	}
+	return instances, nil
+}
+
+// toService converts a catalog entry into the service structure of Nomad native services
+func toService(entry *catalogEntry) *nomad.Service {
+	address := entry.ServiceAddress
+	if address == "" {
+		address = entry.Address
+	}
+	return &nomad.Service{
+		// Service IDs are unique per node only
+		ID:          entry.Node + "/" + entry.ServiceID,
+		ServiceName: entry.ServiceName,
+		Namespace:   entry.Namespace,
+		NodeID:      entry.ID,
+		Datacenter:  entry.Datacenter,
+		AllocID:     nomadAllocID(entry.ServiceID),
+		Tags:        entry.ServiceTags,
+		Address:     address,
+		Port:        entry.ServicePort,
+		Meta:        entry.ServiceMeta,
+		CreateIndex: entry.CreateIndex,
+		ModifyIndex: entry.ModifyIndex,
+	}
+}
+
+// nomadAllocID returns the allocation of a service Nomad registered in Consul, "" for other services
+func nomadAllocID(serviceID string) string {
+	rest, ok := strings.CutPrefix(serviceID, nomadServiceIDPrefix)
+	if !ok || len(rest) < allocIDLength {
+		return ""
+	}
+	return rest[:allocIDLength]
+}
+
+func instanceKey(svc *nomad.Service) string {
+	return svc.ServiceName + "/" + svc.ID
+}
+
+func hasHAProxyTag(tags []string) bool {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, tagPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// get decodes the response of a GET request into out and returns the X-Consul-Index. With an index
+// the request is a blocking query.
+func (c *Client) get(ctx context.Context, path string, index uint64, out interface{}) (uint64, error) {
+	query := url.Values{}
+	if c.datacenter != "" {
+		query.Set("dc", c.datacenter)
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(c.wait.Seconds())))
+	}
+	requestURL := c.address + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, http.NoBody)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create Consul request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("consul request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, fmt.Errorf("failed to decode Consul response: %w", err)
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return newIndex, nil
+}
+
+func sortedKeys(instances map[string]*nomad.Service) []string {
+	keys := make([]string, 0, len(instances))
+	for key := range instances {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
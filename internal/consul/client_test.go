@@ -0,0 +1,226 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// fakeCatalog serves the catalog endpoints, blocking queries wait for the next change
+type fakeCatalog struct {
+	mu      sync.Mutex
+	index   uint64
+	entries map[string][]catalogEntry
+	changed chan struct{}
+}
+
+func newFakeCatalog(t *testing.T, entries map[string][]catalogEntry) (*fakeCatalog, *Client) {
+	t.Helper()
+	catalog := &fakeCatalog{index: 10, entries: entries, changed: make(chan struct{})}
+	server := httptest.NewServer(catalog)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, "secret", "", log.New(io.Discard, "", 0))
+	client.wait = time.Second
+	return catalog, client
+}
+
+func (f *fakeCatalog) set(service string, entries []catalogEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[service] = entries
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != "secret" {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index >= f.index {
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		f.mu.Lock()
+	}
+	defer f.mu.Unlock()
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	if name, ok := strings.CutPrefix(r.URL.Path, "/v1/catalog/service/"); ok {
+		_ = json.NewEncoder(w).Encode(f.entries[name])
+		return
+	}
+	services := make(map[string][]string)
+	for name, entries := range f.entries {
+		for i := range entries {
+			services[name] = append(services[name], entries[i].ServiceTags...)
+		}
+	}
+	_ = json.NewEncoder(w).Encode(services)
+}
+
+func webEntry(node, address string, port int, modifyIndex uint64) catalogEntry {
+	return catalogEntry{
+		ID:          node + "-id",
+		Node:        node,
+		Address:     address,
+		ServiceID:   "_nomad-task-0b4a5c3e-1111-2222-3333-444455556666-web-web-http",
+		ServiceName: "web",
+		ServiceTags: []string{"haproxy.enable=true"},
+		ServicePort: port,
+		ModifyIndex: modifyIndex,
+	}
+}
+
+func TestGetServices(t *testing.T) {
+	withServiceAddress := webEntry("node-2", "192.0.2.2", 8080, 5)
+	withServiceAddress.ServiceAddress = "10.0.0.2"
+	_, client := newFakeCatalog(t, map[string][]catalogEntry{
+		"web":   {webEntry("node-1", "192.0.2.1", 8080, 5), withServiceAddress},
+		"other": {{Node: "node-1", ServiceID: "other", ServiceName: "other", ServiceTags: []string{"metrics"}}},
+	})
+
+	services, err := client.GetServices()
+	require.NoError(t, err)
+	require.Len(t, services, 2, "services without haproxy.* tags are not discovered")
+
+	assert.Equal(t, "node-1/_nomad-task-0b4a5c3e-1111-2222-3333-444455556666-web-web-http", services[0].ID)
+	assert.Equal(t, "0b4a5c3e-1111-2222-3333-444455556666", services[0].AllocID)
+	assert.Equal(t, "node-1-id", services[0].NodeID)
+	assert.Equal(t, "192.0.2.1", services[0].Address, "the node address is used without service address")
+	assert.Equal(t, "10.0.0.2", services[1].Address)
+	assert.Equal(t, 8080, services[1].Port)
+}
+
+func TestNomadAllocID(t *testing.T) {
+	assert.Equal(t, "0b4a5c3e-1111-2222-3333-444455556666",
+		nomadAllocID("_nomad-task-0b4a5c3e-1111-2222-3333-444455556666-group-web-web-http"))
+	assert.Equal(t, "", nomadAllocID("web-1"))
+	assert.Equal(t, "", nomadAllocID("_nomad-task-short"))
+}
+
+func TestChangeEvents(t *testing.T) {
+	service := func(id, address string, port int, modifyIndex uint64) *nomad.Service {
+		return &nomad.Service{ID: id, ServiceName: "web", Address: address, Port: port, ModifyIndex: modifyIndex}
+	}
+	known := map[string]*nomad.Service{
+		"web/removed":   service("removed", "10.0.0.1", 80, 1),
+		"web/moved":     service("moved", "10.0.0.2", 80, 1),
+		"web/retagged":  service("retagged", "10.0.0.3", 80, 1),
+		"web/unchanged": service("unchanged", "10.0.0.4", 80, 1),
+	}
+	current := map[string]*nomad.Service{
+		"web/added":     service("added", "10.0.0.5", 80, 7),
+		"web/moved":     service("moved", "10.0.0.9", 80, 7),
+		"web/retagged":  service("retagged", "10.0.0.3", 80, 7),
+		"web/unchanged": service("unchanged", "10.0.0.4", 80, 1),
+	}
+
+	var got []string
+	for _, event := range changeEvents(known, current, 7) {
+		assert.Equal(t, uint64(7), event.Index)
+		got = append(got, event.Type+" "+event.Payload.Service.ID+" "+event.Payload.Service.Address)
+	}
+	assert.Equal(t, []string{
+		"ServiceDeregistration moved 10.0.0.2",
+		"ServiceDeregistration removed 10.0.0.1",
+		"ServiceRegistration added 10.0.0.5",
+		"ServiceRegistration moved 10.0.0.9",
+		"ServiceRegistration retagged 10.0.0.3",
+	}, got)
+}
+
+func TestStreamServiceEvents(t *testing.T) {
+	catalog, client := newFakeCatalog(t, map[string][]catalogEntry{
+		"web": {webEntry("node-1", "10.0.0.1", 8080, 5)},
+	})
+	var statuses []error
+	var statusMu sync.Mutex
+	client.SetStreamStatusHandler(func(err error) {
+		statusMu.Lock()
+		defer statusMu.Unlock()
+		statuses = append(statuses, err)
+	})
+
+	_, err := client.GetServices()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := make(chan nomad.ServiceEvent, 10)
+	go func() { _ = client.StreamServiceEvents(ctx, events) }()
+
+	// Wait for the blocking query before changing the catalog
+	require.Eventually(t, func() bool { return !client.LastActivity().IsZero() }, 5*time.Second, 10*time.Millisecond)
+	second := webEntry("node-2", "10.0.0.2", 8080, 11)
+	second.ServiceID = "web-2"
+	catalog.set("web", []catalogEntry{webEntry("node-1", "10.0.0.1", 8080, 5), second})
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "ServiceRegistration", event.Type)
+		assert.Equal(t, "10.0.0.2", event.Payload.Service.Address)
+	case <-ctx.Done():
+		t.Fatal("Expected a registration event for the added instance")
+	}
+
+	catalog.set("web", []catalogEntry{second})
+	select {
+	case event := <-events:
+		assert.Equal(t, "ServiceDeregistration", event.Type)
+		assert.Equal(t, "10.0.0.1", event.Payload.Service.Address)
+	case <-ctx.Done():
+		t.Fatal("Expected a deregistration event for the removed instance")
+	}
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	assert.Equal(t, []error{nil}, statuses)
+}
+
+func TestStreamServiceEventsReportsFailures(t *testing.T) {
+	_, client := newFakeCatalog(t, map[string][]catalogEntry{})
+	client.token = "wrong"
+
+	failed := make(chan error, 1)
+	client.SetStreamStatusHandler(func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.StreamServiceEvents(ctx, make(chan nomad.ServiceEvent)) }()
+
+	select {
+	case err := <-failed:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "status 403")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the failed query to be reported")
+	}
+}
@@ -0,0 +1,42 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ExecProvider runs a command for every record change. The command gets the change as arguments
+// (<action> <domain> <type> <target>) and as DNS_ACTION, DNS_DOMAIN, DNS_TYPE and DNS_TARGET variables.
+type ExecProvider struct {
+	command string
+	timeout time.Duration
+}
+
+// NewExecProvider creates a provider running command
+func NewExecProvider(command string, timeout time.Duration) *ExecProvider {
+	return &ExecProvider{command: command, timeout: timeout}
+}
+
+func (p *ExecProvider) Apply(ctx context.Context, record Record) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.command, record.Action, record.Domain, record.Type, record.Target)
+	cmd.Env = append(os.Environ(),
+		"DNS_ACTION="+record.Action,
+		"DNS_DOMAIN="+record.Domain,
+		"DNS_TYPE="+record.Type,
+		"DNS_TARGET="+record.Target,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("DNS command failed to %s %s record for %s: %w: %s",
+			record.Action, record.Type, record.Domain, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
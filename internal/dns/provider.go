@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// Supported DNS providers
+const (
+	ProviderWebhook = "webhook"
+	ProviderExec    = "exec"
+)
+
+// Record changes passed to providers
+const (
+	ActionCreate = "create"
+	ActionDelete = "delete"
+)
+
+// Supported record types
+const (
+	RecordTypeA     = "A"
+	RecordTypeCNAME = "CNAME"
+)
+
+// Record describes a DNS record to create or delete: Domain points at Target, an IP address for
+// A records or a hostname for CNAME records
+type Record struct {
+	Action string `json:"action"`
+	Domain string `json:"domain"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// Provider creates and deletes DNS records in an external DNS system
+type Provider interface {
+	Apply(ctx context.Context, record Record) error
+}
+
+// NewProvider creates the provider selected by the DNS configuration
+func NewProvider(cfg *config.DNSConfig) (Provider, error) {
+	if cfg.Target == "" {
+		return nil, fmt.Errorf("no DNS target configured for the records to point at")
+	}
+	if cfg.RecordType != RecordTypeA && cfg.RecordType != RecordTypeCNAME {
+		return nil, fmt.Errorf("unsupported DNS record type %q (expected A or CNAME)", cfg.RecordType)
+	}
+
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultDNSTimeoutSec * time.Second
+	}
+
+	switch cfg.Provider {
+	case ProviderWebhook, "":
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("no webhook URL configured for the DNS webhook provider")
+		}
+		return NewWebhookProvider(cfg.WebhookURL, timeout), nil
+	case ProviderExec:
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("no command configured for the DNS exec provider")
+		}
+		return NewExecProvider(cfg.Command, timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown DNS provider %q (expected webhook or exec)", cfg.Provider)
+	}
+}
@@ -0,0 +1,103 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.DNSConfig
+		wantErr string
+	}{
+		{name: "webhook", cfg: config.DNSConfig{WebhookURL: "http://dns", RecordType: "A", Target: "192.0.2.1"}},
+		{name: "exec", cfg: config.DNSConfig{Provider: "exec", Command: "/bin/true", RecordType: "CNAME", Target: "lb.example.com"}},
+		{name: "no target", cfg: config.DNSConfig{WebhookURL: "http://dns", RecordType: "A"}, wantErr: "target"},
+		{name: "bad record type", cfg: config.DNSConfig{WebhookURL: "http://dns", RecordType: "MX", Target: "lb"}, wantErr: "record type"},
+		{name: "no webhook url", cfg: config.DNSConfig{RecordType: "A", Target: "192.0.2.1"}, wantErr: "webhook URL"},
+		{name: "no command", cfg: config.DNSConfig{Provider: "exec", RecordType: "A", Target: "192.0.2.1"}, wantErr: "command"},
+		{name: "unknown provider", cfg: config.DNSConfig{Provider: "route53", RecordType: "A", Target: "192.0.2.1"}, wantErr: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewProvider(&tt.cfg)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("NewProvider() failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWebhookProvider(t *testing.T) {
+	var received Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Failed to decode record: %v", err)
+		}
+		if received.Domain == "broken.example.com" {
+			http.Error(w, "zone not found", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewWebhookProvider(server.URL, time.Second)
+	record := Record{Action: ActionCreate, Domain: "app.example.com", Type: RecordTypeA, Target: "192.0.2.1"}
+	if err := provider.Apply(context.Background(), record); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	if received != record {
+		t.Errorf("Expected %+v, got %+v", record, received)
+	}
+
+	record.Domain = "broken.example.com"
+	if err := provider.Apply(context.Background(), record); err == nil || !strings.Contains(err.Error(), "zone not found") {
+		t.Errorf("Expected webhook error, got %v", err)
+	}
+}
+
+func TestExecProvider(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "dns.sh")
+	content := "#!/bin/sh\necho \"$@ $DNS_ACTION $DNS_DOMAIN $DNS_TYPE $DNS_TARGET\" >> " + output + "\n" +
+		"[ \"$DNS_DOMAIN\" != broken.example.com ] || { echo no such zone; exit 1; }\n"
+	if err := os.WriteFile(script, []byte(content), 0o700); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	provider := NewExecProvider(script, time.Second)
+	record := Record{Action: ActionDelete, Domain: "app.example.com", Type: RecordTypeCNAME, Target: "lb.example.com"}
+	if err := provider.Apply(context.Background(), record); err != nil {
+		t.Fatalf("Apply() failed: %v", err)
+	}
+	calls, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Failed to read calls: %v", err)
+	}
+	expected := "delete app.example.com CNAME lb.example.com delete app.example.com CNAME lb.example.com\n"
+	if string(calls) != expected {
+		t.Errorf("Expected arguments and environment %q, got %q", expected, calls)
+	}
+
+	record.Domain = "broken.example.com"
+	if err := provider.Apply(context.Background(), record); err == nil || !strings.Contains(err.Error(), "no such zone") {
+		t.Errorf("Expected command output in error, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookProvider posts record changes as JSON to an HTTP endpoint that manages the records
+type WebhookProvider struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewWebhookProvider creates a provider posting to url
+func NewWebhookProvider(url string, timeout time.Duration) *WebhookProvider {
+	return &WebhookProvider{
+		url:        url,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *WebhookProvider) Apply(ctx context.Context, record Record) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal DNS record: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create DNS webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("DNS webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("DNS webhook failed to %s %s record for %s: status %d: %s",
+			record.Action, record.Type, record.Domain, resp.StatusCode, string(body))
+	}
+	return nil
+}
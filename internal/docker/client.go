@@ -0,0 +1,405 @@
+// Package docker discovers the containers of a Docker or Podman host with haproxy.* labels. Its
+// client implements the same discovery interface as the Nomad client, so the containers are
+// handled by the connector like Nomad services.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+const (
+	// DefaultHost is the Engine API socket of Docker, Podman serves the same API at unix:///run/podman/podman.sock
+	DefaultHost = "unix:///var/run/docker.sock"
+
+	// DefaultRequestTimeoutSec bounds the Engine API requests, except the event stream
+	DefaultRequestTimeoutSec = 10
+
+	// Labels read by the source, the other haproxy.* labels are passed on as tags
+	ServiceLabel = "haproxy.service" // Service name (default: the container name)
+	PortLabel    = "haproxy.port"    // Container port (default: the only or lowest exposed port)
+
+	enableLabel = "haproxy.enable=true"
+	tagPrefix   = "haproxy."
+)
+
+// Client watches the containers of a Docker or Podman host
+type Client struct {
+	baseURL     string
+	hostAddress string
+	httpClient  *http.Client // requests, bounded by DefaultRequestTimeoutSec
+	streamHTTP  *http.Client // the event stream, without timeout
+	logger      *log.Logger
+
+	mu    sync.Mutex
+	known map[string]*nomad.Service // running containers with haproxy.enable=true, by container ID
+}
+
+var _ nomad.NomadClient = (*Client)(nil)
+
+// NewClient creates a client for the Engine API at host (unix:///path or tcp://host:port). Published
+// ports are reached at hostAddress; without it or without published port, the container address is used.
+func NewClient(host, hostAddress string, logger *log.Logger) (*Client, error) {
+	transport := &http.Transport{}
+	baseURL := ""
+	switch {
+	case strings.HasPrefix(host, "unix://"):
+		socket := strings.TrimPrefix(host, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		baseURL = "http://docker"
+	case strings.HasPrefix(host, "tcp://"):
+		baseURL = "http://" + strings.TrimPrefix(host, "tcp://")
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q (expected unix:// or tcp://)", host)
+	}
+
+	return &Client{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		hostAddress: hostAddress,
+		httpClient:  &http.Client{Transport: transport, Timeout: DefaultRequestTimeoutSec * time.Second},
+		streamHTTP:  &http.Client{Transport: transport},
+		logger:      logger,
+		known:       make(map[string]*nomad.Service),
+	}, nil
+}
+
+// GetServices gets the running containers with haproxy.enable=true
+func (c *Client) GetServices() ([]*nomad.Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeoutSec*time.Second)
+	defer cancel()
+
+	containers, err := c.listContainers(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.known = containers
+	c.mu.Unlock()
+
+	services := make([]*nomad.Service, 0, len(containers))
+	for _, id := range sortedKeys(containers) {
+		services = append(services, containers[id])
+	}
+	return services, nil
+}
+
+// GetServiceCheckFromJob returns no check, the checks of containers are configured with the
+// haproxy.check.* labels
+func (c *Client) GetServiceCheckFromJob(_, _ string) (*nomad.ServiceCheck, error) {
+	return nil, nil
+}
+
+// StreamServiceEvents reports started containers as service registrations and stopped ones as
+// deregistrations. Changes missed while the event stream was disconnected are reported after reconnecting.
+func (c *Client) StreamServiceEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	for {
+		err := c.streamEvents(ctx, eventChan)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.logger.Printf("Docker event stream error: %v", err)
+		c.logger.Printf("Reconnecting in %d seconds...", nomad.StreamReconnectDelaySec)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(nomad.StreamReconnectDelaySec * time.Second):
+		}
+	}
+}
+
+// containerEvent is an entry of the Engine API event stream
+type containerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID string `json:"ID"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+func (c *Client) streamEvents(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	filters, _ := json.Marshal(map[string][]string{
+		"type":  {"container"},
+		"event": {"start", "die"},
+		"label": {enableLabel},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/events?filters="+url.QueryEscape(string(filters)), http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.streamHTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to event stream: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("event stream returned status %d", resp.StatusCode)
+	}
+	c.logger.Printf("Connected to Docker event stream")
+
+	// Subscribed first, so nothing is missed between catching up and the first event
+	if err := c.catchUp(ctx, eventChan); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event containerEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("event stream ended")
+			}
+			return fmt.Errorf("failed to read event stream: %w", err)
+		}
+		if err := c.handleEvent(ctx, &event, eventChan); err != nil {
+			return err
+		}
+	}
+}
+
+// catchUp reports the containers that started or stopped since the containers were last listed
+func (c *Client) catchUp(ctx context.Context, eventChan chan<- nomad.ServiceEvent) error {
+	listCtx, cancel := context.WithTimeout(ctx, DefaultRequestTimeoutSec*time.Second)
+	defer cancel()
+	containers, err := c.listContainers(listCtx, "")
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	known := c.known
+	c.known = containers
+	c.mu.Unlock()
+
+	index := uint64(time.Now().UnixNano())
+	for _, id := range sortedKeys(known) {
+		if current, ok := containers[id]; !ok || current.Address != known[id].Address || current.Port != known[id].Port {
+			if err := send(ctx, eventChan, "ServiceDeregistration", known[id], index); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range sortedKeys(containers) {
+		if previous, ok := known[id]; !ok || previous.Address != containers[id].Address || previous.Port != containers[id].Port {
+			if err := send(ctx, eventChan, "ServiceRegistration", containers[id], index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleEvent turns a container start into a registration and a stop into a deregistration
+func (c *Client) handleEvent(ctx context.Context, event *containerEvent, eventChan chan<- nomad.ServiceEvent) error {
+	index := uint64(event.TimeNano)
+	switch event.Action {
+	case "start":
+		listCtx, cancel := context.WithTimeout(ctx, DefaultRequestTimeoutSec*time.Second)
+		containers, err := c.listContainers(listCtx, event.Actor.ID)
+		cancel()
+		if err != nil {
+			c.logger.Printf("Warning: Failed to get started container %s: %v", event.Actor.ID, err)
+			return nil
+		}
+		svc, ok := containers[event.Actor.ID]
+		if !ok {
+			return nil
+		}
+		c.mu.Lock()
+		c.known[event.Actor.ID] = svc
+		c.mu.Unlock()
+		return send(ctx, eventChan, "ServiceRegistration", svc, index)
+	case "die":
+		c.mu.Lock()
+		svc, ok := c.known[event.Actor.ID]
+		delete(c.known, event.Actor.ID)
+		c.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		return send(ctx, eventChan, "ServiceDeregistration", svc, index)
+	}
+	return nil
+}
+
+func send(ctx context.Context, eventChan chan<- nomad.ServiceEvent, eventType string, svc *nomad.Service, index uint64) error {
+	event := nomad.ServiceEvent{Type: eventType, Topic: "Service", Index: index, Payload: nomad.Payload{Service: svc}}
+	select {
+	case eventChan <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// container is an entry of /containers/json
+type container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []struct {
+		IP          string `json:"IP"`
+		PrivatePort int    `json:"PrivatePort"`
+		PublicPort  int    `json:"PublicPort"`
+		Type        string `json:"Type"`
+	} `json:"Ports"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// listContainers gets the running containers with haproxy.enable=true, all or the one with the given ID
+func (c *Client) listContainers(ctx context.Context, id string) (map[string]*nomad.Service, error) {
+	filter := map[string][]string{"label": {enableLabel}, "status": {"running"}}
+	if id != "" {
+		filter["id"] = []string{id}
+	}
+	filters, _ := json.Marshal(filter)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/containers/json?filters="+url.QueryEscape(string(filters)), http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to list containers: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var list []container
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode containers: %w", err)
+	}
+
+	services := make(map[string]*nomad.Service, len(list))
+	for i := range list {
+		svc, err := c.toService(&list[i])
+		if err != nil {
+			c.logger.Printf("Warning: Skipping container %s: %v", containerName(&list[i]), err)
+			continue
+		}
+		services[list[i].ID] = svc
+	}
+	return services, nil
+}
+
+// toService converts a container into the service structure of Nomad native services
+func (c *Client) toService(ctr *container) (*nomad.Service, error) {
+	address, port, err := c.endpoint(ctr)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := ctr.Labels[ServiceLabel]
+	if serviceName == "" {
+		serviceName = containerName(ctr)
+	}
+	var tags []string
+	for key, value := range ctr.Labels {
+		if strings.HasPrefix(key, tagPrefix) && key != ServiceLabel && key != PortLabel {
+			tags = append(tags, key+"="+value)
+		}
+	}
+	sort.Strings(tags)
+
+	return &nomad.Service{
+		ID:          ctr.ID,
+		ServiceName: serviceName,
+		// The container ID correlates address changes of a restarted container, like an allocation
+		AllocID: ctr.ID,
+		Tags:    tags,
+		Address: address,
+		Port:    port,
+	}, nil
+}
+
+// endpoint returns the address HAProxy reaches the container at: the published port at the host
+// address, or the container address and port
+func (c *Client) endpoint(ctr *container) (string, int, error) {
+	wanted := 0
+	if label := ctr.Labels[PortLabel]; label != "" {
+		port, err := strconv.Atoi(label)
+		if err != nil || port < 1 || port > 65535 {
+			return "", 0, fmt.Errorf("invalid %s label %q", PortLabel, label)
+		}
+		wanted = port
+	}
+
+	privatePort, publicPort := 0, 0
+	for _, p := range ctr.Ports {
+		if p.Type != "" && p.Type != "tcp" {
+			continue
+		}
+		if wanted != 0 && p.PrivatePort != wanted {
+			continue
+		}
+		if privatePort == 0 || p.PrivatePort < privatePort || (p.PrivatePort == privatePort && publicPort == 0) {
+			privatePort, publicPort = p.PrivatePort, p.PublicPort
+		}
+	}
+	if privatePort == 0 {
+		privatePort = wanted
+	}
+	if privatePort == 0 {
+		return "", 0, fmt.Errorf("no exposed port, set the %s label", PortLabel)
+	}
+
+	if publicPort != 0 && c.hostAddress != "" {
+		return c.hostAddress, publicPort, nil
+	}
+	for _, name := range sortedNetworks(ctr) {
+		if address := ctr.NetworkSettings.Networks[name].IPAddress; address != "" {
+			return address, privatePort, nil
+		}
+	}
+	return "", 0, fmt.Errorf("no container address and no published port at docker.host_address")
+}
+
+func containerName(ctr *container) string {
+	if len(ctr.Names) == 0 {
+		return ctr.ID
+	}
+	return strings.TrimPrefix(ctr.Names[0], "/")
+}
+
+func sortedNetworks(ctr *container) []string {
+	names := make([]string, 0, len(ctr.NetworkSettings.Networks))
+	for name := range ctr.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(services map[string]*nomad.Service) []string {
+	keys := make([]string, 0, len(services))
+	for key := range services {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,188 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// fakeEngine serves the container list and an event stream fed by the test
+type fakeEngine struct {
+	mu         sync.Mutex
+	containers []map[string]interface{}
+	events     chan string
+}
+
+func newFakeEngine(t *testing.T, hostAddress string, containers ...map[string]interface{}) (*fakeEngine, *Client) {
+	t.Helper()
+	engine := &fakeEngine{containers: containers, events: make(chan string, 10)}
+	server := httptest.NewServer(engine)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient("tcp://"+strings.TrimPrefix(server.URL, "http://"), hostAddress, log.New(io.Discard, "", 0))
+	require.NoError(t, err)
+	return engine, client
+}
+
+func (e *fakeEngine) setContainers(containers ...map[string]interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.containers = containers
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var filters map[string][]string
+	_ = json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+
+	switch r.URL.Path {
+	case "/containers/json":
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		list := []map[string]interface{}{}
+		for _, ctr := range e.containers {
+			if ids := filters["id"]; len(ids) == 0 || ids[0] == ctr["Id"] {
+				list = append(list, ctr)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	case "/events":
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case event := <-e.events:
+				fmt.Fprintln(w, event)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func testContainer(id, name, ip string, labels map[string]string, ports ...map[string]interface{}) map[string]interface{} {
+	allLabels := map[string]string{"haproxy.enable": "true"}
+	for key, value := range labels {
+		allLabels[key] = value
+	}
+	return map[string]interface{}{
+		"Id":              id,
+		"Names":           []string{"/" + name},
+		"Labels":          allLabels,
+		"Ports":           ports,
+		"NetworkSettings": map[string]interface{}{"Networks": map[string]interface{}{"bridge": map[string]string{"IPAddress": ip}}},
+	}
+}
+
+func port(private, public int) map[string]interface{} {
+	return map[string]interface{}{"PrivatePort": private, "PublicPort": public, "Type": "tcp"}
+}
+
+func TestGetServices(t *testing.T) {
+	_, client := newFakeEngine(t, "192.0.2.10",
+		testContainer("c1", "blog", "172.17.0.2", map[string]string{"haproxy.domain": "blog.example.com", "com.example.team": "web"}, port(80, 0)),
+		testContainer("c2", "shop-1", "172.17.0.3", map[string]string{ServiceLabel: "shop", PortLabel: "8080"}, port(9090, 0), port(8080, 32768)),
+		testContainer("c3", "worker", "172.17.0.4", nil),
+	)
+
+	services, err := client.GetServices()
+	require.NoError(t, err)
+	require.Len(t, services, 2, "containers without port are skipped")
+
+	blog := services[0]
+	assert.Equal(t, "blog", blog.ServiceName)
+	assert.Equal(t, "c1", blog.AllocID)
+	assert.Equal(t, "172.17.0.2", blog.Address, "unpublished ports are reached at the container address")
+	assert.Equal(t, 80, blog.Port)
+	assert.Equal(t, []string{"haproxy.domain=blog.example.com", "haproxy.enable=true"}, blog.Tags)
+
+	shop := services[1]
+	assert.Equal(t, "shop", shop.ServiceName)
+	assert.Equal(t, "192.0.2.10", shop.Address, "published ports are reached at the host address")
+	assert.Equal(t, 32768, shop.Port)
+	assert.Equal(t, []string{"haproxy.enable=true"}, shop.Tags)
+}
+
+func TestEndpointWithoutHostAddress(t *testing.T) {
+	_, client := newFakeEngine(t, "")
+	var ctr container
+	raw, _ := json.Marshal(testContainer("c1", "shop", "172.17.0.3", nil, port(8080, 32768)))
+	require.NoError(t, json.Unmarshal(raw, &ctr))
+
+	address, port, err := client.endpoint(&ctr)
+	require.NoError(t, err)
+	assert.Equal(t, "172.17.0.3", address)
+	assert.Equal(t, 8080, port)
+
+	ctr.Labels[PortLabel] = "http"
+	_, _, err = client.endpoint(&ctr)
+	assert.Error(t, err)
+}
+
+func TestNewClientRejectsUnknownHost(t *testing.T) {
+	_, err := NewClient("ssh://host", "", log.New(io.Discard, "", 0))
+	assert.Error(t, err)
+}
+
+func TestStreamServiceEvents(t *testing.T) {
+	engine, client := newFakeEngine(t, "",
+		testContainer("c1", "blog", "172.17.0.2", nil, port(80, 0)),
+		testContainer("c2", "old", "172.17.0.5", nil, port(80, 0)),
+	)
+	_, err := client.GetServices()
+	require.NoError(t, err)
+
+	// c2 stopped while the stream wasn't connected
+	engine.setContainers(testContainer("c1", "blog", "172.17.0.2", nil, port(80, 0)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := make(chan nomad.ServiceEvent, 10)
+	go func() { _ = client.StreamServiceEvents(ctx, events) }()
+
+	next := func() nomad.ServiceEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-ctx.Done():
+			t.Fatal("Expected an event")
+			return nomad.ServiceEvent{}
+		}
+	}
+
+	missed := next()
+	assert.Equal(t, "ServiceDeregistration", missed.Type)
+	assert.Equal(t, "old", missed.Payload.Service.ServiceName)
+
+	engine.setContainers(
+		testContainer("c1", "blog", "172.17.0.2", nil, port(80, 0)),
+		testContainer("c3", "api", "172.17.0.6", nil, port(3000, 0)),
+	)
+	engine.events <- `{"Type":"container","Action":"start","Actor":{"ID":"c3"},"timeNano":100}`
+	started := next()
+	assert.Equal(t, "ServiceRegistration", started.Type)
+	assert.Equal(t, "api", started.Payload.Service.ServiceName)
+	assert.Equal(t, uint64(100), started.Index)
+
+	engine.events <- `{"Type":"container","Action":"die","Actor":{"ID":"c1"},"timeNano":200}`
+	stopped := next()
+	assert.Equal(t, "ServiceDeregistration", stopped.Type)
+	assert.Equal(t, "blog", stopped.Payload.Service.ServiceName)
+	assert.Equal(t, "172.17.0.2", stopped.Payload.Service.Address)
+}
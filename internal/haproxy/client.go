@@ -4,15 +4,29 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
+	"github.com/pscheit/haproxy-nomad-connector/internal/tracing"
 )
 
+// clientLog is the structured logger of the Data Plane API clients
+var clientLog = logging.Logger(logging.ModuleHAProxy)
+
 const (
 	HTTPMethodGET    = "GET"
 	HTTPMethodPOST   = "POST"
@@ -22,29 +36,199 @@ const (
 
 // Client configuration constants
 const (
-	DefaultClientTimeoutSec  = 10
-	HTTPStatusClientErrorMin = 400
+	DefaultClientTimeoutSec      = 10
+	DefaultCommitTimeoutSec      = 60
+	DefaultIdleConnTimeoutSec    = 90
+	DefaultMaxIdleConns          = 10
+	DefaultRetryAttempts         = 3
+	DefaultMaxRetryAfterSec      = 30
+	DefaultRetryBackoffMs        = 200
+	DefaultMaxRetryBackoffMs     = 5000
+	HTTPStatusClientErrorMin     = 400
+	HTTPHeaderRetryAfter         = "Retry-After"
+	DefaultRetryAfterFallbackSec = 1
 )
 
+// ClientOptions tunes the HTTP connection to the Data Plane API. Zero durations and
+// connection limits fall back to the defaults.
+type ClientOptions struct {
+	Timeout           time.Duration // Timeout of regular requests
+	CommitTimeout     time.Duration // Timeout of transaction commits, which reload HAProxy
+	DisableKeepAlives bool          // Open a new connection for every request
+	IdleConnTimeout   time.Duration // How long idle keep-alive connections are kept open
+	MaxIdleConns      int           // Idle keep-alive connections kept open
+	RetryAttempts     int           // Retries of failed requests (network errors, 5xx, 409 version conflicts, 429)
+	MaxRetryAfter     time.Duration // Upper bound for the wait requested via Retry-After
+	RetryBackoff      time.Duration // Wait before the first retry, doubled with every further retry
+	MaxRetryBackoff   time.Duration // Upper bound for the exponential backoff
+	TLSConfig         *tls.Config   // TLS settings of https endpoints, e.g. a client certificate for mutual TLS (nil = defaults)
+
+	// Stats socket of the HAProxy behind the Data Plane API for server state changes (empty = none),
+	// used as RuntimeModeFallback (default) or RuntimeModePrefer
+	RuntimeSocket  string
+	RuntimeMode    string
+	RuntimeTimeout time.Duration
+
+	// Read-only credentials used for GET requests; mutations keep using the read-write credentials.
+	// Empty credentials fall back to the read-write ones.
+	ReadUsername string
+	ReadPassword string
+}
+
+// DefaultClientOptions returns the options used by NewClient
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Timeout:         DefaultClientTimeoutSec * time.Second,
+		CommitTimeout:   DefaultCommitTimeoutSec * time.Second,
+		IdleConnTimeout: DefaultIdleConnTimeoutSec * time.Second,
+		MaxIdleConns:    DefaultMaxIdleConns,
+		RetryAttempts:   DefaultRetryAttempts,
+		MaxRetryAfter:   DefaultMaxRetryAfterSec * time.Second,
+		RetryBackoff:    DefaultRetryBackoffMs * time.Millisecond,
+		MaxRetryBackoff: DefaultMaxRetryBackoffMs * time.Millisecond,
+	}
+}
+
 type Client struct {
-	baseURL    string
-	username   string
-	password   string
-	httpClient *http.Client
+	baseURL         string
+	credentials     *credentials // shared by the views of WithContext
+	httpClient      *http.Client
+	commitClient    *http.Client
+	retryAttempts   int
+	maxRetryAfter   time.Duration
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	runtime         *RuntimeClient // stats socket, nil without
+	runtimeMode     string
+	ctx             context.Context // of the caller, carries its trace; nil outside WithContext views
+}
+
+// credentials authenticate the requests of a client, they may rotate
+type credentials struct {
+	mu           sync.RWMutex
+	username     string
+	password     string
+	readUsername string
+	readPassword string
 }
 
 // NewClient creates a new HAProxy Data Plane API client
 func NewClient(baseURL, username, password string) *Client {
-	return &Client{
-		baseURL:  baseURL,
-		username: username,
-		password: password,
+	return NewClientWithOptions(baseURL, username, password, DefaultClientOptions())
+}
+
+// NewClientWithOptions creates a new HAProxy Data Plane API client with tuned HTTP connection settings.
+// baseURL is an http(s) URL or a unix:// socket path.
+func NewClientWithOptions(baseURL, username, password string, opts ClientOptions) *Client {
+	defaults := DefaultClientOptions()
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.CommitTimeout <= 0 {
+		opts.CommitTimeout = defaults.CommitTimeout
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaults.RetryBackoff
+	}
+	if opts.MaxRetryBackoff <= 0 {
+		opts.MaxRetryBackoff = defaults.MaxRetryBackoff
+	}
+	if opts.ReadUsername == "" {
+		opts.ReadUsername, opts.ReadPassword = username, password
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = opts.DisableKeepAlives
+	transport.IdleConnTimeout = opts.IdleConnTimeout
+	transport.MaxIdleConns = opts.MaxIdleConns
+	// All requests go to the same Data Plane API host
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConns
+	if opts.TLSConfig != nil {
+		transport.TLSClientConfig = opts.TLSConfig
+	}
+	if socketPath, ok := unixSocketPath(baseURL); ok {
+		dialUnixSocket(transport, socketPath)
+		baseURL = unixSocketBaseURL
+	}
+
+	client := &Client{
+		baseURL: baseURL,
+		credentials: &credentials{
+			username:     username,
+			password:     password,
+			readUsername: opts.ReadUsername,
+			readPassword: opts.ReadPassword,
+		},
 		httpClient: &http.Client{
-			Timeout: DefaultClientTimeoutSec * time.Second,
+			Timeout:   opts.Timeout,
+			Transport: transport,
+		},
+		commitClient: &http.Client{
+			Timeout:   opts.CommitTimeout,
+			Transport: transport,
 		},
+		retryAttempts:   max(opts.RetryAttempts, 0),
+		maxRetryAfter:   opts.MaxRetryAfter,
+		retryBackoff:    opts.RetryBackoff,
+		maxRetryBackoff: opts.MaxRetryBackoff,
+	}
+	if opts.RuntimeSocket != "" {
+		client.runtime = NewRuntimeClient(opts.RuntimeSocket, opts.RuntimeTimeout)
+		client.runtimeMode = opts.RuntimeMode
+		if client.runtimeMode == "" {
+			client.runtimeMode = RuntimeModeFallback
+		}
+	}
+	return client
+}
+
+// SetCredentials replaces the credentials of the client, e.g. after they were rotated. Empty
+// read-only credentials fall back to the read-write ones.
+func (c *Client) SetCredentials(username, password, readUsername, readPassword string) {
+	if readUsername == "" {
+		readUsername, readPassword = username, password
+	}
+	c.credentials.mu.Lock()
+	defer c.credentials.mu.Unlock()
+	c.credentials.username, c.credentials.password = username, password
+	c.credentials.readUsername, c.credentials.readPassword = readUsername, readPassword
+}
+
+// WithContext returns a view of the client whose requests belong to ctx: they are traced as children
+// of the span in ctx and carry its trace context. The view shares connections and credentials.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	view := *c
+	view.ctx = ctx
+	return &view
+}
+
+// WithContext returns a view of client whose requests belong to ctx, clients that can't be bound to
+// a context are returned as they are
+func WithContext(ctx context.Context, client ClientInterface) ClientInterface {
+	switch c := client.(type) {
+	case *Client:
+		return c.WithContext(ctx)
+	case *MultiClient:
+		return c.WithContext(ctx)
+	default:
+		return client
 	}
 }
 
+// context returns the context of the caller, or the background context outside WithContext views
+func (c *Client) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
 // GetInfo gets Data Plane API information
 func (c *Client) GetInfo() (*APIInfo, error) {
 	var info APIInfo
@@ -64,6 +248,9 @@ func (c *Client) GetConfigVersion() (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if resp.StatusCode >= HTTPStatusClientErrorMin {
+		return 0, newAPIError(resp.StatusCode, body)
+	}
 
 	version, err := strconv.Atoi(strings.TrimSpace(string(body)))
 	if err != nil {
@@ -73,6 +260,32 @@ func (c *Client) GetConfigVersion() (int, error) {
 	return version, nil
 }
 
+// GetRawConfiguration gets the HAProxy configuration file as plain text
+func (c *Client) GetRawConfiguration() (string, error) {
+	resp, err := c.makeRawRequest(HTTPMethodGET, "/v3/services/haproxy/configuration/raw", nil, 0)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= HTTPStatusClientErrorMin {
+		return "", newAPIError(resp.StatusCode, body)
+	}
+
+	// Some Data Plane API versions answer JSON clients with the file as a JSON string
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var raw string
+		if err := json.Unmarshal(body, &raw); err == nil {
+			return raw, nil
+		}
+	}
+	return string(body), nil
+}
+
 func (c *Client) GetBackends() ([]Backend, error) {
 	var backends []Backend
 	err := c.makeRequest(HTTPMethodGET, "/v3/services/haproxy/configuration/backends", nil, &backends, 0)
@@ -126,16 +339,95 @@ func (c *Client) DeleteServer(backendName, serverName string, version int) error
 	return c.makeRequest(HTTPMethodDELETE, path, nil, nil, version)
 }
 
+// ReplaceServer updates an existing server. Data Plane API applies changes limited to the address,
+// port and maintenance state through the runtime API, without reloading HAProxy.
+func (c *Client) ReplaceServer(backendName string, server *Server, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/servers/%s", backendName, server.Name)
+	return c.makeRequest(HTTPMethodPUT, path, server, nil, version)
+}
+
+// SwapServer replaces a server by another one (e.g. with a new address) in a single transaction,
+// so the backend never contains both or neither of them
+func (c *Client) SwapServer(backendName, oldServerName string, server *Server) error {
+	return c.runTransaction(func(transactionID string) error {
+		deletePath := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/servers/%s?transaction_id=%s",
+			backendName, oldServerName, transactionID)
+		if err := c.makeRequest(HTTPMethodDELETE, deletePath, nil, nil, 0); err != nil {
+			return fmt.Errorf("failed to delete server %s: %w", oldServerName, err)
+		}
+
+		createPath := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/servers?transaction_id=%s", backendName, transactionID)
+		if err := c.makeRequest(HTTPMethodPOST, createPath, server, nil, 0); err != nil {
+			return fmt.Errorf("failed to create server %s: %w", server.Name, err)
+		}
+		return nil
+	})
+}
+
+// UpdateServers removes and creates servers of a backend in a single transaction, so a batch of
+// changes to the backend costs a single reload
+func (c *Client) UpdateServers(backendName string, remove []string, create []Server) error {
+	return c.runTransaction(func(transactionID string) error {
+		for _, serverName := range remove {
+			deletePath := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/servers/%s?transaction_id=%s",
+				backendName, serverName, transactionID)
+			if err := c.makeRequest(HTTPMethodDELETE, deletePath, nil, nil, 0); err != nil {
+				return fmt.Errorf("failed to delete server %s: %w", serverName, err)
+			}
+		}
+
+		createPath := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/servers?transaction_id=%s", backendName, transactionID)
+		for i := range create {
+			if err := c.makeRequest(HTTPMethodPOST, createPath, &create[i], nil, 0); err != nil {
+				return fmt.Errorf("failed to create server %s: %w", create[i].Name, err)
+			}
+		}
+		return nil
+	})
+}
+
 // GetRuntimeServer gets runtime server information
 func (c *Client) GetRuntimeServer(backendName, serverName string) (*RuntimeServer, error) {
+	if c.runtime != nil && c.runtimeMode == RuntimeModePrefer {
+		server, err := c.runtime.GetRuntimeServer(c.context(), backendName, serverName)
+		if err == nil {
+			return server, nil
+		}
+		clientLog.Debug("Stats socket failed, using the Data Plane API", "backend", backendName, "error", err)
+	}
+
 	var server RuntimeServer
 	path := fmt.Sprintf("/v3/services/haproxy/runtime/backends/%s/servers/%s", backendName, serverName)
 	err := c.makeRequest(HTTPMethodGET, path, nil, &server, 0)
 	return &server, err
 }
 
+// GetRuntimeServers gets the runtime information of all servers of a backend in one request
+func (c *Client) GetRuntimeServers(backendName string) ([]RuntimeServer, error) {
+	if c.runtime != nil && c.runtimeMode == RuntimeModePrefer {
+		servers, err := c.runtime.GetRuntimeServers(c.context(), backendName)
+		if err == nil {
+			return servers, nil
+		}
+		clientLog.Debug("Stats socket failed, using the Data Plane API", "backend", backendName, "error", err)
+	}
+
+	var servers []RuntimeServer
+	path := fmt.Sprintf("/v3/services/haproxy/runtime/backends/%s/servers", backendName)
+	err := c.makeRequest(HTTPMethodGET, path, nil, &servers, 0)
+	return servers, err
+}
+
 // SetServerState sets the administrative state of a server (ready, drain, maint)
 func (c *Client) SetServerState(ctx context.Context, backendName, serverName, adminState string) error {
+	if c.runtime != nil && c.runtimeMode == RuntimeModePrefer {
+		err := c.runtime.SetServerState(ctx, backendName, serverName, adminState)
+		if err == nil {
+			return nil
+		}
+		clientLog.Debug("Stats socket failed, using the Data Plane API", "backend", backendName, "error", err)
+	}
+
 	path := fmt.Sprintf("/v3/services/haproxy/runtime/backends/%s/servers/%s", backendName, serverName)
 
 	// Create the runtime server object with the new admin state
@@ -143,7 +435,22 @@ func (c *Client) SetServerState(ctx context.Context, backendName, serverName, ad
 		AdminState: adminState,
 	}
 
-	return c.makeRequest(HTTPMethodPUT, path, server, nil, 0)
+	err := c.makeRequest(HTTPMethodPUT, path, server, nil, 0)
+	if err != nil && c.runtime != nil && c.runtimeMode == RuntimeModeFallback && apiUnavailable(err) {
+		if runtimeErr := c.runtime.SetServerState(ctx, backendName, serverName, adminState); runtimeErr != nil {
+			return fmt.Errorf("%w (stats socket: %v)", err, runtimeErr)
+		}
+		clientLog.Warn("Data Plane API failed, set the server state over the stats socket",
+			"backend", backendName, "server", serverName, "state", adminState, "error", err)
+		return nil
+	}
+	return err
+}
+
+// apiUnavailable checks if a Data Plane API request failed because the API is unreachable or
+// broken rather than because the request was rejected
+func apiUnavailable(err error) bool {
+	return statusCode(err) == 0 || statusCode(err) >= http.StatusInternalServerError
 }
 
 // DrainServer puts a server into drain mode (completes existing connections, no new ones)
@@ -161,192 +468,262 @@ func (c *Client) MaintainServer(backendName, serverName string) error {
 	return c.SetServerState(context.Background(), backendName, serverName, "maint")
 }
 
+// GetStickTableEntries reads the entries of a stick table from the runtime API
+func (c *Client) GetStickTableEntries(table string) ([]StickTableEntry, error) {
+	var entries []StickTableEntry
+	path := fmt.Sprintf("/v3/services/haproxy/runtime/stick_tables/%s/entries", table)
+	err := c.makeRequest(HTTPMethodGET, path, nil, &entries, 0)
+	return entries, err
+}
+
 // makeRequest is a helper for making authenticated HTTP requests
 func (c *Client) makeRequest(method, path string, body, result interface{}, version int) error {
 	resp, err := c.makeRawRequest(method, path, body, version)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= HTTPStatusClientErrorMin {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
-	if result != nil && resp.StatusCode != http.StatusNoContent {
-		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
-			return fmt.Errorf("failed to decode response: %w", err)
-		}
-	}
-
-	return nil
+	return decodeResponse(resp, result)
 }
 
 // makeRawRequest makes the actual HTTP request
 func (c *Client) makeRawRequest(method, path string, body interface{}, version int) (*http.Response, error) {
-	url := c.baseURL + path
+	return c.sendRequest(c.httpClient, method, path, body, version)
+}
 
-	// Add version parameter for operations that require it
-	if version > 0 && (method == HTTPMethodPOST || method == HTTPMethodPUT || method == HTTPMethodDELETE) {
-		separator := "?"
-		if strings.Contains(url, "?") {
-			separator = "&"
+// sendRequest sends a JSON request with the given HTTP client. Network errors and 5xx responses of
+// idempotent requests are retried with exponential backoff and jitter, as are 429 responses; a
+// Retry-After header overrides the backoff. A POST is only sent again if it provably didn't reach
+// the Data Plane API, it might have been applied otherwise. Version conflicts are returned to the
+// caller, which decides if its change still applies on top of the current version.
+func (c *Client) sendRequest(httpClient *http.Client, method, path string, body interface{}, version int) (resp *http.Response, err error) {
+	ctx, span := tracing.StartClient(c.context(), "haproxy "+method,
+		tracing.String("http.request.method", method),
+		tracing.String("url.path", path),
+		tracing.String("server.address", c.baseURL))
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
 		}
-		url += fmt.Sprintf("%sversion=%d", separator, version)
-	}
+		span.RecordError(err)
+		span.End()
+	}()
 
-	var bodyReader io.Reader = http.NoBody
+	var jsonBody []byte
 	if body != nil {
-		jsonBody, err := json.Marshal(body)
+		var err error
+		jsonBody, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		bodyReader = bytes.NewReader(jsonBody)
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), method, url, bodyReader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	for attempt := 0; ; attempt++ {
+		var bodyReader io.Reader = http.NoBody
+		if jsonBody != nil {
+			bodyReader = bytes.NewReader(jsonBody)
+		}
 
-	// Add authentication
-	req.SetBasicAuth(c.username, c.password)
+		req, err := http.NewRequestWithContext(ctx, method, c.requestURL(method, path, version), bodyReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+		c.setAuth(req)
+		tracing.Inject(ctx, req.Header)
 
-	return c.httpClient.Do(req)
-}
+		// Set headers
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
 
-func (c *Client) GetServers(backendName string) ([]Server, error) {
-	var servers []Server
-	path := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/servers", backendName)
-	err := c.makeRequest(HTTPMethodGET, path, nil, &servers, 0)
-	return servers, err
-}
+		resp, err = httpClient.Do(req)
+		if attempt > 0 {
+			span.SetAttributes(tracing.Int("http.request.resend_count", attempt))
+		}
+		if attempt >= c.retryAttempts {
+			return resp, err
+		}
 
-func IsBackendCompatibleForDynamicService(backend *Backend) bool {
-	return backend.Balance.Algorithm == "roundrobin"
+		wait, retry := c.retryDelay(attempt, method, resp, err)
+		if !retry {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, fmt.Errorf("canceled while waiting to retry %s %s: %w", method, path, err)
+		}
+	}
 }
 
-// AddFrontendRule adds a domain-to-backend routing rule to the specified frontend
-func (c *Client) AddFrontendRule(frontend, domain, backend string) error {
-	return c.AddFrontendRuleWithType(frontend, domain, backend, DomainTypeExact)
+// sleepContext waits for d or until ctx is canceled, returning the context's error then
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// AddFrontendRuleWithType adds a domain-to-backend routing rule with specific domain type
-func (c *Client) AddFrontendRuleWithType(frontend, domain, backend string, domainType DomainType) error {
-	// Create transaction
-	transactionID, err := c.createTransaction()
-	if err != nil {
-		return fmt.Errorf("failed to create transaction: %w", err)
+// requestURL builds the URL of a request, adding the version parameter for operations that require it
+func (c *Client) requestURL(method, path string, version int) string {
+	url := c.baseURL + path
+	if version > 0 && (method == HTTPMethodPOST || method == HTTPMethodPUT || method == HTTPMethodDELETE) {
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		url += fmt.Sprintf("%sversion=%d", separator, version)
 	}
+	return url
+}
 
-	// Get current rules to append to
-	currentRules, err := c.getFrontendRulesInTransaction(frontend, transactionID)
+// retryDelay decides whether a failed attempt is retried and how long to wait before. A POST is
+// only retried if it never reached the Data Plane API: the connection failed, or it was rejected
+// with a 429 before being processed.
+func (c *Client) retryDelay(attempt int, method string, resp *http.Response, err error) (time.Duration, bool) {
 	if err != nil {
-		return fmt.Errorf("failed to get current rules: %w", err)
+		return c.backoff(attempt), method != HTTPMethodPOST || neverSent(err)
 	}
-
-	// Add new rule (avoid duplicates)
-	newRule := FrontendRule{Domain: domain, Backend: backend, Type: domainType}
-	exists := false
-	for i, rule := range currentRules {
-		if rule.Domain == domain {
-			// Update existing rule
-			currentRules[i].Backend = backend
-			currentRules[i].Type = domainType
-			exists = true
-			break
-		}
-	}
-	if !exists {
-		currentRules = append(currentRules, newRule)
+	if method == HTTPMethodPOST && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
 	}
 
-	// Update ACLs and backend switching rules
-	if err := c.setFrontendRulesInTransaction(frontend, currentRules, transactionID); err != nil {
-		return fmt.Errorf("failed to update rules: %w", err)
+	if wait, ok := c.retryAfter(resp); ok {
+		return wait, true
 	}
 
-	// Commit transaction
-	if err := c.commitTransaction(transactionID); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented:
+		return c.backoff(attempt), true
 	}
+	return 0, false
+}
 
-	return nil
+// neverSent checks if a request failed before it reached the Data Plane API, because no connection
+// could be established
+func neverSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
 }
 
-// RemoveFrontendRule removes a domain routing rule from the specified frontend
-// ResetFrontendRules clears all ACLs and backend switching rules for a frontend
-func (c *Client) ResetFrontendRules(frontendName string) error {
-	// Create transaction
-	transactionID, err := c.createTransaction()
-	if err != nil {
-		return fmt.Errorf("failed to create transaction: %w", err)
+// backoff returns the exponential backoff of an attempt with jitter: a random wait between half
+// and the full backoff, so concurrent writers don't retry in lockstep
+func (c *Client) backoff(attempt int) time.Duration {
+	backoff := c.retryBackoff
+	for i := 0; i < attempt && backoff < c.maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, c.maxRetryBackoff)
+	if backoff <= 0 {
+		return 0
 	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1)) //nolint:gosec // Jitter needs no crypto randomness
+}
 
-	// Clear all ACLs
-	emptyACLs := []interface{}{}
-	err = c.makeRequest(HTTPMethodPUT,
-		fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/acls?transaction_id=%s", frontendName, transactionID),
-		emptyACLs, nil, 0)
-	if err != nil {
-		return fmt.Errorf("failed to clear ACLs: %w", err)
+// setAuth authenticates a request: reads with the read-only credentials, mutations with the
+// read-write credentials, so the privileged pair is only sent when needed
+func (c *Client) setAuth(req *http.Request) {
+	c.credentials.mu.RLock()
+	defer c.credentials.mu.RUnlock()
+	if req.Method == HTTPMethodGET {
+		req.SetBasicAuth(c.credentials.readUsername, c.credentials.readPassword)
+		return
 	}
+	req.SetBasicAuth(c.credentials.username, c.credentials.password)
+}
 
-	// Clear all backend switching rules
-	emptyRules := []interface{}{}
-	err = c.makeRequest(HTTPMethodPUT,
-		fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/backend_switching_rules?transaction_id=%s", frontendName, transactionID),
-		emptyRules, nil, 0)
-	if err != nil {
-		return fmt.Errorf("failed to clear backend switching rules: %w", err)
+// retryAfter returns how long to wait before retrying a request the Data Plane API rejected as
+// overloaded or busy reloading. Returns false if the response does not ask for a retry.
+func (c *Client) retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	header := resp.Header.Get(HTTPHeaderRetryAfter)
+	if header == "" {
+		return 0, false
 	}
 
-	// Commit transaction
-	err = c.commitTransaction(transactionID)
-	if err != nil {
-		return fmt.Errorf("failed to commit reset transaction: %w", err)
+	wait := DefaultRetryAfterFallbackSec * time.Second
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = time.Until(date)
 	}
 
-	return nil
+	wait = max(wait, 0)
+	if c.maxRetryAfter > 0 {
+		wait = min(wait, c.maxRetryAfter)
+	}
+	return wait, true
 }
 
-func (c *Client) RemoveFrontendRule(frontend, domain string) error {
-	// Create transaction
-	transactionID, err := c.createTransaction()
-	if err != nil {
-		return fmt.Errorf("failed to create transaction: %w", err)
-	}
+// decodeResponse checks the response status and decodes the JSON body into result
+func decodeResponse(resp *http.Response, result interface{}) error {
+	defer resp.Body.Close()
 
-	// Get current rules
-	currentRules, err := c.getFrontendRulesInTransaction(frontend, transactionID)
-	if err != nil {
-		return fmt.Errorf("failed to get current rules: %w", err)
+	if resp.StatusCode >= HTTPStatusClientErrorMin {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return newAPIError(resp.StatusCode, bodyBytes)
 	}
 
-	// Remove rule for domain
-	var updatedRules []FrontendRule
-	for _, rule := range currentRules {
-		if rule.Domain != domain {
-			updatedRules = append(updatedRules, rule)
+	if result != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
 		}
 	}
 
-	// Update ACLs and backend switching rules
-	if err := c.setFrontendRulesInTransaction(frontend, updatedRules, transactionID); err != nil {
-		return fmt.Errorf("failed to update rules: %w", err)
-	}
+	return nil
+}
 
-	// Commit transaction
-	if err := c.commitTransaction(transactionID); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
+func (c *Client) GetServers(backendName string) ([]Server, error) {
+	var servers []Server
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/servers", backendName)
+	err := c.makeRequest(HTTPMethodGET, path, nil, &servers, 0)
+	return servers, err
+}
 
-	return nil
+func IsBackendCompatibleForDynamicService(backend *Backend) bool {
+	return backend.Balance.Algorithm == "roundrobin"
+}
+
+// AddFrontendRule adds a domain-to-backend routing rule to the specified frontend
+func (c *Client) AddFrontendRule(frontend, domain, backend string) error {
+	return c.AddFrontendRuleWithType(frontend, domain, backend, DomainTypeExact)
+}
+
+// AddFrontendRuleWithType adds a domain-to-backend routing rule with specific domain type
+func (c *Client) AddFrontendRuleWithType(frontend, domain, backend string, domainType DomainType) error {
+	return c.SetFrontendRule(frontend, FrontendRule{Domain: domain, Backend: backend, Type: domainType})
+}
+
+// SetFrontendRule adds or replaces the routing rule of a domain, including its basic auth protection,
+// in a single transaction
+func (c *Client) SetFrontendRule(frontend string, rule FrontendRule) error {
+	return c.runTransaction(func(transactionID string) error {
+		return c.setFrontendRuleInTransaction(frontend, &rule, transactionID)
+	})
+}
+
+// ResetFrontendRules removes all domain rules the connector created in a frontend, hand-written
+// ACLs and rules are kept
+func (c *Client) ResetFrontendRules(frontendName string) error {
+	return c.runTransaction(func(transactionID string) error {
+		return c.resetFrontendRulesInTransaction(frontendName, transactionID)
+	})
+}
+
+// RemoveFrontendRule removes a domain routing rule from the specified frontend
+func (c *Client) RemoveFrontendRule(frontend, domain string) error {
+	return c.runTransaction(func(transactionID string) error {
+		return c.removeFrontendRuleInTransaction(frontend, domain, transactionID)
+	})
 }
 
 // GetFrontendRules returns all domain-to-backend routing rules for the specified frontend
@@ -379,31 +756,127 @@ func (c *Client) createTransaction() (string, error) {
 	return transactionID, nil
 }
 
+// runTransaction runs fn in a new transaction and commits it. If another writer changed the
+// configuration while the transaction was open, the commit fails with a version mismatch; fn
+// then runs again in a fresh transaction on top of the new version, so the change isn't lost.
+func (c *Client) runTransaction(fn func(transactionID string) error) error {
+	for attempt := 0; ; attempt++ {
+		err := c.attemptTransaction(fn)
+		if err == nil || !IsVersionConflict(err) || attempt >= c.retryAttempts {
+			return err
+		}
+		if err := sleepContext(c.context(), c.backoff(attempt)); err != nil {
+			return fmt.Errorf("canceled while waiting to retry transaction: %w", err)
+		}
+	}
+}
+
+// attemptTransaction runs fn in a new transaction and commits it. Uncommitted transactions are
+// deleted on every error path, otherwise they pile up until the Data Plane API refuses to start
+// new ones.
+func (c *Client) attemptTransaction(fn func(transactionID string) error) (err error) {
+	ctx, span := tracing.Start(c.context(), "haproxy transaction", tracing.String("server.address", c.baseURL))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	traced := c.WithContext(ctx)
+
+	transactionID, err := traced.createTransaction()
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %w", err)
+	}
+	span.SetAttributes(tracing.String("haproxy.transaction", transactionID))
+
+	committed := false
+	defer func() {
+		if !committed {
+			traced.deleteTransaction(transactionID)
+		}
+	}()
+
+	if err := fn(transactionID); err != nil {
+		clientLog.Debug("Discarding transaction", "transaction", transactionID, "error", err)
+		return err
+	}
+	if err := traced.commitTransaction(transactionID); err != nil {
+		clientLog.Debug("Failed to commit transaction", "transaction", transactionID, "error", err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	clientLog.Debug("Committed transaction", "transaction", transactionID)
+	return nil
+}
+
+// DeleteStaleTransactions deletes open transactions started on an outdated configuration version,
+// e.g. left behind by a connector that was killed in the middle of a change. Transactions don't
+// record who started them; outdated ones can't be committed anymore, so deleting them is safe.
+// Returns the number of deleted transactions.
+func (c *Client) DeleteStaleTransactions() (int, error) {
+	version, err := c.GetConfigVersion()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get config version: %w", err)
+	}
+
+	var transactions []Transaction
+	if err := c.makeRequest(HTTPMethodGET, "/v3/services/haproxy/transactions?status=in_progress", nil, &transactions, 0); err != nil {
+		return 0, fmt.Errorf("failed to list transactions: %w", err)
+	}
+
+	deleted := 0
+	for _, transaction := range transactions {
+		if transaction.Status != TransactionStatusInProgress || transaction.Version >= version {
+			continue
+		}
+		path := fmt.Sprintf("/v3/services/haproxy/transactions/%s", transaction.ID)
+		if err := c.makeRequest(HTTPMethodDELETE, path, nil, nil, 0); err != nil {
+			return deleted, fmt.Errorf("failed to delete stale transaction %s: %w", transaction.ID, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// deleteTransaction discards a transaction that is not committed. Errors are ignored, transactions
+// that could not be deleted are cleaned up by DeleteStaleTransactions on the next start.
+func (c *Client) deleteTransaction(transactionID string) {
+	path := fmt.Sprintf("/v3/services/haproxy/transactions/%s", transactionID)
+	_ = c.makeRequest(HTTPMethodDELETE, path, nil, nil, 0)
+}
+
 func (c *Client) commitTransaction(transactionID string) error {
 	path := fmt.Sprintf("/v3/services/haproxy/transactions/%s", transactionID)
+	// Commits reload HAProxy and may take much longer than regular requests
+	resp, err := c.sendRequest(c.commitClient, HTTPMethodPUT, path, nil, 0)
+	if err != nil {
+		return err
+	}
 	var response map[string]interface{}
-	return c.makeRequest(HTTPMethodPUT, path, nil, &response, 0)
+	return decodeResponse(resp, &response)
 }
 
 func (c *Client) getFrontendRulesInTransaction(frontend, transactionID string) ([]FrontendRule, error) {
-	// Get ACLs
-	var acls []map[string]interface{}
-	aclPath := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/acls", frontend)
-	if transactionID != "" {
-		aclPath += "?transaction_id=" + transactionID
-	}
-	if err := c.makeRequest(HTTPMethodGET, aclPath, nil, &acls, 0); err != nil {
+	acls, err := c.getFrontendListInTransaction(frontend, frontendListACLs, transactionID)
+	if err != nil {
 		return nil, fmt.Errorf("failed to get ACLs: %w", err)
 	}
+	rules, err := c.getFrontendListInTransaction(frontend, frontendListSwitchingRules, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backend switching rules: %w", err)
+	}
 
-	// Get backend switching rules
-	var rules []map[string]interface{}
-	rulePath := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/backend_switching_rules", frontend)
-	if transactionID != "" {
-		rulePath += "?transaction_id=" + transactionID
+	// Get http-request auth rules protecting domains
+	authUserlists, err := c.getAuthUserlistsInTransaction(frontend, transactionID)
+	if err != nil {
+		return nil, err
 	}
-	if err := c.makeRequest(HTTPMethodGET, rulePath, nil, &rules, 0); err != nil {
-		return nil, fmt.Errorf("failed to get backend switching rules: %w", err)
+
+	// Canary switching rules send a share of a domain's traffic elsewhere
+	canaries := make(map[string]FrontendRule)
+	for _, rule := range rules {
+		if aclName, canary, ok := parseCanaryRule(rule); ok {
+			canaries[aclName] = canary
+		}
 	}
 
 	// Match ACLs to backend switching rules
@@ -416,20 +889,16 @@ func (c *Client) getFrontendRulesInTransaction(frontend, transactionID string) (
 		for _, acl := range acls {
 			aclName, _ := acl["acl_name"].(string)
 			if aclName == condTest {
-				value, _ := acl["value"].(string)
-
-				// Strip -m reg prefix if present
-				domain := value
-				domainType := DomainTypeExact
-				if strings.HasPrefix(value, "-m reg ") {
-					domain = strings.TrimPrefix(value, "-m reg ")
-					domainType = DomainTypeRegex
-				}
-
+				domain, domainType, hostMatch, _ := parseDomainACL(acl)
 				frontendRules = append(frontendRules, FrontendRule{
-					Domain:  domain,
-					Backend: backendName,
-					Type:    domainType,
+					Domain:        domain,
+					Backend:       backendName,
+					Type:          domainType,
+					AuthUserlist:  authUserlists[aclName],
+					HostMatch:     hostMatch,
+					CanaryBackend: canaries[aclName].CanaryBackend,
+					CanaryPercent: canaries[aclName].CanaryPercent,
+					Managed:       isManagedACLNameOf(aclName, backendName, domain),
 				})
 				break
 			}
@@ -439,62 +908,131 @@ func (c *Client) getFrontendRulesInTransaction(frontend, transactionID string) (
 	return frontendRules, nil
 }
 
+// MaxACLNameLength bounds the ACL names the connector generates, long backend names are truncated
+const MaxACLNameLength = 64
+
+// invalidACLNameChars matches the characters replaced in the backend part of ACL names. HAProxy
+// accepts letters, digits and "-_.:", dashes are replaced as well for names stable since the start.
+var invalidACLNameChars = regexp.MustCompile(`[^A-Za-z0-9_.:]`)
+
 // hashDomain creates a short hash of the domain for use in ACL names
 func hashDomain(domain string) string {
 	hash := sha256.Sum256([]byte(domain))
 	return fmt.Sprintf("%x", hash[:4]) // Use first 8 hex chars (4 bytes)
 }
 
-func (c *Client) setFrontendRulesInTransaction(frontend string, rules []FrontendRule, transactionID string) error {
-	// Convert rules to ACLs and backend switching rules
-	var acls []map[string]interface{}
-	var backendRules []map[string]interface{}
+// longHashDomain creates the longer hash of the domain used when the short one collides
+func longHashDomain(domain string) string {
+	hash := sha256.Sum256([]byte(domain))
+	return fmt.Sprintf("%x", hash[:8])
+}
 
-	for _, rule := range rules {
-		// Generate ACL name: backend + domain hash (safe for HAProxy, unique per domain+backend)
-		aclName := fmt.Sprintf("is_%s_%s",
-			strings.ReplaceAll(rule.Backend, "-", "_"),
-			hashDomain(rule.Domain))
+// managedACLName generates the name of the ACL the connector matches a domain with:
+// backend + domain hash (safe for HAProxy, unique per domain+backend)
+func managedACLName(backend, domain string) string {
+	return aclNameWithHash(backend, hashDomain(domain))
+}
 
-		value := rule.Domain
-		if rule.Type == DomainTypeRegex {
-			value = "-m reg " + rule.Domain
-		}
+// longManagedACLName generates the name of the ACL of a domain whose short name is taken by
+// another domain with the same hash
+func longManagedACLName(backend, domain string) string {
+	return aclNameWithHash(backend, longHashDomain(domain))
+}
 
-		acl := map[string]interface{}{
-			"acl_name":  aclName,
-			"criterion": "hdr(host)",
-			"value":     value,
-		}
+func aclNameWithHash(backend, hash string) string {
+	name := invalidACLNameChars.ReplaceAllString(backend, "_")
+	if maxLen := MaxACLNameLength - len("is__") - len(hash); len(name) > maxLen {
+		name = name[:maxLen]
+	}
+	return "is_" + name + "_" + hash
+}
 
-		if rule.Type == DomainTypeRegex {
-			fmt.Printf("DEBUG: Adding regex ACL: %+v\n", acl)
-		}
+// isManagedACLNameOf checks if the ACL of a rule is named the way the connector names the ACL of
+// the backend and domain
+func isManagedACLNameOf(aclName, backend, domain string) bool {
+	return aclName == managedACLName(backend, domain) || aclName == longManagedACLName(backend, domain)
+}
 
-		acls = append(acls, acl)
+// canaryRuleCondition matches the condition of connector-managed canary switching rules: "<acl> { rand(100) lt <percent> }"
+var canaryRuleCondition = regexp.MustCompile(`^(is_\S+) \{ rand\(100\) lt (\d+) \}$`)
 
-		// Add backend switching rule
-		backendRules = append(backendRules, map[string]interface{}{
-			"cond":      "if",
-			"cond_test": aclName,
-			"name":      rule.Backend,
-		})
+// canarySwitchingRule builds the switching rule sending percent of the ACL's traffic to the canary backend
+func canarySwitchingRule(aclName, canaryBackend string, percent int) map[string]interface{} {
+	return map[string]interface{}{
+		"cond":      "if",
+		"cond_test": fmt.Sprintf("%s { rand(100) lt %d }", aclName, percent),
+		"name":      canaryBackend,
 	}
+}
 
-	// Update ACLs
-	aclPath := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/acls?transaction_id=%s", frontend, transactionID)
-	if err := c.makeRequest(HTTPMethodPUT, aclPath, acls, nil, 0); err != nil {
-		return fmt.Errorf("failed to update ACLs: %w", err)
+// parseCanaryRule returns the ACL, canary backend and percentage of a connector-managed canary switching rule
+func parseCanaryRule(rule map[string]interface{}) (aclName string, canary FrontendRule, ok bool) {
+	condTest, _ := rule["cond_test"].(string)
+	backendName, _ := rule["name"].(string)
+	match := canaryRuleCondition.FindStringSubmatch(condTest)
+	if match == nil {
+		return "", FrontendRule{}, false
 	}
+	percent, err := strconv.Atoi(match[2])
+	if err != nil {
+		return "", FrontendRule{}, false
+	}
+	return match[1], FrontendRule{CanaryBackend: backendName, CanaryPercent: percent}, true
+}
+
+// authRuleCondition matches the condition of connector-managed auth rules: "<acl> !{ http_auth(<userlist>) }"
+var authRuleCondition = regexp.MustCompile(`^(is_\S+) !\{ http_auth\((\S+)\) \}$`)
 
-	// Update backend switching rules
-	rulePath := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/backend_switching_rules?transaction_id=%s",
-		frontend, transactionID)
-	if err := c.makeRequest(HTTPMethodPUT, rulePath, backendRules, nil, 0); err != nil {
-		return fmt.Errorf("failed to update backend switching rules: %w", err)
+// authRequestRule builds the http-request auth rule asking for credentials of the userlist on the ACL's domain
+func authRequestRule(aclName, realm, userlist string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "auth",
+		"auth_realm": realm,
+		"cond":       "if",
+		"cond_test":  fmt.Sprintf("%s !{ http_auth(%s) }", aclName, userlist),
 	}
+}
 
-	return nil
+// parseAuthRule returns the ACL and userlist of a connector-managed auth rule
+func parseAuthRule(rule map[string]interface{}) (aclName, userlist string, ok bool) {
+	ruleType, _ := rule["type"].(string)
+	condTest, _ := rule["cond_test"].(string)
+	if ruleType != "auth" {
+		return "", "", false
+	}
+	match := authRuleCondition.FindStringSubmatch(condTest)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+func (c *Client) getHTTPRequestRulesInTransaction(frontend, transactionID string) ([]map[string]interface{}, error) {
+	var rules []map[string]interface{}
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/http_request_rules", frontend)
+	if transactionID != "" {
+		path += "?transaction_id=" + transactionID
+	}
+	if err := c.makeRequest(HTTPMethodGET, path, nil, &rules, 0); err != nil {
+		return nil, fmt.Errorf("failed to get http-request rules: %w", err)
+	}
+	return rules, nil
+}
+
+// getAuthUserlistsInTransaction maps the ACLs of protected domains to their userlist
+func (c *Client) getAuthUserlistsInTransaction(frontend, transactionID string) (map[string]string, error) {
+	rules, err := c.getHTTPRequestRulesInTransaction(frontend, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	userlists := make(map[string]string)
+	for _, rule := range rules {
+		if aclName, userlist, ok := parseAuthRule(rule); ok {
+			userlists[aclName] = userlist
+		}
+	}
+	return userlists, nil
 }
 
 // SetHTTPChecks replaces all HTTP checks for a backend
@@ -511,3 +1049,370 @@ func (c *Client) GetHTTPChecks(backendName string) ([]HTTPCheck, error) {
 	err := c.makeRequest(HTTPMethodGET, path, nil, &checks, 0)
 	return checks, err
 }
+
+// GetFrontend returns a frontend by name
+func (c *Client) GetFrontend(name string) (*Frontend, error) {
+	var frontend Frontend
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s", name)
+	if err := c.makeRequest(HTTPMethodGET, path, nil, &frontend, 0); err != nil {
+		return nil, err
+	}
+	return &frontend, nil
+}
+
+// UpdateFrontendLogging sets log-format, option httplog and option tcplog of a frontend as given,
+// keeping all other settings of the frontend
+func (c *Client) UpdateFrontendLogging(frontend *Frontend, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s", frontend.Name)
+
+	// Frontend only models a few fields, so the full section is replaced from its raw form
+	var raw map[string]interface{}
+	if err := c.makeRequest(HTTPMethodGET, path, nil, &raw, 0); err != nil {
+		return err
+	}
+
+	delete(raw, "log_format")
+	delete(raw, "httplog")
+	delete(raw, "tcplog")
+	if frontend.LogFormat != "" {
+		raw["log_format"] = frontend.LogFormat
+	}
+	if frontend.HTTPLog {
+		raw["httplog"] = true
+	}
+	if frontend.TCPLog {
+		raw["tcplog"] = true
+	}
+
+	return c.makeRequest(HTTPMethodPUT, path, raw, nil, version)
+}
+
+// SetFrontendDefaultBackend sets the default_backend of a frontend, keeping all other settings of
+// the frontend
+func (c *Client) SetFrontendDefaultBackend(frontendName, backendName string, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s", frontendName)
+
+	var raw map[string]interface{}
+	if err := c.makeRequest(HTTPMethodGET, path, nil, &raw, 0); err != nil {
+		return err
+	}
+	raw["default_backend"] = backendName
+
+	return c.makeRequest(HTTPMethodPUT, path, raw, nil, version)
+}
+
+// CreateFrontend creates a new frontend
+func (c *Client) CreateFrontend(frontend *Frontend, version int) (*Frontend, error) {
+	var created Frontend
+	err := c.makeRequest(HTTPMethodPOST, "/v3/services/haproxy/configuration/frontends", frontend, &created, version)
+	return &created, err
+}
+
+// DeleteFrontend deletes a frontend
+func (c *Client) DeleteFrontend(name string, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s", name)
+	return c.makeRequest(HTTPMethodDELETE, path, nil, nil, version)
+}
+
+// CreateBind adds a bind directive to a frontend
+func (c *Client) CreateBind(frontendName string, bind *Bind, version int) (*Bind, error) {
+	var created Bind
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/binds", frontendName)
+	err := c.makeRequest(HTTPMethodPOST, path, bind, &created, version)
+	return &created, err
+}
+
+// EnsureFrontend creates the frontend if it doesn't exist and makes its binds match binds: missing
+// binds are created and binds whose address, port or certificate differ are replaced. Binds named
+// the way the connector names them (<frontend>_<port>) that are no longer wanted, e.g. after a port
+// change, are deleted; other binds, e.g. written by hand, are kept. All changes are made in a single
+// transaction, so a frontend is never left without its bind. Returns whether anything changed.
+func (c *Client) EnsureFrontend(frontend *Frontend, binds []Bind) (bool, error) {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s", frontend.Name)
+	exists := true
+	if _, err := c.GetFrontend(frontend.Name); IsNotFound(err) {
+		exists = false
+	} else if err != nil {
+		return false, err
+	}
+
+	var current []Bind
+	if exists {
+		if err := c.makeRequest(HTTPMethodGET, path+"/binds", nil, &current, 0); err != nil {
+			return false, fmt.Errorf("failed to get binds of frontend %s: %w", frontend.Name, err)
+		}
+	}
+	create, replace, remove := diffBinds(frontend.Name, current, binds)
+	if exists && len(create)+len(replace)+len(remove) == 0 {
+		return false, nil
+	}
+
+	err := c.runTransaction(func(transactionID string) error {
+		query := "?transaction_id=" + transactionID
+		if !exists {
+			if err := c.makeRequest(HTTPMethodPOST, "/v3/services/haproxy/configuration/frontends"+query, frontend, nil, 0); err != nil {
+				return fmt.Errorf("failed to create frontend %s: %w", frontend.Name, err)
+			}
+		}
+		for _, name := range remove {
+			if err := c.makeRequest(HTTPMethodDELETE, path+"/binds/"+name+query, nil, nil, 0); err != nil {
+				return fmt.Errorf("failed to delete bind %s of frontend %s: %w", name, frontend.Name, err)
+			}
+		}
+		for i := range replace {
+			if err := c.makeRequest(HTTPMethodPUT, path+"/binds/"+replace[i].Name+query, &replace[i], nil, 0); err != nil {
+				return fmt.Errorf("failed to replace bind %s of frontend %s: %w", replace[i].Name, frontend.Name, err)
+			}
+		}
+		for i := range create {
+			if err := c.makeRequest(HTTPMethodPOST, path+"/binds"+query, &create[i], nil, 0); err != nil {
+				return fmt.Errorf("failed to bind frontend %s to port %d: %w", frontend.Name, create[i].Port, err)
+			}
+		}
+		return nil
+	})
+	return err == nil, err
+}
+
+// diffBinds compares the binds of a frontend with the wanted ones. Only binds named after the
+// frontend are removed.
+func diffBinds(frontendName string, current, wanted []Bind) (create, replace []Bind, remove []string) {
+	existing := make(map[string]Bind, len(current))
+	for _, bind := range current {
+		existing[bind.Name] = bind
+	}
+	names := make(map[string]bool, len(wanted))
+	for _, bind := range wanted {
+		names[bind.Name] = true
+		found, ok := existing[bind.Name]
+		switch {
+		case !ok:
+			create = append(create, bind)
+		case found != bind:
+			replace = append(replace, bind)
+		}
+	}
+	for _, bind := range current {
+		if !names[bind.Name] && strings.HasPrefix(bind.Name, frontendName+"_") {
+			remove = append(remove, bind.Name)
+		}
+	}
+	return create, replace, remove
+}
+
+// EnsureUserlistUser creates the userlist if it is missing and creates or updates the user with the
+// given crypt(3) password hash in a single transaction
+func (c *Client) EnsureUserlistUser(userlist, username, passwordHash string) error {
+	var users []User
+	listErr := c.makeRequest(HTTPMethodGET, "/v3/services/haproxy/configuration/users?userlist="+url.QueryEscape(userlist), nil, &users, 0)
+	if listErr != nil && !IsNotFound(listErr) {
+		return fmt.Errorf("failed to get users of userlist %s: %w", userlist, listErr)
+	}
+	userlistMissing := listErr != nil
+	userExists := false
+	for i := range users {
+		if users[i].Username == username {
+			if users[i].Password == passwordHash {
+				return nil
+			}
+			userExists = true
+		}
+	}
+
+	return c.runTransaction(func(transactionID string) error {
+		if userlistMissing {
+			path := "/v3/services/haproxy/configuration/userlists?transaction_id=" + transactionID
+			if err := c.makeRequest(HTTPMethodPOST, path, Userlist{Name: userlist}, nil, 0); err != nil {
+				return fmt.Errorf("failed to create userlist %s: %w", userlist, err)
+			}
+		}
+
+		var err error
+		user := User{Username: username, Password: passwordHash, SecurePassword: true}
+		query := fmt.Sprintf("userlist=%s&transaction_id=%s", url.QueryEscape(userlist), transactionID)
+		if userExists {
+			err = c.makeRequest(HTTPMethodPUT, fmt.Sprintf("/v3/services/haproxy/configuration/users/%s?%s", username, query), user, nil, 0)
+		} else {
+			err = c.makeRequest(HTTPMethodPOST, "/v3/services/haproxy/configuration/users?"+query, user, nil, 0)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set user %s in userlist %s: %w", username, userlist, err)
+		}
+		return nil
+	})
+}
+
+// DeleteUserlist deletes a userlist with all its users
+func (c *Client) DeleteUserlist(name string, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/userlists/%s", name)
+	return c.makeRequest(HTTPMethodDELETE, path, nil, nil, version)
+}
+
+// GetHTTPRequestRules returns the http-request rules of a frontend or backend
+func (c *Client) GetHTTPRequestRules(parentType, parentName string) ([]HTTPRequestRule, error) {
+	var rules []HTTPRequestRule
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/%s/%s/http_request_rules", parentType, parentName)
+	err := c.makeRequest(HTTPMethodGET, path, nil, &rules, 0)
+	return rules, err
+}
+
+// CreateHTTPRequestRule inserts an http-request rule at the given index
+func (c *Client) CreateHTTPRequestRule(parentType, parentName string, index int, rule *HTTPRequestRule, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/%s/%s/http_request_rules/%d", parentType, parentName, index)
+	return c.makeRequest(HTTPMethodPOST, path, rule, nil, version)
+}
+
+// DeleteHTTPRequestRule deletes the http-request rule at the given index
+func (c *Client) DeleteHTTPRequestRule(parentType, parentName string, index, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/%s/%s/http_request_rules/%d", parentType, parentName, index)
+	return c.makeRequest(HTTPMethodDELETE, path, nil, nil, version)
+}
+
+// GetHTTPResponseRules returns the http-response rules of a frontend or backend
+func (c *Client) GetHTTPResponseRules(parentType, parentName string) ([]HTTPResponseRule, error) {
+	var rules []HTTPResponseRule
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/%s/%s/http_response_rules", parentType, parentName)
+	err := c.makeRequest(HTTPMethodGET, path, nil, &rules, 0)
+	return rules, err
+}
+
+// CreateHTTPResponseRule inserts an http-response rule at the given index
+func (c *Client) CreateHTTPResponseRule(parentType, parentName string, index int, rule *HTTPResponseRule, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/%s/%s/http_response_rules/%d", parentType, parentName, index)
+	return c.makeRequest(HTTPMethodPOST, path, rule, nil, version)
+}
+
+// DeleteHTTPResponseRule deletes the http-response rule at the given index
+func (c *Client) DeleteHTTPResponseRule(parentType, parentName string, index, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/%s/%s/http_response_rules/%d", parentType, parentName, index)
+	return c.makeRequest(HTTPMethodDELETE, path, nil, nil, version)
+}
+
+// GetBackendSwitchingRules returns the use_backend rules of a frontend
+func (c *Client) GetBackendSwitchingRules(frontend string) ([]BackendSwitchingRule, error) {
+	var rules []BackendSwitchingRule
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/backend_switching_rules", frontend)
+	err := c.makeRequest(HTTPMethodGET, path, nil, &rules, 0)
+	return rules, err
+}
+
+// CreateBackendSwitchingRule inserts a use_backend rule at the given index
+func (c *Client) CreateBackendSwitchingRule(frontend string, index int, rule *BackendSwitchingRule, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/backend_switching_rules/%d", frontend, index)
+	return c.makeRequest(HTTPMethodPOST, path, rule, nil, version)
+}
+
+// DeleteBackendSwitchingRule deletes the use_backend rule at the given index
+func (c *Client) DeleteBackendSwitchingRule(frontend string, index, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/backend_switching_rules/%d", frontend, index)
+	return c.makeRequest(HTTPMethodDELETE, path, nil, nil, version)
+}
+
+// GetStickRules returns the stick rules of a backend
+func (c *Client) GetStickRules(backend string) ([]StickRule, error) {
+	var rules []StickRule
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/stick_rules", backend)
+	err := c.makeRequest(HTTPMethodGET, path, nil, &rules, 0)
+	return rules, err
+}
+
+// CreateStickRule inserts a stick rule at the given index
+func (c *Client) CreateStickRule(backend string, index int, rule *StickRule, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/stick_rules/%d", backend, index)
+	return c.makeRequest(HTTPMethodPOST, path, rule, nil, version)
+}
+
+// DeleteStickRule deletes the stick rule at the given index
+func (c *Client) DeleteStickRule(backend string, index, version int) error {
+	path := fmt.Sprintf("/v3/services/haproxy/configuration/backends/%s/stick_rules/%d", backend, index)
+	return c.makeRequest(HTTPMethodDELETE, path, nil, nil, version)
+}
+
+// GetSSLCertificates returns all certificate files in the Data Plane API storage
+func (c *Client) GetSSLCertificates() ([]SSLCertificate, error) {
+	var certificates []SSLCertificate
+	err := c.makeRequest(HTTPMethodGET, "/v3/services/haproxy/storage/ssl_certificates", nil, &certificates, 0)
+	return certificates, err
+}
+
+// GetSSLCertificate returns a single certificate file from the Data Plane API storage
+func (c *Client) GetSSLCertificate(name string) (*SSLCertificate, error) {
+	var certificate SSLCertificate
+	path := fmt.Sprintf("/v3/services/haproxy/storage/ssl_certificates/%s", name)
+	if err := c.makeRequest(HTTPMethodGET, path, nil, &certificate, 0); err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// CreateSSLCertificate uploads a PEM file (certificate and key) to the storage under the given name
+func (c *Client) CreateSSLCertificate(name string, pem []byte) (*SSLCertificate, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file_upload", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart body: %w", err)
+	}
+	if _, err := part.Write(pem); err != nil {
+		return nil, fmt.Errorf("failed to write multipart body: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart body: %w", err)
+	}
+
+	var certificate SSLCertificate
+	err = c.makeContentRequest(HTTPMethodPOST, "/v3/services/haproxy/storage/ssl_certificates",
+		writer.FormDataContentType(), &body, &certificate)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// ReplaceSSLCertificate replaces the content of a stored certificate file
+func (c *Client) ReplaceSSLCertificate(name string, pem []byte) (*SSLCertificate, error) {
+	var certificate SSLCertificate
+	path := fmt.Sprintf("/v3/services/haproxy/storage/ssl_certificates/%s", name)
+	if err := c.makeContentRequest(HTTPMethodPUT, path, "text/plain", bytes.NewReader(pem), &certificate); err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// DeleteSSLCertificate removes a certificate file from the storage
+func (c *Client) DeleteSSLCertificate(name string) error {
+	path := fmt.Sprintf("/v3/services/haproxy/storage/ssl_certificates/%s", name)
+	return c.makeRequest(HTTPMethodDELETE, path, nil, nil, 0)
+}
+
+// makeContentRequest sends a non-JSON request body (storage uploads) and decodes the JSON response
+func (c *Client) makeContentRequest(method, path, contentType string, body io.Reader, result interface{}) error {
+	ctx, span := tracing.StartClient(c.context(), "haproxy "+method,
+		tracing.String("http.request.method", method),
+		tracing.String("url.path", path),
+		tracing.String("server.address", c.baseURL))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setAuth(req)
+	tracing.Inject(ctx, req.Header)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+	span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
+	err = decodeResponse(resp, result)
+	span.RecordError(err)
+	return err
+}
+
+// Ensure Client implements ClientInterface
+var _ ClientInterface = (*Client)(nil)
@@ -1,11 +1,17 @@
 package haproxy
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestClient_CreateBackend(t *testing.T) {
@@ -127,6 +133,51 @@ func TestClient_CreateServer(t *testing.T) {
 	}
 }
 
+func TestClient_SwapServer(t *testing.T) {
+	var calls []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/configuration/version"):
+			_, _ = w.Write([]byte("7"))
+		case r.Method == HTTPMethodPOST && strings.HasSuffix(r.URL.Path, "/transactions"):
+			calls = append(calls, "begin")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "tx-1"})
+		case r.Method == HTTPMethodDELETE:
+			if r.URL.Query().Get("transaction_id") != "tx-1" {
+				t.Errorf("Expected delete inside transaction, got %s", r.URL.String())
+			}
+			calls = append(calls, "delete "+r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == HTTPMethodPOST && strings.HasSuffix(r.URL.Path, "/backends/web/servers"):
+			if r.URL.Query().Get("transaction_id") != "tx-1" {
+				t.Errorf("Expected create inside transaction, got %s", r.URL.String())
+			}
+			var created Server
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			calls = append(calls, "create "+created.Name)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == HTTPMethodPUT && strings.HasSuffix(r.URL.Path, "/transactions/tx-1"):
+			calls = append(calls, "commit")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": "success"})
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "password")
+	newServer := &Server{Name: "web_10_0_0_2_8080", Address: "10.0.0.2", Port: 8080}
+	if err := client.SwapServer("web", "web_10_0_0_1_8080", newServer); err != nil {
+		t.Fatalf("SwapServer() failed: %v", err)
+	}
+
+	expected := []string{"begin", "delete web_10_0_0_1_8080", "create web_10_0_0_2_8080", "commit"}
+	if strings.Join(calls, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+}
+
 func TestClient_DrainServer(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != HTTPMethodPUT {
@@ -234,216 +285,82 @@ func TestClient_GetRuntimeServer(t *testing.T) {
 	}
 }
 
-func TestClient_AddFrontendRule(t *testing.T) {
-	// Track API calls to verify transaction workflow
-	var transactionCreated, aclsUpdated, rulesUpdated, transactionCommitted bool
-	var transactionID string
-
+func TestClient_GetRuntimeServers(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch {
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/configuration/version"):
-			// Mock version endpoint
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("12"))
-
-		case r.Method == HTTPMethodPOST && strings.Contains(r.URL.Path, "/transactions"):
-			// Create transaction
-			transactionCreated = true
-			transactionID = "test-tx-123"
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":       transactionID,
-				"status":   "in_progress",
-				"_version": 1,
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/https/acls"):
-			// Update ACLs
-			aclsUpdated = true
-			if r.URL.Query().Get("transaction_id") != transactionID {
-				t.Errorf("Expected transaction_id %s", transactionID)
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := []map[string]interface{}{
-				{
-					"acl_name":  "is_example_com",
-					"criterion": "hdr(host)",
-					"value":     "example.com",
-				},
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/https/backend_switching_rules"):
-			// Update backend switching rules
-			rulesUpdated = true
-			if r.URL.Query().Get("transaction_id") != transactionID {
-				t.Errorf("Expected transaction_id %s", transactionID)
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := []map[string]interface{}{
-				{
-					"cond":      "if",
-					"cond_test": "is_example_com",
-					"name":      "example_backend",
-				},
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/https/acls"):
-			// Mock getting current ACLs (empty initially)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/https/backend_switching_rules"):
-			// Mock getting current backend switching rules (empty initially)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/transactions/"+transactionID):
-			// Commit transaction
-			transactionCommitted = true
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":     transactionID,
-				"status": "success",
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		default:
-			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
-			w.WriteHeader(http.StatusNotFound)
+		if r.Method != HTTPMethodGET || r.URL.Path != "/v3/services/haproxy/runtime/backends/test-backend/servers" {
+			t.Errorf("Expected GET of the runtime servers, got %s %s", r.Method, r.URL.Path)
 		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]RuntimeServer{
+			{ServerName: "server1", OperationalState: "up"},
+			{ServerName: "server2", OperationalState: "down"},
+		})
 	}))
 	defer server.Close()
 
+	servers, err := NewClient(server.URL, "admin", "password").GetRuntimeServers("test-backend")
+	if err != nil {
+		t.Fatalf("Failed to get runtime servers: %v", err)
+	}
+	if len(servers) != 2 || servers[1].ServerName != "server2" || servers[1].OperationalState != "down" {
+		t.Errorf("Unexpected runtime servers: %+v", servers)
+	}
+}
+
+func TestClient_AddFrontendRule(t *testing.T) {
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{})
 	client := NewClient(server.URL, "admin", "password")
 
-	// This should fail initially - method doesn't exist yet
 	err := client.AddFrontendRule("https", "example.com", "example_backend")
 	if err != nil {
 		t.Fatalf("AddFrontendRule failed: %v", err)
 	}
 
-	// Verify all expected API calls were made
-	if !transactionCreated {
-		t.Error("Expected transaction to be created")
-	}
-	if !aclsUpdated {
-		t.Error("Expected ACLs to be updated")
+	expected := "[POST acls/0 POST backend_switching_rules/0]"
+	if changes := server.recordedChanges(); fmt.Sprint(changes) != expected {
+		t.Errorf("Expected changes %s, got %v", expected, changes)
 	}
-	if !rulesUpdated {
-		t.Error("Expected backend switching rules to be updated")
+	acls := server.list("https/acls")
+	if len(acls) != 1 || acls[0]["value"] != "example.com" {
+		t.Fatalf("Expected ACL for example.com, got %v", acls)
 	}
-	if !transactionCommitted {
-		t.Error("Expected transaction to be committed")
+	rules := server.list("https/backend_switching_rules")
+	if len(rules) != 1 || rules[0]["cond_test"] != acls[0]["acl_name"] || rules[0]["name"] != "example_backend" {
+		t.Errorf("Expected switching rule to example_backend, got %v", rules)
 	}
 }
 
 func TestClient_RemoveFrontendRule(t *testing.T) {
-	var transactionCreated, aclsUpdated, rulesUpdated, transactionCommitted bool
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch {
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/configuration/version"):
-			// Mock version endpoint
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("12"))
-
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/https/acls"):
-			// Mock getting current ACLs (one rule that will be removed)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := []map[string]interface{}{
-				{
-					"acl_name":  "is_example_com",
-					"criterion": "hdr(host)",
-					"value":     "example.com",
-				},
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/https/backend_switching_rules"):
-			// Mock getting current backend switching rules (one rule that will be removed)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := []map[string]interface{}{
-				{
-					"cond":      "if",
-					"cond_test": "is_example_com",
-					"name":      "example_backend",
-				},
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodPOST && strings.Contains(r.URL.Path, "/transactions"):
-			transactionCreated = true
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":       "test-tx-456",
-				"status":   "in_progress",
-				"_version": 1,
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/https/acls"):
-			aclsUpdated = true
-			// Should receive empty array when removing last rule
-			var acls []interface{}
-			_ = json.NewDecoder(r.Body).Decode(&acls)
-			if len(acls) != 0 {
-				t.Errorf("Expected empty ACL array when removing rule, got %d items", len(acls))
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/https/backend_switching_rules"):
-			rulesUpdated = true
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/transactions/"):
-			transactionCommitted = true
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":     "test-tx-456",
-				"status": "success",
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
-
+	exampleACL := managedACLName("example_backend", "example.com")
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{
+		"https/acls": {
+			{"acl_name": exampleACL, "criterion": "hdr(host)", "value": "example.com"},
+			{"acl_name": "is_static", "criterion": "path_beg", "value": "/static"},
+		},
+		"https/backend_switching_rules": {
+			{"cond": "if", "cond_test": exampleACL, "name": "example_backend"},
+			{"cond": "if", "cond_test": "is_static", "name": "static"},
+		},
+	})
 	client := NewClient(server.URL, "admin", "password")
 
-	// This should fail initially - method doesn't exist yet
 	err := client.RemoveFrontendRule("https", "example.com")
 	if err != nil {
 		t.Fatalf("RemoveFrontendRule failed: %v", err)
 	}
 
-	// Verify transaction workflow was followed
-	if !transactionCreated || !aclsUpdated || !rulesUpdated || !transactionCommitted {
-		t.Error("Expected complete transaction workflow for rule removal")
+	expected := "[DELETE backend_switching_rules/0 DELETE acls/0]"
+	if changes := server.recordedChanges(); fmt.Sprint(changes) != expected {
+		t.Errorf("Expected changes %s, got %v", expected, changes)
+	}
+	if rules := server.list("https/backend_switching_rules"); len(rules) != 1 || rules[0]["name"] != "static" {
+		t.Errorf("Expected hand-written rule to be kept, got %v", rules)
 	}
 }
 
 func TestClient_GetFrontendRules(t *testing.T) {
+	// example.com is routed by a connector-managed ACL, test.com by a hand-written one
+	managedACL := managedACLName("example_backend", "example.com")
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != HTTPMethodGET {
 			t.Errorf("Expected GET, got %s", r.Method)
@@ -455,7 +372,7 @@ func TestClient_GetFrontendRules(t *testing.T) {
 			w.WriteHeader(http.StatusOK)
 			response := []map[string]interface{}{
 				{
-					"acl_name":  "is_example_com",
+					"acl_name":  managedACL,
 					"criterion": "hdr(host)",
 					"value":     "example.com",
 				},
@@ -473,7 +390,7 @@ func TestClient_GetFrontendRules(t *testing.T) {
 			response := []map[string]interface{}{
 				{
 					"cond":      "if",
-					"cond_test": "is_example_com",
+					"cond_test": managedACL,
 					"name":      "example_backend",
 				},
 				{
@@ -484,6 +401,10 @@ func TestClient_GetFrontendRules(t *testing.T) {
 			}
 			_ = json.NewEncoder(w).Encode(response)
 
+		case strings.Contains(r.URL.Path, "/http_request_rules"):
+			// No http-request rules
+			_ = json.NewEncoder(w).Encode([]interface{}{})
+
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
@@ -499,8 +420,8 @@ func TestClient_GetFrontendRules(t *testing.T) {
 	}
 
 	expectedRules := []FrontendRule{
-		{Domain: "example.com", Backend: "example_backend"},
-		{Domain: "test.com", Backend: "test_backend"},
+		{Domain: "example.com", Backend: "example_backend", Managed: true},
+		{Domain: "test.com", Backend: "test_backend", Managed: false},
 	}
 
 	if len(rules) != len(expectedRules) {
@@ -514,86 +435,17 @@ func TestClient_GetFrontendRules(t *testing.T) {
 		if rule.Backend != expectedRules[i].Backend {
 			t.Errorf("Expected backend %s, got %s", expectedRules[i].Backend, rule.Backend)
 		}
+		if rule.Managed != expectedRules[i].Managed {
+			t.Errorf("Expected managed %v for %s, got %v", expectedRules[i].Managed, rule.Domain, rule.Managed)
+		}
 	}
 }
 
 func TestClient_AddFrontendRuleWithType_RegexDomain(t *testing.T) {
 	// This test verifies that regex domains get the -m reg flag in ACL
-	var capturedACL map[string]interface{}
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch {
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/configuration/version"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("12"))
-
-		case r.Method == HTTPMethodPOST && strings.Contains(r.URL.Path, "/transactions"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":       "test-tx-regex",
-				"status":   "in_progress",
-				"_version": 1,
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/http/acls"):
-			// Capture the ACL being set to verify the fix
-			var acls []map[string]interface{}
-			err := json.NewDecoder(r.Body).Decode(&acls)
-			if err != nil {
-				t.Errorf("Failed to decode ACL request: %v", err)
-				return
-			}
-			if len(acls) > 0 {
-				capturedACL = acls[0]
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode(acls)
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/http/backend_switching_rules"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := []map[string]interface{}{
-				{
-					"cond":      "if",
-					"cond_test": "is_test_backend_service_60d0d8c1",
-					"name":      "test_backend_service",
-				},
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/http/acls"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/http/backend_switching_rules"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/transactions/test-tx-regex"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":     "test-tx-regex",
-				"status": "success",
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		default:
-			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
-
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{})
 	client := NewClient(server.URL, "admin", "password")
 
-	// Test with regex domain pattern - should add match_method: "reg"
 	regexDomain := "^(api\\.|www\\.)?test-regex\\.com$"
 	backend := "test_backend_service"
 
@@ -602,94 +454,24 @@ func TestClient_AddFrontendRuleWithType_RegexDomain(t *testing.T) {
 		t.Fatalf("AddFrontendRuleWithType failed: %v", err)
 	}
 
-	// Verify the ACL includes match_method: "reg" for regex domains
-	if capturedACL == nil {
-		t.Fatal("No ACL was captured")
+	acls := server.list("http/acls")
+	if len(acls) != 1 {
+		t.Fatalf("Expected 1 ACL, got %v", acls)
 	}
-
-	// Check required fields
-	if capturedACL["criterion"] != "hdr(host)" {
-		t.Errorf("Expected criterion 'hdr(host)', got %v", capturedACL["criterion"])
+	if acls[0]["criterion"] != "hdr(host)" {
+		t.Errorf("Expected criterion 'hdr(host)', got %v", acls[0]["criterion"])
 	}
 	expectedValue := "-m reg " + regexDomain
-	if capturedACL["value"] != expectedValue {
-		t.Errorf("Expected value '%s', got %v", expectedValue, capturedACL["value"])
-	}
-
-	// CRITICAL: Check that the value contains -m reg for regex domains
-	if !strings.Contains(capturedACL["value"].(string), "-m reg") {
-		t.Errorf("Expected value to contain '-m reg' for regex domain, got %v", capturedACL["value"])
+	if acls[0]["value"] != expectedValue {
+		t.Errorf("Expected value '%s', got %v", expectedValue, acls[0]["value"])
 	}
 }
 
 func TestClient_AddFrontendRuleWithType_ExactDomain(t *testing.T) {
 	// This test verifies that exact domains do NOT get the -m reg flag
-	var capturedACL map[string]interface{}
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch {
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/configuration/version"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("12"))
-
-		case r.Method == HTTPMethodPOST && strings.Contains(r.URL.Path, "/transactions"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":       "test-tx-exact",
-				"status":   "in_progress",
-				"_version": 1,
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/http/acls"):
-			var acls []map[string]interface{}
-			err := json.NewDecoder(r.Body).Decode(&acls)
-			if err != nil {
-				t.Errorf("Failed to decode ACL request: %v", err)
-				return
-			}
-			if len(acls) > 0 {
-				capturedACL = acls[0]
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode(acls)
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/http/backend_switching_rules"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/http/acls"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/http/backend_switching_rules"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
-
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/transactions/test-tx-exact"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":     "test-tx-exact",
-				"status": "success",
-			}
-			_ = json.NewEncoder(w).Encode(response)
-
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer server.Close()
-
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{})
 	client := NewClient(server.URL, "admin", "password")
 
-	// Test with exact domain - should NOT have match_method
 	exactDomain := "example.com"
 	backend := "example_backend"
 
@@ -698,118 +480,860 @@ func TestClient_AddFrontendRuleWithType_ExactDomain(t *testing.T) {
 		t.Fatalf("AddFrontendRuleWithType failed: %v", err)
 	}
 
-	// Verify the ACL does NOT include match_method for exact domains
-	if capturedACL == nil {
-		t.Fatal("No ACL was captured")
+	acls := server.list("http/acls")
+	if len(acls) != 1 {
+		t.Fatalf("Expected 1 ACL, got %v", acls)
 	}
-
-	if capturedACL["criterion"] != "hdr(host)" {
-		t.Errorf("Expected criterion 'hdr(host)', got %v", capturedACL["criterion"])
+	if acls[0]["criterion"] != "hdr(host)" {
+		t.Errorf("Expected criterion 'hdr(host)', got %v", acls[0]["criterion"])
 	}
-	if capturedACL["value"] != exactDomain {
-		t.Errorf("Expected value '%s', got %v", exactDomain, capturedACL["value"])
+	if acls[0]["value"] != exactDomain {
+		t.Errorf("Expected value '%s', got %v", exactDomain, acls[0]["value"])
 	}
-
-	// CRITICAL: Check that match_method is NOT set for exact domains
-	if _, hasMatchMethod := capturedACL["match_method"]; hasMatchMethod {
-		t.Errorf("Expected no match_method for exact domain, but got %v", capturedACL["match_method"])
+	if _, hasMatchMethod := acls[0]["match_method"]; hasMatchMethod {
+		t.Errorf("Expected no match_method for exact domain, but got %v", acls[0]["match_method"])
 	}
 }
 
 func TestClient_AddFrontendRule_RegexDomain(t *testing.T) {
 	// This test verifies that ACL names are generated from backend names, not domain patterns
-	// The fix should use backend name to create valid ACL names
-	var capturedACLName string
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{})
+	client := NewClient(server.URL, "admin", "password")
 
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch {
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/configuration/version"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("12"))
+	regexDomain := "^(www\\.)?ps-webforge\\.com$"
+	backend := "ps_webforge"
 
-		case r.Method == HTTPMethodPOST && strings.Contains(r.URL.Path, "/transactions"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":       "test-tx-regex",
-				"status":   "in_progress",
-				"_version": 1,
-			}
-			_ = json.NewEncoder(w).Encode(response)
+	if err := client.AddFrontendRule("https", regexDomain, backend); err != nil {
+		t.Errorf("Expected success with fixed ACL name, but got error: %v", err)
+	}
 
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/https/acls"):
-			// Capture the ACL being set to verify the bug
-			var acls []map[string]interface{}
-			err := json.NewDecoder(r.Body).Decode(&acls)
-			if err != nil {
-				t.Errorf("Failed to decode ACL request: %v", err)
-				return
-			}
-			if len(acls) > 0 {
-				if name, ok := acls[0]["acl_name"].(string); ok {
-					capturedACLName = name
-				}
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode(acls)
+	expectedACLName := "is_ps_webforge_36fa0b03"
+	acls := server.list("https/acls")
+	if len(acls) != 1 || acls[0]["acl_name"] != expectedACLName {
+		t.Errorf("Expected ACL name %s, got %v", expectedACLName, acls)
+	}
+	rules := server.list("https/backend_switching_rules")
+	if len(rules) != 1 || rules[0]["cond_test"] != expectedACLName {
+		t.Errorf("Expected switching rule on %s, got %v", expectedACLName, rules)
+	}
+}
 
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/frontends/https/backend_switching_rules"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := []map[string]interface{}{
-				{
-					"cond":      "if",
-					"cond_test": capturedACLName,
-					"name":      "ps_webforge",
-				},
+func TestClient_SetFrontendRule_WithAuth(t *testing.T) {
+	otherACL := "is_other_" + hashDomain("other.example.com")
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{
+		"https/acls":                    {{"acl_name": otherACL, "criterion": "hdr(host)", "value": "other.example.com"}},
+		"https/backend_switching_rules": {{"cond": "if", "cond_test": otherACL, "name": "other"}},
+		"https/http_request_rules": {
+			{"type": "set-header", "hdr_name": "X-Forwarded-Proto", "hdr_format": "https"},
+			{"type": "auth", "auth_realm": "other", "cond": "if", "cond_test": otherACL + " !{ http_auth(ops) }"},
+		},
+	})
+	client := NewClient(server.URL, "admin", "password")
+
+	rule := FrontendRule{Domain: "staging.example.com", Backend: "staging", Type: DomainTypeExact, AuthUserlist: "auth_staging"}
+	if err := client.SetFrontendRule("https", rule); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+
+	expected := "[POST acls/1 POST backend_switching_rules/1 POST http_request_rules/2]"
+	if changes := server.recordedChanges(); fmt.Sprint(changes) != expected {
+		t.Errorf("Expected changes %s, got %v", expected, changes)
+	}
+	requestRules := server.list("https/http_request_rules")
+	if len(requestRules) != 3 {
+		t.Fatalf("Expected 3 http-request rules, got %+v", requestRules)
+	}
+	expectedCond := "is_staging_" + hashDomain("staging.example.com") + " !{ http_auth(auth_staging) }"
+	if requestRules[2]["type"] != "auth" || requestRules[2]["cond_test"] != expectedCond {
+		t.Errorf("Expected auth rule %q, got %+v", expectedCond, requestRules[2])
+	}
+}
+
+func TestClient_SetFrontendRule_WithCanary(t *testing.T) {
+	appACL := "is_app_" + hashDomain("app.example.com")
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{
+		"https/acls": {{"acl_name": appACL, "criterion": "hdr(host)", "value": "app.example.com"}},
+		"https/backend_switching_rules": {
+			{"cond": "if", "cond_test": appACL + " { rand(100) lt 20 }", "name": "app_canary"},
+			{"cond": "if", "cond_test": appACL, "name": "app"},
+		},
+	})
+	client := NewClient(server.URL, "admin", "password")
+
+	rules, err := client.GetFrontendRules("https")
+	if err != nil {
+		t.Fatalf("GetFrontendRules() failed: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Backend != "app" || rules[0].CanaryBackend != "app_canary" || rules[0].CanaryPercent != 20 {
+		t.Fatalf("Expected app rule with 20%% canary, got %+v", rules)
+	}
+
+	rules[0].CanaryPercent = 50
+	if err := client.SetFrontendRule("https", rules[0]); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+	if changes := server.recordedChanges(); fmt.Sprint(changes) != "[PUT backend_switching_rules/0]" {
+		t.Errorf("Expected only the canary rule to be replaced, got %v", changes)
+	}
+	switchingRules := server.list("https/backend_switching_rules")
+	if switchingRules[0]["cond_test"] != appACL+" { rand(100) lt 50 }" || switchingRules[0]["name"] != "app_canary" {
+		t.Errorf("Expected canary rule first, got %+v", switchingRules[0])
+	}
+	if switchingRules[1]["cond_test"] != appACL || switchingRules[1]["name"] != "app" {
+		t.Errorf("Expected stable rule second, got %+v", switchingRules[1])
+	}
+}
+
+func TestClient_EnsureUserlistUser(t *testing.T) {
+	var calls []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/configuration/version"):
+			_, _ = w.Write([]byte("3"))
+		case r.Method == HTTPMethodGET && strings.HasSuffix(r.URL.Path, "/users"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == HTTPMethodPOST && strings.HasSuffix(r.URL.Path, "/transactions"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "tx-1"})
+		case r.Method == HTTPMethodPOST && strings.HasSuffix(r.URL.Path, "/userlists"):
+			var userlist Userlist
+			_ = json.NewDecoder(r.Body).Decode(&userlist)
+			calls = append(calls, "create userlist "+userlist.Name)
+		case r.Method == HTTPMethodPOST && strings.HasSuffix(r.URL.Path, "/users"):
+			var user User
+			_ = json.NewDecoder(r.Body).Decode(&user)
+			if !user.SecurePassword || r.URL.Query().Get("userlist") != "auth_staging" {
+				t.Errorf("Expected secure password user in auth_staging, got %+v (%s)", user, r.URL.RawQuery)
 			}
-			_ = json.NewEncoder(w).Encode(response)
+			calls = append(calls, "create user "+user.Username)
+		case r.Method == HTTPMethodPUT && strings.HasSuffix(r.URL.Path, "/transactions/tx-1"):
+			calls = append(calls, "commit")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
 
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/https/acls"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
+	client := NewClient(server.URL, "admin", "password")
+	if err := client.EnsureUserlistUser("auth_staging", "admin", "$5$hash"); err != nil {
+		t.Fatalf("EnsureUserlistUser() failed: %v", err)
+	}
 
-		case r.Method == HTTPMethodGET && strings.Contains(r.URL.Path, "/frontends/https/backend_switching_rules"):
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode([]interface{}{})
+	expected := []string{"create userlist auth_staging", "create user admin", "commit"}
+	if strings.Join(calls, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+	}
+}
 
-		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/transactions/test-tx-regex"):
-			// With the fix, this should now succeed
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			response := map[string]interface{}{
-				"id":     "test-tx-regex",
-				"status": "success",
+func TestClient_EnsureUserlistUser_ListFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != HTTPMethodGET || !strings.HasSuffix(r.URL.Path, "/users") {
+			t.Errorf("Expected nothing to be changed after the failed listing, got %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	options := DefaultClientOptions()
+	options.RetryAttempts = 0
+	err := NewClientWithOptions(server.URL, "admin", "password", options).EnsureUserlistUser("auth_staging", "admin", "$5$hash")
+	if err == nil || statusCode(err) != http.StatusUnauthorized {
+		t.Errorf("Expected the listing error to be returned, got %v", err)
+	}
+}
+
+func TestClient_CreateSSLCertificate(t *testing.T) {
+	pem := []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != HTTPMethodPOST || r.URL.Path != "/v3/services/haproxy/storage/ssl_certificates" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+
+		file, header, err := r.FormFile("file_upload")
+		if err != nil {
+			t.Fatalf("Expected multipart file_upload: %v", err)
+		}
+		defer file.Close()
+		if header.Filename != "example.com.pem" {
+			t.Errorf("Expected filename example.com.pem, got %s", header.Filename)
+		}
+		content, _ := io.ReadAll(file)
+		if string(content) != string(pem) {
+			t.Errorf("Unexpected upload content %q", content)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(SSLCertificate{StorageName: header.Filename, SHA256FingerPrint: "ABCD"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "password")
+	certificate, err := client.CreateSSLCertificate("example.com.pem", pem)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if certificate.StorageName != "example.com.pem" || certificate.SHA256FingerPrint != "ABCD" {
+		t.Errorf("Unexpected certificate %+v", certificate)
+	}
+}
+
+func TestClient_ReplaceSSLCertificate(t *testing.T) {
+	pem := []byte("-----BEGIN CERTIFICATE-----\nMIIC\n-----END CERTIFICATE-----\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != HTTPMethodPUT || r.URL.Path != "/v3/services/haproxy/storage/ssl_certificates/example.com.pem" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != "text/plain" {
+			t.Errorf("Expected text/plain body, got %s", contentType)
+		}
+		content, _ := io.ReadAll(r.Body)
+		if string(content) != string(pem) {
+			t.Errorf("Unexpected body %q", content)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SSLCertificate{StorageName: "example.com.pem"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "password")
+	if _, err := client.ReplaceSSLCertificate("example.com.pem", pem); err != nil {
+		t.Fatalf("Failed to replace certificate: %v", err)
+	}
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Header().Set(HTTPHeaderRetryAfter, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("7"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "password")
+	version, err := client.GetConfigVersion()
+	if err != nil {
+		t.Fatalf("GetConfigVersion() failed: %v", err)
+	}
+	if version != 7 || attempts != 3 {
+		t.Errorf("Expected version 7 after 3 attempts, got %d after %d", version, attempts)
+	}
+}
+
+func TestClient_RetryAfterExhausted(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set(HTTPHeaderRetryAfter, "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	opts := DefaultClientOptions()
+	opts.RetryAttempts = 1
+	opts.MaxRetryAfter = time.Millisecond
+	client := NewClientWithOptions(server.URL, "admin", "password", opts)
+
+	if _, err := client.GetBackends(); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("Expected 429 error once retries are exhausted, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+// newRetryTestClient creates a client that retries without noticeable backoff
+func newRetryTestClient(url string) *Client {
+	opts := DefaultClientOptions()
+	opts.RetryBackoff = time.Millisecond
+	opts.MaxRetryBackoff = time.Millisecond
+	return NewClientWithOptions(url, "admin", "password", opts)
+}
+
+func TestClient_RetryServerErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]Backend{{Name: "web"}})
+	}))
+	defer server.Close()
+
+	backends, err := newRetryTestClient(server.URL).GetBackends()
+	if err != nil {
+		t.Fatalf("GetBackends() failed: %v", err)
+	}
+	if len(backends) != 1 || attempts != 3 {
+		t.Errorf("Expected backends after 3 attempts, got %v after %d", backends, attempts)
+	}
+}
+
+func TestClient_NoRetryOnClientErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"code":409,"message":"object web already exists"}`))
+	}))
+	defer server.Close()
+
+	_, err := newRetryTestClient(server.URL).CreateBackend(Backend{Name: "web"}, 3)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected conflict error with body, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected a single attempt for a conflict that is no version mismatch, got %d", attempts)
+	}
+}
+
+func TestClient_VersionConflictReturnedToCaller(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"code":409,"message":"version mismatch, expected 4, got 3"}`))
+	}))
+	defer server.Close()
+
+	_, err := newRetryTestClient(server.URL).CreateServer("web", &Server{Name: "srv"}, 3)
+	if !IsVersionConflict(err) {
+		t.Fatalf("Expected the version conflict to be returned, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected the request not to be sent again with another version, got %d attempts", attempts)
+	}
+}
+
+func TestClient_NoRetryOfPostAfterServerError(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := newRetryTestClient(server.URL)
+	if _, err := client.CreateBackend(Backend{Name: "web"}, 3); err == nil {
+		t.Fatal("Expected the server error to be returned")
+	}
+	if attempts != 1 {
+		t.Errorf("Expected a POST that may have been applied not to be sent again, got %d attempts", attempts)
+	}
+
+	attempts = 0
+	if err := client.DeleteServer("web", "srv", 3); err == nil || attempts != 4 {
+		t.Errorf("Expected the idempotent DELETE to be retried, got %d attempts (err: %v)", attempts, err)
+	}
+}
+
+func TestClient_RetryPostNeverSent(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := newRetryTestClient("http://" + addr)
+	_, err = client.CreateBackend(Backend{Name: "web"}, 3)
+	if err == nil || !neverSent(err) {
+		t.Fatalf("Expected a refused connection to be recognized as never sent, got %v", err)
+	}
+	if _, retry := client.retryDelay(0, HTTPMethodPOST, nil, err); !retry {
+		t.Error("Expected a POST that never reached the Data Plane API to be retried")
+	}
+}
+
+func TestClient_RetryWaitCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTPHeaderRetryAfter, "30")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := NewClient(server.URL, "admin", "password").WithContext(ctx).GetBackends()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the retry wait to end with the context, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected the retry wait to be interrupted, took %s", elapsed)
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	opts := DefaultClientOptions()
+	opts.RetryBackoff = 100 * time.Millisecond
+	opts.MaxRetryBackoff = 300 * time.Millisecond
+	client := NewClientWithOptions("http://localhost", "admin", "password", opts)
+
+	tests := []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{2, 300 * time.Millisecond},
+		{10, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if wait := client.backoff(tt.attempt); wait < tt.expected/2 || wait > tt.expected {
+				t.Errorf("backoff(%d) = %v, expected between %v and %v", tt.attempt, wait, tt.expected/2, tt.expected)
 			}
-			_ = json.NewEncoder(w).Encode(response)
+		}
+	}
+}
+
+func TestClient_CommitTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == HTTPMethodPUT {
+			// A slow commit outlasting the regular request timeout
+			time.Sleep(100 * time.Millisecond)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "tx-1"})
+	}))
+	defer server.Close()
 
+	opts := DefaultClientOptions()
+	opts.Timeout = 50 * time.Millisecond
+	opts.CommitTimeout = time.Second
+	opts.RetryBackoff = time.Millisecond
+	client := NewClientWithOptions(server.URL, "admin", "password", opts)
+
+	if err := client.commitTransaction("tx-1"); err != nil {
+		t.Errorf("Expected commit to use the commit timeout, got %v", err)
+	}
+	if err := client.makeRequest(HTTPMethodPUT, "/v3/services/haproxy/configuration/backends/web", nil, nil, 0); err == nil {
+		t.Error("Expected regular request to time out")
+	}
+}
+
+func TestClient_ReadWriteCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		expected := "writer:write-secret"
+		if r.Method == HTTPMethodGET {
+			expected = "reader:read-secret"
+		}
+		if username+":"+password != expected {
+			t.Errorf("Expected %s credentials for %s, got %s:%s", expected, r.Method, username, password)
+		}
+		if r.Method == HTTPMethodGET {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+	}))
+	defer server.Close()
+
+	opts := DefaultClientOptions()
+	opts.ReadUsername, opts.ReadPassword = "reader", "read-secret"
+	client := NewClientWithOptions(server.URL, "writer", "write-secret", opts)
+
+	if _, err := client.GetBackends(); err != nil {
+		t.Fatalf("GetBackends() failed: %v", err)
+	}
+	if _, err := client.CreateBackend(Backend{Name: "web"}, 1); err != nil {
+		t.Fatalf("CreateBackend() failed: %v", err)
+	}
+	if err := client.DeleteBackend("web", 2); err != nil {
+		t.Fatalf("DeleteBackend() failed: %v", err)
+	}
+}
+
+func TestClient_ReadCredentialsFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "admin" || password != "password" {
+			t.Errorf("Expected read-write credentials without read-only ones, got %s:%s", username, password)
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "password")
+	if _, err := client.GetBackends(); err != nil {
+		t.Fatalf("GetBackends() failed: %v", err)
+	}
+}
+
+func TestClient_GetRawConfiguration(t *testing.T) {
+	raw := "global\n    daemon\n"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{name: "plain text", contentType: "text/plain", body: raw},
+		{name: "json string", contentType: "application/json", body: `"global\n    daemon\n"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v3/services/haproxy/configuration/raw" {
+					t.Errorf("Unexpected request: %s", r.URL.Path)
+				}
+				w.Header().Set("Content-Type", tt.contentType)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			config, err := NewClient(server.URL, "admin", "password").GetRawConfiguration()
+			if err != nil {
+				t.Fatalf("GetRawConfiguration() failed: %v", err)
+			}
+			if config != raw {
+				t.Errorf("Expected %q, got %q", raw, config)
+			}
+		})
+	}
+}
+
+func TestClient_UpdateFrontendLogging(t *testing.T) {
+	var replaced map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case HTTPMethodGET:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"name": "https", "mode": "http", "maxconn": 2000, "log_format": "%ci %b", "httplog": false,
+			})
+		case HTTPMethodPUT:
+			if r.URL.Query().Get("version") != "5" {
+				t.Errorf("Expected version 5, got %s", r.URL.RawQuery)
+			}
+			_ = json.NewDecoder(r.Body).Decode(&replaced)
+			_ = json.NewEncoder(w).Encode(replaced)
 		default:
 			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
-			w.WriteHeader(http.StatusNotFound)
 		}
 	}))
 	defer server.Close()
 
 	client := NewClient(server.URL, "admin", "password")
+	if err := client.UpdateFrontendLogging(&Frontend{Name: "https", HTTPLog: true}, 5); err != nil {
+		t.Fatalf("UpdateFrontendLogging() failed: %v", err)
+	}
 
-	// Test with regex domain pattern that causes the production bug
-	regexDomain := "^(www\\.)?ps-webforge\\.com$"
-	backend := "ps_webforge"
+	if replaced["maxconn"] != float64(2000) || replaced["mode"] != "http" {
+		t.Errorf("Expected other frontend settings to be kept, got %v", replaced)
+	}
+	if replaced["httplog"] != true {
+		t.Errorf("Expected option httplog, got %v", replaced)
+	}
+	if _, ok := replaced["log_format"]; ok {
+		t.Errorf("Expected previous log-format to be removed, got %v", replaced)
+	}
+}
 
-	err := client.AddFrontendRule("https", regexDomain, backend)
+func TestClient_SetFrontendDefaultBackend(t *testing.T) {
+	var replaced map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case HTTPMethodGET:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "https", "mode": "http", "maxconn": 2000})
+		case HTTPMethodPUT:
+			_ = json.NewDecoder(r.Body).Decode(&replaced)
+			_ = json.NewEncoder(w).Encode(replaced)
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
 
-	// The test should succeed with the fix
+	client := NewClient(server.URL, "admin", "password")
+	if err := client.SetFrontendDefaultBackend("https", "not_found", 5); err != nil {
+		t.Fatalf("SetFrontendDefaultBackend() failed: %v", err)
+	}
+	if replaced["default_backend"] != "not_found" || replaced["maxconn"] != float64(2000) {
+		t.Errorf("Expected the default backend to be set and other settings kept, got %v", replaced)
+	}
+}
+
+func TestClient_TransactionRetryOnVersionConflict(t *testing.T) {
+	tests := []struct {
+		name            string
+		commitStatus    int
+		commitBody      string
+		expectError     bool
+		expectedCommits int
+	}{
+		{name: "version mismatch is retried", commitStatus: http.StatusConflict,
+			commitBody: `{"code":409,"message":"version mismatch"}`, expectedCommits: 2},
+		{name: "other failures are not retried", commitStatus: http.StatusBadRequest,
+			commitBody: `{"code":400,"message":"invalid configuration"}`, expectError: true, expectedCommits: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transactions, commits, discarded int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == HTTPMethodGET && strings.HasSuffix(r.URL.Path, "/configuration/version"):
+					_, _ = fmt.Fprintf(w, "%d", 3+transactions)
+				case r.Method == HTTPMethodPOST && strings.HasSuffix(r.URL.Path, "/transactions"):
+					transactions++
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": fmt.Sprintf("tx-%d", transactions)})
+				case r.Method == HTTPMethodDELETE && strings.Contains(r.URL.Path, "/transactions/"):
+					discarded++
+					w.WriteHeader(http.StatusNoContent)
+				case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/transactions/"):
+					commits++
+					if commits == 1 {
+						w.WriteHeader(tt.commitStatus)
+						_, _ = w.Write([]byte(tt.commitBody))
+						return
+					}
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+				case r.Method == HTTPMethodGET:
+					_ = json.NewEncoder(w).Encode([]map[string]interface{}{})
+				default:
+					// ACLs and backend switching rules
+					_ = json.NewEncoder(w).Encode([]map[string]interface{}{})
+				}
+			}))
+			defer server.Close()
+
+			client := newRetryTestClient(server.URL)
+			err := client.SetFrontendRule("https", FrontendRule{Domain: "app.example.com", Backend: "app"})
+			if (err != nil) != tt.expectError {
+				t.Fatalf("SetFrontendRule() error = %v, expectError %v", err, tt.expectError)
+			}
+			if commits != tt.expectedCommits || transactions != tt.expectedCommits {
+				t.Errorf("Expected %d transactions and commits, got %d and %d", tt.expectedCommits, transactions, commits)
+			}
+			if discarded != 1 {
+				t.Errorf("Expected the failed transaction to be discarded, got %d deletions", discarded)
+			}
+		})
+	}
+}
+
+func TestClient_TransactionDeletedWhenChangeFails(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == HTTPMethodGET && strings.HasSuffix(r.URL.Path, "/configuration/version"):
+			_, _ = w.Write([]byte("3"))
+		case r.Method == HTTPMethodPOST && strings.HasSuffix(r.URL.Path, "/transactions"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "tx-1"})
+		case r.Method == HTTPMethodDELETE && strings.Contains(r.URL.Path, "/transactions/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v3/services/haproxy/transactions/"))
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == HTTPMethodPUT && strings.Contains(r.URL.Path, "/transactions/"):
+			t.Error("Expected the failed change not to be committed")
+		case r.Method == HTTPMethodGET:
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{})
+		default:
+			// Creating the ACL fails
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":400,"message":"invalid acl"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := newRetryTestClient(server.URL)
+	err := client.AddFrontendRuleWithType("https", "app.example.com", "app", DomainTypeExact)
+	if err == nil {
+		t.Fatal("Expected AddFrontendRuleWithType() to fail")
+	}
+	if len(deleted) != 1 || deleted[0] != "tx-1" {
+		t.Errorf("Expected transaction tx-1 to be deleted, got %v", deleted)
+	}
+}
+
+func TestClient_DeleteStaleTransactions(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == HTTPMethodGET && strings.HasSuffix(r.URL.Path, "/configuration/version"):
+			_, _ = w.Write([]byte("7"))
+		case r.Method == HTTPMethodGET && strings.HasSuffix(r.URL.Path, "/transactions"):
+			if r.URL.Query().Get("status") != TransactionStatusInProgress {
+				t.Errorf("Expected in_progress filter, got %q", r.URL.RawQuery)
+			}
+			_ = json.NewEncoder(w).Encode([]Transaction{
+				{ID: "stale", Version: 5, Status: TransactionStatusInProgress},
+				{ID: "current", Version: 7, Status: TransactionStatusInProgress},
+				{ID: "failed", Version: 4, Status: "failed"},
+			})
+		case r.Method == HTTPMethodDELETE:
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/v3/services/haproxy/transactions/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "pass")
+	count, err := client.DeleteStaleTransactions()
 	if err != nil {
-		t.Errorf("Expected success with fixed ACL name, but got error: %v", err)
+		t.Fatalf("DeleteStaleTransactions() failed: %v", err)
+	}
+	if count != 1 || len(deleted) != 1 || deleted[0] != "stale" {
+		t.Errorf("Expected only the outdated transaction to be deleted, got %d %v", count, deleted)
+	}
+}
+
+func TestClient_UpdateServers(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/configuration/version"):
+			_, _ = w.Write([]byte("3"))
+		case r.Method == HTTPMethodPOST && strings.HasSuffix(r.URL.Path, "/transactions"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "tx-1"})
+		case r.Method == HTTPMethodPUT && strings.HasSuffix(r.URL.Path, "/transactions/tx-1"):
+			requests = append(requests, "commit")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+		default:
+			if r.URL.Query().Get("transaction_id") != "tx-1" {
+				t.Errorf("Expected %s %s to be part of the transaction", r.Method, r.URL.Path)
+			}
+			requests = append(requests, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "pass")
+	err := client.UpdateServers("web", []string{"web_old"}, []Server{{Name: "web_1"}, {Name: "web_2"}})
+	if err != nil {
+		t.Fatalf("UpdateServers() failed: %v", err)
+	}
+
+	expected := []string{
+		"DELETE /v3/services/haproxy/configuration/backends/web/servers/web_old",
+		"POST /v3/services/haproxy/configuration/backends/web/servers",
+		"POST /v3/services/haproxy/configuration/backends/web/servers",
+		"commit",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected requests %v, got %v", expected, requests)
+	}
+}
+
+func TestClient_ReplaceServer(t *testing.T) {
+	var method, path string
+	var body Server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "pass")
+	err := client.ReplaceServer("web", &Server{Name: "web_slot1", Address: "10.0.0.1", Port: 8080, Maintenance: "disabled"}, 3)
+	if err != nil {
+		t.Fatalf("ReplaceServer() failed: %v", err)
+	}
+
+	if method != HTTPMethodPUT || path != "/v3/services/haproxy/configuration/backends/web/servers/web_slot1" {
+		t.Errorf("Expected PUT of the server, got %s %s", method, path)
 	}
+	if body.Address != "10.0.0.1" || body.Maintenance != "disabled" {
+		t.Errorf("Expected the new address out of maintenance, got %+v", body)
+	}
+}
 
-	// Verify that the ACL name uses backend + domain hash format (the fix)
-	expectedFixedACLName := "is_ps_webforge_36fa0b03"
-	if capturedACLName != expectedFixedACLName {
-		t.Errorf("Expected fixed ACL name %s, got %s", expectedFixedACLName, capturedACLName)
+func TestClient_GetStickTableEntries(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"key":"https/api","http_req_cnt":42,"http_req_rate":3,"use":0}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "pass")
+	entries, err := client.GetStickTableEntries("domain_hits")
+	if err != nil {
+		t.Fatalf("GetStickTableEntries() failed: %v", err)
+	}
+
+	if path != "/v3/services/haproxy/runtime/stick_tables/domain_hits/entries" {
+		t.Errorf("Expected the runtime stick table entries path, got %s", path)
+	}
+	if len(entries) != 1 || entries[0].Key != "https/api" || entries[0].HTTPReqCnt != 42 || entries[0].HTTPReqRate != 3 {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestClient_EnsureFrontend(t *testing.T) {
+	tests := []struct {
+		name     string
+		exists   bool
+		binds    []Bind
+		expected []string
+	}{
+		{name: "missing frontend is created with its bind in one transaction", expected: []string{
+			"POST /frontends", "POST /frontends/tcp_db/binds",
+		}},
+		{name: "missing bind is created", exists: true, expected: []string{"POST /frontends/tcp_db/binds"}},
+		{name: "bind on the old port is replaced, binds written by hand are kept", exists: true,
+			binds:    []Bind{{Name: "tcp_db_5432", Address: "*", Port: 5432}, {Name: "manual", Address: "*", Port: 9000}},
+			expected: []string{"DELETE /frontends/tcp_db/binds/tcp_db_5432", "POST /frontends/tcp_db/binds"}},
+		{name: "changed address is replaced", exists: true,
+			binds:    []Bind{{Name: "tcp_db_6543", Address: "10.0.0.1", Port: 6543}},
+			expected: []string{"PUT /frontends/tcp_db/binds/tcp_db_6543"}},
+		{name: "nothing to change", exists: true, binds: []Bind{{Name: "tcp_db_6543", Address: "*", Port: 6543}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path := strings.TrimPrefix(r.URL.Path, "/v3/services/haproxy/configuration")
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/configuration/version"):
+					_, _ = w.Write([]byte("3"))
+				case strings.HasSuffix(r.URL.Path, "/transactions"):
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "tx-1"})
+				case strings.Contains(r.URL.Path, "/transactions/"):
+					_ = json.NewEncoder(w).Encode(map[string]interface{}{})
+				case r.Method == HTTPMethodGET && path == "/frontends/tcp_db":
+					if !tt.exists {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					_ = json.NewEncoder(w).Encode(Frontend{Name: "tcp_db"})
+				case r.Method == HTTPMethodGET && path == "/frontends/tcp_db/binds":
+					_ = json.NewEncoder(w).Encode(tt.binds)
+				default:
+					if r.URL.Query().Get("transaction_id") != "tx-1" {
+						t.Errorf("Expected %s %s in the transaction", r.Method, path)
+					}
+					changes = append(changes, r.Method+" "+path)
+					w.WriteHeader(http.StatusCreated)
+				}
+			}))
+			defer server.Close()
+
+			frontend := &Frontend{Name: "tcp_db", Mode: "tcp", DefaultBackend: "db"}
+			changed, err := NewClient(server.URL, "admin", "password").EnsureFrontend(frontend,
+				[]Bind{{Name: "tcp_db_6543", Address: "*", Port: 6543}})
+			if err != nil {
+				t.Fatalf("EnsureFrontend() failed: %v", err)
+			}
+			if strings.Join(changes, ", ") != strings.Join(tt.expected, ", ") || changed != (len(tt.expected) > 0) {
+				t.Errorf("Expected changes %v, got %v (changed: %v)", tt.expected, changes, changed)
+			}
+		})
 	}
 }
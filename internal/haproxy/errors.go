@@ -0,0 +1,94 @@
+package haproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is an error response of the Data Plane API. Callers classify it with IsNotFound,
+// IsConflict, IsBadRequest and IsRetryable instead of matching its message.
+type APIError struct {
+	StatusCode int    `json:"status_code"`
+	Message    string `json:"message"` // Message of the error body, the whole body if it isn't JSON
+	Body       string `json:"-"`       // Raw response body
+	Retryable  bool   `json:"-"`       // The request may succeed when sent again: 5xx, 429 and version conflicts (on the current version)
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+// newAPIError creates the error of a failed response from its status and body. The Data Plane API
+// reports errors as {"code": ..., "message": ...}.
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Body: string(body), Message: strings.TrimSpace(string(body))}
+	var errorBody struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &errorBody); err == nil && errorBody.Message != "" {
+		apiErr.Message = errorBody.Message
+	}
+
+	switch {
+	case statusCode == http.StatusTooManyRequests,
+		statusCode >= http.StatusInternalServerError && statusCode != http.StatusNotImplemented:
+		apiErr.Retryable = true
+	case statusCode == http.StatusConflict:
+		apiErr.Retryable = isVersionMismatch(apiErr.Message)
+	}
+	return apiErr
+}
+
+// statusCode returns the status of a Data Plane API error, 0 for other errors
+func statusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound checks if err reports that the requested object doesn't exist
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsConflict checks if err reports a conflict: an object that already exists or, see
+// IsVersionConflict, a configuration version that changed meanwhile
+func IsConflict(err error) bool {
+	return statusCode(err) == http.StatusConflict
+}
+
+// IsBadRequest checks if the Data Plane API rejected a request as invalid, which usually means the
+// connector generated configuration HAProxy doesn't accept
+func IsBadRequest(err error) bool {
+	code := statusCode(err)
+	return code == http.StatusBadRequest || code == http.StatusUnprocessableEntity
+}
+
+// IsRetryable checks if a request failed temporarily: a network error or a Data Plane API error
+// marked retryable
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable
+	}
+	return err != nil
+}
+
+// IsVersionConflict checks if err is a Data Plane API error about a configuration version mismatch
+func IsVersionConflict(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict && isVersionMismatch(apiErr.Message)
+}
+
+// isVersionMismatch checks if a conflict message is about the configuration version, not e.g. an existing object
+func isVersionMismatch(message string) bool {
+	return strings.Contains(strings.ToLower(message), "version")
+}
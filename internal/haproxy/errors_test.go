@@ -0,0 +1,72 @@
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	apiErr := newAPIError(http.StatusBadRequest, []byte(`{"code": 400, "message": "invalid value for balance"}`))
+	if apiErr.Message != "invalid value for balance" || apiErr.Retryable {
+		t.Errorf("Expected the message of the JSON body, got %+v", apiErr)
+	}
+	if apiErr.Error() != "API request failed with status 400: invalid value for balance" {
+		t.Errorf("Unexpected error message: %s", apiErr.Error())
+	}
+
+	tests := []struct {
+		status    int
+		body      string
+		retryable bool
+	}{
+		{http.StatusNotFound, "not found", false},
+		{http.StatusConflict, `{"message": "version mismatch, reload the configuration"}`, true},
+		{http.StatusConflict, `{"message": "backend web already exists"}`, false},
+		{http.StatusTooManyRequests, "", true},
+		{http.StatusServiceUnavailable, "reloading", true},
+		{http.StatusNotImplemented, "", false},
+	}
+	for _, test := range tests {
+		if apiErr := newAPIError(test.status, []byte(test.body)); apiErr.Retryable != test.retryable {
+			t.Errorf("Expected retryable %v for %d %q, got %v", test.retryable, test.status, test.body, apiErr.Retryable)
+		}
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	notFound := fmt.Errorf("failed to get backend web: %w", &APIError{StatusCode: http.StatusNotFound})
+	if !IsNotFound(notFound) || IsConflict(notFound) || IsBadRequest(notFound) || IsRetryable(notFound) {
+		t.Error("Expected a wrapped 404 to be classified as not found only")
+	}
+	exists := newAPIError(http.StatusConflict, []byte(`{"message": "object already exists"}`))
+	if !IsConflict(exists) || IsVersionConflict(exists) {
+		t.Error("Expected an existing object to be a conflict, but no version conflict")
+	}
+	if !IsBadRequest(&APIError{StatusCode: http.StatusUnprocessableEntity}) {
+		t.Error("Expected 422 to be a bad request")
+	}
+	if !IsRetryable(errors.New("connection refused")) || IsNotFound(errors.New("not found")) {
+		t.Error("Expected network errors to be retryable and not to be classified by message")
+	}
+}
+
+func TestClient_ReturnsAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code": 404, "message": "missing object: backend web"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "admin", "adminpwd")
+	_, err := client.GetBackend("web")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !IsNotFound(err) || apiErr.Message != "missing object: backend web" {
+		t.Errorf("Expected a 404 APIError with the message of the body, got %v", err)
+	}
+	if _, err := client.GetConfigVersion(); !IsNotFound(err) {
+		t.Errorf("Expected the version request to report the status, got %v", err)
+	}
+}
@@ -0,0 +1,651 @@
+package haproxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ApplyPolicy decides when a change fanned out to multiple HAProxy instances counts as successful
+type ApplyPolicy string
+
+// No policy rolls a change back on the instances that applied it: a change failing on some
+// instances leaves them behind, flagged as inconsistent until a resync heals them.
+const (
+	ApplyPolicyAllMustSucceed ApplyPolicy = "all_must_succeed" // every instance must apply the change
+	ApplyPolicyQuorum         ApplyPolicy = "quorum"           // a majority of instances must apply the change
+	ApplyPolicyBestEffort     ApplyPolicy = "best_effort"      // at least one instance must apply the change
+
+	// ApplyPolicyAllOrNothing is the former name of all_must_succeed, still accepted
+	ApplyPolicyAllOrNothing ApplyPolicy = "all_or_nothing"
+)
+
+// Instance is a named HAProxy Data Plane API endpoint managed by a MultiClient
+type Instance struct {
+	Name   string
+	Client ClientInterface
+}
+
+// InstanceStatus is the health of a managed instance as seen by the changes fanned out to it
+type InstanceStatus struct {
+	Name                string    `json:"name"`
+	Consistent          bool      `json:"consistent"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+}
+
+// MultiClient fans every mutation out to several HAProxy instances and evaluates the result
+// against an ApplyPolicy. Reads are served by the first instance that has not missed a change.
+//
+// Config versions are tracked per instance, so the version passed to mutating calls is
+// ignored and each instance's own current version is used instead.
+type MultiClient struct {
+	instances []Instance
+	policy    ApplyPolicy
+
+	mu           *sync.Mutex // shared with the views of WithContext
+	inconsistent map[string]bool
+	status       map[string]*InstanceStatus
+}
+
+// NewMultiClient creates a client that manages all given instances with the given apply policy
+func NewMultiClient(instances []Instance, policy ApplyPolicy) (*MultiClient, error) {
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("at least one HAProxy instance is required")
+	}
+
+	switch policy {
+	case ApplyPolicyAllMustSucceed, ApplyPolicyQuorum, ApplyPolicyBestEffort:
+	case "", ApplyPolicyAllOrNothing:
+		policy = ApplyPolicyAllMustSucceed
+	default:
+		return nil, fmt.Errorf("unknown apply policy %q", policy)
+	}
+
+	status := make(map[string]*InstanceStatus, len(instances))
+	for _, instance := range instances {
+		status[instance.Name] = &InstanceStatus{Name: instance.Name}
+	}
+
+	return &MultiClient{
+		instances:    instances,
+		policy:       policy,
+		mu:           &sync.Mutex{},
+		inconsistent: make(map[string]bool),
+		status:       status,
+	}, nil
+}
+
+// WithContext returns a view of the client whose requests to every instance belong to ctx. The
+// view shares the health of the instances with the client.
+func (m *MultiClient) WithContext(ctx context.Context) *MultiClient {
+	view := *m
+	view.instances = make([]Instance, len(m.instances))
+	for i, instance := range m.instances {
+		view.instances[i] = Instance{Name: instance.Name, Client: WithContext(ctx, instance.Client)}
+	}
+	return &view
+}
+
+// Instances returns the managed instances
+func (m *MultiClient) Instances() []Instance {
+	return m.instances
+}
+
+// Inconsistent returns the names of instances that missed at least one change since they were last healed
+func (m *MultiClient) Inconsistent() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.inconsistent))
+	for name := range m.inconsistent {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MarkHealed clears the inconsistent flag of an instance after it has been resynchronized
+func (m *MultiClient) MarkHealed(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.inconsistent, name)
+	m.recordResult(name, nil)
+}
+
+// MarkInconsistent flags an instance that could not be reached outside of a fanned out change,
+// e.g. on startup, so it is healed by a resync once it is back
+func (m *MultiClient) MarkInconsistent(name string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inconsistent[name] = true
+	m.recordResult(name, err)
+}
+
+// Status returns the health of all instances in configuration order
+func (m *MultiClient) Status() []InstanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]InstanceStatus, 0, len(m.instances))
+	for _, instance := range m.instances {
+		status := *m.status[instance.Name]
+		status.Consistent = !m.inconsistent[instance.Name]
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// recordResult updates the health of an instance after a call; m.mu must be held
+func (m *MultiClient) recordResult(name string, err error) {
+	status, ok := m.status[name]
+	if !ok {
+		return
+	}
+	if err != nil {
+		status.ConsecutiveFailures++
+		status.LastError = err.Error()
+		return
+	}
+	status.ConsecutiveFailures = 0
+	status.LastError = ""
+	status.LastSuccess = time.Now()
+}
+
+// policySatisfied reports whether the number of successful instances satisfies the apply policy
+func (m *MultiClient) policySatisfied(succeeded int) bool {
+	switch m.policy {
+	case ApplyPolicyQuorum:
+		return succeeded > len(m.instances)/2
+	case ApplyPolicyBestEffort:
+		return succeeded > 0
+	default:
+		return succeeded == len(m.instances)
+	}
+}
+
+// apply runs a mutation against all instances in parallel and evaluates the apply policy.
+// Instances that fail are flagged as inconsistent so they can be healed by a resync; the instances
+// that applied the change keep it, even if the policy fails the change.
+func (m *MultiClient) apply(operation string, fn func(client ClientInterface) error) error {
+	errs := make([]error, len(m.instances))
+
+	var wg sync.WaitGroup
+	for i := range m.instances {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(m.instances[i].Client)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	var failures []string
+	m.mu.Lock()
+	for i, err := range errs {
+		m.recordResult(m.instances[i].Name, err)
+		if err == nil {
+			succeeded++
+			continue
+		}
+		m.inconsistent[m.instances[i].Name] = true
+		failures = append(failures, fmt.Sprintf("%s: %v", m.instances[i].Name, err))
+	}
+	m.mu.Unlock()
+
+	if m.policySatisfied(succeeded) {
+		return nil
+	}
+
+	// With a single instance, surface the original error unchanged
+	if len(m.instances) == 1 {
+		return errs[0]
+	}
+
+	return fmt.Errorf("%s applied on %d/%d instances (policy %s): %s",
+		operation, succeeded, len(m.instances), m.policy, strings.Join(failures, "; "))
+}
+
+// applyVersioned runs a mutation that needs the instance's current config version
+func (m *MultiClient) applyVersioned(operation string, fn func(client ClientInterface, version int) error) error {
+	return m.apply(operation, func(client ClientInterface) error {
+		version, err := client.GetConfigVersion()
+		if err != nil {
+			return fmt.Errorf("failed to get config version: %w", err)
+		}
+		return fn(client, version)
+	})
+}
+
+// primary returns the instance reads are served from: the first one that has not missed a change,
+// so reads neither fail on nor see stale state of a broken instance. Falls back to the first instance.
+func (m *MultiClient) primary() ClientInterface {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, instance := range m.instances {
+		if !m.inconsistent[instance.Name] {
+			return instance.Client
+		}
+	}
+	return m.instances[0].Client
+}
+
+func (m *MultiClient) GetInfo() (*APIInfo, error) {
+	return m.primary().GetInfo()
+}
+
+func (m *MultiClient) GetConfigVersion() (int, error) {
+	return m.primary().GetConfigVersion()
+}
+
+func (m *MultiClient) GetRawConfiguration() (string, error) {
+	return m.primary().GetRawConfiguration()
+}
+
+// DeleteStaleTransactions sweeps stale transactions on every instance
+func (m *MultiClient) DeleteStaleTransactions() (int, error) {
+	var mu sync.Mutex
+	total := 0
+	err := m.apply("delete stale transactions", func(client ClientInterface) error {
+		deleted, err := client.DeleteStaleTransactions()
+		mu.Lock()
+		total += deleted
+		mu.Unlock()
+		return err
+	})
+	return total, err
+}
+
+func (m *MultiClient) GetBackends() ([]Backend, error) {
+	return m.primary().GetBackends()
+}
+
+func (m *MultiClient) GetBackend(name string) (*Backend, error) {
+	return m.primary().GetBackend(name)
+}
+
+//nolint:gocritic // Backend struct matches API interface requirements
+func (m *MultiClient) CreateBackend(backend Backend, _ int) (*Backend, error) {
+	err := m.applyVersioned("create backend", func(client ClientInterface, version int) error {
+		_, err := client.CreateBackend(backend, version)
+		return err
+	})
+	return &backend, err
+}
+
+func (m *MultiClient) ReplaceBackend(backend *Backend, _ int) (*Backend, error) {
+	err := m.applyVersioned("replace backend", func(client ClientInterface, version int) error {
+		_, err := client.ReplaceBackend(backend, version)
+		return err
+	})
+	return backend, err
+}
+
+func (m *MultiClient) DeleteBackend(name string, _ int) error {
+	return m.applyVersioned("delete backend", func(client ClientInterface, version int) error {
+		return client.DeleteBackend(name, version)
+	})
+}
+
+func (m *MultiClient) GetServers(backendName string) ([]Server, error) {
+	return m.primary().GetServers(backendName)
+}
+
+func (m *MultiClient) CreateServer(backendName string, server *Server, _ int) (*Server, error) {
+	err := m.applyVersioned("create server", func(client ClientInterface, version int) error {
+		_, err := client.CreateServer(backendName, server, version)
+		return err
+	})
+	return server, err
+}
+
+func (m *MultiClient) DeleteServer(backendName, serverName string, _ int) error {
+	return m.applyVersioned("delete server", func(client ClientInterface, version int) error {
+		return client.DeleteServer(backendName, serverName, version)
+	})
+}
+
+func (m *MultiClient) ReplaceServer(backendName string, server *Server, _ int) error {
+	return m.applyVersioned("replace server", func(client ClientInterface, version int) error {
+		return client.ReplaceServer(backendName, server, version)
+	})
+}
+
+func (m *MultiClient) SwapServer(backendName, oldServerName string, server *Server) error {
+	return m.apply("swap server", func(client ClientInterface) error {
+		return client.SwapServer(backendName, oldServerName, server)
+	})
+}
+
+func (m *MultiClient) UpdateServers(backendName string, remove []string, create []Server) error {
+	return m.apply("update servers", func(client ClientInterface) error {
+		return client.UpdateServers(backendName, remove, create)
+	})
+}
+
+func (m *MultiClient) GetRuntimeServer(backendName, serverName string) (*RuntimeServer, error) {
+	return m.primary().GetRuntimeServer(backendName, serverName)
+}
+
+func (m *MultiClient) GetRuntimeServers(backendName string) ([]RuntimeServer, error) {
+	return m.primary().GetRuntimeServers(backendName)
+}
+
+func (m *MultiClient) GetStickTableEntries(table string) ([]StickTableEntry, error) {
+	return m.primary().GetStickTableEntries(table)
+}
+
+func (m *MultiClient) SetServerState(ctx context.Context, backendName, serverName, adminState string) error {
+	return m.apply("set server state", func(client ClientInterface) error {
+		return client.SetServerState(ctx, backendName, serverName, adminState)
+	})
+}
+
+func (m *MultiClient) DrainServer(backendName, serverName string) error {
+	return m.apply("drain server", func(client ClientInterface) error {
+		return client.DrainServer(backendName, serverName)
+	})
+}
+
+func (m *MultiClient) ReadyServer(backendName, serverName string) error {
+	return m.apply("ready server", func(client ClientInterface) error {
+		return client.ReadyServer(backendName, serverName)
+	})
+}
+
+func (m *MultiClient) MaintainServer(backendName, serverName string) error {
+	return m.apply("maintain server", func(client ClientInterface) error {
+		return client.MaintainServer(backendName, serverName)
+	})
+}
+
+func (m *MultiClient) AddFrontendRule(frontend, domain, backend string) error {
+	return m.AddFrontendRuleWithType(frontend, domain, backend, DomainTypeExact)
+}
+
+func (m *MultiClient) AddFrontendRuleWithType(frontend, domain, backend string, domainType DomainType) error {
+	return m.apply("add frontend rule", func(client ClientInterface) error {
+		return client.AddFrontendRuleWithType(frontend, domain, backend, domainType)
+	})
+}
+
+func (m *MultiClient) SetFrontendRule(frontend string, rule FrontendRule) error {
+	return m.apply("set frontend rule", func(client ClientInterface) error {
+		return client.SetFrontendRule(frontend, rule)
+	})
+}
+
+func (m *MultiClient) RemoveFrontendRule(frontend, domain string) error {
+	return m.apply("remove frontend rule", func(client ClientInterface) error {
+		return client.RemoveFrontendRule(frontend, domain)
+	})
+}
+
+func (m *MultiClient) GetFrontendRules(frontend string) ([]FrontendRule, error) {
+	return m.primary().GetFrontendRules(frontend)
+}
+
+func (m *MultiClient) ResetFrontendRules(frontend string) error {
+	return m.apply("reset frontend rules", func(client ClientInterface) error {
+		return client.ResetFrontendRules(frontend)
+	})
+}
+
+func (m *MultiClient) EnsureUserlistUser(userlist, username, passwordHash string) error {
+	return m.apply("ensure userlist user", func(client ClientInterface) error {
+		return client.EnsureUserlistUser(userlist, username, passwordHash)
+	})
+}
+
+func (m *MultiClient) DeleteUserlist(name string, _ int) error {
+	return m.applyVersioned("delete userlist", func(client ClientInterface, version int) error {
+		return client.DeleteUserlist(name, version)
+	})
+}
+
+func (m *MultiClient) SetHTTPChecks(backendName string, checks []HTTPCheck, _ int) error {
+	return m.applyVersioned("set http checks", func(client ClientInterface, version int) error {
+		return client.SetHTTPChecks(backendName, checks, version)
+	})
+}
+
+func (m *MultiClient) GetHTTPChecks(backendName string) ([]HTTPCheck, error) {
+	return m.primary().GetHTTPChecks(backendName)
+}
+
+func (m *MultiClient) GetFrontend(name string) (*Frontend, error) {
+	return m.primary().GetFrontend(name)
+}
+
+func (m *MultiClient) CreateFrontend(frontend *Frontend, _ int) (*Frontend, error) {
+	err := m.applyVersioned("create frontend", func(client ClientInterface, version int) error {
+		_, err := client.CreateFrontend(frontend, version)
+		return err
+	})
+	return frontend, err
+}
+
+func (m *MultiClient) UpdateFrontendLogging(frontend *Frontend, _ int) error {
+	return m.applyVersioned("update frontend logging", func(client ClientInterface, version int) error {
+		return client.UpdateFrontendLogging(frontend, version)
+	})
+}
+
+func (m *MultiClient) SetFrontendDefaultBackend(frontendName, backendName string, _ int) error {
+	return m.applyVersioned("set frontend default backend", func(client ClientInterface, version int) error {
+		return client.SetFrontendDefaultBackend(frontendName, backendName, version)
+	})
+}
+
+func (m *MultiClient) DeleteFrontend(name string, _ int) error {
+	return m.applyVersioned("delete frontend", func(client ClientInterface, version int) error {
+		return client.DeleteFrontend(name, version)
+	})
+}
+
+// EnsureFrontend sets up the frontend on every instance, reporting a change if any instance changed
+func (m *MultiClient) EnsureFrontend(frontend *Frontend, binds []Bind) (bool, error) {
+	var mu sync.Mutex
+	changed := false
+	err := m.apply("ensure frontend", func(client ClientInterface) error {
+		instanceChanged, err := client.EnsureFrontend(frontend, binds)
+		mu.Lock()
+		changed = changed || instanceChanged
+		mu.Unlock()
+		return err
+	})
+	return changed, err
+}
+
+func (m *MultiClient) CreateBind(frontendName string, bind *Bind, _ int) (*Bind, error) {
+	err := m.applyVersioned("create bind", func(client ClientInterface, version int) error {
+		_, err := client.CreateBind(frontendName, bind, version)
+		return err
+	})
+	return bind, err
+}
+
+func (m *MultiClient) GetHTTPRequestRules(parentType, parentName string) ([]HTTPRequestRule, error) {
+	return m.primary().GetHTTPRequestRules(parentType, parentName)
+}
+
+// CreateHTTPRequestRule inserts the rule on every instance. The index refers to the rules read from
+// the first consistent instance, it is resolved against the rules of each instance.
+func (m *MultiClient) CreateHTTPRequestRule(parentType, parentName string, index int, rule *HTTPRequestRule, _ int) error {
+	reference, err := m.primary().GetHTTPRequestRules(parentType, parentName)
+	if err != nil {
+		return fmt.Errorf("failed to get http-request rules of %s %s: %w", parentType, parentName, err)
+	}
+	return m.applyVersioned("create http-request rule", func(client ClientInterface, version int) error {
+		rules, err := client.GetHTTPRequestRules(parentType, parentName)
+		if err != nil {
+			return err
+		}
+		return client.CreateHTTPRequestRule(parentType, parentName, insertIndex(reference, rules, index), rule, version)
+	})
+}
+
+// DeleteHTTPRequestRule deletes the rule on every instance. The index refers to the rules read from
+// the first consistent instance, each instance deletes the same rule wherever it holds it.
+func (m *MultiClient) DeleteHTTPRequestRule(parentType, parentName string, index, _ int) error {
+	reference, err := m.primary().GetHTTPRequestRules(parentType, parentName)
+	if err != nil {
+		return fmt.Errorf("failed to get http-request rules of %s %s: %w", parentType, parentName, err)
+	}
+	return m.applyVersioned("delete http-request rule", func(client ClientInterface, version int) error {
+		rules, err := client.GetHTTPRequestRules(parentType, parentName)
+		if err != nil {
+			return err
+		}
+		instanceIndex, ok := findRule(reference, rules, index)
+		if !ok {
+			return nil
+		}
+		return client.DeleteHTTPRequestRule(parentType, parentName, instanceIndex, version)
+	})
+}
+
+func (m *MultiClient) GetHTTPResponseRules(parentType, parentName string) ([]HTTPResponseRule, error) {
+	return m.primary().GetHTTPResponseRules(parentType, parentName)
+}
+
+// CreateHTTPResponseRule inserts the rule on every instance, see CreateHTTPRequestRule
+func (m *MultiClient) CreateHTTPResponseRule(parentType, parentName string, index int, rule *HTTPResponseRule, _ int) error {
+	reference, err := m.primary().GetHTTPResponseRules(parentType, parentName)
+	if err != nil {
+		return fmt.Errorf("failed to get http-response rules of %s %s: %w", parentType, parentName, err)
+	}
+	return m.applyVersioned("create http-response rule", func(client ClientInterface, version int) error {
+		rules, err := client.GetHTTPResponseRules(parentType, parentName)
+		if err != nil {
+			return err
+		}
+		return client.CreateHTTPResponseRule(parentType, parentName, insertIndex(reference, rules, index), rule, version)
+	})
+}
+
+// DeleteHTTPResponseRule deletes the rule on every instance, see DeleteHTTPRequestRule
+func (m *MultiClient) DeleteHTTPResponseRule(parentType, parentName string, index, _ int) error {
+	reference, err := m.primary().GetHTTPResponseRules(parentType, parentName)
+	if err != nil {
+		return fmt.Errorf("failed to get http-response rules of %s %s: %w", parentType, parentName, err)
+	}
+	return m.applyVersioned("delete http-response rule", func(client ClientInterface, version int) error {
+		rules, err := client.GetHTTPResponseRules(parentType, parentName)
+		if err != nil {
+			return err
+		}
+		instanceIndex, ok := findRule(reference, rules, index)
+		if !ok {
+			return nil
+		}
+		return client.DeleteHTTPResponseRule(parentType, parentName, instanceIndex, version)
+	})
+}
+
+// insertIndex translates the position of a new rule in the reference rules to the rules of an
+// instance: before the same rule the new one precedes in the reference, or at the end
+func insertIndex[R comparable](reference, rules []R, index int) int {
+	if index < 0 || index >= len(reference) {
+		return len(rules)
+	}
+	if instanceIndex, ok := findRule(reference, rules, index); ok {
+		return instanceIndex
+	}
+	return min(index, len(rules))
+}
+
+// findRule finds the rule at index of the reference rules among the rules of an instance. Equal
+// rules are told apart by their order. Returns false if the instance doesn't hold the rule.
+func findRule[R comparable](reference, rules []R, index int) (int, bool) {
+	if index < 0 || index >= len(reference) {
+		return 0, false
+	}
+	occurrence := 0
+	for i := 0; i < index; i++ {
+		if reference[i] == reference[index] {
+			occurrence++
+		}
+	}
+	for i := range rules {
+		if rules[i] != reference[index] {
+			continue
+		}
+		if occurrence == 0 {
+			return i, true
+		}
+		occurrence--
+	}
+	return 0, false
+}
+
+func (m *MultiClient) GetBackendSwitchingRules(frontend string) ([]BackendSwitchingRule, error) {
+	return m.primary().GetBackendSwitchingRules(frontend)
+}
+
+func (m *MultiClient) CreateBackendSwitchingRule(frontend string, index int, rule *BackendSwitchingRule, _ int) error {
+	return m.applyVersioned("create backend switching rule", func(client ClientInterface, version int) error {
+		return client.CreateBackendSwitchingRule(frontend, index, rule, version)
+	})
+}
+
+func (m *MultiClient) DeleteBackendSwitchingRule(frontend string, index, _ int) error {
+	return m.applyVersioned("delete backend switching rule", func(client ClientInterface, version int) error {
+		return client.DeleteBackendSwitchingRule(frontend, index, version)
+	})
+}
+
+func (m *MultiClient) GetStickRules(backend string) ([]StickRule, error) {
+	return m.primary().GetStickRules(backend)
+}
+
+func (m *MultiClient) CreateStickRule(backend string, index int, rule *StickRule, _ int) error {
+	return m.applyVersioned("create stick rule", func(client ClientInterface, version int) error {
+		return client.CreateStickRule(backend, index, rule, version)
+	})
+}
+
+func (m *MultiClient) DeleteStickRule(backend string, index, _ int) error {
+	return m.applyVersioned("delete stick rule", func(client ClientInterface, version int) error {
+		return client.DeleteStickRule(backend, index, version)
+	})
+}
+
+func (m *MultiClient) GetSSLCertificates() ([]SSLCertificate, error) {
+	return m.primary().GetSSLCertificates()
+}
+
+func (m *MultiClient) GetSSLCertificate(name string) (*SSLCertificate, error) {
+	return m.primary().GetSSLCertificate(name)
+}
+
+func (m *MultiClient) CreateSSLCertificate(name string, pem []byte) (*SSLCertificate, error) {
+	err := m.apply("create ssl certificate", func(client ClientInterface) error {
+		_, err := client.CreateSSLCertificate(name, pem)
+		return err
+	})
+	return &SSLCertificate{StorageName: name}, err
+}
+
+func (m *MultiClient) ReplaceSSLCertificate(name string, pem []byte) (*SSLCertificate, error) {
+	err := m.apply("replace ssl certificate", func(client ClientInterface) error {
+		_, err := client.ReplaceSSLCertificate(name, pem)
+		return err
+	})
+	return &SSLCertificate{StorageName: name}, err
+}
+
+func (m *MultiClient) DeleteSSLCertificate(name string) error {
+	return m.apply("delete ssl certificate", func(client ClientInterface) error {
+		return client.DeleteSSLCertificate(name)
+	})
+}
+
+// Ensure MultiClient implements ClientInterface
+var _ ClientInterface = (*MultiClient)(nil)
@@ -0,0 +1,268 @@
+package haproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newInstanceServer simulates a Data Plane API that fails server creation when healthy is false
+func newInstanceServer(t *testing.T, healthy bool, created *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/configuration/version"):
+			_, _ = w.Write([]byte("7"))
+		case strings.HasSuffix(r.URL.Path, "/servers") && r.Method == HTTPMethodPOST:
+			if r.URL.Query().Get("version") != "7" {
+				t.Errorf("Expected instance's own version 7, got %s", r.URL.Query().Get("version"))
+			}
+			if !healthy {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			atomic.AddInt32(created, 1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"name":"srv"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestMultiClient_ApplyPolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      ApplyPolicy
+		healthy     []bool
+		expectError bool
+	}{
+		{"all_must_succeed all healthy", ApplyPolicyAllMustSucceed, []bool{true, true, true}, false},
+		{"all_must_succeed one failing", ApplyPolicyAllMustSucceed, []bool{true, true, false}, true},
+		{"quorum majority healthy", ApplyPolicyQuorum, []bool{true, true, false}, false},
+		{"quorum minority healthy", ApplyPolicyQuorum, []bool{true, false, false}, true},
+		{"best_effort one healthy", ApplyPolicyBestEffort, []bool{false, true, false}, false},
+		{"best_effort none healthy", ApplyPolicyBestEffort, []bool{false, false}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created int32
+			var instances []Instance
+			var failing []string
+			for i, healthy := range tt.healthy {
+				server := newInstanceServer(t, healthy, &created)
+				defer server.Close()
+
+				name := string(rune('a' + i))
+				instances = append(instances, Instance{Name: name, Client: newRetryTestClient(server.URL)})
+				if !healthy {
+					failing = append(failing, name)
+				}
+			}
+
+			multi, err := NewMultiClient(instances, tt.policy)
+			if err != nil {
+				t.Fatalf("NewMultiClient() failed: %v", err)
+			}
+
+			// The passed version is ignored in favor of each instance's own version
+			_, err = multi.CreateServer("web", &Server{Name: "srv", Address: "10.0.0.1", Port: 80}, 1)
+			if (err != nil) != tt.expectError {
+				t.Errorf("CreateServer() error = %v, expectError %v", err, tt.expectError)
+			}
+
+			if got := multi.Inconsistent(); strings.Join(got, ",") != strings.Join(failing, ",") {
+				t.Errorf("Inconsistent() = %v, expected %v", got, failing)
+			}
+
+			for _, name := range failing {
+				multi.MarkHealed(name)
+			}
+			if len(multi.Inconsistent()) != 0 {
+				t.Error("Expected no inconsistent instances after healing")
+			}
+		})
+	}
+}
+
+func TestNewMultiClient_Validation(t *testing.T) {
+	if _, err := NewMultiClient(nil, ApplyPolicyQuorum); err == nil {
+		t.Error("Expected error without instances")
+	}
+
+	instances := []Instance{{Name: "a", Client: NewClient("http://localhost", "", "")}}
+	if _, err := NewMultiClient(instances, "majority"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+
+	multi, err := NewMultiClient(instances, "")
+	if err != nil {
+		t.Fatalf("NewMultiClient() failed: %v", err)
+	}
+	if multi.policy != ApplyPolicyAllMustSucceed {
+		t.Errorf("Expected default policy all_must_succeed, got %s", multi.policy)
+	}
+
+	if multi, err = NewMultiClient(instances, ApplyPolicyAllOrNothing); err != nil || multi.policy != ApplyPolicyAllMustSucceed {
+		t.Errorf("Expected all_or_nothing to be accepted as all_must_succeed, got %v (err: %v)", multi, err)
+	}
+}
+
+func TestMultiClient_StatusAndReadFailover(t *testing.T) {
+	var created int32
+	broken := newInstanceServer(t, false, &created)
+	defer broken.Close()
+	healthy := newInstanceServer(t, true, &created)
+	defer healthy.Close()
+
+	brokenClient := newRetryTestClient(broken.URL)
+	healthyClient := newRetryTestClient(healthy.URL)
+	multi, err := NewMultiClient([]Instance{
+		{Name: "a", Client: brokenClient},
+		{Name: "b", Client: healthyClient},
+	}, ApplyPolicyBestEffort)
+	if err != nil {
+		t.Fatalf("NewMultiClient() failed: %v", err)
+	}
+
+	if multi.primary() != brokenClient {
+		t.Error("Expected reads to be served by the first instance while all are consistent")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := multi.CreateServer("web", &Server{Name: "srv", Address: "10.0.0.1", Port: 80}, 1); err != nil {
+			t.Fatalf("CreateServer() failed: %v", err)
+		}
+	}
+
+	status := multi.Status()
+	if len(status) != 2 || status[0].Name != "a" || status[1].Name != "b" {
+		t.Fatalf("Expected status of a and b in configuration order, got %+v", status)
+	}
+	if status[0].Consistent || status[0].ConsecutiveFailures != 2 || status[0].LastError == "" {
+		t.Errorf("Expected a to be inconsistent after 2 failures, got %+v", status[0])
+	}
+	if !status[1].Consistent || status[1].ConsecutiveFailures != 0 || status[1].LastSuccess.IsZero() {
+		t.Errorf("Expected b to be healthy, got %+v", status[1])
+	}
+	if multi.primary() != healthyClient {
+		t.Error("Expected reads to fail over to the consistent instance")
+	}
+
+	multi.MarkHealed("a")
+	if status := multi.Status(); !status[0].Consistent || status[0].ConsecutiveFailures != 0 {
+		t.Errorf("Expected a to be healthy after healing, got %+v", status[0])
+	}
+	if multi.primary() != brokenClient {
+		t.Error("Expected reads to return to the first instance after healing")
+	}
+}
+
+func TestMultiClient_MarkInconsistent(t *testing.T) {
+	instances := []Instance{
+		{Name: "a", Client: NewClient("http://localhost", "", "")},
+		{Name: "b", Client: NewClient("http://localhost", "", "")},
+	}
+	multi, err := NewMultiClient(instances, ApplyPolicyQuorum)
+	if err != nil {
+		t.Fatalf("NewMultiClient() failed: %v", err)
+	}
+
+	multi.MarkInconsistent("b", errors.New("connection refused"))
+	if got := multi.Inconsistent(); len(got) != 1 || got[0] != "b" {
+		t.Errorf("Inconsistent() = %v, expected [b]", got)
+	}
+	if status := multi.Status(); status[1].LastError != "connection refused" || status[1].ConsecutiveFailures != 1 {
+		t.Errorf("Expected startup failure in status of b, got %+v", status[1])
+	}
+}
+
+// recordingClient is a minimal ClientInterface implementation; unused operations panic through the nil embedded interface
+type recordingClient struct {
+	ClientInterface
+	backends []Backend
+	resets   []string
+	rules    []HTTPRequestRule
+}
+
+func (r *recordingClient) GetConfigVersion() (int, error) {
+	return 1, nil
+}
+
+func (r *recordingClient) GetHTTPRequestRules(_, _ string) ([]HTTPRequestRule, error) {
+	return append([]HTTPRequestRule{}, r.rules...), nil
+}
+
+func (r *recordingClient) CreateHTTPRequestRule(_, _ string, index int, rule *HTTPRequestRule, _ int) error {
+	r.rules = append(r.rules[:index], append([]HTTPRequestRule{*rule}, r.rules[index:]...)...)
+	return nil
+}
+
+func (r *recordingClient) DeleteHTTPRequestRule(_, _ string, index, _ int) error {
+	r.rules = append(r.rules[:index], r.rules[index+1:]...)
+	return nil
+}
+
+func (r *recordingClient) GetBackends() ([]Backend, error) {
+	return r.backends, nil
+}
+
+func (r *recordingClient) ResetFrontendRules(frontend string) error {
+	r.resets = append(r.resets, frontend)
+	return nil
+}
+
+func TestMultiClient_AcceptsAnyClientImplementation(t *testing.T) {
+	first := &recordingClient{backends: []Backend{{Name: "web"}}}
+	second := &recordingClient{}
+	multi, err := NewMultiClient([]Instance{{Name: "a", Client: first}, {Name: "b", Client: second}}, ApplyPolicyAllMustSucceed)
+	if err != nil {
+		t.Fatalf("NewMultiClient() failed: %v", err)
+	}
+
+	backends, err := multi.GetBackends()
+	if err != nil || len(backends) != 1 || backends[0].Name != "web" {
+		t.Errorf("Expected the backends of the first instance, got %v (%v)", backends, err)
+	}
+	if err := multi.ResetFrontendRules("https"); err != nil {
+		t.Fatalf("ResetFrontendRules() failed: %v", err)
+	}
+	if len(first.resets) != 1 || len(second.resets) != 1 {
+		t.Errorf("Expected the reset on every instance, got %v and %v", first.resets, second.resets)
+	}
+}
+
+func TestMultiClient_ResolvesRuleIndexPerInstance(t *testing.T) {
+	manual := HTTPRequestRule{Type: "deny", Cond: "if", CondTest: "{ path_beg /admin }"}
+	redirect := HTTPRequestRule{Type: "redirect", RedirType: "scheme", RedirValue: "https", Cond: "if", CondTest: "{ hdr(host) -i a.example.com }"}
+	added := HTTPRequestRule{Type: "redirect", RedirType: "scheme", RedirValue: "https", Cond: "if", CondTest: "{ hdr(host) -i b.example.com }"}
+
+	// The second instance holds a rule written by hand the first one lacks
+	first := &recordingClient{rules: []HTTPRequestRule{redirect}}
+	second := &recordingClient{rules: []HTTPRequestRule{manual, redirect}}
+	multi, err := NewMultiClient([]Instance{{Name: "a", Client: first}, {Name: "b", Client: second}}, ApplyPolicyAllMustSucceed)
+	if err != nil {
+		t.Fatalf("NewMultiClient() failed: %v", err)
+	}
+
+	if err := multi.CreateHTTPRequestRule(ParentTypeFrontend, "http", 0, &added, 0); err != nil {
+		t.Fatalf("CreateHTTPRequestRule() failed: %v", err)
+	}
+	if second.rules[0] != manual || second.rules[1] != added || second.rules[2] != redirect {
+		t.Errorf("Expected the rule to be inserted before the same rule on every instance, got %+v", second.rules)
+	}
+
+	if err := multi.DeleteHTTPRequestRule(ParentTypeFrontend, "http", 1, 0); err != nil {
+		t.Fatalf("DeleteHTTPRequestRule() failed: %v", err)
+	}
+	if len(first.rules) != 1 || first.rules[0] != added {
+		t.Errorf("Expected the redirect to be deleted on the first instance, got %+v", first.rules)
+	}
+	if len(second.rules) != 2 || second.rules[0] != manual || second.rules[1] != added {
+		t.Errorf("Expected the redirect, not the rule written by hand, to be deleted on the second instance, got %+v", second.rules)
+	}
+}
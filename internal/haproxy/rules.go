@@ -0,0 +1,357 @@
+package haproxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lists of a frontend a domain rule consists of
+const (
+	frontendListACLs           = "acls"
+	frontendListSwitchingRules = "backend_switching_rules"
+	frontendListRequestRules   = "http_request_rules"
+)
+
+// indexedEntry is an entry of a frontend list (an ACL or a rule) together with its position
+type indexedEntry struct {
+	index int
+	entry map[string]interface{}
+}
+
+// frontendListPath returns the path of an ACL or rule list of a frontend
+func frontendListPath(frontend, list string) string {
+	return fmt.Sprintf("/v3/services/haproxy/configuration/frontends/%s/%s", frontend, list)
+}
+
+func (c *Client) getFrontendListInTransaction(frontend, list, transactionID string) ([]map[string]interface{}, error) {
+	var entries []map[string]interface{}
+	path := frontendListPath(frontend, list)
+	if transactionID != "" {
+		path += "?transaction_id=" + transactionID
+	}
+	if err := c.makeRequest(HTTPMethodGET, path, nil, &entries, 0); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// hostWithoutPort is the sample of the Host header without port
+const hostWithoutPort = "hdr(host),field(1,:)"
+
+// domainACL returns the criterion and value of the ACL matching the domain of a rule
+func domainACL(domain string, domainType DomainType, hostMatch HostMatch) (criterion, value string) {
+	hostMatch = hostMatch.ForType(domainType)
+	sample := "hdr(host)"
+	if hostMatch == HostMatchStripPort {
+		sample = hostWithoutPort
+	}
+
+	switch {
+	case domainType == DomainTypeRegex:
+		return sample, "-m reg " + domain
+	case domainType == DomainTypeSuffix && hostMatch == HostMatchHeader:
+		return "hdr_end(host)", domain
+	case domainType == DomainTypeSuffix:
+		return sample, "-m end " + domain
+	case hostMatch == HostMatchDomain:
+		return "hdr_dom(host)", domain
+	default:
+		return sample, domain
+	}
+}
+
+// parseDomainACL returns the domain, type and host match of an ACL matching the Host header.
+// ACLs with another criterion aren't domain ACLs, their value is returned as exact domain.
+func parseDomainACL(acl map[string]interface{}) (string, DomainType, HostMatch, bool) {
+	criterion, _ := acl["criterion"].(string)
+	value, _ := acl["value"].(string)
+
+	hostMatch := HostMatchHeader
+	switch criterion {
+	case "hdr(host)":
+	case hostWithoutPort:
+		hostMatch = HostMatchStripPort
+	case "hdr_end(host)":
+		return value, DomainTypeSuffix, HostMatchHeader, true
+	case "hdr_dom(host)":
+		return value, DomainTypeExact, HostMatchDomain, true
+	default:
+		return value, DomainTypeExact, HostMatchHeader, false
+	}
+
+	switch {
+	case strings.HasPrefix(value, "-m reg "):
+		return strings.TrimPrefix(value, "-m reg "), DomainTypeRegex, hostMatch, true
+	case strings.HasPrefix(value, "-m end "):
+		return strings.TrimPrefix(value, "-m end "), DomainTypeSuffix, hostMatch, true
+	default:
+		return value, DomainTypeExact, hostMatch, true
+	}
+}
+
+// isDomainACL checks if an ACL matches the host header against the domain
+func isDomainACL(acl map[string]interface{}, domain string) bool {
+	aclDomain, _, _, ok := parseDomainACL(acl)
+	return ok && aclDomain == domain
+}
+
+// isManagedACL checks if an ACL is named the way the connector names the ACLs of a domain. Only
+// those are ever changed or removed, hand-written ACLs matching the same domain are left alone.
+func isManagedACL(aclName, domain string) bool {
+	return strings.HasPrefix(aclName, "is_") &&
+		(strings.HasSuffix(aclName, "_"+hashDomain(domain)) || strings.HasSuffix(aclName, "_"+longHashDomain(domain)))
+}
+
+// aclReference returns the ACL a switching or auth rule is conditioned on, including the
+// connector's canary and auth conditions
+func aclReference(rule map[string]interface{}) string {
+	if aclName, _, ok := parseCanaryRule(rule); ok {
+		return aclName
+	}
+	if aclName, _, ok := parseAuthRule(rule); ok {
+		return aclName
+	}
+	condTest, _ := rule["cond_test"].(string)
+	return condTest
+}
+
+// referencingEntries returns the rules conditioned on one of the ACLs
+func referencingEntries(rules []map[string]interface{}, aclNames map[string]bool, authOnly bool) []indexedEntry {
+	var entries []indexedEntry
+	for i, rule := range rules {
+		if authOnly {
+			if _, _, ok := parseAuthRule(rule); !ok {
+				continue
+			}
+		}
+		if aclNames[aclReference(rule)] {
+			entries = append(entries, indexedEntry{index: i, entry: rule})
+		}
+	}
+	return entries
+}
+
+// entryMatches checks if an existing entry has all the fields of the desired one. The Data Plane
+// API returns fields the connector doesn't set, those are ignored.
+func entryMatches(existing, desired map[string]interface{}) bool {
+	for key, value := range desired {
+		if fmt.Sprint(existing[key]) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceEntriesInTransaction turns the current entries of a frontend list into the desired ones
+// with as few changes as possible. Entries are replaced in place while their number stays the same,
+// otherwise the current ones are deleted and the desired ones inserted where the first of them was,
+// or at the end of the list. All other entries keep their content and order.
+func (c *Client) replaceEntriesInTransaction(
+	frontend, list string,
+	current []indexedEntry,
+	desired []map[string]interface{},
+	listLen int,
+	transactionID string,
+) error {
+	entryPath := func(index int) string {
+		return fmt.Sprintf("%s/%d?transaction_id=%s", frontendListPath(frontend, list), index, transactionID)
+	}
+
+	if len(current) == len(desired) {
+		for i := range current {
+			if entryMatches(current[i].entry, desired[i]) {
+				continue
+			}
+			if err := c.makeRequest(HTTPMethodPUT, entryPath(current[i].index), desired[i], nil, 0); err != nil {
+				return fmt.Errorf("failed to replace %s entry %d: %w", list, current[i].index, err)
+			}
+		}
+		return nil
+	}
+
+	insertAt := listLen
+	if len(current) > 0 {
+		insertAt = current[0].index
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i].index > current[j].index })
+	for _, entry := range current {
+		if err := c.makeRequest(HTTPMethodDELETE, entryPath(entry.index), nil, nil, 0); err != nil {
+			return fmt.Errorf("failed to delete %s entry %d: %w", list, entry.index, err)
+		}
+	}
+	for i, entry := range desired {
+		if err := c.makeRequest(HTTPMethodPOST, entryPath(insertAt+i), entry, nil, 0); err != nil {
+			return fmt.Errorf("failed to create %s entry %d: %w", list, insertAt+i, err)
+		}
+	}
+	return nil
+}
+
+// domainRoute holds the entries of a frontend routing a domain
+type domainRoute struct {
+	acls          []map[string]interface{}
+	switching     []map[string]interface{}
+	requests      []map[string]interface{}
+	domainACLs    []indexedEntry
+	releasedNames map[string]bool // ACLs left without entries once those of the domain are gone
+}
+
+// getDomainRouteInTransaction reads the lists of the frontend and finds the connector's ACLs matching the domain
+func (c *Client) getDomainRouteInTransaction(frontend, domain, transactionID string) (*domainRoute, error) {
+	route := &domainRoute{releasedNames: make(map[string]bool)}
+	var err error
+	if route.acls, err = c.getFrontendListInTransaction(frontend, frontendListACLs, transactionID); err != nil {
+		return nil, fmt.Errorf("failed to get ACLs: %w", err)
+	}
+	if route.switching, err = c.getFrontendListInTransaction(frontend, frontendListSwitchingRules, transactionID); err != nil {
+		return nil, fmt.Errorf("failed to get backend switching rules: %w", err)
+	}
+	if route.requests, err = c.getHTTPRequestRulesInTransaction(frontend, transactionID); err != nil {
+		return nil, err
+	}
+
+	// An ACL name may match several domains, its rules keep serving the others
+	remaining := make(map[string]int)
+	for i, acl := range route.acls {
+		name, _ := acl["acl_name"].(string)
+		if isDomainACL(acl, domain) && isManagedACL(name, domain) {
+			route.domainACLs = append(route.domainACLs, indexedEntry{index: i, entry: acl})
+			route.releasedNames[name] = true
+		} else {
+			remaining[name]++
+		}
+	}
+	for name := range route.releasedNames {
+		if remaining[name] > 0 {
+			delete(route.releasedNames, name)
+		}
+	}
+	return route, nil
+}
+
+// aclNameFor returns the name of the connector's ACL of the domain. A short name already used by an
+// ACL of another domain, whose hash collides, is replaced by the long one.
+func (r *domainRoute) aclNameFor(frontend, backend, domain string) (string, error) {
+	for _, name := range []string{managedACLName(backend, domain), longManagedACLName(backend, domain)} {
+		collides := false
+		for _, acl := range r.acls {
+			if aclName, _ := acl["acl_name"].(string); aclName != name {
+				continue
+			}
+			if aclDomain, _, _, ok := parseDomainACL(acl); !ok || aclDomain != domain {
+				clientLog.Warn("ACL name collides with the ACL of another domain", "frontend", frontend, "acl", name,
+					"domain", domain, "other_domain", aclDomain, "backend", backend)
+				collides = true
+				break
+			}
+		}
+		if !collides {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("ACL names of domain %s and backend %s collide with other ACLs in frontend %s", domain, backend, frontend)
+}
+
+// setFrontendRuleInTransaction adds or replaces the ACL, switching rules and auth rule of a domain,
+// leaving the entries of other domains and hand-written ones untouched
+func (c *Client) setFrontendRuleInTransaction(frontend string, rule *FrontendRule, transactionID string) error {
+	route, err := c.getDomainRouteInTransaction(frontend, rule.Domain, transactionID)
+	if err != nil {
+		return err
+	}
+
+	aclName, err := route.aclNameFor(frontend, rule.Backend, rule.Domain)
+	if err != nil {
+		return err
+	}
+	if rule.Type == DomainTypeRegex {
+		clientLog.Debug("Adding regex ACL", "frontend", frontend, "domain", rule.Domain, "backend", rule.Backend,
+			"acl", aclName, "transaction", transactionID)
+	}
+	criterion, value := domainACL(rule.Domain, rule.Type, rule.HostMatch)
+	acl := map[string]interface{}{
+		"acl_name":  aclName,
+		"criterion": criterion,
+		"value":     value,
+	}
+	if err := c.replaceEntriesInTransaction(frontend, frontendListACLs, route.domainACLs,
+		[]map[string]interface{}{acl}, len(route.acls), transactionID); err != nil {
+		return fmt.Errorf("failed to update ACLs: %w", err)
+	}
+
+	names := map[string]bool{aclName: true}
+	for name := range route.releasedNames {
+		names[name] = true
+	}
+
+	// The canary rule must come first, so its share of the traffic never reaches the stable rule
+	var switching []map[string]interface{}
+	if rule.CanaryBackend != "" && rule.CanaryPercent > 0 {
+		switching = append(switching, canarySwitchingRule(aclName, rule.CanaryBackend, rule.CanaryPercent))
+	}
+	switching = append(switching, map[string]interface{}{
+		"cond":      "if",
+		"cond_test": aclName,
+		"name":      rule.Backend,
+	})
+	if err := c.replaceEntriesInTransaction(frontend, frontendListSwitchingRules,
+		referencingEntries(route.switching, names, false), switching, len(route.switching), transactionID); err != nil {
+		return fmt.Errorf("failed to update backend switching rules: %w", err)
+	}
+
+	var auth []map[string]interface{}
+	if rule.AuthUserlist != "" {
+		auth = append(auth, authRequestRule(aclName, rule.Backend, rule.AuthUserlist))
+	}
+	if err := c.replaceEntriesInTransaction(frontend, frontendListRequestRules,
+		referencingEntries(route.requests, names, true), auth, len(route.requests), transactionID); err != nil {
+		return fmt.Errorf("failed to update auth rules: %w", err)
+	}
+	return nil
+}
+
+// removeFrontendRuleInTransaction removes the connector's ACL of a domain and the rules conditioned on it
+func (c *Client) removeFrontendRuleInTransaction(frontend, domain, transactionID string) error {
+	route, err := c.getDomainRouteInTransaction(frontend, domain, transactionID)
+	if err != nil {
+		return err
+	}
+
+	// Rules are removed first, so they never reference a missing ACL
+	if err := c.replaceEntriesInTransaction(frontend, frontendListRequestRules,
+		referencingEntries(route.requests, route.releasedNames, true), nil, len(route.requests), transactionID); err != nil {
+		return fmt.Errorf("failed to update auth rules: %w", err)
+	}
+	if err := c.replaceEntriesInTransaction(frontend, frontendListSwitchingRules,
+		referencingEntries(route.switching, route.releasedNames, false), nil, len(route.switching), transactionID); err != nil {
+		return fmt.Errorf("failed to update backend switching rules: %w", err)
+	}
+	if err := c.replaceEntriesInTransaction(frontend, frontendListACLs, route.domainACLs, nil, len(route.acls), transactionID); err != nil {
+		return fmt.Errorf("failed to update ACLs: %w", err)
+	}
+	return nil
+}
+
+// resetFrontendRulesInTransaction removes the ACLs and rules of all domains the connector routes
+// in the frontend
+func (c *Client) resetFrontendRulesInTransaction(frontend, transactionID string) error {
+	acls, err := c.getFrontendListInTransaction(frontend, frontendListACLs, transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to get ACLs: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, acl := range acls {
+		name, _ := acl["acl_name"].(string)
+		domain, _, _, ok := parseDomainACL(acl)
+		if !ok || !isManagedACL(name, domain) || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		if err := c.removeFrontendRuleInTransaction(frontend, domain, transactionID); err != nil {
+			return fmt.Errorf("failed to remove rule for %s: %w", domain, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package haproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// frontendListServer simulates the ACL and rule lists of a frontend behind the per-index
+// endpoints of the Data Plane API and records the changes made to them
+type frontendListServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	lists   map[string][]map[string]interface{} // "<frontend>/<list>" -> entries
+	changes []string                            // "<method> <list>/<index>"
+}
+
+func newFrontendListServer(t *testing.T, lists map[string][]map[string]interface{}) *frontendListServer {
+	t.Helper()
+	s := &frontendListServer{lists: lists}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/v3/services/haproxy/")
+		switch {
+		case path == "configuration/version":
+			_, _ = w.Write([]byte("7"))
+		case path == "transactions" && r.Method == HTTPMethodPOST:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "tx-1", "status": "in_progress"})
+		case strings.HasPrefix(path, "transactions/"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "tx-1", "status": "success"})
+		case strings.HasPrefix(path, "configuration/frontends/"):
+			s.serveList(t, w, r, strings.Split(strings.TrimPrefix(path, "configuration/frontends/"), "/"))
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *frontendListServer) serveList(t *testing.T, w http.ResponseWriter, r *http.Request, parts []string) {
+	key := parts[0] + "/" + parts[1]
+	if len(parts) == 2 {
+		if r.Method != HTTPMethodGET {
+			t.Errorf("Expected %s to be changed per index, got %s", key, r.Method)
+		}
+		entries := s.lists[key]
+		if entries == nil {
+			entries = []map[string]interface{}{}
+		}
+		_ = json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	if r.URL.Query().Get("transaction_id") != "tx-1" {
+		t.Errorf("Expected %s %s to be part of the transaction", r.Method, r.URL.Path)
+	}
+	index, _ := strconv.Atoi(parts[2])
+	entries := s.lists[key]
+	var entry map[string]interface{}
+	if r.Method != HTTPMethodDELETE {
+		_ = json.NewDecoder(r.Body).Decode(&entry)
+	}
+	switch r.Method {
+	case HTTPMethodPOST:
+		entries = append(entries[:index], append([]map[string]interface{}{entry}, entries[index:]...)...)
+	case HTTPMethodPUT:
+		entries[index] = entry
+	case HTTPMethodDELETE:
+		entries = append(entries[:index], entries[index+1:]...)
+	}
+	s.lists[key] = entries
+	s.changes = append(s.changes, fmt.Sprintf("%s %s/%d", r.Method, parts[1], index))
+}
+
+func (s *frontendListServer) list(key string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists[key]
+}
+
+func (s *frontendListServer) recordedChanges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.changes...)
+}
+
+func TestSetFrontendRule_MinimalChanges(t *testing.T) {
+	apiACL := managedACLName("api", "api.example.com")
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{
+		"https/acls": {
+			{"acl_name": "is_static", "criterion": "path_beg", "value": "/static"},
+			{"acl_name": apiACL, "criterion": "hdr(host)", "value": "api.example.com"},
+			{"acl_name": "is_legacy", "criterion": "hdr(host)", "value": "legacy.example.com"},
+		},
+		"https/backend_switching_rules": {
+			{"cond": "if", "cond_test": "is_static", "name": "static"},
+			{"cond": "if", "cond_test": apiACL, "name": "api"},
+			{"cond": "if", "cond_test": "is_legacy", "name": "legacy"},
+		},
+	})
+	client := NewClient(server.URL, "admin", "password")
+
+	// Setting an unchanged rule changes nothing
+	if err := client.SetFrontendRule("https", FrontendRule{Domain: "api.example.com", Backend: "api"}); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+	if changes := server.recordedChanges(); len(changes) != 0 {
+		t.Errorf("Expected no changes for an unchanged rule, got %v", changes)
+	}
+
+	// A new domain is appended
+	if err := client.SetFrontendRule("https", FrontendRule{Domain: "new.example.com", Backend: "new"}); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+	expected := []string{"POST acls/3", "POST backend_switching_rules/3"}
+	if changes := server.recordedChanges(); fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, changes)
+	}
+
+	// Moving a domain to another backend replaces its entries in place
+	if err := client.SetFrontendRule("https", FrontendRule{Domain: "api.example.com", Backend: "api_v2"}); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+	expected = append(expected, "PUT acls/1", "PUT backend_switching_rules/1")
+	if changes := server.recordedChanges(); fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, changes)
+	}
+
+	rules := server.list("https/backend_switching_rules")
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, rule["name"].(string))
+	}
+	if fmt.Sprint(names) != "[static api_v2 legacy new]" {
+		t.Errorf("Expected the order of the rules to be kept, got %v", names)
+	}
+}
+
+func TestRemoveFrontendRule_KeepsHandWrittenACLs(t *testing.T) {
+	bACL := managedACLName("b", "b.example.com")
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{
+		"https/acls": {
+			{"acl_name": "is_sites", "criterion": "hdr(host)", "value": "a.example.com"},
+			{"acl_name": "is_sites", "criterion": "hdr(host)", "value": "b.example.com"},
+			{"acl_name": bACL, "criterion": "hdr(host)", "value": "b.example.com"},
+			{"acl_name": bACL, "criterion": "hdr(host)", "value": "c.example.com"},
+		},
+		"https/backend_switching_rules": {
+			{"cond": "if", "cond_test": "is_sites", "name": "sites"},
+			{"cond": "if", "cond_test": bACL, "name": "b"},
+		},
+	})
+	client := NewClient(server.URL, "admin", "password")
+
+	// The hand-written is_sites ACLs stay, and the connector's ACL name still matches c.example.com,
+	// so its rule must keep working
+	if err := client.RemoveFrontendRule("https", "b.example.com"); err != nil {
+		t.Fatalf("RemoveFrontendRule() failed: %v", err)
+	}
+	if changes := server.recordedChanges(); fmt.Sprint(changes) != "[DELETE acls/2]" {
+		t.Errorf("Expected only the connector's ACL entry of the domain to be deleted, got %v", changes)
+	}
+	if rules := server.list("https/backend_switching_rules"); len(rules) != 2 {
+		t.Errorf("Expected both switching rules to be kept, got %v", rules)
+	}
+}
+
+func TestSetFrontendRule_KeepsHandWrittenACLOfDomain(t *testing.T) {
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{
+		"https/acls":                    {{"acl_name": "host_app", "criterion": "hdr(host)", "value": "app.example.com"}},
+		"https/backend_switching_rules": {{"cond": "if", "cond_test": "host_app", "name": "app_manual"}},
+	})
+	client := NewClient(server.URL, "admin", "password")
+
+	if err := client.SetFrontendRule("https", FrontendRule{Domain: "app.example.com", Backend: "app"}); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+	expected := "[POST acls/1 POST backend_switching_rules/1]"
+	if changes := server.recordedChanges(); fmt.Sprint(changes) != expected {
+		t.Errorf("Expected changes %s, got %v", expected, changes)
+	}
+	if acls := server.list("https/acls"); acls[0]["acl_name"] != "host_app" {
+		t.Errorf("Expected hand-written ACL to be kept, got %v", acls)
+	}
+}
+
+func TestResetFrontendRules_KeepsHandWrittenEntries(t *testing.T) {
+	appACL := managedACLName("app", "app.example.com")
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{
+		"https/acls": {
+			{"acl_name": "is_static", "criterion": "path_beg", "value": "/static"},
+			{"acl_name": appACL, "criterion": "hdr(host)", "value": "app.example.com"},
+		},
+		"https/backend_switching_rules": {
+			{"cond": "if", "cond_test": appACL + " { rand(100) lt 10 }", "name": "app_canary"},
+			{"cond": "if", "cond_test": "is_static", "name": "static"},
+			{"cond": "if", "cond_test": appACL, "name": "app"},
+		},
+	})
+	client := NewClient(server.URL, "admin", "password")
+
+	if err := client.ResetFrontendRules("https"); err != nil {
+		t.Fatalf("ResetFrontendRules() failed: %v", err)
+	}
+	if acls := server.list("https/acls"); len(acls) != 1 || acls[0]["acl_name"] != "is_static" {
+		t.Errorf("Expected only the hand-written ACL to be left, got %v", acls)
+	}
+	if rules := server.list("https/backend_switching_rules"); len(rules) != 1 || rules[0]["name"] != "static" {
+		t.Errorf("Expected only the hand-written rule to be left, got %v", rules)
+	}
+}
+
+func TestSetFrontendRule_SuffixDomain(t *testing.T) {
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{})
+	client := NewClient(server.URL, "admin", "password")
+
+	rule := FrontendRule{Domain: ".tenants.example.com", Backend: "tenants", Type: DomainTypeSuffix}
+	if err := client.SetFrontendRule("https", rule); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+	acls := server.list("https/acls")
+	if len(acls) != 1 || acls[0]["criterion"] != "hdr_end(host)" || acls[0]["value"] != ".tenants.example.com" {
+		t.Fatalf("Expected hdr_end(host) ACL, got %v", acls)
+	}
+
+	rules, err := client.GetFrontendRules("https")
+	if err != nil {
+		t.Fatalf("GetFrontendRules() failed: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Type != DomainTypeSuffix || rules[0].Domain != rule.Domain || !rules[0].Managed {
+		t.Errorf("Expected managed suffix rule to be read back, got %+v", rules)
+	}
+
+	// Setting it again changes nothing
+	if err := client.SetFrontendRule("https", rule); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+	if changes := server.recordedChanges(); len(changes) != 2 {
+		t.Errorf("Expected no changes for an unchanged suffix rule, got %v", changes)
+	}
+}
+
+func TestDomainACL_HostMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		domain    string
+		typ       DomainType
+		hostMatch HostMatch
+		criterion string
+		value     string
+	}{
+		{"exact as sent", "example.com", DomainTypeExact, HostMatchHeader, "hdr(host)", "example.com"},
+		{"exact without port", "example.com", DomainTypeExact, HostMatchStripPort, "hdr(host),field(1,:)", "example.com"},
+		{"exact hdr_dom", "example.com", DomainTypeExact, HostMatchDomain, "hdr_dom(host)", "example.com"},
+		{"suffix as sent", ".example.com", DomainTypeSuffix, HostMatchHeader, "hdr_end(host)", ".example.com"},
+		{"suffix without port", ".example.com", DomainTypeSuffix, HostMatchStripPort, "hdr(host),field(1,:)", "-m end .example.com"},
+		{"suffix hdr_dom", ".example.com", DomainTypeSuffix, HostMatchDomain, "hdr(host),field(1,:)", "-m end .example.com"},
+		{"regex without port", "^api\\.", DomainTypeRegex, HostMatchStripPort, "hdr(host),field(1,:)", "-m reg ^api\\."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			criterion, value := domainACL(tt.domain, tt.typ, tt.hostMatch)
+			if criterion != tt.criterion || value != tt.value {
+				t.Fatalf("domainACL() = %q %q, expected %q %q", criterion, value, tt.criterion, tt.value)
+			}
+
+			// The ACL is read back as the rule it was created for
+			domain, typ, hostMatch, ok := parseDomainACL(map[string]interface{}{"criterion": criterion, "value": value})
+			if !ok || domain != tt.domain || typ != tt.typ || hostMatch != tt.hostMatch.ForType(tt.typ) {
+				t.Errorf("parseDomainACL() = %q %q %q %v", domain, typ, hostMatch, ok)
+			}
+		})
+	}
+}
+
+func TestSetFrontendRule_ACLNameCollision(t *testing.T) {
+	// Both domains share the short hash dbd2b615
+	taken := managedACLName("app", "app85101.example.com")
+	if taken != managedACLName("app", "app158717.example.com") {
+		t.Fatal("Expected the short ACL names of the domains to collide")
+	}
+	server := newFrontendListServer(t, map[string][]map[string]interface{}{
+		"https/acls":                    {{"acl_name": taken, "criterion": "hdr(host)", "value": "app85101.example.com"}},
+		"https/backend_switching_rules": {{"cond": "if", "cond_test": taken, "name": "app"}},
+	})
+	client := NewClient(server.URL, "admin", "password")
+
+	if err := client.SetFrontendRule("https", FrontendRule{Domain: "app158717.example.com", Backend: "app"}); err != nil {
+		t.Fatalf("SetFrontendRule() failed: %v", err)
+	}
+	acls := server.list("https/acls")
+	if len(acls) != 2 || acls[0]["value"] != "app85101.example.com" {
+		t.Fatalf("Expected the ACL of the other domain to be kept, got %v", acls)
+	}
+	longName := longManagedACLName("app", "app158717.example.com")
+	if acls[1]["acl_name"] != longName {
+		t.Errorf("Expected the long ACL name %s, got %v", longName, acls[1]["acl_name"])
+	}
+
+	rules, err := client.GetFrontendRules("https")
+	if err != nil {
+		t.Fatalf("GetFrontendRules() failed: %v", err)
+	}
+	if len(rules) != 2 || !rules[0].Managed || !rules[1].Managed {
+		t.Errorf("Expected both rules to be managed, got %+v", rules)
+	}
+
+	// Removing the domain leaves the colliding one alone
+	if err := client.RemoveFrontendRule("https", "app158717.example.com"); err != nil {
+		t.Fatalf("RemoveFrontendRule() failed: %v", err)
+	}
+	if acls := server.list("https/acls"); len(acls) != 1 || acls[0]["acl_name"] != taken {
+		t.Errorf("Expected only the other domain's ACL to be left, got %v", acls)
+	}
+	if rules := server.list("https/backend_switching_rules"); len(rules) != 1 || rules[0]["cond_test"] != taken {
+		t.Errorf("Expected only the other domain's rule to be left, got %v", rules)
+	}
+}
+
+func TestManagedACLName_Limits(t *testing.T) {
+	name := managedACLName("team-a/web app#1", "example.com")
+	if name != "is_team_a_web_app_1_"+hashDomain("example.com") {
+		t.Errorf("Expected invalid characters to be replaced, got %s", name)
+	}
+
+	long := longManagedACLName(strings.Repeat("backend", 20), "example.com")
+	if len(long) > MaxACLNameLength || !strings.HasSuffix(long, "_"+longHashDomain("example.com")) {
+		t.Errorf("Expected the name to be truncated to %d characters keeping the hash, got %s", MaxACLNameLength, long)
+	}
+	if !isManagedACL(long, "example.com") {
+		t.Errorf("Expected the truncated name to be recognized as managed")
+	}
+}
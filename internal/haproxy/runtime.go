@@ -0,0 +1,200 @@
+package haproxy
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Modes of the runtime socket client next to the Data Plane API
+const (
+	// RuntimeModeFallback sends server state changes over the stats socket when the Data Plane
+	// API is unreachable or fails
+	RuntimeModeFallback = "fallback"
+	// RuntimeModePrefer sends server state changes and reads over the stats socket first, and
+	// only uses the Data Plane API when the socket fails
+	RuntimeModePrefer = "prefer"
+
+	DefaultRuntimeTimeoutSec = 5
+)
+
+// RuntimeClient speaks the HAProxy runtime API on the stats socket (stats socket ... level admin),
+// which changes server states and weights without the Data Plane API and without a reload
+type RuntimeClient struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// StatRow is a server or proxy line of "show stat"
+type StatRow struct {
+	Proxy   string // pxname
+	Server  string // svname, FRONTEND and BACKEND for the proxy lines
+	Status  string // UP, DOWN, MAINT, DRAIN, NOLB, no check, ...
+	Weight  int
+	Address string // addr, empty for proxy lines
+	Current int    // scur, current sessions
+}
+
+// NewRuntimeClient creates a client of the stats socket at address: a unix socket path (optionally
+// prefixed with unix://) or host:port of a TCP stats socket (tcp://host:port)
+func NewRuntimeClient(address string, timeout time.Duration) *RuntimeClient {
+	if timeout <= 0 {
+		timeout = DefaultRuntimeTimeoutSec * time.Second
+	}
+	client := &RuntimeClient{network: "unix", address: strings.TrimPrefix(address, UnixSocketScheme), timeout: timeout}
+	if tcpAddress, ok := strings.CutPrefix(address, "tcp://"); ok {
+		client.network, client.address = "tcp", tcpAddress
+	}
+	return client
+}
+
+// Execute sends a single command and returns the response. The socket closes the connection
+// after answering in non-interactive mode.
+func (r *RuntimeClient) Execute(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, r.network, r.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to stats socket %s: %w", r.address, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, command+"\n"); err != nil {
+		return "", fmt.Errorf("failed to send %q to stats socket: %w", command, err)
+	}
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response of %q from stats socket: %w", command, err)
+	}
+	return string(response), nil
+}
+
+// executeSet sends a command that answers with an empty line on success and a message otherwise
+func (r *RuntimeClient) executeSet(ctx context.Context, command string) error {
+	response, err := r.Execute(ctx, command)
+	if err != nil {
+		return err
+	}
+	if message := strings.TrimSpace(response); message != "" {
+		return fmt.Errorf("stats socket rejected %q: %s", command, message)
+	}
+	return nil
+}
+
+// SetServerState sets the administrative state of a server: ready, drain or maint
+func (r *RuntimeClient) SetServerState(ctx context.Context, backendName, serverName, adminState string) error {
+	return r.executeSet(ctx, fmt.Sprintf("set server %s/%s state %s", backendName, serverName, adminState))
+}
+
+// SetServerWeight sets the weight of a server
+func (r *RuntimeClient) SetServerWeight(ctx context.Context, backendName, serverName string, weight int) error {
+	return r.executeSet(ctx, fmt.Sprintf("set server %s/%s weight %d", backendName, serverName, weight))
+}
+
+// ShowStat returns the statistics of all proxies and servers
+func (r *RuntimeClient) ShowStat(ctx context.Context) ([]StatRow, error) {
+	response, err := r.Execute(ctx, "show stat")
+	if err != nil {
+		return nil, err
+	}
+	return parseStat(response)
+}
+
+// GetRuntimeServer returns the state of a server like the Data Plane API runtime endpoint
+func (r *RuntimeClient) GetRuntimeServer(ctx context.Context, backendName, serverName string) (*RuntimeServer, error) {
+	rows, err := r.ShowStat(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.Proxy == backendName && row.Server == serverName {
+			return row.runtimeServer(), nil
+		}
+	}
+	return nil, &APIError{StatusCode: 404, Message: fmt.Sprintf("server %s/%s not found on stats socket", backendName, serverName)}
+}
+
+// GetRuntimeServers returns the state of all servers of a backend with a single show stat
+func (r *RuntimeClient) GetRuntimeServers(ctx context.Context, backendName string) ([]RuntimeServer, error) {
+	rows, err := r.ShowStat(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var servers []RuntimeServer
+	for _, row := range rows {
+		if row.Proxy == backendName && row.Server != "FRONTEND" && row.Server != "BACKEND" {
+			servers = append(servers, *row.runtimeServer())
+		}
+	}
+	return servers, nil
+}
+
+// runtimeServer maps the status of show stat to the admin and operational state
+func (s *StatRow) runtimeServer() *RuntimeServer {
+	server := &RuntimeServer{ServerName: s.Server, AdminState: "ready", OperationalState: "up"}
+	if host, port, err := net.SplitHostPort(s.Address); err == nil {
+		server.Address = host
+		server.Port, _ = strconv.Atoi(port)
+	}
+
+	status := strings.ToUpper(s.Status)
+	switch {
+	case strings.HasPrefix(status, "MAINT"):
+		server.AdminState, server.OperationalState = "maint", "down"
+	case strings.HasPrefix(status, "DRAIN"):
+		server.AdminState = "drain"
+	case strings.HasPrefix(status, "DOWN"):
+		server.OperationalState = "down"
+	}
+	return server
+}
+
+// parseStat parses the CSV output of show stat, whose header line starts with "# "
+func parseStat(response string) ([]StatRow, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(response, "# ")))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse show stat: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("show stat returned no header")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	rows := make([]StatRow, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := StatRow{
+			Proxy:   field(record, "pxname"),
+			Server:  field(record, "svname"),
+			Status:  field(record, "status"),
+			Address: field(record, "addr"),
+		}
+		row.Weight, _ = strconv.Atoi(field(record, "weight"))
+		row.Current, _ = strconv.Atoi(field(record, "scur"))
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
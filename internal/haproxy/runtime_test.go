@@ -0,0 +1,152 @@
+package haproxy
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testShowStat = `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,addr
+web,web_1,0,0,3,5,,10,0,0,0,0,,0,0,0,0,UP,100,1,0,10.0.0.1:8080
+web,web_2,0,0,0,0,,0,0,0,0,0,,0,0,0,0,MAINT,100,1,0,10.0.0.2:8080
+web,web_3,0,0,1,1,,1,0,0,0,0,,0,0,0,0,DRAIN,0,1,0,10.0.0.3:8080
+web,BACKEND,0,0,4,5,,11,0,0,0,0,,0,0,0,0,UP,200,2,0,
+
+`
+
+// statsSocket answers runtime API commands on a unix socket and records them
+type statsSocket struct {
+	mu        sync.Mutex
+	commands  []string
+	responses map[string]string
+}
+
+func newStatsSocket(t *testing.T, responses map[string]string) (*statsSocket, string) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "stats")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "admin.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	socket := &statsSocket{responses: responses}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			command, _ := bufio.NewReader(conn).ReadString('\n')
+			command = strings.TrimSpace(command)
+			socket.mu.Lock()
+			socket.commands = append(socket.commands, command)
+			response := socket.responses[command]
+			socket.mu.Unlock()
+			_, _ = conn.Write([]byte(response + "\n"))
+			conn.Close()
+		}
+	}()
+	return socket, path
+}
+
+func (s *statsSocket) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func TestRuntimeClient(t *testing.T) {
+	socket, path := newStatsSocket(t, map[string]string{
+		"show stat":                          testShowStat,
+		"set server web/missing state maint": "No such server.",
+	})
+	client := NewRuntimeClient(UnixSocketScheme+path, 0)
+	ctx := context.Background()
+
+	rows, err := client.ShowStat(ctx)
+	if err != nil {
+		t.Fatalf("ShowStat() failed: %v", err)
+	}
+	if len(rows) != 4 || rows[0].Server != "web_1" || rows[0].Weight != 100 || rows[0].Current != 3 {
+		t.Errorf("Unexpected stats: %+v", rows)
+	}
+
+	server, err := client.GetRuntimeServer(ctx, "web", "web_2")
+	if err != nil || server.AdminState != "maint" || server.Address != "10.0.0.2" || server.Port != 8080 {
+		t.Errorf("Expected web_2 in maintenance, got %+v (%v)", server, err)
+	}
+	if server, _ := client.GetRuntimeServer(ctx, "web", "web_3"); server.AdminState != "drain" {
+		t.Errorf("Expected web_3 draining, got %+v", server)
+	}
+	if _, err := client.GetRuntimeServer(ctx, "web", "web_9"); err == nil {
+		t.Error("Expected an unknown server to fail")
+	}
+	if servers, err := client.GetRuntimeServers(ctx, "web"); err != nil || len(servers) != 3 || servers[2].ServerName != "web_3" {
+		t.Errorf("Expected the 3 servers of web without the BACKEND line, got %+v (%v)", servers, err)
+	}
+
+	if err := client.SetServerState(ctx, "web", "web_1", "drain"); err != nil {
+		t.Errorf("SetServerState() failed: %v", err)
+	}
+	if err := client.SetServerWeight(ctx, "web", "web_1", 50); err != nil {
+		t.Errorf("SetServerWeight() failed: %v", err)
+	}
+	if err := client.SetServerState(ctx, "web", "missing", "maint"); err == nil || !strings.Contains(err.Error(), "No such server.") {
+		t.Errorf("Expected the socket's message as error, got %v", err)
+	}
+
+	commands := socket.received()
+	if commands[len(commands)-3] != "set server web/web_1 state drain" || commands[len(commands)-2] != "set server web/web_1 weight 50" {
+		t.Errorf("Unexpected commands: %v", commands)
+	}
+}
+
+func TestClient_RuntimeSocketFallback(t *testing.T) {
+	socket, path := newStatsSocket(t, map[string]string{})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+
+	options := DefaultClientOptions()
+	options.RetryAttempts = 0
+	options.RuntimeSocket = path
+	if err := NewClientWithOptions(api.URL, "admin", "adminpwd", options).DrainServer("web", "web_1"); err != nil {
+		t.Fatalf("Expected the stats socket to take over, got %v", err)
+	}
+	if commands := socket.received(); len(commands) != 1 || commands[0] != "set server web/web_1 state drain" {
+		t.Errorf("Expected the drain on the stats socket, got %v", commands)
+	}
+}
+
+func TestClient_RuntimeSocketPreferred(t *testing.T) {
+	socket, path := newStatsSocket(t, map[string]string{})
+	apiCalls := 0
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCalls++
+	}))
+	defer api.Close()
+
+	options := DefaultClientOptions()
+	options.RuntimeSocket = path
+	options.RuntimeMode = RuntimeModePrefer
+	if err := NewClientWithOptions(api.URL, "admin", "adminpwd", options).MaintainServer("web", "web_1"); err != nil {
+		t.Fatalf("MaintainServer() failed: %v", err)
+	}
+	if apiCalls != 0 || len(socket.received()) != 1 {
+		t.Errorf("Expected only the stats socket to be used, got %d API calls and %v", apiCalls, socket.received())
+	}
+}
@@ -0,0 +1,31 @@
+package haproxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// UnixSocketScheme prefixes Data Plane API addresses that are unix socket paths, e.g.
+// unix:///var/run/dataplaneapi.sock
+const UnixSocketScheme = "unix://"
+
+// unixSocketBaseURL is the base of request URLs sent over a unix socket, its host only ends up in
+// the Host header
+const unixSocketBaseURL = "http://dataplaneapi"
+
+// unixSocketPath returns the socket path of a unix:// address
+func unixSocketPath(address string) (string, bool) {
+	path, ok := strings.CutPrefix(address, UnixSocketScheme)
+	return path, ok && path != ""
+}
+
+// dialUnixSocket makes the transport connect every request to the socket at path
+func dialUnixSocket(transport *http.Transport, path string) {
+	dialer := &net.Dialer{}
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+}
@@ -0,0 +1,45 @@
+package haproxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClient_UnixSocket(t *testing.T) {
+	// Socket paths are limited to about 100 bytes, t.TempDir() may be longer
+	dir, err := os.MkdirTemp("", "dpapi")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "api.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/info" {
+			t.Errorf("Expected /v3/info, got %s", r.URL.Path)
+		}
+		if username, _, _ := r.BasicAuth(); username != "admin" {
+			t.Errorf("Expected basic auth, got %q", username)
+		}
+		_, _ = w.Write([]byte(`{"api": {"version": "v3.0.0"}}`))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	info, err := NewClient(UnixSocketScheme+socketPath, "admin", "adminpwd").GetInfo()
+	if err != nil {
+		t.Fatalf("GetInfo() over the socket failed: %v", err)
+	}
+	if info.API.Version != "v3.0.0" {
+		t.Errorf("Expected version v3.0.0, got %s", info.API.Version)
+	}
+}
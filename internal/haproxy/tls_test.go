@@ -0,0 +1,129 @@
+package haproxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeClientCertificate creates a self-signed client certificate and returns it with the
+// paths of its PEM certificate and key files
+func writeClientCertificate(t *testing.T, dir string) (certificate *x509.Certificate, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "haproxy-nomad-connector"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	certificate, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "client.pem")
+	keyFile = filepath.Join(dir, "client-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certificate, certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestClient_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := writeClientCertificate(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"api": {"version": "v3.0.0"}}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	tlsConfig, err := NewTLSConfig(caFile, certFile, keyFile, "", false)
+	if err != nil {
+		t.Fatalf("NewTLSConfig() failed: %v", err)
+	}
+	options := DefaultClientOptions()
+	options.TLSConfig = tlsConfig
+	options.RetryAttempts = 0
+	info, err := NewClientWithOptions(server.URL, "admin", "adminpwd", options).GetInfo()
+	if err != nil {
+		t.Fatalf("Expected the request with client certificate to succeed, got %v", err)
+	}
+	if info.API.Version != "v3.0.0" {
+		t.Errorf("Expected version v3.0.0, got %s", info.API.Version)
+	}
+
+	// Without the client certificate the server rejects the handshake
+	tlsConfig, err = NewTLSConfig(caFile, "", "", "", false)
+	if err != nil {
+		t.Fatalf("NewTLSConfig() failed: %v", err)
+	}
+	options.TLSConfig = tlsConfig
+	if _, err := NewClientWithOptions(server.URL, "admin", "adminpwd", options).GetInfo(); err == nil {
+		t.Error("Expected the request without client certificate to fail")
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	_, certFile, _ := writeClientCertificate(t, dir)
+
+	tests := []struct {
+		caFile, certFile, keyFile string
+		expected                  string
+	}{
+		{caFile: filepath.Join(dir, "missing.pem"), expected: "failed to read CA bundle"},
+		{caFile: notPEM, expected: "no PEM certificates found"},
+		{certFile: certFile, expected: "failed to load client certificate"},
+	}
+	for _, test := range tests {
+		if _, err := NewTLSConfig(test.caFile, test.certFile, test.keyFile, "", false); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Expected %q, got %v", test.expected, err)
+		}
+	}
+}
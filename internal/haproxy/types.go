@@ -1,6 +1,9 @@
 package haproxy
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Data Plane API response structures
 type APIInfo struct {
@@ -21,6 +24,52 @@ type Backend struct {
 	AdvCheck        string           `json:"adv_check,omitempty"`      // "httpchk", "ldap-check", "mysql-check", etc.
 	HTTPCheckParams *HTTPCheckParams `json:"httpchk_params,omitempty"` // HTTP check parameters
 	DefaultServer   *Server          `json:"default_server,omitempty"` // Default server parameters
+
+	Cookie           *Cookie      `json:"cookie,omitempty"`             // Cookie-based persistence
+	DynamicCookieKey string       `json:"dynamic_cookie_key,omitempty"` // Secret for dynamic server cookies
+	StickTable       *StickTable  `json:"stick_table,omitempty"`        // Stick table for stick rules
+	Forwardfor       *Forwardfor  `json:"forwardfor,omitempty"`         // option forwardfor
+	Compression      *Compression `json:"compression,omitempty"`        // HTTP compression of responses
+
+	ServerTimeout  int `json:"server_timeout,omitempty"`  // Server inactivity timeout in milliseconds
+	ConnectTimeout int `json:"connect_timeout,omitempty"` // Server connect timeout in milliseconds
+	TunnelTimeout  int `json:"tunnel_timeout,omitempty"`  // Inactivity timeout of tunnels, e.g. WebSockets, in milliseconds
+	CheckTimeout   int `json:"check_timeout,omitempty"`   // Health check timeout in milliseconds
+}
+
+// Cookie configures cookie-based session persistence of a backend
+type Cookie struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"` // "insert", "rewrite", "prefix"
+	Indirect bool   `json:"indirect,omitempty"`
+	Nocache  bool   `json:"nocache,omitempty"`
+	Dynamic  bool   `json:"dynamic,omitempty"` // Derive server cookies from address, port and dynamic_cookie_key
+}
+
+// Compression configures the HTTP compression of a backend's responses
+type Compression struct {
+	Algorithms []string `json:"algorithms,omitempty"` // "gzip", "deflate", "raw-deflate", "identity"
+	Types      []string `json:"types,omitempty"`      // Content types to compress (empty = all)
+}
+
+// Forwardfor configures option forwardfor, adding the client IP to requests as X-Forwarded-For
+type Forwardfor struct {
+	Enabled string `json:"enabled"` // "enabled"
+}
+
+// StickTable configures the stick table of a backend
+type StickTable struct {
+	Type   string `json:"type"`             // "ip", "ipv6", "string", ...
+	Size   int    `json:"size,omitempty"`   // Maximum number of entries
+	Expire int    `json:"expire,omitempty"` // Entry lifetime in milliseconds
+	Store  string `json:"store,omitempty"`  // Stored data types, e.g. "http_req_rate(10s)"
+}
+
+// StickTableEntry is an entry of a stick table as read from the runtime API
+type StickTableEntry struct {
+	Key         string `json:"key"`
+	HTTPReqCnt  int64  `json:"http_req_cnt"`  // Requests counted since the entry was created
+	HTTPReqRate int64  `json:"http_req_rate"` // Requests within the rate period of the table
 }
 
 type HTTPCheckParams struct {
@@ -43,6 +92,23 @@ type Server struct {
 	CheckPath   string `json:"check_path,omitempty"`   // HTTP check path
 	CheckMethod string `json:"check_method,omitempty"` // HTTP check method
 	CheckHost   string `json:"check_host,omitempty"`   // HTTP check host header
+	Maxconn     int    `json:"maxconn,omitempty"`      // Maximum concurrent connections per server
+	Slowstart   int    `json:"slowstart,omitempty"`    // Milliseconds a server ramps up to its full weight after coming up
+	Maintenance string `json:"maintenance,omitempty"`  // "enabled" starts the server in maintenance mode
+	Inter       int    `json:"inter,omitempty"`        // Health check interval in milliseconds
+	Rise        int    `json:"rise,omitempty"`         // Consecutive successful checks to consider the server up
+	Fall        int    `json:"fall,omitempty"`         // Consecutive failed checks to consider the server down
+	CheckSSL    string `json:"check-ssl,omitempty"`    // "enabled" runs health checks over TLS
+	Verify      string `json:"verify,omitempty"`       // "none" or "required" certificate verification
+	SSLCAFile   string `json:"ssl_cafile,omitempty"`   // CA file to verify server certificates with
+	AgentCheck  string `json:"agent-check,omitempty"`  // "enabled" lets an agent on the server drive its weight and state
+	AgentAddr   string `json:"agent-addr,omitempty"`   // Address of the agent, defaults to the server address
+	AgentPort   int    `json:"agent-port,omitempty"`   // TCP port of the agent
+	Proto       string `json:"proto,omitempty"`        // Protocol spoken to the server, e.g. "h2"
+	Observe     string `json:"observe,omitempty"`      // "layer4" or "layer7" counts errors of live traffic
+	OnError     string `json:"on-error,omitempty"`     // "fastinter", "fail-check", "sudden-death", "mark-down"
+	ErrorLimit  int    `json:"error_limit,omitempty"`  // Consecutive errors that trigger on-error
+	ALPN        string `json:"alpn,omitempty"`         // ALPN protocols offered on TLS connections, e.g. "h2,http/1.1"
 }
 
 type RuntimeServer struct {
@@ -56,8 +122,78 @@ type RuntimeServer struct {
 
 type Frontend struct {
 	Name           string `json:"name"`
+	Mode           string `json:"mode,omitempty"` // "http", "tcp"
 	DefaultBackend string `json:"default_backend,omitempty"`
 	From           string `json:"from,omitempty"`
+	LogFormat      string `json:"log_format,omitempty"`
+	HTTPLog        bool   `json:"httplog,omitempty"` // option httplog
+	TCPLog         bool   `json:"tcplog,omitempty"`  // option tcplog
+}
+
+// Bind represents a bind directive of a frontend
+type Bind struct {
+	Name           string `json:"name"`
+	Address        string `json:"address,omitempty"`
+	Port           int    `json:"port,omitempty"`
+	SSL            bool   `json:"ssl,omitempty"`
+	SSLCertificate string `json:"ssl_certificate,omitempty"` // Certificate file or directory (enables ssl)
+}
+
+// Parent types for configuration objects that live inside a frontend or backend
+const (
+	ParentTypeFrontend = "frontends"
+	ParentTypeBackend  = "backends"
+)
+
+// HTTPRequestRule represents an http-request rule of a frontend or backend
+type HTTPRequestRule struct {
+	Type       string `json:"type"`                  // "redirect", "auth", "set-header", "deny", ...
+	Cond       string `json:"cond,omitempty"`        // "if", "unless"
+	CondTest   string `json:"cond_test,omitempty"`   // Condition, e.g. "{ hdr(host) -i example.com }"
+	RedirType  string `json:"redir_type,omitempty"`  // "location", "prefix", "scheme"
+	RedirValue string `json:"redir_value,omitempty"` // Redirect target
+	RedirCode  int    `json:"redir_code,omitempty"`  // 301, 302, 303, 307, 308
+	HdrName    string `json:"hdr_name,omitempty"`    // Header of set-header, e.g. "X-Forwarded-Prefix"
+	HdrFormat  string `json:"hdr_format,omitempty"`  // Log-format value of set-header
+
+	TrackSCKey          string `json:"track_sc_key,omitempty"`           // Sample tracked by track-sc, e.g. "src"
+	TrackSCTable        string `json:"track_sc_table,omitempty"`         // Stick table of track-sc
+	TrackSCStickCounter int    `json:"track_sc_stick_counter,omitempty"` // Sticky counter of track-sc (default 0)
+	DenyStatus          int    `json:"deny_status,omitempty"`            // Status code of deny
+}
+
+// HTTPResponseRule represents an http-response rule of a frontend or backend
+type HTTPResponseRule struct {
+	Type      string `json:"type"`                 // "set-header", "del-header", "deny", ...
+	Cond      string `json:"cond,omitempty"`       // "if", "unless"
+	CondTest  string `json:"cond_test,omitempty"`  // Condition
+	HdrName   string `json:"hdr_name,omitempty"`   // Header of set-header
+	HdrFormat string `json:"hdr_format,omitempty"` // Log-format value of set-header
+}
+
+// BackendSwitchingRule represents a use_backend rule of a frontend
+type BackendSwitchingRule struct {
+	Name     string `json:"name"`                // Backend to use
+	Cond     string `json:"cond,omitempty"`      // "if", "unless"
+	CondTest string `json:"cond_test,omitempty"` // Condition, e.g. "{ path_beg /.well-known/acme-challenge/ }"
+}
+
+// StickRule represents a stick rule of a backend
+type StickRule struct {
+	Type     string `json:"type"`                // "on", "match", "store-request", "store-response"
+	Pattern  string `json:"pattern"`             // Sample expression, e.g. "src"
+	Cond     string `json:"cond,omitempty"`      // "if", "unless"
+	CondTest string `json:"cond_test,omitempty"` // Condition
+}
+
+// SSLCertificate represents a certificate file in the Data Plane API storage
+type SSLCertificate struct {
+	StorageName       string     `json:"storage_name"`
+	File              string     `json:"file,omitempty"`
+	Description       string     `json:"description,omitempty"`
+	Domains           string     `json:"domains,omitempty"`
+	NotAfter          *time.Time `json:"not_after,omitempty"`
+	SHA256FingerPrint string     `json:"sha256_finger_print,omitempty"`
 }
 
 // Service classification for our connector
@@ -118,9 +254,28 @@ type DomainType string
 const (
 	DomainTypeExact  DomainType = "exact"  // exact domain match
 	DomainTypePrefix DomainType = "prefix" // domain prefix match
+	DomainTypeSuffix DomainType = "suffix" // domain suffix match, e.g. ".example.com" for all subdomains
 	DomainTypeRegex  DomainType = "regex"  // regex pattern match
 )
 
+// HostMatch is how the ACL of a domain rule reads the Host header
+type HostMatch string
+
+const (
+	HostMatchHeader    HostMatch = ""           // Host header as sent, "example.com:8443" doesn't match example.com
+	HostMatchStripPort HostMatch = "strip_port" // Host header without port: hdr(host),field(1,:)
+	HostMatchDomain    HostMatch = "hdr_dom"    // hdr_dom(host) for exact domains, which matches subdomains as well
+)
+
+// ForType returns how the ACL of a domain of the type reads the Host header. hdr_dom(host) only
+// applies to exact domains, the other types strip the port instead.
+func (m HostMatch) ForType(domainType DomainType) HostMatch {
+	if m == HostMatchDomain && domainType != DomainTypeExact && domainType != "" {
+		return HostMatchStripPort
+	}
+	return m
+}
+
 // DomainMapConfig holds configuration for domain map file management
 type DomainMapConfig struct {
 	FilePath string `json:"file_path"`
@@ -129,45 +284,144 @@ type DomainMapConfig struct {
 
 // FrontendRule represents a domain-to-backend routing rule
 type FrontendRule struct {
-	Domain  string     `json:"domain"`
-	Backend string     `json:"backend"`
-	Type    DomainType `json:"type,omitempty"` // Domain matching type
+	Domain       string     `json:"domain"`
+	Backend      string     `json:"backend"`
+	Type         DomainType `json:"type,omitempty"`          // Domain matching type
+	AuthUserlist string     `json:"auth_userlist,omitempty"` // Userlist required via basic auth (empty: no auth)
+	HostMatch    HostMatch  `json:"host_match,omitempty"`    // How the Host header is matched (empty: as sent)
+
+	// CanaryBackend receives CanaryPercent percent of the domain's traffic (empty: no canary)
+	CanaryBackend string `json:"canary_backend,omitempty"`
+	CanaryPercent int    `json:"canary_percent,omitempty"`
+
+	// Managed is set on rules read back whose ACL is named the way the connector names its ACLs,
+	// rules written by hand are not
+	Managed bool `json:"managed,omitempty"`
 }
 
-// APIError represents an API error response
-type APIError struct {
-	StatusCode int    `json:"status_code"`
-	Message    string `json:"message"`
+// Userlist represents a userlist section
+type Userlist struct {
+	Name string `json:"name"`
 }
 
-func (e *APIError) Error() string {
-	return e.Message
+// User represents a user of a userlist
+type User struct {
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	SecurePassword bool   `json:"secure_password"` // Password is a crypt(3) hash
 }
 
-// ClientInterface defines the interface for HAProxy client operations
-type ClientInterface interface {
+// TransactionStatusInProgress marks transactions that are neither committed nor failed
+const TransactionStatusInProgress = "in_progress"
+
+// Transaction represents a configuration transaction
+type Transaction struct {
+	ID      string `json:"id"`
+	Version int    `json:"_version"` // Configuration version the transaction was started on
+	Status  string `json:"status"`
+}
+
+// ConfigurationClient covers the API itself and the configuration as a whole
+type ConfigurationClient interface {
+	GetInfo() (*APIInfo, error)
 	GetConfigVersion() (int, error)
+	GetRawConfiguration() (string, error)
+	DeleteStaleTransactions() (int, error)
+}
+
+// BackendClient manages backends, their servers and everything configured per backend
+type BackendClient interface {
+	GetBackends() ([]Backend, error)
 	GetBackend(name string) (*Backend, error)
 	CreateBackend(backend Backend, version int) (*Backend, error)
 	ReplaceBackend(backend *Backend, version int) (*Backend, error)
+	DeleteBackend(name string, version int) error
 	GetServers(backendName string) ([]Server, error)
 	CreateServer(backendName string, server *Server, version int) (*Server, error)
 	DeleteServer(backendName, serverName string, version int) error
+	ReplaceServer(backendName string, server *Server, version int) error
+	SwapServer(backendName, oldServerName string, server *Server) error
+	UpdateServers(backendName string, remove []string, create []Server) error
+
+	// HTTP check management
+	SetHTTPChecks(backendName string, checks []HTTPCheck, version int) error
+	GetHTTPChecks(backendName string) ([]HTTPCheck, error)
 
-	// Runtime server management
+	// Stick rule management
+	GetStickRules(backend string) ([]StickRule, error)
+	CreateStickRule(backend string, index int, rule *StickRule, version int) error
+	DeleteStickRule(backend string, index, version int) error
+}
+
+// RuntimeServerClient changes server state at runtime without touching the configuration
+type RuntimeServerClient interface {
 	GetRuntimeServer(backendName, serverName string) (*RuntimeServer, error)
+	GetRuntimeServers(backendName string) ([]RuntimeServer, error)
 	SetServerState(ctx context.Context, backendName, serverName, adminState string) error
 	DrainServer(backendName, serverName string) error
 	ReadyServer(backendName, serverName string) error
 	MaintainServer(backendName, serverName string) error
+	GetStickTableEntries(table string) ([]StickTableEntry, error)
+}
+
+// FrontendClient manages frontends and how they route domains to backends
+type FrontendClient interface {
+	GetFrontend(name string) (*Frontend, error)
+	CreateFrontend(frontend *Frontend, version int) (*Frontend, error)
+	UpdateFrontendLogging(frontend *Frontend, version int) error
+	SetFrontendDefaultBackend(frontendName, backendName string, version int) error
+	DeleteFrontend(name string, version int) error
+	CreateBind(frontendName string, bind *Bind, version int) (*Bind, error)
+	EnsureFrontend(frontend *Frontend, binds []Bind) (bool, error)
 
 	// Frontend rule management
 	AddFrontendRule(frontend, domain, backend string) error
 	AddFrontendRuleWithType(frontend, domain, backend string, domainType DomainType) error
+	SetFrontendRule(frontend string, rule FrontendRule) error
 	RemoveFrontendRule(frontend, domain string) error
 	GetFrontendRules(frontend string) ([]FrontendRule, error)
+	ResetFrontendRules(frontend string) error
 
-	// HTTP check management
-	SetHTTPChecks(backendName string, checks []HTTPCheck, version int) error
-	GetHTTPChecks(backendName string) ([]HTTPCheck, error)
+	// Backend switching rule management
+	GetBackendSwitchingRules(frontend string) ([]BackendSwitchingRule, error)
+	CreateBackendSwitchingRule(frontend string, index int, rule *BackendSwitchingRule, version int) error
+	DeleteBackendSwitchingRule(frontend string, index, version int) error
+}
+
+// HTTPRuleClient manages http-request and http-response rules (parentType is ParentTypeFrontend or ParentTypeBackend)
+type HTTPRuleClient interface {
+	GetHTTPRequestRules(parentType, parentName string) ([]HTTPRequestRule, error)
+	CreateHTTPRequestRule(parentType, parentName string, index int, rule *HTTPRequestRule, version int) error
+	DeleteHTTPRequestRule(parentType, parentName string, index, version int) error
+	GetHTTPResponseRules(parentType, parentName string) ([]HTTPResponseRule, error)
+	CreateHTTPResponseRule(parentType, parentName string, index int, rule *HTTPResponseRule, version int) error
+	DeleteHTTPResponseRule(parentType, parentName string, index, version int) error
+}
+
+// UserlistClient manages userlists for basic auth
+type UserlistClient interface {
+	EnsureUserlistUser(userlist, username, passwordHash string) error
+	DeleteUserlist(name string, version int) error
+}
+
+// CertificateClient manages the SSL certificate storage
+type CertificateClient interface {
+	GetSSLCertificates() ([]SSLCertificate, error)
+	GetSSLCertificate(name string) (*SSLCertificate, error)
+	CreateSSLCertificate(name string, pem []byte) (*SSLCertificate, error)
+	ReplaceSSLCertificate(name string, pem []byte) (*SSLCertificate, error)
+	DeleteSSLCertificate(name string) error
+}
+
+// ClientInterface covers every operation the connector performs against HAProxy. Client talks to
+// a single Data Plane API, MultiClient fans changes out to several; code that needs only part of
+// the operations should accept the focused interface instead.
+type ClientInterface interface {
+	ConfigurationClient
+	BackendClient
+	RuntimeServerClient
+	FrontendClient
+	HTTPRuleClient
+	UserlistClient
+	CertificateClient
 }
@@ -0,0 +1,154 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConsulTimeoutSec bounds each Consul request
+const DefaultConsulTimeoutSec = 10
+
+// ConsulLock holds a Consul KV key with a session. The session uses the release behavior, so the
+// key is freed as soon as the session expires because the leader stopped renewing it.
+type ConsulLock struct {
+	address    string
+	token      string
+	key        string
+	ttl        time.Duration
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	session string
+}
+
+// NewConsulLock creates a lock on the Consul KV key at path
+func NewConsulLock(address, token, path string, ttl time.Duration) *ConsulLock {
+	return &ConsulLock{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		key:     strings.Trim(path, "/"),
+		ttl:     ttl,
+		httpClient: &http.Client{
+			Timeout: DefaultConsulTimeoutSec * time.Second,
+		},
+	}
+}
+
+func (l *ConsulLock) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.session == "" {
+		session, err := l.createSession(ctx)
+		if err != nil {
+			return err
+		}
+		l.session = session
+	}
+
+	hostname, _ := os.Hostname()
+	var acquired bool
+	if err := l.request(ctx, http.MethodPut, "/v1/kv/"+l.key+"?acquire="+l.session, []byte(hostname), &acquired); err != nil {
+		return fmt.Errorf("failed to acquire Consul lock %s: %w", l.key, err)
+	}
+	if !acquired {
+		return ErrLockHeld
+	}
+	return nil
+}
+
+func (l *ConsulLock) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.session == "" {
+		return fmt.Errorf("no Consul session")
+	}
+	if err := l.request(ctx, http.MethodPut, "/v1/session/renew/"+l.session, nil, nil); err != nil {
+		// An expired session has released the key already
+		l.session = ""
+		return fmt.Errorf("failed to renew Consul session: %w", err)
+	}
+	return nil
+}
+
+func (l *ConsulLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.session == "" {
+		return nil
+	}
+	session := l.session
+	l.session = ""
+
+	var released bool
+	if err := l.request(ctx, http.MethodPut, "/v1/kv/"+l.key+"?release="+session, nil, &released); err != nil {
+		return fmt.Errorf("failed to release Consul lock %s: %w", l.key, err)
+	}
+	return l.request(ctx, http.MethodPut, "/v1/session/destroy/"+session, nil, nil)
+}
+
+func (l *ConsulLock) TTL() time.Duration {
+	return l.ttl
+}
+
+// createSession creates the session holding the lock
+func (l *ConsulLock) createSession(ctx context.Context) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"Name":      "haproxy-nomad-connector leader",
+		"TTL":       l.ttl.String(),
+		"Behavior":  "release",
+		"LockDelay": "0s",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var session struct {
+		ID string `json:"ID"`
+	}
+	if err := l.request(ctx, http.MethodPut, "/v1/session/create", body, &session); err != nil {
+		return "", fmt.Errorf("failed to create Consul session: %w", err)
+	}
+	return session.ID, nil
+}
+
+func (l *ConsulLock) request(ctx context.Context, method, path string, value []byte, result interface{}) error {
+	var body io.Reader = http.NoBody
+	if value != nil {
+		body = bytes.NewReader(value)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, l.address+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create Consul request: %w", err)
+	}
+	if l.token != "" {
+		req.Header.Set("X-Consul-Token", l.token)
+	}
+
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("consul request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode Consul response: %w", err)
+		}
+	}
+	return nil
+}
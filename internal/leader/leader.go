@@ -0,0 +1,106 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// Supported lock backends
+const (
+	BackendNomad  = "nomad"
+	BackendConsul = "consul"
+)
+
+// ReleaseTimeoutSec bounds releasing the lock after leadership ended
+const ReleaseTimeoutSec = 5
+
+// ErrLockHeld is returned by Acquire while another connector instance holds the lock
+var ErrLockHeld = errors.New("lock is held by another instance")
+
+// Lock is a lease shared by all connector instances of an active/standby pair. The holder has to
+// renew it within its TTL, otherwise the lease expires and a standby can take over.
+type Lock interface {
+	Acquire(ctx context.Context) error
+	Renew(ctx context.Context) error
+	Release(ctx context.Context) error
+	TTL() time.Duration
+}
+
+// NewLock creates the lock selected by the HA configuration
+func NewLock(cfg *config.Config) (Lock, error) {
+	ttl := time.Duration(cfg.HA.TTLSec) * time.Second
+	if ttl <= 0 {
+		ttl = config.DefaultHATTLSec * time.Second
+	}
+	switch cfg.HA.Backend {
+	case BackendNomad, "":
+		return NewNomadLock(&cfg.Nomad, cfg.HA.LockPath, ttl)
+	case BackendConsul:
+		return NewConsulLock(cfg.State.ConsulAddress, cfg.State.ConsulToken, cfg.HA.LockPath, ttl), nil
+	default:
+		return nil, fmt.Errorf("unknown HA backend %q (expected nomad or consul)", cfg.HA.Backend)
+	}
+}
+
+// Run campaigns for leadership until ctx is canceled. While this instance holds the lock, lead runs
+// with a context that is canceled as soon as the lease cannot be renewed; lead must return then.
+func Run(ctx context.Context, lock Lock, logger *log.Logger, lead func(ctx context.Context)) {
+	retry := lock.TTL() / 2
+	for {
+		err := lock.Acquire(ctx)
+		switch {
+		case err == nil:
+			logger.Println("Acquired leadership")
+			runAsLeader(ctx, lock, logger, lead)
+			logger.Println("Leadership ended")
+		case !errors.Is(err, ErrLockHeld) && ctx.Err() == nil:
+			logger.Printf("Warning: Failed to acquire leadership: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// runAsLeader runs lead while renewing the lease in the background, then releases the lock
+// so a standby does not have to wait for the lease to expire
+func runAsLeader(ctx context.Context, lock Lock, logger *log.Logger, lead func(ctx context.Context)) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		ticker := time.NewTicker(lock.TTL() / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-leaderCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := lock.Renew(leaderCtx); err != nil {
+				if leaderCtx.Err() == nil {
+					logger.Printf("Warning: Lost leadership, failed to renew lock: %v", err)
+				}
+				cancel()
+				return
+			}
+		}
+	}()
+
+	lead(leaderCtx)
+	cancel()
+
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), ReleaseTimeoutSec*time.Second)
+	defer cancelRelease()
+	if err := lock.Release(releaseCtx); err != nil {
+		logger.Printf("Warning: Failed to release leadership lock: %v", err)
+	}
+}
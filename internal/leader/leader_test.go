@@ -0,0 +1,154 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLock is held by another instance for the first acquire attempts and fails renewals on demand
+type fakeLock struct {
+	mu          sync.Mutex
+	heldFor     int
+	acquired    int
+	renewErr    error
+	released    int
+	renewCalled chan struct{}
+}
+
+func (l *fakeLock) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.heldFor > 0 {
+		l.heldFor--
+		return ErrLockHeld
+	}
+	l.acquired++
+	return nil
+}
+
+func (l *fakeLock) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case l.renewCalled <- struct{}{}:
+	default:
+	}
+	return l.renewErr
+}
+
+func (l *fakeLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.released++
+	return nil
+}
+
+func (l *fakeLock) TTL() time.Duration {
+	return 20 * time.Millisecond
+}
+
+func TestRunLeadsAfterLockIsFreed(t *testing.T) {
+	lock := &fakeLock{heldFor: 2, renewErr: errors.New("lease expired"), renewCalled: make(chan struct{}, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	terms := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, lock, log.New(io.Discard, "", 0), func(leaderCtx context.Context) {
+			terms++
+			// A failed renewal ends the term
+			<-leaderCtx.Done()
+			if terms == 2 {
+				cancel()
+			}
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was canceled")
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if terms != 2 || lock.acquired != 2 {
+		t.Errorf("Expected 2 leadership terms, got %d terms and %d acquisitions", terms, lock.acquired)
+	}
+	if lock.released != 2 {
+		t.Errorf("Expected the lock to be released after every term, got %d releases", lock.released)
+	}
+}
+
+func TestConsulLock(t *testing.T) {
+	var mu sync.Mutex
+	holder := ""
+	sessions := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			t.Errorf("Expected Consul token header, got %q", r.Header.Get("X-Consul-Token"))
+		}
+		switch {
+		case r.URL.Path == "/v1/session/create":
+			var session map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&session)
+			if session["TTL"] != "15s" || session["Behavior"] != "release" {
+				t.Errorf("Unexpected session %v", session)
+			}
+			sessions++
+			_ = json.NewEncoder(w).Encode(map[string]string{"ID": "session-" + string(rune('0'+sessions))})
+		case r.URL.Path == "/v1/kv/connector/leader" && r.URL.Query().Get("acquire") != "":
+			session := r.URL.Query().Get("acquire")
+			acquired := holder == "" || holder == session
+			if acquired {
+				holder = session
+			}
+			_ = json.NewEncoder(w).Encode(acquired)
+		case r.URL.Path == "/v1/kv/connector/leader" && r.URL.Query().Get("release") != "":
+			if holder == r.URL.Query().Get("release") {
+				holder = ""
+			}
+			_ = json.NewEncoder(w).Encode(true)
+		case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"), strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+			_, _ = w.Write([]byte("[]"))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.String())
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	first := NewConsulLock(server.URL, "secret", "/connector/leader/", 15*time.Second)
+	second := NewConsulLock(server.URL, "secret", "connector/leader", 15*time.Second)
+
+	if err := first.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	if err := second.Acquire(ctx); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("Expected ErrLockHeld for the standby, got %v", err)
+	}
+	if err := first.Renew(ctx); err != nil {
+		t.Fatalf("Renew() failed: %v", err)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("Release() failed: %v", err)
+	}
+	if err := second.Acquire(ctx); err != nil {
+		t.Errorf("Expected standby to take over after release, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// NomadLockRetries bounds the retries of a single lock call, so a held lock is reported quickly
+const NomadLockRetries = 1
+
+// NomadLock uses the lock of a Nomad variable (Nomad 1.7+) as leader lease
+type NomadLock struct {
+	client *nomadapi.Client
+	path   string
+	ttl    time.Duration
+	locks  *nomadapi.Locks // Handle of the current lease
+}
+
+// NewNomadLock creates a lock on the Nomad variable at path
+func NewNomadLock(cfg *config.NomadConfig, path string, ttl time.Duration) (*NomadLock, error) {
+	apiConfig := nomadapi.DefaultConfig()
+	apiConfig.Address = cfg.Address
+	apiConfig.SecretID = cfg.Token
+	apiConfig.TLSConfig = nomad.APITLSConfig(&cfg.TLS)
+	if cfg.Region != "" {
+		apiConfig.Region = cfg.Region
+	}
+
+	client, err := nomadapi.NewClient(apiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Nomad client for leader lock: %w", err)
+	}
+	return &NomadLock{client: client, path: path, ttl: ttl}, nil
+}
+
+func (l *NomadLock) Acquire(ctx context.Context) error {
+	// Every lease starts with a fresh handle, the lock ID of a released lease is stale
+	variable := nomadapi.Variable{Path: l.path, Lock: &nomadapi.VariableLock{TTL: l.ttl.String()}}
+	locks, err := l.client.Locks(nomadapi.WriteOptions{}, variable, nomadapi.LocksOptionWithMaxRetries(NomadLockRetries))
+	if err != nil {
+		return fmt.Errorf("failed to create leader lock on Nomad variable %s: %w", l.path, err)
+	}
+	if _, err := locks.Acquire(ctx); err != nil {
+		return nomadLockError(err)
+	}
+	l.locks = locks
+	return nil
+}
+
+func (l *NomadLock) Renew(ctx context.Context) error {
+	if l.locks == nil {
+		return fmt.Errorf("leader lock %s is not held", l.path)
+	}
+	return nomadLockError(l.locks.Renew(ctx))
+}
+
+func (l *NomadLock) Release(ctx context.Context) error {
+	if l.locks == nil {
+		return nil
+	}
+	locks := l.locks
+	l.locks = nil
+	return nomadLockError(locks.Release(ctx))
+}
+
+func (l *NomadLock) TTL() time.Duration {
+	return l.ttl
+}
+
+// nomadLockError maps Nomad's lock conflicts to ErrLockHeld
+func nomadLockError(err error) error {
+	if errors.Is(err, nomadapi.ErrLockConflict) {
+		return fmt.Errorf("%w: %v", ErrLockHeld, err)
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+// Package logging sets up the structured, leveled logging of the connector. Every module logs
+// through its own logger, so its level can be raised (e.g. haproxy=debug) without flooding the
+// output with the debug logs of all other modules.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Modules with their own log level, set in log.modules
+const (
+	ModuleMain      = "main"
+	ModuleConnector = "connector"
+	ModuleHAProxy   = "haproxy"
+	ModuleNomad     = "nomad"
+	ModuleConsul    = "consul"
+	ModuleDocker    = "docker"
+)
+
+// WarningPrefix marks messages of printf-style loggers that are logged at warn level
+const WarningPrefix = "Warning: "
+
+var (
+	mu           sync.RWMutex
+	output       = newHandler(FormatText, os.Stderr)
+	defaultLevel = slog.LevelInfo
+	moduleLevels = map[string]slog.Level{}
+)
+
+func newHandler(format string, w io.Writer) slog.Handler {
+	// Levels are filtered per module, the handler itself passes everything
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if format == FormatJSON {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// Setup applies the format and levels of the log config, also to loggers created before. The
+// standard library logger is redirected to the main module.
+func Setup(cfg *config.LogConfig, w io.Writer) error {
+	level, levels, err := parseConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	output = newHandler(cfg.Format, w)
+	defaultLevel = level
+	moduleLevels = levels
+	mu.Unlock()
+
+	slog.SetDefault(Logger(ModuleMain))
+	return nil
+}
+
+// Validate checks the format and levels of the log config without applying it
+func Validate(cfg *config.LogConfig) error {
+	_, _, err := parseConfig(cfg)
+	return err
+}
+
+func parseConfig(cfg *config.LogConfig) (level slog.Level, levels map[string]slog.Level, err error) {
+	switch cfg.Format {
+	case "", FormatText, FormatJSON:
+	default:
+		return level, nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	if level, err = ParseLevel(cfg.Level); err != nil {
+		return level, nil, err
+	}
+	levels = make(map[string]slog.Level, len(cfg.Modules))
+	for module, value := range cfg.Modules {
+		if levels[module], err = ParseLevel(value); err != nil {
+			return level, nil, fmt.Errorf("module %s: %w", module, err)
+		}
+	}
+	return level, levels, nil
+}
+
+// ParseLevel parses debug, info, warn or error; an empty level is info
+func ParseLevel(value string) (slog.Level, error) {
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return level, fmt.Errorf("invalid log level %q", value)
+	}
+	return level, nil
+}
+
+func levelOf(module string) slog.Level {
+	mu.RLock()
+	defer mu.RUnlock()
+	if level, ok := moduleLevels[module]; ok {
+		return level
+	}
+	return defaultLevel
+}
+
+// Logger returns the structured logger of a module, its records carry a module field
+func Logger(module string) *slog.Logger {
+	return slog.New(&moduleHandler{module: module}).With(slog.String("module", module))
+}
+
+// StdLogger returns a printf-style logger of a module for code that takes a *log.Logger.
+// Messages starting with "Warning: " are logged at warn level, everything else at info level.
+func StdLogger(module string) *log.Logger {
+	return log.New(&levelWriter{logger: Logger(module)}, "", 0)
+}
+
+// moduleHandler filters records by the level of its module and writes them to the output
+// configured when they are logged
+type moduleHandler struct {
+	module string
+	with   []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls, in order
+}
+
+func (h *moduleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levelOf(h.module)
+}
+
+func (h *moduleHandler) Handle(ctx context.Context, record slog.Record) error {
+	mu.RLock()
+	handler := output
+	mu.RUnlock()
+
+	for _, apply := range h.with {
+		handler = apply(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.add(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *moduleHandler) WithGroup(name string) slog.Handler {
+	return h.add(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *moduleHandler) add(apply func(slog.Handler) slog.Handler) *moduleHandler {
+	return &moduleHandler{module: h.module, with: append(slices.Clip(h.with), apply)}
+}
+
+// levelWriter logs the lines written by a *log.Logger
+type levelWriter struct {
+	logger *slog.Logger
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	level := slog.LevelInfo
+	if warning, ok := strings.CutPrefix(message, WarningPrefix); ok {
+		message, level = warning, slog.LevelWarn
+	}
+	w.logger.Log(context.Background(), level, message)
+	return len(p), nil
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+func setupForTest(t *testing.T, cfg *config.LogConfig) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Setup(cfg, &buf); err != nil {
+		t.Fatalf("Setup() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = Setup(&config.LogConfig{}, os.Stderr)
+	})
+	return &buf
+}
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid JSON log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestModuleLevels(t *testing.T) {
+	// Loggers created before the setup use the configured output and levels
+	haproxyLog := Logger(ModuleHAProxy)
+	connectorLog := Logger(ModuleConnector).With("service", "web")
+
+	buf := setupForTest(t, &config.LogConfig{Level: "info", Format: FormatJSON, Modules: map[string]string{ModuleHAProxy: "debug"}})
+	haproxyLog.Debug("Committed transaction", "transaction", "abc-123")
+	connectorLog.Debug("Classified service")
+	connectorLog.Info("Registered server", "backend", "web")
+
+	records := decodeRecords(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected the haproxy debug and the connector info record, got %v", records)
+	}
+	if records[0]["module"] != ModuleHAProxy || records[0]["transaction"] != "abc-123" || records[0]["level"] != "DEBUG" {
+		t.Errorf("Unexpected haproxy record: %v", records[0])
+	}
+	if records[1]["module"] != ModuleConnector || records[1]["service"] != "web" || records[1]["backend"] != "web" {
+		t.Errorf("Unexpected connector record: %v", records[1])
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	buf := setupForTest(t, &config.LogConfig{Format: FormatJSON})
+	logger := StdLogger(ModuleNomad)
+	logger.Printf("Connected to %s", "nomad")
+	logger.Printf("Warning: Event stream lagging")
+
+	records := decodeRecords(t, buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %v", records)
+	}
+	if records[0]["msg"] != "Connected to nomad" || records[0]["level"] != "INFO" {
+		t.Errorf("Unexpected info record: %v", records[0])
+	}
+	if records[1]["msg"] != "Event stream lagging" || records[1]["level"] != "WARN" || records[1]["module"] != ModuleNomad {
+		t.Errorf("Expected a warn record without the prefix, got %v", records[1])
+	}
+}
+
+func TestSetupRejectsInvalidConfig(t *testing.T) {
+	if err := Setup(&config.LogConfig{Format: "xml"}, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+	if err := Setup(&config.LogConfig{Modules: map[string]string{ModuleHAProxy: "verbose"}}, &bytes.Buffer{}); err == nil {
+		t.Error("Expected an invalid module level to be rejected")
+	}
+	if err := Validate(&config.LogConfig{Format: FormatJSON, Modules: map[string]string{ModuleHAProxy: "debug"}}); err != nil {
+		t.Errorf("Expected a valid config to pass validation, got %v", err)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for value, expected := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError} {
+		if level, err := ParseLevel(value); err != nil || level != expected {
+			t.Errorf("ParseLevel(%q) = %v, %v; expected %v", value, level, err, expected)
+		}
+	}
+}
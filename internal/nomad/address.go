@@ -0,0 +1,126 @@
+package nomad
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Address modes select which address of an instance is registered in HAProxy
+const (
+	AddressModeService = "service" // the address of the service registration (default)
+	AddressModeNode    = "node"    // the advertised IP address of the node
+
+	// AddressModeHostNetworkPrefix followed by an alias selects the node's address in that host network
+	AddressModeHostNetworkPrefix = "host_network:"
+
+	// AddressTag overrides the address mode per service
+	AddressTag = "haproxy.address="
+
+	// nodeAddressTTL is how long the addresses of a node are cached, deregistrations of allocations on
+	// a node that is gone still resolve to the address they were registered with
+	nodeAddressTTL = 10 * time.Minute
+)
+
+// ValidAddressMode checks an address mode: service, node or host_network:<alias>
+func ValidAddressMode(mode string) bool {
+	if alias, ok := strings.CutPrefix(mode, AddressModeHostNetworkPrefix); ok {
+		return alias != ""
+	}
+	return mode == AddressModeService || mode == AddressModeNode
+}
+
+// nodeAddresses are the addresses of a node, from /v1/node/:id
+type nodeAddresses struct {
+	Attributes    map[string]string `json:"Attributes"`
+	NodeResources struct {
+		NodeNetworks []struct {
+			Addresses []struct {
+				Alias   string `json:"Alias"`
+				Address string `json:"Address"`
+			} `json:"Addresses"`
+		} `json:"NodeNetworks"`
+	} `json:"NodeResources"`
+
+	fetched time.Time
+}
+
+// address returns the address of the node for an address mode, "" if the node has none
+func (n *nodeAddresses) address(mode string) string {
+	if mode == AddressModeNode {
+		return n.Attributes["unique.network.ip-address"]
+	}
+	alias := strings.TrimPrefix(mode, AddressModeHostNetworkPrefix)
+	for _, network := range n.NodeResources.NodeNetworks {
+		for _, address := range network.Addresses {
+			if address.Alias == alias {
+				return address.Address
+			}
+		}
+	}
+	return ""
+}
+
+// nodeAddressCache caches the addresses of nodes by node ID
+type nodeAddressCache struct {
+	mu    sync.Mutex
+	nodes map[string]*nodeAddresses
+}
+
+// SetAddressMode selects the address registered for services without haproxy.address tag
+func (c *Client) SetAddressMode(mode string) {
+	c.addressMode = mode
+}
+
+// resolveAddress replaces the address of a service by the one its address mode selects. The
+// address of the registration is kept when the node address can't be determined.
+func (c *Client) resolveAddress(svc *Service) {
+	mode := c.addressMode
+	for _, tag := range svc.Tags {
+		if value, ok := strings.CutPrefix(tag, AddressTag); ok && ValidAddressMode(value) {
+			mode = value
+		}
+	}
+	if mode == "" || mode == AddressModeService || svc.NodeID == "" {
+		return
+	}
+
+	node, err := c.nodeAddresses(svc.NodeID)
+	if err != nil {
+		c.logger.Printf("Warning: Keeping address %s of service %s: %v", svc.Address, svc.ServiceName, err)
+		return
+	}
+	address := node.address(mode)
+	if address == "" {
+		c.logger.Printf("Warning: Keeping address %s of service %s: node %s has no %s address", svc.Address, svc.ServiceName, svc.NodeID, mode)
+		return
+	}
+	svc.Address = address
+}
+
+// nodeAddresses returns the cached addresses of a node, fetching them when unknown or outdated.
+// Outdated addresses are still used when the node can't be fetched anymore.
+func (c *Client) nodeAddresses(nodeID string) (*nodeAddresses, error) {
+	c.nodeCache.mu.Lock()
+	defer c.nodeCache.mu.Unlock()
+
+	cached := c.nodeCache.nodes[nodeID]
+	if cached != nil && time.Since(cached.fetched) < nodeAddressTTL {
+		return cached, nil
+	}
+
+	var node nodeAddresses
+	if _, err := c.client.Raw().Query("/v1/node/"+nodeID, &node, nil); err != nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, fmt.Errorf("failed to get node %s: %w", nodeID, err)
+	}
+	node.fetched = time.Now()
+	if c.nodeCache.nodes == nil {
+		c.nodeCache.nodes = make(map[string]*nodeAddresses)
+	}
+	c.nodeCache.nodes[nodeID] = &node
+	return &node, nil
+}
@@ -0,0 +1,73 @@
+package nomad
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestResolveAddress(t *testing.T) {
+	var nodeRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/node/node-1" {
+			http.NotFound(w, r)
+			return
+		}
+		nodeRequests.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"Attributes": map[string]string{"unique.network.ip-address": "192.0.2.10"},
+			"NodeResources": map[string]interface{}{
+				"NodeNetworks": []map[string]interface{}{
+					{"Addresses": []map[string]string{{"Alias": "public", "Address": "203.0.113.10"}}},
+					{"Addresses": []map[string]string{{"Alias": "private", "Address": "10.0.0.10"}}},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "", "", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.SetAddressMode(AddressModeNode)
+
+	tests := []struct {
+		name     string
+		nodeID   string
+		tags     []string
+		expected string
+	}{
+		{name: "node address", nodeID: "node-1", expected: "192.0.2.10"},
+		{name: "host network tag", nodeID: "node-1", tags: []string{"haproxy.address=host_network:private"}, expected: "10.0.0.10"},
+		{name: "service tag", nodeID: "node-1", tags: []string{"haproxy.address=service"}, expected: "172.17.0.2"},
+		{name: "unknown host network", nodeID: "node-1", tags: []string{"haproxy.address=host_network:storage"}, expected: "172.17.0.2"},
+		{name: "unknown node", nodeID: "node-2", expected: "172.17.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &Service{ServiceName: "web", NodeID: tt.nodeID, Address: "172.17.0.2", Tags: tt.tags}
+			client.resolveAddress(svc)
+			if svc.Address != tt.expected {
+				t.Errorf("Expected address %s, got %s", tt.expected, svc.Address)
+			}
+		})
+	}
+	if requests := nodeRequests.Load(); requests != 1 {
+		t.Errorf("Expected the node to be fetched once, got %d requests", requests)
+	}
+}
+
+func TestValidAddressMode(t *testing.T) {
+	for mode, valid := range map[string]bool{
+		"service": true, "node": true, "host_network:private": true, "host_network:": false, "interface": false,
+	} {
+		if ValidAddressMode(mode) != valid {
+			t.Errorf("ValidAddressMode(%q) = %v, expected %v", mode, !valid, valid)
+		}
+	}
+}
@@ -9,22 +9,48 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	nomadapi "github.com/hashicorp/nomad/api"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
 )
 
+var streamLog = logging.Logger(logging.ModuleNomad)
+
 // Client configuration constants
 const (
 	StreamReconnectDelaySec = 5
+
+	// CheckStatusSuccess is the status of a passing Nomad service check
+	CheckStatusSuccess = "success"
 )
 
 type Client struct {
-	client  *nomadapi.Client
-	address string
-	token   string
-	region  string
-	logger  *log.Logger
+	client       *nomadapi.Client
+	streamClient *http.Client // event stream requests, which the API client doesn't cover
+	address      string
+	tokenMu      sync.RWMutex // guards token and tokenFile, the token may rotate
+	token        string
+	tokenFile    string // read again before the event stream connects (empty = token is fixed)
+	region       string
+	logger       *log.Logger
+
+	// streamStatus is notified when the event stream connects (nil) or fails (error)
+	streamStatus func(err error)
+
+	// stallTimeout reconnects a stream that received nothing, not even a heartbeat, this long (0 = never)
+	stallTimeout time.Duration
+	lastActivity atomic.Int64 // unix nanoseconds of the last data received on the stream
+
+	// watchNodes subscribes the stream to the Node topic, which needs the node:read ACL capability
+	watchNodes bool
+
+	// addressMode selects the registered address of services, node addresses need node:read
+	addressMode string
+	nodeCache   nodeAddressCache
 }
 
 // ServiceEvent represents a Nomad service registration/deregistration event
@@ -38,6 +64,33 @@ type ServiceEvent struct {
 
 type Payload struct {
 	Service *Service `json:"Service"`
+	Node    *Node    `json:"Node"`
+}
+
+// Node statuses
+const (
+	NodeStatusReady = "ready"
+	NodeStatusDown  = "down"
+)
+
+// Node is the payload of Node topic events, reduced to what the connector needs
+type Node struct {
+	ID     string `json:"ID"`
+	Name   string `json:"Name"`
+	Status string `json:"Status"`
+	// DrainStrategy is set while the node is draining
+	DrainStrategy *DrainStrategy `json:"DrainStrategy"`
+}
+
+// DrainStrategy describes an ongoing node drain
+type DrainStrategy struct {
+	Deadline         time.Duration `json:"Deadline"`
+	IgnoreSystemJobs bool          `json:"IgnoreSystemJobs"`
+}
+
+// Draining reports whether a drain of the node is in progress
+func (n *Node) Draining() bool {
+	return n.DrainStrategy != nil
 }
 
 type Service struct {
@@ -58,17 +111,29 @@ type Service struct {
 
 // ServiceCheck represents a Nomad service health check configuration
 type ServiceCheck struct {
-	Type     string        // "http", "tcp", "script", "grpc"
-	Path     string        // HTTP path for http checks
-	Method   string        // HTTP method for http checks
-	Interval time.Duration // Check interval
-	Timeout  time.Duration // Check timeout
+	Type          string        // "http", "tcp", "script", "grpc"
+	Path          string        // HTTP path for http checks
+	Method        string        // HTTP method for http checks
+	Interval      time.Duration // Check interval
+	Timeout       time.Duration // Check timeout
+	Protocol      string        // "https" for http checks against TLS upstreams
+	TLSSkipVerify bool          // Skip the certificate verification of https checks
 }
 
-// NewClient creates a new Nomad client
+// NewClient creates a new Nomad client. TLS is configured by the NOMAD_CACERT, NOMAD_CLIENT_CERT,
+// ... environment variables.
 func NewClient(address, token, region string, logger *log.Logger) (*Client, error) {
+	return NewClientWithTLS(address, token, region, nil, logger)
+}
+
+// NewClientWithTLS creates a new Nomad client whose API requests and event stream use the given
+// TLS settings (nil = the NOMAD_* environment variables)
+func NewClientWithTLS(address, token, region string, tlsConfig *nomadapi.TLSConfig, logger *log.Logger) (*Client, error) {
 	config := nomadapi.DefaultConfig()
 	config.Address = address
+	if tlsConfig != nil {
+		config.TLSConfig = tlsConfig
+	}
 
 	if token != "" {
 		config.SecretID = token
@@ -82,16 +147,36 @@ func NewClient(address, token, region string, logger *log.Logger) (*Client, erro
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Nomad client: %w", err)
 	}
+	streamClient, err := newStreamHTTPClient(config.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Client{
-		client:  client,
-		address: address,
-		token:   token,
-		region:  region,
-		logger:  logger,
+		client:       client,
+		streamClient: streamClient,
+		address:      address,
+		token:        token,
+		region:       region,
+		logger:       logger,
 	}, nil
 }
 
+// SetToken replaces the ACL token, e.g. after it was rotated. A running event stream keeps its
+// connection, it uses the new token once it reconnects.
+func (c *Client) SetToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.token = token
+	c.client.SetSecretID(token)
+}
+
+func (c *Client) currentToken() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.token
+}
+
 // StreamServiceEvents streams Nomad service events
 func (c *Client) StreamServiceEvents(ctx context.Context, eventChan chan<- ServiceEvent) error {
 	for {
@@ -100,6 +185,7 @@ func (c *Client) StreamServiceEvents(ctx context.Context, eventChan chan<- Servi
 			return ctx.Err()
 		default:
 			if err := c.streamEvents(ctx, eventChan); err != nil {
+				c.reportStreamStatus(err)
 				c.logger.Printf("Event stream error: %v", err)
 				c.logger.Printf("Reconnecting in 5 seconds...")
 
@@ -114,39 +200,82 @@ func (c *Client) StreamServiceEvents(ctx context.Context, eventChan chan<- Servi
 	}
 }
 
+// SetStreamStatusHandler registers a callback that is notified whenever the event stream
+// connects (nil error) or fails (the error causing the reconnect)
+func (c *Client) SetStreamStatusHandler(handler func(err error)) {
+	c.streamStatus = handler
+}
+
+// SetStallTimeout makes the stream reconnect when it received no data, not even one of Nomad's
+// heartbeats, for the given duration. 0 disables the detection.
+func (c *Client) SetStallTimeout(timeout time.Duration) {
+	c.stallTimeout = timeout
+}
+
+// SetWatchNodes subscribes the event stream to node events (drain, down) in addition to service events
+func (c *Client) SetWatchNodes(watch bool) {
+	c.watchNodes = watch
+}
+
+// LastActivity returns when the event stream last received data, events or heartbeats
+func (c *Client) LastActivity() time.Time {
+	if nanos := c.lastActivity.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+func (c *Client) reportStreamStatus(err error) {
+	if c.streamStatus != nil {
+		c.streamStatus(err)
+	}
+}
+
 func (c *Client) streamEvents(ctx context.Context, eventChan chan<- ServiceEvent) error {
 	// Create HTTP request for event stream
 	url := fmt.Sprintf("%s/v1/event/stream?topic=Service", c.address)
+	if c.watchNodes {
+		url += "&topic=Node"
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
+	// The watchdog cancels the request of a stream that stopped receiving data, a silently dead
+	// connection would otherwise block the decoder forever
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchdog := newStallWatchdog(c.stallTimeout, cancel)
+	defer watchdog.stop()
+
+	req, err := http.NewRequestWithContext(streamCtx, "GET", url, http.NoBody)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add authentication if token provided
-	if c.token != "" {
-		req.Header.Set("X-Nomad-Token", c.token)
+	c.reloadTokenBeforeConnect()
+	if token := c.currentToken(); token != "" {
+		req.Header.Set("X-Nomad-Token", token)
 	}
 
 	// Add headers for streaming
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Cache-Control", "no-cache")
 
-	client := &http.Client{
-		Timeout: 0, // No timeout for streaming
-	}
-
-	resp, err := client.Do(req)
+	resp, err := c.streamClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to connect to event stream: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return unauthorizedError(resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("event stream returned status %d", resp.StatusCode)
 	}
 
 	c.logger.Printf("Connected to Nomad event stream: %s", url)
+	c.lastActivity.Store(time.Now().UnixNano())
+	c.reportStreamStatus(nil)
 
 	// Process streaming JSON lines
 	decoder := json.NewDecoder(resp.Body)
@@ -160,41 +289,108 @@ func (c *Client) streamEvents(ctx context.Context, eventChan chan<- ServiceEvent
 				Events []ServiceEvent `json:"Events"`
 			}
 
-			if err := decoder.Decode(&eventWrapper); err != nil {
+			err := decoder.Decode(&eventWrapper)
+			if watchdog.stalled() {
+				return fmt.Errorf("event stream stalled: no data received for %s", c.stallTimeout)
+			}
+			if err != nil {
 				if shouldReconnect, reconnectErr := c.handleStreamError(err); shouldReconnect {
 					return reconnectErr
 				}
 				continue
 			}
+			c.lastActivity.Store(time.Now().UnixNano())
 
-			// Process each event
+			// Process each event; a busy consumer doesn't count as a stalled stream
+			watchdog.pause()
 			for _, event := range eventWrapper.Events {
-				if event.Topic == "Service" && event.Payload.Service != nil {
-					select {
-					case eventChan <- event:
+				if !relevantEvent(&event) {
+					continue
+				}
+				if event.Payload.Service != nil {
+					c.resolveAddress(event.Payload.Service)
+				}
+				select {
+				case eventChan <- event:
+					if event.Payload.Service != nil {
 						c.logger.Printf("Processed %s event for service %s",
 							event.Type, event.Payload.Service.ServiceName)
-					case <-ctx.Done():
-						return ctx.Err()
+					} else {
+						c.logger.Printf("Processed %s event for node %s", event.Type, event.Payload.Node.ID)
 					}
+				case <-ctx.Done():
+					return ctx.Err()
 				}
 			}
+			watchdog.reset()
 		}
 	}
 }
 
+// relevantEvent checks if an event of the stream is passed on: service events and node events
+func relevantEvent(event *ServiceEvent) bool {
+	switch event.Topic {
+	case "Service":
+		return event.Payload.Service != nil
+	case "Node":
+		return event.Payload.Node != nil
+	}
+	return false
+}
+
+// stallWatchdog calls cancel when it isn't reset within the timeout
+type stallWatchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+	fired   atomic.Bool
+}
+
+func newStallWatchdog(timeout time.Duration, cancel context.CancelFunc) *stallWatchdog {
+	w := &stallWatchdog{timeout: timeout}
+	if timeout > 0 {
+		w.timer = time.AfterFunc(timeout, func() {
+			w.fired.Store(true)
+			cancel()
+		})
+	}
+	return w
+}
+
+// reset restarts the timeout after data was received
+func (w *stallWatchdog) reset() {
+	if w.timer != nil && !w.fired.Load() {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+// pause stops the timeout until the next reset
+func (w *stallWatchdog) pause() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+func (w *stallWatchdog) stop() {
+	w.pause()
+}
+
+// stalled reports whether the timeout passed and the stream was canceled
+func (w *stallWatchdog) stalled() bool {
+	return w.fired.Load()
+}
+
 // handleStreamError determines if a streaming error should trigger reconnection
 func (c *Client) handleStreamError(err error) (shouldReconnect bool, reconnectErr error) {
-	c.logger.Printf("DEBUG: handleStreamError called with error: %T: %v", err, err)
+	streamLog.Debug("Event stream error", "error", err, "type", fmt.Sprintf("%T", err))
 
 	if err == io.EOF {
-		c.logger.Printf("DEBUG: EOF detected, triggering reconnection")
+		streamLog.Debug("Event stream ended, reconnecting")
 		return true, fmt.Errorf("event stream ended")
 	}
 
 	// Connection errors (like timeouts) should trigger reconnection
 	if netErr, ok := err.(*net.OpError); ok {
-		c.logger.Printf("DEBUG: Network error detected, triggering reconnection")
+		streamLog.Debug("Network error on the event stream, reconnecting", "error", err)
 		return true, fmt.Errorf("network error during event stream: %w", netErr)
 	}
 
@@ -204,12 +400,12 @@ func (c *Client) handleStreamError(err error) (shouldReconnect bool, reconnectEr
 		strings.Contains(errStr, "connection reset") ||
 		strings.Contains(errStr, "broken pipe") ||
 		strings.Contains(errStr, "unexpected EOF") {
-		c.logger.Printf("DEBUG: Connection issue detected (%s), triggering reconnection", errStr)
+		streamLog.Debug("Event stream connection lost, reconnecting", "error", err)
 		return true, fmt.Errorf("connection lost: %w", err)
 	}
 
 	c.logger.Printf("Failed to decode event: %v", err)
-	c.logger.Printf("DEBUG: Not triggering reconnection for this error type")
+	streamLog.Debug("Not reconnecting for this error", "type", fmt.Sprintf("%T", err))
 	return false, nil
 }
 
@@ -251,6 +447,7 @@ func (c *Client) GetServices() ([]*Service, error) {
 					CreateIndex: registration.CreateIndex,
 					ModifyIndex: registration.ModifyIndex,
 				}
+				c.resolveAddress(service)
 				services = append(services, service)
 			}
 		}
@@ -269,6 +466,38 @@ func (c *Client) GetJobSpec(jobID string) (*nomadapi.Job, error) {
 	return job, nil
 }
 
+// AllocationHealthy checks if a service of an allocation is healthy: all its Nomad checks pass. Before
+// the checks reported, the deployment health of the allocation decides, or whether it is running for
+// allocations outside of deployments.
+func (c *Client) AllocationHealthy(allocID, serviceName string) (bool, error) {
+	checks, err := c.client.Allocations().Checks(allocID, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get checks of allocation %s: %w", allocID, err)
+	}
+	reported := false
+	for _, check := range checks {
+		if check.Service != serviceName {
+			continue
+		}
+		if check.Status != CheckStatusSuccess {
+			return false, nil
+		}
+		reported = true
+	}
+	if reported {
+		return true, nil
+	}
+
+	alloc, _, err := c.client.Allocations().Info(allocID, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to get allocation %s: %w", allocID, err)
+	}
+	if alloc.DeploymentStatus != nil && alloc.DeploymentStatus.Healthy != nil {
+		return *alloc.DeploymentStatus.Healthy, nil
+	}
+	return alloc.DeploymentID == "" && alloc.ClientStatus == nomadapi.AllocClientStatusRunning, nil
+}
+
 // GetServiceCheckFromJob extracts the health check configuration for a specific service from a job
 func (c *Client) GetServiceCheckFromJob(jobID, serviceName string) (*ServiceCheck, error) {
 	job, err := c.GetJobSpec(jobID)
@@ -292,11 +521,13 @@ func extractServiceCheckFromJob(job *nomadapi.Job, serviceName string) (*Service
 					if len(service.Checks) > 0 {
 						check := service.Checks[0]
 						return &ServiceCheck{
-							Type:     check.Type,
-							Path:     check.Path,
-							Method:   check.Method,
-							Interval: check.Interval,
-							Timeout:  check.Timeout,
+							Type:          check.Type,
+							Path:          check.Path,
+							Method:        check.Method,
+							Interval:      check.Interval,
+							Timeout:       check.Timeout,
+							Protocol:      check.Protocol,
+							TLSSkipVerify: check.TLSSkipVerify,
 						}, nil
 					}
 					// Service found but no checks defined
@@ -311,11 +542,13 @@ func extractServiceCheckFromJob(job *nomadapi.Job, serviceName string) (*Service
 				if len(service.Checks) > 0 {
 					check := service.Checks[0]
 					return &ServiceCheck{
-						Type:     check.Type,
-						Path:     check.Path,
-						Method:   check.Method,
-						Interval: check.Interval,
-						Timeout:  check.Timeout,
+						Type:          check.Type,
+						Path:          check.Path,
+						Method:        check.Method,
+						Interval:      check.Interval,
+						Timeout:       check.Timeout,
+						Protocol:      check.Protocol,
+						TLSSkipVerify: check.TLSSkipVerify,
 					}, nil
 				}
 				return nil, nil
@@ -3,8 +3,11 @@ package nomad
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -86,8 +89,9 @@ func TestStreamReconnectsOnTimeout(t *testing.T) {
 	// Create client with detailed logging
 	logger := log.New(os.Stdout, "[test-client] ", log.LstdFlags)
 	client := &Client{
-		address: fmt.Sprintf("http://%s", serverAddr),
-		logger:  logger,
+		address:      fmt.Sprintf("http://%s", serverAddr),
+		streamClient: http.DefaultClient,
+		logger:       logger,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
@@ -113,3 +117,34 @@ func TestStreamReconnectsOnTimeout(t *testing.T) {
 		t.Errorf("Expected at least 2 connection attempts after timeout, got %d", attempts)
 	}
 }
+
+// TestStreamReconnectsWhenStalled verifies that a stream receiving no data, not even heartbeats, is given up
+func TestStreamReconnectsWhenStalled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("{}\n")) // heartbeat
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // then nothing, like a silently dead connection
+	}))
+	defer server.Close()
+
+	var statuses []error
+	client := &Client{address: server.URL, streamClient: server.Client(), logger: log.New(io.Discard, "", 0)}
+	client.SetStallTimeout(200 * time.Millisecond)
+	client.SetStreamStatusHandler(func(err error) { statuses = append(statuses, err) })
+
+	start := time.Now()
+	err := client.streamEvents(context.Background(), make(chan ServiceEvent, 1))
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Fatalf("Expected a stall error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the stall to be detected after the timeout, took %s", elapsed)
+	}
+	if len(statuses) != 1 || statuses[0] != nil {
+		t.Errorf("Expected the connect to be reported, got %v", statuses)
+	}
+	if client.LastActivity().IsZero() {
+		t.Error("Expected the heartbeat to be recorded as activity")
+	}
+}
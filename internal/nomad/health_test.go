@@ -0,0 +1,76 @@
+package nomad
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAllocationServer(t *testing.T, checks nomadapi.AllocCheckStatuses, alloc *nomadapi.Allocation) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/client/allocation/a1/checks":
+			_ = json.NewEncoder(w).Encode(checks)
+		case "/v1/allocation/a1":
+			_ = json.NewEncoder(w).Encode(alloc)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "", "", log.New(io.Discard, "", 0))
+	require.NoError(t, err)
+	return client
+}
+
+func TestAllocationHealthy(t *testing.T) {
+	healthy, unhealthy := true, false
+	running := &nomadapi.Allocation{ID: "a1", ClientStatus: nomadapi.AllocClientStatusRunning}
+	inDeployment := &nomadapi.Allocation{ID: "a1", ClientStatus: nomadapi.AllocClientStatusRunning, DeploymentID: "d1"}
+
+	tests := []struct {
+		name     string
+		checks   nomadapi.AllocCheckStatuses
+		alloc    *nomadapi.Allocation
+		expected bool
+	}{
+		{name: "checks pass", checks: nomadapi.AllocCheckStatuses{
+			"c1": {Service: "web", Status: "success"},
+			"c2": {Service: "other", Status: "failure"},
+		}, alloc: running, expected: true},
+		{name: "check fails", checks: nomadapi.AllocCheckStatuses{
+			"c1": {Service: "web", Status: "success"},
+			"c2": {Service: "web", Status: "pending"},
+		}, alloc: running, expected: false},
+		{name: "no checks outside of deployments", alloc: running, expected: true},
+		{name: "deployment health pending", alloc: inDeployment, expected: false},
+		{name: "deployment healthy", alloc: &nomadapi.Allocation{ID: "a1", DeploymentID: "d1",
+			DeploymentStatus: &nomadapi.AllocDeploymentStatus{Healthy: &healthy}}, expected: true},
+		{name: "deployment unhealthy", alloc: &nomadapi.Allocation{ID: "a1", DeploymentID: "d1",
+			DeploymentStatus: &nomadapi.AllocDeploymentStatus{Healthy: &unhealthy}}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newAllocationServer(t, tt.checks, tt.alloc)
+			healthy, err := client.AllocationHealthy("a1", "web")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, healthy)
+		})
+	}
+}
+
+func TestAllocationHealthy_UnknownAllocation(t *testing.T) {
+	client := newAllocationServer(t, nil, nil)
+	_, err := client.AllocationHealthy("missing", "web")
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package nomad
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEventsWatchNodes(t *testing.T) {
+	topics := make(chan []string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topics <- r.URL.Query()["topic"]
+		fmt.Fprintln(w, `{"Events":[`+
+			`{"Topic":"Node","Type":"NodeDrain","Payload":{"Node":{"ID":"n1","Status":"ready","DrainStrategy":{"Deadline":3600000000000}}}},`+
+			`{"Topic":"Allocation","Type":"AllocationUpdated","Payload":{"Allocation":{"ID":"a1"}}},`+
+			`{"Topic":"Service","Type":"ServiceRegistration","Payload":{"Service":{"ServiceName":"web"}}}]}`)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "", "", log.New(io.Discard, "", 0))
+	require.NoError(t, err)
+	client.SetWatchNodes(true)
+
+	events := make(chan ServiceEvent, 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = client.streamEvents(ctx, events)
+
+	assert.Equal(t, []string{"Service", "Node"}, <-topics)
+	require.Len(t, events, 2)
+	drain := <-events
+	require.NotNil(t, drain.Payload.Node)
+	assert.True(t, drain.Payload.Node.Draining())
+	assert.Equal(t, time.Hour, drain.Payload.Node.DrainStrategy.Deadline)
+	assert.Equal(t, "web", (<-events).Payload.Service.ServiceName)
+}
+
+func TestRelevantEvent(t *testing.T) {
+	assert.True(t, relevantEvent(&ServiceEvent{Topic: "Service", Payload: Payload{Service: &Service{}}}))
+	assert.True(t, relevantEvent(&ServiceEvent{Topic: "Node", Payload: Payload{Node: &Node{}}}))
+	assert.False(t, relevantEvent(&ServiceEvent{Topic: "Node"}))
+	assert.False(t, relevantEvent(&ServiceEvent{Topic: "Allocation"}))
+}
@@ -0,0 +1,46 @@
+package nomad
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// APITLSConfig returns the TLS settings of Nomad API clients: the NOMAD_CACERT, NOMAD_CAPATH,
+// NOMAD_CLIENT_CERT, ... environment variables read by the Nomad API package, overridden by the
+// configured settings
+func APITLSConfig(cfg *config.TLSConfig) *nomadapi.TLSConfig {
+	tlsConfig := nomadapi.DefaultConfig().TLSConfig
+	if cfg.CAFile != "" {
+		tlsConfig.CACert = cfg.CAFile
+	}
+	if cfg.CertFile != "" {
+		tlsConfig.ClientCert = cfg.CertFile
+	}
+	if cfg.KeyFile != "" {
+		tlsConfig.ClientKey = cfg.KeyFile
+	}
+	if cfg.ServerName != "" {
+		tlsConfig.TLSServerName = cfg.ServerName
+	}
+	if cfg.InsecureSkipVerify {
+		tlsConfig.Insecure = true
+	}
+	return tlsConfig
+}
+
+// newStreamHTTPClient creates the HTTP client of the event stream with the same TLS settings as
+// the API client. It has no timeout, the stream stays open.
+func newStreamHTTPClient(tlsConfig *nomadapi.TLSConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	client := &http.Client{Transport: transport}
+	if err := nomadapi.ConfigureTLS(client, tlsConfig); err != nil {
+		return nil, fmt.Errorf("failed to configure TLS of the event stream: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,64 @@
+package nomad
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+func TestAPITLSConfig(t *testing.T) {
+	t.Setenv("NOMAD_CACERT", "/etc/nomad/ca.pem")
+	t.Setenv("NOMAD_CLIENT_CERT", "/etc/nomad/cli.pem")
+
+	tlsConfig := APITLSConfig(&config.TLSConfig{CertFile: "/etc/connector/cert.pem", ServerName: "server.global.nomad"})
+	if tlsConfig.CACert != "/etc/nomad/ca.pem" {
+		t.Errorf("Expected NOMAD_CACERT to be kept, got %q", tlsConfig.CACert)
+	}
+	if tlsConfig.ClientCert != "/etc/connector/cert.pem" || tlsConfig.TLSServerName != "server.global.nomad" {
+		t.Errorf("Expected the configured settings to take precedence, got %+v", tlsConfig)
+	}
+}
+
+func TestStreamUsesTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	t.Setenv("NOMAD_CACERT", "")
+
+	var statuses []error
+	connect := func(tlsConfig *config.TLSConfig) {
+		client, err := NewClientWithTLS(server.URL, "", "", APITLSConfig(tlsConfig), log.New(io.Discard, "", 0))
+		if err != nil {
+			t.Fatalf("NewClientWithTLS() failed: %v", err)
+		}
+		client.SetStreamStatusHandler(func(err error) { statuses = append(statuses, err) })
+		_ = client.streamEvents(context.Background(), make(chan ServiceEvent, 1))
+	}
+
+	// Without the CA the server certificate isn't trusted
+	connect(&config.TLSConfig{})
+	if len(statuses) != 0 {
+		t.Errorf("Expected the connection to fail without the CA, got %v", statuses)
+	}
+
+	connect(&config.TLSConfig{CAFile: caFile})
+	if len(statuses) != 1 || statuses[0] != nil {
+		t.Errorf("Expected the stream to connect with the CA, got %v", statuses)
+	}
+}
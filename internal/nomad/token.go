@@ -0,0 +1,56 @@
+package nomad
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// ErrUnauthorized is returned when Nomad rejects the ACL token, e.g. because it was rotated or revoked
+var ErrUnauthorized = errors.New("nomad rejected the ACL token")
+
+// SetTokenFile makes the client read its ACL token from path, before every connect of the event
+// stream and whenever ReloadToken is called
+func (c *Client) SetTokenFile(path string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.tokenFile = path
+}
+
+// ReloadToken reads the token file again and uses the token if it changed. Without token file
+// it does nothing.
+func (c *Client) ReloadToken() (changed bool, err error) {
+	c.tokenMu.RLock()
+	path, current := c.tokenFile, c.token
+	c.tokenMu.RUnlock()
+	if path == "" {
+		return false, nil
+	}
+
+	token, err := config.ReadTokenFile(path)
+	if err != nil {
+		return false, err
+	}
+	if token == current {
+		return false, nil
+	}
+	c.SetToken(token)
+	return true, nil
+}
+
+// reloadTokenBeforeConnect picks up a rotated token before the event stream connects, a stream
+// connecting with the previous token would only get 403 responses
+func (c *Client) reloadTokenBeforeConnect() {
+	changed, err := c.ReloadToken()
+	switch {
+	case err != nil:
+		c.logger.Printf("Warning: Failed to read Nomad token file, keeping the current token: %v", err)
+	case changed:
+		c.logger.Println("Nomad ACL token changed, using the new token")
+	}
+}
+
+func unauthorizedError(statusCode int) error {
+	return fmt.Errorf("%w: event stream returned status %d", ErrUnauthorized, statusCode)
+}
@@ -0,0 +1,55 @@
+package nomad
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamReadsRotatedTokenFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Nomad-Token") != "new-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeToken := func(token string) {
+		if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0o600); err != nil {
+			t.Fatalf("Failed to write token file: %v", err)
+		}
+	}
+	writeToken("old-token")
+
+	client, err := NewClient(server.URL, "old-token", "", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	client.SetTokenFile(tokenFile)
+
+	err = client.streamEvents(context.Background(), make(chan ServiceEvent, 1))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Expected an authentication error, got %v", err)
+	}
+
+	writeToken("new-token")
+	var statuses []error
+	client.SetStreamStatusHandler(func(err error) { statuses = append(statuses, err) })
+	_ = client.streamEvents(context.Background(), make(chan ServiceEvent, 1))
+	if len(statuses) != 1 || statuses[0] != nil {
+		t.Errorf("Expected the stream to connect with the rotated token, got %v", statuses)
+	}
+	if changed, err := client.ReloadToken(); changed || err != nil {
+		t.Errorf("Expected the unchanged token to be kept, got %v (%v)", changed, err)
+	}
+}
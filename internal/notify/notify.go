@@ -0,0 +1,218 @@
+// Package notify alerts webhooks and Slack channels about problems of the connector that otherwise
+// only show in its logs. Alerts are sent in the background and rate limited per kind, so a problem
+// that persists or flaps doesn't flood the receivers.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
+)
+
+// Kinds of alerts
+const (
+	KindEventFailures      = "event_failures"
+	KindDrift              = "drift"
+	KindHAProxyUnavailable = "haproxy_unavailable"
+)
+
+// Alert statuses
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// queueSize bounds the alerts waiting to be sent, further alerts are dropped while the receivers are slow
+const queueSize = 64
+
+var notifyLog = logging.Logger(logging.ModuleMain)
+
+// Alert is the body of the generic webhook requests
+type Alert struct {
+	Kind       string    `json:"kind"`
+	Status     string    `json:"status"`
+	Summary    string    `json:"summary"`
+	Details    string    `json:"details,omitempty"`
+	Instance   string    `json:"instance"`             // host name of the connector
+	Suppressed int       `json:"suppressed,omitempty"` // alerts of the kind held back by the rate limit since the last one
+	Time       time.Time `json:"time"`
+}
+
+// Notifier sends alerts to the configured webhooks. A nil notifier sends nothing, so callers don't
+// have to check whether notifications are enabled.
+type Notifier struct {
+	webhookURLs []string
+	slackURLs   []string
+	minInterval time.Duration
+	instance    string
+	httpClient  *http.Client
+	queue       chan Alert
+
+	mu    sync.Mutex
+	kinds map[string]*kindState
+}
+
+// kindState tracks the alerts of one kind for the rate limit
+type kindState struct {
+	firing     bool // a firing alert was sent and not resolved yet
+	lastSent   time.Time
+	suppressed int
+}
+
+// New creates a notifier sending to the configured webhooks, nil if notifications are disabled
+func New(cfg *config.NotificationsConfig) *Notifier {
+	if !cfg.Enabled {
+		return nil
+	}
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultNotifyTimeoutSec * time.Second
+	}
+	instance, _ := os.Hostname()
+
+	n := &Notifier{
+		webhookURLs: cfg.WebhookURLs,
+		slackURLs:   cfg.SlackWebhookURLs,
+		minInterval: time.Duration(cfg.MinIntervalSec) * time.Second,
+		instance:    instance,
+		httpClient:  &http.Client{Timeout: timeout},
+		queue:       make(chan Alert, queueSize),
+		kinds:       make(map[string]*kindState),
+	}
+	go n.run()
+	return n
+}
+
+// Fire alerts about a problem. An alert of a kind that was sent within the minimum interval is
+// held back and counted in the next one.
+func (n *Notifier) Fire(kind, summary, details string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	state := n.state(kind)
+	now := time.Now()
+	if !state.lastSent.IsZero() && now.Sub(state.lastSent) < n.minInterval {
+		state.suppressed++
+		n.mu.Unlock()
+		return
+	}
+	alert := Alert{Kind: kind, Status: StatusFiring, Summary: summary, Details: details, Suppressed: state.suppressed, Time: now}
+	state.firing = true
+	state.lastSent = now
+	state.suppressed = 0
+	n.mu.Unlock()
+
+	n.enqueue(alert)
+}
+
+// Resolve reports that the problem of a kind is gone. Only problems that were alerted about are
+// resolved, regardless of the rate limit.
+func (n *Notifier) Resolve(kind, summary string) {
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	state := n.state(kind)
+	if !state.firing {
+		n.mu.Unlock()
+		return
+	}
+	state.firing = false
+	state.suppressed = 0
+	n.mu.Unlock()
+
+	n.enqueue(Alert{Kind: kind, Status: StatusResolved, Summary: summary, Time: time.Now()})
+}
+
+// state returns the state of a kind; n.mu must be held
+func (n *Notifier) state(kind string) *kindState {
+	state, ok := n.kinds[kind]
+	if !ok {
+		state = &kindState{}
+		n.kinds[kind] = state
+	}
+	return state
+}
+
+func (n *Notifier) enqueue(alert Alert) {
+	alert.Instance = n.instance
+	select {
+	case n.queue <- alert:
+	default:
+		notifyLog.Warn("Dropped alert, the notification webhooks are too slow", "kind", alert.Kind, "summary", alert.Summary)
+	}
+}
+
+// run sends the queued alerts to all webhooks
+func (n *Notifier) run() {
+	for alert := range n.queue {
+		n.send(alert)
+	}
+}
+
+// send posts an alert to every webhook, failures are logged and not retried
+func (n *Notifier) send(alert Alert) {
+	for _, url := range n.webhookURLs {
+		if err := n.post(url, alert); err != nil {
+			notifyLog.Warn("Failed to send alert", "kind", alert.Kind, "error", err)
+		}
+	}
+	for _, url := range n.slackURLs {
+		if err := n.post(url, slackMessage(&alert)); err != nil {
+			notifyLog.Warn("Failed to send alert to Slack", "kind", alert.Kind, "error", err)
+		}
+	}
+}
+
+func (n *Notifier) post(url string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook failed: status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// slackMessage formats an alert for a Slack incoming webhook
+func slackMessage(alert *Alert) map[string]string {
+	icon := ":rotating_light:"
+	if alert.Status == StatusResolved {
+		icon = ":white_check_mark:"
+	}
+	text := fmt.Sprintf("%s *haproxy-nomad-connector* on %s: %s", icon, alert.Instance, alert.Summary)
+	if alert.Details != "" {
+		text += "\n```" + alert.Details + "```"
+	}
+	if alert.Suppressed > 0 {
+		text += fmt.Sprintf("\n_%d similar alerts were held back_", alert.Suppressed)
+	}
+	return map[string]string{"text": text}
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// receiver records the requests of a webhook
+type receiver struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var body map[string]interface{}
+	if req.Method != http.MethodPost || json.NewDecoder(req.Body).Decode(&body) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.bodies = append(r.bodies, body)
+	r.mu.Unlock()
+}
+
+// wait returns the received bodies once there are n of them
+func (r *receiver) wait(t *testing.T, n int) []map[string]interface{} {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		bodies := append([]map[string]interface{}(nil), r.bodies...)
+		r.mu.Unlock()
+		if len(bodies) >= n || time.Now().After(deadline) {
+			if len(bodies) != n {
+				t.Fatalf("Expected %d requests, got %d: %v", n, len(bodies), bodies)
+			}
+			return bodies
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNilNotifierSendsNothing(t *testing.T) {
+	n := New(&config.NotificationsConfig{WebhookURLs: []string{"http://hook"}})
+	if n != nil {
+		t.Fatalf("Expected no notifier while notifications are disabled")
+	}
+	n.Fire(KindDrift, "drift", "")
+	n.Resolve(KindDrift, "in sync")
+}
+
+func TestNotifierSendsToWebhookAndSlack(t *testing.T) {
+	webhook, slack := &receiver{}, &receiver{}
+	webhookServer, slackServer := httptest.NewServer(webhook), httptest.NewServer(slack)
+	defer webhookServer.Close()
+	defer slackServer.Close()
+
+	n := New(&config.NotificationsConfig{
+		Enabled:          true,
+		WebhookURLs:      []string{webhookServer.URL},
+		SlackWebhookURLs: []string{slackServer.URL},
+		MinIntervalSec:   3600,
+	})
+	n.Fire(KindHAProxyUnavailable, "HAProxy Data Plane API is unreachable", "connection refused")
+	n.Resolve(KindHAProxyUnavailable, "HAProxy Data Plane API is reachable again")
+
+	alerts := webhook.wait(t, 2)
+	if alerts[0]["kind"] != KindHAProxyUnavailable || alerts[0]["status"] != StatusFiring || alerts[0]["details"] != "connection refused" {
+		t.Errorf("Expected the firing alert, got %v", alerts[0])
+	}
+	if alerts[1]["status"] != StatusResolved {
+		t.Errorf("Expected the resolved alert, got %v", alerts[1])
+	}
+
+	messages := slack.wait(t, 2)
+	text, _ := messages[0]["text"].(string)
+	if !strings.Contains(text, ":rotating_light:") || !strings.Contains(text, "connection refused") {
+		t.Errorf("Expected a Slack message with the alert, got %q", text)
+	}
+}
+
+func TestNotifierRateLimitsPerKind(t *testing.T) {
+	webhook := &receiver{}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	n := New(&config.NotificationsConfig{Enabled: true, WebhookURLs: []string{server.URL}, MinIntervalSec: 3600})
+	n.Fire(KindEventFailures, "3 events failed", "")
+	n.Fire(KindEventFailures, "4 events failed", "")
+	n.Fire(KindEventFailures, "5 events failed", "")
+	n.Fire(KindDrift, "drift", "")
+	n.Resolve(KindHAProxyUnavailable, "never alerted")
+	webhook.wait(t, 2)
+
+	n.mu.Lock()
+	suppressed := n.kinds[KindEventFailures].suppressed
+	n.kinds[KindEventFailures].lastSent = time.Now().Add(-2 * time.Hour)
+	n.mu.Unlock()
+	if suppressed != 2 {
+		t.Errorf("Expected 2 suppressed alerts, got %d", suppressed)
+	}
+
+	n.Fire(KindEventFailures, "6 events failed", "")
+	alerts := webhook.wait(t, 3)
+	if alerts[2]["summary"] != "6 events failed" || alerts[2]["suppressed"] != float64(2) {
+		t.Errorf("Expected the repeated alert to count the suppressed ones, got %v", alerts[2])
+	}
+}
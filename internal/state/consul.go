@@ -0,0 +1,90 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultConsulTimeoutSec bounds each Consul KV request
+const DefaultConsulTimeoutSec = 10
+
+// ConsulStore keeps each key in the Consul KV store below a prefix
+type ConsulStore struct {
+	address    string
+	token      string
+	prefix     string
+	httpClient *http.Client
+}
+
+// NewConsulStore creates a store using the Consul HTTP API at address
+func NewConsulStore(address, token, prefix string) *ConsulStore {
+	return &ConsulStore{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		prefix:  strings.Trim(prefix, "/"),
+		httpClient: &http.Client{
+			Timeout: DefaultConsulTimeoutSec * time.Second,
+		},
+	}
+}
+
+func (s *ConsulStore) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.request(ctx, http.MethodGet, key+"?raw", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state %s from Consul: %w", key, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read state %s from Consul: status %d: %s", key, resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+func (s *ConsulStore) Put(ctx context.Context, key string, value []byte) error {
+	resp, err := s.request(ctx, http.MethodPut, key, value)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "true" {
+		return fmt.Errorf("failed to write state %s to Consul: status %d: %s", key, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (s *ConsulStore) request(ctx context.Context, method, key string, value []byte) (*http.Response, error) {
+	url := fmt.Sprintf("%s/v1/kv/%s/%s", s.address, s.prefix, key)
+
+	var body io.Reader = http.NoBody
+	if value != nil {
+		body = bytes.NewReader(value)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Consul request: %w", err)
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consul request failed: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/nomad"
+)
+
+// NomadPutAttempts bounds the retries of a Put that lost a check-and-set race against another connector
+const NomadPutAttempts = 3
+
+// NomadStore keeps all keys as items of a single Nomad variable. Values are base64 encoded because
+// variable items are strings. Writes use check-and-set, so connectors sharing the variable don't
+// overwrite each other's keys.
+type NomadStore struct {
+	variables *nomadapi.Variables
+	path      string
+}
+
+// NewNomadStore creates a store for the Nomad variable at path
+func NewNomadStore(cfg *config.NomadConfig, path string) (*NomadStore, error) {
+	apiConfig := nomadapi.DefaultConfig()
+	apiConfig.Address = cfg.Address
+	apiConfig.SecretID = cfg.Token
+	apiConfig.TLSConfig = nomad.APITLSConfig(&cfg.TLS)
+	if cfg.Region != "" {
+		apiConfig.Region = cfg.Region
+	}
+
+	client, err := nomadapi.NewClient(apiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Nomad client for state: %w", err)
+	}
+	return &NomadStore{variables: client.Variables(), path: path}, nil
+}
+
+func (s *NomadStore) Get(ctx context.Context, key string) ([]byte, error) {
+	variable, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if variable == nil {
+		return nil, ErrNotFound
+	}
+
+	encoded, ok := variable.Items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	value, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state %s from Nomad variable %s: %w", key, s.path, err)
+	}
+	return value, nil
+}
+
+func (s *NomadStore) Put(ctx context.Context, key string, value []byte) error {
+	var err error
+	for attempt := 0; attempt < NomadPutAttempts; attempt++ {
+		var variable *nomadapi.Variable
+		if variable, err = s.read(ctx); err != nil {
+			return err
+		}
+		if variable == nil {
+			variable = nomadapi.NewVariable(s.path)
+		}
+		if variable.Items == nil {
+			variable.Items = make(nomadapi.VariableItems)
+		}
+		variable.Items[key] = base64.StdEncoding.EncodeToString(value)
+
+		opts := (&nomadapi.WriteOptions{}).WithContext(ctx)
+		if _, _, err = s.variables.CheckedUpdate(variable, opts); err == nil {
+			return nil
+		}
+		if !errors.As(err, &nomadapi.ErrCASConflict{}) {
+			break
+		}
+	}
+	return fmt.Errorf("failed to write state %s to Nomad variable %s: %w", key, s.path, err)
+}
+
+// read returns the variable, or nil if it doesn't exist yet
+func (s *NomadStore) read(ctx context.Context) (*nomadapi.Variable, error) {
+	variable, _, err := s.variables.Peek(s.path, (&nomadapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Nomad variable %s: %w", s.path, err)
+	}
+	return variable, nil
+}
@@ -0,0 +1,39 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// Supported state backends
+const (
+	BackendFile   = "file"
+	BackendConsul = "consul"
+	BackendNomad  = "nomad"
+)
+
+// ErrNotFound is returned by Get for keys that have not been stored yet
+var ErrNotFound = errors.New("state key not found")
+
+// Store persists small pieces of connector state (e.g. the ACME account key) by key
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, value []byte) error
+}
+
+// NewStore creates the store selected by the state configuration
+func NewStore(cfg *config.Config) (Store, error) {
+	switch cfg.State.Backend {
+	case BackendFile, "":
+		return NewFileStore(cfg.State.Dir), nil
+	case BackendConsul:
+		return NewConsulStore(cfg.State.ConsulAddress, cfg.State.ConsulToken, cfg.State.Prefix), nil
+	case BackendNomad:
+		return NewNomadStore(&cfg.Nomad, cfg.State.Prefix)
+	default:
+		return nil, fmt.Errorf("unknown state backend %q (expected file, consul or nomad)", cfg.State.Backend)
+	}
+}
@@ -0,0 +1,138 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// testStoreRoundTrip checks the behavior every store implementation must share
+func testStoreRoundTrip(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "acme_account.pem"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound for missing key, got %v", err)
+	}
+
+	if err := store.Put(ctx, "acme_account.pem", []byte("key-1")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if err := store.Put(ctx, "other", []byte("other")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if err := store.Put(ctx, "acme_account.pem", []byte("key-2")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+
+	value, err := store.Get(ctx, "acme_account.pem")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if string(value) != "key-2" {
+		t.Errorf("Expected key-2, got %q", value)
+	}
+	if value, _ := store.Get(ctx, "other"); string(value) != "other" {
+		t.Errorf("Expected other key to be kept, got %q", value)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	testStoreRoundTrip(t, NewFileStore(t.TempDir()+"/state"))
+}
+
+func TestConsulStore(t *testing.T) {
+	var mu sync.Mutex
+	kv := map[string]string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			t.Errorf("Expected Consul token header, got %q", r.Header.Get("X-Consul-Token"))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		switch r.Method {
+		case http.MethodGet:
+			value, ok := kv[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(value))
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			kv[key] = string(body)
+			_, _ = w.Write([]byte("true"))
+		}
+	}))
+	defer server.Close()
+
+	testStoreRoundTrip(t, NewConsulStore(server.URL, "secret", "connector/"))
+
+	if _, ok := kv["connector/acme_account.pem"]; !ok {
+		t.Errorf("Expected key below prefix, got %v", kv)
+	}
+}
+
+func TestNomadStore(t *testing.T) {
+	var mu sync.Mutex
+	var variable *nomadapi.Variable
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path != "/v1/var/connector" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if variable == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(variable)
+		case http.MethodPut:
+			var update nomadapi.Variable
+			_ = json.NewDecoder(r.Body).Decode(&update)
+			expectedCAS := "0"
+			if variable != nil {
+				expectedCAS = "1"
+			}
+			if cas := r.URL.Query().Get("cas"); cas != expectedCAS {
+				t.Errorf("Expected check-and-set index %s, got %s", expectedCAS, cas)
+			}
+			update.ModifyIndex = 1
+			variable = &update
+			_ = json.NewEncoder(w).Encode(variable)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewStore(&config.Config{
+		Nomad: config.NomadConfig{Address: server.URL},
+		State: config.StateConfig{Backend: BackendNomad, Prefix: "connector"},
+	})
+	if err != nil {
+		t.Fatalf("NewStore() failed: %v", err)
+	}
+	testStoreRoundTrip(t, store)
+}
+
+func TestNewStoreUnknownBackend(t *testing.T) {
+	if _, err := NewStore(&config.Config{State: config.StateConfig{Backend: "etcd"}}); err == nil {
+		t.Error("Expected error for unknown state backend")
+	}
+}
@@ -0,0 +1,165 @@
+// Package tracing records OpenTelemetry spans of the event processing and exports them over
+// OTLP/HTTP with the OpenTelemetry SDK. Without Setup, or with tracing disabled, Start returns nil
+// spans whose methods do nothing, so instrumented code doesn't have to check whether tracing is on.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+	"github.com/pscheit/haproxy-nomad-connector/internal/logging"
+)
+
+// TraceparentHeader carries the trace context of a request (W3C Trace Context)
+const TraceparentHeader = "traceparent"
+
+// instrumentationName is the instrumentation scope of the connector's spans
+const instrumentationName = "github.com/pscheit/haproxy-nomad-connector"
+
+var exportLog = logging.Logger(logging.ModuleMain)
+
+// Attr is an attribute of a span
+type Attr = attribute.KeyValue
+
+// String creates a string attribute
+func String(key, value string) Attr {
+	return attribute.String(key, value)
+}
+
+// Int creates an integer attribute
+func Int(key string, value int) Attr {
+	return attribute.Int(key, value)
+}
+
+// Span is an operation of a trace. A nil span is valid and records nothing.
+type Span struct {
+	span trace.Span
+}
+
+// tracer is the provider spans are recorded with, and its tracer
+type tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// active is the tracer of the current Setup, nil while tracing is disabled
+var active atomic.Pointer[tracer]
+
+// propagator writes the trace context of outgoing requests
+var propagator = propagation.TraceContext{}
+
+// Setup starts exporting spans as configured, replacing the exporter of a previous Setup. The
+// returned function flushes the spans still queued and stops exporting.
+func Setup(cfg *config.TracingConfig, version string) func(context.Context) error {
+	if !cfg.Enabled {
+		if previous := active.Swap(nil); previous != nil {
+			go shutdown(context.Background(), previous)
+		}
+		return func(context.Context) error { return nil }
+	}
+
+	t := newTracer(cfg, version)
+	if previous := active.Swap(t); previous != nil {
+		go shutdown(context.Background(), previous)
+	}
+	return func(ctx context.Context) error {
+		active.CompareAndSwap(t, nil)
+		return t.provider.Shutdown(ctx)
+	}
+}
+
+func newTracer(cfg *config.TracingConfig, version string) *tracer {
+	ratio := cfg.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	// The client only fails on invalid options, which the endpoint validation rules out; failed
+	// exports are reported to the error handler
+	exporter, _ := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(cfg.Endpoint, "/")+"/v1/traces"),
+		otlptracehttp.WithHeaders(cfg.Headers))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		exportLog.Warn("Failed to export spans", "error", err)
+	}))
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", cfg.ServiceName)}
+	if version != "" {
+		attrs = append(attrs, attribute.String("service.version", version))
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	return &tracer{provider: provider, tracer: provider.Tracer(instrumentationName, trace.WithInstrumentationVersion(version))}
+}
+
+func shutdown(ctx context.Context, t *tracer) {
+	if err := t.provider.Shutdown(ctx); err != nil {
+		exportLog.Warn("Failed to export the remaining spans", "error", err)
+	}
+}
+
+// Start begins a span as child of the span in ctx, or a new trace if ctx has none. New traces are
+// sampled by the configured ratio; the returned context carries the span for its children.
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, trace.SpanKindInternal, attrs)
+}
+
+// StartClient begins a span of a request to another service, e.g. the Data Plane API
+func StartClient(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, trace.SpanKindClient, attrs)
+}
+
+func start(ctx context.Context, name string, kind trace.SpanKind, attrs []Attr) (context.Context, *Span) {
+	t := active.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+	return ctx, &Span{span: span}
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// RecordError marks the span as failed with err, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End completes the span and queues it for export, later calls do nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// Inject sets the traceparent header of an outgoing request to the span in ctx, so the called
+// service can continue the trace
+func Inject(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
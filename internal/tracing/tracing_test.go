@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pscheit/haproxy-nomad-connector/internal/config"
+)
+
+// collector records the export requests of the spans
+type collector struct {
+	mu       sync.Mutex
+	requests []*collectortrace.ExportTraceServiceRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	request := &collectortrace.ExportTraceServiceRequest{}
+	if r.URL.Path != "/v1/traces" || err != nil || proto.Unmarshal(body, request) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, request)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+}
+
+func (c *collector) spans() map[string]*tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]*tracepb.Span)
+	for _, request := range c.requests {
+		for _, resourceSpans := range request.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func setupForTest(t *testing.T, cfg *config.TracingConfig) func(context.Context) error {
+	t.Helper()
+	shutdown := Setup(cfg, "test")
+	t.Cleanup(func() {
+		_ = shutdown(context.Background())
+	})
+	return shutdown
+}
+
+func TestDisabledTracingRecordsNothing(t *testing.T) {
+	setupForTest(t, &config.TracingConfig{})
+
+	ctx, span := Start(context.Background(), "event")
+	if span != nil {
+		t.Fatalf("Expected no span while tracing is disabled")
+	}
+	span.SetAttributes(String("service.name", "web"))
+	span.RecordError(errors.New("failed"))
+	span.End()
+
+	header := http.Header{}
+	Inject(ctx, header)
+	if header.Get(TraceparentHeader) != "" {
+		t.Errorf("Expected no traceparent header, got %q", header.Get(TraceparentHeader))
+	}
+}
+
+func TestSpansAreExported(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	shutdown := setupForTest(t, &config.TracingConfig{
+		Enabled:     true,
+		Endpoint:    server.URL + "/",
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+		ServiceName: "connector",
+		SampleRatio: 1,
+	})
+
+	ctx, event := Start(context.Background(), "process event", String("service.name", "web"))
+	requestCtx, request := StartClient(ctx, "haproxy PUT", Int("http.response.status_code", 500))
+	header := http.Header{}
+	Inject(requestCtx, header)
+	request.RecordError(errors.New("internal error"))
+	request.End()
+	event.End()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(shutdownCtx); err != nil {
+		t.Fatalf("shutdown() failed: %v", err)
+	}
+
+	spans := c.spans()
+	parent, child := spans["process event"], spans["haproxy PUT"]
+	if parent == nil || child == nil {
+		t.Fatalf("Expected both spans to be exported, got %v", spans)
+	}
+	if string(child.TraceId) != string(parent.TraceId) || string(child.ParentSpanId) != string(parent.SpanId) || len(parent.ParentSpanId) != 0 {
+		t.Errorf("Expected the request span to be a child of the event span, got %+v and %+v", parent, child)
+	}
+	if child.Kind != tracepb.Span_SPAN_KIND_CLIENT || child.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR ||
+		child.Status.GetMessage() != "internal error" {
+		t.Errorf("Expected a failed client span, got %+v", child)
+	}
+	if len(parent.Attributes) != 1 || parent.Attributes[0].Value.GetStringValue() != "web" {
+		t.Errorf("Expected the service.name attribute, got %+v", parent.Attributes)
+	}
+	if len(child.Attributes) != 1 || child.Attributes[0].Value.GetIntValue() != 500 {
+		t.Errorf("Expected the status code attribute, got %+v", child.Attributes)
+	}
+
+	want := "00-" + hex.EncodeToString(child.TraceId) + "-" + hex.EncodeToString(child.SpanId) + "-01"
+	if header.Get(TraceparentHeader) != want {
+		t.Errorf("Expected traceparent %q, got %q", want, header.Get(TraceparentHeader))
+	}
+	if got := c.headers[0].Get("X-Api-Key"); got != "secret" {
+		t.Errorf("Expected the configured export header, got %q", got)
+	}
+	resource := c.requests[0].ResourceSpans[0].Resource.Attributes
+	if resource[0].Key != "service.name" || resource[0].Value.GetStringValue() != "connector" {
+		t.Errorf("Expected the service name resource attribute, got %+v", resource)
+	}
+}
+
+func TestSampleRatio(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	shutdown := setupForTest(t, &config.TracingConfig{Enabled: true, Endpoint: server.URL, ServiceName: "connector", SampleRatio: 0.000001})
+	ctx, event := Start(context.Background(), "process event")
+	_, request := StartClient(ctx, "haproxy GET")
+	request.End()
+	event.End()
+
+	header := http.Header{}
+	Inject(ctx, header)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown() failed: %v", err)
+	}
+	if spans := c.spans(); len(spans) != 0 {
+		t.Errorf("Expected the unsampled trace not to be exported, got %v", spans)
+	}
+	if got := header.Get(TraceparentHeader); got == "" || got[len(got)-2:] != "00" {
+		t.Errorf("Expected the trace context to be passed on as not sampled, got %q", got)
+	}
+}